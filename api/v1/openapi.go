@@ -0,0 +1,9 @@
+package v1
+
+import _ "embed"
+
+// OpenAPISpec is the OpenAPI 3 description of the v1 HTTP API.
+// Keep it in sync with the handlers in internal/server and the types in this package.
+//
+//go:embed openapi.json
+var OpenAPISpec []byte
@@ -0,0 +1,6 @@
+package pb
+
+// The generated code is checked in. Regenerate it after editing
+// api/proto/heliosdb/v1/heliosdb.proto; this needs buf, protoc-gen-go,
+// protoc-gen-go-grpc and protoc-gen-grpc-gateway on the PATH.
+//go:generate sh -c "cd ../../proto && buf lint && buf generate --path heliosdb"
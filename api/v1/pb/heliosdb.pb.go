@@ -0,0 +1,951 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: heliosdb/v1/heliosdb.proto
+
+// Package heliosdb.v1 is the gRPC form of the HeliosDB v1 API. The HTTP
+// annotations map every method onto the same path and verb as the REST API,
+// so a grpc-gateway generated from this file serves the familiar URLs.
+
+package pb
+
+import (
+	_ "google.golang.org/genproto/googleapis/api/annotations"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type GetRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Key   string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	// stale (the default), lease or strong.
+	Consistency   string `protobuf:"bytes,2,opt,name=consistency,proto3" json:"consistency,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetRequest) Reset() {
+	*x = GetRequest{}
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetRequest) ProtoMessage() {}
+
+func (x *GetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRequest.ProtoReflect.Descriptor instead.
+func (*GetRequest) Descriptor() ([]byte, []int) {
+	return file_heliosdb_v1_heliosdb_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *GetRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *GetRequest) GetConsistency() string {
+	if x != nil {
+		return x.Consistency
+	}
+	return ""
+}
+
+type GetResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Value         string                 `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
+	Version       uint64                 `protobuf:"varint,2,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetResponse) Reset() {
+	*x = GetResponse{}
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetResponse) ProtoMessage() {}
+
+func (x *GetResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetResponse.ProtoReflect.Descriptor instead.
+func (*GetResponse) Descriptor() ([]byte, []int) {
+	return file_heliosdb_v1_heliosdb_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetResponse) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+func (x *GetResponse) GetVersion() uint64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type SetRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Value         string                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetRequest) Reset() {
+	*x = SetRequest{}
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetRequest) ProtoMessage() {}
+
+func (x *SetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetRequest.ProtoReflect.Descriptor instead.
+func (*SetRequest) Descriptor() ([]byte, []int) {
+	return file_heliosdb_v1_heliosdb_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SetRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *SetRequest) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+type SetResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetResponse) Reset() {
+	*x = SetResponse{}
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetResponse) ProtoMessage() {}
+
+func (x *SetResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetResponse.ProtoReflect.Descriptor instead.
+func (*SetResponse) Descriptor() ([]byte, []int) {
+	return file_heliosdb_v1_heliosdb_proto_rawDescGZIP(), []int{3}
+}
+
+type DeleteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteRequest) Reset() {
+	*x = DeleteRequest{}
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteRequest) ProtoMessage() {}
+
+func (x *DeleteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteRequest.ProtoReflect.Descriptor instead.
+func (*DeleteRequest) Descriptor() ([]byte, []int) {
+	return file_heliosdb_v1_heliosdb_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *DeleteRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+type DeleteResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteResponse) Reset() {
+	*x = DeleteResponse{}
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteResponse) ProtoMessage() {}
+
+func (x *DeleteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteResponse.ProtoReflect.Descriptor instead.
+func (*DeleteResponse) Descriptor() ([]byte, []int) {
+	return file_heliosdb_v1_heliosdb_proto_rawDescGZIP(), []int{5}
+}
+
+type EvalRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Script        string                 `protobuf:"bytes,1,opt,name=script,proto3" json:"script,omitempty"`
+	Args          []string               `protobuf:"bytes,2,rep,name=args,proto3" json:"args,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EvalRequest) Reset() {
+	*x = EvalRequest{}
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EvalRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EvalRequest) ProtoMessage() {}
+
+func (x *EvalRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EvalRequest.ProtoReflect.Descriptor instead.
+func (*EvalRequest) Descriptor() ([]byte, []int) {
+	return file_heliosdb_v1_heliosdb_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *EvalRequest) GetScript() string {
+	if x != nil {
+		return x.Script
+	}
+	return ""
+}
+
+func (x *EvalRequest) GetArgs() []string {
+	if x != nil {
+		return x.Args
+	}
+	return nil
+}
+
+type EvalResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The script's "result" global.
+	Result string `protobuf:"bytes,1,opt,name=result,proto3" json:"result,omitempty"`
+	// The keys the script wrote.
+	Keys          []string `protobuf:"bytes,2,rep,name=keys,proto3" json:"keys,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EvalResponse) Reset() {
+	*x = EvalResponse{}
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EvalResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EvalResponse) ProtoMessage() {}
+
+func (x *EvalResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EvalResponse.ProtoReflect.Descriptor instead.
+func (*EvalResponse) Descriptor() ([]byte, []int) {
+	return file_heliosdb_v1_heliosdb_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *EvalResponse) GetResult() string {
+	if x != nil {
+		return x.Result
+	}
+	return ""
+}
+
+func (x *EvalResponse) GetKeys() []string {
+	if x != nil {
+		return x.Keys
+	}
+	return nil
+}
+
+type BeginRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// last_write_wins, occ or serializable; empty for the node's default.
+	Isolation     string `protobuf:"bytes,1,opt,name=isolation,proto3" json:"isolation,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BeginRequest) Reset() {
+	*x = BeginRequest{}
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BeginRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BeginRequest) ProtoMessage() {}
+
+func (x *BeginRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BeginRequest.ProtoReflect.Descriptor instead.
+func (*BeginRequest) Descriptor() ([]byte, []int) {
+	return file_heliosdb_v1_heliosdb_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *BeginRequest) GetIsolation() string {
+	if x != nil {
+		return x.Isolation
+	}
+	return ""
+}
+
+type BeginResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TxId          string                 `protobuf:"bytes,1,opt,name=tx_id,json=txId,proto3" json:"tx_id,omitempty"`
+	Isolation     string                 `protobuf:"bytes,2,opt,name=isolation,proto3" json:"isolation,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BeginResponse) Reset() {
+	*x = BeginResponse{}
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BeginResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BeginResponse) ProtoMessage() {}
+
+func (x *BeginResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BeginResponse.ProtoReflect.Descriptor instead.
+func (*BeginResponse) Descriptor() ([]byte, []int) {
+	return file_heliosdb_v1_heliosdb_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *BeginResponse) GetTxId() string {
+	if x != nil {
+		return x.TxId
+	}
+	return ""
+}
+
+func (x *BeginResponse) GetIsolation() string {
+	if x != nil {
+		return x.Isolation
+	}
+	return ""
+}
+
+type Operation struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// get, set or delete.
+	Op  string `protobuf:"bytes,1,opt,name=op,proto3" json:"op,omitempty"`
+	Key string `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	// For set.
+	Value         string `protobuf:"bytes,3,opt,name=value,proto3" json:"value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Operation) Reset() {
+	*x = Operation{}
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Operation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Operation) ProtoMessage() {}
+
+func (x *Operation) ProtoReflect() protoreflect.Message {
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Operation.ProtoReflect.Descriptor instead.
+func (*Operation) Descriptor() ([]byte, []int) {
+	return file_heliosdb_v1_heliosdb_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Operation) GetOp() string {
+	if x != nil {
+		return x.Op
+	}
+	return ""
+}
+
+func (x *Operation) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *Operation) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+type OperationsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TxId          string                 `protobuf:"bytes,1,opt,name=tx_id,json=txId,proto3" json:"tx_id,omitempty"`
+	Operations    []*Operation           `protobuf:"bytes,2,rep,name=operations,proto3" json:"operations,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OperationsRequest) Reset() {
+	*x = OperationsRequest{}
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OperationsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OperationsRequest) ProtoMessage() {}
+
+func (x *OperationsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OperationsRequest.ProtoReflect.Descriptor instead.
+func (*OperationsRequest) Descriptor() ([]byte, []int) {
+	return file_heliosdb_v1_heliosdb_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *OperationsRequest) GetTxId() string {
+	if x != nil {
+		return x.TxId
+	}
+	return ""
+}
+
+func (x *OperationsRequest) GetOperations() []*Operation {
+	if x != nil {
+		return x.Operations
+	}
+	return nil
+}
+
+type OperationResult struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Op    string                 `protobuf:"bytes,1,opt,name=op,proto3" json:"op,omitempty"`
+	Key   string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	// For get.
+	Value string `protobuf:"bytes,3,opt,name=value,proto3" json:"value,omitempty"`
+	// For get.
+	Found         bool `protobuf:"varint,4,opt,name=found,proto3" json:"found,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OperationResult) Reset() {
+	*x = OperationResult{}
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OperationResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OperationResult) ProtoMessage() {}
+
+func (x *OperationResult) ProtoReflect() protoreflect.Message {
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OperationResult.ProtoReflect.Descriptor instead.
+func (*OperationResult) Descriptor() ([]byte, []int) {
+	return file_heliosdb_v1_heliosdb_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *OperationResult) GetOp() string {
+	if x != nil {
+		return x.Op
+	}
+	return ""
+}
+
+func (x *OperationResult) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *OperationResult) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+func (x *OperationResult) GetFound() bool {
+	if x != nil {
+		return x.Found
+	}
+	return false
+}
+
+type OperationsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Results       []*OperationResult     `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OperationsResponse) Reset() {
+	*x = OperationsResponse{}
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OperationsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OperationsResponse) ProtoMessage() {}
+
+func (x *OperationsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OperationsResponse.ProtoReflect.Descriptor instead.
+func (*OperationsResponse) Descriptor() ([]byte, []int) {
+	return file_heliosdb_v1_heliosdb_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *OperationsResponse) GetResults() []*OperationResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+type CommitRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TxId          string                 `protobuf:"bytes,1,opt,name=tx_id,json=txId,proto3" json:"tx_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommitRequest) Reset() {
+	*x = CommitRequest{}
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommitRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommitRequest) ProtoMessage() {}
+
+func (x *CommitRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommitRequest.ProtoReflect.Descriptor instead.
+func (*CommitRequest) Descriptor() ([]byte, []int) {
+	return file_heliosdb_v1_heliosdb_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *CommitRequest) GetTxId() string {
+	if x != nil {
+		return x.TxId
+	}
+	return ""
+}
+
+type CommitResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommitResponse) Reset() {
+	*x = CommitResponse{}
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommitResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommitResponse) ProtoMessage() {}
+
+func (x *CommitResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_heliosdb_v1_heliosdb_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommitResponse.ProtoReflect.Descriptor instead.
+func (*CommitResponse) Descriptor() ([]byte, []int) {
+	return file_heliosdb_v1_heliosdb_proto_rawDescGZIP(), []int{15}
+}
+
+var File_heliosdb_v1_heliosdb_proto protoreflect.FileDescriptor
+
+const file_heliosdb_v1_heliosdb_proto_rawDesc = "" +
+	"\n" +
+	"\x1aheliosdb/v1/heliosdb.proto\x12\vheliosdb.v1\x1a\x1cgoogle/api/annotations.proto\"@\n" +
+	"\n" +
+	"GetRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12 \n" +
+	"\vconsistency\x18\x02 \x01(\tR\vconsistency\"=\n" +
+	"\vGetResponse\x12\x14\n" +
+	"\x05value\x18\x01 \x01(\tR\x05value\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\x04R\aversion\"4\n" +
+	"\n" +
+	"SetRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value\"\r\n" +
+	"\vSetResponse\"!\n" +
+	"\rDeleteRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\"\x10\n" +
+	"\x0eDeleteResponse\"9\n" +
+	"\vEvalRequest\x12\x16\n" +
+	"\x06script\x18\x01 \x01(\tR\x06script\x12\x12\n" +
+	"\x04args\x18\x02 \x03(\tR\x04args\":\n" +
+	"\fEvalResponse\x12\x16\n" +
+	"\x06result\x18\x01 \x01(\tR\x06result\x12\x12\n" +
+	"\x04keys\x18\x02 \x03(\tR\x04keys\",\n" +
+	"\fBeginRequest\x12\x1c\n" +
+	"\tisolation\x18\x01 \x01(\tR\tisolation\"B\n" +
+	"\rBeginResponse\x12\x13\n" +
+	"\x05tx_id\x18\x01 \x01(\tR\x04txId\x12\x1c\n" +
+	"\tisolation\x18\x02 \x01(\tR\tisolation\"C\n" +
+	"\tOperation\x12\x0e\n" +
+	"\x02op\x18\x01 \x01(\tR\x02op\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x03 \x01(\tR\x05value\"`\n" +
+	"\x11OperationsRequest\x12\x13\n" +
+	"\x05tx_id\x18\x01 \x01(\tR\x04txId\x126\n" +
+	"\n" +
+	"operations\x18\x02 \x03(\v2\x16.heliosdb.v1.OperationR\n" +
+	"operations\"_\n" +
+	"\x0fOperationResult\x12\x0e\n" +
+	"\x02op\x18\x01 \x01(\tR\x02op\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x03 \x01(\tR\x05value\x12\x14\n" +
+	"\x05found\x18\x04 \x01(\bR\x05found\"L\n" +
+	"\x12OperationsResponse\x126\n" +
+	"\aresults\x18\x01 \x03(\v2\x1c.heliosdb.v1.OperationResultR\aresults\"$\n" +
+	"\rCommitRequest\x12\x13\n" +
+	"\x05tx_id\x18\x01 \x01(\tR\x04txId\"\x10\n" +
+	"\x0eCommitResponse2\xd9\x02\n" +
+	"\tKVService\x12N\n" +
+	"\x03Get\x12\x17.heliosdb.v1.GetRequest\x1a\x18.heliosdb.v1.GetResponse\"\x14\x82\xd3\xe4\x93\x02\x0e\x12\f/v1/kv/{key}\x12Q\n" +
+	"\x03Set\x12\x17.heliosdb.v1.SetRequest\x1a\x18.heliosdb.v1.SetResponse\"\x17\x82\xd3\xe4\x93\x02\x11:\x01*\"\f/v1/kv/{key}\x12W\n" +
+	"\x06Delete\x12\x1a.heliosdb.v1.DeleteRequest\x1a\x1b.heliosdb.v1.DeleteResponse\"\x14\x82\xd3\xe4\x93\x02\x0e*\f/v1/kv/{key}\x12P\n" +
+	"\x04Eval\x12\x18.heliosdb.v1.EvalRequest\x1a\x19.heliosdb.v1.EvalResponse\"\x13\x82\xd3\xe4\x93\x02\r:\x01*\"\b/v1/eval2\xc1\x02\n" +
+	"\x12TransactionService\x12T\n" +
+	"\x05Begin\x12\x19.heliosdb.v1.BeginRequest\x1a\x1a.heliosdb.v1.BeginResponse\"\x14\x82\xd3\xe4\x93\x02\x0e\"\f/v1/tx/begin\x12s\n" +
+	"\n" +
+	"Operations\x12\x1e.heliosdb.v1.OperationsRequest\x1a\x1f.heliosdb.v1.OperationsResponse\"$\x82\xd3\xe4\x93\x02\x1e:\x01*\"\x19/v1/tx/{tx_id}/operations\x12`\n" +
+	"\x06Commit\x12\x1a.heliosdb.v1.CommitRequest\x1a\x1b.heliosdb.v1.CommitResponse\"\x1d\x82\xd3\xe4\x93\x02\x17\"\x15/v1/tx/{tx_id}/commitB.Z,github.com/ASHISH26940/heliosdb/api/v1/pb;pbb\x06proto3"
+
+var (
+	file_heliosdb_v1_heliosdb_proto_rawDescOnce sync.Once
+	file_heliosdb_v1_heliosdb_proto_rawDescData []byte
+)
+
+func file_heliosdb_v1_heliosdb_proto_rawDescGZIP() []byte {
+	file_heliosdb_v1_heliosdb_proto_rawDescOnce.Do(func() {
+		file_heliosdb_v1_heliosdb_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_heliosdb_v1_heliosdb_proto_rawDesc), len(file_heliosdb_v1_heliosdb_proto_rawDesc)))
+	})
+	return file_heliosdb_v1_heliosdb_proto_rawDescData
+}
+
+var file_heliosdb_v1_heliosdb_proto_msgTypes = make([]protoimpl.MessageInfo, 16)
+var file_heliosdb_v1_heliosdb_proto_goTypes = []any{
+	(*GetRequest)(nil),         // 0: heliosdb.v1.GetRequest
+	(*GetResponse)(nil),        // 1: heliosdb.v1.GetResponse
+	(*SetRequest)(nil),         // 2: heliosdb.v1.SetRequest
+	(*SetResponse)(nil),        // 3: heliosdb.v1.SetResponse
+	(*DeleteRequest)(nil),      // 4: heliosdb.v1.DeleteRequest
+	(*DeleteResponse)(nil),     // 5: heliosdb.v1.DeleteResponse
+	(*EvalRequest)(nil),        // 6: heliosdb.v1.EvalRequest
+	(*EvalResponse)(nil),       // 7: heliosdb.v1.EvalResponse
+	(*BeginRequest)(nil),       // 8: heliosdb.v1.BeginRequest
+	(*BeginResponse)(nil),      // 9: heliosdb.v1.BeginResponse
+	(*Operation)(nil),          // 10: heliosdb.v1.Operation
+	(*OperationsRequest)(nil),  // 11: heliosdb.v1.OperationsRequest
+	(*OperationResult)(nil),    // 12: heliosdb.v1.OperationResult
+	(*OperationsResponse)(nil), // 13: heliosdb.v1.OperationsResponse
+	(*CommitRequest)(nil),      // 14: heliosdb.v1.CommitRequest
+	(*CommitResponse)(nil),     // 15: heliosdb.v1.CommitResponse
+}
+var file_heliosdb_v1_heliosdb_proto_depIdxs = []int32{
+	10, // 0: heliosdb.v1.OperationsRequest.operations:type_name -> heliosdb.v1.Operation
+	12, // 1: heliosdb.v1.OperationsResponse.results:type_name -> heliosdb.v1.OperationResult
+	0,  // 2: heliosdb.v1.KVService.Get:input_type -> heliosdb.v1.GetRequest
+	2,  // 3: heliosdb.v1.KVService.Set:input_type -> heliosdb.v1.SetRequest
+	4,  // 4: heliosdb.v1.KVService.Delete:input_type -> heliosdb.v1.DeleteRequest
+	6,  // 5: heliosdb.v1.KVService.Eval:input_type -> heliosdb.v1.EvalRequest
+	8,  // 6: heliosdb.v1.TransactionService.Begin:input_type -> heliosdb.v1.BeginRequest
+	11, // 7: heliosdb.v1.TransactionService.Operations:input_type -> heliosdb.v1.OperationsRequest
+	14, // 8: heliosdb.v1.TransactionService.Commit:input_type -> heliosdb.v1.CommitRequest
+	1,  // 9: heliosdb.v1.KVService.Get:output_type -> heliosdb.v1.GetResponse
+	3,  // 10: heliosdb.v1.KVService.Set:output_type -> heliosdb.v1.SetResponse
+	5,  // 11: heliosdb.v1.KVService.Delete:output_type -> heliosdb.v1.DeleteResponse
+	7,  // 12: heliosdb.v1.KVService.Eval:output_type -> heliosdb.v1.EvalResponse
+	9,  // 13: heliosdb.v1.TransactionService.Begin:output_type -> heliosdb.v1.BeginResponse
+	13, // 14: heliosdb.v1.TransactionService.Operations:output_type -> heliosdb.v1.OperationsResponse
+	15, // 15: heliosdb.v1.TransactionService.Commit:output_type -> heliosdb.v1.CommitResponse
+	9,  // [9:16] is the sub-list for method output_type
+	2,  // [2:9] is the sub-list for method input_type
+	2,  // [2:2] is the sub-list for extension type_name
+	2,  // [2:2] is the sub-list for extension extendee
+	0,  // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_heliosdb_v1_heliosdb_proto_init() }
+func file_heliosdb_v1_heliosdb_proto_init() {
+	if File_heliosdb_v1_heliosdb_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_heliosdb_v1_heliosdb_proto_rawDesc), len(file_heliosdb_v1_heliosdb_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   16,
+			NumExtensions: 0,
+			NumServices:   2,
+		},
+		GoTypes:           file_heliosdb_v1_heliosdb_proto_goTypes,
+		DependencyIndexes: file_heliosdb_v1_heliosdb_proto_depIdxs,
+		MessageInfos:      file_heliosdb_v1_heliosdb_proto_msgTypes,
+	}.Build()
+	File_heliosdb_v1_heliosdb_proto = out.File
+	file_heliosdb_v1_heliosdb_proto_goTypes = nil
+	file_heliosdb_v1_heliosdb_proto_depIdxs = nil
+}
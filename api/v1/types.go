@@ -1,6 +1,642 @@
 package v1
 
+import "time"
+
 type SetRequest struct{
+	Value     string    `json:"value"`
+	ExecuteAt time.Time `json:"execute_at,omitzero"` // If in the future, the leader holds the write until then
+}
+
+// TxBeginResponse is returned when a new transaction is started.
+type TxBeginResponse struct {
+	TxID      string `json:"tx_id"`
+	Isolation string `json:"isolation"` // last_write_wins, occ or serializable
+}
+
+// JoinRequest asks the leader to add a node to the Raft cluster.
+type JoinRequest struct {
+	NodeID string `json:"node_id"`
+	Addr   string `json:"addr"` // Raft address of the joining node
+
+	// HTTPAddr is the joining node's advertised HTTP address, which other
+	// nodes point clients at while it leads.
+	HTTPAddr string `json:"http_addr,omitempty"`
+
+	// ClusterID is the cluster the node belongs to, if it knows. The leader
+	// refuses a node of another cluster.
+	ClusterID string `json:"cluster_id,omitempty"`
+}
+
+// RotateKeyResponse reports the newly active data-encryption key version.
+type RotateKeyResponse struct {
+	KeyVersion uint32 `json:"key_version"`
+}
+
+// ConfigResponse reports a node's effective configuration.
+type ConfigResponse struct {
+	Settings []Setting `json:"settings"`
+}
+
+// Setting is one effective config value and where it came from: default,
+// file, env, flag or runtime. Secrets are redacted.
+type Setting struct {
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+}
+
+// EvalRequest runs a Starlark script atomically against the store.
+type EvalRequest struct {
+	Script string   `json:"script"`
+	Args   []string `json:"args,omitempty"`
+}
+
+// EvalResponse carries a script's "result" global and the keys it wrote.
+type EvalResponse struct {
+	Result string   `json:"result"`
+	Keys   []string `json:"keys"`
+}
+
+// UpdateResponse is returned by the atomic read-modify-write endpoint.
+type UpdateResponse struct {
+	Value    string `json:"value"`
+	Version  uint64 `json:"version"`
+	Attempts int    `json:"attempts"` // Includes retries after conflicting writes
+}
+
+// TxOperation is one read, write or delete staged by POST /tx/{id}/operations.
+type TxOperation struct {
+	Op    string `json:"op"` // get, set or delete
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"` // For set
+}
+
+// TxOperationsRequest stages a batch of operations in a transaction, in order.
+type TxOperationsRequest struct {
+	Operations []TxOperation `json:"operations"`
+}
+
+// TxOperationResult is the outcome of one staged operation. Value and Found
+// are only meaningful for reads.
+type TxOperationResult struct {
+	Op    string `json:"op"`
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+	Found bool   `json:"found,omitempty"`
+}
+
+// TxOperationsResponse reports the results of a batch, in request order.
+type TxOperationsResponse struct {
+	Results []TxOperationResult `json:"results"`
+}
+
+// TxSavepointRequest names the savepoint to set with POST
+// /tx/{id}/savepoint, or to roll back to with POST /tx/{id}/rollback.
+type TxSavepointRequest struct {
+	Name string `json:"name"`
+}
+
+// TxRead is a key a transaction read, with the version it had; 0 means the
+// key was absent.
+type TxRead struct {
+	Key     string `json:"key"`
+	Version uint64 `json:"version"`
+}
+
+// TxExecuteRequest is a whole transaction for POST /tx/execute: it applies
+// Operations, sets and deletes only, if every key in Reads is unchanged.
+type TxExecuteRequest struct {
+	Reads      []TxRead      `json:"reads,omitempty"`
+	Operations []TxOperation `json:"operations"`
+}
+
+// StatsResponse reports runtime statistics of the node.
+type StatsResponse struct {
+	Transactions TxStats          `json:"transactions"`
+	Namespaces   []NamespaceUsage `json:"namespaces,omitempty"` // Namespaces with a quota
+	Latencies    []OpLatency      `json:"latencies"`            // Of each op served recently, ordered by op
+	HotReads     []HotKey         `json:"hot_reads"`            // Keys read most often recently, hottest first
+	HotWrites    []HotKey         `json:"hot_writes"`           // Keys written most often recently, on the leader
+}
+
+// TxStats summarises transaction commit outcomes, to help tune contention.
+type TxStats struct {
+	Active             int               `json:"active"`       // Transactions begun but not yet committed or cleared
+	StagedBytes        int64             `json:"staged_bytes"` // Bytes of keys and values staged by active transactions
+	CommitAttempts     uint64            `json:"commit_attempts"`
+	Commits            uint64            `json:"commits"`
+	ValidationFailures uint64            `json:"validation_failures"`
+	Aborts             map[string]uint64 `json:"aborts"`              // By reason: conflict, not_leader or apply_error
+	Expired            uint64            `json:"expired"`             // Aborted after sitting idle past the idle timeout
+	MeanWriteSetSize   float64           `json:"mean_write_set_size"` // Over successful commits
+}
+
+// OpLatency reports how long the recent requests for one operation, such
+// as GET or SET, took to serve, in milliseconds. Percentiles are estimated
+// from buckets whose bounds double, so they are accurate to within that.
+type OpLatency struct {
+	Op    string  `json:"op"`
+	Count uint64  `json:"count"`
+	P50Ms float64 `json:"p50_ms"`
+	P95Ms float64 `json:"p95_ms"`
+	P99Ms float64 `json:"p99_ms"`
+}
+
+// HotKey is one of the keys read or written most often recently. Count is
+// estimated: the true number is within Error of it.
+type HotKey struct {
+	Key   string `json:"key"`
+	Count uint64 `json:"count"`
+	Error uint64 `json:"error,omitempty"`
+}
+
+// NamespaceUsage reports how much of its quota a namespace uses. Zero
+// limits are unlimited.
+type NamespaceUsage struct {
+	Namespace string `json:"namespace"`
+	MaxKeys   int64  `json:"max_keys,omitempty"`
+	MaxBytes  int64  `json:"max_bytes,omitempty"`
+	Keys      int64  `json:"keys"`
+	Bytes     int64  `json:"bytes"` // Of keys and values together
+}
+
+// QuotaRequest sets the quota of the namespace of keys starting with
+// Namespace. Zero limits are unlimited.
+type QuotaRequest struct {
+	Namespace string `json:"namespace"`
+	MaxKeys   int64  `json:"max_keys,omitempty"`
+	MaxBytes  int64  `json:"max_bytes,omitempty"`
+}
+
+// RenameRequest moves (or, with ?op=copy, copies) the value of the key in
+// the URL to To. If To exists, the request fails unless Overwrite is set.
+type RenameRequest struct {
+	To        string `json:"to"`
+	Overwrite bool   `json:"overwrite,omitempty"`
+}
+
+// RenameResponse reports where a renamed or copied value now is, and its
+// version there. A renamed value keeps the version it had, unless the
+// destination had been written past it; a copy gets the destination's next.
+type RenameResponse struct {
+	Key     string `json:"key"`
+	Version uint64 `json:"version"`
+}
+
+// RangeDeleteResponse reports the outcome of DELETE /kv?prefix=, or in a
+// dry run what it would be.
+type RangeDeleteResponse struct {
+	Prefix    string   `json:"prefix"`
+	DryRun    bool     `json:"dry_run,omitempty"`
+	Deleted   int      `json:"deleted"`              // Keys deleted, or that would be
+	Keys      []string `json:"keys"`                 // The first 100 of them, in key order
+	Limit     int      `json:"limit,omitempty"`      // Most keys the delete may remove; 0 is unlimited
+	OverLimit bool     `json:"over_limit,omitempty"` // In a dry run: the delete would be refused
+}
+
+// APIKeyUsage reports the requests and bytes of one API key since this node
+// started. ID is a fingerprint of the key: the first 12 hex digits of its
+// SHA-256 hash, or "anonymous" for requests without a key and "other" for
+// keys seen once too many were metered.
+type APIKeyUsage struct {
+	ID            string `json:"id"`
+	Key           string `json:"key"` // Truncated, as in the audit log
+	Tenant        string `json:"tenant,omitempty"`
+	Requests      uint64 `json:"requests"`
+	Throttled     uint64 `json:"throttled"`      // Refused for exceeding the key's request rate
+	BytesReceived uint64 `json:"bytes_received"` // Of HTTP request bodies
+	BytesSent     uint64 `json:"bytes_sent"`     // Of HTTP response bodies
+}
+
+// APIKeysResponse lists the usage of each metered API key.
+type APIKeysResponse struct {
+	Keys []APIKeyUsage `json:"keys"`
+}
+
+// QuotasResponse lists the namespaces with a quota, ordered by namespace.
+type QuotasResponse struct {
+	Namespaces []NamespaceUsage `json:"namespaces"`
+}
+
+// BulkLoadRecord is one line of a POST /admin/bulk-load stream.
+type BulkLoadRecord struct {
+	Key   string `json:"key"`
 	Value string `json:"value"`
 }
 
+// BulkLoadResponse reports how much of a bulk load was committed.
+type BulkLoadResponse struct {
+	Records int `json:"records"`
+	Batches int `json:"batches"` // Raft entries the records were chunked into
+}
+
+// RedisImportResponse reports the outcome of POST /admin/import/redis.
+type RedisImportResponse struct {
+	Records     int            `json:"records"`
+	Batches     int            `json:"batches"`
+	Expired     int            `json:"expired"`      // Keys skipped because their TTL had already passed
+	TTLsDropped int            `json:"ttls_dropped"` // Keys imported without their (future) TTL
+	NotUTF8     int            `json:"not_utf8"`     // Keys skipped because the key or value is binary
+	Skipped     map[string]int `json:"skipped"`      // Keys of other types, by type
+}
+
+// MigrationRequest starts copying keys to another store.
+type MigrationRequest struct {
+	Target          string `json:"target"` // redis://[user:password@]host:port[/db] or helios://host:port[,host:port...]
+	Prefix          string `json:"prefix,omitempty"`
+	DeleteAfterCopy bool   `json:"delete_after_copy,omitempty"` // Delete keys once copied, unless written meanwhile
+	Replace         bool   `json:"replace,omitempty"`           // Overwrite keys that already exist on a Redis target
+}
+
+// MigrationStatus reports the progress of a migration.
+type MigrationStatus struct {
+	ID              string    `json:"id"`
+	Target          string    `json:"target"` // Password redacted
+	Prefix          string    `json:"prefix,omitempty"`
+	DeleteAfterCopy bool      `json:"delete_after_copy"`
+	State           string    `json:"state"` // running, done, failed or cancelled
+	Total           int       `json:"total"` // Keys matching when the migration started
+	Copied          int       `json:"copied"`
+	Deleted         int       `json:"deleted"`
+	Changed         int       `json:"changed"` // Kept because they were written after being copied
+	Missing         int       `json:"missing"` // Deleted by someone else before they were copied
+	Error           string    `json:"error,omitempty"`
+	Started         time.Time `json:"started"`
+	Finished        time.Time `json:"finished,omitzero"`
+}
+
+// FailpointRequest enables a failpoint, e.g. {"term":"delay(100ms)"}.
+type FailpointRequest struct {
+	Term string `json:"term"` // delay(d), error or pause, optionally prefixed with a count as in "3*error"
+}
+
+// FailpointsResponse lists the enabled failpoints and their terms.
+type FailpointsResponse struct {
+	Failpoints map[string]string `json:"failpoints"`
+}
+
+// CompactResponse reports what POST /admin/compact reclaimed on a node.
+type CompactResponse struct {
+	SnapshotIndex  uint64 `json:"snapshot_index,omitempty"` // Log index of the snapshot taken, if one was needed
+	WALBytesBefore int64  `json:"wal_bytes_before"`
+	WALBytesAfter  int64  `json:"wal_bytes_after"`
+	ReclaimedBytes int64  `json:"reclaimed_bytes"`
+}
+
+// DiskUsageResponse reports a node's disk usage, in bytes.
+type DiskUsageResponse struct {
+	DataDir           string  `json:"data_dir"`
+	RaftLogBytes      int64   `json:"raft_log_bytes"` // raft.db
+	WALBytes          int64   `json:"wal_bytes"`
+	SnapshotBytes     int64   `json:"snapshot_bytes"` // 0 when snapshots are kept in S3
+	ColdBytes         int64   `json:"cold_bytes"`     // Memory-mapped segment files of cold values
+	OtherBytes        int64   `json:"other_bytes"`
+	TotalBytes        int64   `json:"total_bytes"` // Everything in Dirs
+	StoreBytes        int64   `json:"store_bytes"` // Keys and values held in memory by the storage engine
+	MappedBytes       int64   `json:"mapped_bytes"` // Part of StoreBytes served from memory-mapped segments rather than the heap
+	VolumeTotalBytes  int64   `json:"volume_total_bytes,omitempty"`
+	VolumeFreeBytes   int64   `json:"volume_free_bytes,omitempty"` // Available to the server's user
+	VolumeUsedPercent float64 `json:"volume_used_percent,omitempty"`
+	Dirs              []StorageDir `json:"dirs"` // The data directory, then any holding Raft's log, the WAL or snapshots apart from it
+}
+
+// StorageDir reports the disk usage of one directory a node keeps its files
+// in, and of the volume it is on, in bytes. The Volume fields of
+// DiskUsageResponse are those of the first, the data directory.
+type StorageDir struct {
+	Path              string  `json:"path"`
+	Bytes             int64   `json:"bytes"`
+	VolumeTotalBytes  int64   `json:"volume_total_bytes,omitempty"`
+	VolumeFreeBytes   int64   `json:"volume_free_bytes,omitempty"`
+	VolumeUsedPercent float64 `json:"volume_used_percent,omitempty"`
+}
+
+// ValueSizeBucket counts the keys whose values are at most MaxBytes long,
+// and longer than those of the bucket before. The last bucket has no
+// MaxBytes.
+type ValueSizeBucket struct {
+	MaxBytes int   `json:"max_bytes,omitempty"`
+	Keys     int64 `json:"keys"`
+}
+
+// PrefixStats counts the keys under a prefix, and their size.
+type PrefixStats struct {
+	Prefix     string            `json:"prefix"`
+	Keys       int64             `json:"keys"`
+	Bytes      int64             `json:"bytes"` // Of keys and values together
+	ValueSizes []ValueSizeBucket `json:"value_sizes"`
+}
+
+// KeyspaceLevel counts the keys under each prefix one level deep. Other
+// counts the keys of prefixes past the limit the node counts separately.
+type KeyspaceLevel struct {
+	Level    int           `json:"level"`
+	Prefixes []PrefixStats `json:"prefixes"`
+	Other    *PrefixStats  `json:"other,omitempty"`
+}
+
+// KeyspaceResponse summarizes the keys a node holds, overall and by prefix.
+// Prefixes end just after one of Delimiters.
+type KeyspaceResponse struct {
+	Total      PrefixStats     `json:"total"`
+	Delimiters string          `json:"delimiters"`
+	Levels     []KeyspaceLevel `json:"levels"`
+}
+
+// DrainResponse reports a node's progress towards a safe restart.
+type DrainResponse struct {
+	Draining              bool   `json:"draining"`
+	TransferredLeadership bool   `json:"transferred_leadership,omitempty"` // This node was the leader and handed leadership off
+	Leader                string `json:"leader,omitempty"`                 // Raft address of the current leader
+	InFlight              int64  `json:"in_flight"`                        // HTTP requests still being served
+	Drained               bool   `json:"drained"`                          // Draining and no requests are in flight; safe to restart
+}
+
+// KeyVersion is one version of a key in its history.
+type KeyVersion struct {
+	Version   uint64    `json:"version"`
+	Value     string    `json:"value,omitempty"`
+	Deleted   bool      `json:"deleted,omitempty"`
+	Index     uint64    `json:"index"`                // Raft log index of the write
+	Time      time.Time `json:"time,omitzero"`        // When the leader appended the write to its log
+	Writer    string    `json:"writer,omitempty"`     // Principal that made the write; recorded only when audit logging is enabled
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// KeyHistoryResponse lists the versions of a key written since the node
+// started, newest first.
+type KeyHistoryResponse struct {
+	Key      string       `json:"key"`
+	Versions []KeyVersion `json:"versions"`
+}
+
+// DigestResponse is a hash of a node's keyspace at a Raft log index.
+// Replicas that have applied the same entries report the same hash.
+type DigestResponse struct {
+	Index uint64 `json:"index"` // Log index the hash reflects
+	Hash  string `json:"hash"`  // SHA-256 over every key, value and version, hex-encoded
+	Keys  int    `json:"keys"`
+}
+
+// Member is one server in the cluster configuration.
+type Member struct {
+	NodeID   string `json:"node_id"`
+	Addr     string `json:"addr"`                // Raft address
+	HTTPAddr string `json:"http_addr,omitempty"` // Advertised HTTP address, if the node recorded one
+	Suffrage string `json:"suffrage"`            // Voter, Nonvoter or Staging
+}
+
+// MembersResponse lists the cluster configuration.
+type MembersResponse struct {
+	Leader         string   `json:"leader,omitempty"`           // Raft address of the leader, if known
+	LeaderHTTPAddr string   `json:"leader_http_addr,omitempty"` // Advertised HTTP address of the leader, if known
+	ClusterID      string   `json:"cluster_id,omitempty"`       // Empty until the cluster has been assigned one
+	Members        []Member `json:"members"`
+}
+
+// DecommissionRequest asks the leader to remove a node from the cluster.
+type DecommissionRequest struct {
+	NodeID  string `json:"node_id"`
+	Timeout string `json:"timeout,omitempty"` // e.g. "1m"; how long to wait for the remaining voters; default 30s
+}
+
+// DecommissionResponse reports how far a decommission got. Every step before
+// the first false one completed.
+type DecommissionResponse struct {
+	NodeID        string `json:"node_id"`
+	Demoted       bool   `json:"demoted"`         // The node no longer votes
+	PeersCaughtUp bool   `json:"peers_caught_up"` // The remaining voters are reachable and have replicated every entry
+	Removed       bool   `json:"removed"`         // The node is no longer in the configuration
+	ConfigIndex   uint64 `json:"config_index,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// JoinTokenRequest asks the leader for a one-time join token.
+type JoinTokenRequest struct {
+	TTL string `json:"ttl,omitempty"` // e.g. "30m"; how long the token stays valid; default 1h
+}
+
+// JoinTokenResponse carries a one-time join token. It admits a single /join
+// or /admin/decommission request before it expires.
+type JoinTokenResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// MaintenanceRequest turns cluster-wide maintenance mode on or off.
+type MaintenanceRequest struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason,omitempty"` // Returned to refused writers, e.g. "backup window until 02:00 UTC"
+}
+
+// MaintenanceStatus reports whether the cluster is in maintenance mode.
+type MaintenanceStatus struct {
+	Enabled bool      `json:"enabled"`
+	Reason  string    `json:"reason,omitempty"`
+	Since   time.Time `json:"since,omitzero"`
+}
+
+// MigrationsResponse lists the migrations started since the node started.
+type MigrationsResponse struct {
+	Migrations []MigrationStatus `json:"migrations"`
+}
+
+// WatchEvent is one line of a GET /watch stream: a committed change to a
+// key, or, with Type "CANCELED", the reason the stream ended. Revision is
+// the Raft log index of the write; pass the last one received as
+// since_revision to resume.
+type WatchEvent struct {
+	Revision uint64    `json:"revision,omitempty"`
+	Type     string    `json:"type"` // PUT, DELETE or CANCELED
+	Key      string    `json:"key,omitempty"`
+	Value    string    `json:"value,omitempty"`
+	Version  uint64    `json:"version,omitempty"`
+	Time     time.Time `json:"time,omitzero"`   // When the leader appended the write to its log
+	Error    string    `json:"error,omitempty"` // Why a CANCELED stream ended
+}
+
+// ChangesResponse is a page of the changes a node has buffered, for
+// consumers that poll GET /changes. To get the next page, pass Revision
+// as since_revision.
+type ChangesResponse struct {
+	Events            []WatchEvent `json:"events"`
+	Revision          uint64       `json:"revision"`           // Revision of the last event returned, or since_revision if there were none
+	CompactedRevision uint64       `json:"compacted_revision"` // Changes at or before this revision are no longer buffered
+	More              bool         `json:"more"`               // More changes are buffered after Revision
+}
+
+// WatchCompactedResponse is returned with 410 Gone when a watch cannot
+// resume because the changes after its revision are no longer buffered.
+// The client must re-read the keys it watches and start a new watch.
+type WatchCompactedResponse struct {
+	Error             string `json:"error"`
+	CompactedRevision uint64 `json:"compacted_revision"`
+}
+
+// PublishRequest is the body of POST /pubsub/{channel}.
+type PublishRequest struct {
+	Message string `json:"message"`
+}
+
+// PublishResponse reports how many subscribers a message was delivered to.
+type PublishResponse struct {
+	Receivers int `json:"receivers"`
+}
+
+// PubSubMessage is one line of a GET /pubsub/{channel} stream: a message
+// published to the channel, or, with Type "CANCELED", the reason the
+// subscription ended.
+type PubSubMessage struct {
+	Type    string    `json:"type"` // MESSAGE or CANCELED
+	Channel string    `json:"channel,omitempty"`
+	Message string    `json:"message,omitempty"`
+	Time    time.Time `json:"time,omitzero"`   // When the leader received the message
+	Error   string    `json:"error,omitempty"` // Why a CANCELED subscription ended
+}
+
+// StreamAddRequest is the body of POST /streams/{name}, which appends an
+// entry to a stream.
+type StreamAddRequest struct {
+	Fields map[string]string `json:"fields"`
+	MaxLen uint64            `json:"max_len,omitempty"` // Trim the oldest entries beyond this many
+}
+
+// StreamAddResponse reports the ID of an appended entry.
+type StreamAddResponse struct {
+	ID uint64 `json:"id"`
+}
+
+// StreamEntry is one entry of a stream.
+type StreamEntry struct {
+	ID         uint64            `json:"id"`
+	Fields     map[string]string `json:"fields"`
+	Deliveries int               `json:"deliveries,omitempty"` // For entries read by a consumer group
+}
+
+// StreamEntriesResponse lists entries of a stream, in ID order.
+type StreamEntriesResponse struct {
+	Stream  string        `json:"stream"`
+	Entries []StreamEntry `json:"entries"`
+}
+
+// StreamPending is an entry delivered to a consumer and not yet acknowledged.
+type StreamPending struct {
+	ID          uint64    `json:"id"`
+	Consumer    string    `json:"consumer"`
+	Deliveries  int       `json:"deliveries"`
+	DeliveredAt time.Time `json:"delivered_at"`
+}
+
+// StreamGroup describes a consumer group.
+type StreamGroup struct {
+	Name          string          `json:"name"`
+	LastDelivered uint64          `json:"last_delivered"`
+	Pending       []StreamPending `json:"pending"`
+}
+
+// StreamInfoResponse describes a stream.
+type StreamInfoResponse struct {
+	Stream  string        `json:"stream"`
+	Length  uint64        `json:"length"`
+	FirstID uint64        `json:"first_id"` // 0 when the stream is empty
+	LastID  uint64        `json:"last_id"`  // The last ID assigned, even if trimmed since
+	Groups  []StreamGroup `json:"groups"`
+}
+
+// StreamGroupRequest is the body of POST /streams/{name}/groups, which
+// creates a consumer group.
+type StreamGroupRequest struct {
+	Group   string `json:"group"`
+	StartID uint64 `json:"start_id,omitempty"` // Deliver the entries after this one; 0 delivers them all
+	Latest  bool   `json:"latest,omitempty"`   // Deliver only entries added from now on
+}
+
+// StreamReadRequest is the body of POST /streams/{name}/groups/{group}/read.
+type StreamReadRequest struct {
+	Consumer  string `json:"consumer"`
+	Count     int    `json:"count,omitempty"`       // Most entries to deliver; defaults to 10
+	MinIdleMs int64  `json:"min_idle_ms,omitempty"` // First take over entries other consumers have left pending this long
+}
+
+// StreamAckRequest is the body of POST /streams/{name}/groups/{group}/ack.
+type StreamAckRequest struct {
+	IDs []uint64 `json:"ids"`
+}
+
+// StreamAckResponse reports how many of the acknowledged entries were pending.
+type StreamAckResponse struct {
+	Acked int `json:"acked"`
+}
+
+// ScanItem is one key returned by GET /scan.
+type ScanItem struct {
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	Version uint64 `json:"version"`
+}
+
+// ScanResponse is a page of the keys under a prefix that match a scan's
+// filters, in key order. If More is set, pass Next as start_after to get
+// the next page. Scanned counts the keys examined, matching or not.
+type ScanResponse struct {
+	Items   []ScanItem `json:"items"`
+	Scanned int        `json:"scanned"`
+	More    bool       `json:"more"`
+	Next    string     `json:"next,omitempty"`
+}
+
+// SampleItem is one key returned by GET /keys/sample. Size is the length of
+// its value in bytes.
+type SampleItem struct {
+	Key     string `json:"key"`
+	Size    int    `json:"size"`
+	Version uint64 `json:"version"`
+}
+
+// SampleResponse is a uniform random sample of the keys under a prefix, in
+// key order. Matched is the number of keys under the prefix it was drawn
+// from.
+type SampleResponse struct {
+	Prefix  string       `json:"prefix"`
+	Matched int          `json:"matched"`
+	Keys    []SampleItem `json:"keys"`
+}
+
+// AggregateResponse is the result of GET /aggregate. Count is the number
+// of keys aggregated, and Skipped the number of matching keys left out
+// because they had no number to aggregate. Value is 0 if Count is.
+type AggregateResponse struct {
+	Op      string  `json:"op"`
+	Field   string  `json:"field,omitempty"`
+	Value   float64 `json:"value"`
+	Count   int     `json:"count"`
+	Skipped int     `json:"skipped"`
+}
+
+// QueryRequest is the body of POST /query.
+type QueryRequest struct {
+	SQL string `json:"sql"`
+}
+
+// QueryResponse holds the rows of a query, in key order. Each row has one
+// value per column: strings for key and value, a number for version, and
+// any JSON value, or null if it is missing, for a field. Truncated is set
+// if rows were left out to keep the response within the node's limit.
+type QueryResponse struct {
+	Columns   []string        `json:"columns"`
+	Rows      [][]interface{} `json:"rows"`
+	Truncated bool            `json:"truncated,omitempty"`
+}
+
+// ScheduledWrite is a SET the leader holds until ExecuteAt.
+type ScheduledWrite struct {
+	ID        string    `json:"id"`
+	Key       string    `json:"key"`
+	Value     string    `json:"value"`
+	ExecuteAt time.Time `json:"execute_at"`
+}
+
+// ScheduledWritesResponse lists the pending scheduled writes, earliest first.
+type ScheduledWritesResponse struct {
+	Writes []ScheduledWrite `json:"writes"`
+}
@@ -0,0 +1,280 @@
+// Package client is a Go client for the HeliosDB HTTP API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+)
+
+// ErrNotFound is returned by Get when the key does not exist.
+var ErrNotFound = errors.New("heliosdb: key not found")
+
+// StatusError is returned when a node answers with an unexpected HTTP status.
+type StatusError struct {
+	Endpoint string
+	Code     int
+	Message  string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("heliosdb: %s returned %d: %s", e.Endpoint, e.Code, e.Message)
+}
+
+// Client talks to a HeliosDB cluster through the HTTP API of its nodes.
+// It is safe for concurrent use.
+type Client struct {
+	nodes []*node // One per endpoint base URL, e.g. "http://localhost:8081"
+	http  *http.Client
+
+	hedgeDelay   time.Duration // 0 disables hedged reads
+	maxRetries   int
+	retryBackoff time.Duration
+
+	failureThreshold int           // Consecutive failures before an endpoint is skipped; 0 disables
+	cooldown         time.Duration // How long an unhealthy endpoint is skipped
+	maxConnsPerNode  int           // Idle connections pooled per endpoint
+
+	next atomic.Uint32 // Round-robin position for reads
+}
+
+// Option configures optional Client behaviour.
+type Option func(*Client)
+
+// WithHTTPClient sets the http.Client used for requests.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.http = hc
+	}
+}
+
+// WithHedgedReads sends a second copy of a read to another node if the first
+// hasn't answered within delay, and uses whichever answers first. This trims
+// tail latency at the cost of extra load on slow requests.
+func WithHedgedReads(delay time.Duration) Option {
+	return func(c *Client) {
+		c.hedgeDelay = delay
+	}
+}
+
+// WithRetries retries idempotent requests (reads, sets and deletes) up to n
+// times on transient errors, waiting backoff, then twice that, and so on.
+func WithRetries(n int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = n
+		c.retryBackoff = backoff
+	}
+}
+
+// New returns a client for the nodes at endpoints.
+func New(endpoints []string, opts ...Option) (*Client, error) {
+	if len(endpoints) == 0 {
+		return nil, errors.New("heliosdb: at least one endpoint is required")
+	}
+	c := &Client{
+		nodes:            make([]*node, len(endpoints)),
+		maxRetries:       2,
+		retryBackoff:     50 * time.Millisecond,
+		failureThreshold: 3,
+		cooldown:         5 * time.Second,
+		maxConnsPerNode:  16,
+	}
+	for i, e := range endpoints {
+		c.nodes[i] = &node{url: strings.TrimSuffix(e, "/")}
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.http == nil {
+		c.http = &http.Client{Timeout: 10 * time.Second, Transport: newTransport(c.maxConnsPerNode)}
+	}
+	return c, nil
+}
+
+// Get returns the value of key, read from any node.
+func (c *Client) Get(ctx context.Context, key string) (string, error) {
+	var value string
+	err := c.retry(ctx, func(ctx context.Context) error {
+		body, err := c.hedged(ctx, func(ctx context.Context, n *node) ([]byte, error) {
+			return c.do(ctx, n, http.MethodGet, kvPath(key), nil, http.StatusOK)
+		})
+		if err != nil {
+			return err
+		}
+		value = strings.TrimSuffix(string(body), "\n")
+		return nil
+	})
+	return value, err
+}
+
+// Set writes value to key.
+func (c *Client) Set(ctx context.Context, key, value string) error {
+	body, err := json.Marshal(v1.SetRequest{Value: value})
+	if err != nil {
+		return err
+	}
+	return c.retry(ctx, func(ctx context.Context) error {
+		_, err := c.write(ctx, http.MethodPost, kvPath(key), body, http.StatusCreated)
+		return err
+	})
+}
+
+// Delete removes key.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	return c.retry(ctx, func(ctx context.Context) error {
+		_, err := c.write(ctx, http.MethodDelete, kvPath(key), nil, http.StatusOK)
+		return err
+	})
+}
+
+func kvPath(key string) string {
+	return "/v1/kv/" + url.PathEscape(key)
+}
+
+// write sends a mutating request to each node in turn until one accepts it.
+// Followers refuse writes with 403, so this finds the leader.
+func (c *Client) write(ctx context.Context, method, path string, body []byte, want int) ([]byte, error) {
+	var lastErr error
+	for _, n := range c.ordered(false) {
+		resp, err := c.do(ctx, n, method, path, body, want)
+		var se *StatusError
+		if errors.As(err, &se) && se.Code == http.StatusForbidden {
+			lastErr = err
+			continue
+		}
+		return resp, err
+	}
+	return nil, lastErr
+}
+
+// hedged runs read against one node and, if it hasn't finished after the
+// hedge delay, against the next one too. The first success wins.
+func (c *Client) hedged(ctx context.Context, read func(ctx context.Context, n *node) ([]byte, error)) ([]byte, error) {
+	nodes := c.ordered(true)
+	if c.hedgeDelay <= 0 || len(nodes) == 1 {
+		return read(ctx, nodes[0])
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		body []byte
+		err  error
+	}
+	results := make(chan result, 2)
+	launch := func(n *node) {
+		go func() {
+			body, err := read(ctx, n)
+			results <- result{body, err}
+		}()
+	}
+
+	launch(nodes[0])
+	inFlight := 1
+	timer := time.NewTimer(c.hedgeDelay)
+	defer timer.Stop()
+	var firstErr error
+	for {
+		select {
+		case <-timer.C:
+			if inFlight == 1 && firstErr == nil {
+				launch(nodes[1])
+				inFlight++
+			}
+		case res := <-results:
+			inFlight--
+			if res.err == nil || errors.Is(res.err, ErrNotFound) {
+				return res.body, res.err
+			}
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			if inFlight == 0 {
+				return nil, firstErr
+			}
+		}
+	}
+}
+
+// retry calls fn until it succeeds, fails permanently, or retries run out.
+func (c *Client) retry(ctx context.Context, fn func(ctx context.Context) error) error {
+	backoff := c.retryBackoff
+	for attempt := 0; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= c.maxRetries || !transient(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// transient reports whether err may go away if the request is retried.
+func transient(err error) bool {
+	var se *StatusError
+	if errors.As(err, &se) {
+		switch se.Code {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	var ne net.Error
+	return errors.As(err, &ne) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+// do sends one request to n, records the outcome in n's health, and returns
+// the response body if the status is want.
+func (c *Client) do(ctx context.Context, n *node, method, path string, body []byte, want int) ([]byte, error) {
+	data, err := c.send(ctx, n.url, method, path, body, want)
+	if ctx.Err() == nil {
+		// A request cancelled by the caller (or a won hedge) says nothing about the node.
+		n.report(err, c.failureThreshold, c.cooldown)
+	}
+	return data, err
+}
+
+func (c *Client) send(ctx context.Context, endpoint, method, path string, body []byte, want int) ([]byte, error) {
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint+path, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound && method == http.MethodGet {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != want {
+		return nil, &StatusError{Endpoint: endpoint, Code: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+	}
+	return data, nil
+}
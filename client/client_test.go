@@ -0,0 +1,145 @@
+// Package client_test contains the unit tests for the client package.
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGet_Hedged(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+		w.Write([]byte("slow\n"))
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fast\n"))
+	}))
+	defer fast.Close()
+
+	c, _ := New([]string{slow.URL, fast.URL}, WithHedgedReads(20*time.Millisecond))
+
+	// --- Test Case 1: A slow first node is hedged around ---
+	start := time.Now()
+	value, err := c.Get(context.Background(), "k")
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	if value != "fast" {
+		t.Errorf("expected the hedged read to win, but got %q", value)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the hedge to cut latency, but the read took %s", elapsed)
+	}
+}
+
+func TestGet_Retries(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/kv/a%2Fb" && r.URL.RawPath != "/v1/kv/a%2Fb" {
+			t.Errorf("expected the key to be escaped, but got path %q", r.URL.RawPath)
+		}
+		if calls.Add(1) < 3 {
+			http.Error(w, "leadership in flux", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("v\n"))
+	}))
+	defer srv.Close()
+
+	// --- Test Case 1: Transient errors are retried ---
+	c, _ := New([]string{srv.URL}, WithRetries(3, time.Millisecond))
+	if value, err := c.Get(context.Background(), "a/b"); err != nil || value != "v" {
+		t.Errorf("expected v after retries, but got %q (err %v)", value, err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("expected 3 attempts, but got %d", calls.Load())
+	}
+
+	// --- Test Case 2: Retries are bounded ---
+	calls.Store(-10)
+	c, _ = New([]string{srv.URL}, WithRetries(1, time.Millisecond))
+	var se *StatusError
+	if _, err := c.Get(context.Background(), "a/b"); !errors.As(err, &se) || se.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected a 503 StatusError, but got %v", err)
+	}
+}
+
+func TestWrites(t *testing.T) {
+	follower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Writes must be sent to the leader", http.StatusForbidden)
+	}))
+	defer follower.Close()
+	var writes atomic.Int32
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writes.Add(1)
+		switch r.Method {
+		case http.MethodPost:
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodDelete:
+			w.WriteHeader(http.StatusOK)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer leader.Close()
+
+	c, _ := New([]string{follower.URL, leader.URL})
+
+	// --- Test Case 1: Writes find the leader ---
+	if err := c.Set(context.Background(), "k", "v"); err != nil {
+		t.Errorf("expected no error, but got %v", err)
+	}
+	if err := c.Delete(context.Background(), "k"); err != nil {
+		t.Errorf("expected no error, but got %v", err)
+	}
+	if writes.Load() != 2 {
+		t.Errorf("expected 2 writes on the leader, but got %d", writes.Load())
+	}
+
+	// --- Test Case 2: Missing keys ---
+	c, _ = New([]string{leader.URL})
+	if _, err := c.Get(context.Background(), "k"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, but got %v", err)
+	}
+}
+
+func TestHealthTracking(t *testing.T) {
+	var brokenCalls atomic.Int32
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		brokenCalls.Add(1)
+		http.Error(w, "disk on fire", http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("v\n"))
+	}))
+	defer good.Close()
+
+	c, _ := New([]string{broken.URL, good.URL}, WithHealthTracking(2, time.Hour), WithRetries(0, 0))
+
+	// --- Test Case 1: Repeated failures mark an endpoint unhealthy ---
+	for i := 0; i < 10; i++ {
+		c.Get(context.Background(), "k")
+	}
+	if n := brokenCalls.Load(); n != 2 {
+		t.Errorf("expected the broken endpoint to be skipped after 2 failures, but it got %d requests", n)
+	}
+	statuses := c.Endpoints()
+	if statuses[0].Healthy || statuses[0].Failures != 2 || !statuses[1].Healthy {
+		t.Errorf("unexpected endpoint statuses: %+v", statuses)
+	}
+
+	// --- Test Case 2: Reads keep succeeding on the healthy endpoint ---
+	if value, err := c.Get(context.Background(), "k"); err != nil || value != "v" {
+		t.Errorf("expected v, but got %q (err %v)", value, err)
+	}
+}
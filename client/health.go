@@ -0,0 +1,127 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// node is one endpoint of the cluster, with its recent health.
+type node struct {
+	url string
+
+	mu        sync.Mutex
+	failures  int       // Consecutive failures
+	downUntil time.Time // Skipped for reads until then, once failures reach the threshold
+}
+
+// EndpointStatus reports the health of one endpoint, as seen by the client.
+type EndpointStatus struct {
+	URL      string
+	Healthy  bool
+	Failures int // Consecutive failed requests
+}
+
+// WithHealthTracking marks an endpoint unhealthy after threshold consecutive
+// failures. Unhealthy endpoints are skipped for cooldown, after which one
+// request is let through to probe them; a success makes them healthy again.
+func WithHealthTracking(threshold int, cooldown time.Duration) Option {
+	return func(c *Client) {
+		c.failureThreshold = threshold
+		c.cooldown = cooldown
+	}
+}
+
+// WithMaxConnsPerNode sets how many idle keep-alive connections are pooled
+// per endpoint, so bursts of requests don't pay for new connections. It has
+// no effect when WithHTTPClient is used.
+func WithMaxConnsPerNode(n int) Option {
+	return func(c *Client) {
+		c.maxConnsPerNode = n
+	}
+}
+
+// newTransport returns a copy of http.DefaultTransport that keeps up to
+// perNode idle connections to each endpoint, rather than the default of 2.
+func newTransport(perNode int) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConnsPerHost = perNode
+	if t.MaxIdleConns < perNode*4 {
+		t.MaxIdleConns = perNode * 4
+	}
+	return t
+}
+
+func (n *node) healthy(now time.Time) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return !now.Before(n.downUntil)
+}
+
+// report records the outcome of a request to n.
+func (n *node) report(err error, threshold int, cooldown time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !nodeFailure(err) {
+		n.failures = 0
+		n.downUntil = time.Time{}
+		return
+	}
+	n.failures++
+	if threshold > 0 && n.failures >= threshold {
+		n.downUntil = time.Now().Add(cooldown)
+	}
+}
+
+// nodeFailure reports whether err says something about the node's health,
+// as opposed to the request (e.g. a missing key or a write sent to a follower).
+func nodeFailure(err error) bool {
+	if err == nil || errors.Is(err, ErrNotFound) {
+		return false
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Code >= http.StatusInternalServerError
+	}
+	return true
+}
+
+func (n *node) status(now time.Time) EndpointStatus {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return EndpointStatus{URL: n.url, Healthy: !now.Before(n.downUntil), Failures: n.failures}
+}
+
+// Endpoints reports the health of every endpoint.
+func (c *Client) Endpoints() []EndpointStatus {
+	now := time.Now()
+	statuses := make([]EndpointStatus, len(c.nodes))
+	for i, n := range c.nodes {
+		statuses[i] = n.status(now)
+	}
+	return statuses
+}
+
+// ordered returns the nodes to try, healthy ones first. Reads rotate the
+// starting point among healthy nodes to spread load; writes keep the
+// configured order so they find the leader quickly.
+func (c *Client) ordered(rotate bool) []*node {
+	now := time.Now()
+	healthy := make([]*node, 0, len(c.nodes))
+	var unhealthy []*node
+	for _, n := range c.nodes {
+		if n.healthy(now) {
+			healthy = append(healthy, n)
+		} else {
+			unhealthy = append(unhealthy, n)
+		}
+	}
+	if rotate && len(healthy) > 1 {
+		start := int(c.next.Add(1)-1) % len(healthy)
+		rotated := make([]*node, 0, len(c.nodes))
+		rotated = append(rotated, healthy[start:]...)
+		healthy = append(rotated, healthy[:start]...)
+	}
+	return append(healthy, unhealthy...)
+}
@@ -0,0 +1,186 @@
+// Command helios-bench generates load against a HeliosDB cluster and reports
+// throughput and latency percentiles, for validating tuning changes.
+//
+//	helios-bench -endpoints http://localhost:8081,http://localhost:8082 \
+//	    -duration 30s -concurrency 32 -reads 0.9 -keys 100000 -dist zipfian
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ASHISH26940/heliosdb/client"
+)
+
+// options configures a benchmark run.
+type options struct {
+	endpoints   []string
+	duration    time.Duration
+	concurrency int
+	readRatio   float64 // Fraction of operations that are reads
+	keys        int     // Size of the keyspace
+	dist        string  // uniform or zipfian
+	zipfS       float64 // Zipfian skew; higher means hotter hot keys
+	valueSize   int
+	prefix      string
+	preload     bool
+	hedge       time.Duration
+}
+
+func main() {
+	var opts options
+	endpoints := flag.String("endpoints", "http://localhost:8081", "Comma-separated node URLs")
+	flag.DurationVar(&opts.duration, "duration", 10*time.Second, "How long to run")
+	flag.IntVar(&opts.concurrency, "concurrency", 16, "Concurrent workers")
+	flag.Float64Var(&opts.readRatio, "reads", 0.9, "Fraction of operations that are reads (0-1)")
+	flag.IntVar(&opts.keys, "keys", 10000, "Number of distinct keys")
+	flag.StringVar(&opts.dist, "dist", "uniform", "Key distribution: uniform or zipfian")
+	flag.Float64Var(&opts.zipfS, "zipf-s", 1.1, "Zipfian skew (> 1)")
+	flag.IntVar(&opts.valueSize, "value-size", 128, "Value size in bytes")
+	flag.StringVar(&opts.prefix, "prefix", "bench/", "Key prefix")
+	flag.BoolVar(&opts.preload, "preload", true, "Write every key before the run, so reads hit")
+	flag.DurationVar(&opts.hedge, "hedge", 0, "Hedge reads after this delay (0 disables)")
+	flag.Parse()
+	opts.endpoints = strings.Split(*endpoints, ",")
+
+	if err := opts.validate(); err != nil {
+		fmt.Fprintln(os.Stderr, "helios-bench:", err)
+		os.Exit(2)
+	}
+	c, err := client.New(opts.endpoints, client.WithHedgedReads(opts.hedge), client.WithMaxConnsPerNode(opts.concurrency))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if opts.preload {
+		log.Printf("Preloading %d keys...", opts.keys)
+		if err := preload(ctx, c, opts); err != nil {
+			log.Fatalf("Preload failed: %v", err)
+		}
+	}
+	log.Printf("Running for %s with %d workers (%.0f%% reads, %s keys)...", opts.duration, opts.concurrency, opts.readRatio*100, opts.dist)
+	res := run(ctx, c, opts)
+	res.report(os.Stdout)
+}
+
+func (o options) validate() error {
+	switch {
+	case o.concurrency < 1:
+		return errors.New("-concurrency must be at least 1")
+	case o.keys < 1:
+		return errors.New("-keys must be at least 1")
+	case o.readRatio < 0 || o.readRatio > 1:
+		return errors.New("-reads must be between 0 and 1")
+	case o.dist != "uniform" && o.dist != "zipfian":
+		return fmt.Errorf("unknown -dist %q (want uniform or zipfian)", o.dist)
+	case o.dist == "zipfian" && o.zipfS <= 1:
+		return errors.New("-zipf-s must be greater than 1")
+	}
+	return nil
+}
+
+// keyChooser picks key indexes in [0, keys) following the configured distribution.
+func (o options) keyChooser(rng *rand.Rand) func() int {
+	if o.dist == "zipfian" {
+		z := rand.NewZipf(rng, o.zipfS, 1, uint64(o.keys-1))
+		return func() int { return int(z.Uint64()) }
+	}
+	return func() int { return rng.Intn(o.keys) }
+}
+
+func (o options) key(i int) string {
+	return fmt.Sprintf("%s%08d", o.prefix, i)
+}
+
+// preload writes every key once, using all workers.
+func preload(ctx context.Context, c *client.Client, o options) error {
+	value := strings.Repeat("x", o.valueSize)
+	next := make(chan int)
+	errs := make(chan error, o.concurrency)
+	var wg sync.WaitGroup
+	for w := 0; w < o.concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if err := c.Set(ctx, o.key(i), value); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	var err error
+feed:
+	for i := 0; i < o.keys; i++ {
+		select {
+		case next <- i:
+		case err = <-errs:
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+	if err == nil {
+		select {
+		case err = <-errs:
+		default:
+		}
+	}
+	return err
+}
+
+// run drives the workload for o.duration and collects the results.
+func run(ctx context.Context, c *client.Client, o options) *results {
+	ctx, cancel := context.WithTimeout(ctx, o.duration)
+	defer cancel()
+	value := strings.Repeat("x", o.valueSize)
+
+	workers := make([]*results, o.concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := range workers {
+		workers[w] = &results{}
+		wg.Add(1)
+		go func(res *results, seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			choose := o.keyChooser(rng)
+			for ctx.Err() == nil {
+				key := o.key(choose())
+				if rng.Float64() < o.readRatio {
+					t := time.Now()
+					_, err := c.Get(ctx, key)
+					if ctx.Err() != nil {
+						return // Cut short by the end of the run
+					}
+					res.reads.record(time.Since(t), err, errors.Is(err, client.ErrNotFound))
+				} else {
+					t := time.Now()
+					err := c.Set(ctx, key, value)
+					if ctx.Err() != nil {
+						return
+					}
+					res.writes.record(time.Since(t), err, false)
+				}
+			}
+		}(workers[w], time.Now().UnixNano()+int64(w))
+	}
+	wg.Wait()
+
+	total := &results{elapsed: time.Since(start)}
+	for _, res := range workers {
+		total.reads.merge(&res.reads)
+		total.writes.merge(&res.writes)
+	}
+	return total
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ASHISH26940/heliosdb/client"
+)
+
+func TestPercentile(t *testing.T) {
+	// --- Test Case 1: Nearest rank over 1..100ms ---
+	var lat []time.Duration
+	for i := 1; i <= 100; i++ {
+		lat = append(lat, time.Duration(i)*time.Millisecond)
+	}
+	for p, want := range map[float64]time.Duration{0.5: 50 * time.Millisecond, 0.99: 99 * time.Millisecond, 1: 100 * time.Millisecond, 0: time.Millisecond} {
+		if got := percentile(lat, p); got != want {
+			t.Errorf("expected p%v to be %s, but got %s", p*100, want, got)
+		}
+	}
+
+	// --- Test Case 2: No samples ---
+	if got := percentile(nil, 0.5); got != 0 {
+		t.Errorf("expected 0 for no samples, but got %s", got)
+	}
+
+	// --- Test Case 3: Misses count as completed reads, errors do not ---
+	var s opStats
+	s.record(time.Millisecond, nil, false)
+	s.record(time.Millisecond, client.ErrNotFound, true)
+	s.record(time.Millisecond, errors.New("boom"), false)
+	if len(s.latencies) != 2 || s.misses != 1 || s.errors != 1 {
+		t.Errorf("expected 2 samples, 1 miss and 1 error, but got %d, %d and %d", len(s.latencies), s.misses, s.errors)
+	}
+}
+
+func TestKeyChooser(t *testing.T) {
+	// --- Test Case 1: Both distributions stay within the keyspace ---
+	for _, dist := range []string{"uniform", "zipfian"} {
+		o := options{keys: 50, dist: dist, zipfS: 1.1}
+		choose := o.keyChooser(rand.New(rand.NewSource(1)))
+		for i := 0; i < 10000; i++ {
+			if k := choose(); k < 0 || k >= o.keys {
+				t.Fatalf("expected %s keys in [0, %d), but got %d", dist, o.keys, k)
+			}
+		}
+	}
+
+	// --- Test Case 2: Zipfian concentrates on the hottest key ---
+	o := options{keys: 1000, dist: "zipfian", zipfS: 1.5}
+	choose := o.keyChooser(rand.New(rand.NewSource(1)))
+	hot := 0
+	for i := 0; i < 10000; i++ {
+		if choose() == 0 {
+			hot++
+		}
+	}
+	if hot < 3000 {
+		t.Errorf("expected key 0 to take a large share of zipfian picks, but got %d of 10000", hot)
+	}
+
+	// --- Test Case 3: Invalid options are rejected ---
+	bad := []options{
+		{concurrency: 1, keys: 1, readRatio: 1.5, dist: "uniform"},
+		{concurrency: 1, keys: 1, dist: "gaussian"},
+		{concurrency: 1, keys: 1, dist: "zipfian", zipfS: 1},
+		{concurrency: 0, keys: 1, dist: "uniform"},
+	}
+	for i, o := range bad {
+		if o.validate() == nil {
+			t.Errorf("expected options %d to be rejected, but they were accepted", i)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	var mu sync.Mutex
+	data := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodGet:
+			v, ok := data[key]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(v))
+		case http.MethodPost, http.MethodPut:
+			data[key] = "x"
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := client.New([]string{srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := options{duration: 200 * time.Millisecond, concurrency: 4, readRatio: 0.5, keys: 20, dist: "uniform", valueSize: 8, prefix: "bench/"}
+
+	// --- Test Case 1: Preload writes every key ---
+	if err := preload(context.Background(), c, o); err != nil {
+		t.Fatalf("expected preload to succeed, but got %v", err)
+	}
+	if len(data) != o.keys {
+		t.Errorf("expected %d preloaded keys, but got %d", o.keys, len(data))
+	}
+
+	// --- Test Case 2: A run performs both reads and writes without errors ---
+	res := run(context.Background(), c, o)
+	if len(res.reads.latencies) == 0 || len(res.writes.latencies) == 0 {
+		t.Errorf("expected reads and writes, but got %d and %d", len(res.reads.latencies), len(res.writes.latencies))
+	}
+	if res.reads.errors+res.writes.errors != 0 || res.reads.misses != 0 {
+		t.Errorf("expected no errors or misses, but got %d errors and %d misses", res.reads.errors+res.writes.errors, res.reads.misses)
+	}
+	var out strings.Builder
+	res.report(&out)
+	if !strings.Contains(out.String(), "p99.9") || !strings.Contains(out.String(), "write") {
+		t.Errorf("expected a percentile table, but got %q", out.String())
+	}
+}
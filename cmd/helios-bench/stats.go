@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"time"
+)
+
+// opStats collects the latencies of one kind of operation.
+type opStats struct {
+	latencies []time.Duration // Successful operations only
+	errors    int
+	misses    int // Reads of keys that did not exist
+}
+
+func (s *opStats) record(d time.Duration, err error, miss bool) {
+	switch {
+	case miss:
+		s.misses++
+		s.latencies = append(s.latencies, d)
+	case err != nil:
+		s.errors++
+	default:
+		s.latencies = append(s.latencies, d)
+	}
+}
+
+func (s *opStats) merge(o *opStats) {
+	s.latencies = append(s.latencies, o.latencies...)
+	s.errors += o.errors
+	s.misses += o.misses
+}
+
+// percentile returns the latency at or below which a fraction p (0-1) of
+// operations completed, using the nearest-rank method. latencies must be sorted.
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p*float64(len(latencies)))) - 1
+	return latencies[max(0, min(rank, len(latencies)-1))]
+}
+
+// results is the outcome of a run.
+type results struct {
+	elapsed time.Duration
+	reads   opStats
+	writes  opStats
+}
+
+// report writes a summary table of throughput and latency percentiles.
+func (r *results) report(w io.Writer) {
+	fmt.Fprintf(w, "%-6s %9s %10s %7s %7s %10s %10s %10s %10s %10s\n",
+		"op", "count", "ops/s", "errors", "misses", "p50", "p90", "p99", "p99.9", "max")
+	for _, row := range []struct {
+		name string
+		s    *opStats
+	}{{"read", &r.reads}, {"write", &r.writes}} {
+		lat := row.s.latencies
+		slices.Sort(lat)
+		ops := 0.0
+		if r.elapsed > 0 {
+			ops = float64(len(lat)) / r.elapsed.Seconds()
+		}
+		fmt.Fprintf(w, "%-6s %9d %10.0f %7d %7d %10s %10s %10s %10s %10s\n",
+			row.name, len(lat), ops, row.s.errors, row.s.misses,
+			fmtLatency(percentile(lat, 0.50)), fmtLatency(percentile(lat, 0.90)),
+			fmtLatency(percentile(lat, 0.99)), fmtLatency(percentile(lat, 0.999)),
+			fmtLatency(percentile(lat, 1)))
+	}
+}
+
+func fmtLatency(d time.Duration) string {
+	return d.Round(time.Microsecond).String()
+}
@@ -2,7 +2,9 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -10,86 +12,263 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/audit"
+	"github.com/ASHISH26940/heliosdb/internal/certs"
 	"github.com/ASHISH26940/heliosdb/internal/config"
 	"github.com/ASHISH26940/heliosdb/internal/persistence"
 	internal_raft "github.com/ASHISH26940/heliosdb/internal/raft"
 	"github.com/ASHISH26940/heliosdb/internal/server"
+	"github.com/ASHISH26940/heliosdb/internal/snapshots"
 	"github.com/ASHISH26940/heliosdb/internal/store"
+	"github.com/ASHISH26940/heliosdb/internal/transaction"
+	"github.com/ASHISH26940/heliosdb/internal/upstream"
+	"github.com/ASHISH26940/heliosdb/internal/watch"
+	"github.com/ASHISH26940/heliosdb/internal/webhook"
 	"github.com/hashicorp/raft"
 	"github.com/hashicorp/raft-boltdb"
+	"google.golang.org/grpc"
 )
 
 func main() {
+	// Offline tools are subcommands; anything else starts a node.
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "verify":
+			os.Exit(runVerify(os.Args[2:], os.Stdout))
+		case "wal":
+			os.Exit(runWAL(os.Args[2:], os.Stdout))
+		case "snapshot":
+			os.Exit(runSnapshot(os.Args[2:], os.Stdout))
+		case "recover-cluster":
+			os.Exit(runRecoverCluster(os.Args[2:], os.Stdout))
+		}
+	}
+
 	// --- Configuration and Flags ---
-	configFile := flag.String("config", "config.toml", "Path to config file")
+	configFile := flag.String("config", "config.toml", "Path to config file (.toml, .yaml/.yml or .json)")
 	bootstrap := flag.Bool("bootstrap", false, "Bootstrap the cluster (run on the first node only)")
+	restoreFrom := flag.String("restore-snapshot", "", "Discard the local store and rebuild it from this snapshot ID, archive index, or snapshot/archive path")
+	flag.String("node-id", "", "Override node_id (flags > env > config file > defaults)")
+	flag.String("host", "", "Override host")
+	flag.Int("port", 0, "Override the HTTP port")
+	flag.Int("raft-port", 0, "Override the Raft port")
+	flag.String("data-dir", "", "Override data_dir")
 	flag.Parse()
 
-	cfg := config.New()
-	if err := cfg.Load(*configFile); err != nil {
+	loadConfig := func() (*config.Config, error) {
+		cfg := config.New()
+		if err := cfg.Load(*configFile); err != nil {
+			return nil, err
+		}
+		if err := cfg.ApplyEnv(os.LookupEnv); err != nil {
+			return nil, err
+		}
+		if err := applyFlags(cfg, flag.CommandLine); err != nil {
+			return nil, err
+		}
+		return cfg, nil
+	}
+	cfg, err := loadConfig()
+	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
+	if err := applyLogLevel(cfg.LogLevel); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	txIsolation, err := transaction.ParseIsolation(cfg.TxIsolation)
+	if err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+
+	for _, dir := range cfg.StorageDirs() {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			log.Fatalf("Failed to create data directory: %v", err)
+		}
+	}
+
+	// --- Load the encryption keyring, if any ---
+	var keyring *persistence.Keyring
+	if cfg.EncryptionKeyFile != "" {
+		var err error
+		keyring, err = persistence.LoadKeyring(cfg.EncryptionKeyFile, keyringOptions(cfg)...)
+		if err != nil {
+			log.Fatalf("Failed to load encryption keyring: %v", err)
+		}
+		log.Printf("Encryption at rest is enabled (active key version %d).", keyring.ActiveVersion())
+		if cfg.EncryptionMigratePlaintext {
+			log.Printf("Reading plaintext WAL records written before encryption was enabled; unset encryption_migrate_plaintext once the WAL has been compacted.")
+		}
+	}
+	snapshotOpts, err := snapshotOptions(cfg, keyring)
+	if err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+
+	snapshots, err := newSnapshotStore(cfg)
+	if err != nil {
+		log.Fatalf("Failed to create snapshot store: %v", err)
+	}
+
+	logStore, err := raftboltdb.NewBoltStore(cfg.RaftLogPath())
+	if err != nil {
+		log.Fatalf("Failed to create bolt store: %v", err)
+	}
 
-	if err := os.MkdirAll(cfg.DataDir, 0755); err != nil {
-		log.Fatalf("Failed to create data directory: %v", err)
+	// --- Re-provision a node whose Raft state was wiped ---
+	// A node with no Raft state whose peers already form a cluster must not
+	// bootstrap a second one. If the cluster still lists this node, anything
+	// left in the data directory predates the wipe, so it is set aside and
+	// the node rejoins, catching up from the leader's log or a snapshot.
+	rejoinCluster := false
+	existing, err := raft.HasExistingState(logStore, logStore, snapshots)
+	if err != nil {
+		log.Fatalf("Failed to inspect Raft state: %v", err)
+	}
+	if !existing && len(cfg.Peers) > 0 {
+		if cluster, ok := findCluster(context.Background(), cfg.Peers); ok {
+			rejoinCluster = true
+			if *bootstrap {
+				log.Printf("Ignoring -bootstrap: peers already form a cluster led by %s", cluster.Leader)
+			}
+			if cfg.ClusterID != "" && cluster.ClusterID != "" && cluster.ClusterID != cfg.ClusterID {
+				log.Fatalf("Peers belong to cluster %s, but cluster_id is %s", cluster.ClusterID, cfg.ClusterID)
+			}
+			if isMember(cluster, cfg.NodeID) {
+				log.Printf("Node %s is in the cluster configuration but has no local Raft state; re-provisioning it", cfg.NodeID)
+				dirs, err := quarantineStaleDirs(cfg.StorageDirs())
+				if err != nil {
+					log.Fatalf("Failed to set aside stale local state: %v", err)
+				}
+				for _, dir := range dirs {
+					log.Printf("Moved stale local state to %s", dir)
+				}
+			}
+		}
 	}
 
-	// --- Initialize Store and Restore from WAL ---
+	// --- Initialize Store from the latest snapshot and the WAL after it ---
 	st := store.NewStore()
-	walPath := filepath.Join(cfg.DataDir, "app.wal")
-	log.Printf("Replaying Write-Ahead Log from %s...", walPath)
+	walPath := cfg.WALPath()
 
-	err := persistence.Replay(walPath, func(cmdBytes []byte) error {
-		var cmd internal_raft.Command
-		if err := json.Unmarshal(cmdBytes, &cmd); err != nil {
-			return err
+	// --- Rebuild from a named snapshot, discarding the local store ---
+	// The snapshot is read in full before anything is moved, so a bad name
+	// or a corrupt snapshot leaves the node as it was. Raft's log and
+	// snapshots are kept: the node resumes from the snapshot's log index and
+	// catches up from there.
+	if *restoreFrom != "" {
+		point, err := internal_raft.OpenRestorePoint(*restoreFrom, snapshots, internal_raft.NewArchiver(cfg.SnapshotArchivePath(), 0), keyring)
+		if err != nil {
+			log.Fatalf("Failed to read the snapshot to restore: %v", err)
 		}
-		switch cmd.Op {
-		case "SET":
-			st.Set(cmd.Key, cmd.Value)
-		case "DELETE":
-			st.Delete(cmd.Key)
+		dirs, err := quarantineStaleDirs(cfg.StorageDirs())
+		if err != nil {
+			log.Fatalf("Failed to set aside local state: %v", err)
 		}
-		return nil
-	})
-	if err != nil {
-		log.Fatalf("Failed to replay WAL: %v", err)
+		for _, dir := range dirs {
+			log.Printf("Moved local state to %s", dir)
+		}
+		if err := point.WriteWAL(walPath, keyring); err != nil {
+			log.Fatalf("Failed to write the restored WAL: %v", err)
+		}
+		log.Printf("Restored %d keys from %s at log index %d; drop -restore-snapshot before the next restart", point.Keys(), point.Source, point.Index)
 	}
-	log.Println("WAL replay complete. Store is up to date.")
+
+	log.Printf("Recovering store from snapshots and Write-Ahead Log %s...", walPath)
+
+	recovery, err := internal_raft.Recover(st, snapshots, walPath, keyring, cfg.ReplayWorkers())
+	if errors.Is(err, persistence.ErrPlaintextRecord) {
+		log.Fatalf("Failed to recover store: %v; if the WAL was written before encryption was enabled, set encryption_migrate_plaintext for one start", err)
+	} else if err != nil {
+		log.Fatalf("Failed to recover store: %v", err)
+	}
+	if recovery.SnapshotIndex > 0 {
+		log.Printf("Loaded snapshot at log index %d and replayed the WAL after it.", recovery.SnapshotIndex)
+	}
+	log.Printf("Recovery complete. Store is up to date through log index %d.", recovery.Index)
+
+	// A node holding another cluster's data must not take part in this one.
+	if len(cfg.ClusterID) > 255 {
+		log.Fatalf("Invalid config: cluster_id is longer than 255 bytes")
+	}
+	if id := internal_raft.ClusterID(st); id != "" && cfg.ClusterID != "" && id != cfg.ClusterID {
+		log.Fatalf("The data in %s belongs to cluster %s, but cluster_id is %s", cfg.DataDir, id, cfg.ClusterID)
+	}
+	clusterID := func() string {
+		if id := internal_raft.ClusterID(st); id != "" {
+			return id
+		}
+		return cfg.ClusterID
+	}
+
+	// Segments of cold values are rebuilt from the recovered store; those of
+	// an earlier run are never read again.
+	coldDir := filepath.Join(cfg.DataDir, "cold")
+	if err := os.RemoveAll(coldDir); err != nil {
+		log.Fatalf("Failed to remove old cold value segments: %v", err)
+	}
+	spillCold(st, coldDir, cfg.ColdValueBytes)
 
 	// --- Open WAL for new commands ---
-	wal, err := persistence.NewWAL(walPath)
+	wal, err := persistence.NewPipelinedWAL(walPath, keyring, cfg.WALPipelineDepth, persistence.WithSegmentBytes(cfg.WALSegmentBytes))
 	if err != nil {
 		log.Fatalf("Failed to open WAL: %v", err)
 	}
 
 	// --- Initialize FSM with Store and WAL ---
 	fsm := internal_raft.NewFSM(st, wal)
+	fsm.SetAppliedIndex(recovery.Index)
+	// Watches can resume from any change applied from here on.
+	watchHub := watch.NewHub(recovery.Index, watch.WithSize(cfg.WatchHistorySize), watch.WithMaxAge(cfg.WatchHistoryMaxAge))
+	fsm.SetWatchHub(watchHub)
+	fsm.SetSnapshotOptions(snapshotOpts)
+	if cfg.SnapshotArchiveInterval > 0 {
+		fsm.SetArchiver(internal_raft.NewArchiver(cfg.SnapshotArchivePath(), cfg.SnapshotArchiveRetain, internal_raft.WithFullEvery(cfg.SnapshotArchiveFullEvery)))
+		log.Printf("Archiving snapshots to %s every %s", cfg.SnapshotArchivePath(), cfg.SnapshotArchiveInterval)
+	}
 
 	// --- Raft Setup ---
 	raftConfig := raft.DefaultConfig()
 	raftConfig.LocalID = raft.ServerID(cfg.NodeID)
+	raftConfig.SnapshotInterval = cfg.SnapshotInterval
+	raftConfig.SnapshotThreshold = cfg.SnapshotThreshold
+	raftConfig.NoSnapshotRestoreOnStart = recovery.SkipRestore
 
-	raftAddr := fmt.Sprintf("%s:%d", cfg.Host, cfg.RaftPort)
-	addr, err := net.ResolveTCPAddr("tcp", raftAddr)
+	raftAddr := cfg.RaftListenAddr()
+	addr, err := net.ResolveTCPAddr("tcp", cfg.RaftAdvertise())
 	if err != nil {
-		log.Fatalf("Failed to resolve Raft address: %v", err)
+		log.Fatalf("Failed to resolve Raft advertise address: %v", err)
 	}
-	transport, err := raft.NewTCPTransport(raftAddr, addr, 3, 10*time.Second, os.Stderr)
-	if err != nil {
-		log.Fatalf("Failed to create Raft transport: %v", err)
+	log.Printf("Raft listening on %s, advertising %s", raftAddr, addr)
+	var certReloaders []*certs.Reloader
+	var transportOpts []internal_raft.TransportOption
+	if cfg.RaftTLSCertFile != "" {
+		if cfg.RaftTLSCAFile == "" {
+			log.Fatalf("Invalid config: raft_tls_cert_file needs raft_tls_ca_file to verify other nodes with")
+		}
+		raftCerts, err := certs.New(cfg.RaftTLSCertFile, cfg.RaftTLSKeyFile, cfg.RaftTLSCAFile)
+		if err != nil {
+			log.Fatalf("Failed to load the Raft TLS certificate: %v", err)
+		}
+		certReloaders = append(certReloaders, raftCerts)
+		transportOpts = append(transportOpts, internal_raft.WithTransportTLS(raftCerts.ServerConfig(), func(address string) (*tls.Config, error) {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return nil, err
+			}
+			return raftCerts.ClientConfig(host)
+		}))
+		log.Printf("Raft traffic is encrypted with mutual TLS")
 	}
-
-	snapshots, err := raft.NewFileSnapshotStore(cfg.DataDir, 2, os.Stderr)
-	if err != nil {
-		log.Fatalf("Failed to create snapshot store: %v", err)
+	if cfg.RaftClusterPreamble {
+		transportOpts = append(transportOpts, internal_raft.WithClusterPreamble())
 	}
-
-	logStore, err := raftboltdb.NewBoltStore(filepath.Join(cfg.DataDir, "raft.db"))
+	transport, err := internal_raft.NewClusterTransport(raftAddr, addr, clusterID, 3, 10*time.Second, os.Stderr, transportOpts...)
 	if err != nil {
-		log.Fatalf("Failed to create bolt store: %v", err)
+		log.Fatalf("Failed to create Raft transport: %v", err)
 	}
 
 	r, err := raft.NewRaft(raftConfig, fsm, logStore, logStore, snapshots, transport)
@@ -98,7 +277,15 @@ func main() {
 	}
 
 	// --- Conditionally Bootstrap the Cluster ---
-	if *bootstrap {
+	if rejoinCluster {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			defer cancel()
+			if err := rejoin(ctx, cfg.Peers, cfg.NodeID, cfg.RaftAdvertise(), cfg.HTTPAdvertise(), clusterID(), cfg.JoinToken); err != nil {
+				log.Printf("%v", err)
+			}
+		}()
+	} else if *bootstrap {
 		log.Println("Bootstrapping cluster...")
 		bootstrapConfig := raft.Configuration{
 			Servers: []raft.Server{
@@ -112,15 +299,422 @@ func main() {
 	}
 
 	// --- Start the HTTP Server ---
-	httpServer := server.New(st, r)
-	httpAddr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
-	log.Printf("Starting HTTP server on %s", httpAddr)
-	go func() {
-		if err := http.ListenAndServe(httpAddr, httpServer); err != nil {
-			log.Fatalf("HTTP server failed: %v", err)
+	adminAllowlist, err := server.ParseAllowlist(cfg.AdminAllowedCIDRs)
+	if err != nil {
+		log.Fatalf("Invalid config: admin_allowed_cidrs: %v", err)
+	}
+	tenantList, err := tenants(cfg)
+	if err != nil {
+		log.Fatalf("Invalid config: tenants: %v", err)
+	}
+	if len(tenantList) > 0 {
+		log.Printf("Multi-tenant mode: %d tenants; data-plane requests need a tenant API key", len(tenantList))
+	}
+	opts := []server.Option{
+		server.WithSlowRequestThreshold(cfg.SlowRequestThreshold),
+		server.WithAPIExplorer(cfg.APIExplorer),
+		server.WithFailpoints(cfg.Failpoints),
+		server.WithReadOnly(cfg.ReadOnly),
+		server.WithJoinToken(cfg.JoinToken),
+		server.WithAdminAllowlist(adminAllowlist),
+		server.WithSeparateAdmin(cfg.AdminAddr != ""),
+		server.WithTenants(tenantList),
+		server.WithKeyMetering(cfg.APIKeyMetering),
+		server.WithKeyRateLimit(cfg.APIKeyRequestsPerSecond),
+		server.WithMaxRequestBytes(cfg.HTTPMaxBodyBytes),
+		server.WithRangeDeleteLimit(cfg.RangeDeleteMaxKeys),
+		server.WithDataDir(cfg.DataDir),
+		server.WithStorageDirs(cfg.StorageDirs()[1:]...),
+		server.WithTxIsolation(txIsolation),
+		server.WithTxLimits(transaction.Limits{MaxActive: cfg.TxMaxActive, MaxWriteSet: cfg.TxMaxWriteSet, MaxStagedBytes: cfg.TxMaxStagedBytes, IdleTimeout: cfg.TxIdleTimeout}),
+		server.WithIdempotencyTTL(cfg.TxIdempotencyTTL),
+		server.WithReadLease(cfg.ReadLease),
+	}
+	rl := &reloader{load: loadConfig, current: cfg, raft: r}
+	opts = append(opts, server.WithConfigInspector(func() []config.Setting {
+		return rl.Current().Effective()
+	}), server.WithTunables(rl.Update))
+	opts = append(opts, server.WithCompactor(func() (v1.CompactResponse, error) {
+		res, err := internal_raft.Compact(r, fsm)
+		if err == nil {
+			spillCold(st, coldDir, cfg.ColdValueBytes)
+		}
+		return v1.CompactResponse{SnapshotIndex: res.SnapshotIndex, WALBytesBefore: res.WALBytesBefore, WALBytesAfter: res.WALBytesAfter}, err
+	}))
+	if cfg.KeyHistoryVersions > 0 {
+		history := internal_raft.NewHistory(cfg.KeyHistoryVersions)
+		fsm.SetHistory(history)
+		opts = append(opts, server.WithKeyHistory(func(key string) []v1.KeyVersion {
+			var versions []v1.KeyVersion
+			for _, v := range history.Versions(key) {
+				versions = append(versions, v1.KeyVersion{Version: v.Version, Value: v.Value, Deleted: v.Deleted, Index: v.Index, Time: v.Time, Writer: v.Writer, RequestID: v.RequestID})
+			}
+			return versions
+		}))
+	}
+	opts = append(opts, server.WithWatchHub(watchHub))
+	opts = append(opts, server.WithDigester(func(ctx context.Context, index uint64) (v1.DigestResponse, error) {
+		d, err := fsm.DigestAt(ctx, index)
+		if errors.Is(err, internal_raft.ErrDigestUnavailable) {
+			err = server.ErrDigestUnavailable
+		}
+		return v1.DigestResponse{Index: d.Index, Hash: d.Hash, Keys: d.Keys}, err
+	}))
+	if keyring != nil {
+		opts = append(opts, server.WithKeyRotator(keyring))
+	}
+	if cfg.UpstreamReadThrough || cfg.UpstreamWriteThrough {
+		up, err := openUpstream(cfg)
+		if err != nil {
+			log.Fatalf("Invalid config: upstream_url: %v", err)
+		}
+		if cfg.UpstreamReadThrough {
+			opts = append(opts, server.WithReadThrough(up, cfg.UpstreamBackfill))
+			if cfg.UpstreamBackfill {
+				log.Printf("Reading keys missing from the store through from upstream, and keeping them")
+			} else {
+				log.Printf("Proxying reads of keys missing from the store to upstream")
+			}
+		}
+		if cfg.UpstreamWriteThrough {
+			opts = append(opts, server.WithWriteThrough(up))
+			log.Printf("Writing SETs and DELETEs through to upstream once they commit")
+		}
+	}
+	if cfg.AuditLogFile != "" {
+		auditLog, err := audit.Open(cfg.AuditLogFile)
+		if err != nil {
+			log.Fatalf("Failed to open audit log: %v", err)
 		}
-	}()
+		opts = append(opts, server.WithAuditor(auditLog))
+		log.Printf("Audit logging to %s", cfg.AuditLogFile)
+	}
+	if cfg.ReadOnly {
+		log.Printf("Read-only mode: this node refuses all mutating requests")
+	}
+	if cfg.Failpoints {
+		log.Printf("WARNING: Failpoints are enabled; /admin/failpoints can inject faults into this node")
+	}
+	apiServer := server.New(st, r, opts...)
+	httpServer := newHTTPServer(cfg, apiServer)
+	var httpTLS *tls.Config
+	protos := []string{"http/1.1"}
+	if cfg.HTTP2 {
+		protos = []string{"h2", "http/1.1"}
+	}
+	if len(cfg.ACMEDomains) > 0 {
+		if cfg.TLSCertFile != "" {
+			log.Fatalf("Invalid config: acme_domains and tls_cert_file are mutually exclusive")
+		}
+		m, err := certs.NewACME(cfg.ACMEDomains, cfg.ACMEEmail, cfg.ACMECachePath(), cfg.ACMEDirectoryURL)
+		if err != nil {
+			log.Fatalf("Invalid config: %v", err)
+		}
+		httpTLS = certs.ACMEServerConfig(m, protos...)
+		log.Printf("Getting TLS certificates for %s from ACME, cached in %s", strings.Join(cfg.ACMEDomains, ", "), cfg.ACMECachePath())
+		if cfg.ACMEHTTPAddr != "" {
+			ln, err := net.Listen("tcp", cfg.ACMEHTTPAddr)
+			if err != nil {
+				log.Fatalf("Failed to listen on %s: %v", cfg.ACMEHTTPAddr, err)
+			}
+			log.Printf("Answering ACME challenges on %s", cfg.ACMEHTTPAddr)
+			go serveHTTP(newHTTPServer(cfg, m.HTTPHandler(nil)), ln)
+		}
+	} else if cfg.TLSCertFile != "" {
+		httpCerts, err := certs.New(cfg.TLSCertFile, cfg.TLSKeyFile, "")
+		if err != nil {
+			log.Fatalf("Failed to load the TLS certificate: %v", err)
+		}
+		certReloaders = append(certReloaders, httpCerts)
+		httpTLS = httpCerts.ServerConfig()
+		httpTLS.NextProtos = protos
+	}
+	for _, httpAddr := range cfg.HTTPListenAddrs() {
+		ln, err := net.Listen("tcp", httpAddr)
+		if err != nil {
+			log.Fatalf("Failed to listen on %s: %v", httpAddr, err)
+		}
+		// The unix socket, below, relies on file permissions instead.
+		if httpTLS != nil {
+			ln = tls.NewListener(ln, httpTLS)
+		}
+		log.Printf("Starting HTTP server on %s", httpAddr)
+		go serveHTTP(httpServer, ln)
+	}
+	log.Printf("Advertising HTTP API at %s", cfg.HTTPAdvertise())
+	if cfg.AdminAddr != "" {
+		ln, err := net.Listen("tcp", cfg.AdminAddr)
+		if err != nil {
+			log.Fatalf("Failed to listen on %s: %v", cfg.AdminAddr, err)
+		}
+		if httpTLS != nil {
+			ln = tls.NewListener(ln, httpTLS)
+		}
+		log.Printf("Starting admin HTTP server on %s", cfg.AdminAddr)
+		go serveHTTP(newHTTPServer(cfg, apiServer.AdminHandler()), ln)
+	}
+	if cfg.UnixSocket != "" {
+		ln, err := listenUnix(cfg.UnixSocket)
+		if err != nil {
+			log.Fatalf("Failed to listen on unix socket: %v", err)
+		}
+		log.Printf("Serving HTTP API on unix socket %s", cfg.UnixSocket)
+		go serveHTTP(httpServer, ln)
+	}
+
+	if cfg.GRPCPort != 0 || cfg.GRPCUnixSocket != "" {
+		gs := grpc.NewServer()
+		apiServer.RegisterGRPC(gs)
+		if cfg.GRPCPort != 0 {
+			addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.GRPCPort)
+			ln, err := net.Listen("tcp", addr)
+			if err != nil {
+				log.Fatalf("Failed to listen on %s: %v", addr, err)
+			}
+			log.Printf("Starting gRPC server on %s", addr)
+			go serveGRPC(gs, ln)
+		}
+		if cfg.GRPCUnixSocket != "" {
+			ln, err := listenUnix(cfg.GRPCUnixSocket)
+			if err != nil {
+				log.Fatalf("Failed to listen on gRPC unix socket: %v", err)
+			}
+			log.Printf("Serving gRPC API on unix socket %s", cfg.GRPCUnixSocket)
+			go serveGRPC(gs, ln)
+		}
+	}
+	if cfg.GRPCGatewayPort != 0 {
+		gateway, err := apiServer.GatewayHandler(context.Background())
+		if err != nil {
+			log.Fatalf("Failed to start gRPC gateway: %v", err)
+		}
+		addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.GRPCGatewayPort)
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Fatalf("Failed to listen on %s: %v", addr, err)
+		}
+		log.Printf("Starting gRPC gateway on %s", addr)
+		go serveHTTP(newHTTPServer(cfg, gateway), ln)
+	}
+
+	rl.server = apiServer
+	rl.certs = certReloaders
+	go rl.watch()
+	for _, c := range certReloaders {
+		go c.Watch(cfg.TLSReloadInterval, nil)
+	}
+	go internal_raft.RunTombstonePurger(r, st, cfg.TombstoneRetention, nil)
+	go internal_raft.RunIdempotencyPurger(r, st, cfg.TxIdempotencyTTL, nil)
+	go internal_raft.RunScheduler(r, fsm, nil)
+	go internal_raft.RunArchiveScheduler(r, cfg.SnapshotArchiveInterval, nil)
+	go internal_raft.AssignClusterID(r, st, cfg.ClusterID, nil)
+	go internal_raft.AdvertiseHTTP(r, st, cfg.RaftAdvertise(), cfg.HTTPAdvertise(), nil)
+	if len(cfg.Webhooks) > 0 {
+		endpoints := make([]webhook.Endpoint, 0, len(cfg.Webhooks))
+		for _, h := range cfg.Webhooks {
+			endpoints = append(endpoints, webhook.Endpoint{Prefix: h.Prefix, URL: h.URL, Secret: h.Secret})
+			log.Printf("Sending changes under %q to a webhook", h.Prefix)
+		}
+		go webhook.New(endpoints).Run(watchHub, func() bool { return r.State() == raft.Leader }, nil)
+	}
 
 	log.Println("HeliosDB node started successfully.")
 	select {}
-}
\ No newline at end of file
+}
+
+// spillCold moves values of at least minValueBytes out of the heap into a
+// memory-mapped segment in dir. It does nothing if minValueBytes is 0.
+func spillCold(st *store.Store, dir string, minValueBytes int) {
+	if minValueBytes <= 0 {
+		return
+	}
+	res, err := st.Spill(dir, minValueBytes)
+	if err != nil {
+		log.Printf("Failed to spill cold values: %v", err)
+		return
+	}
+	if res.Keys > 0 {
+		log.Printf("Serving %d values from a %d-byte memory-mapped segment", res.Keys, res.Bytes)
+	}
+	if res.Retired > 0 {
+		log.Printf("Removed %d memory-mapped segments that no longer serve any value", res.Retired)
+	}
+}
+
+// newSnapshotStore returns the Raft snapshot store selected by cfg.
+func newSnapshotStore(cfg *config.Config) (raft.SnapshotStore, error) {
+	switch cfg.SnapshotBackend {
+	case "", "file":
+		return raft.NewFileSnapshotStore(cfg.SnapshotPath(), cfg.SnapshotRetain, os.Stderr)
+	case "s3":
+		log.Printf("Storing Raft snapshots in s3://%s/%s", cfg.SnapshotS3Bucket, cfg.SnapshotS3Prefix)
+		return snapshots.NewS3Store(context.Background(), snapshots.S3Options{
+			Bucket:   cfg.SnapshotS3Bucket,
+			Prefix:   cfg.SnapshotS3Prefix,
+			Region:   cfg.SnapshotS3Region,
+			Endpoint: cfg.SnapshotS3Endpoint,
+			Retain:   cfg.SnapshotRetain,
+		})
+	}
+	return nil, fmt.Errorf("unknown snapshot_backend %q (want file or s3)", cfg.SnapshotBackend)
+}
+
+// keyringOptions returns the options cfg loads the encryption keyring with.
+func keyringOptions(cfg *config.Config) []persistence.KeyringOption {
+	if cfg.EncryptionMigratePlaintext {
+		return []persistence.KeyringOption{persistence.WithPlaintextMigration()}
+	}
+	return nil
+}
+
+// snapshotOptions returns how cfg says snapshots should be written. The
+// keyring, which may be nil, opens encrypted snapshots either way.
+func snapshotOptions(cfg *config.Config, keyring *persistence.Keyring) (internal_raft.SnapshotOptions, error) {
+	opts := internal_raft.SnapshotOptions{Encrypt: cfg.SnapshotEncryption, Keyring: keyring}
+	switch cfg.SnapshotCompression {
+	case "", "none":
+	case "zstd":
+		opts.Compress = true
+	default:
+		return opts, fmt.Errorf("unknown snapshot_compression %q (want none or zstd)", cfg.SnapshotCompression)
+	}
+	if opts.Encrypt && keyring == nil {
+		return opts, fmt.Errorf("snapshot_encryption needs encryption_key_file")
+	}
+	return opts, nil
+}
+
+// tenants converts the tenants in cfg for the server. It fails if two share
+// a name or an API key, or if one's namespace contains another's, which
+// would let a tenant read and write the other's keys.
+func tenants(cfg *config.Config) ([]server.Tenant, error) {
+	var out []server.Tenant
+	owners := make(map[string]string)
+	for _, t := range cfg.Tenants {
+		if t.Name == "" {
+			return nil, fmt.Errorf("a tenant has no name")
+		}
+		namespace := t.Namespace
+		if namespace == "" {
+			namespace = t.Name + "/"
+		}
+		if len(t.APIKeys) == 0 {
+			return nil, fmt.Errorf("tenant %s has no api_keys", t.Name)
+		}
+		for _, key := range t.APIKeys {
+			if key == "" {
+				return nil, fmt.Errorf("tenant %s has an empty API key", t.Name)
+			}
+			if owner, ok := owners[key]; ok {
+				return nil, fmt.Errorf("tenants %s and %s share an API key", owner, t.Name)
+			}
+			owners[key] = t.Name
+		}
+		for _, other := range out {
+			if other.Name == t.Name {
+				return nil, fmt.Errorf("two tenants are named %s", t.Name)
+			}
+			if strings.HasPrefix(namespace, other.Namespace) || strings.HasPrefix(other.Namespace, namespace) {
+				return nil, fmt.Errorf("namespaces %q of %s and %q of %s overlap", namespace, t.Name, other.Namespace, other.Name)
+			}
+		}
+		out = append(out, server.Tenant{Name: t.Name, Namespace: namespace, APIKeys: t.APIKeys, RequestsPerSecond: t.RequestsPerSecond})
+	}
+	return out, nil
+}
+
+// flagKeys maps command-line override flags to the config keys they set.
+var flagKeys = map[string]string{
+	"node-id":   "node_id",
+	"host":      "host",
+	"port":      "port",
+	"raft-port": "raft_port",
+	"data-dir":  "data_dir",
+}
+
+// applyFlags overrides config values with the override flags that were
+// explicitly given on the command line. Flags win over env and the file.
+func applyFlags(cfg *config.Config, fs *flag.FlagSet) error {
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		key, ok := flagKeys[f.Name]
+		if !ok || err != nil {
+			return
+		}
+		if setErr := cfg.Set(key, f.Value.String(), config.SourceFlag); setErr != nil {
+			err = fmt.Errorf("invalid value for --%s: %w", f.Name, setErr)
+		}
+	})
+	return err
+}
+
+// serveGRPC serves gs on ln, exiting the process if the listener fails.
+func serveGRPC(gs *grpc.Server, ln net.Listener) {
+	if err := gs.Serve(ln); err != nil {
+		log.Fatalf("gRPC server on %s failed: %v", ln.Addr(), err)
+	}
+}
+
+// serveHTTP serves srv on ln, exiting the process if the listener fails.
+func serveHTTP(srv *http.Server, ln net.Listener) {
+	if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("HTTP server on %s failed: %v", ln.Addr(), err)
+	}
+}
+
+// newHTTPServer wraps handler in an http.Server configured with the
+// timeouts and limits from cfg, rather than relying on net/http's defaults
+// (which have no timeouts at all).
+func newHTTPServer(cfg *config.Config, handler http.Handler) *http.Server {
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.HTTPReadHeaderTimeout,
+		ReadTimeout:       cfg.HTTPReadTimeout,
+		WriteTimeout:      cfg.HTTPWriteTimeout,
+		IdleTimeout:       cfg.HTTPIdleTimeout,
+		MaxHeaderBytes:    cfg.HTTPMaxHeaderBytes,
+		Protocols:         new(http.Protocols),
+	}
+	srv.Protocols.SetHTTP1(true)
+	if cfg.HTTP2 {
+		srv.Protocols.SetHTTP2(true)
+		srv.Protocols.SetUnencryptedHTTP2(true)
+	}
+	srv.SetKeepAlivesEnabled(cfg.HTTPKeepAlives)
+	return srv
+}
+
+// listenUnix listens on a unix socket at path, replacing a stale socket left
+// behind by a previous run. Access is limited to the owner and group, which
+// lets same-host sidecars rely on file permissions instead of network auth.
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0660); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// openUpstream returns the upstream cfg reads and writes through to.
+func openUpstream(cfg *config.Config) (upstream.Store, error) {
+	opts := []upstream.Option{}
+	if cfg.UpstreamTimeout > 0 {
+		opts = append(opts, upstream.WithTimeout(cfg.UpstreamTimeout))
+	}
+	if cfg.UpstreamAuthorization != "" {
+		opts = append(opts, upstream.WithHeader("Authorization", cfg.UpstreamAuthorization))
+	}
+	return upstream.Open(cfg.UpstreamURL, opts...)
+}
@@ -1,2 +1,553 @@
 package main
 
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/api/v1/pb"
+	"github.com/ASHISH26940/heliosdb/internal/config"
+	"github.com/ASHISH26940/heliosdb/internal/logging"
+	"github.com/ASHISH26940/heliosdb/internal/persistence"
+	internal_raft "github.com/ASHISH26940/heliosdb/internal/raft"
+	"github.com/ASHISH26940/heliosdb/internal/server"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+	"github.com/ASHISH26940/heliosdb/internal/transaction"
+	"github.com/hashicorp/raft"
+	"github.com/hashicorp/raft-boltdb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestNewHTTPServer(t *testing.T) {
+	cfg := config.New()
+	srv := newHTTPServer(cfg, http.NotFoundHandler())
+
+	if srv.ReadHeaderTimeout != cfg.HTTPReadHeaderTimeout || srv.ReadHeaderTimeout == 0 {
+		t.Errorf("expected a non-zero ReadHeaderTimeout from config, got %s", srv.ReadHeaderTimeout)
+	}
+	if srv.IdleTimeout != cfg.HTTPIdleTimeout || srv.MaxHeaderBytes != cfg.HTTPMaxHeaderBytes {
+		t.Error("expected idle timeout and header limit to come from config")
+	}
+	if !srv.Protocols.HTTP1() || !srv.Protocols.UnencryptedHTTP2() {
+		t.Error("expected HTTP/1 and cleartext HTTP/2 to be enabled by default")
+	}
+
+	cfg.HTTP2 = false
+	srv = newHTTPServer(cfg, http.NotFoundHandler())
+	if srv.Protocols.HTTP2() || srv.Protocols.UnencryptedHTTP2() {
+		t.Error("expected HTTP/2 to be disabled when http2 = false")
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "helios.sock")
+
+	// A stale socket from a previous run must be replaced.
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("failed to create stale socket: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := listenUnix(path)
+	if err != nil {
+		t.Fatalf("expected to listen over a stale socket, got: %v", err)
+	}
+	defer ln.Close()
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get("http://unix/")
+	if err != nil {
+		t.Fatalf("request over unix socket failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "ok" {
+		t.Errorf("expected body 'ok', got '%s'", body)
+	}
+
+	// A regular file at the path must not be deleted.
+	filePath := filepath.Join(t.TempDir(), "not-a-socket")
+	os.WriteFile(filePath, nil, 0644)
+	if _, err := listenUnix(filePath); err == nil {
+		t.Error("expected an error when the path is a regular file, but got none")
+	}
+}
+
+func TestServeGRPCUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "grpc.sock")
+	ln, err := listenUnix(path)
+	if err != nil {
+		t.Fatalf("failed to listen on unix socket: %v", err)
+	}
+	st := store.NewStore()
+	wal, err := persistence.NewWAL(filepath.Join(t.TempDir(), "app.wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	rc := raft.DefaultConfig()
+	rc.LocalID = "node1"
+	rc.Logger = nil
+	addr, trans := raft.NewInmemTransport("node1")
+	r, err := raft.NewRaft(rc, internal_raft.NewFSM(st, wal), raft.NewInmemStore(), raft.NewInmemStore(), raft.NewInmemSnapshotStore(), trans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Shutdown()
+	r.BootstrapCluster(raft.Configuration{Servers: []raft.Server{{ID: rc.LocalID, Address: addr}}})
+	for deadline := time.Now().Add(5 * time.Second); r.State() != raft.Leader; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for leadership")
+		}
+	}
+	gs := grpc.NewServer()
+	server.New(st, r).RegisterGRPC(gs)
+	go serveGRPC(gs, ln)
+	defer gs.Stop()
+
+	conn, err := grpc.NewClient("unix://"+path, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+	kvc := pb.NewKVServiceClient(conn)
+
+	// --- Test Case 1: The gRPC API is served on the socket ---
+	if _, err := kvc.Set(context.Background(), &pb.SetRequest{Key: "foo", Value: "bar"}); err != nil {
+		t.Fatalf("expected Set to succeed, but got %v", err)
+	}
+	got, err := kvc.Get(context.Background(), &pb.GetRequest{Key: "foo"})
+	if err != nil || got.GetValue() != "bar" {
+		t.Errorf("expected bar, but got %v (err %v)", got, err)
+	}
+}
+
+type fakeReloadableRaft struct{ rc raft.ReloadableConfig }
+
+func (f *fakeReloadableRaft) ReloadableConfig() raft.ReloadableConfig { return f.rc }
+func (f *fakeReloadableRaft) ReloadConfig(rc raft.ReloadableConfig) error {
+	f.rc = rc
+	return nil
+}
+
+type fakeTunableServer struct {
+	d       time.Duration
+	rates   map[string]float64
+	keyRate float64
+}
+
+func (f *fakeTunableServer) SetSlowRequestThreshold(d time.Duration) { f.d = d }
+func (f *fakeTunableServer) SetTenantRates(rates map[string]float64) { f.rates = rates }
+func (f *fakeTunableServer) SetKeyRateLimit(requestsPerSecond float64) error {
+	f.keyRate = requestsPerSecond
+	return nil
+}
+
+func TestReloader(t *testing.T) {
+	defer logging.SetLevel(logging.GetLevel())
+
+	updated := config.New()
+	updated.LogLevel = "debug"
+	updated.SlowRequestThreshold = time.Second
+	updated.SnapshotThreshold = 42
+	updated.Port = 9999 // Requires a restart
+	updated.APIKeyRequestsPerSecond = 20
+	updated.Tenants = []config.Tenant{{Name: "payments", APIKeys: []string{"new-key"}, RequestsPerSecond: 50}}
+	current := config.New()
+	current.Tenants = []config.Tenant{{Name: "payments", APIKeys: []string{"old-key"}, RequestsPerSecond: 10}}
+
+	fr := &fakeReloadableRaft{rc: raft.ReloadableConfig{TrailingLogs: 10}}
+	fs := &fakeTunableServer{}
+	rl := &reloader{
+		load:    func() (*config.Config, error) { return updated, nil },
+		current: current,
+		raft:    fr,
+		server:  fs,
+	}
+	if err := rl.reload(); err != nil {
+		t.Fatalf("expected reload to succeed, got: %v", err)
+	}
+
+	if logging.GetLevel() != logging.LevelDebug {
+		t.Errorf("expected log level debug, got %s", logging.GetLevel())
+	}
+	if fs.d != time.Second {
+		t.Errorf("expected slow threshold 1s, got %s", fs.d)
+	}
+	if fr.rc.SnapshotThreshold != 42 || fr.rc.TrailingLogs != 10 {
+		t.Errorf("unexpected Raft reloadable config: %+v", fr.rc)
+	}
+	if rl.current.Port != 8080 {
+		t.Errorf("expected port change to be deferred until restart, got %d", rl.current.Port)
+	}
+	if fs.keyRate != 20 || rl.current.APIKeyRequestsPerSecond != 20 {
+		t.Errorf("expected API key rate 20, got %v (current %v)", fs.keyRate, rl.current.APIKeyRequestsPerSecond)
+	}
+	if fs.rates["payments"] != 50 {
+		t.Errorf("expected tenant rate 50, got %v", fs.rates)
+	}
+	if got := rl.current.Tenants[0]; got.RequestsPerSecond != 50 || got.APIKeys[0] != "old-key" {
+		t.Errorf("expected only the tenant rate to be applied, got %+v", got)
+	}
+	if current.Tenants[0].RequestsPerSecond != 10 {
+		t.Errorf("expected the previous config to be left alone, got %+v", current.Tenants[0])
+	}
+
+	// An invalid config is rejected without touching the running node.
+	bad := config.New()
+	bad.LogLevel = "loud"
+	rl.load = func() (*config.Config, error) { return bad, nil }
+	if err := rl.reload(); err == nil {
+		t.Error("expected an error for an invalid log level, but got none")
+	}
+	if fs.d != time.Second {
+		t.Errorf("expected slow threshold to be unchanged after a failed reload, got %s", fs.d)
+	}
+}
+
+func TestApplyFlags(t *testing.T) {
+	fs := flag.NewFlagSet("heliosdb", flag.ContinueOnError)
+	fs.String("node-id", "", "")
+	fs.String("host", "", "")
+	fs.Int("port", 0, "")
+	fs.Int("raft-port", 0, "")
+	fs.String("data-dir", "", "")
+	if err := fs.Parse([]string{"--node-id", "node9", "--port=8089"}); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+
+	cfg := config.New()
+	cfg.Host = "from-file"
+	cfg.Port = 1234 // e.g. from env
+	if err := applyFlags(cfg, fs); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if cfg.NodeID != "node9" || cfg.Port != 8089 {
+		t.Errorf("expected flags to override node_id and port, got %s and %d", cfg.NodeID, cfg.Port)
+	}
+	if cfg.Host != "from-file" || cfg.RaftPort != 9080 {
+		t.Errorf("expected unset flags to leave values alone, got host %s, raft_port %d", cfg.Host, cfg.RaftPort)
+	}
+}
+
+func TestReloader_Update(t *testing.T) {
+	defer logging.SetLevel(logging.GetLevel())
+
+	fr := &fakeReloadableRaft{}
+	fs := &fakeTunableServer{}
+	rl := &reloader{current: config.New(), raft: fr, server: fs}
+
+	err := rl.Update(map[string]string{"log_level": "warn", "snapshot_threshold": "64", "api_key_requests_per_second": "12.5"})
+	if err != nil {
+		t.Fatalf("expected update to succeed, got: %v", err)
+	}
+	if fs.keyRate != 12.5 {
+		t.Errorf("expected API key rate 12.5, got %v", fs.keyRate)
+	}
+	if logging.GetLevel() != logging.LevelWarn || fr.rc.SnapshotThreshold != 64 {
+		t.Errorf("expected tunables to be applied, got level %s and threshold %d", logging.GetLevel(), fr.rc.SnapshotThreshold)
+	}
+	if rl.Current().Source("log_level") != config.SourceRuntime {
+		t.Errorf("expected log_level source to be runtime, got %s", rl.Current().Source("log_level"))
+	}
+
+	if err := rl.Update(map[string]string{"port": "1"}); err == nil {
+		t.Error("expected an error for a non-tunable key, but got none")
+	}
+	if err := rl.Update(map[string]string{"slow_request_threshold": "soon"}); err == nil {
+		t.Error("expected an error for an invalid duration, but got none")
+	}
+}
+
+func TestReprovision(t *testing.T) {
+	// --- Test Case 1: Stale state is set aside, everything else stays ---
+	dir := t.TempDir()
+	for _, name := range []string{"app.wal", "app.wal.tmp", "raft.db", "audit.log"} {
+		os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644)
+	}
+	os.Mkdir(filepath.Join(dir, "cold"), 0755)
+	stale, err := quarantineStaleState(dir)
+	if err != nil {
+		t.Fatalf("failed to quarantine: %v", err)
+	}
+	for _, name := range []string{"app.wal", "app.wal.tmp", "cold"} {
+		if _, err := os.Stat(filepath.Join(stale, name)); err != nil {
+			t.Errorf("expected %s to be moved aside, but got %v", name, err)
+		}
+	}
+	for _, name := range []string{"raft.db", "audit.log"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("expected %s to stay, but got %v", name, err)
+		}
+	}
+	if stale, err := quarantineStaleState(dir); err != nil || stale != "" {
+		t.Errorf("expected nothing left to move, but got %q (%v)", stale, err)
+	}
+
+	// --- Test Case 2: The cluster is found through any peer that answers ---
+	joins := 0
+	var joined v1.JoinRequest
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/admin/members":
+			json.NewEncoder(w).Encode(v1.MembersResponse{Leader: "10.0.0.1:9080", Members: []v1.Member{{NodeID: "node2"}}})
+		case "/v1/join":
+			if r.Header.Get(server.JoinTokenHeader) != "secret" {
+				http.Error(w, "no token", http.StatusUnauthorized)
+				return
+			}
+			json.NewDecoder(r.Body).Decode(&joined)
+			// The first attempt reaches a follower.
+			if joins++; joins == 1 {
+				http.Error(w, "not the leader", http.StatusForbidden)
+			}
+		}
+	}))
+	defer peer.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	peers := []string{down.URL, peer.URL}
+	cluster, ok := findCluster(context.Background(), peers)
+	if !ok || cluster.Leader != "10.0.0.1:9080" {
+		t.Fatalf("expected to find the cluster, but got %+v (found %v)", cluster, ok)
+	}
+	if !isMember(cluster, "node2") || isMember(cluster, "node3") {
+		t.Error("expected only node2 to be a member")
+	}
+	if _, ok := findCluster(context.Background(), []string{down.URL}); ok {
+		t.Error("expected no cluster without reachable peers, but found one")
+	}
+
+	// --- Test Case 3: Rejoining retries until the leader accepts ---
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := rejoin(ctx, peers, "node2", "127.0.0.1:9082", "127.0.0.1:8082", "", "secret"); err != nil {
+		t.Fatalf("expected to rejoin, but got %v", err)
+	}
+	if joins != 2 {
+		t.Errorf("expected 2 join attempts, but got %d", joins)
+	}
+	if joined.HTTPAddr != "127.0.0.1:8082" {
+		t.Errorf("expected the HTTP address to be sent, but got %+v", joined)
+	}
+}
+
+func TestRunVerify(t *testing.T) {
+	dir := t.TempDir()
+	var out bytes.Buffer
+
+	// --- Test Case 1: A directory without a Raft log cannot be verified ---
+	if code := runVerify([]string{"-data-dir", dir}, &out); code != 2 {
+		t.Errorf("expected exit code 2, but got %d: %s", code, out.String())
+	}
+
+	// --- Test Case 2: An empty node is consistent ---
+	logs, err := raftboltdb.NewBoltStore(filepath.Join(dir, "raft.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs.Close()
+	out.Reset()
+	if code := runVerify([]string{"-data-dir", dir}, &out); code != 0 {
+		t.Errorf("expected exit code 0, but got %d: %s", code, out.String())
+	}
+}
+
+func TestRunRecoverCluster(t *testing.T) {
+	dir := t.TempDir()
+	logs, err := raftboltdb.NewBoltStore(filepath.Join(dir, "raft.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := raft.Configuration{Servers: []raft.Server{
+		{ID: "node1", Address: "127.0.0.1:9080"},
+		{ID: "node2", Address: "127.0.0.1:9081"},
+		{ID: "node3", Address: "127.0.0.1:9082"},
+	}}
+	logs.StoreLogs([]*raft.Log{
+		{Index: 1, Term: 1, Type: raft.LogConfiguration, Data: raft.EncodeConfiguration(old)},
+		{Index: 2, Term: 1, Type: raft.LogCommand, Data: []byte(`{"op":"SET","key":"a","value":"1"}`)},
+	})
+	logs.SetUint64([]byte("CurrentTerm"), 1)
+	logs.Close()
+	var out bytes.Buffer
+
+	// --- Test Case 1: Nothing changes without -force ---
+	args := []string{"-data-dir", dir, "-node-id", "node1", "-members", "node1=127.0.0.1:9080,node4=127.0.0.1:9083"}
+	if code := runRecoverCluster(args, &out); code != 2 || !strings.Contains(out.String(), "node4 127.0.0.1:9083") {
+		t.Errorf("expected exit code 2 and the new members listed, but got %d: %s", code, out.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "snapshots")); err == nil {
+		t.Error("expected no snapshot to be written, but one was")
+	}
+
+	// --- Test Case 2: The new cluster must include this node ---
+	out.Reset()
+	if code := runRecoverCluster([]string{"-data-dir", dir, "-node-id", "node1", "-members", "node2=127.0.0.1:9081", "-force"}, &out); code != 2 {
+		t.Errorf("expected exit code 2, but got %d: %s", code, out.String())
+	}
+
+	// --- Test Case 3: With -force the configuration is replaced ---
+	out.Reset()
+	if code := runRecoverCluster(append(args, "-force"), &out); code != 0 {
+		t.Fatalf("expected exit code 0, but got %d: %s", code, out.String())
+	}
+	snapshots, err := raft.NewFileSnapshotStore(dir, 1, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metas, _ := snapshots.List()
+	if len(metas) != 1 || metas[0].Index != 2 || len(metas[0].Configuration.Servers) != 2 || metas[0].Configuration.Servers[1].ID != "node4" {
+		t.Errorf("expected a snapshot at index 2 with node1 and node4, but got %+v", metas)
+	}
+}
+
+func TestRunWALDump(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.wal")
+	wal, err := persistence.NewWAL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range []internal_raft.Command{
+		{Op: "SET", Key: "users/ada", Value: "hello", Index: 3, Term: 1},
+		{Op: "SET", Key: "orders/1", Value: "x", Index: 4, Term: 1},
+		{Op: "TX_COMMIT", WriteSet: []transaction.WriteOp{{Key: "users/bob", Value: "hi"}, {Key: "users/ada", Delete: true}}, Index: 5, Term: 2},
+	} {
+		if err := wal.WriteCommand(cmd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wal.Close()
+	var out bytes.Buffer
+
+	// --- Test Case 1: A key filter finds single- and multi-key writes ---
+	if code := runWAL([]string{"dump", "-path", path, "-key", "users/ada"}, &out); code != 0 {
+		t.Fatalf("expected exit code 0, but got %d: %s", code, out.String())
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[1], "SET") || !strings.Contains(lines[2], "deleted") {
+		t.Errorf("expected a header, the SET and the TX_COMMIT delete, but got:\n%s", out.String())
+	}
+
+	// --- Test Case 2: Index and op filters select whole records ---
+	out.Reset()
+	runWAL([]string{"dump", "-path", path, "-op", "set", "-from-index", "4", "-json"}, &out)
+	if got := strings.TrimSpace(out.String()); !strings.Contains(got, `"orders/1"`) || strings.Count(got, "\n") != 0 {
+		t.Errorf("expected only the SET at index 4, but got:\n%s", got)
+	}
+
+	// --- Test Case 3: A missing file is an error ---
+	out.Reset()
+	if code := runWAL([]string{"dump", "-path", path + ".missing"}, &out); code != 1 {
+		t.Errorf("expected exit code 1, but got %d", code)
+	}
+}
+
+func TestRunSnapshotInspect(t *testing.T) {
+	dir := t.TempDir()
+	st := store.NewStore()
+	st.Set("users/ada", "hello")
+	st.Set("users/ada", "hello again")
+	st.Set("orders/1", "x")
+	wal, err := persistence.NewWAL(filepath.Join(dir, "app.wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	snap, err := internal_raft.NewFSM(st, wal).Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshots, err := raft.NewFileSnapshotStore(dir, 1, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink, err := snapshots.Create(raft.SnapshotVersionMax, 7, 2, raft.Configuration{}, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+
+	// --- Test Case 1: The newest snapshot's metadata and keys are listed ---
+	if code := runSnapshot([]string{"inspect", "-data-dir", dir, "-prefix", "users/"}, &out); code != 0 {
+		t.Fatalf("expected exit code 0, but got %d: %s", code, out.String())
+	}
+	for _, want := range []string{"ID:", `"users/ada"  2`, "1 keys, 11 value bytes"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected the output to contain %q, but got:\n%s", want, out.String())
+		}
+	}
+
+	// --- Test Case 2: A single value is extracted verbatim ---
+	out.Reset()
+	runSnapshot([]string{"inspect", "-path", filepath.Join(dir, "snapshots", sink.ID()), "-key", "users/ada"}, &out)
+	if out.String() != "hello again" {
+		t.Errorf("expected %q, but got %q", "hello again", out.String())
+	}
+
+	// --- Test Case 3: A modified snapshot fails its CRC check ---
+	state := filepath.Join(dir, "snapshots", sink.ID(), "state.bin")
+	data, _ := os.ReadFile(state)
+	os.WriteFile(state, bytes.Replace(data, []byte(`"x"`), []byte(`"y"`), 1), 0644)
+	out.Reset()
+	if code := runSnapshot([]string{"inspect", "-path", state}, &out); code != 1 || !strings.Contains(out.String(), "CRC mismatch") {
+		t.Errorf("expected a CRC mismatch with exit code 1, but got %d:\n%s", code, out.String())
+	}
+}
+
+func TestTenants(t *testing.T) {
+	// --- Test Case 1: Namespaces default to the tenant's name ---
+	cfg := config.New()
+	cfg.Tenants = []config.Tenant{
+		{Name: "payments", APIKeys: []string{"k1"}, RequestsPerSecond: 50},
+		{Name: "search", Namespace: "idx:", APIKeys: []string{"k2", "k3"}},
+	}
+	got, err := tenants(cfg)
+	if err != nil {
+		t.Fatalf("failed to convert tenants: %v", err)
+	}
+	if len(got) != 2 || got[0].Namespace != "payments/" || got[1].Namespace != "idx:" || got[0].RequestsPerSecond != 50 {
+		t.Errorf("unexpected tenants: %+v", got)
+	}
+
+	// --- Test Case 2: Tenants must not share keys or namespaces ---
+	for name, bad := range map[string][]config.Tenant{
+		"no name":           {{APIKeys: []string{"k1"}}},
+		"no keys":           {{Name: "a"}},
+		"shared key":        {{Name: "a", APIKeys: []string{"k1"}}, {Name: "b", APIKeys: []string{"k1"}}},
+		"same name":         {{Name: "a", APIKeys: []string{"k1"}}, {Name: "a", Namespace: "x/", APIKeys: []string{"k2"}}},
+		"nested namespaces": {{Name: "a", APIKeys: []string{"k1"}}, {Name: "b", Namespace: "a/b/", APIKeys: []string{"k2"}}},
+	} {
+		cfg.Tenants = bad
+		if _, err := tenants(cfg); err == nil {
+			t.Errorf("expected %s to be rejected, but it was accepted", name)
+		}
+	}
+}
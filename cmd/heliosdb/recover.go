@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ASHISH26940/heliosdb/internal/config"
+	"github.com/ASHISH26940/heliosdb/internal/persistence"
+	internal_raft "github.com/ASHISH26940/heliosdb/internal/raft"
+	"github.com/boltdb/bolt"
+	"github.com/hashicorp/raft"
+	"github.com/hashicorp/raft-boltdb"
+)
+
+// runRecoverCluster implements "heliosdb recover-cluster": it rewrites a
+// stopped node's Raft state so that the node forms a new cluster with only
+// the given members, after a majority of the old one was lost for good. It
+// returns the process exit code.
+func runRecoverCluster(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("recover-cluster", flag.ContinueOnError)
+	fs.SetOutput(out)
+	configFile := fs.String("config", "", "Path to the surviving node's config file")
+	dataDir := fs.String("data-dir", "", "Data directory to recover (overrides the config file)")
+	nodeID := fs.String("node-id", "", "This node's ID (overrides the config file)")
+	members := fs.String("members", "", "Comma-separated id=raft_address pairs of the new cluster; defaults to this node alone")
+	keyFile := fs.String("encryption-key-file", "", "Keyring for encrypted snapshots (overrides the config file)")
+	force := fs.Bool("force", false, "Confirm that the lost nodes will never come back with their data")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg := config.New()
+	if *configFile != "" {
+		if err := cfg.Load(*configFile); err != nil {
+			fmt.Fprintf(out, "Failed to load config: %v\n", err)
+			return 2
+		}
+	}
+	if *dataDir != "" {
+		cfg.DataDir = *dataDir
+	}
+	if *nodeID != "" {
+		cfg.NodeID = *nodeID
+	}
+	if *keyFile != "" {
+		cfg.EncryptionKeyFile = *keyFile
+	}
+	if cfg.NodeID == "" {
+		fmt.Fprintln(out, "No node ID: pass -config or -node-id")
+		return 2
+	}
+	servers, err := parseMembers(*members, cfg)
+	if err != nil {
+		fmt.Fprintf(out, "Invalid -members: %v\n", err)
+		return 2
+	}
+
+	fmt.Fprintln(out, "The new cluster will be:")
+	for _, s := range servers {
+		fmt.Fprintf(out, "  %s %s\n", s.ID, s.Address)
+	}
+	if !*force {
+		fmt.Fprintln(out, "\nThis discards the old cluster configuration. Entries in this node's log that were never")
+		fmt.Fprintln(out, "committed become part of the new cluster's history. Nodes left out must never rejoin with")
+		fmt.Fprintln(out, "their old data. Stop this node and rerun with -force to proceed.")
+		return 2
+	}
+
+	var keyring *persistence.Keyring
+	if cfg.EncryptionKeyFile != "" {
+		if keyring, err = persistence.LoadKeyring(cfg.EncryptionKeyFile); err != nil {
+			fmt.Fprintf(out, "Failed to load encryption keyring: %v\n", err)
+			return 2
+		}
+	}
+	opts, err := snapshotOptions(cfg, keyring)
+	if err != nil {
+		fmt.Fprintf(out, "Invalid config: %v\n", err)
+		return 2
+	}
+
+	logPath := cfg.RaftLogPath()
+	if _, err := os.Stat(logPath); err != nil {
+		fmt.Fprintf(out, "No Raft state to recover: %v\n", err)
+		return 2
+	}
+	// A running node holds an exclusive lock on raft.db.
+	logs, err := raftboltdb.New(raftboltdb.Options{
+		Path:        logPath,
+		BoltOptions: &bolt.Options{Timeout: time.Second},
+	})
+	if err != nil {
+		fmt.Fprintf(out, "Failed to open the Raft log (is the node still running?): %v\n", err)
+		return 2
+	}
+	defer logs.Close()
+	snapshots, err := newSnapshotStore(cfg)
+	if err != nil {
+		fmt.Fprintf(out, "Failed to open snapshots: %v\n", err)
+		return 2
+	}
+
+	index, err := internal_raft.ForceConfiguration(cfg.NodeID, logs, logs, snapshots, servers, opts)
+	if err != nil {
+		fmt.Fprintf(out, "Recovery failed: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(out, "\nRecovered at log index %d. Start %s without -bootstrap; it will elect itself once a majority of the new cluster is up.\n", index, cfg.NodeID)
+	return 0
+}
+
+// parseMembers parses the -members flag of recover-cluster into Raft
+// servers. An empty flag means cfg's node alone. The node must be a member.
+func parseMembers(members string, cfg *config.Config) ([]raft.Server, error) {
+	if members == "" {
+		return []raft.Server{{ID: raft.ServerID(cfg.NodeID), Address: raft.ServerAddress(cfg.RaftAdvertise()), Suffrage: raft.Voter}}, nil
+	}
+	var servers []raft.Server
+	self := false
+	for _, m := range strings.Split(members, ",") {
+		id, addr, ok := strings.Cut(strings.TrimSpace(m), "=")
+		if !ok || id == "" || addr == "" {
+			return nil, fmt.Errorf("%q is not id=raft_address", m)
+		}
+		servers = append(servers, raft.Server{ID: raft.ServerID(id), Address: raft.ServerAddress(addr), Suffrage: raft.Voter})
+		self = self || id == cfg.NodeID
+	}
+	if !self {
+		return nil, fmt.Errorf("this node, %s, is not listed", cfg.NodeID)
+	}
+	return servers, nil
+}
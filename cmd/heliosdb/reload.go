@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ASHISH26940/heliosdb/internal/certs"
+	"github.com/ASHISH26940/heliosdb/internal/config"
+	"github.com/ASHISH26940/heliosdb/internal/logging"
+	"github.com/hashicorp/raft"
+)
+
+// reloadableRaft is the part of *raft.Raft that the reloader needs.
+type reloadableRaft interface {
+	ReloadableConfig() raft.ReloadableConfig
+	ReloadConfig(rc raft.ReloadableConfig) error
+}
+
+// tunableServer is the part of *server.Server that the reloader needs.
+type tunableServer interface {
+	SetSlowRequestThreshold(d time.Duration)
+	SetTenantRates(rates map[string]float64)
+	SetKeyRateLimit(requestsPerSecond float64) error
+}
+
+// reloader re-reads the configuration and applies the reloadable subset of it
+// to the running node.
+type reloader struct {
+	load    func() (*config.Config, error)
+	mu      sync.Mutex
+	current *config.Config
+	raft    reloadableRaft
+	server  tunableServer
+	certs   []*certs.Reloader // TLS certificates, read again on every SIGHUP
+}
+
+// reload loads the configuration again and applies whatever can change at
+// runtime, logging every change and whether it took effect.
+func (rl *reloader) reload() error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	updated, err := rl.load()
+	if err != nil {
+		return err
+	}
+	changed := config.Changes(rl.current, updated)
+	if len(changed) == 0 {
+		log.Println("CONFIG: Reloaded, nothing changed.")
+		return nil
+	}
+
+	if err := rl.apply(updated); err != nil {
+		return err
+	}
+	pending := config.Changes(rl.current, updated)
+	for _, key := range changed {
+		if !slices.Contains(pending, key) {
+			log.Printf("CONFIG: Applied new value for %s", key)
+		} else if key == "tenants" {
+			log.Printf("CONFIG: Applied new tenant request rates; other tenant changes require a restart to take effect")
+		} else {
+			log.Printf("CONFIG: %s changed but requires a restart to take effect", key)
+		}
+	}
+	return nil
+}
+
+// Update changes runtime tunables by config key without touching the config
+// file. Keys that are not in config.Reloadable are rejected.
+func (rl *reloader) Update(values map[string]string) error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	updated := rl.current.Clone()
+	for key, raw := range values {
+		if !config.Reloadable[key] {
+			return fmt.Errorf("%s is not a runtime tunable", key)
+		}
+		if err := updated.Set(key, raw, config.SourceRuntime); err != nil {
+			return fmt.Errorf("invalid value for %s: %w", key, err)
+		}
+	}
+	if err := rl.apply(updated); err != nil {
+		return err
+	}
+	for key, raw := range values {
+		log.Printf("CONFIG: %s set to %s at runtime", key, raw)
+	}
+	return nil
+}
+
+// apply pushes the reloadable settings of updated into the running node and
+// records them as current. Settings that need a restart keep their running
+// values, so they are reported again on the next reload. Of the tenants, only
+// the request rates of those already running are reloadable.
+func (rl *reloader) apply(updated *config.Config) error {
+	if err := applyLogLevel(updated.LogLevel); err != nil {
+		return err
+	}
+	if err := rl.server.SetKeyRateLimit(updated.APIKeyRequestsPerSecond); err != nil {
+		return err
+	}
+	rates := make(map[string]float64, len(updated.Tenants))
+	for _, t := range updated.Tenants {
+		rates[t.Name] = t.RequestsPerSecond
+	}
+	rl.server.SetTenantRates(rates)
+	rl.server.SetSlowRequestThreshold(updated.SlowRequestThreshold)
+	rc := rl.raft.ReloadableConfig()
+	rc.SnapshotInterval = updated.SnapshotInterval
+	rc.SnapshotThreshold = updated.SnapshotThreshold
+	if err := rl.raft.ReloadConfig(rc); err != nil {
+		return err
+	}
+
+	applied := rl.current.Clone()
+	for key := range config.Reloadable {
+		if err := applied.CopyFrom(updated, key); err != nil {
+			return err
+		}
+	}
+	for i, t := range applied.Tenants {
+		if rps, ok := rates[t.Name]; ok {
+			applied.Tenants[i].RequestsPerSecond = rps
+		}
+	}
+	rl.current = applied
+	return nil
+}
+
+// Current returns the configuration the node is running with.
+func (rl *reloader) Current() *config.Config {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.current
+}
+
+// watch reloads the configuration every time the process receives SIGHUP.
+func (rl *reloader) watch() {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	for range sighup {
+		log.Println("CONFIG: Received SIGHUP, reloading configuration...")
+		if err := rl.reload(); err != nil {
+			log.Printf("CONFIG: Reload failed, keeping the current configuration: %v", err)
+		}
+		for _, c := range rl.certs {
+			if err := c.Reload(); err != nil {
+				log.Printf("TLS: Reload failed, keeping the current certificate: %v", err)
+			} else {
+				log.Println("TLS: Reloaded certificate.")
+			}
+		}
+	}
+}
+
+// applyLogLevel sets the process-wide log level from its config name.
+func applyLogLevel(name string) error {
+	level, err := logging.ParseLevel(name)
+	if err != nil {
+		return err
+	}
+	logging.SetLevel(level)
+	return nil
+}
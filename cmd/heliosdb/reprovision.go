@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/server"
+)
+
+// peerTimeout bounds each request a starting node makes to its peers.
+const peerTimeout = 5 * time.Second
+
+// staleFiles are the files in the data directory that hold state derived
+// from the Raft log. Without the log they describe a history the cluster may
+// have moved on from.
+var staleFiles = []string{"app.wal", "cold"}
+
+// findCluster asks each peer, given as an HTTP base URL, for the cluster
+// configuration, and returns the first answer. ok is false if no peer
+// answered, e.g. because this is the first node of a new cluster.
+func findCluster(ctx context.Context, peers []string) (v1.MembersResponse, bool) {
+	for _, peer := range peers {
+		var res v1.MembersResponse
+		if err := peerRequest(ctx, http.MethodGet, peer, "/v1/admin/members", nil, nil, &res); err != nil {
+			log.Printf("Peer %s did not report the cluster configuration: %v", peer, err)
+			continue
+		}
+		return res, true
+	}
+	return v1.MembersResponse{}, false
+}
+
+// isMember reports whether nodeID is in the cluster configuration.
+func isMember(cluster v1.MembersResponse, nodeID string) bool {
+	for _, m := range cluster.Members {
+		if m.NodeID == nodeID {
+			return true
+		}
+	}
+	return false
+}
+
+// quarantineStaleState moves the files that outlive a wiped Raft log into a
+// new stale-<timestamp> directory under dataDir, so that they are neither
+// replayed nor lost. It returns that directory, or "" if there was nothing
+// to move.
+func quarantineStaleState(dataDir string) (string, error) {
+	dir := filepath.Join(dataDir, "stale-"+strconv.FormatInt(time.Now().Unix(), 10))
+	moved := false
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		return "", err
+	}
+	for _, e := range entries {
+		if !isStale(e.Name()) {
+			continue
+		}
+		if !moved {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return "", err
+			}
+			moved = true
+		}
+		if err := os.Rename(filepath.Join(dataDir, e.Name()), filepath.Join(dir, e.Name())); err != nil {
+			return "", err
+		}
+	}
+	if !moved {
+		return "", nil
+	}
+	return dir, nil
+}
+
+// quarantineStaleDirs sets aside the stale state in each of dirs, which may
+// be on different volumes, and returns the directories it was moved to.
+func quarantineStaleDirs(dirs []string) ([]string, error) {
+	var moved []string
+	for _, dataDir := range dirs {
+		dir, err := quarantineStaleState(dataDir)
+		if err != nil {
+			return moved, err
+		}
+		if dir != "" {
+			moved = append(moved, dir)
+		}
+	}
+	return moved, nil
+}
+
+// isStale reports whether name, in the data directory, is one of staleFiles
+// or a WAL temporary file.
+func isStale(name string) bool {
+	for _, f := range staleFiles {
+		if name == f || strings.HasPrefix(name, f+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// rejoin asks the peers to add this node to the cluster, retrying until the
+// leader accepts or ctx is done. Followers refuse joins, so each attempt
+// tries every peer in turn. clusterID, if known, lets the leader refuse a
+// node of another cluster; joinToken is sent if the cluster requires one.
+// httpAddr is recorded so that clients can be pointed at this node while it
+// leads.
+func rejoin(ctx context.Context, peers []string, nodeID, raftAddr, httpAddr, clusterID, joinToken string) error {
+	req := v1.JoinRequest{NodeID: nodeID, Addr: raftAddr, HTTPAddr: httpAddr, ClusterID: clusterID}
+	header := http.Header{}
+	if joinToken != "" {
+		header.Set(server.JoinTokenHeader, joinToken)
+	}
+	for {
+		var err error
+		for _, peer := range peers {
+			if err = peerRequest(ctx, http.MethodPost, peer, "/v1/join", header, req, nil); err == nil {
+				log.Printf("Rejoined the cluster via %s", peer)
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to rejoin the cluster: %w (last error: %v)", ctx.Err(), err)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// peerRequest sends a JSON request, with any extra header, to a peer's HTTP
+// API and decodes the response into out, if it is not nil.
+func peerRequest(ctx context.Context, method, peer, path string, header http.Header, in, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, peerTimeout)
+	defer cancel()
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(peer, "/")+path, &body)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s returned status %d", method, path, resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,61 @@
+// Package audit records mutating operations to an append-only audit trail.
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry describes a single audited operation: who did what, when, and from where.
+type Entry struct {
+	Time       time.Time `json:"time"`
+	Principal  string    `json:"principal"`
+	RemoteAddr string    `json:"remote_addr"`
+	RequestID  string    `json:"request_id,omitempty"`
+	Op         string    `json:"op"`
+	Key        string    `json:"key,omitempty"`
+	Keys       []string  `json:"keys,omitempty"` // For transactions
+	NodeID     string    `json:"node_id,omitempty"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Log is a thread-safe, append-only audit log backed by a file.
+type Log struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Open opens (or creates) the audit log at path for appending.
+func Open(path string) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &Log{file: file}, nil
+}
+
+// Record appends an entry to the audit log, stamping it with the current time if unset.
+func (l *Log) Record(e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return l.file.Sync()
+}
+
+// Close closes the underlying file.
+func (l *Log) Close() error {
+	return l.file.Close()
+}
@@ -0,0 +1,54 @@
+// Package audit_test contains the unit tests for the audit package.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLog_Record(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("failed to open audit log: %v", err)
+	}
+	l.Record(Entry{Principal: "alice", RemoteAddr: "10.0.0.1:1234", Op: "SET", Key: "k1", Success: true})
+	l.Record(Entry{Principal: "bob", Op: "TX_COMMIT", Keys: []string{"a", "b"}, Success: true})
+	l.Close()
+
+	// Reopening must append rather than truncate.
+	l, _ = Open(path)
+	l.Record(Entry{Principal: "carol", Op: "DELETE", Key: "k1", Success: false, Error: "not leader"})
+	l.Close()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to read audit log: %v", err)
+	}
+	defer file.Close()
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("audit entry is not valid JSON: %v", err)
+		}
+		entries = append(entries, e)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	if entries[0].Principal != "alice" || entries[0].Time.IsZero() {
+		t.Errorf("first entry was not recorded correctly: %+v", entries[0])
+	}
+	if len(entries[1].Keys) != 2 {
+		t.Errorf("expected transaction keys to be recorded, got %+v", entries[1])
+	}
+	if entries[2].Success || entries[2].Error == "" {
+		t.Errorf("expected failed operation to be recorded with its error, got %+v", entries[2])
+	}
+}
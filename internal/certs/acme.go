@@ -0,0 +1,54 @@
+package certs
+
+import (
+	"crypto/tls"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// NewACME returns a manager that gets certificates for domains from the ACME
+// CA at directoryURL, or Let's Encrypt if it is empty, when a client first
+// asks for one, renews them before they expire, and keeps them, with the
+// account key, in cacheDir so that restarts do not ask the CA again. email,
+// if set, is the contact the CA warns about expiring certificates.
+//
+// The CA checks that this node controls a domain by connecting to it on
+// port 443, which ACMEServerConfig answers, or on port 80, which the
+// manager's HTTPHandler answers.
+func NewACME(domains []string, email, cacheDir, directoryURL string) (*autocert.Manager, error) {
+	var hosts []string
+	for _, d := range domains {
+		if d = strings.TrimSpace(d); d != "" {
+			hosts = append(hosts, d)
+		}
+	}
+	if len(hosts) == 0 {
+		return nil, errors.New("no ACME domains")
+	}
+	if cacheDir == "" {
+		return nil, errors.New("no ACME cache directory")
+	}
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(hosts...),
+		Cache:      autocert.DirCache(cacheDir),
+		Email:      email,
+	}
+	if directoryURL != "" {
+		m.Client = &acme.Client{DirectoryURL: directoryURL}
+	}
+	return m, nil
+}
+
+// ACMEServerConfig returns the configuration for a TLS server whose
+// certificates m provides, offering protos to clients over ALPN.
+func ACMEServerConfig(m *autocert.Manager, protos ...string) *tls.Config {
+	cfg := m.TLSConfig()
+	cfg.MinVersion = tls.VersionTLS12
+	// The CA's TLS-ALPN-01 challenge negotiates its own protocol.
+	cfg.NextProtos = append(append([]string{}, protos...), acme.ALPNProto)
+	return cfg
+}
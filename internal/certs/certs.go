@@ -0,0 +1,192 @@
+// Package certs serves TLS certificates from files and reloads them when the
+// files change, so that certificates can rotate without a restart.
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader holds a certificate and key loaded from files, and optionally a
+// bundle of CA certificates that peers' certificates must chain to. Every
+// tls.Config it returns reads the newest of them at each handshake, so
+// connections made after a reload use the new files while existing ones
+// carry on.
+type Reloader struct {
+	certFile, keyFile, caFile string
+
+	mu    sync.RWMutex
+	cert  *tls.Certificate
+	pool  *x509.CertPool // nil without a CA file
+	stamp string         // Sizes and modification times of the files last loaded
+}
+
+// New loads the certificate in certFile and the key in keyFile, and the CA
+// bundle in caFile if it is not empty.
+func New(certFile, keyFile, caFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile, caFile: caFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the files again. If any of them cannot be used, e.g. because
+// a new certificate was written but not yet its key, the files loaded
+// before stay in use.
+func (r *Reloader) Reload() error {
+	stamp, err := r.fileStamp()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates in %s", r.caFile)
+		}
+	}
+	r.mu.Lock()
+	r.cert, r.pool, r.stamp = &cert, pool, stamp
+	r.mu.Unlock()
+	return nil
+}
+
+// fileStamp returns a string that changes whenever one of the files does.
+func (r *Reloader) fileStamp() (string, error) {
+	var stamp string
+	for _, path := range []string{r.certFile, r.keyFile, r.caFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		stamp += fmt.Sprintf("%d/%d;", info.Size(), info.ModTime().UnixNano())
+	}
+	return stamp, nil
+}
+
+// Watch reloads the files whenever they change, checking every interval,
+// until stop is closed.
+func (r *Reloader) Watch(every time.Duration, stop <-chan struct{}) {
+	if every <= 0 {
+		return
+	}
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		stamp, err := r.fileStamp()
+		r.mu.RLock()
+		unchanged := stamp == r.stamp
+		r.mu.RUnlock()
+		if err == nil && unchanged {
+			continue
+		}
+		if err := r.Reload(); err != nil {
+			log.Printf("TLS: Keeping the current certificate from %s: %v", r.certFile, err)
+			continue
+		}
+		log.Printf("TLS: Reloaded the certificate from %s", r.certFile)
+	}
+}
+
+// Certificate returns the certificate in use.
+func (r *Reloader) Certificate() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+// certPool returns the CA bundle in use, or nil if there is none.
+func (r *Reloader) certPool() *x509.CertPool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.pool
+}
+
+// ServerConfig returns the configuration for a TLS server. With a CA bundle,
+// clients must present a certificate that chains to it. Callers may change
+// the returned config, e.g. to set NextProtos, before serving with it.
+func (r *Reloader) ServerConfig() *tls.Config {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.Certificate(), nil
+		},
+	}
+	if r.caFile != "" {
+		cfg.ClientCAs = r.certPool()
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		// The CA bundle can only change per handshake through a whole config,
+		// so hand out a copy of cfg, as the caller left it, with the newest.
+		cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			c := cfg.Clone()
+			c.ClientCAs = r.certPool()
+			return c, nil
+		}
+	}
+	return cfg
+}
+
+// ClientConfig returns the configuration for a TLS client connecting to
+// serverName, which presents the certificate in use if the server asks for
+// one. It needs a CA bundle to verify the server with, and verifies it
+// against the bundle in use at each handshake.
+func (r *Reloader) ClientConfig(serverName string) (*tls.Config, error) {
+	if r.certPool() == nil {
+		return nil, errors.New("no CA bundle to verify servers with")
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+		// RootCAs would be fixed for the life of the config; the server's
+		// certificate is verified in VerifyConnection instead.
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			return r.verifyServer(cs, serverName)
+		},
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return r.Certificate(), nil
+		},
+	}, nil
+}
+
+// verifyServer checks, as crypto/tls would with RootCAs, that the server in
+// cs presented a certificate for serverName that chains to the CA bundle in
+// use.
+func (r *Reloader) verifyServer(cs tls.ConnectionState, serverName string) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("server presented no certificate")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         r.certPool(),
+		DNSName:       serverName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
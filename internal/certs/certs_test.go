@@ -0,0 +1,214 @@
+// Package certs_test contains the unit tests for the certs package.
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// issue writes a certificate for 127.0.0.1 with the given serial, signed by
+// ca (self-signed if ca is nil), and its key, to certFile and keyFile.
+func issue(t *testing.T, serial int64, ca *tls.Certificate, certFile, keyFile string) *tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "heliosdb"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:                  ca == nil,
+		BasicConstraintsValid: true,
+	}
+	parent, signer := tmpl, any(key)
+	if ca != nil {
+		parent, signer = ca.Leaf, ca.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	leaf, _ := x509.ParseCertificate(der)
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// serial returns the serial number of the certificate r serves.
+func serial(r *Reloader) int64 {
+	leaf, _ := x509.ParseCertificate(r.Certificate().Certificate[0])
+	return leaf.SerialNumber.Int64()
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	caFile, caKey := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca.key")
+	certFile, keyFile := filepath.Join(dir, "node.pem"), filepath.Join(dir, "node.key")
+	ca := issue(t, 1, nil, caFile, caKey)
+	issue(t, 2, ca, certFile, keyFile)
+
+	r, err := New(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+
+	// --- Test Case 1: Both sides of a mutual TLS handshake use the files ---
+	handshake := func() error {
+		client, server := net.Pipe()
+		defer client.Close()
+		defer server.Close()
+		cfg, err := r.ClientConfig("127.0.0.1")
+		if err != nil {
+			return err
+		}
+		errs := make(chan error, 1)
+		go func() { errs <- tls.Server(server, r.ServerConfig()).Handshake() }()
+		if err := tls.Client(client, cfg).Handshake(); err != nil {
+			return err
+		}
+		return <-errs
+	}
+	if err := handshake(); err != nil {
+		t.Fatalf("expected the handshake to succeed, but got %v", err)
+	}
+
+	// --- Test Case 2: Changed files are picked up by Watch ---
+	issue(t, 3, ca, certFile, keyFile)
+	stop := make(chan struct{})
+	go r.Watch(10*time.Millisecond, stop)
+	deadline := time.Now().Add(5 * time.Second)
+	for serial(r) != 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(stop)
+	if got := serial(r); got != 3 {
+		t.Fatalf("expected the new certificate, but got serial %d", got)
+	}
+	if err := handshake(); err != nil {
+		t.Errorf("expected the handshake to succeed after the reload, but got %v", err)
+	}
+
+	// --- Test Case 3: A half-written pair keeps the current certificate ---
+	os.WriteFile(keyFile, []byte("not a key"), 0600)
+	if err := r.Reload(); err == nil {
+		t.Error("expected the reload to fail, but it succeeded")
+	}
+	if got := serial(r); got != 3 {
+		t.Errorf("expected serial 3 to stay in use, but got %d", got)
+	}
+
+	// --- Test Case 4: Clients need a CA bundle ---
+	plain, err := New(caFile, caKey, "")
+	if err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+	if _, err := plain.ClientConfig("127.0.0.1"); err == nil {
+		t.Error("expected a client config without a CA bundle to fail, but it succeeded")
+	}
+	if cfg := plain.ServerConfig(); cfg.GetConfigForClient != nil {
+		t.Error("expected a server without a CA bundle not to ask for client certificates")
+	}
+
+	// --- Test Case 5: Servers asking for client certificates keep ALPN ---
+	// Over TCP rather than a pipe, so that a failing side can send its alert
+	// while the other is still writing.
+	handshakeWith := func(clientCfg, serverCfg *tls.Config) (tls.ConnectionState, error) {
+		ln, err := tls.Listen("tcp", "127.0.0.1:0", serverCfg)
+		if err != nil {
+			return tls.ConnectionState{}, err
+		}
+		defer ln.Close()
+		errs := make(chan error, 1)
+		go func() {
+			conn, err := ln.Accept()
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer conn.Close()
+			errs <- conn.(*tls.Conn).Handshake()
+		}()
+		conn, err := tls.Dial("tcp", ln.Addr().String(), clientCfg)
+		if err != nil {
+			return tls.ConnectionState{}, err
+		}
+		defer conn.Close()
+		return conn.ConnectionState(), <-errs
+	}
+	issue(t, 4, ca, certFile, keyFile)
+	if err := r.Reload(); err != nil {
+		t.Fatalf("failed to reload: %v", err)
+	}
+	clientCfg, err := r.ClientConfig("127.0.0.1")
+	if err != nil {
+		t.Fatalf("failed to get a client config: %v", err)
+	}
+	serverCfg := r.ServerConfig()
+	serverCfg.NextProtos = []string{"h2", "http/1.1"}
+	clientCfg.NextProtos = []string{"h2"}
+	if cs, err := handshakeWith(clientCfg, serverCfg); err != nil || cs.NegotiatedProtocol != "h2" {
+		t.Errorf("expected h2 to be negotiated, but got %q (err %v)", cs.NegotiatedProtocol, err)
+	}
+
+	// --- Test Case 6: Clients made before a CA rotation trust the new CA ---
+	newCA := issue(t, 5, nil, caFile, caKey)
+	issue(t, 6, newCA, certFile, keyFile)
+	if err := r.Reload(); err != nil {
+		t.Fatalf("failed to reload: %v", err)
+	}
+	if _, err := handshakeWith(clientCfg, r.ServerConfig()); err != nil {
+		t.Errorf("expected the handshake to succeed after the CA rotation, but got %v", err)
+	}
+
+	// --- Test Case 7: Servers not signed by the CA are refused ---
+	issue(t, 7, nil, certFile, keyFile)
+	rogue, err := New(certFile, keyFile, "")
+	if err != nil {
+		t.Fatalf("failed to load: %v", err)
+	}
+	if _, err := handshakeWith(clientCfg, rogue.ServerConfig()); err == nil {
+		t.Error("expected a server outside the CA to be refused, but the handshake succeeded")
+	}
+}
+
+func TestNewACME(t *testing.T) {
+	// --- Test Case 1: Domains are required ---
+	if _, err := NewACME([]string{" "}, "", t.TempDir(), ""); err == nil {
+		t.Error("expected no domains to fail, but it succeeded")
+	}
+
+	// --- Test Case 2: Only the listed domains get certificates ---
+	m, err := NewACME([]string{"db.example.com"}, "ops@example.com", t.TempDir(), "https://acme.invalid/directory")
+	if err != nil {
+		t.Fatalf("failed to create the manager: %v", err)
+	}
+	cfg := ACMEServerConfig(m, "h2", "http/1.1")
+	if _, err := cfg.GetCertificate(&tls.ClientHelloInfo{ServerName: "other.example.com"}); err == nil {
+		t.Error("expected an unlisted domain to be refused, but it was not")
+	}
+
+	// --- Test Case 3: The TLS-ALPN-01 challenge protocol is offered ---
+	if got := cfg.NextProtos; len(got) != 3 || got[0] != "h2" || got[2] != "acme-tls/1" {
+		t.Errorf("expected [h2 http/1.1 acme-tls/1], but got %v", got)
+	}
+}
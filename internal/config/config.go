@@ -1,7 +1,14 @@
 // Package config handles loading and parsing the application's configuration.
 package config
 
-import "github.com/BurntSushi/toml"
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"time"
+)
 
 // Config holds all configuration for the application.
 // We use struct tags to explicitly map TOML keys to struct fields.
@@ -12,6 +19,155 @@ type Config struct {
 	RaftPort int      `toml:"raft_port"`  // Port for Raft's internal communication
 	DataDir  string   `toml:"data_dir"`   // Directory to store Raft's data
 	Peers    []string `toml:"peers"`      // List of other node IDs in the cluster
+
+	// Raft's log, the WAL and snapshots can each live on their own volume,
+	// e.g. the fsync-heavy logs on a fast disk and snapshots on a large one.
+	RaftLogDir  string `toml:"raft_log_dir"` // Directory for raft.db; defaults to data_dir
+	WALDir      string `toml:"wal_dir"`      // Directory for app.wal; defaults to data_dir
+	SnapshotDir string `toml:"snapshot_dir"` // Directory whose snapshots subdirectory holds Raft snapshots; defaults to data_dir
+
+	ClusterID string `toml:"cluster_id"` // ID of the cluster this node belongs to; a new one is generated at bootstrap if empty
+	RaftClusterPreamble bool `toml:"raft_cluster_preamble"` // Send the cluster ID on Raft connections; set once every node accepts it
+	JoinToken string `toml:"join_token" secret:"true"` // Shared secret required to join or decommission nodes; membership changes are open if empty
+	AdminAllowedCIDRs []string `toml:"admin_allowed_cidrs"` // Addresses allowed to reach /join, /admin/* and /cluster/*, on top of any token; all if empty
+
+	WALReplayWorkers           int    `toml:"wal_replay_workers"`                // Goroutines used to replay the WAL at startup; 0 uses one per CPU
+	WALPipelineDepth           int    `toml:"wal_pipeline_depth"`                // WAL records that may await fsync in the background; 0 writes synchronously
+	WALSegmentBytes            int64  `toml:"wal_segment_bytes"`                 // WAL space is allocated, and recycled after compaction, this many bytes at a time; 0 grows the file with every write
+	ColdValueBytes             int    `toml:"cold_value_bytes"`                  // Values at least this large are served from memory-mapped files in data_dir/cold; 0 keeps all values on the heap
+	EncryptionKeyFile          string `toml:"encryption_key_file" secret:"true"` // Keyring of hex AES keys; enables encryption at rest when set
+	EncryptionMigratePlaintext bool   `toml:"encryption_migrate_plaintext"`      // Read plaintext WAL records written before encryption was enabled; set once, until the WAL is compacted
+	AuditLogFile               string `toml:"audit_log_file"`                    // Append-only audit trail of mutating operations; disabled when empty
+
+	SlowRequestThreshold time.Duration `toml:"slow_request_threshold"` // e.g. "250ms"; requests slower than this are logged, 0 disables
+	APIExplorer          bool          `toml:"api_explorer"`           // Serve a Swagger UI page at /docs
+	Failpoints           bool          `toml:"failpoints"`             // Allow fault injection through /admin/failpoints; for chaos tests only
+	ReadOnly             bool          `toml:"read_only"`              // Refuse writes, transactions, scripts and admin changes on this node
+
+	// HTTP server limits, to survive slow or misbehaving clients.
+	HTTPReadHeaderTimeout time.Duration `toml:"http_read_header_timeout"` // Time allowed to send request headers
+	HTTPReadTimeout       time.Duration `toml:"http_read_timeout"`        // Time allowed to send the whole request
+	HTTPWriteTimeout      time.Duration `toml:"http_write_timeout"`       // Time allowed to write the response
+	HTTPIdleTimeout       time.Duration `toml:"http_idle_timeout"`        // How long keep-alive connections may sit idle
+	HTTPMaxHeaderBytes    int           `toml:"http_max_header_bytes"`
+	HTTPMaxBodyBytes      int64         `toml:"http_max_body_bytes"`      // Largest request body accepted, except bulk loads and imports; 0 is unlimited
+	HTTPKeepAlives        bool          `toml:"http_keep_alives"`
+	HTTP2                 bool          `toml:"http2"`                    // Also accept cleartext HTTP/2 (h2c)
+
+	UnixSocket string `toml:"unix_socket"` // Optional unix socket path to serve the HTTP API on, alongside TCP; see GRPCUnixSocket for gRPC
+
+	// TLS is off unless given a certificate and key. The files are reloaded
+	// when they change, or on SIGHUP, so certificates rotate without restarts.
+	TLSCertFile       string        `toml:"tls_cert_file"`       // Certificate the HTTP API is served over HTTPS with
+	TLSKeyFile        string        `toml:"tls_key_file"`
+	RaftTLSCertFile   string        `toml:"raft_tls_cert_file"`  // Certificate for mutual TLS between nodes, as server and as client
+	RaftTLSKeyFile    string        `toml:"raft_tls_key_file"`
+	RaftTLSCAFile     string        `toml:"raft_tls_ca_file"`    // CAs that other nodes' certificates must chain to
+	TLSReloadInterval time.Duration `toml:"tls_reload_interval"` // How often to check the files for changes; 0 reloads only on SIGHUP
+
+	// Instead of tls_cert_file, the HTTP API can get certificates for its
+	// public domains from an ACME CA such as Let's Encrypt, and renew them.
+	ACMEDomains      []string `toml:"acme_domains"`       // Domains to serve; enables ACME when set
+	ACMEEmail        string   `toml:"acme_email"`         // Contact the CA warns about expiring certificates
+	ACMECacheDir     string   `toml:"acme_cache_dir"`     // Defaults to data_dir/acme
+	ACMEDirectoryURL string   `toml:"acme_directory_url"` // Defaults to Let's Encrypt; set to a staging CA to test
+	ACMEHTTPAddr     string   `toml:"acme_http_addr"`     // Optional address, e.g. ":80", to answer HTTP-01 challenges on and redirect to HTTPS
+
+	// The gRPC API (api/proto) and its grpc-gateway JSON bridge are off unless given a port.
+	GRPCPort        int    `toml:"grpc_port"`
+	GRPCGatewayPort int    `toml:"grpc_gateway_port"`
+	GRPCUnixSocket  string `toml:"grpc_unix_socket"` // Optional unix socket path to serve the gRPC API on, with or without grpc_port
+
+	// Bind addresses are what this node listens on; advertise addresses are
+	// what other nodes and clients should dial (they differ behind NAT or in
+	// containers). All default to host:port / host:raft_port.
+	HTTPBindAddrs     []string `toml:"http_bind_addrs"`     // One or more host:port pairs to serve HTTP on
+	HTTPAdvertiseAddr string   `toml:"http_advertise_addr"` // Externally reachable HTTP address, which followers name while this node leads
+	RaftBindAddr      string   `toml:"raft_bind_addr"`
+	RaftAdvertiseAddr string   `toml:"raft_advertise_addr"` // Externally reachable Raft address, stored in the cluster configuration
+	AdminAddr         string   `toml:"admin_addr"`          // Optional host:port to serve /join, /admin/*, /metrics and /debug/pprof on, instead of the data-plane addresses
+
+	LogLevel          string        `toml:"log_level"`          // debug, info, warn or error
+	SnapshotInterval  time.Duration `toml:"snapshot_interval"`  // How often Raft checks whether to snapshot
+	SnapshotThreshold uint64        `toml:"snapshot_threshold"` // Log entries since the last snapshot before taking another
+	SnapshotRetain    int           `toml:"snapshot_retain"`    // Snapshots to keep
+	SnapshotCompression string      `toml:"snapshot_compression"` // none or zstd; applies to snapshots written from then on
+	SnapshotEncryption  bool        `toml:"snapshot_encryption"`  // Seal snapshots and archives with the encryption_key_file keyring, which every node must share
+	ReadLease         time.Duration `toml:"read_lease"`         // How long a leadership check covers ?consistency=lease reads; keep below the election timeout
+
+	// Archives are copies of the store that every node writes at the same
+	// log position on a schedule, and keeps apart from Raft's snapshots.
+	SnapshotArchiveInterval time.Duration `toml:"snapshot_archive_interval"` // e.g. 6h, aligned to the clock; 0 disables archives
+	SnapshotArchiveDir      string        `toml:"snapshot_archive_dir"`      // Defaults to data_dir/archives
+	SnapshotArchiveRetain   int           `toml:"snapshot_archive_retain"`   // Archives to keep, besides older ones they build on; 0 keeps all
+	SnapshotArchiveFullEvery int          `toml:"snapshot_archive_full_every"` // Every nth archive is full and the rest record only changes; 0 or 1 makes all full
+
+	TombstoneRetention time.Duration `toml:"tombstone_retention"` // How long deleted keys are remembered before their tombstones are purged; 0 keeps them forever
+	KeyHistoryVersions int           `toml:"key_history_versions"` // Versions of each key kept in memory for GET /kv/{key}?history=true; 0 disables it
+	WatchHistorySize   int           `toml:"watch_history_size"`    // Recent changes kept in memory for resuming watches and GET /changes
+	WatchHistoryMaxAge time.Duration `toml:"watch_history_max_age"` // How long a change is kept for; 0 keeps it until watch_history_size is reached
+
+	Webhooks []Webhook `toml:"webhooks" secret:"true"` // URLs the leader POSTs committed changes to; redacted because URLs and secrets carry credentials
+
+	Tenants []Tenant `toml:"tenants" secret:"true"` // Teams sharing the cluster; when set, data-plane requests need a tenant's API key
+	APIKeyMetering          bool    `toml:"api_key_metering"`            // Count requests and bytes of each API key, for /metrics and /admin/api-keys
+	APIKeyRequestsPerSecond float64 `toml:"api_key_requests_per_second"` // Cap for each API key, on top of its tenant's; enables metering; 0 is unlimited
+
+	// Snapshots are kept in snapshot_dir unless snapshot_backend is "s3".
+	SnapshotBackend    string `toml:"snapshot_backend"`     // file or s3
+	SnapshotS3Bucket   string `toml:"snapshot_s3_bucket"`
+	SnapshotS3Prefix   string `toml:"snapshot_s3_prefix"`   // e.g. "heliosdb/node1/"
+	SnapshotS3Region   string `toml:"snapshot_s3_region"`
+	SnapshotS3Endpoint string `toml:"snapshot_s3_endpoint"` // For S3-compatible services such as MinIO
+
+	RangeDeleteMaxKeys int `toml:"range_delete_max_keys"` // Most keys one DELETE /v1/kv?prefix= may remove; 0 means no limit
+
+	// Another store behind this one (see package upstream): a slower system of
+	// record the cluster caches, or a legacy store it is taking traffic over
+	// from. Nothing is sent to it unless read- or write-through is enabled.
+	UpstreamURL           string        `toml:"upstream_url" secret:"true"`           // An HTTP callback (http or https), a HeliosDB cluster (helios://) or Redis (redis://); redacted because URLs carry credentials
+	UpstreamAuthorization string        `toml:"upstream_authorization" secret:"true"` // Sent as the Authorization header of every call to an HTTP callback
+	UpstreamReadThrough   bool          `toml:"upstream_read_through"`                // Load keys missing from the store from upstream
+	UpstreamBackfill      bool          `toml:"upstream_backfill"`                    // Keep keys read through; when false, misses are proxied every time
+	UpstreamWriteThrough  bool          `toml:"upstream_write_through"`               // Send SETs and DELETEs of single keys upstream once they commit
+	UpstreamTimeout       time.Duration `toml:"upstream_timeout"`                     // Per call; 0 uses 5s
+
+	TxIsolation      string        `toml:"tx_isolation"`        // Default transaction isolation: last_write_wins, occ or serializable
+	TxMaxActive      int           `toml:"tx_max_active"`       // Transactions in flight on the node; 0 means no limit
+	TxMaxWriteSet    int           `toml:"tx_max_write_set"`    // Writes and deletes one transaction may stage; 0 means no limit
+	TxMaxStagedBytes int64         `toml:"tx_max_staged_bytes"` // Bytes of keys and values staged across all transactions; 0 means no limit
+	TxIdleTimeout    time.Duration `toml:"tx_idle_timeout"`     // Transactions unused for this long are aborted once a limit is reached; 0 keeps them
+	TxIdempotencyTTL time.Duration `toml:"tx_idempotency_ttl"`  // How long /tx/execute remembers commits by Idempotency-Key; 0 ignores the header
+
+	sources map[string]Source // Where each non-default value came from
+}
+
+// Webhook sends the committed changes to keys starting with Prefix to URL,
+// signed with Secret if it is set. See package webhook.
+type Webhook struct {
+	Prefix string `toml:"prefix"`
+	URL    string `toml:"url"`
+	Secret string `toml:"secret"`
+}
+
+// Tenant is a team sharing the cluster in multi-tenant mode. Its callers
+// present one of APIKeys and may only touch keys under Namespace.
+type Tenant struct {
+	Name              string   `toml:"name"`
+	Namespace         string   `toml:"namespace"` // Key prefix; defaults to name + "/"
+	APIKeys           []string `toml:"api_keys"`
+	RequestsPerSecond float64  `toml:"requests_per_second"` // 0 is unlimited
+}
+
+// Reloadable lists the config keys that take effect on SIGHUP without a
+// restart. Changes to any other key are reported but ignored until restart,
+// except for the request rates of tenants, which SIGHUP also reloads.
+var Reloadable = map[string]bool{
+	"log_level":                   true,
+	"slow_request_threshold":      true,
+	"snapshot_interval":           true,
+	"snapshot_threshold":          true,
+	"api_key_requests_per_second": true,
 }
 
 // New returns a new Config with default values.
@@ -23,11 +179,162 @@ func New() *Config {
         RaftPort: 9080,
         DataDir:  ".",
         Peers:    []string{},
+
+        WALPipelineDepth: 1024,
+        WALSegmentBytes:  64 << 20,
+
+        SlowRequestThreshold: 500 * time.Millisecond,
+
+        HTTPReadHeaderTimeout: 5 * time.Second,
+        HTTPReadTimeout:       30 * time.Second,
+        HTTPWriteTimeout:      30 * time.Second,
+        HTTPIdleTimeout:       120 * time.Second,
+        HTTPMaxHeaderBytes:    64 << 10,
+        HTTPMaxBodyBytes:      32 << 20,
+        RangeDeleteMaxKeys:    10000,
+        UpstreamBackfill:      true,
+        HTTPKeepAlives:        true,
+        HTTP2:                 true,
+
+        TLSReloadInterval: time.Minute,
+
+        LogLevel:          "info",
+        SnapshotInterval:  120 * time.Second,
+        SnapshotThreshold: 8192,
+        SnapshotRetain:    2,
+        SnapshotCompression: "none",
+        ReadLease:         500 * time.Millisecond,
+        SnapshotArchiveRetain: 7,
+        SnapshotBackend:   "file",
+
+        TombstoneRetention: 24 * time.Hour,
+        WatchHistorySize:   10000,
+        WatchHistoryMaxAge: time.Hour,
+
+        TxIsolation:      "last_write_wins",
+        TxMaxActive:      10000,
+        TxMaxWriteSet:    10000,
+        TxMaxStagedBytes: 256 << 20,
+        TxIdleTimeout:    5 * time.Minute,
+        TxIdempotencyTTL: 24 * time.Hour,
     }
 }
 
 // Load reads a configuration file from the given path and populates the Config struct.
+// The format (TOML, YAML or JSON) is detected from the file extension.
 func (c *Config) Load(path string) error {
-	_, err := toml.DecodeFile(path, c)
+	keys, err := decodeFile(path, c)
+	for _, key := range keys {
+		c.setSource(key, SourceFile)
+	}
 	return err
-}
\ No newline at end of file
+}
+
+// HTTPListenAddrs returns the addresses the HTTP API should listen on.
+func (c *Config) HTTPListenAddrs() []string {
+	if len(c.HTTPBindAddrs) > 0 {
+		return c.HTTPBindAddrs
+	}
+	return []string{fmt.Sprintf("%s:%d", c.Host, c.Port)}
+}
+
+// HTTPAdvertise returns the HTTP address clients should use to reach this node.
+func (c *Config) HTTPAdvertise() string {
+	if c.HTTPAdvertiseAddr != "" {
+		return c.HTTPAdvertiseAddr
+	}
+	return c.HTTPListenAddrs()[0]
+}
+
+// RaftListenAddr returns the address the Raft transport should listen on.
+func (c *Config) RaftListenAddr() string {
+	if c.RaftBindAddr != "" {
+		return c.RaftBindAddr
+	}
+	return fmt.Sprintf("%s:%d", c.Host, c.RaftPort)
+}
+
+// RaftLogPath returns the path of Raft's log, raft.db.
+func (c *Config) RaftLogPath() string {
+	return filepath.Join(c.orDataDir(c.RaftLogDir), "raft.db")
+}
+
+// WALPath returns the path of the write-ahead log, app.wal.
+func (c *Config) WALPath() string {
+	return filepath.Join(c.orDataDir(c.WALDir), "app.wal")
+}
+
+// SnapshotPath returns the directory Raft's file snapshot store is opened
+// in. The snapshots themselves are kept in its snapshots subdirectory.
+func (c *Config) SnapshotPath() string {
+	return c.orDataDir(c.SnapshotDir)
+}
+
+// StorageDirs returns the directories a node keeps its files in: data_dir,
+// followed by any of raft_log_dir, wal_dir and snapshot_dir set apart from
+// it, without repeats.
+func (c *Config) StorageDirs() []string {
+	dirs := []string{c.DataDir}
+	for _, dir := range []string{filepath.Dir(c.RaftLogPath()), filepath.Dir(c.WALPath()), c.SnapshotPath()} {
+		if !slices.ContainsFunc(dirs, func(d string) bool { return filepath.Clean(d) == filepath.Clean(dir) }) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// orDataDir returns dir, or data_dir if dir is empty.
+func (c *Config) orDataDir(dir string) string {
+	if dir != "" {
+		return dir
+	}
+	return c.DataDir
+}
+
+// SnapshotArchivePath returns the directory snapshot archives are kept in.
+func (c *Config) SnapshotArchivePath() string {
+	if c.SnapshotArchiveDir != "" {
+		return c.SnapshotArchiveDir
+	}
+	return filepath.Join(c.DataDir, "archives")
+}
+
+// ACMECachePath returns the directory ACME certificates and the account key
+// are kept in.
+func (c *Config) ACMECachePath() string {
+	if c.ACMECacheDir != "" {
+		return c.ACMECacheDir
+	}
+	return filepath.Join(c.DataDir, "acme")
+}
+
+// ReplayWorkers returns the number of goroutines to replay the WAL on.
+func (c *Config) ReplayWorkers() int {
+	if c.WALReplayWorkers > 0 {
+		return c.WALReplayWorkers
+	}
+	return runtime.NumCPU()
+}
+
+// RaftAdvertise returns the Raft address peers should use to reach this node.
+func (c *Config) RaftAdvertise() string {
+	if c.RaftAdvertiseAddr != "" {
+		return c.RaftAdvertiseAddr
+	}
+	return c.RaftListenAddr()
+}
+
+// Changes returns the TOML keys whose values differ between old and updated.
+func Changes(old, updated *Config) []string {
+	var changed []string
+	ov, nv := reflect.ValueOf(old).Elem(), reflect.ValueOf(updated).Elem()
+	for i := 0; i < ov.NumField(); i++ {
+		if ov.Type().Field(i).Tag.Get("toml") == "" {
+			continue
+		}
+		if !reflect.DeepEqual(ov.Field(i).Interface(), nv.Field(i).Interface()) {
+			changed = append(changed, ov.Type().Field(i).Tag.Get("toml"))
+		}
+	}
+	return changed
+}
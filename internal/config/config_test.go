@@ -4,7 +4,9 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
+	"time"
 )
 
 func TestConfig_Load(t *testing.T) {
@@ -15,6 +17,7 @@ func TestConfig_Load(t *testing.T) {
 	validToml := `
 host = "127.0.0.1"
 port = 9000
+slow_request_threshold = "250ms"
 peers = ["http://localhost:9001", "http://localhost:9002"]
 `
 	validPath := filepath.Join(tempDir, "valid.toml")
@@ -34,6 +37,9 @@ peers = ["http://localhost:9001", "http://localhost:9002"]
 	if cfg.Port != 9000 {
 		t.Errorf("expected port to be 9000, but got %d", cfg.Port)
 	}
+	if cfg.SlowRequestThreshold != 250*time.Millisecond {
+		t.Errorf("expected slow_request_threshold to be 250ms, but got %s", cfg.SlowRequestThreshold)
+	}
 	if len(cfg.Peers) != 2 || cfg.Peers[0] != "http://localhost:9001" {
 		t.Errorf("peers were not parsed correctly")
 	}
@@ -57,4 +63,236 @@ peers = ["http://localhost:9001", "http://localhost:9002"]
 	if err == nil {
 		t.Fatal("expected an error for invalid TOML, but got none")
 	}
-}
\ No newline at end of file
+}
+
+func TestConfig_Addresses(t *testing.T) {
+	// --- Test Case 1: Defaults derive from host and ports ---
+	cfg := New()
+	cfg.Host, cfg.Port, cfg.RaftPort = "10.0.0.5", 8081, 9081
+	if addrs := cfg.HTTPListenAddrs(); len(addrs) != 1 || addrs[0] != "10.0.0.5:8081" {
+		t.Errorf("unexpected default HTTP listen addrs: %v", addrs)
+	}
+	if cfg.HTTPAdvertise() != "10.0.0.5:8081" {
+		t.Errorf("unexpected default HTTP advertise addr: %s", cfg.HTTPAdvertise())
+	}
+	if cfg.RaftListenAddr() != "10.0.0.5:9081" || cfg.RaftAdvertise() != "10.0.0.5:9081" {
+		t.Errorf("unexpected default Raft addrs: %s / %s", cfg.RaftListenAddr(), cfg.RaftAdvertise())
+	}
+
+	// --- Test Case 2: Explicit bind and advertise addresses ---
+	cfg.HTTPBindAddrs = []string{"0.0.0.0:8081", "[::1]:8081"}
+	cfg.HTTPAdvertiseAddr = "db.example.com:443"
+	cfg.RaftBindAddr = "0.0.0.0:9081"
+	cfg.RaftAdvertiseAddr = "203.0.113.7:9081"
+	if addrs := cfg.HTTPListenAddrs(); len(addrs) != 2 {
+		t.Errorf("expected 2 HTTP listen addrs, got %v", addrs)
+	}
+	if cfg.HTTPAdvertise() != "db.example.com:443" {
+		t.Errorf("unexpected HTTP advertise addr: %s", cfg.HTTPAdvertise())
+	}
+	if cfg.RaftListenAddr() != "0.0.0.0:9081" || cfg.RaftAdvertise() != "203.0.113.7:9081" {
+		t.Errorf("unexpected Raft addrs: %s / %s", cfg.RaftListenAddr(), cfg.RaftAdvertise())
+	}
+}
+
+func TestChanges(t *testing.T) {
+	old := New()
+	updated := New()
+	updated.LogLevel = "debug"
+	updated.Port = 9999
+	updated.Peers = []string{"localhost:9082"}
+
+	changed := Changes(old, updated)
+	want := map[string]bool{"log_level": true, "port": true, "peers": true}
+	if len(changed) != len(want) {
+		t.Fatalf("expected %d changes, got %v", len(want), changed)
+	}
+	for _, key := range changed {
+		if !want[key] {
+			t.Errorf("unexpected change reported for %s", key)
+		}
+	}
+	if !Reloadable["log_level"] || Reloadable["port"] {
+		t.Error("expected log_level to be reloadable and port to require a restart")
+	}
+}
+
+func TestConfig_ApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"HELIOSDB_NODE_ID":                "node7",
+		"HELIOSDB_PORT":                   "8087",
+		"HELIOSDB_PEERS":                  "localhost:9082, localhost:9083",
+		"HELIOSDB_SLOW_REQUEST_THRESHOLD": "2s",
+		"HELIOSDB_HTTP2":                  "false",
+		"HELIOSDB_SNAPSHOT_THRESHOLD":     "100",
+	}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	cfg := New()
+	if err := cfg.ApplyEnv(lookup); err != nil {
+		t.Fatalf("expected no error applying env, but got: %v", err)
+	}
+	if cfg.NodeID != "node7" || cfg.Port != 8087 {
+		t.Errorf("expected node_id and port from env, got %s and %d", cfg.NodeID, cfg.Port)
+	}
+	if len(cfg.Peers) != 2 || cfg.Peers[1] != "localhost:9083" {
+		t.Errorf("expected peers from env, got %v", cfg.Peers)
+	}
+	if cfg.SlowRequestThreshold != 2*time.Second || cfg.HTTP2 || cfg.SnapshotThreshold != 100 {
+		t.Errorf("expected duration, bool and uint values from env, got %+v", cfg)
+	}
+	if cfg.Host != "localhost" {
+		t.Errorf("expected unset keys to keep their value, got host '%s'", cfg.Host)
+	}
+
+	env["HELIOSDB_PORT"] = "eighty"
+	if err := New().ApplyEnv(lookup); err == nil {
+		t.Error("expected an error for an invalid integer, but got none")
+	}
+}
+
+func TestConfig_Set(t *testing.T) {
+	cfg := New()
+	if err := cfg.Set("raft_port", "9999", SourceFlag); err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if cfg.RaftPort != 9999 {
+		t.Errorf("expected raft_port 9999, got %d", cfg.RaftPort)
+	}
+	if err := cfg.Set("no_such_key", "1", SourceFlag); err == nil {
+		t.Error("expected an error for an unknown key, but got none")
+	}
+}
+
+func TestConfig_LoadFormats(t *testing.T) {
+	tempDir := t.TempDir()
+	files := map[string]string{
+		"config.yaml": `
+node_id: node2
+port: 8082
+slow_request_threshold: 250ms
+http2: false
+peers:
+  - localhost:9081
+  - localhost:9083
+`,
+		"config.json": `{
+  "node_id": "node2",
+  "port": 8082,
+  "slow_request_threshold": "250ms",
+  "http2": false,
+  "peers": ["localhost:9081", "localhost:9083"]
+}`,
+	}
+
+	for name, contents := range files {
+		path := filepath.Join(tempDir, name)
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+		cfg := New()
+		if err := cfg.Load(path); err != nil {
+			t.Fatalf("expected no error loading %s, but got: %v", name, err)
+		}
+		if cfg.NodeID != "node2" || cfg.Port != 8082 || cfg.HTTP2 {
+			t.Errorf("%s: scalar values were not parsed correctly: %+v", name, cfg)
+		}
+		if cfg.SlowRequestThreshold != 250*time.Millisecond {
+			t.Errorf("%s: expected 250ms threshold, got %s", name, cfg.SlowRequestThreshold)
+		}
+		if len(cfg.Peers) != 2 || cfg.Peers[1] != "localhost:9083" {
+			t.Errorf("%s: peers were not parsed correctly: %v", name, cfg.Peers)
+		}
+		if cfg.RaftPort != 9080 {
+			t.Errorf("%s: expected defaults to be kept for unset keys, got raft_port %d", name, cfg.RaftPort)
+		}
+	}
+
+	// Malformed input is reported.
+	badPath := filepath.Join(tempDir, "bad.json")
+	os.WriteFile(badPath, []byte(`{"port": `), 0644)
+	if err := New().Load(badPath); err == nil {
+		t.Error("expected an error for malformed JSON, but got none")
+	}
+}
+
+func TestConfig_Effective(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	os.WriteFile(path, []byte("host = \"10.0.0.1\"\nencryption_key_file = \"/secrets/key\"\n"), 0644)
+
+	cfg := New()
+	if err := cfg.Load(path); err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	cfg.ApplyEnv(func(name string) (string, bool) {
+		if name == "HELIOSDB_PORT" {
+			return "8085", true
+		}
+		return "", false
+	})
+	cfg.Set("node_id", "node5", SourceFlag)
+
+	settings := make(map[string]Setting)
+	for _, s := range cfg.Effective() {
+		settings[s.Key] = s
+	}
+	expect := map[string]Source{
+		"host":      SourceFile,
+		"port":      SourceEnv,
+		"node_id":   SourceFlag,
+		"raft_port": SourceDefault,
+	}
+	for key, src := range expect {
+		if settings[key].Source != src {
+			t.Errorf("expected %s to come from %s, got %s", key, src, settings[key].Source)
+		}
+	}
+	if settings["encryption_key_file"].Value != Redacted {
+		t.Errorf("expected secret to be redacted, got %v", settings["encryption_key_file"].Value)
+	}
+	if settings["slow_request_threshold"].Value != "500ms" {
+		t.Errorf("expected durations to be rendered as strings, got %v", settings["slow_request_threshold"].Value)
+	}
+}
+
+func TestConfig_ReplayWorkers(t *testing.T) {
+	cfg := New()
+
+	// --- Test Case 1: Defaults to one worker per CPU ---
+	if got := cfg.ReplayWorkers(); got != runtime.NumCPU() {
+		t.Errorf("expected %d replay workers, but got %d", runtime.NumCPU(), got)
+	}
+
+	// --- Test Case 2: An explicit count wins ---
+	cfg.WALReplayWorkers = 3
+	if got := cfg.ReplayWorkers(); got != 3 {
+		t.Errorf("expected 3 replay workers, but got %d", got)
+	}
+}
+
+func TestConfig_StoragePaths(t *testing.T) {
+	cfg := New()
+	cfg.DataDir = "/data"
+
+	// --- Test Case 1: Everything defaults to data_dir ---
+	if cfg.RaftLogPath() != filepath.Join("/data", "raft.db") || cfg.WALPath() != filepath.Join("/data", "app.wal") || cfg.SnapshotPath() != "/data" {
+		t.Errorf("expected paths under /data, but got %s, %s and %s", cfg.RaftLogPath(), cfg.WALPath(), cfg.SnapshotPath())
+	}
+	if dirs := cfg.StorageDirs(); len(dirs) != 1 || dirs[0] != "/data" {
+		t.Errorf("expected only /data, but got %v", dirs)
+	}
+
+	// --- Test Case 2: Each can be moved, and shared dirs are listed once ---
+	cfg.RaftLogDir = "/fast"
+	cfg.WALDir = "/fast/"
+	cfg.SnapshotDir = "/bulk"
+	if cfg.RaftLogPath() != filepath.Join("/fast", "raft.db") || cfg.WALPath() != filepath.Join("/fast", "app.wal") || cfg.SnapshotPath() != "/bulk" {
+		t.Errorf("expected the configured dirs, but got %s, %s and %s", cfg.RaftLogPath(), cfg.WALPath(), cfg.SnapshotPath())
+	}
+	if dirs := cfg.StorageDirs(); len(dirs) != 3 || dirs[1] != "/fast" || dirs[2] != "/bulk" {
+		t.Errorf("expected /data, /fast and /bulk, but got %v", dirs)
+	}
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix is prepended to the upper-cased TOML key to form the name of the
+// environment variable that overrides it, e.g. port -> HELIOSDB_PORT.
+const EnvPrefix = "HELIOSDB_"
+
+// EnvVar returns the environment variable that overrides the given TOML key.
+func EnvVar(key string) string {
+	return EnvPrefix + strings.ToUpper(key)
+}
+
+// ApplyEnv overrides config values from environment variables, looked up with
+// lookup (normally os.LookupEnv). List values are comma-separated.
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		key := v.Type().Field(i).Tag.Get("toml")
+		if key == "" {
+			continue
+		}
+		raw, ok := lookup(EnvVar(key))
+		if !ok {
+			continue
+		}
+		if err := setField(v.Field(i), raw); err != nil {
+			return fmt.Errorf("invalid value for %s: %w", EnvVar(key), err)
+		}
+		c.setSource(key, SourceEnv)
+	}
+	return nil
+}
+
+// Set overrides a single config value by its TOML key, parsing raw the same
+// way as an environment variable, and records src as the value's origin.
+func (c *Config) Set(key, raw string, src Source) error {
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).Tag.Get("toml") == key {
+			if err := setField(v.Field(i), raw); err != nil {
+				return err
+			}
+			c.setSource(key, src)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown config key %q", key)
+}
+
+// setField parses raw into a config field according to the field's type.
+func setField(f reflect.Value, raw string) error {
+	if f.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+		return nil
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	case reflect.Slice:
+		if f.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported list type %s", f.Type())
+		}
+		items := []string{}
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		f.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", f.Type())
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// decodeFile parses a config file whose format is chosen by extension:
+// .yaml/.yml and .json are supported alongside TOML (the default). All
+// formats use the same keys as config.toml. It returns the keys that the
+// file set.
+func decodeFile(path string, c *Config) ([]string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return decodeVia(path, c, yaml.Unmarshal)
+	case ".json":
+		return decodeVia(path, c, json.Unmarshal)
+	default:
+		md, err := toml.DecodeFile(path, c)
+		if err != nil {
+			return nil, err
+		}
+		return topLevelKeys(md), nil
+	}
+}
+
+func topLevelKeys(md toml.MetaData) []string {
+	var keys []string
+	for _, key := range md.Keys() {
+		if len(key) == 1 {
+			keys = append(keys, key[0])
+		}
+	}
+	return keys
+}
+
+// decodeVia parses the file into generic values with unmarshal and then
+// feeds them through the TOML decoder, so that every format shares the TOML
+// struct tags and type handling (e.g. "250ms" durations).
+func decodeVia(path string, c *Config, unmarshal func([]byte, interface{}) error) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]interface{}
+	if err := unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(normalize(values)); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	md, err := toml.Decode(buf.String(), c)
+	if err != nil {
+		return nil, err
+	}
+	return topLevelKeys(md), nil
+}
+
+// normalize turns whole-number floats (which is how encoding/json decodes
+// every number) back into integers so they can populate integer fields.
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int64(v)
+		}
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = normalize(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalize(item)
+		}
+	}
+	return v
+}
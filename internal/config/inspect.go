@@ -0,0 +1,93 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// Source records where a config value came from.
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+	SourceRuntime Source = "runtime" // Changed through the admin API
+)
+
+// Redacted replaces the value of settings tagged secret:"true".
+const Redacted = "[REDACTED]"
+
+// Setting is one effective config value and its origin.
+type Setting struct {
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Source Source      `json:"source"`
+}
+
+func (c *Config) setSource(key string, src Source) {
+	if c.sources == nil {
+		c.sources = make(map[string]Source)
+	}
+	c.sources[key] = src
+}
+
+// Source returns where the value of key came from.
+func (c *Config) Source(key string) Source {
+	if src, ok := c.sources[key]; ok {
+		return src
+	}
+	return SourceDefault
+}
+
+// Effective lists every config key with its current value and origin, in
+// declaration order. Secret values are redacted when set.
+func (c *Config) Effective() []Setting {
+	v := reflect.ValueOf(c).Elem()
+	settings := make([]Setting, 0, v.NumField())
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		key := field.Tag.Get("toml")
+		if key == "" {
+			continue
+		}
+		value := v.Field(i).Interface()
+		if d, ok := value.(interface{ String() string }); ok && v.Field(i).Kind() == reflect.Int64 {
+			value = d.String() // Durations read better as "250ms" than nanoseconds
+		}
+		if field.Tag.Get("secret") == "true" && !v.Field(i).IsZero() {
+			value = Redacted
+		}
+		settings = append(settings, Setting{Key: key, Value: value, Source: c.Source(key)})
+	}
+	return settings
+}
+
+// Clone returns a deep copy of the config, safe to modify independently.
+func (c *Config) Clone() *Config {
+	clone := *c
+	clone.Peers = slices.Clone(c.Peers)
+	clone.HTTPBindAddrs = slices.Clone(c.HTTPBindAddrs)
+	clone.Webhooks = slices.Clone(c.Webhooks)
+	clone.Tenants = slices.Clone(c.Tenants)
+	clone.sources = make(map[string]Source, len(c.sources))
+	for k, v := range c.sources {
+		clone.sources[k] = v
+	}
+	return &clone
+}
+
+// CopyFrom sets key to its value in other, along with its source.
+func (c *Config) CopyFrom(other *Config, key string) error {
+	dst, src := reflect.ValueOf(c).Elem(), reflect.ValueOf(other).Elem()
+	for i := 0; i < dst.NumField(); i++ {
+		if dst.Type().Field(i).Tag.Get("toml") == key {
+			dst.Field(i).Set(src.Field(i))
+			c.setSource(key, other.Source(key))
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown config key %q", key)
+}
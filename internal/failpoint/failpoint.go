@@ -0,0 +1,164 @@
+// Package failpoint injects faults at named points in the code, so that
+// resilience tests can exercise failure paths deterministically. Failpoints
+// are off unless enabled, and a disabled failpoint costs one atomic load.
+//
+// A failpoint is enabled with a term such as:
+//
+//	delay(100ms)  sleep before continuing
+//	error         make the operation fail with ErrInjected
+//	pause         block until the failpoint is disabled
+//
+// Delays and errors may be prefixed with a count, e.g. "3*error", after which
+// the failpoint disables itself.
+package failpoint
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Failpoints wired into the server.
+const (
+	RaftApply   = "raft/apply"   // Before the FSM applies a committed entry; error drops it on this node
+	WALFsync    = "wal/fsync"    // Before the WAL syncs to disk; error fails the sync
+	StoreAccess = "store/access" // Before every store read and write; delay and pause only
+)
+
+// ErrInjected is returned by Inject for a failpoint set to "error".
+var ErrInjected = errors.New("failpoint: injected error")
+
+type action struct {
+	term    string // As given to Enable, for List
+	kind    string // delay, error or pause
+	delay   time.Duration
+	remain  int           // Evaluations left before disabling itself; 0 is unlimited
+	release chan struct{} // Closed when a pause is lifted
+}
+
+var (
+	active atomic.Int32 // Number of enabled failpoints, for the fast path
+
+	mu     sync.Mutex
+	points = make(map[string]*action)
+)
+
+// Enable sets the failpoint name to term, replacing any previous setting.
+func Enable(name, term string) error {
+	a, err := parse(term)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	disableLocked(name)
+	points[name] = a
+	active.Add(1)
+	return nil
+}
+
+func parse(term string) (*action, error) {
+	a := &action{term: term}
+	rest := strings.TrimSpace(term)
+	if n, kind, ok := strings.Cut(rest, "*"); ok {
+		count, err := strconv.Atoi(n)
+		if err != nil || count < 1 {
+			return nil, fmt.Errorf("failpoint: invalid count in %q", term)
+		}
+		a.remain, rest = count, kind
+	}
+	switch {
+	case rest == "error":
+		a.kind = "error"
+	case rest == "pause":
+		if a.remain > 0 {
+			return nil, fmt.Errorf("failpoint: pause cannot be counted in %q", term)
+		}
+		a.kind = "pause"
+		a.release = make(chan struct{})
+	case strings.HasPrefix(rest, "delay(") && strings.HasSuffix(rest, ")"):
+		d, err := time.ParseDuration(rest[len("delay(") : len(rest)-1])
+		if err != nil {
+			return nil, fmt.Errorf("failpoint: invalid delay in %q: %v", term, err)
+		}
+		a.kind, a.delay = "delay", d
+	default:
+		return nil, fmt.Errorf("failpoint: unknown term %q (want delay(d), error or pause)", term)
+	}
+	return a, nil
+}
+
+// Disable turns off the failpoint name, releasing anything paused on it.
+func Disable(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	disableLocked(name)
+}
+
+// DisableAll turns off every failpoint.
+func DisableAll() {
+	mu.Lock()
+	defer mu.Unlock()
+	for name := range points {
+		disableLocked(name)
+	}
+}
+
+func disableLocked(name string) {
+	a, ok := points[name]
+	if !ok {
+		return
+	}
+	delete(points, name)
+	active.Add(-1)
+	if a.release != nil {
+		close(a.release)
+	}
+}
+
+// List returns the enabled failpoints and their terms.
+func List() map[string]string {
+	mu.Lock()
+	defer mu.Unlock()
+	out := make(map[string]string, len(points))
+	for name, a := range points {
+		out[name] = a.term
+	}
+	return out
+}
+
+// Inject evaluates the failpoint name: it sleeps for a delay, blocks while
+// paused, and returns ErrInjected for an error. It returns nil at once if
+// the failpoint is not enabled.
+func Inject(name string) error {
+	if active.Load() == 0 {
+		return nil
+	}
+	mu.Lock()
+	a, ok := points[name]
+	if ok && a.remain > 0 {
+		if a.remain--; a.remain == 0 {
+			// The last evaluation still takes effect; later ones do not.
+			delete(points, name)
+			active.Add(-1)
+		}
+	}
+	mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	switch a.kind {
+	case "delay":
+		time.Sleep(a.delay)
+	case "pause":
+		<-a.release
+	case "error":
+		return fmt.Errorf("%w at %s", ErrInjected, name)
+	}
+	return nil
+}
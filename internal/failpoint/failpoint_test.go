@@ -0,0 +1,66 @@
+// Package failpoint_test contains the unit tests for the failpoint package.
+package failpoint
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInject(t *testing.T) {
+	defer DisableAll()
+
+	// --- Test Case 1: A disabled failpoint does nothing ---
+	if err := Inject(RaftApply); err != nil {
+		t.Errorf("expected no error from a disabled failpoint, but got %v", err)
+	}
+
+	// --- Test Case 2: A counted error fires that many times ---
+	if err := Enable(RaftApply, "2*error"); err != nil {
+		t.Fatalf("expected 2*error to be accepted, but got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := Inject(RaftApply); !errors.Is(err, ErrInjected) {
+			t.Errorf("expected ErrInjected on evaluation %d, but got %v", i+1, err)
+		}
+	}
+	if err := Inject(RaftApply); err != nil {
+		t.Errorf("expected the failpoint to disable itself, but got %v", err)
+	}
+	if len(List()) != 0 {
+		t.Errorf("expected no enabled failpoints, but got %v", List())
+	}
+
+	// --- Test Case 3: A delay sleeps ---
+	Enable(WALFsync, "delay(20ms)")
+	start := time.Now()
+	if err := Inject(WALFsync); err != nil || time.Since(start) < 20*time.Millisecond {
+		t.Errorf("expected a 20ms delay and no error, but got %s and %v", time.Since(start), err)
+	}
+
+	// --- Test Case 4: A pause blocks until disabled ---
+	Enable(StoreAccess, "pause")
+	done := make(chan error)
+	go func() { done <- Inject(StoreAccess) }()
+	select {
+	case <-done:
+		t.Fatal("expected Inject to block while paused, but it returned")
+	case <-time.After(20 * time.Millisecond):
+	}
+	Disable(StoreAccess)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected no error after the pause, but got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected Disable to release the pause, but Inject is still blocked")
+	}
+
+	// --- Test Case 5: Invalid terms are rejected ---
+	for _, term := range []string{"crash", "delay(soon)", "0*error", "2*pause"} {
+		if err := Enable(RaftApply, term); err == nil {
+			t.Errorf("expected %q to be rejected, but it was accepted", term)
+		}
+	}
+}
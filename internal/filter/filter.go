@@ -0,0 +1,87 @@
+// Package filter evaluates simple predicates on stored values and selects
+// fields of JSON values, so that selective reads can be answered on the
+// server instead of shipping whole values to the client.
+package filter
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/ASHISH26940/heliosdb/internal/store"
+)
+
+// Predicate reports whether a key and its value should be kept.
+type Predicate func(key string, v store.VersionedValue) bool
+
+// Filter keeps the keys that match all of its predicates. The empty Filter
+// keeps every key.
+type Filter []Predicate
+
+// Match reports whether key and v satisfy every predicate of f.
+func (f Filter) Match(key string, v store.VersionedValue) bool {
+	for _, p := range f {
+		if !p(key, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValueContains keeps values that contain s.
+func ValueContains(s string) Predicate {
+	return func(_ string, v store.VersionedValue) bool {
+		return strings.Contains(v.Value, s)
+	}
+}
+
+// VersionAbove keeps keys whose version is greater than n.
+func VersionAbove(n uint64) Predicate {
+	return func(_ string, v store.VersionedValue) bool {
+		return v.Version > n
+	}
+}
+
+// FieldEquals keeps JSON values whose field at path equals want. A string
+// field is compared as is; any other field by its JSON encoding, so want
+// "30" matches the number 30 and "true" the boolean. Values that are not
+// JSON, or lack the field, never match.
+func FieldEquals(path, want string) Predicate {
+	return func(_ string, v store.VersionedValue) bool {
+		field, ok := Field(v.Value, path)
+		return ok && Format(field) == want
+	}
+}
+
+// Field returns the field of a JSON value at path, a dot-separated list of
+// object keys such as "address.city".
+func Field(value, path string) (interface{}, bool) {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(value), &doc); err != nil {
+		return nil, false
+	}
+	return Lookup(doc, path)
+}
+
+// Lookup returns the field of a decoded JSON document at path.
+func Lookup(doc interface{}, path string) (interface{}, bool) {
+	for _, name := range strings.Split(path, ".") {
+		obj, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if doc, ok = obj[name]; !ok {
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// Format returns a JSON field as it is compared with a predicate's operand:
+// strings as they are, anything else as JSON.
+func Format(field interface{}) string {
+	if s, ok := field.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(field)
+	return string(b)
+}
@@ -0,0 +1,81 @@
+// Package filter_test contains the unit tests for the filter package.
+package filter
+
+import (
+	"testing"
+
+	"github.com/ASHISH26940/heliosdb/internal/store"
+)
+
+func TestFilter(t *testing.T) {
+	user := store.VersionedValue{Value: `{"name":"alice","age":30,"address":{"city":"Paris"}}`, Version: 3}
+	plain := store.VersionedValue{Value: "hello world", Version: 1}
+
+	// --- Test Case 1: The empty filter keeps everything ---
+	if !(Filter{}).Match("k", plain) {
+		t.Errorf("expected the empty filter to match, but it did not")
+	}
+
+	// --- Test Case 2: Substring and version predicates ---
+	if !(Filter{ValueContains("world")}).Match("k", plain) || (Filter{ValueContains("moon")}).Match("k", plain) {
+		t.Errorf("expected value_contains to match only substrings of the value")
+	}
+	if !(Filter{VersionAbove(2)}).Match("k", user) || (Filter{VersionAbove(3)}).Match("k", user) {
+		t.Errorf("expected version_gt to be strict")
+	}
+
+	// --- Test Case 3: JSON field predicates, nested and non-string ---
+	tests := []struct {
+		path, want string
+		match      bool
+	}{
+		{"name", "alice", true},
+		{"age", "30", true},
+		{"address.city", "Paris", true},
+		{"address.city", "London", false},
+		{"address.zip", "", false},
+		{"name.first", "alice", false},
+	}
+	for _, tc := range tests {
+		if got := (Filter{FieldEquals(tc.path, tc.want)}).Match("k", user); got != tc.match {
+			t.Errorf("expected %s=%s to match %v, but got %v", tc.path, tc.want, tc.match, got)
+		}
+	}
+	if (Filter{FieldEquals("name", "alice")}).Match("k", plain) {
+		t.Errorf("expected a non-JSON value never to match a field predicate")
+	}
+
+	// --- Test Case 4: All predicates must match ---
+	if (Filter{ValueContains("alice"), FieldEquals("age", "31")}).Match("k", user) {
+		t.Errorf("expected a filter to require every predicate")
+	}
+}
+
+func TestProject(t *testing.T) {
+	doc := `{"a":1,"b":{"c":2,"d":{"e":3}},"f":"x"}`
+
+	// --- Test Case 1: Top-level and nested fields keep their structure ---
+	tests := []struct {
+		paths []string
+		want  string
+	}{
+		{[]string{"a"}, `{"a":1}`},
+		{[]string{"b.c", "f"}, `{"b":{"c":2},"f":"x"}`},
+		{[]string{"b.c", "b.d.e"}, `{"b":{"c":2,"d":{"e":3}}}`},
+		{[]string{"b", "b.c"}, `{"b":{"c":2,"d":{"e":3}}}`},
+		{[]string{"missing", "a.x"}, `{}`},
+	}
+	for _, tc := range tests {
+		got, err := Project(doc, tc.paths)
+		if err != nil || got != tc.want {
+			t.Errorf("expected %v to give %s, but got %s (err %v)", tc.paths, tc.want, got, err)
+		}
+	}
+
+	// --- Test Case 2: Only JSON objects can be projected ---
+	for _, value := range []string{"plain", "[1,2]", "null"} {
+		if _, err := Project(value, []string{"a"}); err != ErrNotObject {
+			t.Errorf("expected ErrNotObject for %s, but got %v", value, err)
+		}
+	}
+}
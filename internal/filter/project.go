@@ -0,0 +1,41 @@
+package filter
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ErrNotObject is returned by Project for values that are not JSON objects.
+var ErrNotObject = errors.New("value is not a JSON object")
+
+// Project returns the JSON object value reduced to the fields at paths,
+// each a dot-separated list of object keys. Nested fields keep their
+// enclosing objects, so "b.c" of {"a":1,"b":{"c":2,"d":3}} gives
+// {"b":{"c":2}}. Fields the value lacks are left out.
+func Project(value string, paths []string) (string, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &doc); err != nil || doc == nil {
+		return "", ErrNotObject
+	}
+	out := make(map[string]interface{})
+	for _, path := range paths {
+		field, ok := Lookup(doc, path)
+		if !ok {
+			continue
+		}
+		names := strings.Split(path, ".")
+		obj := out
+		for _, name := range names[:len(names)-1] {
+			next, ok := obj[name].(map[string]interface{})
+			if !ok {
+				next = make(map[string]interface{})
+				obj[name] = next
+			}
+			obj = next
+		}
+		obj[names[len(names)-1]] = field
+	}
+	b, err := json.Marshal(out)
+	return string(b), err
+}
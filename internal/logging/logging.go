@@ -0,0 +1,75 @@
+// Package logging adds a process-wide, runtime-adjustable log level on top of
+// the standard library logger.
+package logging
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// Level is a logging severity. Messages below the current level are dropped.
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+// String returns the lower-case name of the level.
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("level(%d)", int32(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel converts a level name such as "debug" or "WARN" to a Level.
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", s)
+}
+
+var current atomic.Int32
+
+func init() {
+	current.Store(int32(LevelInfo))
+}
+
+// SetLevel changes the process-wide log level. It is safe to call at any time.
+func SetLevel(l Level) {
+	current.Store(int32(l))
+}
+
+// GetLevel returns the process-wide log level.
+func GetLevel() Level {
+	return Level(current.Load())
+}
+
+// Enabled reports whether messages at level l are currently logged.
+func Enabled(l Level) bool {
+	return l >= GetLevel()
+}
+
+// Debugf logs a message at debug level.
+func Debugf(format string, args ...interface{}) {
+	if Enabled(LevelDebug) {
+		log.Output(2, "DEBUG: "+fmt.Sprintf(format, args...))
+	}
+}
+
+// Warnf logs a message at warn level.
+func Warnf(format string, args ...interface{}) {
+	if Enabled(LevelWarn) {
+		log.Output(2, "WARN: "+fmt.Sprintf(format, args...))
+	}
+}
@@ -0,0 +1,42 @@
+// Package logging_test contains the unit tests for the logging package.
+package logging
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLevels(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	defer SetLevel(GetLevel())
+
+	lvl, err := ParseLevel("DEBUG")
+	if err != nil || lvl != LevelDebug {
+		t.Fatalf("expected to parse DEBUG, got %v (%v)", lvl, err)
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("expected an error for an unknown level, but got none")
+	}
+
+	SetLevel(LevelDebug)
+	Debugf("first %d", 1)
+	SetLevel(LevelWarn)
+	Debugf("second %d", 2)
+	Warnf("third %d", 3)
+
+	out := buf.String()
+	if !strings.Contains(out, "DEBUG: first 1") {
+		t.Errorf("expected debug message at debug level, got: %s", out)
+	}
+	if strings.Contains(out, "second") {
+		t.Errorf("expected debug message to be dropped at warn level, got: %s", out)
+	}
+	if !strings.Contains(out, "WARN: third 3") {
+		t.Errorf("expected warn message at warn level, got: %s", out)
+	}
+}
@@ -0,0 +1,220 @@
+// Package migration copies keys out of a running node to another key-value
+// store: a Redis-compatible server, or another HeliosDB cluster.
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+)
+
+// Job states.
+const (
+	StateRunning   = "running"
+	StateDone      = "done"
+	StateFailed    = "failed"
+	StateCancelled = "cancelled"
+)
+
+// defaultBatchSize is how many keys are sent to the target per round trip.
+const defaultBatchSize = 100
+
+// Record is one key as copied to a target.
+type Record struct {
+	Key   string
+	Value string
+}
+
+// Target is a store that keys are copied to.
+type Target interface {
+	// Write stores recs, overwriting existing keys only if the target was
+	// opened with replace.
+	Write(ctx context.Context, recs []Record) error
+	Close() error
+}
+
+// ErrInvalidTarget is returned by Dial for a malformed or unsupported target URL.
+var ErrInvalidTarget = errors.New("invalid target")
+
+// Dial opens the target named by a URL: redis://[user:password@]host:port[/db]
+// for a Redis-compatible server, or helios://host:port[,host:port...] for a
+// HeliosDB cluster. replace only applies to Redis; HeliosDB keys are always
+// overwritten.
+func Dial(ctx context.Context, target string, replace bool) (Target, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTarget, err)
+	}
+	switch u.Scheme {
+	case "redis":
+		return dialRedis(ctx, u, replace)
+	case "helios":
+		return newHeliosTarget(strings.Split(u.Host, ","))
+	}
+	return nil, fmt.Errorf("%w: unsupported scheme %q (want redis or helios)", ErrInvalidTarget, u.Scheme)
+}
+
+// Redact hides the password, if any, in a target URL.
+func Redact(target string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return target
+	}
+	return u.Redacted()
+}
+
+// Source is the node's store, as seen by a job.
+type Source interface {
+	Get(key string) (store.VersionedValue, bool)
+	Iterate(fn func(key string, value store.VersionedValue) bool)
+}
+
+// Options selects what a job copies and how.
+type Options struct {
+	Prefix          string // Only keys starting with Prefix are copied
+	DeleteAfterCopy bool   // Delete each key once it is copied, unless it changed meanwhile
+	BatchSize       int
+}
+
+// DeleteFunc deletes key if its version is still version, and returns
+// store.ErrVersionConflict otherwise.
+type DeleteFunc func(key string, version uint64) error
+
+// Job copies keys to a target in the background.
+type Job struct {
+	opts   Options
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu       sync.Mutex
+	progress v1.MigrationStatus
+}
+
+// Start copies the keys of src selected by opts to target, deleting them
+// with del if opts.DeleteAfterCopy is set. Keys are listed up front, but each
+// value is read just before it is sent, so writes made while the job runs
+// are copied as long as they land before their key's turn. The job owns
+// target and closes it when done.
+func Start(id, targetURL string, src Source, target Target, del DeleteFunc, opts Options) *Job {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &Job{
+		opts:   opts,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		progress: v1.MigrationStatus{
+			ID:              id,
+			Target:          Redact(targetURL),
+			Prefix:          opts.Prefix,
+			DeleteAfterCopy: opts.DeleteAfterCopy,
+			State:           StateRunning,
+			Started:         time.Now(),
+		},
+	}
+
+	var keys []string
+	src.Iterate(func(key string, _ store.VersionedValue) bool {
+		if strings.HasPrefix(key, opts.Prefix) && !store.IsReserved(key) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	j.progress.Total = len(keys)
+
+	go func() {
+		defer close(j.done)
+		defer target.Close()
+		err := j.run(ctx, keys, src, target, del)
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		j.progress.Finished = time.Now()
+		switch {
+		case errors.Is(err, context.Canceled):
+			j.progress.State = StateCancelled
+		case err != nil:
+			j.progress.State = StateFailed
+			j.progress.Error = err.Error()
+		default:
+			j.progress.State = StateDone
+		}
+	}()
+	return j
+}
+
+func (j *Job) run(ctx context.Context, keys []string, src Source, target Target, del DeleteFunc) error {
+	for start := 0; start < len(keys); start += j.opts.BatchSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		end := min(start+j.opts.BatchSize, len(keys))
+		recs := make([]Record, 0, end-start)
+		versions := make([]uint64, 0, end-start)
+		missing := 0
+		for _, key := range keys[start:end] {
+			vv, ok := src.Get(key)
+			if !ok {
+				missing++
+				continue
+			}
+			recs = append(recs, Record{Key: key, Value: vv.Value})
+			versions = append(versions, vv.Version)
+		}
+		if len(recs) > 0 {
+			if err := target.Write(ctx, recs); err != nil {
+				return fmt.Errorf("failed to copy keys: %w", err)
+			}
+		}
+		j.update(func(p *v1.MigrationStatus) {
+			p.Copied += len(recs)
+			p.Missing += missing
+		})
+
+		if !j.opts.DeleteAfterCopy {
+			continue
+		}
+		for i, rec := range recs {
+			err := del(rec.Key, versions[i])
+			if errors.Is(err, store.ErrVersionConflict) {
+				j.update(func(p *v1.MigrationStatus) { p.Changed++ })
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to delete %q after copying it: %w", rec.Key, err)
+			}
+			j.update(func(p *v1.MigrationStatus) { p.Deleted++ })
+		}
+	}
+	return nil
+}
+
+func (j *Job) update(fn func(p *v1.MigrationStatus)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fn(&j.progress)
+}
+
+// Progress returns a snapshot of the job's progress.
+func (j *Job) Progress() v1.MigrationStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.progress
+}
+
+// Cancel stops the job after the batch in flight.
+func (j *Job) Cancel() {
+	j.cancel()
+}
+
+// Wait blocks until the job has finished.
+func (j *Job) Wait() {
+	<-j.done
+}
@@ -0,0 +1,146 @@
+// Package migration_test contains the unit tests for the migration package.
+package migration
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ASHISH26940/heliosdb/internal/store"
+)
+
+// memTarget records what is written to it.
+type memTarget struct {
+	mu   sync.Mutex
+	data map[string]string
+}
+
+func (m *memTarget) Write(ctx context.Context, recs []Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, rec := range recs {
+		m.data[rec.Key] = rec.Value
+	}
+	return nil
+}
+
+func (m *memTarget) Close() error { return nil }
+
+func TestJob(t *testing.T) {
+	src := store.NewStore()
+	src.Set("users/a", "1")
+	src.Set("users/b", "2")
+	src.Set("users/c", "3")
+	src.Set("orders/x", "9")
+
+	// --- Test Case 1: Copy a prefix and delete what was copied ---
+	target := &memTarget{data: make(map[string]string)}
+	del := func(key string, version uint64) error {
+		if key == "users/b" {
+			return store.ErrVersionConflict // As if b was written after being copied
+		}
+		src.Delete(key)
+		return nil
+	}
+	job := Start("m1", "redis://:secret@localhost:6379", src, target, del, Options{Prefix: "users/", DeleteAfterCopy: true, BatchSize: 2})
+	job.Wait()
+	p := job.Progress()
+	if p.State != StateDone || p.Total != 3 || p.Copied != 3 || p.Deleted != 2 || p.Changed != 1 {
+		t.Errorf("expected 3 copied, 2 deleted and 1 changed, but got %+v", p)
+	}
+	if target.data["users/c"] != "3" || target.data["orders/x"] != "" {
+		t.Errorf("expected only users/ keys to be copied, but got %v", target.data)
+	}
+	if _, ok := src.Get("users/b"); !ok {
+		t.Error("expected the changed key to be kept, but it was deleted")
+	}
+	if strings.Contains(p.Target, "secret") {
+		t.Errorf("expected the password to be redacted, but got %q", p.Target)
+	}
+}
+
+func TestCRC64(t *testing.T) {
+	// --- Test Case 1: The check value of Redis's crc64 ---
+	if got := crc64Jones([]byte("123456789")); got != 0xe9c6d914c4b8d9ca {
+		t.Errorf("expected 0xe9c6d914c4b8d9ca, but got %#x", got)
+	}
+}
+
+// fakeRedis answers every command with +OK, recording the command names,
+// and refuses RESTORE of "busy" with BUSYKEY.
+func fakeRedis(t *testing.T) (addr string, commands func() []string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	var mu sync.Mutex
+	var seen []string
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			var n int
+			if _, err := fmt.Fscanf(r, "*%d\r\n", &n); err != nil {
+				return
+			}
+			args := make([]string, n)
+			for i := range args {
+				var size int
+				fmt.Fscanf(r, "$%d\r\n", &size)
+				buf := make([]byte, size+2)
+				if _, err := io.ReadFull(r, buf); err != nil {
+					return
+				}
+				args[i] = string(buf[:size])
+			}
+			mu.Lock()
+			seen = append(seen, strings.Join(args[:min(2, n)], " "))
+			mu.Unlock()
+			if args[0] == "RESTORE" && args[1] == "busy" {
+				conn.Write([]byte("-BUSYKEY Target key name already exists.\r\n"))
+			} else {
+				conn.Write([]byte("+OK\r\n"))
+			}
+		}
+	}()
+	return ln.Addr().String(), func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), seen...)
+	}
+}
+
+func TestRedisTarget(t *testing.T) {
+	addr, commands := fakeRedis(t)
+	ctx := context.Background()
+
+	// --- Test Case 1: AUTH and SELECT, then pipelined RESTOREs ---
+	target, err := Dial(ctx, "redis://:pw@"+addr+"/2", true)
+	if err != nil {
+		t.Fatalf("expected to connect, but got %v", err)
+	}
+	defer target.Close()
+	if err := target.Write(ctx, []Record{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}}); err != nil {
+		t.Fatalf("expected the write to succeed, but got %v", err)
+	}
+	want := []string{"AUTH pw", "SELECT 2", "RESTORE a", "RESTORE b"}
+	if got := commands(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("expected commands %v, but got %v", want, got)
+	}
+
+	// --- Test Case 2: An error reply names the key ---
+	err = target.Write(ctx, []Record{{Key: "busy", Value: "1"}})
+	if err == nil || !strings.Contains(err.Error(), `"busy"`) || !strings.Contains(err.Error(), "BUSYKEY") {
+		t.Errorf("expected a BUSYKEY error for busy, but got %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+package migration
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dumpRDBVersion is the RDB version stamped on RESTORE payloads. Targets
+// accept payloads from their own or any older version, and string values
+// have not changed format since this one.
+const dumpRDBVersion = 6
+
+// redisTarget copies keys with pipelined RESTORE commands, the same command
+// Redis's own MIGRATE sends, so any server that accepts a migration from
+// Redis accepts one from HeliosDB.
+type redisTarget struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	w       *bufio.Writer
+	replace bool
+}
+
+func dialRedis(ctx context.Context, u *url.URL, replace bool) (*redisTarget, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+	t := &redisTarget{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn), replace: replace}
+
+	var setup [][]string
+	if password, ok := u.User.Password(); ok {
+		if user := u.User.Username(); user != "" {
+			setup = append(setup, []string{"AUTH", user, password})
+		} else {
+			setup = append(setup, []string{"AUTH", password})
+		}
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		setup = append(setup, []string{"SELECT", db})
+	}
+	for _, cmd := range setup {
+		if err := t.do(ctx, [][]string{cmd}); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s failed: %w", cmd[0], err)
+		}
+	}
+	return t, nil
+}
+
+// Write sends one RESTORE per record in a single pipeline.
+func (t *redisTarget) Write(ctx context.Context, recs []Record) error {
+	cmds := make([][]string, len(recs))
+	for i, rec := range recs {
+		cmds[i] = []string{"RESTORE", rec.Key, "0", string(dumpPayload(rec.Value))}
+		if t.replace {
+			cmds[i] = append(cmds[i], "REPLACE")
+		}
+	}
+	return t.do(ctx, cmds)
+}
+
+// Close closes the connection.
+func (t *redisTarget) Close() error {
+	return t.conn.Close()
+}
+
+// do sends cmds and reads one reply per command, returning the first error.
+func (t *redisTarget) do(ctx context.Context, cmds [][]string) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(30 * time.Second)
+	}
+	t.conn.SetDeadline(deadline)
+
+	for _, cmd := range cmds {
+		fmt.Fprintf(t.w, "*%d\r\n", len(cmd))
+		for _, arg := range cmd {
+			fmt.Fprintf(t.w, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	if err := t.w.Flush(); err != nil {
+		return err
+	}
+	var firstErr error
+	for i := range cmds {
+		if err := readReply(t.r); err != nil && firstErr == nil {
+			if _, ok := err.(redisError); ok && len(cmds[i]) > 1 {
+				err = fmt.Errorf("key %q: %w", cmds[i][1], err)
+			}
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// redisError is an error reply from the server, e.g. "BUSYKEY Target key name already exists".
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+// readReply reads one RESP reply, returning an error reply as a redisError.
+func readReply(r *bufio.Reader) error {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return fmt.Errorf("malformed reply")
+	}
+	switch line[0] {
+	case '+', ':':
+		return nil
+	case '-':
+		return redisError(line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return fmt.Errorf("malformed reply %q", line)
+		}
+		if n >= 0 {
+			_, err = r.Discard(n + 2)
+		}
+		return err
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return fmt.Errorf("malformed reply %q", line)
+		}
+		for i := 0; i < n; i++ {
+			if err := readReply(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("malformed reply %q", line)
+}
+
+// dumpPayload serializes value the way DUMP does: an RDB string object,
+// followed by the RDB version and a CRC64 of everything before it.
+func dumpPayload(value string) []byte {
+	buf := []byte{0} // RDB string type
+	buf = appendLength(buf, uint64(len(value)))
+	buf = append(buf, value...)
+	buf = binary.LittleEndian.AppendUint16(buf, dumpRDBVersion)
+	return binary.LittleEndian.AppendUint64(buf, crc64Jones(buf))
+}
+
+// appendLength appends n in RDB length encoding.
+func appendLength(buf []byte, n uint64) []byte {
+	switch {
+	case n < 1<<6:
+		return append(buf, byte(n))
+	case n < 1<<14:
+		return append(buf, byte(n>>8)|0x40, byte(n))
+	case n <= 0xFFFFFFFF:
+		return binary.BigEndian.AppendUint32(append(buf, 0x80), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(buf, 0x81), n)
+}
+
+// crc64Table is for the reflected Jones polynomial used by Redis.
+var crc64Table = func() (t [256]uint64) {
+	const poly = 0x95AC9329AC4BC9B5
+	for i := range t {
+		crc := uint64(i)
+		for j := 0; j < 8; j++ {
+			if crc&1 == 1 {
+				crc = crc>>1 ^ poly
+			} else {
+				crc >>= 1
+			}
+		}
+		t[i] = crc
+	}
+	return t
+}()
+
+// crc64Jones is Redis's CRC64 (no initial or final inversion, unlike hash/crc64).
+func crc64Jones(data []byte) uint64 {
+	var crc uint64
+	for _, b := range data {
+		crc = crc64Table[byte(crc)^b] ^ crc>>8
+	}
+	return crc
+}
@@ -0,0 +1,89 @@
+// Package mutate implements the small declarative mutations accepted by the
+// atomic read-modify-write endpoint.
+package mutate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Supported mutation operations.
+const (
+	OpMerge  = "merge"  // RFC 7386 JSON merge patch against a JSON object value
+	OpIncr   = "incr"   // Add a number to a numeric value
+	OpAppend = "append" // Append a string to the value
+)
+
+// Mutation describes how to derive a new value from the current one.
+type Mutation struct {
+	Op    string          `json:"op"`
+	Patch json.RawMessage `json:"patch,omitempty"` // For merge
+	Delta float64         `json:"delta,omitempty"` // For incr
+	Value string          `json:"value,omitempty"` // For append
+}
+
+// Apply computes the new value for a key whose current value is current
+// (exists reports whether the key is present at all).
+func Apply(m Mutation, current string, exists bool) (string, error) {
+	switch m.Op {
+	case OpMerge:
+		return merge(current, exists, m.Patch)
+	case OpIncr:
+		n := 0.0
+		if exists {
+			var err error
+			if n, err = strconv.ParseFloat(current, 64); err != nil {
+				return "", fmt.Errorf("current value %q is not a number", current)
+			}
+		}
+		return strconv.FormatFloat(n+m.Delta, 'f', -1, 64), nil
+	case OpAppend:
+		return current + m.Value, nil
+	default:
+		return "", fmt.Errorf("unknown mutation op %q", m.Op)
+	}
+}
+
+func merge(current string, exists bool, patch json.RawMessage) (string, error) {
+	if len(patch) == 0 {
+		return "", errors.New("merge requires a patch")
+	}
+	var target interface{} = map[string]interface{}{}
+	if exists && current != "" {
+		if err := json.Unmarshal([]byte(current), &target); err != nil {
+			return "", fmt.Errorf("current value is not JSON: %w", err)
+		}
+	}
+	var p interface{}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return "", fmt.Errorf("invalid merge patch: %w", err)
+	}
+	out, err := json.Marshal(mergePatch(target, p))
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// mergePatch applies patch to target following RFC 7386: objects are merged
+// recursively, null removes a member, and anything else replaces the target.
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+	return t
+}
@@ -0,0 +1,37 @@
+// Package mutate_test contains the unit tests for the mutate package.
+package mutate
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	cases := []struct {
+		name    string
+		m       Mutation
+		current string
+		exists  bool
+		want    string
+		wantErr bool
+	}{
+		{"incr existing", Mutation{Op: OpIncr, Delta: 5}, "10", true, "15", false},
+		{"incr missing", Mutation{Op: OpIncr, Delta: -1.5}, "", false, "-1.5", false},
+		{"incr non-number", Mutation{Op: OpIncr, Delta: 1}, "abc", true, "", true},
+		{"append", Mutation{Op: OpAppend, Value: "!"}, "hi", true, "hi!", false},
+		{"merge", Mutation{Op: OpMerge, Patch: json.RawMessage(`{"a":{"b":2,"c":null},"d":"x"}`)}, `{"a":{"b":1,"c":3},"e":true}`, true, `{"a":{"b":2},"d":"x","e":true}`, false},
+		{"merge missing", Mutation{Op: OpMerge, Patch: json.RawMessage(`{"a":1}`)}, "", false, `{"a":1}`, false},
+		{"merge non-JSON", Mutation{Op: OpMerge, Patch: json.RawMessage(`{"a":1}`)}, "plain", true, "", true},
+		{"unknown op", Mutation{Op: "multiply"}, "1", true, "", true},
+	}
+	for _, tc := range cases {
+		got, err := Apply(tc.m, tc.current, tc.exists)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: expected error=%v, got %v", tc.name, tc.wantErr, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.want, got)
+		}
+	}
+}
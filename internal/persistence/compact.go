@@ -0,0 +1,119 @@
+package persistence
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Size flushes the WAL and returns the length of its records in bytes,
+// which is less than the file's if space is allocated ahead of them. Taken
+// while nothing else is appending, it marks a cut for Compact.
+func (w *WAL) Size() (int64, error) {
+	unlock := w.pauseAppends()
+	defer unlock()
+	if w.pipe != nil {
+		if err := w.pipe.wait(w.pipe.next); err != nil {
+			return 0, err
+		}
+	}
+	return w.file.end, nil
+}
+
+// Compact replaces the first cut bytes of the WAL with the records emitted
+// by write, which must rebuild the same state, and keeps every record
+// appended after the cut. The new file is written alongside the old one and
+// renamed over it, so a crash leaves one or the other intact. Records are
+// sealed with the active key, re-encrypting any written under older ones.
+// Appends wait only while the tail is copied and the files are swapped. It
+// returns the size of the WAL's records before and after.
+func (w *WAL) Compact(cut int64, write func(emit func(cmd interface{}) error) error) (before, after int64, err error) {
+	tmpPath := w.path + ".compact"
+	tmp := w.reuseRetired(tmpPath)
+	if tmp == nil {
+		f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0644)
+		if err != nil {
+			return 0, 0, err
+		}
+		tmp = &walFile{f: f, segmentBytes: w.segmentBytes}
+	}
+	defer func() {
+		if err != nil {
+			tmp.f.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	err = write(func(cmd interface{}) error {
+		data, err := w.encode(cmd)
+		if err != nil {
+			return err
+		}
+		return tmp.write(data)
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	if before, after, err = w.swapIn(tmp, tmpPath, cut); err != nil {
+		return 0, 0, err
+	}
+	w.trimRetired()
+	return before, after, nil
+}
+
+// swapIn copies the records appended after cut to tmp, at tmpPath, and
+// replaces the WAL with it. Appends wait until it returns.
+func (w *WAL) swapIn(tmp *walFile, tmpPath string, cut int64) (before, after int64, err error) {
+	unlock := w.pauseAppends()
+	defer unlock()
+	if w.pipe != nil {
+		if err = w.pipe.wait(w.pipe.next); err != nil {
+			return 0, 0, err
+		}
+	}
+	before = w.file.end
+	tail := io.NewSectionReader(w.file.f, cut, before-cut)
+	buf := make([]byte, 1<<20)
+	for {
+		n, rerr := tail.Read(buf)
+		if n > 0 {
+			if err = tmp.write(buf[:n]); err != nil {
+				return 0, 0, err
+			}
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return 0, 0, rerr
+		}
+	}
+	if err = datasync(tmp.f); err != nil {
+		return 0, 0, err
+	}
+	after = tmp.end
+	w.retire()
+	if err = os.Rename(tmpPath, w.path); err != nil {
+		return 0, 0, err
+	}
+	if dir, derr := os.Open(filepath.Dir(w.path)); derr == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	old := w.file
+	w.file = tmp
+	old.f.Close()
+	return before, after, nil
+}
+
+// pauseAppends blocks new appends until the returned function is called.
+// Records already queued on a pipelined WAL are still written.
+func (w *WAL) pauseAppends() (unlock func()) {
+	if w.pipe == nil {
+		w.mu.Lock()
+		return w.mu.Unlock
+	}
+	w.pipe.appendMu.Lock()
+	return w.pipe.appendMu.Unlock
+}
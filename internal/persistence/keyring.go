@@ -0,0 +1,233 @@
+package persistence
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// encryptedRecordPrefix marks a WAL line as an AES-GCM sealed record. It is
+// followed by the key version and the base64 sealed payload: "enc:<version>:<payload>".
+// Lines without it are plaintext records written before encryption was enabled.
+var encryptedRecordPrefix = []byte("enc:")
+
+// ErrPlaintextRecord is returned by Open for a plaintext record, which a
+// keyring refuses unless it was loaded with WithPlaintextMigration: anyone
+// able to write to the data directory could otherwise inject records that
+// were never sealed.
+var ErrPlaintextRecord = errors.New("found a plaintext record, but encryption at rest is enabled")
+
+// Keyring holds every version of the data-encryption key. New records are
+// sealed with the newest (active) version; older versions are kept so that
+// data written before a rotation can still be read. A nil *Keyring is valid
+// and leaves records untouched.
+//
+// A keyring is local to its node: Rotate adds a key to this node's file
+// only, and other nodes never learn of it.
+type Keyring struct {
+	mu             sync.RWMutex
+	path           string
+	keys           map[uint32]cipher.AEAD
+	active         uint32
+	allowPlaintext bool
+}
+
+// KeyringOption configures a Keyring.
+type KeyringOption func(*Keyring)
+
+// WithPlaintextMigration lets Open accept plaintext records, so that a WAL
+// written before encryption was enabled can be read once. They are sealed
+// when the WAL is next compacted, after which the option should be dropped.
+func WithPlaintextMigration() KeyringOption {
+	return func(k *Keyring) {
+		k.allowPlaintext = true
+	}
+}
+
+// LoadKeyring reads a keyring file. Each non-empty line is either
+// "<version>:<hex key>" or, for a single-key file, just "<hex key>" (version 1).
+// The highest version is the active key. The file may be a plain secret on
+// disk or one mounted by a KMS agent.
+func LoadKeyring(path string, opts ...KeyringOption) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	k := &Keyring{path: path, keys: make(map[uint32]cipher.AEAD)}
+	for _, opt := range opts {
+		opt(k)
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		version := uint32(1)
+		encoded := line
+		if v, rest, ok := strings.Cut(line, ":"); ok {
+			n, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("key file %s line %d: invalid key version %q", path, i+1, v)
+			}
+			version, encoded = uint32(n), rest
+		}
+		key, err := hex.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key file %s line %d is not valid hex: %w", path, i+1, err)
+		}
+		if err := k.add(version, key); err != nil {
+			return nil, fmt.Errorf("key file %s line %d: %w", path, i+1, err)
+		}
+	}
+	if len(k.keys) == 0 {
+		return nil, fmt.Errorf("key file %s contains no keys", path)
+	}
+	return k, nil
+}
+
+// NewKeyring returns an in-memory keyring holding a single key as version 1.
+func NewKeyring(key []byte, opts ...KeyringOption) (*Keyring, error) {
+	k := &Keyring{keys: make(map[uint32]cipher.AEAD)}
+	for _, opt := range opts {
+		opt(k)
+	}
+	if err := k.add(1, key); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (k *Keyring) add(version uint32, key []byte) error {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	k.keys[version] = aead
+	if version > k.active {
+		k.active = version
+	}
+	return nil
+}
+
+// ActiveVersion returns the version of the key used to seal new records.
+func (k *Keyring) ActiveVersion() uint32 {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active
+}
+
+// Rotate generates a fresh 256-bit key, appends it to the keyring file and
+// makes it the active key. Existing data is not rewritten: records sealed
+// with older versions stay readable and pick up the new key the next time
+// they are written. Only this node's keyring changes; other nodes must be
+// given the new key before they read data this node seals with it, such
+// as the snapshots it sends as leader.
+func (k *Keyring) Rotate() (uint32, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return 0, err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	version := k.active + 1
+	if k.path != "" {
+		f, err := os.OpenFile(k.path, os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return 0, err
+		}
+		_, err = fmt.Fprintf(f, "\n%d:%s\n", version, hex.EncodeToString(key))
+		if err == nil {
+			err = f.Sync()
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	if err := k.add(version, key); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// Seal encrypts data with the active key into a single newline-free line.
+func (k *Keyring) Seal(data []byte) ([]byte, error) {
+	if k == nil {
+		return data, nil
+	}
+	k.mu.RLock()
+	version, aead := k.active, k.keys[k.active]
+	k.mu.RUnlock()
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := aead.Seal(nonce, nonce, data, nil)
+	header := fmt.Sprintf("%s%d:", encryptedRecordPrefix, version)
+	out := make([]byte, len(header)+base64.StdEncoding.EncodedLen(len(sealed)))
+	copy(out, header)
+	base64.StdEncoding.Encode(out[len(header):], sealed)
+	return out, nil
+}
+
+// Open reverses Seal using whichever key version the data was sealed with.
+// Plaintext input is returned as-is by a nil keyring, or one loaded with
+// WithPlaintextMigration, and refused with ErrPlaintextRecord otherwise.
+func (k *Keyring) Open(line []byte) ([]byte, error) {
+	if !bytes.HasPrefix(line, encryptedRecordPrefix) {
+		if k != nil && !k.allowPlaintext {
+			return nil, ErrPlaintextRecord
+		}
+		return line, nil
+	}
+	if k == nil {
+		return nil, errors.New("found encrypted data but no encryption key is configured")
+	}
+	v, encoded, ok := bytes.Cut(line[len(encryptedRecordPrefix):], []byte(":"))
+	if !ok {
+		return nil, errors.New("malformed encrypted record: missing key version")
+	}
+	n, err := strconv.ParseUint(string(v), 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("malformed encrypted record: invalid key version %q", v)
+	}
+	k.mu.RLock()
+	aead, ok := k.keys[uint32(n)]
+	k.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("encrypted record uses unknown key version %d", n)
+	}
+
+	sealed := make([]byte, base64.StdEncoding.DecodedLen(len(encoded)))
+	size, err := base64.StdEncoding.Decode(sealed, encoded)
+	if err != nil {
+		return nil, fmt.Errorf("malformed encrypted record: %w", err)
+	}
+	sealed = sealed[:size]
+	nonceSize := aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, errors.New("malformed encrypted record: too short")
+	}
+	data, err := aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt record: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,193 @@
+package persistence
+
+import (
+	"errors"
+	"sync"
+)
+
+// maxGroupCommit bounds how many queued records are written per fsync.
+const maxGroupCommit = 256
+
+// errWALClosed is returned by Append after the WAL has been closed.
+var errWALClosed = errors.New("wal: closed")
+
+// pipeline persists WAL records on a background goroutine. Records are
+// written in the order they were appended, and every record queued while an
+// fsync is in progress shares the next one (group commit), so callers are
+// not bound by one fsync per record.
+type pipeline struct {
+	w *WAL
+
+	appendMu sync.Mutex // Orders sequence assignment with queueing
+	next     uint64     // Sequence number of the last appended record
+	closed   bool
+	queue    chan pendingRecord
+	stopped  chan struct{}
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	durable uint64 // Highest sequence number known to be on disk
+	err     error  // First write or sync error; sticky
+}
+
+type pendingRecord struct {
+	seq  uint64
+	data []byte
+}
+
+// NewPipelinedWAL is NewEncryptedWAL with asynchronous persistence: Append
+// returns as soon as the record is queued, and up to depth records may be
+// waiting to be written. A depth of 0 writes synchronously.
+func NewPipelinedWAL(path string, k *Keyring, depth int, opts ...Option) (*WAL, error) {
+	w, err := NewEncryptedWAL(path, k, opts...)
+	if err != nil || depth <= 0 {
+		return w, err
+	}
+	p := &pipeline{
+		w:       w,
+		queue:   make(chan pendingRecord, depth),
+		stopped: make(chan struct{}),
+	}
+	p.cond = sync.NewCond(&p.mu)
+	w.pipe = p
+	go p.run()
+	return w, nil
+}
+
+// Append adds cmd to the WAL and returns its sequence number. On a pipelined
+// WAL the record may not be on disk yet; use Wait or Flush for that. An error
+// from an earlier asynchronous write is returned by every later Append.
+func (w *WAL) Append(cmd interface{}) (uint64, error) {
+	data, err := w.encode(cmd)
+	if err != nil {
+		return 0, err
+	}
+	if w.pipe == nil {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if err := w.file.write(data); err != nil {
+			return 0, err
+		}
+		return 0, w.sync()
+	}
+	return w.pipe.append(data)
+}
+
+// Wait blocks until the record with sequence number seq is on disk.
+func (w *WAL) Wait(seq uint64) error {
+	if w.pipe == nil {
+		return nil
+	}
+	return w.pipe.wait(seq)
+}
+
+// Flush blocks until every record appended so far is on disk.
+func (w *WAL) Flush() error {
+	if w.pipe == nil {
+		return nil
+	}
+	w.pipe.appendMu.Lock()
+	seq := w.pipe.next
+	w.pipe.appendMu.Unlock()
+	return w.pipe.wait(seq)
+}
+
+// Durable returns the sequence number of the last record known to be on
+// disk. It is always 0 for a synchronous WAL, where Append only returns once
+// the record is durable.
+func (w *WAL) Durable() uint64 {
+	if w.pipe == nil {
+		return 0
+	}
+	w.pipe.mu.Lock()
+	defer w.pipe.mu.Unlock()
+	return w.pipe.durable
+}
+
+func (p *pipeline) append(data []byte) (uint64, error) {
+	p.mu.Lock()
+	err := p.err
+	p.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	p.appendMu.Lock()
+	defer p.appendMu.Unlock()
+	if p.closed {
+		return 0, errWALClosed
+	}
+	p.next++
+	p.queue <- pendingRecord{seq: p.next, data: data}
+	return p.next, nil
+}
+
+func (p *pipeline) wait(seq uint64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.durable < seq && p.err == nil {
+		p.cond.Wait()
+	}
+	return p.err
+}
+
+// run writes queued records until the queue is closed.
+func (p *pipeline) run() {
+	defer close(p.stopped)
+	var buf []byte
+	for rec := range p.queue {
+		buf = append(buf[:0], rec.data...)
+		last := rec.seq
+	drain:
+		for n := 1; n < maxGroupCommit; n++ {
+			select {
+			case more, ok := <-p.queue:
+				if !ok {
+					break drain
+				}
+				buf = append(buf, more.data...)
+				last = more.seq
+			default:
+				break drain
+			}
+		}
+
+		err := p.sticky()
+		if err == nil {
+			if err = p.w.file.write(buf); err == nil {
+				err = p.w.sync()
+			}
+		}
+
+		p.mu.Lock()
+		if err != nil && p.err == nil {
+			p.err = err
+		}
+		if p.err == nil {
+			p.durable = last
+		}
+		p.cond.Broadcast()
+		p.mu.Unlock()
+	}
+}
+
+func (p *pipeline) sticky() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// close stops accepting records and waits for queued ones to be written.
+func (p *pipeline) close() error {
+	p.appendMu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.appendMu.Unlock()
+	<-p.stopped
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
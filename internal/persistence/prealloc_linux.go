@@ -0,0 +1,46 @@
+//go:build linux
+
+package persistence
+
+import (
+	"os"
+	"syscall"
+)
+
+// fallocZeroRange is FALLOC_FL_ZERO_RANGE: zero a range, keeping its space.
+const fallocZeroRange = 0x10
+
+// preallocate allocates n bytes of f from off, extending it.
+func preallocate(f *os.File, off, n int64) error {
+	err := fallocate(f, 0, off, n)
+	if err == syscall.EOPNOTSUPP || err == syscall.ENOSYS {
+		return f.Truncate(off + n)
+	}
+	return err
+}
+
+// zeroRange zeroes n bytes of f from off, without freeing their space.
+func zeroRange(f *os.File, off, n int64) error {
+	if n == 0 || fallocate(f, fallocZeroRange, off, n) == nil {
+		return nil
+	}
+	return writeZeros(f, off, n)
+}
+
+func fallocate(f *os.File, mode uint32, off, n int64) error {
+	for {
+		if err := syscall.Fallocate(int(f.Fd()), mode, off, n); err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+// datasync flushes f's data to disk, and its metadata only where needed to
+// read the data back, such as a new size.
+func datasync(f *os.File) error {
+	for {
+		if err := syscall.Fdatasync(int(f.Fd())); err != syscall.EINTR {
+			return err
+		}
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package persistence
+
+import "os"
+
+// preallocate extends f to off+n bytes. Space is not allocated ahead on
+// this platform; the file is only extended.
+func preallocate(f *os.File, off, n int64) error {
+	return f.Truncate(off + n)
+}
+
+// zeroRange zeroes n bytes of f from off.
+func zeroRange(f *os.File, off, n int64) error {
+	return writeZeros(f, off, n)
+}
+
+// datasync flushes f to disk.
+func datasync(f *os.File) error {
+	return f.Sync()
+}
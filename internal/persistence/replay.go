@@ -0,0 +1,194 @@
+package persistence
+
+import (
+	"bufio"
+	"hash/fnv"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// replayReadBufferSize is the size of the buffered reader placed in front of the WAL file.
+	replayReadBufferSize = 1 << 20
+	// MaxRecordSize is the largest single WAL record the replayer will accept.
+	// bufio.Scanner's default of 64KB is far too small for large values.
+	MaxRecordSize = 64 << 20
+	// replayProgressInterval controls how often replay progress is logged.
+	replayProgressInterval = 2 * time.Second
+)
+
+// replayProgress tracks and periodically logs how far a replay has got.
+type replayProgress struct {
+	path      string
+	total     int64
+	bytesRead int64
+	entries   int64
+	start     time.Time
+	lastLog   time.Time
+}
+
+func newReplayProgress(path string, total int64) *replayProgress {
+	now := time.Now()
+	return &replayProgress{path: path, total: total, start: now, lastLog: now}
+}
+
+// record accounts for one entry of n bytes (excluding the trailing newline).
+func (p *replayProgress) record(n int) {
+	p.entries++
+	p.bytesRead += int64(n) + 1
+	if time.Since(p.lastLog) >= replayProgressInterval {
+		p.lastLog = time.Now()
+		log.Printf("WAL replay: %d entries (%.1f%% done, %.0f entries/sec)", p.entries, p.percent(), p.rate())
+	}
+}
+
+func (p *replayProgress) percent() float64 {
+	if p.total <= 0 {
+		return 100
+	}
+	pct := float64(p.bytesRead) / float64(p.total) * 100
+	if pct > 100 {
+		pct = 100
+	}
+	return pct
+}
+
+func (p *replayProgress) rate() float64 {
+	elapsed := time.Since(p.start).Seconds()
+	if elapsed <= 0 {
+		return float64(p.entries)
+	}
+	return float64(p.entries) / elapsed
+}
+
+func (p *replayProgress) done() {
+	log.Printf("WAL replay of %s finished: %d entries in %s (%.0f entries/sec)",
+		p.path, p.entries, time.Since(p.start).Round(time.Millisecond), p.rate())
+}
+
+// scanWAL opens the WAL at path and calls fn for every record in order,
+// decrypting records with k first. A missing WAL is treated as empty.
+func scanWAL(path string, k *Keyring, fn func(record []byte) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	var total int64
+	if info, err := file.Stat(); err == nil {
+		total = info.Size()
+	}
+	progress := newReplayProgress(path, total)
+
+	scanner := bufio.NewScanner(bufio.NewReaderSize(file, replayReadBufferSize))
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxRecordSize)
+	scanner.Split(scanRecords)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		record, err := k.Open(line)
+		if err != nil {
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+		progress.record(len(line))
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	progress.done()
+	return nil
+}
+
+// scanRecords splits a WAL into its newline-terminated records, stopping at
+// a zero byte where a record would start: the space allocated ahead of them.
+func scanRecords(data []byte, atEOF bool) (int, []byte, error) {
+	if len(data) > 0 && data[0] == 0 {
+		return 0, nil, bufio.ErrFinalToken
+	}
+	return bufio.ScanLines(data, atEOF)
+}
+
+// ReplayParallel replays the WAL at path, applying records on up to workers
+// goroutines. partition returns the key a record touches; records sharing a
+// key are always applied in log order by the same worker. Records for which
+// partition returns "" (e.g. multi-key transactions) act as barriers: they are
+// applied only after every earlier record has been applied, and before any
+// later one. Encrypted records are opened with k.
+func ReplayParallel(path string, k *Keyring, workers int, partition func(cmdBytes []byte) (string, error), applyFunc func(cmdBytes []byte) error) error {
+	if workers <= 1 {
+		return Replay(path, k, applyFunc)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+		failed   = make(chan struct{})
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			close(failed)
+		})
+	}
+
+	queues := make([]chan []byte, workers)
+	var workersDone sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan []byte, 256)
+		workersDone.Add(1)
+		go func(q <-chan []byte) {
+			defer workersDone.Done()
+			for record := range q {
+				if err := applyFunc(record); err != nil {
+					fail(err)
+				}
+				wg.Done()
+			}
+		}(queues[i])
+	}
+
+	scanErr := scanWAL(path, k, func(record []byte) error {
+		select {
+		case <-failed:
+			return firstErr
+		default:
+		}
+
+		key, err := partition(record)
+		if err != nil {
+			return err
+		}
+		// The scanner reuses its buffer, so records handed to workers must be copied.
+		buf := make([]byte, len(record))
+		copy(buf, record)
+
+		if key == "" {
+			wg.Wait()
+			return applyFunc(buf)
+		}
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		wg.Add(1)
+		queues[h.Sum32()%uint32(workers)] <- buf
+		return nil
+	})
+
+	for _, q := range queues {
+		close(q)
+	}
+	workersDone.Wait()
+
+	if scanErr != nil {
+		return scanErr
+	}
+	return firstErr
+}
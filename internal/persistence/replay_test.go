@@ -0,0 +1,329 @@
+// Package persistence_test contains the unit tests for the persistence package.
+package persistence
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestReplay_LargeRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.wal")
+	wal, err := NewWAL(path)
+	if err != nil {
+		t.Fatalf("failed to open WAL: %v", err)
+	}
+	big := strings.Repeat("x", 1<<20) // Well past bufio.Scanner's 64KB default
+	if err := wal.WriteCommand(map[string]string{"value": big}); err != nil {
+		t.Fatalf("failed to write command: %v", err)
+	}
+	wal.Close()
+
+	count := 0
+	err = Replay(path, nil, func(cmdBytes []byte) error {
+		count++
+		if !strings.Contains(string(cmdBytes), big) {
+			t.Error("replayed record was truncated")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error replaying a large record, but got: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 record, got %d", count)
+	}
+}
+
+func TestReplayParallel_PreservesPerKeyOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.wal")
+	wal, err := NewWAL(path)
+	if err != nil {
+		t.Fatalf("failed to open WAL: %v", err)
+	}
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key%d", i%10)
+		if i%100 == 99 {
+			key = "" // A barrier record
+		}
+		if err := wal.WriteCommand(map[string]interface{}{"key": key, "seq": i}); err != nil {
+			t.Fatalf("failed to write command: %v", err)
+		}
+	}
+	wal.Close()
+
+	var (
+		mu      sync.Mutex
+		lastSeq = make(map[string]int)
+		applied int
+	)
+	decode := func(cmdBytes []byte) (string, int) {
+		var rec struct {
+			Key string `json:"key"`
+			Seq int    `json:"seq"`
+		}
+		json.Unmarshal(cmdBytes, &rec)
+		return rec.Key, rec.Seq
+	}
+
+	err = ReplayParallel(path, nil, 4, func(cmdBytes []byte) (string, error) {
+		key, _ := decode(cmdBytes)
+		return key, nil
+	}, func(cmdBytes []byte) error {
+		key, seq := decode(cmdBytes)
+		mu.Lock()
+		defer mu.Unlock()
+		if key == "" && applied != seq {
+			t.Errorf("barrier %d applied after %d records, expected %d", seq, applied, seq)
+		}
+		if last, ok := lastSeq[key]; ok && last > seq {
+			t.Errorf("key %q applied out of order: %d after %d", key, seq, last)
+		}
+		lastSeq[key] = seq
+		applied++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, but got: %v", err)
+	}
+	if applied != 1000 {
+		t.Errorf("expected 1000 records applied, got %d", applied)
+	}
+}
+
+func TestReplay_Encrypted(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.wal")
+
+	// A plaintext record written before encryption was enabled.
+	plain, err := NewWAL(path)
+	if err != nil {
+		t.Fatalf("failed to open WAL: %v", err)
+	}
+	plain.WriteCommand(map[string]string{"value": "before"})
+	plain.Close()
+
+	keyPath := filepath.Join(dir, "wal.key")
+	os.WriteFile(keyPath, []byte(strings.Repeat("ab", 32)+"\n"), 0600)
+	k, err := LoadKeyring(keyPath)
+	if err != nil {
+		t.Fatalf("failed to load keyring: %v", err)
+	}
+	enc, err := NewEncryptedWAL(path, k)
+	if err != nil {
+		t.Fatalf("failed to open encrypted WAL: %v", err)
+	}
+	enc.WriteCommand(map[string]string{"value": "secret-value"})
+	enc.Close()
+
+	raw, _ := os.ReadFile(path)
+	if strings.Contains(string(raw), "secret-value") {
+		t.Fatal("expected the value to be encrypted on disk, but found it in plaintext")
+	}
+
+	// Once a key is set, plaintext records are refused unless migrating.
+	if err := Replay(path, k, func([]byte) error { return nil }); !errors.Is(err, ErrPlaintextRecord) {
+		t.Errorf("expected %v replaying a plaintext record, but got: %v", ErrPlaintextRecord, err)
+	}
+	migrating, err := LoadKeyring(keyPath, WithPlaintextMigration())
+	if err != nil {
+		t.Fatalf("failed to load keyring: %v", err)
+	}
+
+	var got []string
+	err = Replay(path, migrating, func(cmdBytes []byte) error {
+		got = append(got, string(cmdBytes))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error replaying encrypted WAL, but got: %v", err)
+	}
+	if len(got) != 2 || !strings.Contains(got[1], "secret-value") {
+		t.Errorf("unexpected replayed records: %v", got)
+	}
+
+	// Replaying without the key must fail rather than silently skip records.
+	if err := Replay(path, nil, func([]byte) error { return nil }); err == nil {
+		t.Error("expected an error replaying an encrypted WAL without a key, but got none")
+	}
+}
+
+func TestKeyring_Rotate(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "wal.key")
+	os.WriteFile(keyPath, []byte(strings.Repeat("cd", 32)), 0600)
+	k, err := LoadKeyring(keyPath)
+	if err != nil {
+		t.Fatalf("failed to load keyring: %v", err)
+	}
+
+	old, err := k.Seal([]byte("old record"))
+	if err != nil {
+		t.Fatalf("failed to seal: %v", err)
+	}
+	version, err := k.Rotate()
+	if err != nil {
+		t.Fatalf("failed to rotate: %v", err)
+	}
+	if version != 2 || k.ActiveVersion() != 2 {
+		t.Errorf("expected active key version 2 after rotation, got %d", k.ActiveVersion())
+	}
+	fresh, _ := k.Seal([]byte("new record"))
+	if !strings.HasPrefix(string(fresh), "enc:2:") {
+		t.Errorf("expected new data to be sealed with version 2, got %q", fresh[:8])
+	}
+
+	// The rotated key must be persisted, and old data must stay readable.
+	reloaded, err := LoadKeyring(keyPath)
+	if err != nil {
+		t.Fatalf("failed to reload keyring: %v", err)
+	}
+	for _, sealed := range [][]byte{old, fresh} {
+		if _, err := reloaded.Open(sealed); err != nil {
+			t.Errorf("expected to open %q after reload, got: %v", sealed[:8], err)
+		}
+	}
+}
+
+func TestPipelinedWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.wal")
+	wal, err := NewPipelinedWAL(path, nil, 16)
+	if err != nil {
+		t.Fatalf("failed to open WAL: %v", err)
+	}
+
+	// --- Test Case 1: Appends are ordered and become durable ---
+	const n = 1000
+	var last uint64
+	for i := 0; i < n; i++ {
+		seq, err := wal.Append(map[string]int{"i": i})
+		if err != nil {
+			t.Fatalf("failed to append record %d: %v", i, err)
+		}
+		if seq != last+1 {
+			t.Fatalf("expected sequence %d, but got %d", last+1, seq)
+		}
+		last = seq
+	}
+	if err := wal.Flush(); err != nil {
+		t.Fatalf("failed to flush: %v", err)
+	}
+	if wal.Durable() != n {
+		t.Errorf("expected %d records to be durable, but got %d", n, wal.Durable())
+	}
+
+	// --- Test Case 2: WriteCommand still waits for its own record ---
+	if err := wal.WriteCommand(map[string]int{"i": n}); err != nil {
+		t.Fatalf("failed to write command: %v", err)
+	}
+	if err := wal.Close(); err != nil {
+		t.Fatalf("failed to close WAL: %v", err)
+	}
+	if _, err := wal.Append(map[string]int{"i": -1}); err == nil {
+		t.Error("expected an error appending to a closed WAL, but got nil")
+	}
+
+	// --- Test Case 3: Replay sees every record in order ---
+	next := 0
+	err = Replay(path, nil, func(cmdBytes []byte) error {
+		var rec map[string]int
+		if err := json.Unmarshal(cmdBytes, &rec); err != nil {
+			return err
+		}
+		if rec["i"] != next {
+			return fmt.Errorf("expected record %d, but got %d", next, rec["i"])
+		}
+		next++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	if next != n+1 {
+		t.Errorf("expected %d records, but got %d", n+1, next)
+	}
+}
+
+func TestWAL_Segments(t *testing.T) {
+	const segment = 1 << 16
+	path := filepath.Join(t.TempDir(), "app.wal")
+	wal, err := NewPipelinedWAL(path, nil, 16, WithSegmentBytes(segment))
+	if err != nil {
+		t.Fatalf("failed to open WAL: %v", err)
+	}
+	replay := func() []string {
+		var got []string
+		if err := Replay(path, nil, func(cmdBytes []byte) error {
+			got = append(got, string(cmdBytes))
+			return nil
+		}); err != nil {
+			t.Fatalf("expected no error replaying the WAL, but got: %v", err)
+		}
+		return got
+	}
+
+	// --- Test Case 1: Space is allocated a segment at a time, ahead of the records ---
+	wal.WriteCommand(map[string]int{"n": 1})
+	wal.WriteCommand(map[string]int{"n": 2})
+	size, _ := wal.Size()
+	info, _ := os.Stat(path)
+	if size != int64(len(`{"n":1}`+"\n")*2) || info.Size() != segment {
+		t.Errorf("expected 16 bytes of records in a %d-byte file, but got %d in %d", segment, size, info.Size())
+	}
+	if got := replay(); len(got) != 2 || got[1] != `{"n":2}` {
+		t.Errorf("expected both records and nothing after them, but got %q", got)
+	}
+
+	// --- Test Case 2: A reopened WAL writes after its records, not the file ---
+	wal.Close()
+	if wal, err = NewPipelinedWAL(path, nil, 16, WithSegmentBytes(segment)); err != nil {
+		t.Fatalf("failed to reopen WAL: %v", err)
+	}
+	wal.WriteCommand(map[string]int{"n": 3})
+	wal.WriteCommand(map[string]string{"big": strings.Repeat("x", segment)})
+	info, _ = os.Stat(path)
+	if got := replay(); len(got) != 4 || got[2] != `{"n":3}` || info.Size() != 2*segment {
+		t.Errorf("expected 4 records in 2 segments, but got %d in %d bytes", len(got), info.Size())
+	}
+
+	// --- Test Case 3: Compaction keeps the retired file and reuses its space ---
+	compact := func(n int) {
+		cut, _ := wal.Size()
+		wal.WriteCommand(map[string]int{"tail": n})
+		if _, _, err := wal.Compact(cut, func(emit func(cmd interface{}) error) error {
+			return emit(map[string]int{"base": n})
+		}); err != nil {
+			t.Fatalf("failed to compact: %v", err)
+		}
+	}
+	compact(1)
+	retired, err := os.Stat(path + ".recycle")
+	if err != nil {
+		t.Fatalf("expected the retired WAL to be kept, but got %v", err)
+	}
+	compact(2)
+	if info, _ = os.Stat(path); !os.SameFile(info, retired) {
+		t.Error("expected the second compaction to reuse the retired WAL")
+	}
+	if got := replay(); len(got) != 2 || got[0] != `{"base":2}` || got[1] != `{"tail":2}` {
+		t.Errorf("expected only the compacted records, but got %q", got)
+	}
+
+	// --- Test Case 4: A retired file still linked to the WAL is not reused ---
+	wal.Close()
+	os.Remove(path + ".recycle")
+	os.Link(path, path+".recycle")
+	if wal, err = NewPipelinedWAL(path, nil, 16, WithSegmentBytes(segment)); err != nil {
+		t.Fatalf("failed to reopen WAL: %v", err)
+	}
+	defer wal.Close()
+	compact(3)
+	if got := replay(); len(got) != 2 || got[0] != `{"base":3}` || got[1] != `{"tail":3}` {
+		t.Errorf("expected only the compacted records, but got %q", got)
+	}
+}
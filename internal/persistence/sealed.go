@@ -0,0 +1,110 @@
+package persistence
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// sealedChunkSize is the most plaintext each line of a sealed stream holds.
+const sealedChunkSize = 1 << 20
+
+// IsSealed reports whether data begins like a stream written by a
+// SealWriter, or a record sealed by Keyring.Seal.
+func IsSealed(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedRecordPrefix)
+}
+
+// SealWriter encrypts a stream too large to seal at once, such as a
+// snapshot, as lines sealed with a Keyring's active key, each holding up to
+// 1 MiB of plaintext. Close ends the stream with an empty sealed line, so
+// that a reader can tell a complete stream from a truncated one.
+type SealWriter struct {
+	w   io.Writer
+	k   *Keyring
+	buf []byte
+}
+
+// NewSealWriter returns a SealWriter that writes to w with k, which must
+// not be nil.
+func NewSealWriter(w io.Writer, k *Keyring) *SealWriter {
+	return &SealWriter{w: w, k: k}
+}
+
+// Write encrypts p, writing out each full chunk.
+func (s *SealWriter) Write(p []byte) (int, error) {
+	s.buf = append(s.buf, p...)
+	for len(s.buf) >= sealedChunkSize {
+		if err := s.seal(s.buf[:sealedChunkSize]); err != nil {
+			return 0, err
+		}
+		s.buf = s.buf[sealedChunkSize:]
+	}
+	return len(p), nil
+}
+
+// Close writes out the last chunk and the end of the stream. It does not
+// close the underlying writer.
+func (s *SealWriter) Close() error {
+	if len(s.buf) > 0 {
+		if err := s.seal(s.buf); err != nil {
+			return err
+		}
+		s.buf = nil
+	}
+	return s.seal(nil)
+}
+
+func (s *SealWriter) seal(chunk []byte) error {
+	line, err := s.k.Seal(chunk)
+	if err != nil {
+		return err
+	}
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
+
+// ErrTruncatedStream is returned when a sealed stream ends before its end
+// marker.
+var ErrTruncatedStream = errors.New("sealed stream is truncated")
+
+// OpenReader decrypts a stream written by a SealWriter.
+type OpenReader struct {
+	r    *bufio.Reader
+	k    *Keyring
+	buf  []byte
+	done bool
+}
+
+// NewOpenReader returns an OpenReader that reads from r with k.
+func NewOpenReader(r io.Reader, k *Keyring) *OpenReader {
+	return &OpenReader{r: bufio.NewReader(r), k: k}
+}
+
+// Read returns decrypted data. Every line must be sealed; plaintext is
+// refused, so that it can't be slipped into an encrypted stream.
+func (o *OpenReader) Read(p []byte) (int, error) {
+	for len(o.buf) == 0 {
+		if o.done {
+			return 0, io.EOF
+		}
+		line, err := o.r.ReadBytes('\n')
+		if len(line) == 0 && err == io.EOF {
+			return 0, ErrTruncatedStream
+		} else if err != nil && err != io.EOF {
+			return 0, err
+		}
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		if !IsSealed(line) {
+			return 0, errors.New("sealed stream holds a plaintext line")
+		}
+		if o.buf, err = o.k.Open(line); err != nil {
+			return 0, err
+		}
+		o.done = len(o.buf) == 0
+	}
+	n := copy(p, o.buf)
+	o.buf = o.buf[n:]
+	return n, nil
+}
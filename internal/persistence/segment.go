@@ -0,0 +1,177 @@
+package persistence
+
+import (
+	"io"
+	"os"
+)
+
+// DefaultSegmentBytes is a good size for WithSegmentBytes: large enough that
+// the WAL's space is seldom allocated, and small enough to waste little.
+const DefaultSegmentBytes = 64 << 20
+
+// recycledSegments bounds how much of the WAL retired by a compaction is
+// kept, in segments, to be reused by the next one.
+const recycledSegments = 4
+
+// zeroChunk is the most zeros written at once where they cannot be
+// allocated instead.
+const zeroChunk = 1 << 20
+
+// Option configures a WAL.
+type Option func(*WAL)
+
+// WithSegmentBytes allocates the WAL's space n bytes at a time, ahead of
+// the records written into it, instead of growing the file with every
+// write. Records then land in space the file already has, so syncing them
+// need not update the file's metadata as well. The file retired by a
+// compaction is kept, zeroed, as the next compaction's target, so its space
+// is reused rather than freed and allocated again. 0 grows the file as
+// records are written.
+func WithSegmentBytes(n int64) Option {
+	return func(w *WAL) {
+		if n > 0 {
+			w.segmentBytes = n
+		}
+	}
+}
+
+// walFile is an open WAL file. Records are written at its end, which may
+// come before the end of the file: space allocated ahead of the records is
+// zero, and a zero byte where a record would start ends the WAL.
+type walFile struct {
+	f            *os.File
+	end          int64 // Where the next record goes
+	allocated    int64 // Size of the file
+	segmentBytes int64 // Space is allocated in steps of this size; 0 grows the file as written
+}
+
+// openWALFile opens or creates the WAL file at path and finds the end of
+// its records.
+func openWALFile(path string, segmentBytes int64) (*walFile, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	end, err := recordsEnd(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &walFile{f: f, end: end, allocated: info.Size(), segmentBytes: segmentBytes}, nil
+}
+
+// recordsEnd returns the offset just past the last byte of f, of size
+// bytes, that is not zero.
+func recordsEnd(f *os.File, size int64) (int64, error) {
+	buf := make([]byte, zeroChunk)
+	for size > 0 {
+		n := min(size, int64(len(buf)))
+		chunk := buf[:n]
+		if _, err := f.ReadAt(chunk, size-n); err != nil && err != io.EOF {
+			return 0, err
+		}
+		for i := len(chunk) - 1; i >= 0; i-- {
+			if chunk[i] != 0 {
+				return size - n + int64(i) + 1, nil
+			}
+		}
+		size -= n
+	}
+	return 0, nil
+}
+
+// write writes data at the end of the records, first allocating the
+// segments it reaches into.
+func (wf *walFile) write(data []byte) error {
+	if need := wf.end + int64(len(data)); wf.segmentBytes > 0 && need > wf.allocated {
+		size := (need + wf.segmentBytes - 1) / wf.segmentBytes * wf.segmentBytes
+		if err := preallocate(wf.f, wf.allocated, size-wf.allocated); err != nil {
+			return err
+		}
+		wf.allocated = size
+	}
+	n, err := wf.f.WriteAt(data, wf.end)
+	wf.end += int64(n)
+	if wf.end > wf.allocated {
+		wf.allocated = wf.end
+	}
+	return err
+}
+
+// writeZeros overwrites n bytes of f from off with zeros.
+func writeZeros(f *os.File, off, n int64) error {
+	zeros := make([]byte, min(n, zeroChunk))
+	for n > 0 {
+		chunk := zeros[:min(n, int64(len(zeros)))]
+		if _, err := f.WriteAt(chunk, off); err != nil {
+			return err
+		}
+		off += int64(len(chunk))
+		n -= int64(len(chunk))
+	}
+	return nil
+}
+
+// recyclePath is where the WAL file retired by a compaction is kept.
+func (w *WAL) recyclePath() string {
+	return w.path + ".recycle"
+}
+
+// retire keeps the WAL file, which a compaction is about to replace, as the
+// next compaction's target. It must be called before the replacement is
+// renamed over it.
+func (w *WAL) retire() {
+	if w.segmentBytes <= 0 {
+		return
+	}
+	os.Remove(w.recyclePath())
+	os.Link(w.path, w.recyclePath())
+}
+
+// trimRetired frees all but a few segments of the retired WAL file.
+func (w *WAL) trimRetired() {
+	info, err := os.Stat(w.recyclePath())
+	if err != nil {
+		return
+	}
+	if keep := recycledSegments * w.segmentBytes; info.Size() > keep {
+		os.Truncate(w.recyclePath(), keep)
+	}
+}
+
+// reuseRetired moves the WAL file retired by the last compaction to path
+// and opens it, zeroed, to write the next compacted WAL into. It returns
+// nil if there is none.
+func (w *WAL) reuseRetired(path string) *walFile {
+	if w.segmentBytes <= 0 {
+		return nil
+	}
+	info, err := os.Stat(w.recyclePath())
+	if err != nil {
+		return nil
+	}
+	// A crash during the last compaction may have left it linked to the
+	// live WAL.
+	if live, err := w.file.f.Stat(); err != nil || os.SameFile(info, live) {
+		os.Remove(w.recyclePath())
+		return nil
+	}
+	if err := os.Rename(w.recyclePath(), path); err != nil {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return nil
+	}
+	size := min(info.Size(), recycledSegments*w.segmentBytes)
+	if f.Truncate(size) != nil || zeroRange(f, 0, size) != nil {
+		f.Close()
+		return nil
+	}
+	return &walFile{f: f, allocated: size, segmentBytes: w.segmentBytes}
+}
@@ -1,55 +1,89 @@
 package persistence
 
 import(
-	"bufio"
 	"encoding/json"
-	"os"
+	"sync"
+
+	"github.com/ASHISH26940/heliosdb/internal/failpoint"
 )
 
 type WAL struct{
-	file *os.File
+	path   string
+	mu     sync.Mutex // Serializes synchronous appends with Compact
+	file   *walFile
+	keys   *Keyring
+	segmentBytes int64 // Space is allocated this many bytes at a time; 0 grows the file as written
+
+	pipe   *pipeline // Non-nil when writes are persisted asynchronously
 }
 
 func NewWAL(path string) (*WAL , error){
-	file,err:=os.OpenFile(path,os.O_APPEND|os.O_CREATE|os.O_WRONLY,0644)
+	return NewEncryptedWAL(path,nil)
+}
+
+// NewEncryptedWAL opens the WAL at path and seals every record written with
+// the active key in k. A nil keyring writes plaintext records.
+func NewEncryptedWAL(path string,k *Keyring,opts ...Option) (*WAL,error){
+	w:=&WAL{
+		path:   path,
+		keys:   k,
+	}
+	for _,opt:=range opts{
+		opt(w)
+	}
+	file,err:=openWALFile(path,w.segmentBytes)
 	if err!=nil{
 		return nil,err
 	}
-	return &WAL{
-		file: file,
-	},nil
+	w.file=file
+	return w,nil
 }
 
+// WriteCommand appends cmd to the WAL and returns once it is on disk.
 func (w *WAL) WriteCommand(cmd interface{})error{
-	data,err:=json.Marshal(cmd)
+	seq,err:=w.Append(cmd)
 	if err!=nil{
 		return err
 	}
-	if _,err:=w.file.Write(append(data,'\n'));err!=nil{
-		return err
-	}
-	return w.file.Sync()
+	return w.Wait(seq)
 }
 
-func (w *WAL) Close() error{
-	return w.file.Close()
+// encode marshals and seals cmd into one newline-terminated record.
+func (w *WAL) encode(cmd interface{}) ([]byte,error){
+	data,err:=json.Marshal(cmd)
+	if err!=nil{
+		return nil,err
+	}
+	data,err=w.keys.Seal(data)
+	if err!=nil{
+		return nil,err
+	}
+	return append(data,'\n'),nil
 }
 
-func Replay(path string,applyFunc func(cmdBytes []byte) error) error{
-	file,err:=os.Open(path)
-	if err!=nil{
-		if os.IsNotExist(err){
-			return nil
-		}
+// sync flushes the WAL file to disk.
+func (w *WAL) sync() error{
+	if err:=failpoint.Inject(failpoint.WALFsync);err!=nil{
 		return err
 	}
-	defer file.Close()
+	return datasync(w.file.f)
+}
 
-	scanner:=bufio.NewScanner(file)
-	for scanner.Scan(){
-		if err:=applyFunc(scanner.Bytes());err!=nil{
-			return err
-		}
+// Close flushes any pending records and closes the WAL file.
+func (w *WAL) Close() error{
+	var err error
+	if w.pipe!=nil{
+		err=w.pipe.close()
+	}
+	if cerr:=w.file.f.Close();err==nil{
+		err=cerr
 	}
-	return scanner.Err()
-}
\ No newline at end of file
+	return err
+}
+
+// Replay calls applyFunc for every record in the WAL at path, in order,
+// logging progress as it goes. Encrypted records are opened with k.
+// A missing WAL is treated as empty.
+func Replay(path string,k *Keyring,applyFunc func(cmdBytes []byte) error) error{
+	return scanWAL(path,k,applyFunc)
+}
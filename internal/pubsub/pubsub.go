@@ -0,0 +1,124 @@
+// Package pubsub routes fire-and-forget messages between clients. Messages
+// are delivered to the subscribers connected at the time and are neither
+// replicated nor stored, so a subscriber that is not listening misses them.
+package pubsub
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// subscriberBuffer is how many messages a subscriber may fall behind by
+// before it is cancelled.
+const subscriberBuffer = 256
+
+// ErrFellBehind is reported by a subscription that was cancelled because
+// it did not keep up.
+var ErrFellBehind = errors.New("pubsub: subscriber fell behind")
+
+// Message is a message published to a channel.
+type Message struct {
+	Channel string
+	Payload string
+	Time    time.Time // When the broker received it
+}
+
+// Broker delivers each published message to the current subscribers of its
+// channel.
+type Broker struct {
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+// NewBroker returns a Broker with no subscribers.
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[*Subscription]struct{})}
+}
+
+// Publish sends payload to the subscribers of channel and returns how many
+// there were. Subscribers whose buffer is full are cancelled with
+// ErrFellBehind rather than holding up the publisher.
+func (b *Broker) Publish(channel, payload string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	m := Message{Channel: channel, Payload: payload, Time: time.Now()}
+	n := 0
+	for s := range b.subs {
+		if !s.matches(channel) {
+			continue
+		}
+		select {
+		case s.ch <- m:
+			n++
+		default:
+			b.cancel(s, ErrFellBehind)
+		}
+	}
+	return n
+}
+
+// Subscribe starts receiving the messages published to channel, or to
+// every channel starting with channel if prefix is set.
+func (b *Broker) Subscribe(channel string, prefix bool) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := &Subscription{channel: channel, prefix: prefix, broker: b, ch: make(chan Message, subscriberBuffer)}
+	b.subs[s] = struct{}{}
+	return s
+}
+
+// Subscribers returns the number of subscriptions.
+func (b *Broker) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+// cancel stops delivering to s, closing its channel with err. The caller
+// must hold b.mu.
+func (b *Broker) cancel(s *Subscription, err error) {
+	if _, ok := b.subs[s]; !ok {
+		return
+	}
+	delete(b.subs, s)
+	s.err = err
+	close(s.ch)
+}
+
+// Subscription receives the messages published to a channel or prefix.
+type Subscription struct {
+	channel string
+	prefix  bool
+	broker  *Broker
+	ch      chan Message
+	err     error // Set before ch is closed
+}
+
+// Messages returns the channel messages are delivered on, in the order they
+// were published. It is closed when the subscription is cancelled; Err then
+// says why.
+func (s *Subscription) Messages() <-chan Message {
+	return s.ch
+}
+
+// Err returns why Messages was closed: ErrFellBehind, or nil after Close.
+func (s *Subscription) Err() error {
+	return s.err
+}
+
+// Close ends the subscription.
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.cancel(s, nil)
+}
+
+// matches reports whether s wants the messages of channel.
+func (s *Subscription) matches(channel string) bool {
+	if s.prefix {
+		return strings.HasPrefix(channel, s.channel)
+	}
+	return channel == s.channel
+}
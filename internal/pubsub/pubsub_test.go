@@ -0,0 +1,51 @@
+// Package pubsub_test contains the unit tests for the pubsub package.
+package pubsub
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBroker(t *testing.T) {
+	b := NewBroker()
+	exact := b.Subscribe("jobs/ready", false)
+	all := b.Subscribe("jobs/", true)
+
+	// --- Test Case 1: Messages reach the channel's current subscribers ---
+	if n := b.Publish("jobs/ready", "42"); n != 2 {
+		t.Errorf("expected 2 receivers, but got %d", n)
+	}
+	if n := b.Publish("jobs/done", "41"); n != 1 {
+		t.Errorf("expected 1 receiver, but got %d", n)
+	}
+	if m := <-exact.Messages(); m.Channel != "jobs/ready" || m.Payload != "42" {
+		t.Errorf("expected 42 on jobs/ready, but got %+v", m)
+	}
+	if len(exact.Messages()) != 0 {
+		t.Errorf("expected nothing else on jobs/ready, but got %d messages", len(exact.Messages()))
+	}
+	if len(all.Messages()) != 2 {
+		t.Errorf("expected both messages under jobs/, but got %d", len(all.Messages()))
+	}
+
+	// --- Test Case 2: Messages are not kept for later subscribers ---
+	exact.Close()
+	late := b.Subscribe("jobs/ready", false)
+	defer late.Close()
+	if len(late.Messages()) != 0 {
+		t.Errorf("expected no earlier messages, but got %d", len(late.Messages()))
+	}
+	if n := b.Subscribers(); n != 2 {
+		t.Errorf("expected 2 subscribers, but got %d", n)
+	}
+
+	// --- Test Case 3: A subscriber that falls behind is cancelled ---
+	for range subscriberBuffer {
+		b.Publish("jobs/x", "")
+	}
+	for range all.Messages() {
+	}
+	if !errors.Is(all.Err(), ErrFellBehind) {
+		t.Errorf("expected ErrFellBehind, but got %v", all.Err())
+	}
+}
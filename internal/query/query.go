@@ -0,0 +1,403 @@
+// Package query parses a small SQL dialect over the key-value store, for
+// ad-hoc debugging and BI tools:
+//
+//	SELECT key, value, version, value.address.city
+//	FROM kv
+//	WHERE key LIKE 'users/%' AND value.age >= 30
+//	LIMIT 100
+//
+// The only table is kv. Columns are key, value, version, value.<path> for
+// a field of a JSON value, or *. Conditions compare a column with a literal
+// using =, !=, <>, <, <=, >, >= or LIKE (with % and _ wildcards), joined by
+// AND. A key LIKE condition with a literal prefix limits the scan to that
+// prefix. Every query is a scan; there are no indexes.
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/ASHISH26940/heliosdb/internal/filter"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+)
+
+// Table is the name of the only table, holding every key.
+const Table = "kv"
+
+// Query is a parsed SELECT.
+type Query struct {
+	Columns []string      // Column names, in order
+	Prefix  string        // Only keys starting with Prefix can match
+	Filter  filter.Filter // Keys must also match the filter
+	Limit   int           // At most this many rows; 0 means no limit
+}
+
+// Row returns the values of q's columns for a matching key: strings for key
+// and value, a number for version, and the decoded field, or nil if it is
+// missing, for value.<path>.
+func (q *Query) Row(key string, v store.VersionedValue) []interface{} {
+	row := make([]interface{}, len(q.Columns))
+	for i, col := range q.Columns {
+		row[i], _ = column(col, key, v)
+	}
+	return row
+}
+
+// column returns the value of col for a key, and whether it has one.
+func column(col, key string, v store.VersionedValue) (interface{}, bool) {
+	switch col {
+	case "key":
+		return key, true
+	case "value":
+		return v.Value, true
+	case "version":
+		return float64(v.Version), true
+	}
+	return filter.Field(v.Value, strings.TrimPrefix(col, "value."))
+}
+
+// Parse parses a SELECT statement.
+func Parse(src string) (*Query, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	return p.query()
+}
+
+// token is a lexical token: a keyword or identifier, a quoted string, a
+// number or an operator.
+type token struct {
+	kind string // "ident", "string", "number" or "op"
+	text string
+}
+
+// tokenize splits src into tokens.
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '\'':
+			var b strings.Builder
+			for i++; ; i++ {
+				if i == len(src) {
+					return nil, fmt.Errorf("unterminated string")
+				}
+				if src[i] == '\'' {
+					if i+1 < len(src) && src[i+1] == '\'' {
+						b.WriteByte('\'')
+						i++
+						continue
+					}
+					i++
+					break
+				}
+				b.WriteByte(src[i])
+			}
+			tokens = append(tokens, token{"string", b.String()})
+		case c == '-' || unicode.IsDigit(c):
+			j := i + 1
+			for j < len(src) && (unicode.IsDigit(rune(src[j])) || src[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{"number", src[i:j]})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i + 1
+			for j < len(src) && (unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j])) || src[j] == '_' || src[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{"ident", src[i:j]})
+			i = j
+		case strings.ContainsRune("*,=;", c):
+			tokens = append(tokens, token{"op", string(c)})
+			i++
+		case strings.ContainsRune("<>!", c):
+			j := i + 1
+			if j < len(src) && (src[j] == '=' || (c == '<' && src[j] == '>')) {
+				j++
+			}
+			if src[i:j] == "!" {
+				return nil, fmt.Errorf("unexpected %q", "!")
+			}
+			tokens = append(tokens, token{"op", src[i:j]})
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected %q", c)
+		}
+	}
+	return tokens, nil
+}
+
+// parser consumes tokens.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	if p.pos == len(p.tokens) {
+		return token{}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+	return t
+}
+
+// keyword consumes the keyword kw, case-insensitively, if it is next.
+func (p *parser) keyword(kw string) bool {
+	if t := p.peek(); t.kind == "ident" && strings.EqualFold(t.text, kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// expect consumes the keyword kw or fails.
+func (p *parser) expect(kw string) error {
+	if !p.keyword(kw) {
+		return fmt.Errorf("expected %s, got %s", kw, describe(p.peek()))
+	}
+	return nil
+}
+
+func describe(t token) string {
+	if t.kind == "" {
+		return "end of query"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// query parses SELECT columns [FROM kv] [WHERE conditions] [LIMIT n] [;].
+func (p *parser) query() (*Query, error) {
+	if err := p.expect("SELECT"); err != nil {
+		return nil, err
+	}
+	q := &Query{}
+	for {
+		t := p.next()
+		switch {
+		case t.kind == "op" && t.text == "*":
+			q.Columns = append(q.Columns, "key", "value", "version")
+		case t.kind == "ident":
+			name, ok := columnName(t.text)
+			if !ok {
+				return nil, fmt.Errorf("unknown column %q", t.text)
+			}
+			q.Columns = append(q.Columns, name)
+		default:
+			return nil, fmt.Errorf("expected a column, got %s", describe(t))
+		}
+		if p.peek() != (token{"op", ","}) {
+			break
+		}
+		p.next()
+	}
+	if p.keyword("FROM") {
+		if t := p.next(); t.kind != "ident" || !strings.EqualFold(t.text, Table) {
+			return nil, fmt.Errorf("unknown table %s; the only table is %s", describe(t), Table)
+		}
+	}
+	if p.keyword("WHERE") {
+		for {
+			if err := p.condition(q); err != nil {
+				return nil, err
+			}
+			if !p.keyword("AND") {
+				break
+			}
+		}
+	}
+	if p.keyword("LIMIT") {
+		t := p.next()
+		n, err := strconv.Atoi(t.text)
+		if t.kind != "number" || err != nil || n < 0 {
+			return nil, fmt.Errorf("expected a row count after LIMIT, got %s", describe(t))
+		}
+		q.Limit = n
+	}
+	if p.peek() == (token{"op", ";"}) {
+		p.next()
+	}
+	if t := p.peek(); t.kind != "" {
+		return nil, fmt.Errorf("unexpected %s", describe(t))
+	}
+	return q, nil
+}
+
+// columnName returns the column an identifier names: key, value, version
+// or value.<path>, with keywords lower-cased and the path kept as is.
+func columnName(ident string) (string, bool) {
+	lower := strings.ToLower(ident)
+	switch lower {
+	case "key", "value", "version":
+		return lower, true
+	}
+	if !strings.HasPrefix(lower, "value.") {
+		return "", false
+	}
+	path := ident[len("value."):]
+	if slices.Contains(strings.Split(path, "."), "") {
+		return "", false
+	}
+	return "value." + path, true
+}
+
+// condition parses one comparison and adds it to q.
+func (p *parser) condition(q *Query) error {
+	col := p.next()
+	name, ok := columnName(col.text)
+	if col.kind != "ident" || !ok {
+		return fmt.Errorf("expected a column, got %s", describe(col))
+	}
+	var op string
+	if p.keyword("LIKE") {
+		op = "LIKE"
+	} else if t := p.next(); t.kind == "op" && t.text != "*" && t.text != "," && t.text != ";" {
+		op = t.text
+	} else {
+		return fmt.Errorf("expected a comparison after %s, got %s", name, describe(t))
+	}
+	lit := p.next()
+	if lit.kind != "string" && lit.kind != "number" && !(lit.kind == "ident" && isConstant(lit.text)) {
+		return fmt.Errorf("expected a literal after %s %s, got %s", name, op, describe(lit))
+	}
+	if op == "LIKE" {
+		if lit.kind != "string" {
+			return fmt.Errorf("LIKE needs a quoted pattern")
+		}
+		re := likePattern(lit.text)
+		if name == "key" {
+			if i := strings.IndexAny(lit.text, "%_"); i != 0 {
+				prefix := lit.text
+				if i > 0 {
+					prefix = lit.text[:i]
+				}
+				q.narrow(prefix)
+			}
+		}
+		q.Filter = append(q.Filter, func(key string, v store.VersionedValue) bool {
+			got, ok := column(name, key, v)
+			return ok && re.MatchString(filter.Format(got))
+		})
+		return nil
+	}
+	want := lit.text
+	if lit.kind == "ident" {
+		want = strings.ToLower(want)
+	}
+	if name == "key" && op == "=" {
+		q.narrow(want)
+	}
+	compare, err := comparison(op, want, lit.kind == "number")
+	if err != nil {
+		return err
+	}
+	q.Filter = append(q.Filter, func(key string, v store.VersionedValue) bool {
+		got, ok := column(name, key, v)
+		return ok && compare(got)
+	})
+	return nil
+}
+
+// narrow limits the scan to keys starting with prefix as well.
+// If no key can start with both prefixes, the conditions that set them
+// already exclude every key, so the scan is merely wasted.
+func (q *Query) narrow(prefix string) {
+	if strings.HasPrefix(prefix, q.Prefix) {
+		q.Prefix = prefix
+	}
+}
+
+// isConstant reports whether an identifier is a JSON constant literal.
+func isConstant(s string) bool {
+	switch strings.ToLower(s) {
+	case "true", "false", "null":
+		return true
+	}
+	return false
+}
+
+// comparison returns a function that compares a column's value with want.
+// Number literals compare numerically, with numbers or strings that parse
+// as one, and anything else by its text, as formatted by filter.Format.
+func comparison(op, want string, numeric bool) (func(got interface{}) bool, error) {
+	var wantN float64
+	if numeric {
+		var err error
+		if wantN, err = strconv.ParseFloat(want, 64); err != nil {
+			return nil, fmt.Errorf("invalid number %q", want)
+		}
+	}
+	var holds func(c int) bool
+	switch op {
+	case "=":
+		holds = func(c int) bool { return c == 0 }
+	case "!=", "<>":
+		holds = func(c int) bool { return c != 0 }
+	case "<":
+		holds = func(c int) bool { return c < 0 }
+	case "<=":
+		holds = func(c int) bool { return c <= 0 }
+	case ">":
+		holds = func(c int) bool { return c > 0 }
+	case ">=":
+		holds = func(c int) bool { return c >= 0 }
+	default:
+		return nil, fmt.Errorf("unknown operator %q", op)
+	}
+	return func(got interface{}) bool {
+		if numeric {
+			n, ok := got.(float64)
+			if s, isString := got.(string); isString {
+				var err error
+				n, err = strconv.ParseFloat(strings.TrimSpace(s), 64)
+				ok = err == nil
+			}
+			if !ok {
+				return false
+			}
+			switch {
+			case n < wantN:
+				return holds(-1)
+			case n > wantN:
+				return holds(1)
+			}
+			return holds(0)
+		}
+		return holds(strings.Compare(filter.Format(got), want))
+	}, nil
+}
+
+// likePattern compiles a LIKE pattern, in which % matches any run of
+// characters and _ any one character, to a regular expression.
+func likePattern(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?s)^")
+	for _, c := range pattern {
+		switch c {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
@@ -0,0 +1,89 @@
+// Package query_test contains the unit tests for the query package.
+package query
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ASHISH26940/heliosdb/internal/store"
+)
+
+func TestParse(t *testing.T) {
+	rows := map[string]store.VersionedValue{
+		"users/1":  {Value: `{"name":"alice","age":30,"address":{"city":"Paris"}}`, Version: 1},
+		"users/2":  {Value: `{"name":"bob","age":25,"address":{"city":"Berlin"}}`, Version: 4},
+		"users/3":  {Value: `{"name":"o'hara","age":41}`, Version: 2},
+		"counters": {Value: "12", Version: 12},
+	}
+	keys := []string{"counters", "users/1", "users/2", "users/3"}
+	run := func(src string) ([]string, *Query) {
+		t.Helper()
+		q, err := Parse(src)
+		if err != nil {
+			t.Fatalf("expected %q to parse, but got %v", src, err)
+		}
+		var matched []string
+		for _, k := range keys {
+			if len(k) >= len(q.Prefix) && k[:len(q.Prefix)] == q.Prefix && q.Filter.Match(k, rows[k]) {
+				matched = append(matched, k)
+			}
+		}
+		return matched, q
+	}
+
+	// --- Test Case 1: Columns, including * and JSON fields ---
+	_, q := run("select key, VALUE.address.city, version from KV")
+	if want := []string{"key", "value.address.city", "version"}; !reflect.DeepEqual(q.Columns, want) {
+		t.Errorf("expected columns %v, but got %v", want, q.Columns)
+	}
+	if row := q.Row("users/1", rows["users/1"]); !reflect.DeepEqual(row, []interface{}{"users/1", "Paris", float64(1)}) {
+		t.Errorf("expected the row of users/1, but got %v", row)
+	}
+	if row := q.Row("users/3", rows["users/3"]); row[1] != nil {
+		t.Errorf("expected a missing field to be nil, but got %v", row[1])
+	}
+	if _, q := run("SELECT * LIMIT 2;"); len(q.Columns) != 3 || q.Limit != 2 {
+		t.Errorf("expected * to select three columns with a limit of 2, but got %+v", q)
+	}
+
+	// --- Test Case 2: Conditions filter keys, and key LIKE narrows the scan ---
+	tests := []struct {
+		src    string
+		prefix string
+		want   []string
+	}{
+		{"SELECT key WHERE key LIKE 'users/%'", "users/", []string{"users/1", "users/2", "users/3"}},
+		{"SELECT key WHERE key LIKE 'users/%' AND value.age >= 30", "users/", []string{"users/1", "users/3"}},
+		{"SELECT key WHERE value.address.city = 'Paris'", "", []string{"users/1"}},
+		{"SELECT key WHERE value.name <> 'alice' AND key LIKE 'users/_'", "users/", []string{"users/2", "users/3"}},
+		{"SELECT key WHERE value.name = 'o''hara'", "", []string{"users/3"}},
+		{"SELECT key WHERE value LIKE '%Berlin%'", "", []string{"users/2"}},
+		{"SELECT key WHERE value > 10 AND version = 12", "", []string{"counters"}},
+		{"SELECT key WHERE key = 'users/2'", "users/2", []string{"users/2"}},
+		{"SELECT key WHERE key LIKE '%/1'", "", []string{"users/1"}},
+	}
+	for _, tc := range tests {
+		got, q := run(tc.src)
+		if !reflect.DeepEqual(got, tc.want) || q.Prefix != tc.prefix {
+			t.Errorf("expected %q to match %v under %q, but got %v under %q", tc.src, tc.want, tc.prefix, got, q.Prefix)
+		}
+	}
+
+	// --- Test Case 3: Anything outside the dialect is refused ---
+	for _, src := range []string{
+		"",
+		"DELETE FROM kv",
+		"SELECT name",
+		"SELECT key FROM users",
+		"SELECT key WHERE key LIKE 5",
+		"SELECT key WHERE value.age ! 3",
+		"SELECT key WHERE value..age = 3",
+		"SELECT key WHERE key = 'a' OR key = 'b'",
+		"SELECT key LIMIT -1",
+		"SELECT key WHERE key = 'unterminated",
+	} {
+		if _, err := Parse(src); err == nil {
+			t.Errorf("expected %q to be refused, but it parsed", src)
+		}
+	}
+}
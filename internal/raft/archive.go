@@ -0,0 +1,425 @@
+package raft
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ASHISH26940/heliosdb/internal/persistence"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+	"github.com/hashicorp/raft"
+)
+
+// archivePrefix and archiveSuffix frame the log index in an archive's file
+// name, which is zero-padded so that names sort by index. An incremental
+// archive's name also carries the index of the archive it builds on:
+// archive-<index>-from-<base>.snap.
+const (
+	archivePrefix = "archive-"
+	archiveSuffix = ".snap"
+	archiveFrom   = "-from-"
+)
+
+// Archiver keeps copies of the store, taken at ARCHIVE markers, as files in
+// a directory, apart from the snapshots Raft takes and discards on its own.
+// Every replica writes its archive at the same log position, so any node's
+// archive of a marker holds the same data.
+//
+// Archives may be incremental: each then holds only the keys that changed
+// since the archive before it, down to a full baseline. Raft's own
+// snapshots are always full, since a follower must be able to restore one
+// on its own.
+type Archiver struct {
+	dir       string
+	retain    int
+	fullEvery int
+
+	mu      sync.Mutex // Serializes writing, pruning and loading
+	pending sync.WaitGroup
+	last    chan struct{} // Closed when the newest archive queued is written
+
+	// Guarded by mu: what the newest archive written holds, so that the next
+	// one can record only what changed. prev is nil until a full archive is
+	// written by this process.
+	prev      map[string]archivedKey
+	prevIndex uint64
+	sinceFull int
+}
+
+// archivedKey is what an archive recorded for a key: its version, and
+// whether that was a tombstone.
+type archivedKey struct {
+	version uint64
+	deleted bool
+}
+
+// ArchiveOption configures an Archiver.
+type ArchiveOption func(*Archiver)
+
+// WithFullEvery makes every nth archive a full baseline and those between
+// incremental. An n of 1 or less makes every archive full, the default.
+func WithFullEvery(n int) ArchiveOption {
+	return func(a *Archiver) {
+		a.fullEvery = n
+	}
+}
+
+// NewArchiver returns an Archiver that writes to dir and keeps the newest
+// retain archives, along with the older ones they build on; a retain of 0 or
+// less keeps them all.
+func NewArchiver(dir string, retain int, opts ...ArchiveOption) *Archiver {
+	a := &Archiver{dir: dir, retain: retain}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Archive is an archive file in an Archiver's directory.
+type Archive struct {
+	Path  string
+	Index uint64 // Log index of the ARCHIVE marker it was taken at
+	Base  uint64 // Index of the archive it builds on; 0 for a full archive
+}
+
+// List returns the archives in the directory, newest first.
+func (a *Archiver) List() ([]Archive, error) {
+	entries, err := os.ReadDir(a.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var archives []Archive
+	for _, e := range entries {
+		if ar, ok := parseArchiveName(e.Name()); ok {
+			ar.Path = filepath.Join(a.dir, e.Name())
+			archives = append(archives, ar)
+		}
+	}
+	slices.SortFunc(archives, func(x, y Archive) int {
+		return cmp.Compare(y.Index, x.Index)
+	})
+	return archives, nil
+}
+
+// archiveName returns the file name of the archive at index building on
+// base, or of a full archive if base is 0.
+func archiveName(index, base uint64) string {
+	if base == 0 {
+		return fmt.Sprintf("%s%020d%s", archivePrefix, index, archiveSuffix)
+	}
+	return fmt.Sprintf("%s%020d%s%020d%s", archivePrefix, index, archiveFrom, base, archiveSuffix)
+}
+
+// parseArchiveName reverses archiveName.
+func parseArchiveName(name string) (Archive, bool) {
+	if !strings.HasPrefix(name, archivePrefix) || !strings.HasSuffix(name, archiveSuffix) {
+		return Archive{}, false
+	}
+	indexes := strings.TrimSuffix(strings.TrimPrefix(name, archivePrefix), archiveSuffix)
+	index, from, incremental := strings.Cut(indexes, archiveFrom)
+	var ar Archive
+	var err error
+	if ar.Index, err = strconv.ParseUint(index, 10, 64); err != nil {
+		return Archive{}, false
+	}
+	if incremental {
+		if ar.Base, err = strconv.ParseUint(from, 10, 64); err != nil || ar.Base >= ar.Index {
+			return Archive{}, false
+		}
+	}
+	return ar, true
+}
+
+// archive writes view, which reflects the log up to index, in the
+// background as opts says, and then prunes old archives. Archives are
+// written in the order they are queued, as each may build on the last. It
+// is called with the FSM's applyMu held.
+func (a *Archiver) archive(view *store.View, index uint64, opts SnapshotOptions) {
+	before, done := a.last, make(chan struct{})
+	a.last = done
+	a.pending.Add(1)
+	go func() {
+		defer a.pending.Done()
+		defer close(done)
+		if before != nil {
+			<-before
+		}
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		written, err := a.write(view, index, opts)
+		if err != nil {
+			log.Printf("Archive: Failed to write the archive at index %d: %v", index, err)
+			return
+		}
+		log.Printf("Archive: Wrote %d of %d keys at index %d", written, view.Len(), index)
+		if err := a.prune(); err != nil {
+			log.Printf("Archive: Failed to prune old archives: %v", err)
+		}
+	}()
+}
+
+// write writes view to a temporary file and renames it into place, so that
+// a crash never leaves a partial archive under an archive's name. The
+// archive is incremental if a baseline is at hand and not yet due again.
+// It returns the number of keys written.
+func (a *Archiver) write(view *store.View, index uint64, opts SnapshotOptions) (int, error) {
+	if err := os.MkdirAll(a.dir, 0755); err != nil {
+		return 0, err
+	}
+	var base uint64
+	if a.prev != nil && a.fullEvery > 1 && a.sinceFull+1 < a.fullEvery {
+		base = a.prevIndex
+	}
+	f, err := os.CreateTemp(a.dir, ".archive-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+
+	written := view.Len()
+	if base == 0 {
+		err = writeSnapshot(f, view, index, opts)
+	} else {
+		err = writeStream(f, opts, func(w io.Writer) error {
+			written, err = writeDeltaEntries(w, view, index, base, a.prev)
+			return err
+		})
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(a.dir, archiveName(index, base)))
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if a.fullEvery > 1 {
+		a.prev, a.prevIndex = archivedKeys(view), index
+	}
+	if base == 0 {
+		a.sinceFull = 0
+	} else {
+		a.sinceFull++
+	}
+	return written, nil
+}
+
+// archivedKeys returns what an archive of view records for each key.
+func archivedKeys(view *store.View) map[string]archivedKey {
+	keys := make(map[string]archivedKey, view.Len()+view.TombstoneCount())
+	view.Iterate(func(key string, v store.VersionedValue) bool {
+		keys[key] = archivedKey{version: v.Version}
+		return true
+	})
+	view.IterateTombstones(func(key string, t store.Tombstone) bool {
+		keys[key] = archivedKey{version: t.Version, deleted: true}
+		return true
+	})
+	return keys
+}
+
+// writeDeltaEntries writes a header naming base, then the keys and
+// tombstones of view that differ from prev, and then a Forget entry for
+// each key of prev that view no longer holds even a tombstone of. It
+// returns the number of entries written.
+func writeDeltaEntries(w io.Writer, view *store.View, index, base uint64, prev map[string]archivedKey) (int, error) {
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(snapshotEntry{Index: index, Base: base}); err != nil {
+		return 0, err
+	}
+	written := 0
+	var err error
+	seen := make(map[string]bool, len(prev))
+	view.Iterate(func(key string, v store.VersionedValue) bool {
+		seen[key] = true
+		if prev[key] != (archivedKey{version: v.Version}) {
+			err = enc.Encode(snapshotEntry{Key: key, Value: v.Value, Version: v.Version})
+			written++
+		}
+		return err == nil
+	})
+	if err != nil {
+		return written, err
+	}
+	view.IterateTombstones(func(key string, t store.Tombstone) bool {
+		seen[key] = true
+		if prev[key] != (archivedKey{version: t.Version, deleted: true}) {
+			err = enc.Encode(snapshotEntry{Key: key, Version: t.Version, Deleted: true})
+			written++
+		}
+		return err == nil
+	})
+	if err != nil {
+		return written, err
+	}
+	gone := make([]string, 0)
+	for key := range prev {
+		if !seen[key] {
+			gone = append(gone, key)
+		}
+	}
+	slices.Sort(gone)
+	for _, key := range gone {
+		if err := enc.Encode(snapshotEntry{Key: key, Forget: true}); err != nil {
+			return written, err
+		}
+		written++
+	}
+	return written, nil
+}
+
+// prune removes all but the newest retain archives and those they build on.
+func (a *Archiver) prune() error {
+	if a.retain <= 0 {
+		return nil
+	}
+	archives, err := a.List()
+	if err != nil || len(archives) <= a.retain {
+		return err
+	}
+	keep := make(map[uint64]bool)
+	for _, ar := range archives[:a.retain] {
+		keep[ar.Index] = true
+	}
+	// Archives are newest first, so each base is reached after what builds on it.
+	for _, ar := range archives {
+		if keep[ar.Index] && ar.Base != 0 {
+			keep[ar.Base] = true
+		}
+	}
+	for _, old := range archives {
+		if keep[old.Index] {
+			continue
+		}
+		if err := os.Remove(old.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load returns the keys and tombstones in the archive at index, opened with
+// k if it is encrypted. An incremental archive is applied on top of the
+// archives it builds on, back to its full baseline.
+func (a *Archiver) Load(index uint64, k *persistence.Keyring) (map[string]store.VersionedValue, map[string]store.Tombstone, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	archives, err := a.List()
+	if err != nil {
+		return nil, nil, err
+	}
+	byIndex := make(map[uint64]Archive, len(archives))
+	for _, ar := range archives {
+		byIndex[ar.Index] = ar
+	}
+	var chain []Archive
+	for i := index; ; {
+		ar, ok := byIndex[i]
+		if !ok {
+			if len(chain) == 0 {
+				return nil, nil, fmt.Errorf("no archive at index %d", index)
+			}
+			return nil, nil, fmt.Errorf("archive at index %d builds on index %d, which is missing", chain[len(chain)-1].Index, i)
+		}
+		chain = append(chain, ar)
+		if ar.Base == 0 {
+			break
+		}
+		i = ar.Base
+	}
+
+	data := make(map[string]store.VersionedValue)
+	tombstones := make(map[string]store.Tombstone)
+	for i := len(chain) - 1; i >= 0; i-- {
+		if err := applyArchive(chain[i], k, data, tombstones); err != nil {
+			return nil, nil, err
+		}
+	}
+	return data, tombstones, nil
+}
+
+// applyArchive applies the entries of an archive to data and tombstones.
+func applyArchive(ar Archive, k *persistence.Keyring, data map[string]store.VersionedValue, tombstones map[string]store.Tombstone) error {
+	f, err := os.Open(ar.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	header, err := readSnapshotEntries(f, k, func(e snapshotEntry) bool {
+		delete(data, e.Key)
+		delete(tombstones, e.Key)
+		switch {
+		case e.Forget:
+		case e.Deleted:
+			tombstones[e.Key] = store.Tombstone{Version: e.Version}
+		default:
+			data[e.Key] = store.VersionedValue{Value: e.Value, Version: e.Version}
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", ar.Path, err)
+	}
+	if header.Base != ar.Base {
+		return fmt.Errorf("%s builds on index %d, not %d as named", ar.Path, header.Base, ar.Base)
+	}
+	return nil
+}
+
+// wait blocks until the archives being written are done.
+func (a *Archiver) wait() {
+	a.pending.Wait()
+}
+
+// SetArchiver makes the FSM write an archive with a at each ARCHIVE marker.
+func (f *FSM) SetArchiver(a *Archiver) {
+	f.applyMu.Lock()
+	defer f.applyMu.Unlock()
+	f.archiver = a
+}
+
+// RunArchiveScheduler proposes an ARCHIVE marker at every multiple of every
+// since the Unix epoch, as a cron job would, while this node is the leader,
+// until stop is closed. Aligning to the clock rather than to when the node
+// started keeps the schedule steady across leadership changes. An every of
+// 0 or less disables it.
+func RunArchiveScheduler(r *raft.Raft, every time.Duration, stop <-chan struct{}) {
+	if every <= 0 {
+		return
+	}
+	for {
+		next := time.Now().Truncate(every).Add(every)
+		select {
+		case <-stop:
+			return
+		case <-time.After(time.Until(next)):
+		}
+		if r.State() != raft.Leader {
+			continue
+		}
+		data, err := json.Marshal(Command{Op: "ARCHIVE"})
+		if err != nil {
+			log.Printf("Archive: Failed to encode marker: %v", err)
+			continue
+		}
+		if err := r.Apply(data, 10*time.Second).Error(); err != nil {
+			log.Printf("Archive: Failed to propose marker: %v", err)
+		}
+	}
+}
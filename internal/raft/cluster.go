@@ -0,0 +1,264 @@
+package raft
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ASHISH26940/heliosdb/internal/store"
+	"github.com/hashicorp/raft"
+)
+
+// clusterPreamble starts every Raft connection a node dials with
+// WithClusterPreamble, followed by a length byte and the cluster ID the
+// dialer belongs to.
+var clusterPreamble = []byte("HDBC")
+
+// NewClusterID returns a random version 4 UUID.
+func NewClusterID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// ClusterID returns the ID recorded in st, or "" if the cluster has none yet.
+func ClusterID(st DataStore) string {
+	vv, _ := st.Get(store.ClusterIDKey)
+	return vv.Value
+}
+
+// AssignClusterID gives the cluster an ID, while this node is the leader,
+// if it does not have one: id if it is set, or else a new random one. It
+// returns once st holds an ID, whichever node assigned it, or stop is
+// closed. Clusters bootstrapped before IDs existed get one the same way.
+func AssignClusterID(r *raft.Raft, st DataStore, id string, stop <-chan struct{}) {
+	if id == "" {
+		id = NewClusterID()
+	}
+	for ClusterID(st) == "" {
+		select {
+		case <-stop:
+			return
+		case <-time.After(time.Second):
+		}
+		if r.State() != raft.Leader || ClusterID(st) != "" {
+			continue
+		}
+		data, err := json.Marshal(Command{Op: "CLUSTER_ID", Value: id})
+		if err != nil {
+			log.Printf("Cluster: Failed to encode ID: %v", err)
+			continue
+		}
+		if err := r.Apply(data, 10*time.Second).Error(); err != nil {
+			log.Printf("Cluster: Failed to propose ID: %v", err)
+			continue
+		}
+		log.Printf("Cluster: Assigned cluster ID %s", ClusterID(st))
+	}
+}
+
+// NodeHTTPAddr returns the advertised HTTP address of the node at the Raft
+// address raftAddr, or "" if it has not recorded one.
+func NodeHTTPAddr(st DataStore, raftAddr string) string {
+	vv, _ := st.Get(store.NodeHTTPPrefix + raftAddr)
+	return vv.Value
+}
+
+// AdvertiseHTTP records httpAddr as the advertised HTTP address of this
+// node, at the Raft address raftAddr, the first time it is the leader. It
+// returns once st holds the address, or stop is closed. Other nodes record
+// theirs when they join.
+func AdvertiseHTTP(r *raft.Raft, st DataStore, raftAddr, httpAddr string, stop <-chan struct{}) {
+	for NodeHTTPAddr(st, raftAddr) != httpAddr {
+		select {
+		case <-stop:
+			return
+		case <-time.After(time.Second):
+		}
+		if r.State() != raft.Leader || NodeHTTPAddr(st, raftAddr) == httpAddr {
+			continue
+		}
+		data, err := json.Marshal(Command{Op: "NODE_HTTP", Key: raftAddr, Value: httpAddr})
+		if err != nil {
+			log.Printf("Cluster: Failed to encode HTTP address: %v", err)
+			continue
+		}
+		if err := r.Apply(data, 10*time.Second).Error(); err != nil {
+			log.Printf("Cluster: Failed to propose HTTP address: %v", err)
+			continue
+		}
+		log.Printf("Cluster: Advertising HTTP API at %s", httpAddr)
+	}
+}
+
+// clusterStreamLayer is a TCP raft.StreamLayer whose connections carry the
+// cluster ID of the dialing node, so that a node never exchanges Raft
+// traffic with a node of another cluster, e.g. one whose address it was
+// given by mistake. A side that does not know its cluster ID yet accepts
+// any peer, as does a peer that sends no ID, such as an older version.
+//
+// Only dialers with announce set send their ID: nodes that predate it, or
+// plain raft.NewTCPTransport peers, would take the preamble for an RPC and
+// drop the connection.
+type clusterStreamLayer struct {
+	net.Listener
+	advertise net.Addr
+	id        func() string
+	announce  bool
+
+	serverTLS *tls.Config                               // nil for plaintext
+	clientTLS func(address string) (*tls.Config, error) // Set with serverTLS
+}
+
+// TransportOption configures NewClusterTransport.
+type TransportOption func(*clusterStreamLayer)
+
+// WithTransportTLS encrypts Raft traffic: connections are accepted with
+// server and dialed with the config client returns for the address dialed.
+// Both are consulted on every connection, so they may serve certificates
+// that change over time.
+func WithTransportTLS(server *tls.Config, client func(address string) (*tls.Config, error)) TransportOption {
+	return func(l *clusterStreamLayer) {
+		l.serverTLS, l.clientTLS = server, client
+	}
+}
+
+// WithClusterPreamble sends this node's cluster ID on every connection it
+// dials, so that nodes of other clusters refuse it. Every peer must accept
+// the preamble, which nodes running plain Raft transports, including older
+// versions of this one, do not; all nodes accept it without this option.
+func WithClusterPreamble() TransportOption {
+	return func(l *clusterStreamLayer) {
+		l.announce = true
+	}
+}
+
+// NewClusterTransport returns a Raft transport like raft.NewTCPTransport,
+// listening on bindAddr and advertising advertise, that checks the cluster
+// ID returned by id on every connection that carries one.
+func NewClusterTransport(bindAddr string, advertise net.Addr, id func() string, maxPool int, timeout time.Duration, logOutput io.Writer, opts ...TransportOption) (*raft.NetworkTransport, error) {
+	ln, err := net.Listen("tcp", bindAddr)
+	if err != nil {
+		return nil, err
+	}
+	if advertise == nil {
+		advertise = ln.Addr()
+	}
+	if tcp, ok := advertise.(*net.TCPAddr); !ok || tcp.IP == nil || tcp.IP.IsUnspecified() {
+		ln.Close()
+		return nil, fmt.Errorf("local bind address %s is not advertisable", advertise)
+	}
+	stream := &clusterStreamLayer{Listener: ln, advertise: advertise, id: id}
+	for _, opt := range opts {
+		opt(stream)
+	}
+	return raft.NewNetworkTransport(stream, maxPool, timeout, logOutput), nil
+}
+
+// Dial connects to address and, with WithClusterPreamble, announces this
+// node's cluster ID.
+func (l *clusterStreamLayer) Dial(address raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", string(address), timeout)
+	if err != nil {
+		return nil, err
+	}
+	if l.clientTLS != nil {
+		cfg, err := l.clientTLS(string(address))
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		tlsConn := tls.Client(conn, cfg)
+		tlsConn.SetDeadline(time.Now().Add(timeout))
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		tlsConn.SetDeadline(time.Time{})
+		conn = tlsConn
+	}
+	if !l.announce {
+		return conn, nil
+	}
+	id := l.id()
+	hello := append(append(append([]byte{}, clusterPreamble...), byte(len(id))), id...)
+	conn.SetWriteDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write(hello); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetWriteDeadline(time.Time{})
+	return conn, nil
+}
+
+// Accept returns the next connection, which checks the dialer's cluster ID
+// when it is first read from.
+func (l *clusterStreamLayer) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if l.serverTLS != nil {
+		// The handshake happens on the first read, off the accept loop.
+		conn = tls.Server(conn, l.serverTLS)
+	}
+	return &clusterConn{Conn: conn, r: bufio.NewReader(conn), id: l.id}, nil
+}
+
+// Addr returns the address other nodes dial.
+func (l *clusterStreamLayer) Addr() net.Addr {
+	return l.advertise
+}
+
+// clusterConn is an accepted connection whose first Read checks, and
+// consumes, the dialer's cluster ID.
+type clusterConn struct {
+	net.Conn
+	r    *bufio.Reader
+	id   func() string
+	once sync.Once
+	err  error
+}
+
+// Read reads from the connection once the dialer's cluster ID is checked.
+func (c *clusterConn) Read(p []byte) (int, error) {
+	c.once.Do(func() { c.err = c.checkCluster() })
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(p)
+}
+
+// checkCluster reads the dialer's preamble, if any, and fails if it names a
+// cluster other than this node's.
+func (c *clusterConn) checkCluster() error {
+	if prefix, _ := c.r.Peek(len(clusterPreamble)); !bytes.Equal(prefix, clusterPreamble) {
+		return nil
+	}
+	c.r.Discard(len(clusterPreamble))
+	n, err := c.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	theirs := make([]byte, n)
+	if _, err := io.ReadFull(c.r, theirs); err != nil {
+		return err
+	}
+	if ours := c.id(); ours != "" && len(theirs) > 0 && string(theirs) != ours {
+		err := fmt.Errorf("refusing Raft connection from %s: it belongs to cluster %s, not %s", c.RemoteAddr(), theirs, ours)
+		log.Printf("Cluster: %v", err)
+		c.Conn.Close()
+		return err
+	}
+	return nil
+}
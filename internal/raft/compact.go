@@ -0,0 +1,93 @@
+package raft
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ASHISH26940/heliosdb/internal/store"
+	"github.com/hashicorp/raft"
+)
+
+// loadChunkBytes bounds the size of each LOAD record written by CompactWAL,
+// well below persistence.MaxRecordSize.
+const loadChunkBytes = 1 << 20
+
+// CompactWAL rewrites the WAL as the current contents of the store, in LOAD
+// records, followed by whatever is appended while it runs. Replay then reads
+// each live key once instead of every write ever made. Applies are paused
+// only while the store is copied. It returns the WAL's size before and after.
+func (f *FSM) CompactWAL() (before, after int64, err error) {
+	f.compactMu.Lock()
+	defer f.compactMu.Unlock()
+
+	// Every record in the WAL up to the cut has been applied to the view.
+	f.applyMu.Lock()
+	cut, err := f.wal.Size()
+	view := f.store.SnapshotView()
+	index := f.applied
+	f.applyMu.Unlock()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return f.wal.Compact(cut, func(emit func(cmd interface{}) error) error {
+		var batch []LoadEntry
+		size := 0
+		var err error
+		view.Iterate(func(key string, value store.VersionedValue) bool {
+			batch = append(batch, LoadEntry{Key: key, Value: value.Value, Version: value.Version})
+			if size += len(key) + len(value.Value); size >= loadChunkBytes {
+				err = emit(Command{Op: "LOAD", Load: batch, Index: index})
+				batch, size = nil, 0
+			}
+			return err == nil
+		})
+		if err == nil {
+			// Tombstones follow, so replay keeps the versions of deleted keys.
+			view.IterateTombstones(func(key string, t store.Tombstone) bool {
+				batch = append(batch, LoadEntry{Key: key, Version: t.Version, Deleted: true})
+				if size += len(key); size >= loadChunkBytes {
+					err = emit(Command{Op: "LOAD", Load: batch, Index: index})
+					batch, size = nil, 0
+				}
+				return err == nil
+			})
+		}
+		if err == nil && len(batch) > 0 {
+			err = emit(Command{Op: "LOAD", Load: batch, Index: index})
+		}
+		return err
+	})
+}
+
+// CompactResult reports what Compact reclaimed.
+type CompactResult struct {
+	SnapshotIndex  uint64 // Log index of the latest snapshot; 0 if none was needed
+	WALBytesBefore int64
+	WALBytesAfter  int64
+}
+
+// Compact takes a Raft snapshot, which lets Raft truncate its log, and then
+// compacts the WAL. Snapshotting is skipped if nothing was applied since the
+// last one.
+func Compact(r *raft.Raft, f *FSM) (CompactResult, error) {
+	var res CompactResult
+	future := r.Snapshot()
+	if err := future.Error(); err != nil && !errors.Is(err, raft.ErrNothingNewToSnapshot) {
+		return res, fmt.Errorf("failed to snapshot: %w", err)
+	} else if err == nil {
+		meta, rc, err := future.Open()
+		if err != nil {
+			return res, fmt.Errorf("failed to open snapshot: %w", err)
+		}
+		rc.Close()
+		res.SnapshotIndex = meta.Index
+	}
+
+	before, after, err := f.CompactWAL()
+	if err != nil {
+		return res, fmt.Errorf("failed to compact WAL: %w", err)
+	}
+	res.WALBytesBefore, res.WALBytesAfter = before, after
+	return res, nil
+}
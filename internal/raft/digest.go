@@ -0,0 +1,85 @@
+package raft
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// maxDigests bounds how many DIGEST markers an FSM remembers the digest of.
+const maxDigests = 16
+
+// ErrDigestUnavailable is returned by DigestAt for a log index this node has
+// already applied past without recording a digest there.
+var ErrDigestUnavailable = errors.New("no digest was recorded at that log index")
+
+// Digest is a hash of every key, value and version in the store at a Raft
+// log index. Replicas that have applied the same entries have equal digests.
+type Digest struct {
+	Index uint64
+	Hash  string // StateHash of the store
+	Keys  int
+}
+
+// pendingDigest is a digest being computed in the background.
+type pendingDigest struct {
+	done   chan struct{}
+	digest Digest
+}
+
+// recordDigest remembers the digest of the store as it is now, at index. It
+// is called with applyMu held while applying a DIGEST marker, so only the
+// copy of the store holds up the apply loop; hashing happens afterwards.
+func (f *FSM) recordDigest(index uint64) {
+	view := f.store.SnapshotView()
+	p := &pendingDigest{done: make(chan struct{})}
+	go func() {
+		p.digest = Digest{Index: index, Hash: StateHash(view), Keys: view.Len()}
+		close(p.done)
+	}()
+	if f.digests == nil {
+		f.digests = make(map[uint64]*pendingDigest)
+	}
+	f.digests[index] = p
+	if len(f.digests) > maxDigests {
+		oldest := index
+		for i := range f.digests {
+			oldest = min(oldest, i)
+		}
+		delete(f.digests, oldest)
+	}
+}
+
+// DigestAt returns the digest of the store at log index, which should be
+// the index of a DIGEST marker so that every replica records it. If this
+// node has not applied index yet, DigestAt waits for it until ctx is done.
+// An index of 0 means the store as it is now.
+func (f *FSM) DigestAt(ctx context.Context, index uint64) (Digest, error) {
+	for {
+		f.applyMu.Lock()
+		if index == 0 || index == f.applied {
+			view, at := f.store.SnapshotView(), f.applied
+			f.applyMu.Unlock()
+			return Digest{Index: at, Hash: StateHash(view), Keys: view.Len()}, nil
+		}
+		p, applied := f.digests[index], f.applied
+		f.applyMu.Unlock()
+
+		if p != nil {
+			select {
+			case <-p.done:
+				return p.digest, nil
+			case <-ctx.Done():
+				return Digest{}, ctx.Err()
+			}
+		}
+		if index < applied {
+			return Digest{}, ErrDigestUnavailable
+		}
+		select {
+		case <-ctx.Done():
+			return Digest{}, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
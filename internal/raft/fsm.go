@@ -5,10 +5,17 @@ import (
 	"encoding/json"
 	"io"
 	"log"
+	"sync"
+	"time"
 
+	"github.com/ASHISH26940/heliosdb/internal/failpoint"
+	"github.com/ASHISH26940/heliosdb/internal/logging"
 	"github.com/ASHISH26940/heliosdb/internal/persistence"
+	"github.com/ASHISH26940/heliosdb/internal/script"
 	"github.com/ASHISH26940/heliosdb/internal/store"
+	"github.com/ASHISH26940/heliosdb/internal/stream"
 	"github.com/ASHISH26940/heliosdb/internal/transaction"
+	"github.com/ASHISH26940/heliosdb/internal/watch"
 	"github.com/hashicorp/raft"
 )
 
@@ -17,6 +24,13 @@ type DataStore interface {
 	Get(key string) (store.VersionedValue, bool)
 	Set(key, value string)
 	Delete(key string)
+	ApplyBatch(ops []store.BatchOp)
+	SnapshotView() *store.View
+	Restore(data map[string]store.VersionedValue, tombstones map[string]store.Tombstone)
+	Tombstone(key string) (store.Tombstone, bool)
+	PurgeTombstones(versions map[string]uint64) int
+	CheckQuota(ops []store.BatchOp) error
+	DeletePrefix(prefix string, limit int) ([]string, error)
 }
 
 // Command is updated to handle both simple operations and transactional commits.
@@ -25,12 +39,66 @@ type Command struct {
 	Key      string                  `json:"key,omitempty"`
 	Value    string                  `json:"value,omitempty"`
 	WriteSet []transaction.WriteOp `json:"write_set,omitempty"` // For transactions
+	ReadSet  []transaction.ReadOp  `json:"read_set,omitempty"`  // For transactions: versions that must still hold at commit
+
+	IdempotencyKey string `json:"idempotency_key,omitempty"` // For TX_COMMIT: hash of the client's idempotency key, if it sent one
+
+	RequestID string `json:"request_id,omitempty"` // ID of the HTTP request that proposed the command
+	Principal string `json:"principal,omitempty"`  // Who proposed the command, if the leader audits writes
+
+	Script string   `json:"script,omitempty"` // For EVAL: Starlark source, run deterministically on every node
+	Args   []string `json:"args,omitempty"`   // For EVAL: bound to the script's "args" global
+
+	ExpectedVersion uint64 `json:"expected_version,omitempty"` // For CAS: 0 means the key must not exist
+
+	Limit int `json:"limit,omitempty"` // For DELETE_PREFIX: most keys it may delete; 0 is unlimited
+
+	Overwrite bool `json:"overwrite,omitempty"` // For RENAME and COPY: replace the destination if it exists
+
+	Load []LoadEntry `json:"load,omitempty"` // For LOAD: keys written by WAL compaction
+
+	Purge map[string]uint64 `json:"purge,omitempty"` // For PURGE_TOMBSTONES: the version of each tombstone to forget; for JOIN_TOKEN and PURGE_IDEMPOTENCY: of each expired record
+
+	Stream *stream.Op `json:"stream,omitempty"` // For STREAM
+
+	Schedule    *store.ScheduledWrite `json:"schedule,omitempty"`     // For SCHEDULE
+	ScheduleIDs []string              `json:"schedule_ids,omitempty"` // For UNSCHEDULE and RUN_SCHEDULED
+
+	// Index and Term locate the Raft log entry the command was applied from.
+	// They are set when the command is written to the WAL, and are 0 in
+	// records written before they were introduced.
+	Index uint64 `json:"index,omitempty"`
+	Term  uint64 `json:"term,omitempty"`
+}
+
+// LoadEntry is one key of a LOAD command, with the version it had when the
+// WAL was compacted. Deleted marks the tombstone of a deleted key.
+type LoadEntry struct {
+	Key     string `json:"k"`
+	Value   string `json:"v"`
+	Version uint64 `json:"ver"`
+	Deleted bool   `json:"del,omitempty"`
 }
 
 // FSM is a Finite State Machine that applies Raft logs to the key-value store.
 type FSM struct {
 	store DataStore
 	wal   *persistence.WAL
+
+	applyMu   sync.Mutex // Held while an entry is appended to the WAL and applied
+	compactMu sync.Mutex // Serializes CompactWAL
+
+	applied  uint64 // Index of the last log entry reflected in the store; guarded by applyMu
+	walIndex uint64 // Index of the last log entry already in the WAL; guarded by applyMu
+
+	digests map[uint64]*pendingDigest // Digests recorded at DIGEST markers; guarded by applyMu
+	history *History                  // Optional; records the versions of written keys; guarded by applyMu
+	hub     *watch.Hub                // Optional; receives the changes applied; guarded by applyMu
+
+	archiver     *Archiver       // Optional; writes archives at ARCHIVE markers; guarded by applyMu
+	snapshotOpts SnapshotOptions // How snapshots and archives are written; guarded by applyMu
+
+	scheduled map[string]time.Time // Due times of scheduled writes by ID; nil until first needed; guarded by applyMu
 }
 
 // NewFSM creates a new FSM with a given data store and WAL.
@@ -41,29 +109,320 @@ func NewFSM(store DataStore, wal *persistence.WAL) *FSM {
 	}
 }
 
-// Apply applies a Raft log entry to the key-value store AFTER writing it to the WAL.
+// SetAppliedIndex tells the FSM that its store and WAL already reflect every
+// log entry up to index, as rebuilt by ReplayWAL. Raft replays its log from
+// the latest snapshot on startup; entries the WAL already covered are then
+// neither applied nor written again.
+func (f *FSM) SetAppliedIndex(index uint64) {
+	f.applyMu.Lock()
+	defer f.applyMu.Unlock()
+	f.applied = index
+	f.walIndex = index
+}
+
+// AppliedIndex returns the index of the last log entry reflected in the store.
+func (f *FSM) AppliedIndex() uint64 {
+	f.applyMu.Lock()
+	defer f.applyMu.Unlock()
+	return f.applied
+}
+
+// Apply applies a Raft log entry to the key-value store AFTER appending it to the WAL.
 func (f *FSM) Apply(logEntry *raft.Log) interface{} {
+	f.applyMu.Lock()
+	defer f.applyMu.Unlock()
+
 	var cmd Command
 	if err := json.Unmarshal(logEntry.Data, &cmd); err != nil {
 		log.Panicf("Failed to unmarshal command: %v", err)
 	}
 
-	if err := f.wal.WriteCommand(cmd); err != nil {
-		log.Panicf("Failed to write command to WAL: %v", err)
+	// Raft indexes start at 1, so 0 means the entry's position is unknown and
+	// it is always applied.
+	if logEntry.Index != 0 && logEntry.Index <= f.applied {
+		logging.Debugf("[%s] FSM: Skipping entry %d, already applied from the WAL", cmd.RequestID, logEntry.Index)
+		return nil
 	}
 
-	log.Printf("FSM: Applying command: %+v", cmd)
+	// Chaos tests may delay or drop entries here; a dropped entry leaves this
+	// node's store behind the others.
+	if err := failpoint.Inject(failpoint.RaftApply); err != nil {
+		log.Printf("[%s] FSM: Dropping command at failpoint: %v", cmd.RequestID, err)
+		return err
+	}
+
+	// On a pipelined WAL this only queues the record, so the apply loop is not
+	// held up by an fsync per entry. Raft's own log already holds the entry
+	// durably, so a crash before the WAL catches up loses nothing.
+	// After a snapshot is restored, Raft re-applies entries the WAL may
+	// already hold; those are applied to the store but not written twice.
+	if logEntry.Index == 0 || logEntry.Index > f.walIndex {
+		cmd.Index, cmd.Term = logEntry.Index, logEntry.Term
+		if _, err := f.wal.Append(cmd); err != nil {
+			log.Panicf("Failed to write command to WAL: %v", err)
+		}
+		f.walIndex = max(f.walIndex, logEntry.Index)
+	}
+
+	logging.Debugf("[%s] FSM: Applying command: %+v", cmd.RequestID, cmd)
+
+	var before map[string]uint64
+	if f.hub != nil {
+		before = f.keyVersions(writtenKeys(cmd, nil))
+	}
+	res := ApplyCommand(f.store, cmd)
+	f.applied = max(f.applied, logEntry.Index)
+	if f.history != nil {
+		f.recordHistory(logEntry, cmd, res)
+	}
+	if f.hub != nil {
+		f.publishWrites(logEntry, cmd, res, before)
+	}
+	if f.scheduled != nil {
+		f.indexSchedule(cmd, res)
+	}
+	if cmd.Op == "ARCHIVE" && logEntry.Index != 0 && f.archiver != nil {
+		// Only the copy of the store holds up the apply loop.
+		f.archiver.archive(f.store.SnapshotView(), logEntry.Index, f.snapshotOpts)
+	}
+	if cmd.Op == "DIGEST" && logEntry.Index != 0 {
+		// Every replica records its digest at the same log position, and
+		// the proposer learns which position that was.
+		f.recordDigest(logEntry.Index)
+		return logEntry.Index
+	}
+	return res
+}
+
+// ApplyCommand applies a decoded command to st and returns its response.
+// It is shared by the FSM and by WAL replay at startup, so that both
+// interpret commands identically. EVAL returns a script.Result, or an error
+// if the script failed (in which case nothing is written). CAS returns
+// store.ErrVersionConflict if the key's version no longer matches, as does
+// TX_COMMIT if any entry of its read set is stale. A TX_COMMIT with an
+// idempotency key stores cmd.Value, a store.IdempotencyRecord, under it
+// when it commits; one whose key is already stored is not applied again,
+// and returns nil if the record's digest matches and
+// store.ErrIdempotencyKeyReused if not. PURGE_IDEMPOTENCY deletes the
+// records in cmd.Purge that are still at the given versions. BATCH writes its write
+// set unconditionally. MAINTENANCE enters maintenance mode with cmd.Value as
+// its description, or leaves it if cmd.Value is empty; every other command
+// returns store.ErrMaintenance while the cluster is in maintenance mode.
+// LOAD, written only by WAL compaction, installs keys at their recorded
+// versions. DIGEST changes nothing; the FSM records a digest of the store
+// when it applies one (see FSM.DigestAt). ARCHIVE likewise changes
+// nothing; the FSM writes an archive of the store (see Archiver).
+// CLUSTER_ID records cmd.Value as the cluster's ID unless it already has
+// one, and returns the ID the cluster keeps. NODE_HTTP records cmd.Value as
+// the advertised HTTP address of the node at the Raft address cmd.Key.
+// JOIN_TOKEN records a one-time
+// join token, by its hash in cmd.Key, expiring at cmd.Value, and deletes
+// the tokens in cmd.Purge that are still at the given versions. USE_JOIN_TOKEN
+// spends the token cmd.Key and returns whether it was still valid at
+// cmd.Value, the leader's clock when it was presented.
+// DELETE_PREFIX deletes every key starting with cmd.Key and returns the
+// deleted keys, or deletes none and returns an error wrapping
+// store.ErrRangeTooLarge if more than cmd.Limit keys match.
+// RENAME moves the value of cmd.Key to the key cmd.Value, and returns its
+// store.VersionedValue there; it returns store.ErrKeyNotFound if there is
+// nothing to move, and store.ErrKeyExists if the destination exists and
+// cmd.Overwrite is not set. COPY writes the value of cmd.Key to cmd.Value as
+// its next version, leaving cmd.Key as it is, and fails in the same ways.
+// QUOTA sets the quota of the namespace cmd.Key to the store.Quota encoded
+// in cmd.Value, or removes it if cmd.Value is empty. SET, CAS, TX_COMMIT,
+// BATCH and EVAL return an error wrapping store.ErrQuotaExceeded, and write
+// nothing, if they would take a namespace over its quota; RUN_SCHEDULED
+// drops such writes.
+// PURGE_TOMBSTONES forgets the
+// tombstones in cmd.Purge that are still at the given versions, and returns
+// how many it forgot. STREAM applies cmd.Stream and returns a stream.Result,
+// or an error such as stream.ErrNoGroup if it could not be applied.
+// SCHEDULE records cmd.Schedule for the leader to apply later, and
+// UNSCHEDULE cancels the scheduled writes in cmd.ScheduleIDs, returning how
+// many were still pending. RUN_SCHEDULED applies those of cmd.ScheduleIDs
+// still pending as SETs and returns the keys written.
+func ApplyCommand(st DataStore, cmd Command) interface{} {
+	switch cmd.Op {
+	case "MAINTENANCE", "LOAD", "DIGEST", "ARCHIVE", "PURGE_TOMBSTONES", "PURGE_IDEMPOTENCY", "CLUSTER_ID", "JOIN_TOKEN", "USE_JOIN_TOKEN", "NODE_HTTP":
+	default:
+		if _, ok := st.Get(store.MaintenanceKey); ok {
+			return store.ErrMaintenance
+		}
+	}
 
 	switch cmd.Op {
 	case "SET":
-		f.store.Set(cmd.Key, cmd.Value)
+		if err := st.CheckQuota([]store.BatchOp{{Key: cmd.Key, Value: cmd.Value}}); err != nil {
+			return err
+		}
+		st.Set(cmd.Key, cmd.Value)
 	case "DELETE":
-		f.store.Delete(cmd.Key)
+		st.Delete(cmd.Key)
+	case "DELETE_PREFIX":
+		keys, err := st.DeletePrefix(cmd.Key, cmd.Limit)
+		if err != nil {
+			return err
+		}
+		return keys
+	case "RENAME":
+		return rename(st, cmd.Key, cmd.Value, cmd.Overwrite)
+	case "COPY":
+		return copyKey(st, cmd.Key, cmd.Value, cmd.Overwrite)
+	case "CAS":
+		// Only write if nobody else has written the key since it was read.
+		if currentVersion(st, cmd.Key) != cmd.ExpectedVersion {
+			return store.ErrVersionConflict
+		}
+		if err := st.CheckQuota([]store.BatchOp{{Key: cmd.Key, Value: cmd.Value}}); err != nil {
+			return err
+		}
+		st.Set(cmd.Key, cmd.Value)
 	case "TX_COMMIT":
-		// For a transaction, apply all writes in the write set.
-		for _, op := range cmd.WriteSet {
-			f.store.Set(op.Key, op.Value)
+		if cmd.IdempotencyKey != "" {
+			if vv, ok := st.Get(store.IdempotencyPrefix + cmd.IdempotencyKey); ok {
+				return committedBefore(vv.Value, cmd.Value)
+			}
+		}
+		// Validate on every node against the same log position, so that all
+		// replicas agree on whether the transaction committed.
+		for _, op := range cmd.ReadSet {
+			if currentVersion(st, op.Key) != op.Version {
+				return store.ErrVersionConflict
+			}
+		}
+		// Install the whole write set at once, so no reader sees half a transaction.
+		if err := applyWriteSet(st, cmd.WriteSet); err != nil {
+			return err
+		}
+		if cmd.IdempotencyKey != "" {
+			st.Set(store.IdempotencyPrefix+cmd.IdempotencyKey, cmd.Value)
+		}
+	case "PURGE_IDEMPOTENCY":
+		for hash, version := range cmd.Purge {
+			if vv, ok := st.Get(store.IdempotencyPrefix + hash); ok && vv.Version == version {
+				st.Delete(store.IdempotencyPrefix + hash)
+			}
 		}
+	case "BATCH":
+		// A chunk of a bulk load: unconditional writes, installed together.
+		return applyWriteSet(st, cmd.WriteSet)
+	case "LOAD":
+		ops := make([]store.BatchOp, len(cmd.Load))
+		for i, e := range cmd.Load {
+			ops[i] = store.BatchOp{Key: e.Key, Value: e.Value, Version: e.Version, Delete: e.Deleted}
+		}
+		st.ApplyBatch(ops)
+	case "MAINTENANCE":
+		if cmd.Value == "" {
+			st.Delete(store.MaintenanceKey)
+		} else {
+			st.Set(store.MaintenanceKey, cmd.Value)
+		}
+	case "DIGEST", "ARCHIVE":
+	case "CLUSTER_ID":
+		// The first ID wins, so two leaders racing to assign one agree.
+		if vv, ok := st.Get(store.ClusterIDKey); ok {
+			return vv.Value
+		}
+		st.Set(store.ClusterIDKey, cmd.Value)
+		return cmd.Value
+	case "NODE_HTTP":
+		st.Set(store.NodeHTTPPrefix+cmd.Key, cmd.Value)
+	case "JOIN_TOKEN":
+		for hash, version := range cmd.Purge {
+			if vv, ok := st.Get(store.JoinTokenPrefix + hash); ok && vv.Version == version {
+				st.Delete(store.JoinTokenPrefix + hash)
+			}
+		}
+		st.Set(store.JoinTokenPrefix+cmd.Key, cmd.Value)
+	case "QUOTA":
+		if cmd.Value == "" {
+			st.Delete(store.QuotaPrefix + cmd.Key)
+		} else {
+			st.Set(store.QuotaPrefix+cmd.Key, cmd.Value)
+		}
+	case "USE_JOIN_TOKEN":
+		vv, ok := st.Get(store.JoinTokenPrefix + cmd.Key)
+		if !ok {
+			return false
+		}
+		st.Delete(store.JoinTokenPrefix + cmd.Key)
+		expires, err1 := time.Parse(time.RFC3339Nano, vv.Value)
+		now, err2 := time.Parse(time.RFC3339Nano, cmd.Value)
+		return err1 == nil && err2 == nil && now.Before(expires)
+	case "PURGE_TOMBSTONES":
+		return st.PurgeTombstones(cmd.Purge)
+	case "EVAL":
+		res, err := script.Run(cmd.Script, cmd.Args, storeReader{st})
+		if err != nil {
+			return err
+		}
+		ops := make([]store.BatchOp, len(res.Mutations))
+		for i, m := range res.Mutations {
+			ops[i] = store.BatchOp{Key: m.Key, Value: m.Value, Delete: m.Delete}
+		}
+		if err := st.CheckQuota(ops); err != nil {
+			return err
+		}
+		st.ApplyBatch(ops)
+		return res
+	case "SCHEDULE":
+		data, err := json.Marshal(cmd.Schedule)
+		if err != nil {
+			return err
+		}
+		st.Set(store.ScheduleKey(cmd.Schedule.ID), string(data))
+	case "UNSCHEDULE":
+		n := 0
+		for _, id := range cmd.ScheduleIDs {
+			if _, ok := st.Get(store.ScheduleKey(id)); ok {
+				st.Delete(store.ScheduleKey(id))
+				n++
+			}
+		}
+		return n
+	case "RUN_SCHEDULED":
+		// Writes cancelled since the leader found them due are skipped.
+		var ops, done []store.BatchOp
+		keys := []string{}
+		for _, id := range cmd.ScheduleIDs {
+			vv, ok := st.Get(store.ScheduleKey(id))
+			if !ok {
+				continue
+			}
+			var w store.ScheduledWrite
+			if err := json.Unmarshal([]byte(vv.Value), &w); err != nil {
+				log.Printf("FSM: Dropping unreadable scheduled write %q: %v", id, err)
+			} else {
+				ops = append(ops, store.BatchOp{Key: w.Key, Value: w.Value})
+				keys = append(keys, w.Key)
+			}
+			done = append(done, store.BatchOp{Key: store.ScheduleKey(id), Delete: true})
+		}
+		// Writes that no longer fit their namespace's quota are dropped,
+		// rather than retried forever. Each is checked on top of those
+		// kept before it, so only the writes over a quota are dropped.
+		kept := make([]store.BatchOp, 0, len(ops)+len(done))
+		written := []string{}
+		for i, op := range ops {
+			if err := st.CheckQuota(append(kept, op)); err != nil {
+				log.Printf("FSM: Dropping scheduled write to %q: %v", op.Key, err)
+				continue
+			}
+			kept = append(kept, op)
+			written = append(written, keys[i])
+		}
+		st.ApplyBatch(append(kept, done...))
+		return written
+	case "STREAM":
+		// Streams live in reserved keys; the op is validated against them
+		// on every node, so all replicas agree on its result.
+		res, ops, err := stream.Apply(*cmd.Stream, storeReader{st})
+		if err != nil {
+			return err
+		}
+		st.ApplyBatch(ops)
+		return res
 	default:
 		log.Printf("FSM: Unrecognized command op: %s", cmd.Op)
 	}
@@ -71,12 +430,138 @@ func (f *FSM) Apply(logEntry *raft.Log) interface{} {
 	return nil
 }
 
-// Snapshot is used to support log compaction.
+// committedBefore answers a TX_COMMIT whose idempotency key is already
+// stored, with the record stored and the record proposed: the transaction
+// committed already if they hold the same digest.
+func committedBefore(stored, proposed string) error {
+	var was, now store.IdempotencyRecord
+	if json.Unmarshal([]byte(stored), &was) != nil || json.Unmarshal([]byte(proposed), &now) != nil || was.Digest != now.Digest {
+		return store.ErrIdempotencyKeyReused
+	}
+	return nil
+}
+
+// applyWriteSet installs writes in st as a single batch, unless they would
+// take a namespace over its quota.
+func applyWriteSet(st DataStore, writes []transaction.WriteOp) error {
+	ops := make([]store.BatchOp, len(writes))
+	for i, op := range writes {
+		ops[i] = store.BatchOp{Key: op.Key, Value: op.Value, Delete: op.Delete}
+	}
+	if err := st.CheckQuota(ops); err != nil {
+		return err
+	}
+	st.ApplyBatch(ops)
+	return nil
+}
+
+// rename moves the value of from to the key to in one batch, leaving a
+// tombstone at from. The value keeps its version, unless to has already
+// been written at or past it: versions of a key never go backwards.
+func rename(st DataStore, from, to string, overwrite bool) interface{} {
+	vv, ok := st.Get(from)
+	if !ok {
+		return store.ErrKeyNotFound
+	}
+	if from == to {
+		return vv
+	}
+	version := vv.Version
+	if dst, ok := st.Get(to); ok {
+		if !overwrite {
+			return store.ErrKeyExists
+		}
+		version = max(version, dst.Version+1)
+	} else if t, ok := st.Tombstone(to); ok {
+		version = max(version, t.Version+1)
+	}
+	ops := []store.BatchOp{{Key: to, Value: vv.Value, Version: version}, {Key: from, Delete: true}}
+	if err := st.CheckQuota(ops); err != nil {
+		return err
+	}
+	st.ApplyBatch(ops)
+	return store.VersionedValue{Value: vv.Value, Version: version}
+}
+
+// copyKey writes the value of from to to, unless to exists and overwrite is
+// not set. The copy is a new write of to, so it gets to's next version.
+func copyKey(st DataStore, from, to string, overwrite bool) interface{} {
+	vv, ok := st.Get(from)
+	if !ok {
+		return store.ErrKeyNotFound
+	}
+	if from == to {
+		return vv
+	}
+	if _, ok := st.Get(to); ok && !overwrite {
+		return store.ErrKeyExists
+	}
+	ops := []store.BatchOp{{Key: to, Value: vv.Value}}
+	if err := st.CheckQuota(ops); err != nil {
+		return err
+	}
+	st.ApplyBatch(ops)
+	copied, _ := st.Get(to)
+	return copied
+}
+
+// currentVersion returns the version of key in st, or 0 if it is absent.
+func currentVersion(st DataStore, key string) uint64 {
+	current, ok := st.Get(key)
+	if !ok {
+		return 0
+	}
+	return current.Version
+}
+
+// storeReader gives scripts read access to the plain values in a DataStore.
+type storeReader struct {
+	st DataStore
+}
+
+func (r storeReader) Get(key string) (string, bool) {
+	vv, ok := r.st.Get(key)
+	return vv.Value, ok
+}
+
+// Snapshot captures a point-in-time view of the store. Persisting it runs
+// concurrently with further applies, which the view does not see.
 func (f *FSM) Snapshot() (raft.FSMSnapshot, error) {
-	return nil, nil // Not implemented in this phase
+	// Raft calls Snapshot from its apply loop, so no Apply runs concurrently.
+	f.applyMu.Lock()
+	defer f.applyMu.Unlock()
+	return &fsmSnapshot{view: f.store.SnapshotView(), index: f.applied, opts: f.snapshotOpts}, nil
 }
 
-// Restore is used to restore an FSM from a snapshot.
+// SetSnapshotOptions changes how later snapshots and archives are written.
+func (f *FSM) SetSnapshotOptions(opts SnapshotOptions) {
+	f.applyMu.Lock()
+	defer f.applyMu.Unlock()
+	f.snapshotOpts = opts
+}
+
+// Restore replaces the store's contents with a snapshot written by Persist.
 func (f *FSM) Restore(rc io.ReadCloser) error {
-	return nil // Not implemented in this phase
-}
\ No newline at end of file
+	defer rc.Close()
+	f.applyMu.Lock()
+	k := f.snapshotOpts.Keyring
+	f.applyMu.Unlock()
+	data, tombstones, index, err := readSnapshot(rc, k)
+	if err != nil {
+		return err
+	}
+	f.applyMu.Lock()
+	defer f.applyMu.Unlock()
+	f.store.Restore(data, tombstones)
+	// The store now reflects the snapshot, not the WAL, so entries after it
+	// must be applied again. Snapshots written before indexes were recorded
+	// leave applied at 0, and every replayed entry is applied.
+	f.applied = index
+	f.scheduled = nil
+	if f.hub != nil {
+		// Watchers cannot be told what the snapshot changed.
+		f.hub.Reset(index)
+	}
+	log.Printf("FSM: Restored %d keys from snapshot at index %d", len(data), index)
+	return nil
+}
@@ -0,0 +1,1426 @@
+// Package raft_test contains the unit tests for the raft package.
+package raft
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ASHISH26940/heliosdb/internal/failpoint"
+	"github.com/ASHISH26940/heliosdb/internal/persistence"
+	"github.com/ASHISH26940/heliosdb/internal/script"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+	"github.com/ASHISH26940/heliosdb/internal/stream"
+	"github.com/ASHISH26940/heliosdb/internal/transaction"
+	"github.com/ASHISH26940/heliosdb/internal/watch"
+	"github.com/hashicorp/raft"
+)
+
+// bufferSink is a raft.SnapshotSink backed by a buffer.
+type bufferSink struct {
+	bytes.Buffer
+	cancelled bool
+}
+
+func (s *bufferSink) ID() string    { return "test" }
+func (s *bufferSink) Close() error  { return nil }
+func (s *bufferSink) Cancel() error { s.cancelled = true; return nil }
+
+func TestFSMSnapshotRestore(t *testing.T) {
+	src := store.NewStore()
+	src.Set("a", "1")
+	src.Set("a", "2")
+	src.Set("b", "hello\nworld")
+	src.Set("d", "deleted")
+	src.Delete("d")
+	fsm := NewFSM(src, nil)
+
+	// --- Test Case 1: Snapshot is point-in-time ---
+	snap, err := fsm.Snapshot()
+	if err != nil {
+		t.Fatalf("failed to snapshot: %v", err)
+	}
+	src.Set("c", "after")
+	var sink bufferSink
+	if err := snap.Persist(&sink); err != nil {
+		t.Fatalf("failed to persist snapshot: %v", err)
+	}
+	snap.Release()
+
+	// --- Test Case 2: Restore replaces the store, keeping versions ---
+	dst := store.NewStore()
+	dst.Set("stale", "x")
+	if err := NewFSM(dst, nil).Restore(io.NopCloser(&sink)); err != nil {
+		t.Fatalf("failed to restore snapshot: %v", err)
+	}
+	if v, _ := dst.Get("a"); v.Value != "2" || v.Version != 2 {
+		t.Errorf("expected a=2 at version 2, but got %+v", v)
+	}
+	if v, _ := dst.Get("b"); v.Value != "hello\nworld" {
+		t.Errorf("expected b to survive intact, but got %q", v.Value)
+	}
+	for _, key := range []string{"c", "d", "stale"} {
+		if _, ok := dst.Get(key); ok {
+			t.Errorf("expected %s to be absent after restore, but it exists", key)
+		}
+	}
+	if ts, ok := dst.Tombstone("d"); !ok || ts.Version != 2 {
+		t.Errorf("expected d's tombstone at version 2, but got %+v (found %v)", ts, ok)
+	}
+}
+
+func TestCompressedSnapshot(t *testing.T) {
+	src := store.NewStore()
+	for i := 0; i < 100; i++ {
+		src.Set(fmt.Sprintf("key/%03d", i), strings.Repeat("x", 100))
+	}
+	persist := func(opts SnapshotOptions) *bufferSink {
+		fsm := NewFSM(src, nil)
+		fsm.SetSnapshotOptions(opts)
+		snap, _ := fsm.Snapshot()
+		var sink bufferSink
+		if err := snap.Persist(&sink); err != nil {
+			t.Fatalf("failed to persist snapshot: %v", err)
+		}
+		return &sink
+	}
+	plain, compressed := persist(SnapshotOptions{}), persist(SnapshotOptions{Compress: true})
+
+	// --- Test Case 1: Compressed snapshots are smaller and start with the zstd magic ---
+	if !bytes.HasPrefix(compressed.Bytes(), zstdMagic) || compressed.Len() >= plain.Len()/4 {
+		t.Errorf("expected a zstd stream much smaller than %d bytes, but got %d", plain.Len(), compressed.Len())
+	}
+
+	// --- Test Case 2: Both formats restore ---
+	for _, sink := range []*bufferSink{plain, compressed} {
+		dst := store.NewStore()
+		if err := NewFSM(dst, nil).Restore(io.NopCloser(sink)); err != nil {
+			t.Fatalf("failed to restore snapshot: %v", err)
+		}
+		if v, _ := dst.Get("key/042"); dst.SnapshotView().Len() != 100 || v.Value != strings.Repeat("x", 100) {
+			t.Errorf("expected 100 keys with key/042 intact, but got %d keys and %q", dst.SnapshotView().Len(), v.Value)
+		}
+	}
+}
+
+func TestEncryptedSnapshot(t *testing.T) {
+	keyring, err := persistence.NewKeyring(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := store.NewStore()
+	src.Set("secret", "hunter2")
+	for _, compress := range []bool{false, true} {
+		fsm := NewFSM(src, nil)
+		fsm.SetSnapshotOptions(SnapshotOptions{Compress: compress, Encrypt: true, Keyring: keyring})
+		snap, _ := fsm.Snapshot()
+		var sink bufferSink
+		if err := snap.Persist(&sink); err != nil {
+			t.Fatalf("failed to persist snapshot: %v", err)
+		}
+		data := sink.Bytes()
+
+		// --- Test Case 1: Nothing is written in plaintext ---
+		if bytes.Contains(data, []byte("hunter2")) || bytes.Contains(data, []byte("secret")) {
+			t.Errorf("expected no plaintext in the snapshot (compress=%v), but found some", compress)
+		}
+
+		// --- Test Case 2: The keyring opens it ---
+		dst := store.NewStore()
+		restorer := NewFSM(dst, nil)
+		restorer.SetSnapshotOptions(SnapshotOptions{Keyring: keyring})
+		if err := restorer.Restore(io.NopCloser(bytes.NewReader(data))); err != nil {
+			t.Fatalf("failed to restore snapshot (compress=%v): %v", compress, err)
+		}
+		if v, _ := dst.Get("secret"); v.Value != "hunter2" {
+			t.Errorf("expected secret=hunter2, but got %q", v.Value)
+		}
+
+		// --- Test Case 3: Without the key, or truncated, it is refused ---
+		if err := NewFSM(store.NewStore(), nil).Restore(io.NopCloser(bytes.NewReader(data))); err == nil {
+			t.Error("expected restoring without a key to fail, but it succeeded")
+		}
+		lastLine := bytes.LastIndexByte(data[:len(data)-1], '\n') + 1
+		if err := restorer.Restore(io.NopCloser(bytes.NewReader(data[:lastLine]))); err == nil {
+			t.Error("expected a snapshot missing its end marker to be refused, but it was restored")
+		}
+	}
+}
+
+func TestPurgeTombstonesCommand(t *testing.T) {
+	st := store.NewStore()
+	st.Set("a", "1")
+	st.Delete("a")
+	ApplyCommand(st, Command{Op: "MAINTENANCE", Value: `{"reason":"backup"}`})
+
+	// --- Test Case 1: Purges apply in maintenance mode, at matching versions only ---
+	if n := ApplyCommand(st, Command{Op: "PURGE_TOMBSTONES", Purge: map[string]uint64{"a": 1}}); n != 0 {
+		t.Errorf("expected nothing purged at a stale version, but got %v", n)
+	}
+	if n := ApplyCommand(st, Command{Op: "PURGE_TOMBSTONES", Purge: map[string]uint64{"a": 2}}); n != 1 {
+		t.Errorf("expected 1 tombstone purged, but got %v", n)
+	}
+	if _, ok := st.Tombstone("a"); ok {
+		t.Error("expected a's tombstone to be purged, but it is still there")
+	}
+}
+
+var _ raft.SnapshotSink = (*bufferSink)(nil)
+
+func TestApplyTxCommitDelete(t *testing.T) {
+	st := store.NewStore()
+	st.Set("a", "1")
+	st.Set("b", "1")
+
+	// --- Test Case 1: Deletes and writes install together ---
+	resp := ApplyCommand(st, Command{Op: "TX_COMMIT", WriteSet: []transaction.WriteOp{
+		{Key: "a", Delete: true},
+		{Key: "b", Value: "2"},
+	}})
+	if resp != nil {
+		t.Fatalf("expected the commit to apply, but got %v", resp)
+	}
+	if _, ok := st.Get("a"); ok {
+		t.Error("expected a to be deleted, but it still exists")
+	}
+	if v, _ := st.Get("b"); v.Value != "2" {
+		t.Errorf("expected b=2, but got %q", v.Value)
+	}
+	if _, ok := st.Tombstone("a"); !ok {
+		t.Error("expected a tombstone for a, but got none")
+	}
+
+	// --- Test Case 2: A stale read set leaves the delete unapplied ---
+	resp = ApplyCommand(st, Command{Op: "TX_COMMIT",
+		ReadSet:  []transaction.ReadOp{{Key: "b", Version: 1}},
+		WriteSet: []transaction.WriteOp{{Key: "b", Delete: true}},
+	})
+	if resp != store.ErrVersionConflict {
+		t.Errorf("expected ErrVersionConflict, but got %v", resp)
+	}
+	if _, ok := st.Get("b"); !ok {
+		t.Error("expected b to survive the aborted commit, but it was deleted")
+	}
+}
+
+func TestFSMApplyFailpoint(t *testing.T) {
+	st := store.NewStore()
+	dir := t.TempDir()
+	wal, err := persistence.NewWAL(filepath.Join(dir, "wal.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	fsm := NewFSM(st, wal)
+	defer failpoint.DisableAll()
+
+	// --- Test Case 1: An error failpoint drops the entry on this node ---
+	failpoint.Enable(failpoint.RaftApply, "1*error")
+	resp := fsm.Apply(&raft.Log{Data: []byte(`{"op":"SET","key":"a","value":"1"}`)})
+	if err, ok := resp.(error); !ok || !errors.Is(err, failpoint.ErrInjected) {
+		t.Errorf("expected ErrInjected, but got %v", resp)
+	}
+	if _, ok := st.Get("a"); ok {
+		t.Error("expected the dropped entry not to be applied, but it was")
+	}
+
+	// --- Test Case 2: Later entries apply normally ---
+	fsm.Apply(&raft.Log{Data: []byte(`{"op":"SET","key":"a","value":"2"}`)})
+	if v, _ := st.Get("a"); v.Value != "2" {
+		t.Errorf("expected a=2 once the failpoint is spent, but got %q", v.Value)
+	}
+}
+
+func TestApplyMaintenance(t *testing.T) {
+	st := store.NewStore()
+
+	// --- Test Case 1: Writes are refused in maintenance mode ---
+	ApplyCommand(st, Command{Op: "MAINTENANCE", Value: `{"reason":"backup"}`})
+	if resp := ApplyCommand(st, Command{Op: "SET", Key: "a", Value: "1"}); resp != store.ErrMaintenance {
+		t.Errorf("expected ErrMaintenance, but got %v", resp)
+	}
+	if _, ok := st.Get("a"); ok {
+		t.Error("expected a not to be written, but it was")
+	}
+
+	// --- Test Case 2: Writes apply again afterwards ---
+	ApplyCommand(st, Command{Op: "MAINTENANCE"})
+	if resp := ApplyCommand(st, Command{Op: "SET", Key: "a", Value: "1"}); resp != nil {
+		t.Errorf("expected the write to apply, but got %v", resp)
+	}
+}
+
+func TestClusterID(t *testing.T) {
+	st := store.NewStore()
+
+	// --- Test Case 1: The first ID assigned is kept ---
+	if resp := ApplyCommand(st, Command{Op: "CLUSTER_ID", Value: "a"}); resp != "a" {
+		t.Errorf("expected a, but got %v", resp)
+	}
+	if resp := ApplyCommand(st, Command{Op: "CLUSTER_ID", Value: "b"}); resp != "a" || ClusterID(st) != "a" {
+		t.Errorf("expected a to be kept, but got %v", resp)
+	}
+	if id := NewClusterID(); len(id) != 36 || id[14] != '4' || id == NewClusterID() {
+		t.Errorf("expected a random version 4 UUID, but got %s", id)
+	}
+	if resp := ApplyCommand(st, Command{Op: "EVAL", Script: `set("\x00cluster_id", "evil")`}); !errors.Is(resp.(error), script.ErrReservedKey) || ClusterID(st) != "a" {
+		t.Errorf("expected a script to be refused the cluster ID, but got %v and ID %s", resp, ClusterID(st))
+	}
+
+	// --- Test Case 2: Raft connections between clusters are refused ---
+	listen := func(id string, opts ...TransportOption) *raft.NetworkTransport {
+		t.Helper()
+		trans, err := NewClusterTransport("127.0.0.1:0", nil, func() string { return id }, 1, time.Second, io.Discard, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { trans.Close() })
+		return trans
+	}
+	serve := func(trans *raft.NetworkTransport) {
+		go func() {
+			for rpc := range trans.Consumer() {
+				rpc.Respond(&raft.AppendEntriesResponse{Success: true}, nil)
+			}
+		}()
+	}
+	call := func(from, to *raft.NetworkTransport) error {
+		var resp raft.AppendEntriesResponse
+		return from.AppendEntries("a", to.LocalAddr(), &raft.AppendEntriesRequest{RPCHeader: raft.RPCHeader{ProtocolVersion: raft.ProtocolVersionMax}}, &resp)
+	}
+	server := listen("a")
+	serve(server)
+	if err := call(listen("a", WithClusterPreamble()), server); err != nil {
+		t.Errorf("expected the same cluster to connect, but got %v", err)
+	}
+	if err := call(listen("", WithClusterPreamble()), server); err != nil {
+		t.Errorf("expected a node without an ID to connect, but got %v", err)
+	}
+	if err := call(listen("b", WithClusterPreamble()), server); err == nil {
+		t.Error("expected another cluster to be refused, but it connected")
+	}
+
+	// --- Test Case 3: Without the preamble, plain Raft transports interoperate ---
+	plain, err := raft.NewTCPTransport("127.0.0.1:0", nil, 1, time.Second, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { plain.Close() })
+	serve(plain)
+	if err := call(listen("b"), plain); err != nil {
+		t.Errorf("expected a plain transport to accept the connection, but got %v", err)
+	}
+	if err := call(plain, server); err != nil {
+		t.Errorf("expected a plain transport's connection to be accepted, but got %v", err)
+	}
+	if err := call(listen("a", WithClusterPreamble()), plain); err == nil {
+		t.Error("expected a plain transport to refuse the preamble, but it connected")
+	}
+}
+
+func TestApplyIdempotentTxCommit(t *testing.T) {
+	st := store.NewStore()
+	st.Set("balance", "100")
+	now := time.Now().UTC()
+	record := func(digest string, expires time.Time) string {
+		data, _ := json.Marshal(store.IdempotencyRecord{Expires: expires, Digest: digest})
+		return string(data)
+	}
+	commit := func(key, digest, value string) interface{} {
+		return ApplyCommand(st, Command{Op: "TX_COMMIT", IdempotencyKey: key, Value: record(digest, now.Add(time.Hour)),
+			ReadSet:  []transaction.ReadOp{{Key: "balance", Version: 1}},
+			WriteSet: []transaction.WriteOp{{Key: "balance", Value: value}},
+		})
+	}
+
+	// --- Test Case 1: A retried commit is not applied again ---
+	if resp := commit("k1", "d1", "90"); resp != nil {
+		t.Fatalf("expected the commit to apply, but got %v", resp)
+	}
+	if resp := commit("k1", "d1", "90"); resp != nil {
+		t.Errorf("expected the retry to succeed, but got %v", resp)
+	}
+	if vv, _ := st.Get("balance"); vv.Value != "90" || vv.Version != 2 {
+		t.Errorf("expected balance 90 at version 2, but got %q at %d", vv.Value, vv.Version)
+	}
+
+	// --- Test Case 2: A different transaction may not reuse the key ---
+	if resp := commit("k1", "d2", "80"); resp != store.ErrIdempotencyKeyReused {
+		t.Errorf("expected %v, but got %v", store.ErrIdempotencyKeyReused, resp)
+	}
+
+	// --- Test Case 3: Without a key, the stale read set conflicts ---
+	if resp := commit("", "d1", "90"); resp != store.ErrVersionConflict {
+		t.Errorf("expected %v, but got %v", store.ErrVersionConflict, resp)
+	}
+
+	// --- Test Case 4: Expired records are purged, and found by the leader ---
+	ApplyCommand(st, Command{Op: "TX_COMMIT", IdempotencyKey: "k2", Value: record("d3", now.Add(-time.Second))})
+	expired := ExpiredIdempotencyKeys(st, now)
+	if len(expired) != 1 || expired["k2"] == 0 {
+		t.Fatalf("expected only k2 to have expired, but got %v", expired)
+	}
+	ApplyCommand(st, Command{Op: "PURGE_IDEMPOTENCY", Purge: expired})
+	if _, ok := st.Get(store.IdempotencyPrefix + "k2"); ok {
+		t.Error("expected k2 to be forgotten, but it is still stored")
+	}
+	if _, ok := st.Get(store.IdempotencyPrefix + "k1"); !ok {
+		t.Error("expected k1 to be kept, but it was forgotten")
+	}
+}
+
+func TestApplyJoinTokens(t *testing.T) {
+	st := store.NewStore()
+	now := time.Now().UTC()
+	ApplyCommand(st, Command{Op: "JOIN_TOKEN", Key: "h1", Value: now.Add(time.Hour).Format(time.RFC3339Nano)})
+	ApplyCommand(st, Command{Op: "JOIN_TOKEN", Key: "h2", Value: now.Add(-time.Second).Format(time.RFC3339Nano)})
+	use := func(hash string) interface{} {
+		return ApplyCommand(st, Command{Op: "USE_JOIN_TOKEN", Key: hash, Value: now.Format(time.RFC3339Nano)})
+	}
+
+	// --- Test Case 1: A token is valid once ---
+	if resp := use("h1"); resp != true {
+		t.Errorf("expected the token to be valid, but got %v", resp)
+	}
+	if resp := use("h1"); resp != false {
+		t.Errorf("expected the spent token to be refused, but got %v", resp)
+	}
+
+	// --- Test Case 2: Expired and unknown tokens are refused ---
+	if resp := use("h2"); resp != false {
+		t.Errorf("expected the expired token to be refused, but got %v", resp)
+	}
+	if resp := use("h3"); resp != false {
+		t.Errorf("expected an unknown token to be refused, but got %v", resp)
+	}
+
+	// --- Test Case 3: Minting forgets the expired tokens still at their versions ---
+	ApplyCommand(st, Command{Op: "JOIN_TOKEN", Key: "h4", Value: now.Add(-time.Second).Format(time.RFC3339Nano)})
+	ApplyCommand(st, Command{Op: "JOIN_TOKEN", Key: "h5", Value: now.Add(-time.Second).Format(time.RFC3339Nano)})
+	h5, _ := st.Get(store.JoinTokenPrefix + "h5")
+	ApplyCommand(st, Command{Op: "JOIN_TOKEN", Key: "h6", Value: now.Add(time.Hour).Format(time.RFC3339Nano), Purge: map[string]uint64{"h4": 1, "h5": h5.Version + 1}})
+	if _, ok := st.Get(store.JoinTokenPrefix + "h4"); ok {
+		t.Error("expected h4 to be forgotten, but it is still stored")
+	}
+	if _, ok := st.Get(store.JoinTokenPrefix + "h5"); !ok {
+		t.Error("expected h5, at another version, to be kept, but it was forgotten")
+	}
+	if _, ok := st.Get(store.JoinTokenPrefix + "h6"); !ok {
+		t.Error("expected h6 to be stored, but it is not")
+	}
+}
+
+func TestReplayQuota(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.wal")
+	wal, err := persistence.NewWAL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmds := []Command{{Op: "QUOTA", Key: "a/", Value: `{"max_keys":1}`}}
+	for i := 0; i < 50; i++ {
+		cmds = append(cmds, Command{Op: "SET", Key: fmt.Sprintf("a/%d", i), Value: "x"}, Command{Op: "DELETE", Key: fmt.Sprintf("a/%d", i)})
+	}
+	cmds = append(cmds, Command{Op: "SET", Key: "a/last", Value: "x"})
+	fsm := NewFSM(store.NewStore(), wal)
+	for i, cmd := range cmds {
+		data, _ := json.Marshal(cmd)
+		if resp, _ := fsm.Apply(&raft.Log{Index: uint64(i + 1), Data: data}).(error); resp != nil {
+			t.Fatalf("expected %s %s to apply, but got %v", cmd.Op, cmd.Key, resp)
+		}
+	}
+	if err := wal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// --- Test Case 1: Replay makes the same quota decisions, in order ---
+	st := store.NewStore()
+	if _, err := ReplayWAL(st, path, nil, 8); err != nil {
+		t.Fatalf("failed to replay: %v", err)
+	}
+	if _, ok := st.Get("a/last"); !ok {
+		t.Error("expected a/last to be replayed, but it was refused")
+	}
+	if u := st.NamespaceUsage(); len(u) != 1 || u[0].Keys != 1 {
+		t.Errorf("expected a/ to hold 1 key, but got %+v", u)
+	}
+
+	// --- Test Case 2: A compacted WAL loads the quota, and is replayed in order after it ---
+	wal, err = persistence.NewWAL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	fsm = NewFSM(st, wal)
+	fsm.SetAppliedIndex(uint64(len(cmds)))
+	if _, _, err := fsm.CompactWAL(); err != nil {
+		t.Fatalf("failed to compact: %v", err)
+	}
+	more := []Command{{Op: "DELETE", Key: "a/last"}}
+	for i := 0; i < 50; i++ {
+		more = append(more, Command{Op: "SET", Key: fmt.Sprintf("a/%d", i), Value: "x"}, Command{Op: "DELETE", Key: fmt.Sprintf("a/%d", i)})
+	}
+	more = append(more, Command{Op: "SET", Key: "a/end", Value: "x"})
+	for i, cmd := range more {
+		data, _ := json.Marshal(cmd)
+		if resp, _ := fsm.Apply(&raft.Log{Index: uint64(len(cmds) + i + 1), Data: data}).(error); resp != nil {
+			t.Fatalf("expected %s %s to apply, but got %v", cmd.Op, cmd.Key, resp)
+		}
+	}
+	replayed := store.NewStore()
+	if _, err := ReplayWAL(replayed, path, nil, 8); err != nil {
+		t.Fatalf("failed to replay: %v", err)
+	}
+	if _, ok := replayed.Get("a/end"); !ok {
+		t.Error("expected a/end to be replayed, but it was refused")
+	}
+	if u := replayed.NamespaceUsage(); len(u) != 1 || u[0].Keys != 1 {
+		t.Errorf("expected a/ to hold 1 key, but got %+v", u)
+	}
+
+	// --- Test Case 3: Writes after a loaded quota are not partitioned by key ---
+	partition := replayPartition(store.NewStore())
+	for _, tc := range []struct {
+		cmd  Command
+		want string
+	}{
+		{Command{Op: "SET", Key: "a/1"}, "a/1"},
+		{Command{Op: "LOAD", Load: []LoadEntry{{Key: "a/1"}, {Key: store.QuotaPrefix + "b/", Deleted: true}}}, ""},
+		{Command{Op: "SET", Key: "a/2"}, "a/2"},
+		{Command{Op: "LOAD", Load: []LoadEntry{{Key: store.QuotaPrefix + "a/", Value: `{"max_keys":1}`}}}, ""},
+		{Command{Op: "SET", Key: "a/3"}, ""},
+	} {
+		data, _ := json.Marshal(tc.cmd)
+		if got, err := partition(data); err != nil || got != tc.want {
+			t.Errorf("expected %s to be partitioned as %q, but got %q (%v)", tc.cmd.Op, tc.want, got, err)
+		}
+	}
+}
+
+func TestApplyRename(t *testing.T) {
+	st := store.NewStore()
+	ApplyCommand(st, Command{Op: "SET", Key: "a", Value: "1"})
+	ApplyCommand(st, Command{Op: "SET", Key: "a", Value: "2"})
+	ApplyCommand(st, Command{Op: "SET", Key: "b", Value: "x"})
+
+	// --- Test Case 1: A rename never replaces a key unless told to ---
+	if resp := ApplyCommand(st, Command{Op: "RENAME", Key: "a", Value: "b"}); resp != store.ErrKeyExists {
+		t.Errorf("expected ErrKeyExists, but got %v", resp)
+	}
+	if resp := ApplyCommand(st, Command{Op: "RENAME", Key: "missing", Value: "c"}); resp != store.ErrKeyNotFound {
+		t.Errorf("expected ErrKeyNotFound, but got %v", resp)
+	}
+
+	// --- Test Case 2: The value moves with its version ---
+	resp := ApplyCommand(st, Command{Op: "RENAME", Key: "a", Value: "c"})
+	if vv, _ := st.Get("c"); vv.Value != "2" || vv.Version != 2 || resp != vv {
+		t.Errorf("expected c to hold 2 at version 2, but got %+v (returned %v)", vv, resp)
+	}
+	if ts, ok := st.Tombstone("a"); !ok || ts.Version != 3 {
+		t.Errorf("expected a tombstone for a at version 3, but got %+v (found %v)", ts, ok)
+	}
+
+	// --- Test Case 3: Overwriting never takes the destination's version back ---
+	for i := 0; i < 3; i++ {
+		ApplyCommand(st, Command{Op: "SET", Key: "b", Value: "x"})
+	}
+	ApplyCommand(st, Command{Op: "RENAME", Key: "c", Value: "b", Overwrite: true})
+	if vv, _ := st.Get("b"); vv.Value != "2" || vv.Version != 5 {
+		t.Errorf("expected b to hold 2 at version 5, but got %+v", vv)
+	}
+	if keys := writtenKeys(Command{Op: "RENAME", Key: "c", Value: "b"}, nil); fmt.Sprint(keys) != "[c b]" {
+		t.Errorf("expected c and b to be written, but got %v", keys)
+	}
+}
+
+func TestApplyCopy(t *testing.T) {
+	st := store.NewStore()
+	ApplyCommand(st, Command{Op: "SET", Key: "a", Value: "1"})
+	ApplyCommand(st, Command{Op: "SET", Key: "a", Value: "2"})
+	ApplyCommand(st, Command{Op: "SET", Key: "b", Value: "x"})
+
+	// --- Test Case 1: A copy never replaces a key unless told to ---
+	if resp := ApplyCommand(st, Command{Op: "COPY", Key: "a", Value: "b"}); resp != store.ErrKeyExists {
+		t.Errorf("expected ErrKeyExists, but got %v", resp)
+	}
+	if resp := ApplyCommand(st, Command{Op: "COPY", Key: "missing", Value: "c"}); resp != store.ErrKeyNotFound {
+		t.Errorf("expected ErrKeyNotFound, but got %v", resp)
+	}
+
+	// --- Test Case 2: The copy is a new write of the destination ---
+	resp := ApplyCommand(st, Command{Op: "COPY", Key: "a", Value: "c"})
+	if vv, _ := st.Get("c"); vv.Value != "2" || vv.Version != 1 || resp != vv {
+		t.Errorf("expected c to hold 2 at version 1, but got %+v (returned %v)", vv, resp)
+	}
+	if vv, _ := st.Get("a"); vv.Value != "2" || vv.Version != 2 {
+		t.Errorf("expected a to be unchanged, but got %+v", vv)
+	}
+	ApplyCommand(st, Command{Op: "COPY", Key: "a", Value: "b", Overwrite: true})
+	if vv, _ := st.Get("b"); vv.Value != "2" || vv.Version != 2 {
+		t.Errorf("expected b to hold 2 at version 2, but got %+v", vv)
+	}
+	if keys := writtenKeys(Command{Op: "COPY", Key: "a", Value: "b"}, nil); fmt.Sprint(keys) != "[b]" {
+		t.Errorf("expected only b to be written, but got %v", keys)
+	}
+}
+
+func TestApplyDeletePrefix(t *testing.T) {
+	st := store.NewStore()
+	for _, key := range []string{"s/1", "s/2", "t/1"} {
+		ApplyCommand(st, Command{Op: "SET", Key: key, Value: "x"})
+	}
+
+	// --- Test Case 1: Over the limit, nothing is deleted ---
+	cmd := Command{Op: "DELETE_PREFIX", Key: "s/", Limit: 1}
+	if resp, _ := ApplyCommand(st, cmd).(error); !errors.Is(resp, store.ErrRangeTooLarge) {
+		t.Errorf("expected ErrRangeTooLarge, but got %v", resp)
+	}
+
+	// --- Test Case 2: The deleted keys are returned, and count as written ---
+	cmd.Limit = 2
+	res := ApplyCommand(st, cmd)
+	if keys := writtenKeys(cmd, res); fmt.Sprint(keys) != "[s/1 s/2]" {
+		t.Errorf("expected s/1 and s/2 to be written, but got %v", keys)
+	}
+	if _, ok := st.Get("t/1"); !ok {
+		t.Error("expected t/1 to be kept, but it is gone")
+	}
+}
+
+func TestApplyQuota(t *testing.T) {
+	st := store.NewStore()
+	ApplyCommand(st, Command{Op: "QUOTA", Key: "a/", Value: `{"max_keys":1}`})
+	ApplyCommand(st, Command{Op: "SET", Key: "a/1", Value: "x"})
+
+	// --- Test Case 1: Writes past the quota are refused, whatever the op ---
+	for _, cmd := range []Command{
+		{Op: "SET", Key: "a/2", Value: "x"},
+		{Op: "CAS", Key: "a/2", Value: "x"},
+		{Op: "TX_COMMIT", WriteSet: []transaction.WriteOp{{Key: "b", Value: "x"}, {Key: "a/2", Value: "x"}}},
+		{Op: "BATCH", WriteSet: []transaction.WriteOp{{Key: "a/2", Value: "x"}}},
+	} {
+		if resp, _ := ApplyCommand(st, cmd).(error); !errors.Is(resp, store.ErrQuotaExceeded) {
+			t.Errorf("expected %s to exceed the quota, but got %v", cmd.Op, resp)
+		}
+	}
+	if _, ok := st.Get("b"); ok {
+		t.Error("expected nothing of the refused transaction to be written, but b was")
+	}
+
+	// --- Test Case 2: Writes within the quota apply ---
+	if resp := ApplyCommand(st, Command{Op: "SET", Key: "a/1", Value: "y"}); resp != nil {
+		t.Errorf("expected the overwrite to apply, but got %v", resp)
+	}
+
+	// --- Test Case 3: Removing the quota lifts the limit ---
+	ApplyCommand(st, Command{Op: "QUOTA", Key: "a/"})
+	if resp := ApplyCommand(st, Command{Op: "SET", Key: "a/2", Value: "x"}); resp != nil {
+		t.Errorf("expected the write to apply, but got %v", resp)
+	}
+}
+
+func TestApplyStream(t *testing.T) {
+	st := store.NewStore()
+	apply := func(op stream.Op) interface{} {
+		return ApplyCommand(st, Command{Op: "STREAM", Stream: &op})
+	}
+
+	// --- Test Case 1: Entries and group state are written to the store ---
+	apply(stream.Op{Type: stream.OpAdd, Stream: "q", Fields: map[string]string{"job": "1"}})
+	apply(stream.Op{Type: stream.OpCreateGroup, Stream: "q", Group: "g"})
+	res, ok := apply(stream.Op{Type: stream.OpRead, Stream: "q", Group: "g", Consumer: "c"}).(stream.Result)
+	if !ok || len(res.Entries) != 1 || res.Entries[0].Fields["job"] != "1" {
+		t.Errorf("expected the entry to be delivered, but got %+v", res)
+	}
+	if info, err := stream.Describe(storeReader{st}, "q"); err != nil || len(info.Groups[0].Pending) != 1 {
+		t.Errorf("expected 1 pending entry, but got %+v (%v)", info, err)
+	}
+
+	// --- Test Case 2: Failed ops return their error and write nothing ---
+	before := st.SnapshotView().Len()
+	if resp := apply(stream.Op{Type: stream.OpRead, Stream: "q", Group: "missing", Consumer: "c"}); resp != stream.ErrNoGroup {
+		t.Errorf("expected ErrNoGroup, but got %v", resp)
+	}
+	if after := st.SnapshotView().Len(); after != before {
+		t.Errorf("expected %d keys, but got %d", before, after)
+	}
+}
+
+func TestCompactWAL(t *testing.T) {
+	st := store.NewStore()
+	path := filepath.Join(t.TempDir(), "wal.log")
+	wal, err := persistence.NewPipelinedWAL(path, nil, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	fsm := NewFSM(st, wal)
+	apply := func(cmd string) {
+		fsm.Apply(&raft.Log{Data: []byte(cmd)})
+	}
+	for i := 0; i < 50; i++ {
+		apply(`{"op":"SET","key":"a","value":"` + strings.Repeat("x", i) + `"}`)
+	}
+	apply(`{"op":"SET","key":"b","value":"1"}`)
+	apply(`{"op":"DELETE","key":"b"}`)
+
+	// --- Test Case 1: The WAL shrinks ---
+	before, after, err := fsm.CompactWAL()
+	if err != nil {
+		t.Fatalf("failed to compact: %v", err)
+	}
+	if after >= before {
+		t.Errorf("expected the WAL to shrink, but it went from %d to %d bytes", before, after)
+	}
+
+	// --- Test Case 2: Replay rebuilds the same state, versions included ---
+	apply(`{"op":"SET","key":"c","value":"after"}`)
+	if err := wal.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	replayed := store.NewStore()
+	if _, err := ReplayWAL(replayed, path, nil, 4); err != nil {
+		t.Fatalf("failed to replay: %v", err)
+	}
+	for _, key := range []string{"a", "c"} {
+		want, _ := st.Get(key)
+		if got, _ := replayed.Get(key); got != want {
+			t.Errorf("expected %s to replay as %+v, but got %+v", key, want, got)
+		}
+	}
+	if _, ok := replayed.Get("b"); ok {
+		t.Error("expected b to stay deleted, but it was replayed")
+	}
+	if ts, ok := replayed.Tombstone("b"); !ok || ts.Version != 2 {
+		t.Errorf("expected b's tombstone at version 2 to be replayed, but got %+v (found %v)", ts, ok)
+	}
+}
+
+func TestReplayIdempotent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.wal")
+	wal, err := persistence.NewWAL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []*raft.Log{
+		{Index: 1, Term: 1, Data: []byte(`{"op":"SET","key":"a","value":"1"}`)},
+		{Index: 2, Term: 1, Data: []byte(`{"op":"SET","key":"b","value":"1"}`)},
+		{Index: 3, Term: 2, Data: []byte(`{"op":"CAS","key":"a","value":"2","expected_version":1}`)},
+	}
+	fsm := NewFSM(store.NewStore(), wal)
+	for _, e := range entries {
+		fsm.Apply(e)
+	}
+	if err := wal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// --- Test Case 1: Replay reports the last index in the WAL ---
+	st := store.NewStore()
+	index, err := ReplayWAL(st, path, nil, 1)
+	if err != nil {
+		t.Fatalf("failed to replay: %v", err)
+	}
+	if index != 3 {
+		t.Errorf("expected replay to reach index 3, but got %d", index)
+	}
+
+	// --- Test Case 2: Raft re-applying its log does not apply entries twice ---
+	wal, err = persistence.NewWAL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsm = NewFSM(st, wal)
+	fsm.SetAppliedIndex(index)
+	for _, e := range entries {
+		if res := fsm.Apply(e); res != nil {
+			t.Errorf("expected entry %d to be skipped, but got %v", e.Index, res)
+		}
+	}
+	fsm.Apply(&raft.Log{Index: 4, Term: 2, Data: []byte(`{"op":"SET","key":"b","value":"2"}`)})
+	if vv, _ := st.Get("a"); vv.Version != 2 || vv.Value != "2" {
+		t.Errorf("expected a to be at version 2, but got %+v", vv)
+	}
+	if vv, _ := st.Get("b"); vv.Version != 2 || vv.Value != "2" {
+		t.Errorf("expected b to be at version 2, but got %+v", vv)
+	}
+	if got := fsm.AppliedIndex(); got != 4 {
+		t.Errorf("expected applied index 4, but got %d", got)
+	}
+
+	// --- Test Case 3: After a snapshot is restored, later entries are applied but not rewritten ---
+	sink := &bufferSink{}
+	snap, err := NewFSM(store.NewStore(), nil).Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatal(err)
+	}
+	restored := store.NewStore()
+	fsm = NewFSM(restored, wal)
+	fsm.SetAppliedIndex(4)
+	if err := fsm.Restore(io.NopCloser(&sink.Buffer)); err != nil {
+		t.Fatalf("failed to restore: %v", err)
+	}
+	for _, e := range entries {
+		fsm.Apply(e)
+	}
+	if vv, _ := restored.Get("a"); vv.Version != 2 {
+		t.Errorf("expected a to be re-applied to version 2, but got %+v", vv)
+	}
+	if err := wal.Close(); err != nil {
+		t.Fatal(err)
+	}
+	replayed := store.NewStore()
+	if _, err := ReplayWAL(replayed, path, nil, 1); err != nil {
+		t.Fatal(err)
+	}
+	if vv, _ := replayed.Get("b"); vv.Version != 2 {
+		t.Errorf("expected b to replay to version 2 without duplicates, but got %+v", vv)
+	}
+
+	// --- Test Case 4: A snapshot records the index it reflects ---
+	sink = &bufferSink{}
+	snap, err = fsm.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, index, err := readSnapshot(&sink.Buffer, nil); err != nil || index != 3 {
+		t.Errorf("expected the snapshot to be at index 3, but got %d (%v)", index, err)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.wal")
+	wal, err := persistence.NewWAL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	snapshots, err := raft.NewFileSnapshotStore(dir, 1, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := store.NewStore()
+	fsm := NewFSM(src, wal)
+	apply := func(index uint64, cmd string) {
+		fsm.Apply(&raft.Log{Index: index, Term: 1, Data: []byte(cmd)})
+	}
+	apply(1, `{"op":"SET","key":"a","value":"1"}`)
+	apply(2, `{"op":"SET","key":"b","value":"1"}`)
+
+	// The snapshot holds a key the WAL never wrote, to tell where state came from.
+	src.Set("snap", "1")
+	snap, err := fsm.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink, err := snapshots.Create(raft.SnapshotVersionMax, 2, 1, raft.Configuration{}, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatal(err)
+	}
+	apply(3, `{"op":"SET","key":"a","value":"2"}`)
+	apply(4, `{"op":"DELETE","key":"b"}`)
+	if err := wal.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// --- Test Case 1: The snapshot is loaded and only the WAL after it is replayed ---
+	st := store.NewStore()
+	rec, err := Recover(st, snapshots, path, nil, 4)
+	if err != nil {
+		t.Fatalf("failed to recover: %v", err)
+	}
+	if rec.SnapshotIndex != 2 || rec.Index != 4 || !rec.SkipRestore {
+		t.Errorf("expected recovery from snapshot 2 through index 4, but got %+v", rec)
+	}
+	if _, ok := st.Get("snap"); !ok {
+		t.Error("expected the snapshot to be loaded, but it was not")
+	}
+	if vv, _ := st.Get("a"); vv.Value != "2" || vv.Version != 2 {
+		t.Errorf("expected a to be 2 at version 2, but got %+v", vv)
+	}
+	if _, ok := st.Get("b"); ok {
+		t.Error("expected b to be deleted after the snapshot, but it exists")
+	}
+
+	// --- Test Case 2: Without a snapshot the whole WAL is replayed ---
+	st = store.NewStore()
+	rec, err = Recover(st, raft.NewInmemSnapshotStore(), path, nil, 4)
+	if err != nil {
+		t.Fatalf("failed to recover: %v", err)
+	}
+	if rec.SnapshotIndex != 0 || rec.Index != 4 || rec.SkipRestore {
+		t.Errorf("expected a full replay through index 4, but got %+v", rec)
+	}
+	if _, ok := st.Get("snap"); ok {
+		t.Error("expected no snapshot to be loaded, but one was")
+	}
+
+	// --- Test Case 3: A WAL compacted after the snapshot supersedes it ---
+	src.Delete("snap")
+	if _, _, err := fsm.CompactWAL(); err != nil {
+		t.Fatalf("failed to compact: %v", err)
+	}
+	st = store.NewStore()
+	rec, err = Recover(st, snapshots, path, nil, 4)
+	if err != nil {
+		t.Fatalf("failed to recover: %v", err)
+	}
+	if rec.SnapshotIndex != 0 || rec.Index != 4 || !rec.SkipRestore {
+		t.Errorf("expected the compacted WAL to be replayed through index 4, but got %+v", rec)
+	}
+	if _, ok := st.Get("snap"); ok {
+		t.Error("expected the older snapshot to be ignored, but it was loaded")
+	}
+}
+
+func TestRestorePoint(t *testing.T) {
+	dir := t.TempDir()
+	wal, err := persistence.NewWAL(filepath.Join(dir, "app.wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	snapshots, err := raft.NewFileSnapshotStore(dir, 2, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := store.NewStore()
+	fsm := NewFSM(src, wal)
+	archiver := NewArchiver(filepath.Join(dir, "archives"), 0)
+	fsm.SetArchiver(archiver)
+	fsm.Apply(&raft.Log{Index: 1, Term: 1, Data: []byte(`{"op":"SET","key":"a","value":"1"}`)})
+	fsm.Apply(&raft.Log{Index: 2, Term: 1, Data: []byte(`{"op":"DELETE","key":"a"}`)})
+	fsm.Apply(&raft.Log{Index: 3, Term: 1, Data: []byte(`{"op":"SET","key":"b","value":"1"}`)})
+	snap, err := fsm.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink, err := snapshots.Create(raft.SnapshotVersionMax, 3, 1, raft.Configuration{}, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatal(err)
+	}
+	fsm.Apply(&raft.Log{Index: 4, Term: 1, Data: []byte(`{"op":"SET","key":"c","value":"1"}`)})
+	fsm.Apply(&raft.Log{Index: 5, Term: 1, Data: []byte(`{"op":"ARCHIVE"}`)})
+	archiver.wait()
+
+	restore := func(ref string) (*store.Store, Recovery) {
+		t.Helper()
+		p, err := OpenRestorePoint(ref, snapshots, archiver, nil)
+		if err != nil {
+			t.Fatalf("failed to open %s: %v", ref, err)
+		}
+		path := filepath.Join(t.TempDir(), "app.wal")
+		if err := p.WriteWAL(path, nil); err != nil {
+			t.Fatalf("failed to write the WAL: %v", err)
+		}
+		st := store.NewStore()
+		rec, err := Recover(st, snapshots, path, nil, 1)
+		if err != nil {
+			t.Fatalf("failed to recover: %v", err)
+		}
+		return st, rec
+	}
+
+	// --- Test Case 1: A snapshot is restored by ID, tombstones included ---
+	metas, _ := snapshots.List()
+	st, rec := restore(metas[0].ID)
+	if rec.Index != 3 || !rec.SkipRestore {
+		t.Errorf("expected the store to be restored through index 3, but got %+v", rec)
+	}
+	if _, ok := st.Get("b"); !ok || st.SnapshotView().Len() != 1 {
+		t.Errorf("expected only b, but got %d keys", st.SnapshotView().Len())
+	}
+	if _, ok := st.SnapshotView().Tombstone("a"); !ok {
+		t.Error("expected a's tombstone to be restored, but it was not")
+	}
+
+	// --- Test Case 2: Archives are restored by index or path ---
+	archives, _ := archiver.List()
+	for _, ref := range []string{"5", archives[0].Path} {
+		st, rec = restore(ref)
+		if _, ok := st.Get("c"); !ok || rec.Index != 5 {
+			t.Errorf("expected %s to restore c through index 5, but got index %d", ref, rec.Index)
+		}
+	}
+
+	// --- Test Case 3: A point older than the newest snapshot is refused ---
+	sink, _ = snapshots.Create(raft.SnapshotVersionMax, 6, 1, raft.Configuration{}, 1, nil)
+	snap.Persist(sink)
+	if _, err := OpenRestorePoint("5", snapshots, archiver, nil); err == nil {
+		t.Error("expected restoring behind the newest snapshot to fail, but it succeeded")
+	}
+	if _, err := OpenRestorePoint("missing", snapshots, archiver, nil); err == nil {
+		t.Error("expected an unknown point to fail, but it succeeded")
+	}
+}
+
+func TestForceConfiguration(t *testing.T) {
+	logs := raft.NewInmemStore()
+	snapshots, err := raft.NewFileSnapshotStore(t.TempDir(), 2, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := raft.Configuration{Servers: []raft.Server{
+		{ID: "node1", Address: "10.0.0.1:9080"},
+		{ID: "node2", Address: "10.0.0.2:9080"},
+		{ID: "node3", Address: "10.0.0.3:9080"},
+	}}
+	logs.StoreLogs([]*raft.Log{
+		{Index: 1, Term: 1, Type: raft.LogConfiguration, Data: raft.EncodeConfiguration(old)},
+		{Index: 2, Term: 1, Type: raft.LogCommand, Data: []byte(`{"op":"SET","key":"a","value":"1"}`)},
+		{Index: 3, Term: 2, Type: raft.LogCommand, Data: []byte(`{"op":"SET","key":"b","value":"1"}`)},
+	})
+	logs.SetUint64([]byte("CurrentTerm"), 2)
+
+	// --- Test Case 1: The log becomes a snapshot holding the new configuration ---
+	servers := []raft.Server{{ID: "node1", Address: "10.0.0.1:9080", Suffrage: raft.Voter}}
+	index, err := ForceConfiguration("node1", logs, logs, snapshots, servers, SnapshotOptions{})
+	if err != nil {
+		t.Fatalf("failed to force the configuration: %v", err)
+	}
+	metas, _ := snapshots.List()
+	if index != 3 || len(metas) != 1 || len(metas[0].Configuration.Servers) != 1 || metas[0].Configuration.Servers[0].ID != "node1" {
+		t.Fatalf("expected a snapshot at index 3 with only node1, but got index %d and %+v", index, metas)
+	}
+	st := store.NewStore()
+	if err := loadSnapshot(st, snapshots, metas[0].ID, nil); err != nil {
+		t.Fatalf("failed to load the snapshot: %v", err)
+	}
+	if _, ok := st.Get("b"); !ok || st.SnapshotView().Len() != 2 {
+		t.Errorf("expected both keys in the snapshot, but got %d", st.SnapshotView().Len())
+	}
+
+	// --- Test Case 2: A node without Raft state is refused ---
+	if _, err := ForceConfiguration("node1", raft.NewInmemStore(), raft.NewInmemStore(), raft.NewInmemSnapshotStore(), servers, SnapshotOptions{}); err == nil {
+		t.Error("expected recovery without state to fail, but it succeeded")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.wal")
+	wal, err := persistence.NewWAL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs := raft.NewInmemStore()
+	snapshots, err := raft.NewFileSnapshotStore(dir, 1, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsm := NewFSM(store.NewStore(), wal)
+	apply := func(index uint64, cmd string) {
+		entry := &raft.Log{Index: index, Term: 1, Type: raft.LogCommand, Data: []byte(cmd)}
+		if err := logs.StoreLog(entry); err != nil {
+			t.Fatal(err)
+		}
+		fsm.Apply(entry)
+	}
+	logs.StoreLog(&raft.Log{Index: 1, Term: 1, Type: raft.LogConfiguration})
+	apply(2, `{"op":"SET","key":"a","value":"1"}`)
+	apply(3, `{"op":"SET","key":"b","value":"1"}`)
+	snap, err := fsm.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink, err := snapshots.Create(raft.SnapshotVersionMax, 3, 1, raft.Configuration{}, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatal(err)
+	}
+	apply(4, `{"op":"SET","key":"a","value":"2"}`)
+	apply(5, `{"op":"DELETE","key":"b"}`)
+	if err := wal.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// --- Test Case 1: Consistent state passes ---
+	rep, err := Verify(path, nil, logs, snapshots)
+	if err != nil {
+		t.Fatalf("failed to verify: %v", err)
+	}
+	if len(rep.Problems) > 0 || rep.ComparedAt != 5 || rep.SnapshotIndex != 3 {
+		t.Errorf("expected a clean comparison at index 5, but got %+v", rep)
+	}
+
+	// --- Test Case 2: A WAL that disagrees with the Raft log is reported ---
+	wal.WriteCommand(Command{Op: "SET", Key: "c", Value: "x", Index: 5})
+	apply(6, `{"op":"SET","key":"d","value":"1"}`)
+	wal.Flush()
+	rep, err = Verify(path, nil, logs, snapshots)
+	if err != nil {
+		t.Fatalf("failed to verify: %v", err)
+	}
+	if len(rep.Problems) == 0 || !strings.Contains(strings.Join(rep.Problems, "\n"), `"c"`) {
+		t.Errorf("expected key c to be reported, but got %v", rep.Problems)
+	}
+
+	// --- Test Case 3: An undecodable WAL record is reported ---
+	wal.Close()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("{not json\n")
+	f.Close()
+	rep, err = Verify(path, nil, logs, snapshots)
+	if err != nil {
+		t.Fatalf("failed to verify: %v", err)
+	}
+	if len(rep.Problems) != 1 || rep.ComparedAt != 0 {
+		t.Errorf("expected one problem and no comparison, but got %+v", rep)
+	}
+}
+
+func TestArchives(t *testing.T) {
+	wal, err := persistence.NewWAL(filepath.Join(t.TempDir(), "app.wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	st := store.NewStore()
+	fsm := NewFSM(st, wal)
+	dir := filepath.Join(t.TempDir(), "archives")
+	archiver := NewArchiver(dir, 2)
+	fsm.SetArchiver(archiver)
+
+	// --- Test Case 1: Each marker writes an archive of the store at its index ---
+	fsm.Apply(&raft.Log{Index: 1, Term: 1, Data: []byte(`{"op":"SET","key":"a","value":"1"}`)})
+	fsm.Apply(&raft.Log{Index: 2, Term: 1, Data: []byte(`{"op":"ARCHIVE"}`)})
+	fsm.Apply(&raft.Log{Index: 3, Term: 1, Data: []byte(`{"op":"SET","key":"b","value":"2"}`)})
+	archiver.wait()
+	archives, err := archiver.List()
+	if err != nil || len(archives) != 1 || archives[0].Index != 2 {
+		t.Fatalf("expected one archive at index 2, but got %+v (%v)", archives, err)
+	}
+	f, err := os.Open(archives[0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	index, err := ReadSnapshot(f, nil, func(key string, _ store.VersionedValue) bool {
+		keys = append(keys, key)
+		return true
+	})
+	f.Close()
+	if err != nil || index != 2 || len(keys) != 1 || keys[0] != "a" {
+		t.Errorf("expected the archive to hold only a at index 2, but got %v at %d (%v)", keys, index, err)
+	}
+
+	// --- Test Case 2: Only the newest archives are kept ---
+	fsm.Apply(&raft.Log{Index: 4, Term: 1, Data: []byte(`{"op":"ARCHIVE"}`)})
+	archiver.wait()
+	fsm.Apply(&raft.Log{Index: 5, Term: 1, Data: []byte(`{"op":"ARCHIVE"}`)})
+	archiver.wait()
+	archives, _ = archiver.List()
+	if len(archives) != 2 || archives[0].Index != 5 || archives[1].Index != 4 {
+		t.Errorf("expected the archives at 5 and 4, but got %+v", archives)
+	}
+
+	// --- Test Case 3: Markers apply in maintenance mode and change nothing ---
+	ApplyCommand(st, Command{Op: "MAINTENANCE", Value: `{"reason":"backup"}`})
+	if resp := ApplyCommand(st, Command{Op: "ARCHIVE"}); resp != nil {
+		t.Errorf("expected the marker to apply, but got %v", resp)
+	}
+}
+
+func TestIncrementalArchives(t *testing.T) {
+	wal, err := persistence.NewWAL(filepath.Join(t.TempDir(), "app.wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	st := store.NewStore()
+	fsm := NewFSM(st, wal)
+	archiver := NewArchiver(t.TempDir(), 2, WithFullEvery(3))
+	fsm.SetArchiver(archiver)
+	index := uint64(0)
+	apply := func(cmd string) {
+		index++
+		fsm.Apply(&raft.Log{Index: index, Term: 1, Data: []byte(cmd)})
+		archiver.wait()
+	}
+	for i := 0; i < 50; i++ {
+		apply(fmt.Sprintf(`{"op":"SET","key":"k%02d","value":"v"}`, i))
+	}
+	st.Set("gone", "x")
+	st.Delete("gone")
+	apply(`{"op":"ARCHIVE"}`) // 51: full
+	apply(`{"op":"SET","key":"k01","value":"changed"}`)
+	apply(`{"op":"DELETE","key":"k02"}`)
+	apply(`{"op":"ARCHIVE"}`) // 54: from 51
+	apply(`{"op":"SET","key":"new","value":"n"}`)
+	ApplyCommand(st, Command{Op: "PURGE_TOMBSTONES", Purge: map[string]uint64{"gone": 2}})
+	apply(`{"op":"ARCHIVE"}`) // 56: from 54
+
+	// --- Test Case 1: Archives between baselines hold only what changed ---
+	archives, _ := archiver.List()
+	if len(archives) != 3 || archives[0].Base != 54 || archives[1].Base != 51 || archives[2].Base != 0 {
+		t.Fatalf("expected a chain 56 -> 54 -> 51, but got %+v", archives)
+	}
+	info, _ := os.Stat(archives[1].Path)
+	full, _ := os.Stat(archives[2].Path)
+	if info.Size() >= full.Size()/5 {
+		t.Errorf("expected the increment to be much smaller than %d bytes, but got %d", full.Size(), info.Size())
+	}
+
+	// --- Test Case 2: Loading applies the chain to its baseline ---
+	data, tombstones, err := archiver.Load(56, nil)
+	if err != nil {
+		t.Fatalf("failed to load the archive: %v", err)
+	}
+	want := st.SnapshotView()
+	if len(data) != want.Len() || data["k01"].Value != "changed" || data["new"].Value != "n" {
+		t.Errorf("expected %d keys with k01 changed and new added, but got %d keys", want.Len(), len(data))
+	}
+	if _, ok := tombstones["k02"]; !ok {
+		t.Error("expected k02's tombstone, but got none")
+	}
+	if _, ok := tombstones["gone"]; ok {
+		t.Error("expected the purged tombstone to be forgotten, but it is there")
+	}
+
+	// --- Test Case 3: Increments can't be restored on their own ---
+	f, _ := os.Open(archives[0].Path)
+	defer f.Close()
+	if _, _, _, err := readSnapshot(f, nil); err == nil {
+		t.Error("expected reading an increment as a snapshot to fail, but it succeeded")
+	}
+
+	// --- Test Case 4: The next baseline is full, and retention keeps what it needs ---
+	apply(`{"op":"ARCHIVE"}`) // 57: full
+	apply(`{"op":"ARCHIVE"}`) // 58: from 57
+	archives, _ = archiver.List()
+	if len(archives) != 2 || archives[1].Index != 57 || archives[1].Base != 0 || archives[0].Base != 57 {
+		t.Errorf("expected only 58 -> 57 to be kept, but got %+v", archives)
+	}
+}
+
+func TestDigestAt(t *testing.T) {
+	wal, err := persistence.NewWAL(filepath.Join(t.TempDir(), "app.wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	st := store.NewStore()
+	fsm := NewFSM(st, wal)
+	fsm.Apply(&raft.Log{Index: 1, Term: 1, Data: []byte(`{"op":"SET","key":"a","value":"1"}`)})
+	fsm.Apply(&raft.Log{Index: 2, Term: 1, Data: []byte(`{"op":"SET","key":"b","value":"2"}`)})
+	atMarker := StateHash(st.SnapshotView())
+
+	// --- Test Case 1: A DIGEST marker reports its index and changes nothing ---
+	if resp := fsm.Apply(&raft.Log{Index: 3, Term: 1, Data: []byte(`{"op":"DIGEST"}`)}); resp != uint64(3) {
+		t.Errorf("expected the marker to report index 3, but got %v", resp)
+	}
+	fsm.Apply(&raft.Log{Index: 4, Term: 1, Data: []byte(`{"op":"SET","key":"a","value":"changed"}`)})
+
+	// --- Test Case 2: The digest at the marker ignores later writes ---
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	d, err := fsm.DigestAt(ctx, 3)
+	if err != nil || d.Hash != atMarker || d.Keys != 2 {
+		t.Errorf("expected the hash of the store at index 3, but got %+v (err %v)", d, err)
+	}
+
+	// --- Test Case 3: Index 0 hashes the store as it is now ---
+	if d, _ := fsm.DigestAt(ctx, 0); d.Index != 4 || d.Hash != StateHash(st.SnapshotView()) {
+		t.Errorf("expected the current hash at index 4, but got %+v", d)
+	}
+
+	// --- Test Case 4: A passed index without a marker is unavailable ---
+	if _, err := fsm.DigestAt(ctx, 2); !errors.Is(err, ErrDigestUnavailable) {
+		t.Errorf("expected ErrDigestUnavailable, but got %v", err)
+	}
+
+	// --- Test Case 5: A future index is waited for ---
+	go fsm.Apply(&raft.Log{Index: 5, Term: 1, Data: []byte(`{"op":"DIGEST"}`)})
+	if d, err := fsm.DigestAt(ctx, 5); err != nil || d.Index != 5 {
+		t.Errorf("expected the digest at index 5, but got %+v (err %v)", d, err)
+	}
+	short, cancelShort := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancelShort()
+	if _, err := fsm.DigestAt(short, 9); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the wait to time out, but got %v", err)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	wal, err := persistence.NewWAL(filepath.Join(t.TempDir(), "app.wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	st := store.NewStore()
+	fsm := NewFSM(st, wal)
+	history := NewHistory(2)
+	fsm.SetHistory(history)
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	apply := func(index uint64, cmd string) {
+		fsm.Apply(&raft.Log{Index: index, Term: 1, AppendedAt: at, Data: []byte(cmd)})
+	}
+	apply(1, `{"op":"SET","key":"a","value":"1"}`)
+	apply(2, `{"op":"SET","key":"a","value":"2","principal":"user:alice","request_id":"r2"}`)
+	apply(3, `{"op":"CAS","key":"a","value":"lost","expected_version":1}`)
+	apply(4, `{"op":"DELETE","key":"a"}`)
+	apply(5, `{"op":"DELETE","key":"a"}`)
+
+	// --- Test Case 1: The newest versions are kept, newest first ---
+	versions := history.Versions("a")
+	if len(versions) != 2 {
+		t.Fatalf("expected 2 versions, but got %+v", versions)
+	}
+	if v := versions[0]; v.Version != 3 || !v.Deleted || v.Index != 4 {
+		t.Errorf("expected the delete at index 4 first, but got %+v", v)
+	}
+	if v := versions[1]; v.Version != 2 || v.Value != "2" || v.Writer != "user:alice" || v.RequestID != "r2" || !v.Time.Equal(at) {
+		t.Errorf("expected alice's write of 2, but got %+v", v)
+	}
+
+	// --- Test Case 2: Purging the tombstone forgets the history ---
+	apply(6, `{"op":"PURGE_TOMBSTONES","purge":{"a":3}}`)
+	if versions := history.Versions("a"); len(versions) != 0 {
+		t.Errorf("expected no history after the purge, but got %+v", versions)
+	}
+}
+
+func TestWatchHub(t *testing.T) {
+	wal, err := persistence.NewWAL(filepath.Join(t.TempDir(), "app.wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	st := store.NewStore()
+	fsm := NewFSM(st, wal)
+	hub := watch.NewHub(0)
+	fsm.SetWatchHub(hub)
+	w, err := hub.Watch("", true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apply := func(index uint64, cmd string) {
+		fsm.Apply(&raft.Log{Index: index, Term: 1, Data: []byte(cmd)})
+	}
+	apply(1, `{"op":"SET","key":"a","value":"1"}`)
+	apply(2, `{"op":"CAS","key":"a","value":"lost","expected_version":7}`)
+	apply(3, `{"op":"DELETE","key":"a"}`)
+	apply(4, `{"op":"DELETE","key":"a"}`)
+	apply(5, `{"op":"BATCH","write_set":[{"key":"b","value":"2"},{"key":"c","value":"3"}]}`)
+
+	// --- Test Case 1: Each change is published at its log index ---
+	var got []string
+	for len(w.Events()) > 0 {
+		e := <-w.Events()
+		got = append(got, fmt.Sprintf("%d %s %s=%s v%d", e.Revision, e.Type, e.Key, e.Value, e.Version))
+	}
+	want := []string{"1 PUT a=1 v1", "3 DELETE a= v2", "5 PUT b=2 v1", "5 PUT c=3 v1"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected events %q, but got %q", want, got)
+	}
+
+	// --- Test Case 2: Restoring a snapshot cancels watchers ---
+	snap, err := fsm.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sink bufferSink
+	if err := snap.Persist(&sink); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsm.Restore(io.NopCloser(&sink)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-w.Events(); ok || !errors.Is(w.Err(), watch.ErrCompacted) {
+		t.Errorf("expected the watcher to be cancelled with ErrCompacted, but got %v", w.Err())
+	}
+	if revision, _ := hub.Revision(); revision != 5 {
+		t.Errorf("expected the hub at the snapshot's revision 5, but got %d", revision)
+	}
+}
+
+func TestScheduledWrites(t *testing.T) {
+	wal, err := persistence.NewWAL(filepath.Join(t.TempDir(), "app.wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	st := store.NewStore()
+	fsm := NewFSM(st, wal)
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	var index uint64
+	apply := func(cmd Command) interface{} {
+		data, _ := json.Marshal(cmd)
+		index++
+		return fsm.Apply(&raft.Log{Index: index, Data: data})
+	}
+	apply(Command{Op: "SCHEDULE", Schedule: &store.ScheduledWrite{ID: "late", At: now.Add(time.Hour), Key: "b", Value: "2"}})
+	apply(Command{Op: "SCHEDULE", Schedule: &store.ScheduledWrite{ID: "due", At: now.Add(-time.Second), Key: "a", Value: "1"}})
+	apply(Command{Op: "SCHEDULE", Schedule: &store.ScheduledWrite{ID: "cancelled", At: now, Key: "c", Value: "3"}})
+
+	// --- Test Case 1: Only writes whose time has come are due, earliest first ---
+	if due := fsm.DueWrites(now, 10); strings.Join(due, ",") != "due,cancelled" {
+		t.Errorf("expected due and cancelled to be due, but got %v", due)
+	}
+
+	// --- Test Case 2: Cancelled writes are skipped when run ---
+	if n := apply(Command{Op: "UNSCHEDULE", ScheduleIDs: []string{"cancelled", "unknown"}}); n != 1 {
+		t.Errorf("expected 1 write cancelled, but got %v", n)
+	}
+	keys := apply(Command{Op: "RUN_SCHEDULED", ScheduleIDs: []string{"due", "cancelled"}})
+	if keys, _ := keys.([]string); len(keys) != 1 || keys[0] != "a" {
+		t.Errorf("expected only a to be written, but got %v", keys)
+	}
+	if vv, ok := st.Get("a"); !ok || vv.Value != "1" {
+		t.Errorf("expected a to be 1, but got %+v", vv)
+	}
+	if _, ok := st.Get(store.ScheduleKey("due")); ok {
+		t.Error("expected the run write to be unscheduled, but it was not")
+	}
+
+	// --- Test Case 3: The FSM keeps its index current as it applies ---
+	apply(Command{Op: "RUN_SCHEDULED", ScheduleIDs: []string{"late"}})
+	if due := fsm.DueWrites(now.Add(2*time.Hour), 10); len(due) != 0 {
+		t.Errorf("expected nothing left to run, but got %v", due)
+	}
+	if _, ok := st.Get("b"); !ok {
+		t.Error("expected b to be written, but it was not")
+	}
+
+	// --- Test Case 4: Only the writes over a quota are dropped ---
+	apply(Command{Op: "QUOTA", Key: "full/", Value: `{"max_keys":1}`})
+	apply(Command{Op: "QUOTA", Key: "roomy/", Value: `{"max_keys":10}`})
+	apply(Command{Op: "SET", Key: "full/1", Value: "x"})
+	apply(Command{Op: "SCHEDULE", Schedule: &store.ScheduledWrite{ID: "over", At: now, Key: "full/2", Value: "x"}})
+	apply(Command{Op: "SCHEDULE", Schedule: &store.ScheduledWrite{ID: "under", At: now, Key: "roomy/1", Value: "x"}})
+	keys = apply(Command{Op: "RUN_SCHEDULED", ScheduleIDs: []string{"over", "under"}})
+	if keys, _ := keys.([]string); len(keys) != 1 || keys[0] != "roomy/1" {
+		t.Errorf("expected only roomy/1 to be written, but got %v", keys)
+	}
+	if _, ok := st.Get("full/2"); ok {
+		t.Error("expected full/2 to be dropped, but it was written")
+	}
+	if due := fsm.DueWrites(now.Add(2*time.Hour), 10); len(due) != 0 {
+		t.Errorf("expected the dropped write to be unscheduled, but got %v", due)
+	}
+}
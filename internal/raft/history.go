@@ -0,0 +1,102 @@
+package raft
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// KeyVersion is one version of a key recorded by a History.
+type KeyVersion struct {
+	Version   uint64
+	Value     string
+	Deleted   bool
+	Index     uint64    // Raft log index of the write
+	Time      time.Time // When the leader appended the write to its log
+	Writer    string    // Principal that made the write, if the leader audits writes
+	RequestID string
+}
+
+// History keeps the most recent versions of every key written since the
+// node started, for debugging how a key got its value. It is kept in memory
+// only, by every replica.
+type History struct {
+	mu    sync.RWMutex
+	limit int
+	keys  map[string][]KeyVersion // Oldest first, at most limit per key
+}
+
+// NewHistory returns a History that keeps up to limit versions of each key.
+func NewHistory(limit int) *History {
+	return &History{limit: limit, keys: make(map[string][]KeyVersion)}
+}
+
+// Versions returns the recorded versions of key, newest first.
+func (h *History) Versions(key string) []KeyVersion {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	recorded := h.keys[key]
+	versions := make([]KeyVersion, len(recorded))
+	for i, v := range recorded {
+		versions[len(recorded)-1-i] = v
+	}
+	return versions
+}
+
+// record adds v to the history of key, unless it is the version already
+// recorded last, as after deleting a key that does not exist.
+func (h *History) record(key string, v KeyVersion) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	versions := h.keys[key]
+	if n := len(versions); n > 0 && versions[n-1].Version == v.Version && versions[n-1].Deleted == v.Deleted {
+		return
+	}
+	if len(versions) == h.limit {
+		versions = append(versions[:0], versions[1:]...)
+	}
+	h.keys[key] = append(versions, v)
+}
+
+// forget drops the history of key.
+func (h *History) forget(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.keys, key)
+}
+
+// SetHistory makes the FSM record every write it applies in h.
+func (f *FSM) SetHistory(h *History) {
+	f.applyMu.Lock()
+	defer f.applyMu.Unlock()
+	f.history = h
+}
+
+// recordHistory records the keys cmd, from logEntry, wrote, as they are in
+// the store after applying it with result res. The caller must hold applyMu.
+func (f *FSM) recordHistory(logEntry *raft.Log, cmd Command, res interface{}) {
+	if _, failed := res.(error); failed {
+		return
+	}
+	if cmd.Op == "PURGE_TOMBSTONES" {
+		// A purged key's versions start again, so its history does too.
+		for k := range cmd.Purge {
+			if _, ok := f.store.Tombstone(k); !ok {
+				f.history.forget(k)
+			}
+		}
+		return
+	}
+	for _, key := range writtenKeys(cmd, res) {
+		v := KeyVersion{Index: logEntry.Index, Time: logEntry.AppendedAt, Writer: cmd.Principal, RequestID: cmd.RequestID}
+		if vv, ok := f.store.Get(key); ok {
+			v.Version, v.Value = vv.Version, vv.Value
+		} else if t, ok := f.store.Tombstone(key); ok {
+			v.Version, v.Deleted = t.Version, true
+		} else {
+			continue
+		}
+		f.history.record(key, v)
+	}
+}
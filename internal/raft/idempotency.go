@@ -0,0 +1,84 @@
+package raft
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ASHISH26940/heliosdb/internal/store"
+	"github.com/hashicorp/raft"
+)
+
+// ExpiredIdempotencyKeys returns the records of transactions committed with
+// an idempotency key that expired before now, by hash, with the versions
+// they are stored at.
+func ExpiredIdempotencyKeys(st *store.Store, now time.Time) map[string]uint64 {
+	expired := make(map[string]uint64)
+	st.Iterate(func(key string, vv store.VersionedValue) bool {
+		hash, ok := strings.CutPrefix(key, store.IdempotencyPrefix)
+		if !ok {
+			return true
+		}
+		var rec store.IdempotencyRecord
+		if err := json.Unmarshal([]byte(vv.Value), &rec); err != nil || !now.Before(rec.Expires) {
+			expired[hash] = vv.Version
+		}
+		return true
+	})
+	return expired
+}
+
+// PurgeIdempotencyKeys proposes forgetting the expired idempotency records,
+// and returns how many were proposed. It must run on the leader. Like
+// PurgeTombstones, the command names each record and its version, so every
+// replica forgets the same ones whatever its own clock says.
+func PurgeIdempotencyKeys(r *raft.Raft, st *store.Store, timeout time.Duration) (int, error) {
+	expired := ExpiredIdempotencyKeys(st, time.Now())
+	purged := 0
+	for len(expired) > 0 {
+		chunk := make(map[string]uint64, min(len(expired), maxPurgeKeys))
+		for k, version := range expired {
+			if len(chunk) == maxPurgeKeys {
+				break
+			}
+			chunk[k] = version
+			delete(expired, k)
+		}
+		data, err := json.Marshal(Command{Op: "PURGE_IDEMPOTENCY", Purge: chunk})
+		if err != nil {
+			return purged, err
+		}
+		if err := r.Apply(data, timeout).Error(); err != nil {
+			return purged, err
+		}
+		purged += len(chunk)
+	}
+	return purged, nil
+}
+
+// RunIdempotencyPurger purges expired idempotency records while this node
+// is the leader, checking a tenth as often as ttl, the time they are kept
+// for, until stop is closed. A ttl of 0 or less means none are written.
+func RunIdempotencyPurger(r *raft.Raft, st *store.Store, ttl time.Duration, stop <-chan struct{}) {
+	if ttl <= 0 {
+		return
+	}
+	ticker := time.NewTicker(min(max(ttl/10, time.Second), time.Hour))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if r.State() != raft.Leader {
+			continue
+		}
+		if n, err := PurgeIdempotencyKeys(r, st, 10*time.Second); err != nil {
+			log.Printf("Idempotency: Failed to purge: %v", err)
+		} else if n > 0 {
+			log.Printf("Idempotency: Purged %d expired keys", n)
+		}
+	}
+}
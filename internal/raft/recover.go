@@ -0,0 +1,136 @@
+package raft
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/ASHISH26940/heliosdb/internal/persistence"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+	"github.com/hashicorp/raft"
+)
+
+// errStopScan ends a WAL scan early.
+var errStopScan = errors.New("stop scan")
+
+// Recovery describes how Recover rebuilt the store.
+type Recovery struct {
+	SnapshotIndex uint64 // Log index of the snapshot the store was loaded from; 0 if the whole WAL was replayed
+	Index         uint64 // Log index of the last entry reflected in the store
+
+	// SkipRestore is set when the store is at least as new as the newest
+	// snapshot. Raft must then be started with NoSnapshotRestoreOnStart, so
+	// that it does not replace the store with the older snapshot.
+	SkipRestore bool
+}
+
+// Recover rebuilds st at startup from the newest snapshot in snapshots and
+// only the WAL records after it, instead of the whole WAL history. Raft then
+// replays its log from the snapshot index, and FSM.SetAppliedIndex(Index)
+// skips the entries the WAL already covered.
+//
+// The whole WAL is replayed instead if there is no snapshot, if it cannot be
+// read, or if the WAL was compacted after the snapshot was taken: compaction
+// rewrites the WAL as a full copy of the store, which is then newer.
+func Recover(st DataStore, snapshots raft.SnapshotStore, walPath string, k *persistence.Keyring, workers int) (Recovery, error) {
+	var rec Recovery
+	metas, err := snapshots.List()
+	if err != nil {
+		return rec, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	if len(metas) > 0 {
+		compacted, err := compactedIndex(walPath, k)
+		if err != nil {
+			return rec, err
+		}
+		if compacted >= metas[0].Index {
+			rec.SkipRestore = true
+		} else if err := loadSnapshot(st, snapshots, metas[0].ID, k); err != nil {
+			log.Printf("Recovery: Ignoring snapshot %s, replaying the whole WAL: %v", metas[0].ID, err)
+		} else {
+			rec.SnapshotIndex = metas[0].Index
+			rec.SkipRestore = true
+		}
+	}
+
+	rec.Index, err = replayWALAfter(st, walPath, k, workers, rec.SnapshotIndex)
+	return rec, err
+}
+
+// loadSnapshot replaces the contents of st with the snapshot with the given ID.
+// k opens the snapshot if it is encrypted.
+func loadSnapshot(st DataStore, snapshots raft.SnapshotStore, id string, k *persistence.Keyring) error {
+	_, rc, err := snapshots.Open(id)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	data, tombstones, _, err := readSnapshot(rc, k)
+	if err != nil {
+		return err
+	}
+	st.Restore(data, tombstones)
+	return nil
+}
+
+// compactedIndex returns the log index of the LOAD records at the start of a
+// compacted WAL, or 0 if the WAL has not been compacted.
+func compactedIndex(walPath string, k *persistence.Keyring) (uint64, error) {
+	var index uint64
+	err := persistence.Replay(walPath, k, func(cmdBytes []byte) error {
+		var cmd Command
+		if err := json.Unmarshal(cmdBytes, &cmd); err != nil {
+			return err
+		}
+		if cmd.Op == "LOAD" {
+			index = cmd.Index
+		}
+		return errStopScan
+	})
+	if err != nil && !errors.Is(err, errStopScan) {
+		return 0, err
+	}
+	return index, nil
+}
+
+// ForceConfiguration replaces the cluster configuration in a stopped node's
+// Raft state with servers, for when a majority of the cluster is lost for
+// good and no leader can ever be elected again. The node's log is applied
+// on top of its newest snapshot, including entries that were never
+// committed, and the result is written as a new snapshot holding the new
+// configuration, which replaces the log. It returns that snapshot's index.
+//
+// Every server in the new configuration must start from this node's data,
+// or from none, and the lost servers must never rejoin with their old data.
+func ForceConfiguration(nodeID string, logs raft.LogStore, stable raft.StableStore, snapshots raft.SnapshotStore, servers []raft.Server, opts SnapshotOptions) (uint64, error) {
+	// The FSM only turns the log into a snapshot; its WAL is thrown away.
+	dir, err := os.MkdirTemp("", "heliosdb-recover-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(dir)
+	wal, err := persistence.NewWAL(filepath.Join(dir, "app.wal"))
+	if err != nil {
+		return 0, err
+	}
+	defer wal.Close()
+	fsm := NewFSM(store.NewStore(), wal)
+	fsm.SetSnapshotOptions(opts)
+
+	conf := raft.DefaultConfig()
+	conf.LocalID = raft.ServerID(nodeID)
+	conf.LogOutput = io.Discard
+	_, trans := raft.NewInmemTransport("")
+	if err := raft.RecoverCluster(conf, fsm, logs, stable, snapshots, trans, raft.Configuration{Servers: servers}); err != nil {
+		return 0, err
+	}
+	metas, err := snapshots.List()
+	if err != nil || len(metas) == 0 {
+		return 0, fmt.Errorf("failed to find the recovery snapshot: %v", err)
+	}
+	return metas[0].Index, nil
+}
@@ -0,0 +1,93 @@
+package raft
+
+import (
+	"encoding/json"
+	"strings"
+	"sync/atomic"
+
+	"github.com/ASHISH26940/heliosdb/internal/persistence"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+)
+
+// ReplayWAL rebuilds the store from the WAL, applying single-key commands in
+// parallel across the given number of workers. It returns the highest Raft
+// log index recorded in the WAL, to be passed to FSM.SetAppliedIndex, or 0 if
+// the WAL predates recorded indexes.
+func ReplayWAL(st DataStore, walPath string, k *persistence.Keyring, workers int) (uint64, error) {
+	return replayWALAfter(st, walPath, k, workers, 0)
+}
+
+// replayWALAfter is ReplayWAL, skipping records at or below the log index
+// after when it is non-zero. Records written before indexes were recorded are
+// skipped too, as they precede every indexed one.
+func replayWALAfter(st DataStore, walPath string, k *persistence.Keyring, workers int, after uint64) (uint64, error) {
+	var last atomic.Uint64
+	last.Store(after)
+	apply := func(cmdBytes []byte) error {
+		var cmd Command
+		if err := json.Unmarshal(cmdBytes, &cmd); err != nil {
+			return err
+		}
+		if after != 0 && cmd.Index <= after {
+			return nil
+		}
+		// A failed script was a no-op when it was first applied, so it is one now too.
+		ApplyCommand(st, cmd)
+		for {
+			cur := last.Load()
+			if cmd.Index <= cur || last.CompareAndSwap(cur, cmd.Index) {
+				return nil
+			}
+		}
+	}
+	if err := persistence.ReplayParallel(walPath, k, workers, replayPartition(st), apply); err != nil {
+		return 0, err
+	}
+	return last.Load(), nil
+}
+
+// replayPartition returns the partition function that replays the WAL into
+// st: the key of a command that may be applied in parallel with those of
+// other keys, or "" for one that must be applied in order.
+func replayPartition(st DataStore) func(cmdBytes []byte) (string, error) {
+	// Whether a write fits its namespace's quota depends on every earlier
+	// write to the namespace, so once there are quotas, writes are applied
+	// in order too.
+	quotas := false
+	if q, ok := st.(interface{ NamespaceUsage() []store.Usage }); ok {
+		quotas = len(q.NamespaceUsage()) > 0
+	}
+	return func(cmdBytes []byte) (string, error) {
+		// Partitioning runs on the single goroutine that reads the WAL, so it
+		// decodes only what it needs and leaves values to the workers.
+		var cmd struct {
+			Op   string `json:"op"`
+			Key  string `json:"key"`
+			Load []struct {
+				Key     string `json:"k"`
+				Deleted bool   `json:"del"`
+			} `json:"load"`
+		}
+		if err := json.Unmarshal(cmdBytes, &cmd); err != nil {
+			return "", err
+		}
+		switch cmd.Op {
+		case "SET", "DELETE", "CAS":
+			if !quotas {
+				return cmd.Key, nil
+			}
+		case "QUOTA":
+			quotas = true
+		case "LOAD":
+			// A compacted WAL starts with the quotas among the keys it loads.
+			for _, e := range cmd.Load {
+				if !e.Deleted && strings.HasPrefix(e.Key, store.QuotaPrefix) {
+					quotas = true
+				}
+			}
+		}
+		// Transactions and scripts touch several keys, and maintenance mode
+		// changes how every later command applies, so they are applied in order.
+		return "", nil
+	}
+}
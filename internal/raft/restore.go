@@ -0,0 +1,157 @@
+package raft
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/ASHISH26940/heliosdb/internal/persistence"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+	"github.com/hashicorp/raft"
+)
+
+// RestorePoint is a snapshot or archive chosen to rebuild a node from, read
+// into memory so that it is known to be whole before local state is thrown
+// away.
+type RestorePoint struct {
+	Source string // What the point was read from, for logging
+	Index  uint64 // Log index the point reflects
+
+	data       map[string]store.VersionedValue
+	tombstones map[string]store.Tombstone
+}
+
+// Keys returns the number of live keys in the point.
+func (p *RestorePoint) Keys() int {
+	return len(p.data)
+}
+
+// OpenRestorePoint reads the snapshot or archive ref names, which is one of:
+//
+//   - the ID of a snapshot in snapshots,
+//   - the log index of an archive in archives, which may be nil,
+//   - the path of a snapshot directory, its state.bin, or an archive file.
+//
+// k opens the point if it is encrypted. It fails if the point would leave a
+// gap in the log: Raft resumes applying after its own newest snapshot, so
+// entries between an older point and that snapshot would never be applied.
+func OpenRestorePoint(ref string, snapshots raft.SnapshotStore, archives *Archiver, k *persistence.Keyring) (*RestorePoint, error) {
+	p, err := readRestorePoint(ref, snapshots, archives, k)
+	if err != nil {
+		return nil, err
+	}
+	if p.Index == 0 {
+		return nil, fmt.Errorf("%s does not record the log index it reflects", p.Source)
+	}
+	metas, err := snapshots.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	if len(metas) > 0 && metas[0].Index > p.Index {
+		return nil, fmt.Errorf("%s is at log index %d, older than this node's newest snapshot %s at index %d; restore that snapshot or a newer archive instead",
+			p.Source, p.Index, metas[0].ID, metas[0].Index)
+	}
+	return p, nil
+}
+
+// readRestorePoint resolves ref as OpenRestorePoint describes and reads it.
+func readRestorePoint(ref string, snapshots raft.SnapshotStore, archives *Archiver, k *persistence.Keyring) (*RestorePoint, error) {
+	p := &RestorePoint{Source: ref}
+	var err error
+	if info, statErr := os.Stat(ref); statErr == nil {
+		path := ref
+		if info.IsDir() {
+			path = filepath.Join(ref, "state.bin")
+		}
+		if ar, ok := parseArchiveName(filepath.Base(path)); ok {
+			p.Source = "archive " + path
+			p.Index = ar.Index
+			p.data, p.tombstones, err = NewArchiver(filepath.Dir(path), 0).Load(ar.Index, k)
+			return p, err
+		}
+		p.Source = "snapshot " + path
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		p.data, p.tombstones, p.Index, err = readSnapshot(f, k)
+		return p, err
+	}
+
+	if _, rc, err := snapshots.Open(ref); err == nil {
+		defer rc.Close()
+		p.Source = "snapshot " + ref
+		p.data, p.tombstones, p.Index, err = readSnapshot(rc, k)
+		return p, err
+	}
+	if index, parseErr := strconv.ParseUint(ref, 10, 64); parseErr == nil && archives != nil {
+		p.Source = "archive " + ref
+		p.Index = index
+		p.data, p.tombstones, err = archives.Load(index, k)
+		return p, err
+	}
+	return nil, errors.New("no snapshot, archive or file named " + ref)
+}
+
+// WriteWAL replaces the WAL at walPath with the contents of the point, in
+// the LOAD records a compacted WAL starts with. Recover then rebuilds the
+// store from it alone, and Raft skips the log entries it already reflects.
+// The caller must first move the old WAL aside.
+func (p *RestorePoint) WriteWAL(walPath string, k *persistence.Keyring) error {
+	if _, err := os.Stat(walPath); err == nil {
+		return fmt.Errorf("WAL %s still exists", walPath)
+	}
+	tmp := walPath + ".restore"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	wal, err := persistence.NewEncryptedWAL(tmp, k)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(p.data))
+	for key := range p.data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var batch []LoadEntry
+	size := 0
+	emit := func() error {
+		err := wal.WriteCommand(Command{Op: "LOAD", Load: batch, Index: p.Index})
+		batch, size = nil, 0
+		return err
+	}
+	for _, key := range keys {
+		value := p.data[key]
+		batch = append(batch, LoadEntry{Key: key, Value: value.Value, Version: value.Version})
+		if size += len(key) + len(value.Value); size >= loadChunkBytes {
+			if err := emit(); err != nil {
+				wal.Close()
+				return err
+			}
+		}
+	}
+	// Tombstones follow, so replay keeps the versions of deleted keys.
+	for key, t := range p.tombstones {
+		batch = append(batch, LoadEntry{Key: key, Version: t.Version, Deleted: true})
+		if size += len(key); size >= loadChunkBytes {
+			if err := emit(); err != nil {
+				wal.Close()
+				return err
+			}
+		}
+	}
+	// The last record is written even if empty: it carries the index.
+	if err := emit(); err != nil {
+		wal.Close()
+		return err
+	}
+	if err := wal.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, walPath)
+}
@@ -0,0 +1,109 @@
+package raft
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ASHISH26940/heliosdb/internal/store"
+	"github.com/hashicorp/raft"
+)
+
+// Scheduler timing: how often the leader looks for due writes, and the most
+// it applies in one RUN_SCHEDULED command.
+const (
+	scheduleTick       = 100 * time.Millisecond
+	maxScheduledPerRun = 1000
+)
+
+// DueWrites returns the IDs of up to limit scheduled writes due at now,
+// earliest first.
+func (f *FSM) DueWrites(now time.Time, limit int) []string {
+	f.applyMu.Lock()
+	defer f.applyMu.Unlock()
+	if f.scheduled == nil {
+		f.loadSchedule()
+	}
+	var due []string
+	for id, at := range f.scheduled {
+		if !at.After(now) {
+			due = append(due, id)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		a, b := f.scheduled[due[i]], f.scheduled[due[j]]
+		return a.Before(b) || (a.Equal(b) && due[i] < due[j])
+	})
+	return due[:min(len(due), limit)]
+}
+
+// loadSchedule indexes the scheduled writes in the store, which the FSM
+// then keeps up to date as it applies commands. The caller must hold
+// applyMu.
+func (f *FSM) loadSchedule() {
+	f.scheduled = make(map[string]time.Time)
+	f.store.SnapshotView().Iterate(func(key string, value store.VersionedValue) bool {
+		if strings.HasPrefix(key, store.SchedulePrefix) {
+			var w store.ScheduledWrite
+			if err := json.Unmarshal([]byte(value.Value), &w); err != nil {
+				log.Printf("Scheduler: Ignoring unreadable scheduled write %q: %v", key, err)
+				return true
+			}
+			f.scheduled[w.ID] = w.At
+		}
+		return true
+	})
+}
+
+// indexSchedule updates the index of scheduled writes for cmd, applied with
+// result res. The caller must hold applyMu.
+func (f *FSM) indexSchedule(cmd Command, res interface{}) {
+	if _, failed := res.(error); failed {
+		return
+	}
+	switch cmd.Op {
+	case "SCHEDULE":
+		f.scheduled[cmd.Schedule.ID] = cmd.Schedule.At
+	case "UNSCHEDULE", "RUN_SCHEDULED":
+		for _, id := range cmd.ScheduleIDs {
+			delete(f.scheduled, id)
+		}
+	}
+}
+
+// RunScheduler applies scheduled writes once they are due, while this node
+// is the leader, until stop is closed. Each batch is committed as one
+// RUN_SCHEDULED command, so every replica applies the same writes at the
+// same log position whatever its own clock says. Writes wait while the
+// cluster is in maintenance mode.
+func RunScheduler(r *raft.Raft, f *FSM, stop <-chan struct{}) {
+	ticker := time.NewTicker(scheduleTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if r.State() != raft.Leader {
+			continue
+		}
+		if _, ok := f.store.Get(store.MaintenanceKey); ok {
+			continue
+		}
+		due := f.DueWrites(time.Now(), maxScheduledPerRun)
+		if len(due) == 0 {
+			continue
+		}
+		data, err := json.Marshal(Command{Op: "RUN_SCHEDULED", ScheduleIDs: due})
+		if err != nil {
+			log.Printf("Scheduler: Failed to encode due writes: %v", err)
+			continue
+		}
+		if err := r.Apply(data, 10*time.Second).Error(); err != nil {
+			log.Printf("Scheduler: Failed to apply %d due writes: %v", len(due), err)
+		}
+	}
+}
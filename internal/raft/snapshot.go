@@ -0,0 +1,204 @@
+package raft
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/ASHISH26940/heliosdb/internal/persistence"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+	"github.com/hashicorp/raft"
+	"github.com/klauspost/compress/zstd"
+)
+
+// zstdMagic begins every zstd frame. A snapshot that starts with it is
+// compressed; JSON never does.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// SnapshotOptions controls how the FSM writes snapshots and archives.
+// Readers detect the format of each snapshot, so changing them leaves
+// snapshots already written readable.
+type SnapshotOptions struct {
+	Compress bool                 // zstd-compress the stream
+	Encrypt  bool                 // Seal the stream with Keyring's active key
+	Keyring  *persistence.Keyring // Also opens encrypted snapshots, whether or not Encrypt is set
+}
+
+// snapshotEntry is one key in a snapshot. Snapshots are a stream of these,
+// one JSON object per line, in ascending key order, followed by the
+// tombstones of deleted keys (with Deleted set), also in key order. A
+// snapshot may begin with a header entry that carries only Index, the last
+// log entry it reflects.
+//
+// An incremental archive's header also carries Base, the index of the
+// archive it builds on, and its entries are only the keys and tombstones
+// that changed since, followed by Forget entries for keys no longer held at
+// all. Only an Archiver reads those.
+type snapshotEntry struct {
+	Key     string `json:"k,omitempty"`
+	Value   string `json:"v,omitempty"`
+	Version uint64 `json:"ver,omitempty"`
+	Deleted bool   `json:"del,omitempty"`
+	Forget  bool   `json:"forget,omitempty"`
+	Index   uint64 `json:"index,omitempty"`
+	Base    uint64 `json:"base,omitempty"`
+}
+
+// fsmSnapshot writes a store view to a Raft snapshot sink.
+type fsmSnapshot struct {
+	view  *store.View
+	index uint64 // Index of the last log entry the view reflects
+	opts  SnapshotOptions
+}
+
+// Persist writes every key of the view to sink.
+func (s *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+	if err := writeSnapshot(sink, s.view, s.index, s.opts); err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+// Release is a no-op; the view is garbage collected.
+func (s *fsmSnapshot) Release() {}
+
+// writeSnapshot writes view, reflecting the log up to index, to w.
+// The stream is compressed before it is encrypted, as ciphertext does not
+// compress.
+func writeSnapshot(w io.Writer, view *store.View, index uint64, opts SnapshotOptions) error {
+	return writeStream(w, opts, func(w io.Writer) error {
+		return writeSnapshotEntries(w, view, index)
+	})
+}
+
+// writeStream compresses and encrypts what write writes to w, as opts says.
+func writeStream(w io.Writer, opts SnapshotOptions, write func(w io.Writer) error) error {
+	if opts.Encrypt && opts.Keyring == nil {
+		return errors.New("snapshot encryption needs an encryption key")
+	}
+	var sealer *persistence.SealWriter
+	if opts.Encrypt {
+		sealer = persistence.NewSealWriter(w, opts.Keyring)
+		w = sealer
+	}
+	var zw *zstd.Encoder
+	if opts.Compress {
+		var err error
+		if zw, err = zstd.NewWriter(w); err != nil {
+			return err
+		}
+		w = zw
+	}
+	err := write(w)
+	if zw != nil {
+		if closeErr := zw.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err == nil && sealer != nil {
+		err = sealer.Close()
+	}
+	return err
+}
+
+// writeSnapshotEntries writes the header and entries of view to w.
+func writeSnapshotEntries(w io.Writer, view *store.View, index uint64) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	if index != 0 {
+		if err := enc.Encode(snapshotEntry{Index: index}); err != nil {
+			return err
+		}
+	}
+	var err error
+	view.Iterate(func(key string, value store.VersionedValue) bool {
+		err = enc.Encode(snapshotEntry{Key: key, Value: value.Value, Version: value.Version})
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	view.IterateTombstones(func(key string, t store.Tombstone) bool {
+		err = enc.Encode(snapshotEntry{Key: key, Version: t.Version, Deleted: true})
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// readSnapshot returns the keys and tombstones of a snapshot and the log
+// index it reflects, which is 0 if the snapshot has no header. k opens an
+// encrypted snapshot; it may be nil otherwise.
+func readSnapshot(r io.Reader, k *persistence.Keyring) (map[string]store.VersionedValue, map[string]store.Tombstone, uint64, error) {
+	data := make(map[string]store.VersionedValue)
+	tombstones := make(map[string]store.Tombstone)
+	header, err := readSnapshotEntries(r, k, func(e snapshotEntry) bool {
+		if e.Deleted {
+			tombstones[e.Key] = store.Tombstone{Version: e.Version}
+		} else {
+			data[e.Key] = store.VersionedValue{Value: e.Value, Version: e.Version}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if header.Base != 0 {
+		return nil, nil, 0, errors.New("snapshot is an incremental archive, which holds only some keys")
+	}
+	return data, tombstones, header.Index, nil
+}
+
+// ReadSnapshot streams the keys of a snapshot written by the FSM to fn, in
+// key order, until fn returns false. Tombstones are skipped. It returns the
+// log index the snapshot reflects, which is 0 if the snapshot has no header.
+// k opens an encrypted snapshot; it may be nil otherwise.
+func ReadSnapshot(r io.Reader, k *persistence.Keyring, fn func(key string, value store.VersionedValue) bool) (uint64, error) {
+	header, err := readSnapshotEntries(r, k, func(e snapshotEntry) bool {
+		return e.Deleted || e.Forget || fn(e.Key, store.VersionedValue{Value: e.Value, Version: e.Version})
+	})
+	return header.Index, err
+}
+
+// readSnapshotEntries streams the entries of a snapshot other than its
+// header to fn until fn returns false, and returns the header. The snapshot
+// is decrypted with k and decompressed first, as needed.
+func readSnapshotEntries(r io.Reader, k *persistence.Keyring, fn func(e snapshotEntry) bool) (snapshotEntry, error) {
+	var header snapshotEntry
+	br := bufio.NewReader(r)
+	if prefix, _ := br.Peek(len("enc:")); persistence.IsSealed(prefix) {
+		if k == nil {
+			return header, errors.New("snapshot is encrypted but no encryption key is configured")
+		}
+		br = bufio.NewReader(persistence.NewOpenReader(br, k))
+	}
+	dec := json.NewDecoder(br)
+	if magic, _ := br.Peek(len(zstdMagic)); bytes.Equal(magic, zstdMagic) {
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return header, err
+		}
+		defer zr.Close()
+		dec = json.NewDecoder(zr)
+	}
+	for {
+		var e snapshotEntry
+		if err := dec.Decode(&e); err == io.EOF {
+			return header, nil
+		} else if err != nil {
+			return snapshotEntry{}, err
+		}
+		if e.Index != 0 {
+			header = e
+			continue
+		}
+		if !fn(e) {
+			return header, nil
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package raft
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/ASHISH26940/heliosdb/internal/store"
+	"github.com/hashicorp/raft"
+)
+
+// maxPurgeKeys bounds the tombstones forgotten by one PURGE_TOMBSTONES
+// command, keeping each command well below persistence.MaxRecordSize.
+const maxPurgeKeys = 10000
+
+// PurgeTombstones proposes forgetting the tombstones this node has held for
+// longer than retention, and returns how many were forgotten. It must run on
+// the leader. The command names each tombstone and its version, so every
+// replica forgets the same ones whatever its own clock says.
+func PurgeTombstones(r *raft.Raft, st *store.Store, retention, timeout time.Duration) (int, error) {
+	expired := st.ExpiredTombstones(time.Now().Add(-retention))
+	purged := 0
+	for len(expired) > 0 {
+		chunk := make(map[string]uint64, min(len(expired), maxPurgeKeys))
+		for k, version := range expired {
+			if len(chunk) == maxPurgeKeys {
+				break
+			}
+			chunk[k] = version
+			delete(expired, k)
+		}
+		data, err := json.Marshal(Command{Op: "PURGE_TOMBSTONES", Purge: chunk})
+		if err != nil {
+			return purged, err
+		}
+		future := r.Apply(data, timeout)
+		if err := future.Error(); err != nil {
+			return purged, err
+		}
+		if n, ok := future.Response().(int); ok {
+			purged += n
+		}
+	}
+	return purged, nil
+}
+
+// RunTombstonePurger purges expired tombstones while this node is the
+// leader, checking a tenth as often as retention, until stop is closed. A
+// retention of 0 or less keeps tombstones forever.
+func RunTombstonePurger(r *raft.Raft, st *store.Store, retention time.Duration, stop <-chan struct{}) {
+	if retention <= 0 {
+		return
+	}
+	ticker := time.NewTicker(min(max(retention/10, time.Second), time.Hour))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if r.State() != raft.Leader {
+			continue
+		}
+		if n, err := PurgeTombstones(r, st, retention, 10*time.Second); err != nil {
+			log.Printf("Tombstones: Failed to purge: %v", err)
+		} else if n > 0 {
+			log.Printf("Tombstones: Purged %d older than %s", n, retention)
+		}
+	}
+}
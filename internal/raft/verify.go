@@ -0,0 +1,211 @@
+package raft
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/ASHISH26940/heliosdb/internal/persistence"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+	"github.com/hashicorp/raft"
+)
+
+// maxReportedDiffs bounds the differing keys listed by Verify.
+const maxReportedDiffs = 10
+
+// VerifyReport is the result of Verify. Problems lists everything found
+// wrong; an empty list means the node's state is consistent.
+type VerifyReport struct {
+	WALRecords      int
+	WALLastIndex    uint64
+	WALCompactedAt  uint64 // Index of the LOAD records a compacted WAL starts with; 0 if not compacted
+	LogFirstIndex   uint64
+	LogLastIndex    uint64
+	SnapshotID      string // Newest snapshot; "" if there is none
+	SnapshotIndex   uint64
+	SnapshotKeys    int
+	ComparedAt      uint64 // Log index both rebuilds were compared at; 0 if they could not be
+	WALStateHash    string // Hash of the store as startup recovery rebuilds it from the WAL
+	SnapshotLogHash string // Hash of the snapshot with the Raft log applied on top
+	SkippedReason   string // Why the rebuilds were not compared
+	Problems        []string
+}
+
+// Verify checks a stopped node's on-disk state: that every WAL record and
+// Raft log entry decodes (and, for encrypted WALs, authenticates), that the
+// newest snapshot matches its CRC, and that the store startup recovery
+// rebuilds from the WAL (see Recover) equals the store rebuilt from the
+// snapshot plus the Raft log, at the newest log index both cover.
+func Verify(walPath string, k *persistence.Keyring, logs raft.LogStore, snapshots raft.SnapshotStore) (VerifyReport, error) {
+	var rep VerifyReport
+
+	// --- WAL ---
+	var wal []Command
+	last := uint64(0)
+	err := persistence.Replay(walPath, k, func(cmdBytes []byte) error {
+		rep.WALRecords++
+		var cmd Command
+		if err := json.Unmarshal(cmdBytes, &cmd); err != nil {
+			rep.Problems = append(rep.Problems, fmt.Sprintf("WAL record %d does not decode: %v", rep.WALRecords, err))
+			return nil
+		}
+		if rep.WALRecords == 1 && cmd.Op == "LOAD" {
+			rep.WALCompactedAt = cmd.Index
+		}
+		if cmd.Index != 0 && cmd.Index < last {
+			rep.Problems = append(rep.Problems, fmt.Sprintf("WAL record %d has index %d, after index %d", rep.WALRecords, cmd.Index, last))
+		}
+		last = max(last, cmd.Index)
+		wal = append(wal, cmd)
+		return nil
+	})
+	if err != nil {
+		// Unreadable or unauthenticated records stop the scan.
+		rep.Problems = append(rep.Problems, fmt.Sprintf("WAL record %d cannot be read: %v", rep.WALRecords+1, err))
+	}
+	rep.WALLastIndex = last
+
+	// --- Raft log ---
+	if rep.LogFirstIndex, err = logs.FirstIndex(); err != nil {
+		return rep, err
+	}
+	if rep.LogLastIndex, err = logs.LastIndex(); err != nil {
+		return rep, err
+	}
+	entries := make(map[uint64]Command)
+	for i := rep.LogFirstIndex; i != 0 && i <= rep.LogLastIndex; i++ {
+		var entry raft.Log
+		if err := logs.GetLog(i, &entry); err != nil {
+			rep.Problems = append(rep.Problems, fmt.Sprintf("Raft log entry %d cannot be read: %v", i, err))
+			continue
+		}
+		if entry.Type != raft.LogCommand {
+			continue
+		}
+		var cmd Command
+		if err := json.Unmarshal(entry.Data, &cmd); err != nil {
+			rep.Problems = append(rep.Problems, fmt.Sprintf("Raft log entry %d does not decode: %v", i, err))
+			continue
+		}
+		entries[i] = cmd
+	}
+
+	// --- Snapshot ---
+	snapshotState := store.NewStore()
+	metas, err := snapshots.List()
+	if err != nil {
+		return rep, err
+	}
+	if len(metas) > 0 {
+		rep.SnapshotID, rep.SnapshotIndex = metas[0].ID, metas[0].Index
+		if err := loadSnapshot(snapshotState, snapshots, metas[0].ID, k); err != nil {
+			rep.Problems = append(rep.Problems, fmt.Sprintf("Snapshot %s cannot be read: %v", metas[0].ID, err))
+			return rep, nil
+		}
+		rep.SnapshotKeys = snapshotState.SnapshotView().Len()
+	}
+
+	// --- Compare the two rebuilds ---
+	at := min(rep.WALLastIndex, rep.LogLastIndex)
+	switch {
+	case len(rep.Problems) > 0:
+		rep.SkippedReason = "the WAL or Raft log could not be read in full"
+	case at == 0:
+		rep.SkippedReason = "the WAL or the Raft log is empty, or the WAL predates recorded log indexes"
+	case at < rep.SnapshotIndex || (rep.WALCompactedAt >= rep.SnapshotIndex && at < rep.WALCompactedAt):
+		rep.SkippedReason = fmt.Sprintf("the WAL and the snapshot plus Raft log have no log index in common (up to %d)", at)
+	case rep.LogFirstIndex > rep.SnapshotIndex+1:
+		rep.SkippedReason = fmt.Sprintf("the Raft log starts at %d, leaving a gap after snapshot index %d", rep.LogFirstIndex, rep.SnapshotIndex)
+	}
+	if rep.SkippedReason != "" {
+		return rep, nil
+	}
+
+	walState := store.NewStore()
+	from := uint64(0)
+	if rep.SnapshotID != "" && rep.WALCompactedAt < rep.SnapshotIndex {
+		// As at startup, only the WAL after the snapshot is replayed.
+		if err := loadSnapshot(walState, snapshots, rep.SnapshotID, k); err != nil {
+			return rep, err
+		}
+		from = rep.SnapshotIndex
+	}
+	for _, cmd := range wal {
+		if cmd.Index > at {
+			break
+		}
+		if from == 0 || cmd.Index > from {
+			ApplyCommand(walState, cmd)
+		}
+	}
+	for i := rep.SnapshotIndex + 1; i <= at; i++ {
+		if cmd, ok := entries[i]; ok {
+			ApplyCommand(snapshotState, cmd)
+		}
+	}
+	rep.ComparedAt = at
+	a, b := walState.SnapshotView(), snapshotState.SnapshotView()
+	rep.WALStateHash, rep.SnapshotLogHash = StateHash(a), StateHash(b)
+	if rep.WALStateHash != rep.SnapshotLogHash {
+		rep.Problems = append(rep.Problems, fmt.Sprintf("At log index %d the store rebuilt from the WAL differs from the snapshot plus Raft log", at))
+		for _, key := range diffKeys(a, b, maxReportedDiffs) {
+			va, _ := a.Get(key)
+			vb, _ := b.Get(key)
+			rep.Problems = append(rep.Problems, fmt.Sprintf("  key %q: WAL has version %d, snapshot plus log has version %d", key, va.Version, vb.Version))
+		}
+	}
+	return rep, nil
+}
+
+// StateHash returns a SHA-256 hash of every key, value and version in view,
+// and of its tombstones. Equal hashes mean equal stores.
+func StateHash(view *store.View) string {
+	h := sha256.New()
+	var buf [binary.MaxVarintLen64]byte
+	field := func(s string) {
+		h.Write(buf[:binary.PutUvarint(buf[:], uint64(len(s)))])
+		h.Write([]byte(s))
+	}
+	view.Iterate(func(key string, value store.VersionedValue) bool {
+		field(key)
+		field(value.Value)
+		h.Write(buf[:binary.PutUvarint(buf[:], value.Version)])
+		return true
+	})
+	// Tombstones decide the versions of recreated keys, so they count too.
+	// The count separates them from the keys, which could otherwise be
+	// mistaken for a tombstone.
+	h.Write(buf[:binary.PutUvarint(buf[:], uint64(view.TombstoneCount()))])
+	view.IterateTombstones(func(key string, t store.Tombstone) bool {
+		field(key)
+		h.Write(buf[:binary.PutUvarint(buf[:], t.Version)])
+		return true
+	})
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// diffKeys returns up to limit keys, in order, whose value or version
+// differs between a and b.
+func diffKeys(a, b *store.View, limit int) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	check := func(x, y *store.View) {
+		x.Iterate(func(key string, vx store.VersionedValue) bool {
+			if vy, ok := y.Get(key); (!ok || vx != vy) && !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+			return true
+		})
+	}
+	check(a, b)
+	check(b, a)
+	sort.Strings(keys)
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+	return keys
+}
@@ -0,0 +1,86 @@
+package raft
+
+import (
+	"github.com/ASHISH26940/heliosdb/internal/script"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+	"github.com/ASHISH26940/heliosdb/internal/watch"
+	"github.com/hashicorp/raft"
+)
+
+// writtenKeys returns the keys cmd writes. For EVAL, RUN_SCHEDULED and
+// DELETE_PREFIX, they are the keys written according to its result res.
+func writtenKeys(cmd Command, res interface{}) []string {
+	switch cmd.Op {
+	case "SET", "CAS", "DELETE":
+		return []string{cmd.Key}
+	case "RENAME":
+		return []string{cmd.Key, cmd.Value}
+	case "COPY":
+		return []string{cmd.Value}
+	case "TX_COMMIT", "BATCH":
+		keys := make([]string, 0, len(cmd.WriteSet))
+		for _, op := range cmd.WriteSet {
+			keys = append(keys, op.Key)
+		}
+		return keys
+	case "EVAL":
+		result, _ := res.(script.Result)
+		return result.Keys()
+	case "RUN_SCHEDULED", "DELETE_PREFIX":
+		keys, _ := res.([]string)
+		return keys
+	}
+	return nil
+}
+
+// keyVersions returns the current version of each of keys in the store,
+// counting a tombstone's, or 0 for a key never written.
+func (f *FSM) keyVersions(keys []string) map[string]uint64 {
+	versions := make(map[string]uint64, len(keys))
+	for _, key := range keys {
+		if v, ok := f.store.Get(key); ok {
+			versions[key] = v.Version
+		} else if t, ok := f.store.Tombstone(key); ok {
+			versions[key] = t.Version
+		}
+	}
+	return versions
+}
+
+// SetWatchHub makes the FSM publish every change it applies to h.
+func (f *FSM) SetWatchHub(h *watch.Hub) {
+	f.applyMu.Lock()
+	defer f.applyMu.Unlock()
+	f.hub = h
+}
+
+// publishWrites publishes the changes cmd, from logEntry, made to the store
+// when applied with result res. before holds the versions of the keys cmd
+// writes from before it was applied, so writes that changed nothing, such
+// as deleting a deleted key, are left out. The caller must hold applyMu.
+func (f *FSM) publishWrites(logEntry *raft.Log, cmd Command, res interface{}, before map[string]uint64) {
+	if _, failed := res.(error); failed {
+		return
+	}
+	var events []watch.Event
+	for _, key := range writtenKeys(cmd, res) {
+		if store.IsReserved(key) {
+			continue
+		}
+		e := watch.Event{Revision: logEntry.Index, Key: key, Time: logEntry.AppendedAt}
+		if v, ok := f.store.Get(key); ok {
+			e.Type, e.Value, e.Version = watch.Put, v.Value, v.Version
+		} else if t, ok := f.store.Tombstone(key); ok {
+			e.Type, e.Version = watch.Delete, t.Version
+		} else {
+			continue
+		}
+		if version, ok := before[key]; ok && version == e.Version {
+			continue
+		}
+		events = append(events, e)
+	}
+	if len(events) > 0 {
+		f.hub.Publish(events...)
+	}
+}
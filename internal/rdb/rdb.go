@@ -0,0 +1,523 @@
+// Package rdb reads Redis RDB dump files, to migrate data off Redis. Only
+// string keys are returned; keys of other types are skipped and counted,
+// since HeliosDB has no equivalent for them.
+package rdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Opcodes and value types, from rdb.h in the Redis source.
+const (
+	opFunction2    = 0xF5
+	opModuleAux    = 0xF7
+	opIdle         = 0xF8
+	opFreq         = 0xF9
+	opAux          = 0xFA
+	opResizeDB     = 0xFB
+	opExpireTimeMs = 0xFC
+	opExpireTime   = 0xFD
+	opSelectDB     = 0xFE
+	opEOF          = 0xFF
+
+	typeString          = 0
+	typeList            = 1
+	typeSet             = 2
+	typeZSet            = 3
+	typeHash            = 4
+	typeZSet2           = 5
+	typeZipmap          = 9
+	typeListZiplist     = 10
+	typeSetIntset       = 11
+	typeZSetZiplist     = 12
+	typeHashZiplist     = 13
+	typeListQuicklist   = 14
+	typeStreamListpacks = 15
+	typeHashListpack    = 16
+	typeZSetListpack    = 17
+	typeListQuicklist2  = 18
+	typeStreamListpack2 = 19
+	typeSetListpack     = 20
+	typeStreamListpack3 = 21
+
+	encInt8  = 0
+	encInt16 = 1
+	encInt32 = 2
+	encLZF   = 3
+)
+
+// Entry is one string key read from a dump.
+type Entry struct {
+	DB       int
+	Key      string
+	Value    string
+	ExpireAt time.Time // Zero if the key does not expire
+}
+
+// Reader returns the string keys of an RDB dump, in file order.
+type Reader struct {
+	r       *bufio.Reader
+	version int
+	db      int
+	skipped map[string]int
+}
+
+// NewReader reads the RDB header from r.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReaderSize(r, 64<<10)
+	header := make([]byte, 9)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("rdb: failed to read header: %w", err)
+	}
+	if string(header[:5]) != "REDIS" {
+		return nil, errors.New("rdb: not an RDB file")
+	}
+	version, err := strconv.Atoi(string(header[5:]))
+	if err != nil {
+		return nil, fmt.Errorf("rdb: invalid version %q", header[5:])
+	}
+	return &Reader{r: br, version: version, skipped: make(map[string]int)}, nil
+}
+
+// Version returns the RDB format version of the dump.
+func (r *Reader) Version() int {
+	return r.version
+}
+
+// Skipped returns how many keys of each non-string type were skipped so far.
+func (r *Reader) Skipped() map[string]int {
+	return r.skipped
+}
+
+// Next returns the next string key, or io.EOF at the end of the dump.
+func (r *Reader) Next() (Entry, error) {
+	var expireAt time.Time
+	for {
+		op, err := r.r.ReadByte()
+		if err != nil {
+			return Entry{}, unexpected(err)
+		}
+		switch op {
+		case opEOF:
+			return Entry{}, io.EOF // The checksum that follows is not verified
+		case opSelectDB:
+			db, err := r.length()
+			if err != nil {
+				return Entry{}, err
+			}
+			r.db = int(db)
+		case opResizeDB:
+			if _, err := r.length(); err != nil {
+				return Entry{}, err
+			}
+			if _, err := r.length(); err != nil {
+				return Entry{}, err
+			}
+		case opAux:
+			if err := r.skipStrings(2); err != nil {
+				return Entry{}, err
+			}
+		case opExpireTimeMs:
+			var ms int64
+			if err := binary.Read(r.r, binary.LittleEndian, &ms); err != nil {
+				return Entry{}, unexpected(err)
+			}
+			expireAt = time.UnixMilli(ms)
+		case opExpireTime:
+			var sec int32
+			if err := binary.Read(r.r, binary.LittleEndian, &sec); err != nil {
+				return Entry{}, unexpected(err)
+			}
+			expireAt = time.Unix(int64(sec), 0)
+		case opIdle:
+			if _, err := r.length(); err != nil {
+				return Entry{}, err
+			}
+		case opFreq:
+			if _, err := r.r.ReadByte(); err != nil {
+				return Entry{}, unexpected(err)
+			}
+		case opFunction2:
+			if err := r.skipStrings(1); err != nil {
+				return Entry{}, err
+			}
+		case opModuleAux:
+			return Entry{}, errors.New("rdb: module data is not supported")
+		default:
+			key, err := r.string()
+			if err != nil {
+				return Entry{}, err
+			}
+			if op == typeString {
+				value, err := r.string()
+				if err != nil {
+					return Entry{}, err
+				}
+				return Entry{DB: r.db, Key: key, Value: value, ExpireAt: expireAt}, nil
+			}
+			name, err := r.skipValue(op)
+			if err != nil {
+				return Entry{}, err
+			}
+			r.skipped[name]++
+			expireAt = time.Time{}
+		}
+	}
+}
+
+// skipValue reads past a value of a non-string type and returns the type's name.
+func (r *Reader) skipValue(t byte) (string, error) {
+	switch t {
+	case typeList, typeSet:
+		return typeName(t), r.skipCollection(1)
+	case typeHash:
+		return "hash", r.skipCollection(2)
+	case typeZSet:
+		n, err := r.length()
+		if err != nil {
+			return "", err
+		}
+		for i := uint64(0); i < n; i++ {
+			if err := r.skipStrings(1); err != nil {
+				return "", err
+			}
+			if err := r.skipOldDouble(); err != nil {
+				return "", err
+			}
+		}
+		return "zset", nil
+	case typeZSet2:
+		n, err := r.length()
+		if err != nil {
+			return "", err
+		}
+		for i := uint64(0); i < n; i++ {
+			if err := r.skipStrings(1); err != nil {
+				return "", err
+			}
+			if err := r.skipBytes(8); err != nil {
+				return "", err
+			}
+		}
+		return "zset", nil
+	case typeZipmap, typeListZiplist, typeSetIntset, typeZSetZiplist, typeHashZiplist,
+		typeHashListpack, typeZSetListpack, typeSetListpack:
+		return typeName(t), r.skipStrings(1)
+	case typeListQuicklist:
+		return "list", r.skipCollection(1)
+	case typeListQuicklist2:
+		n, err := r.length()
+		if err != nil {
+			return "", err
+		}
+		for i := uint64(0); i < n; i++ {
+			if _, err := r.length(); err != nil { // Container type
+				return "", err
+			}
+			if err := r.skipStrings(1); err != nil {
+				return "", err
+			}
+		}
+		return "list", nil
+	case typeStreamListpacks, typeStreamListpack2, typeStreamListpack3:
+		return "stream", r.skipStream(t)
+	}
+	return "", fmt.Errorf("rdb: unsupported value type %d", t)
+}
+
+func typeName(t byte) string {
+	switch t {
+	case typeList, typeListZiplist:
+		return "list"
+	case typeSet, typeSetIntset, typeSetListpack:
+		return "set"
+	case typeZSetZiplist, typeZSetListpack:
+		return "zset"
+	}
+	return "hash"
+}
+
+// skipStream reads past a stream, whose layout grew with each type version.
+func (r *Reader) skipStream(t byte) error {
+	// Listpacks, each a master ID and a listpack.
+	if err := r.skipCollection(2); err != nil {
+		return err
+	}
+	// Length and last ID; then first ID, max deleted ID and entries added.
+	lengths := 3
+	if t >= typeStreamListpack2 {
+		lengths += 5
+	}
+	if err := r.skipLengths(lengths); err != nil {
+		return err
+	}
+	groups, err := r.length()
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < groups; i++ {
+		if err := r.skipStrings(1); err != nil { // Name
+			return err
+		}
+		lengths := 2 // Last delivered ID
+		if t >= typeStreamListpack2 {
+			lengths++ // Entries read
+		}
+		if err := r.skipLengths(lengths); err != nil {
+			return err
+		}
+		pending, err := r.length()
+		if err != nil {
+			return err
+		}
+		for j := uint64(0); j < pending; j++ {
+			// Raw ID and delivery time, then delivery count.
+			if err := r.skipBytes(16 + 8); err != nil {
+				return err
+			}
+			if _, err := r.length(); err != nil {
+				return err
+			}
+		}
+		consumers, err := r.length()
+		if err != nil {
+			return err
+		}
+		for j := uint64(0); j < consumers; j++ {
+			if err := r.skipStrings(1); err != nil { // Name
+				return err
+			}
+			times := 8 // Seen time
+			if t >= typeStreamListpack3 {
+				times += 8 // Active time
+			}
+			if err := r.skipBytes(times); err != nil {
+				return err
+			}
+			pending, err := r.length()
+			if err != nil {
+				return err
+			}
+			if err := r.skipBytes(int(pending) * 16); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// skipCollection reads past a length followed by that many groups of per strings.
+func (r *Reader) skipCollection(per int) error {
+	n, err := r.length()
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < n; i++ {
+		if err := r.skipStrings(per); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Reader) skipStrings(n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := r.string(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Reader) skipLengths(n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := r.length(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipOldDouble reads past a double stored as a length-prefixed decimal.
+func (r *Reader) skipOldDouble() error {
+	n, err := r.r.ReadByte()
+	if err != nil {
+		return unexpected(err)
+	}
+	if n >= 253 { // NaN, +Inf and -Inf have no digits
+		return nil
+	}
+	return r.skipBytes(int(n))
+}
+
+func (r *Reader) skipBytes(n int) error {
+	if _, err := r.r.Discard(n); err != nil {
+		return unexpected(err)
+	}
+	return nil
+}
+
+// length reads a length-encoded integer.
+func (r *Reader) length() (uint64, error) {
+	n, special, err := r.lengthOrEncoding()
+	if err != nil {
+		return 0, err
+	}
+	if special {
+		return 0, errors.New("rdb: unexpected string encoding where a length was expected")
+	}
+	return n, nil
+}
+
+// lengthOrEncoding reads a length, or reports that a specially encoded
+// string follows, in which case the returned value is its encoding.
+func (r *Reader) lengthOrEncoding() (uint64, bool, error) {
+	b, err := r.r.ReadByte()
+	if err != nil {
+		return 0, false, unexpected(err)
+	}
+	switch b >> 6 {
+	case 0:
+		return uint64(b & 0x3F), false, nil
+	case 1:
+		next, err := r.r.ReadByte()
+		if err != nil {
+			return 0, false, unexpected(err)
+		}
+		return uint64(b&0x3F)<<8 | uint64(next), false, nil
+	case 2:
+		switch b {
+		case 0x80:
+			var n uint32
+			if err := binary.Read(r.r, binary.BigEndian, &n); err != nil {
+				return 0, false, unexpected(err)
+			}
+			return uint64(n), false, nil
+		case 0x81:
+			var n uint64
+			if err := binary.Read(r.r, binary.BigEndian, &n); err != nil {
+				return 0, false, unexpected(err)
+			}
+			return n, false, nil
+		}
+		return 0, false, fmt.Errorf("rdb: invalid length encoding 0x%02x", b)
+	}
+	return uint64(b & 0x3F), true, nil
+}
+
+// string reads a string, which may be stored as an integer or LZF-compressed.
+func (r *Reader) string() (string, error) {
+	n, special, err := r.lengthOrEncoding()
+	if err != nil {
+		return "", err
+	}
+	if !special {
+		if n > math.MaxInt32 {
+			return "", fmt.Errorf("rdb: string of %d bytes is too long", n)
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(r.r, buf); err != nil {
+			return "", unexpected(err)
+		}
+		return string(buf), nil
+	}
+	switch n {
+	case encInt8:
+		b, err := r.r.ReadByte()
+		if err != nil {
+			return "", unexpected(err)
+		}
+		return strconv.Itoa(int(int8(b))), nil
+	case encInt16:
+		var v int16
+		if err := binary.Read(r.r, binary.LittleEndian, &v); err != nil {
+			return "", unexpected(err)
+		}
+		return strconv.Itoa(int(v)), nil
+	case encInt32:
+		var v int32
+		if err := binary.Read(r.r, binary.LittleEndian, &v); err != nil {
+			return "", unexpected(err)
+		}
+		return strconv.Itoa(int(v)), nil
+	case encLZF:
+		clen, err := r.length()
+		if err != nil {
+			return "", err
+		}
+		ulen, err := r.length()
+		if err != nil {
+			return "", err
+		}
+		if clen > math.MaxInt32 || ulen > math.MaxInt32 {
+			return "", errors.New("rdb: compressed string is too long")
+		}
+		compressed := make([]byte, clen)
+		if _, err := io.ReadFull(r.r, compressed); err != nil {
+			return "", unexpected(err)
+		}
+		out, err := lzfDecompress(compressed, int(ulen))
+		if err != nil {
+			return "", err
+		}
+		return string(out), nil
+	}
+	return "", fmt.Errorf("rdb: unknown string encoding %d", n)
+}
+
+// lzfDecompress expands LZF data into exactly size bytes.
+func lzfDecompress(in []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 32 { // Literal run of ctrl+1 bytes
+			n := ctrl + 1
+			if i+n > len(in) {
+				return nil, errors.New("rdb: corrupt LZF literal")
+			}
+			out = append(out, in[i:i+n]...)
+			i += n
+			continue
+		}
+		// Back reference: length in the top 3 bits (7 means a length byte follows).
+		n := ctrl >> 5
+		if n == 7 {
+			if i >= len(in) {
+				return nil, errors.New("rdb: corrupt LZF back reference")
+			}
+			n += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, errors.New("rdb: corrupt LZF back reference")
+		}
+		ref := len(out) - ((ctrl&0x1F)<<8 | int(in[i])) - 1
+		i++
+		if ref < 0 {
+			return nil, errors.New("rdb: LZF back reference out of range")
+		}
+		for j := 0; j < n+2; j++ { // Byte by byte, as the reference may overlap the output
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != size {
+		return nil, fmt.Errorf("rdb: LZF data expanded to %d bytes, expected %d", len(out), size)
+	}
+	return out, nil
+}
+
+// unexpected turns a clean EOF inside a record into io.ErrUnexpectedEOF.
+func unexpected(err error) error {
+	if err == io.EOF {
+		return fmt.Errorf("rdb: truncated dump: %w", io.ErrUnexpectedEOF)
+	}
+	return err
+}
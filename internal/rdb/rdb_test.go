@@ -0,0 +1,85 @@
+// Package rdb_test contains the unit tests for the rdb package.
+package rdb
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+// rdbString length-prefixes s as an RDB string.
+func rdbString(s string) []byte {
+	return append([]byte{byte(len(s))}, s...)
+}
+
+func TestReader(t *testing.T) {
+	var dump bytes.Buffer
+	dump.WriteString("REDIS0011")
+	dump.WriteByte(opAux)
+	dump.Write(rdbString("redis-ver"))
+	dump.Write(rdbString("7.2.4"))
+	dump.Write([]byte{opSelectDB, 0, opResizeDB, 4, 1})
+	// A plain string.
+	dump.WriteByte(typeString)
+	dump.Write(rdbString("greeting"))
+	dump.Write(rdbString("hello"))
+	// A list, which is skipped.
+	dump.WriteByte(typeList)
+	dump.Write(rdbString("queue"))
+	dump.WriteByte(2)
+	dump.Write(rdbString("a"))
+	dump.Write(rdbString("b"))
+	// A string with an expiry, stored as an integer.
+	dump.Write([]byte{opExpireTimeMs, 0xE8, 0x03, 0, 0, 0, 0, 0, 0}) // 1000ms
+	dump.WriteByte(typeString)
+	dump.Write(rdbString("counter"))
+	dump.Write([]byte{0xC0 | encInt16, 0x39, 0x30}) // 12345
+	// An LZF-compressed string in another database.
+	dump.Write([]byte{opSelectDB, 1})
+	dump.WriteByte(typeString)
+	dump.Write(rdbString("repeated"))
+	dump.Write([]byte{0xC0 | encLZF, 6, 6, 0x02, 'a', 'b', 'c', 0x20, 0x02})
+	dump.WriteByte(opEOF)
+	dump.Write(make([]byte, 8))
+
+	r, err := NewReader(&dump)
+	if err != nil {
+		t.Fatalf("expected a valid header, but got %v", err)
+	}
+
+	// --- Test Case 1: String keys are returned in order ---
+	want := []Entry{
+		{DB: 0, Key: "greeting", Value: "hello"},
+		{DB: 0, Key: "counter", Value: "12345", ExpireAt: time.UnixMilli(1000)},
+		{DB: 1, Key: "repeated", Value: "abcabc"},
+	}
+	for i, w := range want {
+		got, err := r.Next()
+		if err != nil {
+			t.Fatalf("entry %d: expected no error, but got %v", i, err)
+		}
+		if got.DB != w.DB || got.Key != w.Key || got.Value != w.Value || !got.ExpireAt.Equal(w.ExpireAt) {
+			t.Errorf("entry %d: expected %+v, but got %+v", i, w, got)
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("expected io.EOF, but got %v", err)
+	}
+
+	// --- Test Case 2: Other types are counted ---
+	if r.Skipped()["list"] != 1 {
+		t.Errorf("expected 1 skipped list, but got %v", r.Skipped())
+	}
+
+	// --- Test Case 3: A truncated dump is an error ---
+	r, _ = NewReader(bytes.NewReader([]byte("REDIS0011\x00\x05hel")))
+	if _, err := r.Next(); err == nil || err == io.EOF {
+		t.Errorf("expected a truncation error, but got %v", err)
+	}
+
+	// --- Test Case 4: Not an RDB file ---
+	if _, err := NewReader(bytes.NewReader([]byte("HELLO0011"))); err == nil {
+		t.Error("expected an error for a bad header, but got nil")
+	}
+}
@@ -0,0 +1,166 @@
+// Package script runs Starlark scripts that read and write keys atomically.
+// Scripts are executed inside the Raft FSM, so they must be deterministic:
+// Starlark has no access to time, randomness, the filesystem or the network,
+// and every script runs with a bounded number of execution steps.
+package script
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ASHISH26940/heliosdb/internal/store"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// MaxSteps bounds the work a single script may do, so a runaway loop cannot
+// stall the state machine on every node.
+const MaxSteps = 1_000_000
+
+// fileOptions lets scripts use if/for/while at the top level, since they are
+// short snippets rather than modules.
+var fileOptions = &syntax.FileOptions{
+	TopLevelControl: true,
+	While:           true,
+	GlobalReassign:  true,
+}
+
+// ErrReservedKey is returned by get, set and delete for a key holding the
+// cluster's own state, which scripts may neither read nor write.
+var ErrReservedKey = errors.New("keys starting with a NUL byte are reserved")
+
+// Reader is the read access a script has to the store.
+type Reader interface {
+	Get(key string) (string, bool)
+}
+
+// Mutation is a single write produced by a script.
+type Mutation struct {
+	Key    string
+	Value  string
+	Delete bool
+}
+
+// Result is the outcome of running a script.
+type Result struct {
+	Value     string     // The script's "result" global, converted to a string
+	Mutations []Mutation // Writes to apply, in the order the script made them
+}
+
+// Run executes src with args bound to the global "args". The script may call
+// get(key), set(key, value) and delete(key). Writes are buffered: get sees the
+// script's own earlier writes, and nothing reaches the store unless the whole
+// script succeeds, in which case the caller applies Result.Mutations. A
+// script touching a reserved key (see store.IsReserved) fails.
+func Run(src string, args []string, kv Reader) (Result, error) {
+	overlay := make(map[string]*Mutation)
+	var order []string
+
+	get := func(key string) (string, bool) {
+		if m, ok := overlay[key]; ok {
+			return m.Value, !m.Delete
+		}
+		return kv.Get(key)
+	}
+	record := func(m Mutation) {
+		if _, ok := overlay[m.Key]; !ok {
+			order = append(order, m.Key)
+		}
+		overlay[m.Key] = &m
+	}
+
+	predeclared := starlark.StringDict{
+		"get": starlark.NewBuiltin("get", func(_ *starlark.Thread, fn *starlark.Builtin, a starlark.Tuple, kw []starlark.Tuple) (starlark.Value, error) {
+			var key string
+			if err := starlark.UnpackArgs(fn.Name(), a, kw, "key", &key); err != nil {
+				return nil, err
+			}
+			if store.IsReserved(key) {
+				return nil, fmt.Errorf("%s: %w", fn.Name(), ErrReservedKey)
+			}
+			if v, ok := get(key); ok {
+				return starlark.String(v), nil
+			}
+			return starlark.None, nil
+		}),
+		"set": starlark.NewBuiltin("set", func(_ *starlark.Thread, fn *starlark.Builtin, a starlark.Tuple, kw []starlark.Tuple) (starlark.Value, error) {
+			var key, value string
+			if err := starlark.UnpackArgs(fn.Name(), a, kw, "key", &key, "value", &value); err != nil {
+				return nil, err
+			}
+			if store.IsReserved(key) {
+				return nil, fmt.Errorf("%s: %w", fn.Name(), ErrReservedKey)
+			}
+			record(Mutation{Key: key, Value: value})
+			return starlark.None, nil
+		}),
+		"delete": starlark.NewBuiltin("delete", func(_ *starlark.Thread, fn *starlark.Builtin, a starlark.Tuple, kw []starlark.Tuple) (starlark.Value, error) {
+			var key string
+			if err := starlark.UnpackArgs(fn.Name(), a, kw, "key", &key); err != nil {
+				return nil, err
+			}
+			if store.IsReserved(key) {
+				return nil, fmt.Errorf("%s: %w", fn.Name(), ErrReservedKey)
+			}
+			record(Mutation{Key: key, Delete: true})
+			return starlark.None, nil
+		}),
+		"args": argsTuple(args),
+	}
+
+	thread := &starlark.Thread{
+		Name:  "eval",
+		Print: func(*starlark.Thread, string) {}, // Scripts have no output channel
+	}
+	thread.SetMaxExecutionSteps(MaxSteps)
+
+	globals, err := starlark.ExecFileOptions(fileOptions, thread, "eval.star", src, predeclared)
+	if err != nil {
+		var evalErr *starlark.EvalError
+		if errors.As(err, &evalErr) {
+			return Result{}, &failure{backtrace: evalErr.Backtrace(), err: err}
+		}
+		return Result{}, fmt.Errorf("script failed: %w", err)
+	}
+
+	res := Result{Mutations: make([]Mutation, 0, len(order))}
+	for _, key := range order {
+		res.Mutations = append(res.Mutations, *overlay[key])
+	}
+	if v, ok := globals["result"]; ok && v != starlark.None {
+		if s, ok := starlark.AsString(v); ok {
+			res.Value = s
+		} else {
+			res.Value = v.String()
+		}
+	}
+	return res, nil
+}
+
+// failure reports where a script failed, and wraps the error it failed with.
+type failure struct {
+	backtrace string
+	err       error
+}
+
+func (f *failure) Error() string { return "script failed: " + f.backtrace }
+func (f *failure) Unwrap() error { return f.err }
+
+func argsTuple(args []string) starlark.Tuple {
+	t := make(starlark.Tuple, len(args))
+	for i, a := range args {
+		t[i] = starlark.String(a)
+	}
+	return t
+}
+
+// Keys returns the distinct keys written by a result, sorted.
+func (r Result) Keys() []string {
+	keys := make([]string, 0, len(r.Mutations))
+	for _, m := range r.Mutations {
+		keys = append(keys, m.Key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,64 @@
+// Package script_test contains the unit tests for the script package.
+package script
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type mapReader map[string]string
+
+func (m mapReader) Get(key string) (string, bool) {
+	v, ok := m[key]
+	return v, ok
+}
+
+func TestRun(t *testing.T) {
+	kv := mapReader{"balance:a": "100", "balance:b": "5", "stale": "x"}
+
+	// --- Test Case 1: Transfer between two keys ---
+	src := `
+amount = int(args[0])
+a = int(get("balance:a"))
+if a < amount:
+    fail("insufficient funds")
+set("balance:a", str(a - amount))
+set("balance:b", str(int(get("balance:b")) + amount))
+delete("stale")
+result = get("balance:a")
+`
+	res, err := Run(src, []string{"30"}, kv)
+	if err != nil {
+		t.Fatalf("expected script to succeed, got: %v", err)
+	}
+	if res.Value != "70" {
+		t.Errorf("expected result '70' (reading its own write), got '%s'", res.Value)
+	}
+	if len(res.Mutations) != 3 || res.Mutations[1].Value != "35" || !res.Mutations[2].Delete {
+		t.Errorf("unexpected mutations: %+v", res.Mutations)
+	}
+	if kv["balance:a"] != "100" {
+		t.Error("expected Run to leave the store untouched")
+	}
+
+	// --- Test Case 2: A failing script produces no writes ---
+	_, err = Run(src, []string{"1000"}, kv)
+	if err == nil || !strings.Contains(err.Error(), "insufficient funds") {
+		t.Errorf("expected an insufficient funds error, got: %v", err)
+	}
+
+	// --- Test Case 3: Runaway scripts are stopped ---
+	_, err = Run("def f():\n    for i in range(100000000):\n        pass\nf()\n", nil, kv)
+	if err == nil {
+		t.Error("expected a runaway script to be cancelled, but it completed")
+	}
+
+	// --- Test Case 4: Reserved keys can be neither read nor written ---
+	kv["\x00cluster_id"] = "c1"
+	for _, src := range []string{`get("\x00cluster_id")`, `set("\x00cluster_id", "evil")`, `delete("\x00quota\x00a/")`} {
+		if _, err := Run(src, nil, kv); !errors.Is(err, ErrReservedKey) {
+			t.Errorf("expected %s to fail with %v, but got %v", src, ErrReservedKey, err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"path"
+	"strings"
+)
+
+// WithSeparateAdmin stops the handler returned by New from serving the
+// endpoints AdminHandler serves, so that they are reachable only on a
+// listener of their own.
+func WithSeparateAdmin(enabled bool) Option {
+	return func(s *Server) {
+		s.separateAdmin = enabled
+	}
+}
+
+// cleanPath returns path cleaned and without its API version prefix.
+func cleanPath(p string) string {
+	return unversionedPath(path.Clean("/" + p))
+}
+
+// clusterPath reports whether p, as cleanPath returns it, changes or
+// inspects the cluster rather than the data.
+func clusterPath(p string) bool {
+	return p == "/join" || p == "/admin" || p == "/cluster" ||
+		strings.HasPrefix(p, "/admin/") || strings.HasPrefix(p, "/cluster/")
+}
+
+// pprofPath reports whether p, as cleanPath returns it, is a profiling endpoint.
+func pprofPath(p string) bool {
+	return p == "/debug/pprof" || strings.HasPrefix(p, "/debug/pprof/")
+}
+
+// adminPath reports whether p, as cleanPath returns it, belongs on the admin
+// listener: cluster operations, metrics and profiles.
+func adminPath(p string) bool {
+	return clusterPath(p) || p == "/metrics" || pprofPath(p)
+}
+
+// dataPlanePath reports whether p, as cleanPath returns it, serves data
+// rather than operating the cluster, health checks or API documentation.
+func dataPlanePath(p string) bool {
+	return !adminPath(p) && p != "/ready" && p != "/openapi.json" && p != "/docs"
+}
+
+// AdminHandler returns a handler for an admin listener: it serves the
+// cluster and admin endpoints, /metrics, /ready and the Go profiler under
+// /debug/pprof/, which the data-plane handler never serves, and nothing
+// else.
+func (s *Server) AdminHandler() http.Handler {
+	profiles := http.NewServeMux()
+	profiles.HandleFunc("/debug/pprof/", pprof.Index)
+	profiles.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	profiles.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	profiles.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	profiles.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch p := cleanPath(r.URL.Path); {
+		case pprofPath(p):
+			r = withRequestID(w, r)
+			if !s.checkAllowlist(w, r) {
+				return
+			}
+			profiles.ServeHTTP(w, r)
+		case adminPath(p) || p == "/ready":
+			s.serve(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/filter"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+)
+
+// Aggregation operations served by GET /aggregate.
+const (
+	AggregateCount = "count"
+	AggregateSum   = "sum"
+	AggregateAvg   = "avg"
+	AggregateMin   = "min"
+	AggregateMax   = "max"
+)
+
+// handleAggregate computes op over the keys under a prefix on the node, so
+// that dashboards need not fetch the prefix to count or total it. count
+// counts the matching keys; the other ops combine the number at field of
+// each JSON value, or the value itself if no field is given, skipping keys
+// without one. The scan filters narrow the keys first.
+func (s *Server) handleAggregate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	op, field := q.Get("op"), q.Get("field")
+	switch op {
+	case AggregateCount, AggregateSum, AggregateAvg, AggregateMin, AggregateMax:
+	default:
+		http.Error(w, "Unknown op (want count, sum, avg, min or max)", http.StatusBadRequest)
+		return
+	}
+	f, err := scanFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !s.readable(w, r) {
+		return
+	}
+
+	prefix := q.Get("prefix")
+	res := v1.AggregateResponse{Op: op, Field: field}
+	s.store.Iterate(func(key string, value store.VersionedValue) bool {
+		if !strings.HasPrefix(key, prefix) {
+			return key < prefix
+		}
+		if store.IsReserved(key) || !f.Match(key, value) {
+			return true
+		}
+		if op == AggregateCount {
+			res.Count++
+			return true
+		}
+		n, ok := number(value.Value, field)
+		if !ok {
+			res.Skipped++
+			return true
+		}
+		switch {
+		case res.Count == 0:
+			res.Value = n
+		case op == AggregateMin:
+			res.Value = math.Min(res.Value, n)
+		case op == AggregateMax:
+			res.Value = math.Max(res.Value, n)
+		default:
+			res.Value += n
+		}
+		res.Count++
+		return true
+	})
+	switch op {
+	case AggregateCount:
+		res.Value = float64(res.Count)
+	case AggregateAvg:
+		if res.Count > 0 {
+			res.Value /= float64(res.Count)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// number returns the number at field of a JSON value, or the value itself
+// parsed as a number if field is empty.
+func number(value, field string) (float64, bool) {
+	if field == "" {
+		n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		return n, err == nil && !math.IsInf(n, 0) && !math.IsNaN(n)
+	}
+	v, ok := filter.Field(value, field)
+	n, isNumber := v.(float64)
+	return n, ok && isNumber
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ParseAllowlist parses CIDR prefixes, e.g. "10.0.0.0/8", and plain IP
+// addresses, which allow that address alone.
+func ParseAllowlist(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if addr, err := netip.ParseAddr(e); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(e)
+		if err != nil {
+			return nil, fmt.Errorf("%q is neither an IP address nor a CIDR prefix", e)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// WithAdminAllowlist restricts /join, /admin/*, /cluster/* and the profiler
+// on the admin listener to clients whose address is in one of prefixes,
+// whatever credentials they present. Clients on the unix socket are always
+// allowed. An empty list allows all.
+func WithAdminAllowlist(prefixes []netip.Prefix) Option {
+	return func(s *Server) {
+		s.adminAllowlist = prefixes
+	}
+}
+
+// restricted reports whether the path of r is covered by the admin allowlist.
+func restricted(r *http.Request) bool {
+	p := cleanPath(r.URL.Path)
+	return clusterPath(p) || pprofPath(p)
+}
+
+// allowedClient reports whether r may reach the endpoints the admin allowlist
+// covers. Addresses are taken from the connection, never from headers such
+// as X-Forwarded-For, which any client can set.
+func (s *Server) allowedClient(r *http.Request) bool {
+	if len(s.adminAllowlist) == 0 {
+		return true
+	}
+	if unixClient(r) {
+		return true
+	}
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	addr := addrPort.Addr().Unmap()
+	for _, prefix := range s.adminAllowlist {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAllowlist refuses r with 403 Forbidden if it is for an endpoint the
+// admin allowlist covers and comes from an address outside it.
+func (s *Server) checkAllowlist(w http.ResponseWriter, r *http.Request) bool {
+	if !restricted(r) || s.allowedClient(r) {
+		return true
+	}
+	log.Printf("[%s] ALLOWLIST: Refused %s %s from %s", requestID(r), r.Method, r.URL.Path, r.RemoteAddr)
+	http.Error(w, "Forbidden: this endpoint is not reachable from your address", http.StatusForbidden)
+	return false
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// MediaTypeOctetStream is the content type of a set request whose body is
+// the value itself, rather than a SetRequest.
+const MediaTypeOctetStream = "application/octet-stream"
+
+// WithMaxRequestBytes refuses request bodies larger than n bytes with 413
+// Request Entity Too Large: at once if the request declares its length, or
+// as soon as the limit is read otherwise. Bulk loads and imports, which are
+// read a record at a time, are not limited. 0 is unlimited.
+func WithMaxRequestBytes(n int64) Option {
+	return func(s *Server) {
+		s.maxRequestBytes = n
+	}
+}
+
+// streamedPath reports whether p, as cleanPath returns it, is an upload
+// read a record at a time, which may be of any size.
+func streamedPath(p string) bool {
+	return p == "/admin/bulk-load" || p == "/admin/import/redis"
+}
+
+// limitBody applies the request size limit to r, and refuses r with 413 if
+// it declares a longer body.
+func (s *Server) limitBody(w http.ResponseWriter, r *http.Request) bool {
+	if s.maxRequestBytes <= 0 || r.Body == nil || r.Body == http.NoBody || streamedPath(cleanPath(r.URL.Path)) {
+		return true
+	}
+	if r.ContentLength > s.maxRequestBytes {
+		// Don't read the body only to throw it away.
+		w.Header().Set("Connection", "close")
+		http.Error(w, fmt.Sprintf("Request body too large: the limit is %d bytes", s.maxRequestBytes), http.StatusRequestEntityTooLarge)
+		return false
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxRequestBytes)
+	return true
+}
+
+// bodyError answers a request whose body could not be read or decoded: 413
+// if it exceeded the size limit, and 400 otherwise.
+func bodyError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, fmt.Sprintf("Request body too large: the limit is %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if errors.Is(err, errNotUTF8) {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, "Invalid request body", http.StatusBadRequest)
+}
+
+// maxValuePrealloc bounds how much readValue allocates up front on the word
+// of the Content-Length header alone.
+const maxValuePrealloc = 64 << 20
+
+// errNotUTF8 is returned for raw values that are not UTF-8 text, which
+// commands, encoded as JSON, cannot carry intact.
+var errNotUTF8 = errors.New("value is not valid UTF-8")
+
+// readValue reads a raw value from r's body, copying it once rather than
+// decoding and unescaping it.
+func readValue(r *http.Request) (string, error) {
+	var b strings.Builder
+	if n := r.ContentLength; n > 0 {
+		b.Grow(int(min(n, maxValuePrealloc)))
+	}
+	if _, err := io.Copy(&b, r.Body); err != nil {
+		return "", err
+	}
+	if !utf8.ValidString(b.String()) {
+		return "", errNotUTF8
+	}
+	return b.String(), nil
+}
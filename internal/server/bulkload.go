@@ -0,0 +1,135 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/audit"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+	"github.com/ASHISH26940/heliosdb/internal/transaction"
+	"github.com/hashicorp/raft"
+)
+
+// A bulk load is committed in chunks of up to bulkBatchRecords records or
+// bulkBatchBytes of keys and values, whichever is reached first. Large
+// entries amortize the Raft round trip and fsync over many keys, while
+// staying small enough not to stall heartbeats.
+const (
+	bulkBatchRecords = 4096
+	bulkBatchBytes   = 1 << 20
+)
+
+// bulkLoader chunks a stream of writes into BATCH commands.
+type bulkLoader struct {
+	s *Server
+	c caller
+
+	pending []transaction.WriteOp
+	size    int
+	records int // Committed so far
+	batches int
+}
+
+// add queues a write, committing the pending chunk once it is full.
+func (b *bulkLoader) add(key, value string) error {
+	b.pending = append(b.pending, transaction.WriteOp{Key: key, Value: value})
+	b.size += len(key) + len(value)
+	if len(b.pending) >= bulkBatchRecords || b.size >= bulkBatchBytes {
+		return b.flush()
+	}
+	return nil
+}
+
+// flush commits the pending chunk, if any.
+func (b *bulkLoader) flush() error {
+	if len(b.pending) == 0 {
+		return nil
+	}
+	cmd := Command{Op: "BATCH", WriteSet: b.pending, RequestID: b.c.requestID, Principal: b.s.writer(b.c)}
+	cmdBytes, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+	if _, err := b.s.applyCommand(cmd, cmdBytes); err != nil {
+		return err
+	}
+	b.records += len(b.pending)
+	b.batches++
+	b.pending = b.pending[:0]
+	b.size = 0
+	return nil
+}
+
+// errBadRecord marks a malformed record in a bulk load stream.
+var errBadRecord = errors.New("invalid record")
+
+// bulkLoad commits every record read from dec. Records committed before an
+// error stay committed; the returned loader says how many there were.
+func (s *Server) bulkLoad(dec *json.Decoder, c caller) (*bulkLoader, error) {
+	b := &bulkLoader{s: s, c: c}
+	for n := 1; ; n++ {
+		var rec v1.BulkLoadRecord
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return b, fmt.Errorf("%w %d: %v", errBadRecord, n, err)
+		}
+		if rec.Key == "" {
+			return b, fmt.Errorf("%w %d: key is missing", errBadRecord, n)
+		}
+		if store.IsReserved(rec.Key) {
+			return b, fmt.Errorf("%w %d: %v", errBadRecord, n, errReservedKey)
+		}
+		if err := b.add(rec.Key, rec.Value); err != nil {
+			return b, err
+		}
+	}
+	return b, b.flush()
+}
+
+// handleBulkLoad ingests a stream of newline-delimited BulkLoadRecords.
+// Records are committed through Raft in large chunks as they arrive, so the
+// stream can be far larger than memory. The load is not atomic: if it fails,
+// the records committed so far remain, and the response says how many.
+func (s *Server) handleBulkLoad(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.raft.State() != raft.Leader {
+		http.Error(w, "Bulk loads must be sent to the leader at: "+s.leaderAddr(), http.StatusForbidden)
+		return
+	}
+
+	clearDeadlines(w)
+	b, err := s.bulkLoad(json.NewDecoder(r.Body), httpCaller(r))
+	s.recordAudit(r, audit.Entry{Op: "BULK_LOAD"}, err)
+	if err != nil {
+		code := applyStatus(err)
+		if errors.Is(err, errBadRecord) {
+			code = http.StatusBadRequest
+		}
+		http.Error(w, fmt.Sprintf("Bulk load stopped after %d records: %v", b.records, err), code)
+		return
+	}
+
+	log.Printf("[%s] ADMIN: Bulk loaded %d records in %d batches", requestID(r), b.records, b.batches)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v1.BulkLoadResponse{Records: b.records, Batches: b.batches})
+}
+
+// clearDeadlines lifts the server's read and write timeouts from an upload
+// that is read a record at a time, which may take far longer to send.
+func clearDeadlines(w http.ResponseWriter) {
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/go-msgpack/v2/codec"
+)
+
+// MediaTypeMsgpack is the content type of MessagePack bodies. Requests may
+// also label them application/x-msgpack or application/vnd.msgpack.
+const MediaTypeMsgpack = "application/msgpack"
+
+// msgpackHandle encodes with the JSON field names of the api/v1 types, and
+// strings as MessagePack str rather than bin.
+var msgpackHandle = func() *codec.MsgpackHandle {
+	h := &codec.MsgpackHandle{WriteExt: true}
+	h.RawToString = true
+	return h
+}()
+
+// isMsgpack reports whether a media type, possibly with parameters, is
+// MessagePack.
+func isMsgpack(mediaType string) bool {
+	t, _, _ := mime.ParseMediaType(mediaType)
+	switch t {
+	case MediaTypeMsgpack, "application/x-msgpack", "application/vnd.msgpack":
+		return true
+	}
+	return false
+}
+
+// decodeBody decodes r's body into v as MessagePack if its Content-Type
+// says so, and as JSON otherwise.
+func decodeBody(r *http.Request, v interface{}) error {
+	if isMsgpack(r.Header.Get("Content-Type")) {
+		return codec.NewDecoder(r.Body, msgpackHandle).Decode(v)
+	}
+	return json.NewDecoder(r.Body).Decode(v)
+}
+
+// wantsMsgpack reports whether r's Accept header prefers MessagePack to
+// JSON: it lists a MessagePack type before application/json or any
+// wildcard, and with a non-zero quality.
+func wantsMsgpack(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		t, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil || params["q"] == "0" {
+			continue
+		}
+		if isMsgpack(t) {
+			return true
+		}
+		if t == "application/json" || t == "application/*" || t == "*/*" {
+			return false
+		}
+	}
+	return false
+}
+
+// writeBody writes v with status, as MessagePack if r prefers it and as
+// JSON otherwise.
+func writeBody(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	addVary(w, "Accept")
+	if wantsMsgpack(r) {
+		w.Header().Set("Content-Type", MediaTypeMsgpack)
+		w.WriteHeader(status)
+		codec.NewEncoder(w, msgpackHandle).Encode(v)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/audit"
+	"github.com/hashicorp/raft"
+)
+
+// defaultDecommissionTimeout bounds how long a decommission waits for the
+// remaining voters to be healthy and caught up.
+const defaultDecommissionTimeout = 30 * time.Second
+
+// errNotDecommissioned is returned if the node is still in the configuration
+// after it was removed.
+var errNotDecommissioned = errors.New("node is still in the cluster configuration after removal")
+
+// handleDecommission removes a node from the cluster without risking
+// availability. The node is first demoted to a non-voter, so the quorum no
+// longer depends on it; the leader then waits until the remaining voters
+// acknowledge its leadership and have replicated and applied every entry up
+// to the demotion, and only then removes the node and checks that it is gone
+// from the configuration. It must be sent to the leader, and cannot remove
+// the leader itself: drain it first so that another node takes over.
+func (s *Server) handleDecommission(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.raft.State() != raft.Leader {
+		http.Error(w, "Nodes must be decommissioned via the leader at: "+s.leaderAddr(), http.StatusForbidden)
+		return
+	}
+	if !s.authorizeMembership(w, r) {
+		return
+	}
+	var req v1.DecommissionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		bodyError(w, err)
+		return
+	}
+	if req.NodeID == "" {
+		http.Error(w, "Invalid request body: node_id is required", http.StatusBadRequest)
+		return
+	}
+	timeout := defaultDecommissionTimeout
+	if req.Timeout != "" {
+		d, err := time.ParseDuration(req.Timeout)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid timeout", http.StatusBadRequest)
+			return
+		}
+		timeout = d
+	}
+
+	id := raft.ServerID(req.NodeID)
+	member, ok, err := s.clusterMember(id)
+	if err != nil {
+		http.Error(w, "Failed to read the cluster configuration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Node "+req.NodeID+" is not in the cluster", http.StatusNotFound)
+		return
+	}
+	if member.Address == s.raft.Leader() {
+		http.Error(w, "Cannot decommission the leader; drain it first with POST /admin/drain", http.StatusConflict)
+		return
+	}
+
+	res, err := s.decommission(member, timeout)
+	s.recordAudit(r, audit.Entry{Op: "DECOMMISSION", NodeID: req.NodeID}, err)
+	if err != nil {
+		log.Printf("[%s] LEADER: Failed to decommission node %s: %v", requestID(r), req.NodeID, err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		res.Error = err.Error()
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	log.Printf("[%s] LEADER: Decommissioned node %s", requestID(r), req.NodeID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// decommission demotes member, waits for the remaining voters, and removes
+// it, reporting how far it got.
+func (s *Server) decommission(member raft.Server, timeout time.Duration) (v1.DecommissionResponse, error) {
+	res := v1.DecommissionResponse{NodeID: string(member.ID)}
+	deadline := time.Now().Add(timeout)
+	// A zero timeout means none to Raft, so never pass one.
+	remaining := func() time.Duration {
+		return max(time.Until(deadline), time.Millisecond)
+	}
+
+	if member.Suffrage == raft.Voter {
+		if err := s.raft.DemoteVoter(member.ID, 0, timeout).Error(); err != nil {
+			return res, err
+		}
+	}
+	res.Demoted = true
+
+	// Contact with a quorum shows the remaining voters are reachable; the
+	// barrier commits only once they have replicated everything before it.
+	var err error
+	for {
+		if err = s.raft.VerifyLeader().Error(); err == nil {
+			if err = s.raft.Barrier(remaining()).Error(); err == nil {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			return res, err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	res.PeersCaughtUp = true
+
+	future := s.raft.RemoveServer(member.ID, 0, remaining())
+	if err := future.Error(); err != nil {
+		return res, err
+	}
+	if _, ok, err := s.clusterMember(member.ID); err != nil {
+		return res, err
+	} else if ok {
+		return res, errNotDecommissioned
+	}
+	res.Removed = true
+	res.ConfigIndex = future.Index()
+	return res, nil
+}
+
+// clusterMember looks id up in the latest cluster configuration.
+func (s *Server) clusterMember(id raft.ServerID) (raft.Server, bool, error) {
+	future := s.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return raft.Server{}, false, err
+	}
+	for _, srv := range future.Configuration().Servers {
+		if srv.ID == id {
+			return srv, true, nil
+		}
+	}
+	return raft.Server{}, false, nil
+}
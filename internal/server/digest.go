@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/audit"
+	"github.com/hashicorp/raft"
+)
+
+// defaultDigestTimeout bounds how long a digest waits for this node to
+// apply the requested log index.
+const defaultDigestTimeout = 30 * time.Second
+
+// ErrDigestUnavailable is returned by a digester for a log index the node
+// has already applied past without recording a digest there.
+var ErrDigestUnavailable = errors.New("no digest was recorded at that log index")
+
+// WithDigester serves /admin/digest with fn, which returns the digest of
+// this node's store at a Raft log index, waiting until ctx is done for the
+// node to apply it. Index 0 means the store as it is now.
+func WithDigester(fn func(ctx context.Context, index uint64) (v1.DigestResponse, error)) Option {
+	return func(s *Server) {
+		s.digest = fn
+	}
+}
+
+// handleDigest reports a deterministic hash of this node's keyspace at a
+// Raft log index, so operators can check that replicas converged. POST, on
+// the leader, proposes a DIGEST marker through Raft and returns the leader's
+// digest at its index; every replica records its own digest at the marker,
+// which GET ?index= then returns. GET without an index hashes the store as
+// it is now. ?timeout= (default 30s) bounds the wait for a replica that has
+// not applied the index yet.
+func (s *Server) handleDigest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.digest == nil {
+		http.Error(w, "Digests are not available", http.StatusNotFound)
+		return
+	}
+	timeout := defaultDigestTimeout
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			http.Error(w, "Invalid timeout", http.StatusBadRequest)
+			return
+		}
+		timeout = d
+	}
+
+	var index uint64
+	if r.Method == http.MethodPost {
+		if s.raft.State() != raft.Leader {
+			http.Error(w, "Digest markers must be proposed on the leader at: "+s.leaderAddr(), http.StatusForbidden)
+			return
+		}
+		cmd := Command{Op: "DIGEST", RequestID: requestID(r)}
+		cmdBytes, err := json.Marshal(cmd)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		res, err := s.applyCommand(cmd, cmdBytes)
+		s.recordAudit(r, audit.Entry{Op: "DIGEST"}, err)
+		if err != nil {
+			http.Error(w, "Failed to apply command: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// The FSM answers a DIGEST marker with the log index it applied it at.
+		if index, _ = res.(uint64); index == 0 {
+			http.Error(w, "The digest marker was not applied at a known log index", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("[%s] ADMIN: Proposed a digest marker at log index %d", requestID(r), index)
+	} else if v := r.URL.Query().Get("index"); v != "" {
+		var err error
+		if index, err = strconv.ParseUint(v, 10, 64); err != nil {
+			http.Error(w, "Invalid index", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	res, err := s.digest(ctx, index)
+	switch {
+	case errors.Is(err, ErrDigestUnavailable):
+		http.Error(w, "This node has applied past log index "+strconv.FormatUint(index, 10)+" without recording a digest there; propose a new marker", http.StatusGone)
+		return
+	case errors.Is(err, context.DeadlineExceeded):
+		http.Error(w, "Timed out waiting to apply log index "+strconv.FormatUint(index, 10), http.StatusGatewayTimeout)
+		return
+	case err != nil:
+		http.Error(w, "Failed to compute digest: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// diskUsage measures the files in the data directory, and in any storage
+// directories apart from it, by what they hold, and the free space on their
+// volumes.
+func (s *Server) diskUsage() (v1.DiskUsageResponse, error) {
+	u := v1.DiskUsageResponse{DataDir: s.dataDir}
+	roots := []string{filepath.Clean(s.dataDir)}
+	for _, dir := range s.storageDirs {
+		roots = append(roots, filepath.Clean(dir))
+	}
+	for _, root := range roots {
+		dir := v1.StorageDir{Path: root}
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				// A storage directory inside another is measured on its own.
+				if path != root && slices.Contains(roots, path) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(root, path)
+			switch size := info.Size(); {
+			case rel == "raft.db":
+				u.RaftLogBytes += size
+			case strings.HasPrefix(rel, "app.wal"):
+				u.WALBytes += size
+			case strings.HasPrefix(rel, "snapshots"+string(filepath.Separator)):
+				u.SnapshotBytes += size
+			case strings.HasPrefix(rel, "cold"+string(filepath.Separator)):
+				u.ColdBytes += size
+			default:
+				u.OtherBytes += size
+			}
+			dir.Bytes += info.Size()
+			return nil
+		})
+		if err != nil {
+			return u, err
+		}
+		if total, free, err := volumeSpace(root); err == nil {
+			dir.VolumeTotalBytes, dir.VolumeFreeBytes = total, free
+			if total > 0 {
+				dir.VolumeUsedPercent = 100 * float64(total-free) / float64(total)
+			}
+		}
+		u.Dirs = append(u.Dirs, dir)
+	}
+	u.TotalBytes = u.RaftLogBytes + u.WALBytes + u.SnapshotBytes + u.ColdBytes + u.OtherBytes
+	u.VolumeTotalBytes, u.VolumeFreeBytes, u.VolumeUsedPercent = u.Dirs[0].VolumeTotalBytes, u.Dirs[0].VolumeFreeBytes, u.Dirs[0].VolumeUsedPercent
+
+	s.store.Iterate(func(key string, value store.VersionedValue) bool {
+		u.StoreBytes += int64(len(key) + len(value.Value))
+		return true
+	})
+	if m, ok := s.store.(interface{ MappedBytes() int64 }); ok {
+		u.MappedBytes = m.MappedBytes()
+	}
+	return u, nil
+}
+
+// handleDisk reports how much disk the node uses and how much is left.
+func (s *Server) handleDisk(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.dataDir == "" {
+		http.Error(w, "Disk usage is not available", http.StatusNotFound)
+		return
+	}
+	u, err := s.diskUsage()
+	if err != nil {
+		http.Error(w, "Failed to measure disk usage: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(u)
+}
+
+var (
+	dataBytesDesc = prometheus.NewDesc("heliosdb_data_bytes",
+		"Bytes used in the storage directories, by kind (raft_log, wal, snapshots, cold, other).", []string{"kind"}, nil)
+	volumeFreeBytesDesc = prometheus.NewDesc("heliosdb_volume_free_bytes",
+		"Free bytes on the data directory's volume.", nil, nil)
+	volumeTotalBytesDesc = prometheus.NewDesc("heliosdb_volume_total_bytes",
+		"Size of the data directory's volume.", nil, nil)
+	dirVolumeFreeBytesDesc = prometheus.NewDesc("heliosdb_storage_volume_free_bytes",
+		"Free bytes on the volume of each storage directory: the data directory, and any holding Raft's log, the WAL or snapshots apart from it.", []string{"dir"}, nil)
+	dirVolumeTotalBytesDesc = prometheus.NewDesc("heliosdb_storage_volume_total_bytes",
+		"Size of the volume of each storage directory.", []string{"dir"}, nil)
+)
+
+// diskCollector exports disk usage, measured at scrape time.
+type diskCollector struct {
+	s *Server
+}
+
+func (c diskCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dataBytesDesc
+	ch <- volumeFreeBytesDesc
+	ch <- volumeTotalBytesDesc
+	ch <- dirVolumeFreeBytesDesc
+	ch <- dirVolumeTotalBytesDesc
+}
+
+func (c diskCollector) Collect(ch chan<- prometheus.Metric) {
+	u, err := c.s.diskUsage()
+	if err != nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(dataBytesDesc, prometheus.GaugeValue, float64(u.RaftLogBytes), "raft_log")
+	ch <- prometheus.MustNewConstMetric(dataBytesDesc, prometheus.GaugeValue, float64(u.WALBytes), "wal")
+	ch <- prometheus.MustNewConstMetric(dataBytesDesc, prometheus.GaugeValue, float64(u.SnapshotBytes), "snapshots")
+	ch <- prometheus.MustNewConstMetric(dataBytesDesc, prometheus.GaugeValue, float64(u.ColdBytes), "cold")
+	ch <- prometheus.MustNewConstMetric(dataBytesDesc, prometheus.GaugeValue, float64(u.OtherBytes), "other")
+	if u.VolumeTotalBytes > 0 {
+		ch <- prometheus.MustNewConstMetric(volumeFreeBytesDesc, prometheus.GaugeValue, float64(u.VolumeFreeBytes))
+		ch <- prometheus.MustNewConstMetric(volumeTotalBytesDesc, prometheus.GaugeValue, float64(u.VolumeTotalBytes))
+	}
+	for _, dir := range u.Dirs {
+		if dir.VolumeTotalBytes > 0 {
+			ch <- prometheus.MustNewConstMetric(dirVolumeFreeBytesDesc, prometheus.GaugeValue, float64(dir.VolumeFreeBytes), dir.Path)
+			ch <- prometheus.MustNewConstMetric(dirVolumeTotalBytesDesc, prometheus.GaugeValue, float64(dir.VolumeTotalBytes), dir.Path)
+		}
+	}
+}
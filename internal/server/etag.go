@@ -0,0 +1,52 @@
+package server
+
+import (
+	"hash/fnv"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ASHISH26940/heliosdb/internal/store"
+)
+
+// VersionHeader is set on reads of a key to its version, which
+// transactions and compare-and-swap name to check the key is unchanged.
+const VersionHeader = "X-Version"
+
+// valueETag returns the ETag of a key's value: its version and a hash of
+// the value, quoted. The version changes with every write, but starts over
+// once a deleted key's tombstone is purged, so the hash keeps a recreated
+// key from matching a copy of the value it had before.
+func valueETag(vv store.VersionedValue) string {
+	h := fnv.New64a()
+	io.WriteString(h, vv.Value)
+	return `"` + strconv.FormatUint(vv.Version, 10) + "-" + strconv.FormatUint(h.Sum64(), 16) + `"`
+}
+
+// notModified reports whether r's If-None-Match header matches etag, so
+// the client's copy is current. Weak tags match their strong form.
+func notModified(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// addVary adds name to the Vary header unless it is already listed.
+func addVary(w http.ResponseWriter, name string) {
+	for _, v := range w.Header().Values("Vary") {
+		if slices.ContainsFunc(strings.Split(v, ","), func(s string) bool { return strings.EqualFold(strings.TrimSpace(s), name) }) {
+			return
+		}
+	}
+	w.Header().Add("Vary", name)
+}
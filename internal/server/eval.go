@@ -0,0 +1,80 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/audit"
+	"github.com/ASHISH26940/heliosdb/internal/script"
+	"github.com/hashicorp/raft"
+)
+
+// maxScriptSize bounds the size of a script, since it is copied into the Raft log.
+const maxScriptSize = 64 << 10
+
+// handleEval runs a script atomically. The script itself is committed to the
+// Raft log and executed by the FSM on every node, so a multi-key update needs
+// a single round trip instead of a client-side OCC retry loop.
+func (s *Server) handleEval(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.raft.State() != raft.Leader {
+		http.Error(w, "Scripts must be sent to the leader at: "+s.leaderAddr(), http.StatusForbidden)
+		return
+	}
+
+	var req v1.EvalRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxScriptSize)).Decode(&req); err != nil {
+		bodyError(w, err)
+		return
+	}
+	if req.Script == "" {
+		http.Error(w, "Invalid request body: script is required", http.StatusBadRequest)
+		return
+	}
+
+	res, scriptErr, err := s.eval(req, httpCaller(r))
+	if scriptErr != nil {
+		http.Error(w, scriptErr.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to apply script: "+err.Error(), applyStatus(err))
+		return
+	}
+
+	log.Printf("[%s] Applied 'EVAL' writing %d keys via Raft", requestID(r), len(res.Mutations))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v1.EvalResponse{Result: res.Value, Keys: res.Keys()})
+}
+
+// eval commits a script through Raft on behalf of c. A script that fails to
+// run is reported as scriptErr and writes nothing; err is a failure to commit.
+func (s *Server) eval(req v1.EvalRequest, c caller) (res script.Result, scriptErr, err error) {
+	cmd := Command{
+		Op:        "EVAL",
+		Script:    req.Script,
+		Args:      req.Args,
+		RequestID: c.requestID,
+		Principal: s.writer(c),
+	}
+	cmdBytes, err := json.Marshal(cmd)
+	if err != nil {
+		return res, nil, err
+	}
+
+	resp, err := s.applyCommand(cmd, cmdBytes)
+	if err == nil {
+		if scriptErr, ok := resp.(error); ok {
+			s.audited(c, audit.Entry{Op: "EVAL"}, scriptErr)
+			return res, scriptErr, nil
+		}
+	}
+	res, _ = resp.(script.Result)
+	s.audited(c, audit.Entry{Op: "EVAL", Keys: res.Keys()}, err)
+	return res, nil, err
+}
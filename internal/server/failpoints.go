@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/audit"
+	"github.com/ASHISH26940/heliosdb/internal/failpoint"
+)
+
+// handleFailpoints lists (GET) or disables all (DELETE) failpoints.
+func (s *Server) handleFailpoints(w http.ResponseWriter, r *http.Request) {
+	if !s.failpoints {
+		http.Error(w, "Failpoints are disabled", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodDelete:
+		failpoint.DisableAll()
+		s.recordAudit(r, audit.Entry{Op: "DISABLE_FAILPOINTS"}, nil)
+		log.Printf("[%s] ADMIN: Disabled all failpoints", requestID(r))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v1.FailpointsResponse{Failpoints: failpoint.List()})
+}
+
+// handleFailpoint enables (PUT) or disables (DELETE) one failpoint, named by
+// the rest of the path, e.g. /admin/failpoints/raft/apply.
+func (s *Server) handleFailpoint(w http.ResponseWriter, r *http.Request) {
+	if !s.failpoints {
+		http.Error(w, "Failpoints are disabled", http.StatusNotFound)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/admin/failpoints/")
+	switch r.Method {
+	case http.MethodPut:
+		var req v1.FailpointRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			bodyError(w, err)
+			return
+		}
+		if req.Term == "" {
+			http.Error(w, "Invalid request body: term is required", http.StatusBadRequest)
+			return
+		}
+		err := failpoint.Enable(name, req.Term)
+		s.recordAudit(r, audit.Entry{Op: "ENABLE_FAILPOINT", Key: name}, err)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("[%s] ADMIN: Enabled failpoint %s=%s", requestID(r), name, req.Term)
+	case http.MethodDelete:
+		failpoint.Disable(name)
+		s.recordAudit(r, audit.Entry{Op: "DISABLE_FAILPOINT", Key: name}, nil)
+		log.Printf("[%s] ADMIN: Disabled failpoint %s", requestID(r), name)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,329 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/api/v1/pb"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+	"github.com/ASHISH26940/heliosdb/internal/transaction"
+	"github.com/google/uuid"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/hashicorp/raft"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// RegisterGRPC serves the gRPC form of the v1 API (api/proto) on gs. It
+// shares the store, Raft node, transactions and audit log with the HTTP API.
+func (s *Server) RegisterGRPC(gs *grpc.Server) {
+	pb.RegisterKVServiceServer(gs, grpcKV{s: s})
+	pb.RegisterTransactionServiceServer(gs, grpcTx{s: s})
+}
+
+// GatewayHandler returns a grpc-gateway that serves the gRPC services as
+// JSON over the same paths and verbs as the REST API, calling them in
+// process. Clients generated from the protobuf definitions can use it
+// without a gRPC transport.
+func (s *Server) GatewayHandler(ctx context.Context) (http.Handler, error) {
+	mux := runtime.NewServeMux(
+		runtime.WithIncomingHeaderMatcher(gatewayHeader),
+		runtime.WithErrorHandler(gatewayError),
+	)
+	if err := pb.RegisterKVServiceHandlerServer(ctx, mux, grpcKV{s: s}); err != nil {
+		return nil, err
+	}
+	if err := pb.RegisterTransactionServiceHandlerServer(ctx, mux, grpcTx{s: s}); err != nil {
+		return nil, err
+	}
+	return mux, nil
+}
+
+// gatewayHeader forwards the API key and request ID to the services, on top
+// of the headers grpc-gateway forwards by default.
+func gatewayHeader(key string) (string, bool) {
+	switch k := strings.ToLower(key); k {
+	case "x-api-key", "x-request-id":
+		return k, true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// gatewayError answers like the REST API where grpc-gateway's status mapping
+// differs from it: writes sent to a follower are refused with 403.
+func gatewayError(ctx context.Context, mux *runtime.ServeMux, m runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	if status.Code(err) == codes.FailedPrecondition {
+		http.Error(w, status.Convert(err).Message(), http.StatusForbidden)
+		return
+	}
+	runtime.DefaultHTTPErrorHandler(ctx, mux, m, w, r, err)
+}
+
+// grpcCaller identifies the caller of a gRPC request from its metadata.
+func grpcCaller(ctx context.Context) caller {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if v := md.Get(key); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	c := caller{
+		principal: apiKeyPrincipal(first("x-api-key")),
+		requestID: first("x-request-id"),
+	}
+	if c.requestID == "" || len(c.requestID) > 128 {
+		c.requestID = uuid.NewString()
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		c.remoteAddr = p.Addr.String()
+	} else {
+		c.remoteAddr = first("x-forwarded-for") // Set by the in-process gateway
+	}
+	return c
+}
+
+// grpcError converts an error from the shared request logic to a status.
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, errNotLeader):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, errTxNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, store.ErrMaintenance), errors.Is(err, errUpstream):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, store.ErrVersionConflict):
+		return status.Error(codes.Aborted, "transaction aborted: a key it depends on was modified concurrently")
+	case errors.Is(err, transaction.ErrTooManyTransactions), errors.Is(err, transaction.ErrWriteSetTooLarge), errors.Is(err, transaction.ErrStagedBytesExceeded),
+		errors.Is(err, store.ErrQuotaExceeded):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// requireLeader refuses a write on a follower, naming the leader, and on a
+// read-only node.
+func (s *Server) requireLeader(what string) error {
+	if err := s.requireWritable(); err != nil {
+		return err
+	}
+	if s.raft.State() != raft.Leader {
+		return status.Errorf(codes.FailedPrecondition, "%s must be sent to the leader at: %s", what, s.leaderAddr())
+	}
+	return nil
+}
+
+// requireWritable refuses a mutating call on a read-only node, or while the
+// cluster is in maintenance mode.
+func (s *Server) requireWritable() error {
+	if s.readOnly {
+		return status.Errorf(codes.PermissionDenied, "this node is read-only; send writes to the leader at: %s", s.leaderAddr())
+	}
+	if m, ok := s.maintenance(); ok {
+		return status.Error(codes.Unavailable, maintenanceMessage(m))
+	}
+	return nil
+}
+
+// grpcKV implements pb.KVServiceServer.
+type grpcKV struct {
+	pb.UnimplementedKVServiceServer
+	s *Server
+}
+
+func (g grpcKV) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
+	c, err := g.s.admitGRPC(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.GetKey() == "" {
+		return nil, status.Error(codes.InvalidArgument, "key is missing")
+	}
+	if store.IsReserved(req.GetKey()) {
+		return nil, status.Error(codes.InvalidArgument, errReservedKey.Error())
+	}
+	if err := grpcCheckKey(c, req.GetKey()); err != nil {
+		return nil, err
+	}
+	g.s.ops.read(req.GetKey())
+	defer g.s.ops.done("GET", time.Now())
+	consistency, err := parseConsistency(req.GetConsistency())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := g.s.confirmLeader(consistency); errors.Is(err, errNotLeader) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	} else if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	vv, ok := g.s.store.Get(req.GetKey())
+	if !ok && g.s.loader != nil {
+		if vv, ok, err = g.s.readThrough(ctx, req.GetKey(), c); err != nil {
+			return nil, grpcError(err)
+		}
+	}
+	if !ok {
+		return nil, status.Error(codes.NotFound, "key not found")
+	}
+	return &pb.GetResponse{Value: vv.Value, Version: vv.Version}, nil
+}
+
+func (g grpcKV) Set(ctx context.Context, req *pb.SetRequest) (*pb.SetResponse, error) {
+	c, err := g.s.admitGRPC(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.GetKey() == "" {
+		return nil, status.Error(codes.InvalidArgument, "key is missing")
+	}
+	if store.IsReserved(req.GetKey()) {
+		return nil, status.Error(codes.InvalidArgument, errReservedKey.Error())
+	}
+	if err := grpcCheckKey(c, req.GetKey()); err != nil {
+		return nil, err
+	}
+	if err := g.s.requireLeader("writes"); err != nil {
+		return nil, err
+	}
+	defer g.s.ops.done("SET", time.Now())
+	if err := g.s.applyKeyCommand(ctx, "SET", req.GetKey(), req.GetValue(), c); err != nil {
+		return nil, grpcError(err)
+	}
+	log.Printf("[%s] Applied 'SET' for key '%s' via Raft (gRPC)", c.requestID, req.GetKey())
+	return &pb.SetResponse{}, nil
+}
+
+func (g grpcKV) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	c, err := g.s.admitGRPC(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.GetKey() == "" {
+		return nil, status.Error(codes.InvalidArgument, "key is missing")
+	}
+	if store.IsReserved(req.GetKey()) {
+		return nil, status.Error(codes.InvalidArgument, errReservedKey.Error())
+	}
+	if err := grpcCheckKey(c, req.GetKey()); err != nil {
+		return nil, err
+	}
+	if err := g.s.requireLeader("writes"); err != nil {
+		return nil, err
+	}
+	defer g.s.ops.done("DELETE", time.Now())
+	if err := g.s.applyKeyCommand(ctx, "DELETE", req.GetKey(), "", c); err != nil {
+		return nil, grpcError(err)
+	}
+	log.Printf("[%s] Applied 'DELETE' for key '%s' via Raft (gRPC)", c.requestID, req.GetKey())
+	return &pb.DeleteResponse{}, nil
+}
+
+func (g grpcKV) Eval(ctx context.Context, req *pb.EvalRequest) (*pb.EvalResponse, error) {
+	c, err := g.s.admitGRPC(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if c.tenant != nil {
+		return nil, status.Error(codes.PermissionDenied, "scripts are not available to tenants")
+	}
+	if req.GetScript() == "" || len(req.GetScript()) > maxScriptSize {
+		return nil, status.Errorf(codes.InvalidArgument, "script must be 1 to %d bytes", maxScriptSize)
+	}
+	if err := g.s.requireLeader("scripts"); err != nil {
+		return nil, err
+	}
+	res, scriptErr, err := g.s.eval(v1.EvalRequest{Script: req.GetScript(), Args: req.GetArgs()}, c)
+	if scriptErr != nil {
+		return nil, status.Error(codes.InvalidArgument, scriptErr.Error())
+	}
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.EvalResponse{Result: res.Value, Keys: res.Keys()}, nil
+}
+
+// grpcTx implements pb.TransactionServiceServer.
+type grpcTx struct {
+	pb.UnimplementedTransactionServiceServer
+	s *Server
+}
+
+func (g grpcTx) Begin(ctx context.Context, req *pb.BeginRequest) (*pb.BeginResponse, error) {
+	if _, err := g.s.admitGRPC(ctx); err != nil {
+		return nil, err
+	}
+	if err := g.s.requireWritable(); err != nil {
+		return nil, err
+	}
+	var tx *transaction.Transaction
+	var err error
+	if level := req.GetIsolation(); level != "" {
+		iso, parseErr := transaction.ParseIsolation(level)
+		if parseErr != nil {
+			return nil, status.Error(codes.InvalidArgument, parseErr.Error())
+		}
+		tx, err = g.s.txm.BeginWith(iso)
+	} else {
+		tx, err = g.s.txm.Begin()
+	}
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.BeginResponse{TxId: tx.ID, Isolation: string(tx.Isolation)}, nil
+}
+
+func (g grpcTx) Operations(ctx context.Context, req *pb.OperationsRequest) (*pb.OperationsResponse, error) {
+	c, err := g.s.admitGRPC(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tx, ok := g.s.txm.Use(req.GetTxId())
+	if !ok {
+		return nil, grpcError(errTxNotFound)
+	}
+	defer tx.Release()
+	ops := make([]v1.TxOperation, len(req.GetOperations()))
+	for i, op := range req.GetOperations() {
+		ops[i] = v1.TxOperation{Op: op.GetOp(), Key: op.GetKey(), Value: op.GetValue()}
+		if err := validateTxOperation(ops[i]); err != nil {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid operation %d: %v", i, err))
+		}
+		if err := grpcCheckKey(c, ops[i].Key); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := g.s.reserveOperations(tx, ops); err != nil {
+		return nil, grpcError(err)
+	}
+	results := g.s.stageOperations(tx, ops)
+	resp := &pb.OperationsResponse{Results: make([]*pb.OperationResult, len(results))}
+	for i, r := range results {
+		resp.Results[i] = &pb.OperationResult{Op: r.Op, Key: r.Key, Value: r.Value, Found: r.Found}
+	}
+	return resp, nil
+}
+
+func (g grpcTx) Commit(ctx context.Context, req *pb.CommitRequest) (*pb.CommitResponse, error) {
+	c, err := g.s.admitGRPC(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.s.requireWritable(); err != nil {
+		return nil, err
+	}
+	if err := g.s.commitTransaction(req.GetTxId(), c); err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.CommitResponse{}, nil
+}
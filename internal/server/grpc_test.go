@@ -0,0 +1,199 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ASHISH26940/heliosdb/api/v1/pb"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestGRPC(t *testing.T) {
+	kv := newMockStore()
+	mockRaftNode := &mockRaft{isLeader: true, store: kv}
+	srv := New(kv, mockRaftNode)
+
+	ln := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	srv.RegisterGRPC(gs)
+	go gs.Serve(ln)
+	defer gs.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return ln.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+	kvc := pb.NewKVServiceClient(conn)
+	txc := pb.NewTransactionServiceClient(conn)
+	ctx := context.Background()
+
+	// --- Test Case 1: Set and get a key ---
+	if _, err := kvc.Set(ctx, &pb.SetRequest{Key: "foo", Value: "bar"}); err != nil {
+		t.Fatalf("expected Set to succeed, but got %v", err)
+	}
+	got, err := kvc.Get(ctx, &pb.GetRequest{Key: "foo", Consistency: ConsistencyStrong})
+	if err != nil || got.GetValue() != "bar" || got.GetVersion() != 1 {
+		t.Errorf("expected bar at version 1, but got %v (err %v)", got, err)
+	}
+
+	// --- Test Case 2: A missing key is NotFound ---
+	if _, err := kvc.Get(ctx, &pb.GetRequest{Key: "missing"}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected %s, but got %v", codes.NotFound, err)
+	}
+
+	// --- Test Case 3: A transaction through the batch API ---
+	begin, err := txc.Begin(ctx, &pb.BeginRequest{Isolation: "occ"})
+	if err != nil || begin.GetIsolation() != "occ" {
+		t.Fatalf("expected an occ transaction, but got %v (err %v)", begin, err)
+	}
+	ops, err := txc.Operations(ctx, &pb.OperationsRequest{TxId: begin.GetTxId(), Operations: []*pb.Operation{
+		{Op: "get", Key: "foo"},
+		{Op: "set", Key: "baz", Value: "qux"},
+	}})
+	if err != nil || len(ops.GetResults()) != 2 || ops.GetResults()[0].GetValue() != "bar" {
+		t.Fatalf("expected to read foo=bar, but got %v (err %v)", ops, err)
+	}
+	if _, err := txc.Commit(ctx, &pb.CommitRequest{TxId: begin.GetTxId()}); err != nil {
+		t.Fatalf("expected Commit to succeed, but got %v", err)
+	}
+	if val, _ := kv.Get("baz"); val.Value != "qux" {
+		t.Errorf("expected baz to be qux, but got %q", val.Value)
+	}
+
+	// --- Test Case 4: Writes on a follower fail the precondition ---
+	mockRaftNode.isLeader = false
+	if _, err := kvc.Delete(ctx, &pb.DeleteRequest{Key: "foo"}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected %s, but got %v", codes.FailedPrecondition, err)
+	}
+
+	// --- Test Case 5: Reserved keys cannot be read ---
+	kv.Set(store.JoinTokenPrefix+"secret", "{}")
+	if _, err := kvc.Get(ctx, &pb.GetRequest{Key: store.JoinTokenPrefix + "secret"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected %s, but got %v", codes.InvalidArgument, err)
+	}
+}
+
+func TestGateway(t *testing.T) {
+	kv := newMockStore()
+	mockRaftNode := &mockRaft{isLeader: true, store: kv}
+	srv := New(kv, mockRaftNode)
+	gateway, err := srv.GatewayHandler(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create gateway: %v", err)
+	}
+
+	// --- Test Case 1: The REST paths and bodies are served ---
+	rr := httptest.NewRecorder()
+	gateway.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/kv/foo", strings.NewReader(`{"value":"bar"}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, but got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	gateway.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/kv/foo", nil))
+	var got struct{ Value string }
+	json.NewDecoder(rr.Body).Decode(&got)
+	if rr.Code != http.StatusOK || got.Value != "bar" {
+		t.Errorf("expected bar, but got %d %q", rr.Code, got.Value)
+	}
+
+	// --- Test Case 2: A missing key is 404 ---
+	rr = httptest.NewRecorder()
+	gateway.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/kv/missing", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, but got %d", http.StatusNotFound, rr.Code)
+	}
+
+	// --- Test Case 3: A write on a follower is 403, as in the REST API ---
+	mockRaftNode.isLeader = false
+	rr = httptest.NewRecorder()
+	gateway.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/v1/kv/foo", nil))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d, but got %d", http.StatusForbidden, rr.Code)
+	}
+}
+
+func TestGRPCTenants(t *testing.T) {
+	kv := newMockStore()
+	srv := New(kv, &mockRaft{isLeader: true, store: kv}, WithTenants([]Tenant{{Name: "payments", Namespace: "payments/", APIKeys: []string{"pay-key"}}}))
+	g := grpcKV{s: srv}
+	withKey := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", "pay-key"))
+
+	// --- Test Case 1: Calls need a tenant's key ---
+	if _, err := g.Set(context.Background(), &pb.SetRequest{Key: "payments/a", Value: "1"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected %s, but got %v", codes.Unauthenticated, err)
+	}
+
+	// --- Test Case 2: Tenants stay within their namespace ---
+	if _, err := g.Set(withKey, &pb.SetRequest{Key: "payments/a", Value: "1"}); err != nil {
+		t.Errorf("expected Set to succeed, but got %v", err)
+	}
+	if _, err := g.Get(withKey, &pb.GetRequest{Key: "search/a"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected %s, but got %v", codes.PermissionDenied, err)
+	}
+	if _, err := g.Eval(withKey, &pb.EvalRequest{Script: "return 1"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected scripts to be refused, but got %v", err)
+	}
+
+	// --- Test Case 3: Calls on the unix socket are not restricted ---
+	path := filepath.Join(t.TempDir(), "grpc.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	gs := grpc.NewServer()
+	srv.RegisterGRPC(gs)
+	go gs.Serve(ln)
+	defer gs.Stop()
+	conn, err := grpc.NewClient("unix://"+path, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+	if _, err := pb.NewKVServiceClient(conn).Set(context.Background(), &pb.SetRequest{Key: "search/a", Value: "1"}); err != nil {
+		t.Errorf("expected Set on the unix socket to succeed, but got %v", err)
+	}
+}
+
+func TestGRPCKeyRateLimit(t *testing.T) {
+	kv := newMockStore()
+	srv := New(kv, &mockRaft{isLeader: true, store: kv}, WithKeyRateLimit(1))
+	g := grpcKV{s: srv}
+	withKey := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", "batch-key"))
+
+	// --- Test Case 1: Calls over the key's rate are refused ---
+	exhausted := 0
+	for i := 0; i < 3; i++ {
+		if _, err := g.Set(withKey, &pb.SetRequest{Key: "a", Value: "1"}); status.Code(err) == codes.ResourceExhausted {
+			exhausted++
+		}
+	}
+	if exhausted == 0 {
+		t.Errorf("expected calls over the rate to be refused with %s, but none were", codes.ResourceExhausted)
+	}
+
+	// --- Test Case 2: Calls without a key share one cap ---
+	exhausted = 0
+	for i := 0; i < 3; i++ {
+		if _, err := g.Set(context.Background(), &pb.SetRequest{Key: "a", Value: "1"}); status.Code(err) == codes.ResourceExhausted {
+			exhausted++
+		}
+	}
+	if exhausted == 0 {
+		t.Errorf("expected anonymous calls over the rate to be refused with %s, but none were", codes.ResourceExhausted)
+	}
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+)
+
+// historyRequested reports whether r, a GET of /kv/{key}, asks for the
+// key's history, with ?history=true, instead of its value.
+func historyRequested(r *http.Request) bool {
+	history, _ := strconv.ParseBool(r.URL.Query().Get("history"))
+	return history
+}
+
+// WithKeyHistory serves GET /kv/{key}?history=true with fn, which returns the
+// versions of a key this node has recorded, newest first.
+func WithKeyHistory(fn func(key string) []v1.KeyVersion) Option {
+	return func(s *Server) {
+		s.history = fn
+	}
+}
+
+// handleHistory lists the versions of key written since this node started,
+// with when and, if audit logging is enabled, by whom, for debugging how
+// the key got its value.
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request, key string) {
+	if s.history == nil {
+		http.Error(w, "Key history is not enabled on this node (see key_history_versions)", http.StatusNotFound)
+		return
+	}
+	versions := s.history(key)
+	if len(versions) == 0 {
+		if _, ok := s.store.Get(key); !ok {
+			http.Error(w, "Key not found", http.StatusNotFound)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v1.KeyHistoryResponse{Key: key, Versions: append([]v1.KeyVersion{}, versions...)})
+}
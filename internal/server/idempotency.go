@@ -0,0 +1,66 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ASHISH26940/heliosdb/internal/store"
+	"github.com/ASHISH26940/heliosdb/internal/transaction"
+)
+
+// IdempotencyKeyHeader carries a client-chosen key naming a transaction sent
+// to /tx/execute. Retries sent with the same key are applied at most once.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// DefaultIdempotencyTTL is how long commits are remembered by their
+// Idempotency-Key unless WithIdempotencyTTL says otherwise.
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// maxIdempotencyKeyLength bounds the Idempotency-Key header.
+const maxIdempotencyKeyLength = 255
+
+// txIdempotency is what a transaction sent with an Idempotency-Key is
+// remembered by once it commits.
+type txIdempotency struct {
+	id     string // Hash of the caller's tenant and key
+	record string // A store.IdempotencyRecord as JSON
+}
+
+// txIdempotency returns what the transaction of writes and reads, sent by c
+// in r, is remembered by, or nil if r has no Idempotency-Key. Keys are
+// scoped to c's tenant, so tenants cannot see each other's commits.
+func (s *Server) txIdempotency(r *http.Request, c caller, writes []transaction.WriteOp, reads []transaction.ReadOp) (*txIdempotency, error) {
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if key == "" || s.idempotencyTTL <= 0 {
+		return nil, nil
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		return nil, errors.New("longer than 255 bytes")
+	}
+	var scope string
+	if c.tenant != nil {
+		scope = c.tenant.name
+	}
+	id := sha256.Sum256([]byte(scope + "\x00" + key))
+
+	payload, err := json.Marshal(struct {
+		Writes []transaction.WriteOp `json:"writes"`
+		Reads  []transaction.ReadOp  `json:"reads"`
+	}{writes, reads})
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(payload)
+	record, err := json.Marshal(store.IdempotencyRecord{
+		Expires: time.Now().Add(s.idempotencyTTL).UTC(),
+		Digest:  hex.EncodeToString(digest[:]),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &txIdempotency{id: hex.EncodeToString(id[:]), record: string(record)}, nil
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/audit"
+	"github.com/ASHISH26940/heliosdb/internal/rdb"
+	"github.com/hashicorp/raft"
+)
+
+// handleRedisImport loads the string keys of a Redis RDB dump, sent as the
+// request body, through the bulk-load path. Only one Redis database is
+// imported (?db=, default 0), since HeliosDB has a single keyspace.
+//
+// HeliosDB has no TTLs: keys that have already expired are skipped, and the
+// rest are imported without their expiry. Keys or values that aren't valid
+// UTF-8 are skipped too, as they can't be stored losslessly.
+func (s *Server) handleRedisImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.raft.State() != raft.Leader {
+		http.Error(w, "Imports must be sent to the leader at: "+s.leaderAddr(), http.StatusForbidden)
+		return
+	}
+	db := 0
+	if v := r.URL.Query().Get("db"); v != "" {
+		var err error
+		if db, err = strconv.Atoi(v); err != nil || db < 0 {
+			http.Error(w, "Invalid db", http.StatusBadRequest)
+			return
+		}
+	}
+
+	clearDeadlines(w)
+	resp, err := s.importRDB(r.Body, db, httpCaller(r))
+	s.recordAudit(r, audit.Entry{Op: "IMPORT_REDIS"}, err)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, errBadRecord) {
+			code = http.StatusBadRequest
+		}
+		http.Error(w, fmt.Sprintf("Import stopped after %d records: %v", resp.Records, err), code)
+		return
+	}
+
+	log.Printf("[%s] ADMIN: Imported %d keys from a Redis dump in %d batches", requestID(r), resp.Records, resp.Batches)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// importRDB bulk-loads the string keys of database db from the dump in body.
+func (s *Server) importRDB(body io.Reader, db int, c caller) (v1.RedisImportResponse, error) {
+	var resp v1.RedisImportResponse
+	b := &bulkLoader{s: s, c: c}
+	report := func(err error) (v1.RedisImportResponse, error) {
+		resp.Records, resp.Batches = b.records, b.batches
+		return resp, err
+	}
+
+	dump, err := rdb.NewReader(body)
+	if err != nil {
+		return report(fmt.Errorf("%w: %v", errBadRecord, err))
+	}
+	now := time.Now()
+	for {
+		e, err := dump.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return report(fmt.Errorf("%w: %v", errBadRecord, err))
+		}
+		switch {
+		case e.DB != db:
+			continue
+		case !e.ExpireAt.IsZero() && !e.ExpireAt.After(now):
+			resp.Expired++
+			continue
+		case !utf8.ValidString(e.Key) || !utf8.ValidString(e.Value):
+			resp.NotUTF8++
+			continue
+		}
+		if !e.ExpireAt.IsZero() {
+			resp.TTLsDropped++
+		}
+		if err := b.add(e.Key, e.Value); err != nil {
+			return report(err)
+		}
+	}
+	resp.Skipped = dump.Skipped()
+	return report(b.flush())
+}
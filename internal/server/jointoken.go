@@ -0,0 +1,170 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/audit"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+	"github.com/hashicorp/raft"
+)
+
+// JoinTokenHeader carries the join token on requests that change the
+// cluster's membership.
+const JoinTokenHeader = "X-Join-Token"
+
+// defaultJoinTokenTTL is how long a one-time join token stays valid unless
+// the request says otherwise.
+const defaultJoinTokenTTL = time.Hour
+
+// WithJoinToken requires token, or a one-time token minted with it, on
+// /join and /admin/decommission, so that hosts that can reach the HTTP
+// port cannot add themselves as voters or remove others. An empty token
+// leaves membership changes open.
+func WithJoinToken(token string) Option {
+	return func(s *Server) {
+		s.joinToken = token
+	}
+}
+
+// authorizeMembership reports whether r may change the cluster's
+// membership, and answers 401 if not. A one-time token is spent through
+// Raft, so it must be called on the leader.
+func (s *Server) authorizeMembership(w http.ResponseWriter, r *http.Request) bool {
+	if s.joinToken == "" {
+		return true
+	}
+	token := r.Header.Get(JoinTokenHeader)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.joinToken)) == 1 {
+		return true
+	}
+	if token != "" && s.spendJoinToken(r, token) {
+		return true
+	}
+	http.Error(w, "A valid join token is required in the "+JoinTokenHeader+" header", http.StatusUnauthorized)
+	return false
+}
+
+// spendJoinToken spends the one-time join token, if it exists and has not
+// expired, and reports whether it did. Tokens that are not in the local
+// store are refused without a Raft proposal, so that guessing tokens costs
+// the cluster nothing.
+func (s *Server) spendJoinToken(r *http.Request, token string) bool {
+	hash := hashJoinToken(token)
+	now := time.Now().UTC()
+	vv, ok := s.store.Get(store.JoinTokenPrefix + hash)
+	if !ok {
+		return false
+	}
+	if expires, err := time.Parse(time.RFC3339Nano, vv.Value); err != nil || !now.Before(expires) {
+		return false
+	}
+	cmd := Command{Op: "USE_JOIN_TOKEN", Key: hash, Value: now.Format(time.RFC3339Nano), RequestID: requestID(r)}
+	cmdBytes, err := json.Marshal(cmd)
+	if err != nil {
+		return false
+	}
+	resp, err := s.applyCommand(cmd, cmdBytes)
+	if err != nil {
+		log.Printf("[%s] Failed to check a join token: %v", requestID(r), err)
+		return false
+	}
+	valid, _ := resp.(bool)
+	return valid
+}
+
+// expiredJoinTokens returns the unused one-time tokens that expired before
+// now, by hash, with the versions they are stored at.
+func (s *Server) expiredJoinTokens(now time.Time) map[string]uint64 {
+	var expired map[string]uint64
+	s.store.Iterate(func(key string, vv store.VersionedValue) bool {
+		hash, ok := strings.CutPrefix(key, store.JoinTokenPrefix)
+		if !ok {
+			return true
+		}
+		if expires, err := time.Parse(time.RFC3339Nano, vv.Value); err != nil || !now.Before(expires) {
+			if expired == nil {
+				expired = make(map[string]uint64)
+			}
+			expired[hash] = vv.Version
+		}
+		return true
+	})
+	return expired
+}
+
+// hashJoinToken returns the hash a one-time token is stored under, so that
+// the tokens themselves are never replicated or written to disk.
+func hashJoinToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// handleJoinTokens mints a one-time join token (POST). It needs the shared
+// join token, and is served by the leader. Minting also forgets the tokens
+// that expired unused.
+func (s *Server) handleJoinTokens(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.joinToken == "" {
+		http.Error(w, "Join tokens are disabled: join_token is not set", http.StatusNotFound)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(JoinTokenHeader)), []byte(s.joinToken)) != 1 {
+		http.Error(w, "The shared join token is required in the "+JoinTokenHeader+" header", http.StatusUnauthorized)
+		return
+	}
+	if s.raft.State() != raft.Leader {
+		http.Error(w, "Join tokens must be created on the leader at: "+s.leaderAddr(), http.StatusForbidden)
+		return
+	}
+	var req v1.JoinTokenRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			bodyError(w, err)
+			return
+		}
+	}
+	ttl := defaultJoinTokenTTL
+	if req.TTL != "" {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid ttl", http.StatusBadRequest)
+			return
+		}
+		ttl = d
+	}
+
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	now := time.Now().UTC()
+	res := v1.JoinTokenResponse{Token: hex.EncodeToString(b[:]), ExpiresAt: now.Add(ttl)}
+	cmd := Command{Op: "JOIN_TOKEN", Key: hashJoinToken(res.Token), Value: res.ExpiresAt.Format(time.RFC3339Nano), Purge: s.expiredJoinTokens(now), RequestID: requestID(r)}
+	cmdBytes, err := json.Marshal(cmd)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, err = s.applyCommand(cmd, cmdBytes)
+	s.recordAudit(r, audit.Entry{Op: "JOIN_TOKEN"}, err)
+	if err != nil {
+		http.Error(w, "Failed to apply command: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[%s] ADMIN: Created a join token valid until %s", requestID(r), res.ExpiresAt.Format(time.RFC3339))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+)
+
+// handleKeyspace reports how many keys the node holds, and how large they
+// and their values are, overall and under each prefix, from statistics the
+// store keeps as it is written. With ?prefix=, only prefixes starting with
+// it are listed.
+func (s *Server) handleKeyspace(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	st, ok := s.store.(interface{ KeyspaceStats() store.KeyspaceStats })
+	if !ok {
+		http.Error(w, "Keyspace statistics are not available on this node", http.StatusNotFound)
+		return
+	}
+	stats := st.KeyspaceStats()
+	filter := r.URL.Query().Get("prefix")
+	res := v1.KeyspaceResponse{Total: prefixStats(stats.Total), Delimiters: store.PrefixDelimiters}
+	for i, prefixes := range stats.Levels {
+		level := v1.KeyspaceLevel{Level: i + 1, Prefixes: []v1.PrefixStats{}}
+		for _, p := range prefixes {
+			if strings.HasPrefix(p.Prefix, filter) {
+				level.Prefixes = append(level.Prefixes, prefixStats(p))
+			}
+		}
+		if other := stats.Other[i]; other.Keys > 0 {
+			o := prefixStats(other)
+			level.Other = &o
+		}
+		res.Levels = append(res.Levels, level)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// prefixStats converts p to its API form.
+func prefixStats(p store.PrefixStats) v1.PrefixStats {
+	out := v1.PrefixStats{Prefix: p.Prefix, Keys: p.Keys, Bytes: p.Bytes}
+	for i, keys := range p.ValueSizes {
+		bucket := v1.ValueSizeBucket{Keys: keys}
+		if i < len(store.ValueSizeBounds) {
+			bucket.MaxBytes = store.ValueSizeBounds[i]
+		}
+		out.ValueSizes = append(out.ValueSizes, bucket)
+	}
+	return out
+}
@@ -0,0 +1,270 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"golang.org/x/time/rate"
+)
+
+// maxMeteredKeys bounds how many API keys are metered separately. Outside
+// multi-tenant mode any client can make up keys, so keys first seen after
+// the limit is reached are metered together, under "other".
+const maxMeteredKeys = 1000
+
+// WithKeyMetering counts the requests, and the bytes received and sent over
+// HTTP, of each API key, for /metrics and /admin/api-keys. Requests without
+// a key are counted under "anonymous".
+func WithKeyMetering(enabled bool) Option {
+	return func(s *Server) {
+		if enabled && s.keyMeter == nil {
+			s.keyMeter = &keyMeter{}
+		}
+	}
+}
+
+// WithKeyRateLimit caps the request rate of each API key, and enables key
+// metering. The cap applies to every key on its own, on top of its tenant's
+// request rate, so that one busy key cannot use up what its tenant's other
+// keys are allowed. Requests without a key share one cap, as do keys seen
+// after maxMeteredKeys others, so that leaving out the key or making up new
+// ones does not escape it. 0 is unlimited. SetKeyRateLimit changes the cap
+// at runtime.
+func WithKeyRateLimit(requestsPerSecond float64) Option {
+	return func(s *Server) {
+		if requestsPerSecond <= 0 {
+			return
+		}
+		if s.keyMeter == nil {
+			s.keyMeter = &keyMeter{}
+		}
+		s.keyMeter.requestsPerSecond = requestsPerSecond
+	}
+}
+
+// keyMeter holds the usage of each API key seen.
+type keyMeter struct {
+	mu                sync.Mutex
+	requestsPerSecond float64 // Cap for each key; 0 is unlimited
+	keys              map[[sha256.Size]byte]*keyUsage
+	other             *keyUsage // Keys seen after maxMeteredKeys others
+	anon              *keyUsage // Requests without a key
+}
+
+// keyUsage counts the requests and bytes of one API key.
+type keyUsage struct {
+	id      string // Fingerprint of the key, safe to show
+	key     string // Truncated key, as in the audit log
+	tenant  string
+	limiter atomic.Pointer[rate.Limiter] // nil when unlimited
+
+	requests  atomic.Uint64 // Admitted
+	throttled atomic.Uint64 // Refused for exceeding the key's request rate
+	bytesIn   atomic.Uint64 // Of request bodies
+	bytesOut  atomic.Uint64 // Of response bodies
+}
+
+// keyFingerprint identifies an API key in metrics without revealing it:
+// the first 12 hex digits of its SHA-256 hash.
+func keyFingerprint(hash [sha256.Size]byte) string {
+	return hex.EncodeToString(hash[:6])
+}
+
+// usage returns the usage of apiKey, belonging to t if it is a tenant's,
+// adding it if it is new.
+func (m *keyMeter) usage(apiKey string, t *tenant) *keyUsage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if apiKey == "" {
+		if m.anon == nil {
+			m.anon = m.newUsage("anonymous", "anonymous")
+		}
+		return m.anon
+	}
+	hash := sha256.Sum256([]byte(apiKey))
+	if u, ok := m.keys[hash]; ok {
+		return u
+	}
+	if len(m.keys) >= maxMeteredKeys {
+		if m.other == nil {
+			m.other = m.newUsage("other", "other")
+		}
+		return m.other
+	}
+	u := m.newUsage(keyFingerprint(hash), apiKeyPrincipal(apiKey))
+	if t != nil {
+		u.tenant = t.name
+	}
+	if m.keys == nil {
+		m.keys = make(map[[sha256.Size]byte]*keyUsage)
+	}
+	m.keys[hash] = u
+	return u
+}
+
+// newUsage returns the usage of a new key or group of keys, capped at the
+// meter's request rate.
+func (m *keyMeter) newUsage(id, key string) *keyUsage {
+	u := &keyUsage{id: id, key: key}
+	setRate(&u.limiter, m.requestsPerSecond)
+	return u
+}
+
+// setRate changes the cap of every key, seen or not, to requestsPerSecond.
+func (m *keyMeter) setRate(requestsPerSecond float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requestsPerSecond = requestsPerSecond
+	for _, u := range m.keys {
+		setRate(&u.limiter, requestsPerSecond)
+	}
+	for _, u := range []*keyUsage{m.other, m.anon} {
+		if u != nil {
+			setRate(&u.limiter, requestsPerSecond)
+		}
+	}
+}
+
+// SetKeyRateLimit changes the request rate cap of each API key, as set by
+// WithKeyRateLimit, at runtime. Keys are only metered if they were at
+// startup, so a cap cannot be added to a server started without metering.
+func (s *Server) SetKeyRateLimit(requestsPerSecond float64) error {
+	if s.keyMeter == nil {
+		if requestsPerSecond <= 0 {
+			return nil
+		}
+		return errors.New("API keys are not metered; enable api_key_metering or a cap at startup to cap them at runtime")
+	}
+	s.keyMeter.setRate(requestsPerSecond)
+	return nil
+}
+
+// list returns the usage of every key, ordered by fingerprint.
+func (m *keyMeter) list() []*keyUsage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]*keyUsage, 0, len(m.keys)+2)
+	for _, u := range m.keys {
+		out = append(out, u)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].id < out[j].id })
+	if m.anon != nil {
+		out = append(out, m.anon)
+	}
+	if m.other != nil {
+		out = append(out, m.other)
+	}
+	return out
+}
+
+// allow counts a request of u, and reports whether it is within the key's
+// request rate.
+func (u *keyUsage) allow() bool {
+	if !allowRate(&u.limiter) {
+		u.throttled.Add(1)
+		return false
+	}
+	u.requests.Add(1)
+	return true
+}
+
+// meteredKey returns the usage to count a request with apiKey against, or
+// nil if it is not metered: when metering is off, or in multi-tenant mode
+// for keys of no tenant, which are refused anyway.
+func (s *Server) meteredKey(apiKey string) *keyUsage {
+	if s.keyMeter == nil {
+		return nil
+	}
+	t := s.tenantByKey(apiKey)
+	if len(s.tenantList) > 0 && t == nil {
+		return nil
+	}
+	return s.keyMeter.usage(apiKey, t)
+}
+
+// admitKey counts a data-plane request against its API key and refuses it
+// with 429 if the key exceeds its request rate. It returns w and r wrapped
+// to count the bytes sent and received.
+func (s *Server) admitKey(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, *http.Request, bool) {
+	if s.keyMeter == nil || unixClient(r) || !dataPlanePath(cleanPath(r.URL.Path)) {
+		return w, r, true
+	}
+	u := s.meteredKey(r.Header.Get("X-API-Key"))
+	if u == nil {
+		return w, r, true
+	}
+	if !u.allow() {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "API key "+u.key+" exceeded its request rate", http.StatusTooManyRequests)
+		return w, r, false
+	}
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = &meteredBody{ReadCloser: r.Body, n: &u.bytesIn}
+	}
+	return &meteredWriter{ResponseWriter: w, n: &u.bytesOut}, r, true
+}
+
+// meteredBody counts the bytes read from a request body.
+type meteredBody struct {
+	io.ReadCloser
+	n *atomic.Uint64
+}
+
+func (b *meteredBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(uint64(n))
+	return n, err
+}
+
+// meteredWriter counts the bytes written to a response.
+type meteredWriter struct {
+	http.ResponseWriter
+	n *atomic.Uint64
+}
+
+func (w *meteredWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n.Add(uint64(n))
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, to flush
+// watch and subscription streams.
+func (w *meteredWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// handleAPIKeys reports the requests and bytes of each metered API key.
+// Keys are identified by fingerprint and truncated, never in full.
+func (s *Server) handleAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.keyMeter == nil {
+		http.Error(w, "API key metering is not enabled on this node", http.StatusNotFound)
+		return
+	}
+	res := v1.APIKeysResponse{Keys: []v1.APIKeyUsage{}}
+	for _, u := range s.keyMeter.list() {
+		res.Keys = append(res.Keys, v1.APIKeyUsage{
+			ID:            u.id,
+			Key:           u.key,
+			Tenant:        u.tenant,
+			Requests:      u.requests.Load(),
+			Throttled:     u.throttled.Load(),
+			BytesReceived: u.bytesIn.Load(),
+			BytesSent:     u.bytesOut.Load(),
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,389 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+)
+
+// statsWindow is how often the latencies and hot keys in /stats start
+// over. They cover the window in progress and the one before it, so recent
+// load is never hidden by hours of history.
+const statsWindow = time.Minute
+
+// hotKeyCounters is how many keys each hot-key sketch counts at once. The
+// more there are, the closer the counts of the hottest are to exact.
+const hotKeyCounters = 256
+
+// defaultHotKeys and maxHotKeys bound how many hot keys /stats lists.
+const (
+	defaultHotKeys = 10
+	maxHotKeys     = 100
+)
+
+// trackedOps are the operations whose latencies are tracked, by the names
+// /stats reports them under.
+var trackedOps = [...]string{
+	"GET", "SET", "DELETE", "UPDATE", "RENAME", "COPY", "HISTORY", "DELETE_PREFIX",
+	"SCAN", "AGGREGATE", "SAMPLE", "QUERY", "EVAL", "TX",
+}
+
+// opIndex maps the names in trackedOps to their positions.
+var opIndex = func() map[string]int {
+	m := make(map[string]int, len(trackedOps))
+	for i, op := range trackedOps {
+		m[op] = i
+	}
+	return m
+}()
+
+// latencyBuckets is how many buckets a latencyHistogram has. Bucket i
+// counts latencies of up to 2^i microseconds, and the last the rest: about
+// 34 seconds and more.
+const latencyBuckets = 26
+
+// latencyHistogram counts latencies in buckets whose bounds double.
+type latencyHistogram struct {
+	counts [latencyBuckets]atomic.Uint64
+}
+
+// observe counts one latency of d.
+func (h *latencyHistogram) observe(d time.Duration) {
+	i := 0
+	for us := d.Microseconds(); i < latencyBuckets-1 && us > 1<<i; i++ {
+	}
+	h.counts[i].Add(1)
+}
+
+// bucketBounds returns the range of latencies bucket i counts.
+func bucketBounds(i int) (lower, upper time.Duration) {
+	upper = time.Duration(1<<i) * time.Microsecond
+	if i > 0 {
+		lower = upper / 2
+	}
+	return lower, upper
+}
+
+// quantile estimates the latency that the fraction q of those counted in
+// counts, totalling total, did not exceed, assuming they are spread evenly
+// within each bucket.
+func quantile(counts *[latencyBuckets]uint64, total uint64, q float64) time.Duration {
+	rank := q * float64(total)
+	var seen float64
+	for i, n := range counts {
+		if n == 0 {
+			continue
+		}
+		if seen+float64(n) >= rank {
+			lower, upper := bucketBounds(i)
+			return lower + time.Duration(float64(upper-lower)*(rank-seen)/float64(n))
+		}
+		seen += float64(n)
+	}
+	return 0
+}
+
+// hotKeys estimates which keys are counted most often, with the
+// Space-Saving algorithm: it keeps hotKeyCounters counters, and a key
+// without one takes over the smallest, inheriting its count. A key's count
+// then overstates its true count by at most the count it inherited.
+//
+// Counters are kept in buckets of equal count, linked in ascending order
+// (the Stream-Summary structure), so that counting a key and finding the
+// smallest counter both take constant time.
+type hotKeys struct {
+	mu       sync.Mutex
+	counters map[string]*hotKey
+	min      *hotBucket // Smallest count; nil until a key is counted
+}
+
+// hotBucket holds the counters of one count.
+type hotBucket struct {
+	count      uint64
+	keys       map[*hotKey]struct{}
+	prev, next *hotBucket
+}
+
+// hotKey is the counter of one key.
+type hotKey struct {
+	key    string
+	count  uint64
+	error  uint64     // Inherited from the key it replaced
+	bucket *hotBucket // nil in snapshots
+}
+
+// add counts key once.
+func (h *hotKeys) add(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if c, ok := h.counters[key]; ok {
+		h.increment(c)
+		return
+	}
+	if h.counters == nil {
+		h.counters = make(map[string]*hotKey, hotKeyCounters)
+	}
+	if len(h.counters) < hotKeyCounters {
+		c := &hotKey{key: key, count: 1}
+		h.counters[key] = c
+		if h.min == nil || h.min.count != 1 {
+			b := &hotBucket{count: 1, keys: make(map[*hotKey]struct{}), next: h.min}
+			if h.min != nil {
+				h.min.prev = b
+			}
+			h.min = b
+		}
+		c.bucket = h.min
+		h.min.keys[c] = struct{}{}
+		return
+	}
+	var c *hotKey
+	for c = range h.min.keys {
+		break
+	}
+	delete(h.counters, c.key)
+	c.key, c.error = key, c.count
+	h.counters[key] = c
+	h.increment(c)
+}
+
+// increment moves c to the bucket one count up.
+func (h *hotKeys) increment(c *hotKey) {
+	from := c.bucket
+	to := from.next
+	if to == nil || to.count != c.count+1 {
+		to = &hotBucket{count: c.count + 1, keys: make(map[*hotKey]struct{}), prev: from, next: from.next}
+		if from.next != nil {
+			from.next.prev = to
+		}
+		from.next = to
+	}
+	delete(from.keys, c)
+	if len(from.keys) == 0 {
+		if from.prev != nil {
+			from.prev.next = from.next
+		} else {
+			h.min = from.next
+		}
+		from.next.prev = from.prev
+	}
+	c.count++
+	c.bucket = to
+	to.keys[c] = struct{}{}
+}
+
+// snapshot returns a copy of the counters, and the most a key without one
+// may have been counted.
+func (h *hotKeys) snapshot() (map[string]hotKey, uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make(map[string]hotKey, len(h.counters))
+	for k, c := range h.counters {
+		out[k] = hotKey{key: k, count: c.count, error: c.error}
+	}
+	var floor uint64
+	if len(h.counters) >= hotKeyCounters {
+		floor = h.min.count
+	}
+	return out, floor
+}
+
+// opWindow holds what was tracked during one statsWindow.
+type opWindow struct {
+	start     time.Time
+	latencies [len(trackedOps)]latencyHistogram
+	reads     hotKeys
+	writes    hotKeys
+}
+
+// opTracker times requests by operation, and finds the keys read and
+// written most often, over the current and previous statsWindow.
+type opTracker struct {
+	mu       sync.Mutex // Held to move to a new window
+	current  atomic.Pointer[opWindow]
+	previous atomic.Pointer[opWindow]
+}
+
+// window returns the current window, starting a new one if it is over.
+func (t *opTracker) window() *opWindow {
+	now := time.Now()
+	if w := t.current.Load(); w != nil && now.Sub(w.start) < statsWindow {
+		return w
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	w := t.current.Load()
+	if w != nil && now.Sub(w.start) < statsWindow {
+		return w
+	}
+	if w != nil && now.Sub(w.start) < 2*statsWindow {
+		t.previous.Store(w)
+	} else {
+		t.previous.Store(nil)
+	}
+	w = &opWindow{start: now}
+	t.current.Store(w)
+	return w
+}
+
+// done counts an op that started at start and has just finished. Unknown
+// ops are not counted.
+func (t *opTracker) done(op string, start time.Time) {
+	if i, ok := opIndex[op]; ok {
+		t.window().latencies[i].observe(time.Since(start))
+	}
+}
+
+// read counts a read of key.
+func (t *opTracker) read(key string) {
+	if !store.IsReserved(key) {
+		t.window().reads.add(key)
+	}
+}
+
+// write counts a write of key.
+func (t *opTracker) write(key string) {
+	if key != "" && !store.IsReserved(key) {
+		t.window().writes.add(key)
+	}
+}
+
+// windows returns the windows /stats reports on: the current one and the
+// one before, if any.
+func (t *opTracker) windows() []*opWindow {
+	w := t.window()
+	if prev := t.previous.Load(); prev != nil {
+		return []*opWindow{w, prev}
+	}
+	return []*opWindow{w}
+}
+
+// opLatencies reports the latency percentiles of every op seen in windows,
+// ordered by op.
+func opLatencies(windows []*opWindow) []v1.OpLatency {
+	out := []v1.OpLatency{}
+	for i, op := range trackedOps {
+		var counts [latencyBuckets]uint64
+		var total uint64
+		for _, w := range windows {
+			for b := range counts {
+				n := w.latencies[i].counts[b].Load()
+				counts[b] += n
+				total += n
+			}
+		}
+		if total == 0 {
+			continue
+		}
+		out = append(out, v1.OpLatency{
+			Op:    op,
+			Count: total,
+			P50Ms: milliseconds(quantile(&counts, total, 0.50)),
+			P95Ms: milliseconds(quantile(&counts, total, 0.95)),
+			P99Ms: milliseconds(quantile(&counts, total, 0.99)),
+		})
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].Op < out[b].Op })
+	return out
+}
+
+// milliseconds converts d to fractional milliseconds.
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// topKeys merges the sketches of sketch in each window and returns its n
+// hottest keys, hottest first.
+func topKeys(windows []*opWindow, sketch func(*opWindow) *hotKeys, n int) []v1.HotKey {
+	merged := make(map[string]*v1.HotKey)
+	snapshots := make([]map[string]hotKey, len(windows))
+	floors := make([]uint64, len(windows))
+	for i, w := range windows {
+		snapshots[i], floors[i] = sketch(w).snapshot()
+		for k, c := range snapshots[i] {
+			m := merged[k]
+			if m == nil {
+				m = &v1.HotKey{Key: k}
+				merged[k] = m
+			}
+			m.Count += c.count
+			m.Error += c.error
+		}
+	}
+	// A key missing from a full sketch may still have been counted there
+	// as often as its smallest counter.
+	for k, m := range merged {
+		for i := range windows {
+			if _, ok := snapshots[i][k]; !ok {
+				m.Error += floors[i]
+			}
+		}
+	}
+	out := make([]v1.HotKey, 0, len(merged))
+	for _, m := range merged {
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(a, b int) bool {
+		if out[a].Count != out[b].Count {
+			return out[a].Count > out[b].Count
+		}
+		return out[a].Key < out[b].Key
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+// requestOp returns the op an HTTP request performs, as trackedOps names
+// it, and the key it reads or writes, if it names one. It returns "" for
+// requests that are not tracked, such as admin requests and streams, which
+// stay open by design.
+func requestOp(r *http.Request) (op, key string) {
+	p := cleanPath(r.URL.Path)
+	switch {
+	case strings.HasPrefix(p, "/kv/"):
+		// The raw path: keys may contain what cleaning would remove.
+		key = strings.TrimPrefix(unversionedPath(r.URL.Path), "/kv/")
+		switch r.Method {
+		case http.MethodGet:
+			if historyRequested(r) {
+				return "HISTORY", key
+			}
+			return "GET", key
+		case http.MethodPost:
+			switch r.URL.Query().Get("op") {
+			case updateOp:
+				return "UPDATE", key
+			case renameOp:
+				return "RENAME", key
+			case copyOp:
+				return "COPY", key
+			}
+			return "SET", key
+		case http.MethodDelete:
+			return "DELETE", key
+		}
+	case p == "/kv" && r.Method == http.MethodDelete:
+		return "DELETE_PREFIX", ""
+	case p == "/scan":
+		return "SCAN", ""
+	case p == "/aggregate":
+		return "AGGREGATE", ""
+	case p == "/keys/sample":
+		return "SAMPLE", ""
+	case p == "/query":
+		return "QUERY", ""
+	case p == "/eval":
+		return "EVAL", ""
+	case strings.HasPrefix(p, "/tx/"):
+		return "TX", ""
+	}
+	return "", ""
+}
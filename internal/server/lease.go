@@ -0,0 +1,179 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// Read consistency levels, selected with ?consistency= on GET /kv/{key}.
+const (
+	// ConsistencyStale reads from the local store of whichever node receives
+	// the request. It is the fastest, but a follower may lag the leader.
+	ConsistencyStale = "stale"
+	// ConsistencyLease reads on the leader, trusting that it is still the
+	// leader for the lease interval after it last confirmed so.
+	ConsistencyLease = "lease"
+	// ConsistencyStrong confirms leadership with a quorum on every read.
+	ConsistencyStrong = "strong"
+)
+
+// errNotLeader is returned by confirmLeader on a node that isn't the leader.
+var errNotLeader = errors.New("not the leader")
+
+// leaderLease caches the last time the leader confirmed its leadership with
+// a quorum, so reads within the lease skip the round trip. The interval must
+// be shorter than the election timeout, or a deposed leader could serve a
+// stale read before noticing it has been replaced.
+type leaderLease struct {
+	mu       sync.Mutex
+	interval time.Duration
+	until    time.Time
+	caughtUp uint64 // Term in which this node, as leader, has applied every earlier term's writes
+}
+
+// WithReadLease sets how long a leadership confirmation covers lease reads.
+// Zero makes lease reads as expensive as strong ones.
+func WithReadLease(d time.Duration) Option {
+	return func(s *Server) {
+		s.lease.interval = d
+	}
+}
+
+// valid reports whether the lease covers now.
+func (l *leaderLease) valid(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return now.Before(l.until)
+}
+
+// extend records a leadership confirmation that was requested at start. The
+// lease is measured from the request, not the response, to stay conservative.
+func (l *leaderLease) extend(start time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := start.Add(l.interval); until.After(l.until) {
+		l.until = until
+	}
+}
+
+// caughtUpIn reports whether a barrier has completed in term.
+func (l *leaderLease) caughtUpIn(term uint64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.caughtUp == term
+}
+
+// setCaughtUp records that a barrier issued in term has completed.
+func (l *leaderLease) setCaughtUp(term uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if term > l.caughtUp {
+		l.caughtUp = term
+	}
+}
+
+// catchUp makes sure this node, as leader, has applied every write
+// committed in earlier terms. A new leader only learns which those are once
+// an entry of its own term commits, and may not have applied them yet, so
+// the first consistent read of each term waits on a barrier.
+func (s *Server) catchUp() error {
+	term := s.raft.CurrentTerm()
+	if s.lease.caughtUpIn(term) {
+		return nil
+	}
+	if err := s.raft.Barrier(5 * time.Second).Error(); err != nil {
+		return err
+	}
+	s.lease.setCaughtUp(term)
+	return nil
+}
+
+// confirmLeader returns nil if this node may serve a read at the given
+// consistency level from its local store.
+func (s *Server) confirmLeader(consistency string) error {
+	if consistency == ConsistencyStale {
+		return nil
+	}
+	if s.raft.State() != raft.Leader {
+		return fmt.Errorf("%w: %s reads must be sent to the leader at: %s", errNotLeader, consistency, s.leaderAddr())
+	}
+	if err := s.catchUp(); err != nil {
+		return fmt.Errorf("failed to apply earlier terms' writes: %w", err)
+	}
+	start := time.Now()
+	if consistency == ConsistencyLease && s.lease.valid(start) {
+		return nil
+	}
+	if err := s.raft.VerifyLeader().Error(); err != nil {
+		return fmt.Errorf("failed to confirm leadership: %w", err)
+	}
+	s.lease.extend(start)
+	return nil
+}
+
+// Headers describing how fresh a read is, set on every read response.
+const (
+	// ConsistencyHeader is the consistency level the read was served at.
+	ConsistencyHeader = "X-Consistency"
+	// AppliedIndexHeader is the Raft log index the node had applied when
+	// it read; the response reflects at least the writes up to it.
+	AppliedIndexHeader = "X-Raft-Applied-Index"
+	// LeaderContactHeader is how long, in milliseconds, it had been since
+	// a follower last heard from the leader, which bounds how far behind a
+	// stale read may be when replication is keeping up. It is 0 on the
+	// leader and absent on a node that has never heard from one.
+	LeaderContactHeader = "X-Leader-Contact-Age-Ms"
+)
+
+// readable checks that this node may serve r at the consistency it asks
+// for, writing an error response if not. If it may, the freshness headers
+// are set for the read.
+func (s *Server) readable(w http.ResponseWriter, r *http.Request) bool {
+	consistency, err := readConsistency(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if err := s.confirmLeader(consistency); errors.Is(err, errNotLeader) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return false
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return false
+	}
+	h := w.Header()
+	h.Set(ConsistencyHeader, consistency)
+	h.Set(AppliedIndexHeader, strconv.FormatUint(s.raft.AppliedIndex(), 10))
+	if s.raft.State() == raft.Leader {
+		h.Set(LeaderContactHeader, "0")
+	} else if contact := s.raft.LastContact(); !contact.IsZero() {
+		h.Set(LeaderContactHeader, strconv.FormatInt(time.Since(contact).Milliseconds(), 10))
+	}
+	// Caches may keep reads but must revalidate them, cheaply by ETag where
+	// there is one, since any write can change them.
+	h.Set("Cache-Control", "no-cache")
+	return true
+}
+
+// readConsistency returns the consistency level requested by r.
+func readConsistency(r *http.Request) (string, error) {
+	return parseConsistency(r.URL.Query().Get("consistency"))
+}
+
+// parseConsistency validates a consistency level; "" means stale.
+func parseConsistency(c string) (string, error) {
+	switch c {
+	case "":
+		return ConsistencyStale, nil
+	case ConsistencyStale, ConsistencyLease, ConsistencyStrong:
+		return c, nil
+	default:
+		return "", fmt.Errorf("unknown consistency %q (want stale, lease or strong)", c)
+	}
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/audit"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+	"github.com/hashicorp/raft"
+)
+
+// errReservedKey is returned for a client read or write of a key holding
+// cluster state, such as join tokens and idempotency records.
+var errReservedKey = errors.New("keys starting with a NUL byte are reserved")
+
+// maintenance returns the cluster's maintenance state, as last replicated
+// to this node, and whether it is in maintenance mode.
+func (s *Server) maintenance() (v1.MaintenanceStatus, bool) {
+	vv, ok := s.store.Get(store.MaintenanceKey)
+	if !ok {
+		return v1.MaintenanceStatus{}, false
+	}
+	var m v1.MaintenanceStatus
+	json.Unmarshal([]byte(vv.Value), &m)
+	m.Enabled = true
+	return m, true
+}
+
+// maintenanceMessage is the error returned to writes refused during maintenance.
+func maintenanceMessage(m v1.MaintenanceStatus) string {
+	if m.Reason == "" {
+		return "Cluster is in maintenance mode"
+	}
+	return "Cluster is in maintenance mode: " + m.Reason
+}
+
+// handleMaintenance reports (GET) or changes (POST) maintenance mode. While
+// it is on, every node refuses writes with 503 but keeps serving reads. The
+// state is replicated through Raft, so all nodes agree on which writes were
+// accepted before it took effect.
+func (s *Server) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		m, _ := s.maintenance()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(m)
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.raft.State() != raft.Leader {
+		http.Error(w, "Maintenance mode must be changed on the leader at: "+s.leaderAddr(), http.StatusForbidden)
+		return
+	}
+	var req v1.MaintenanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		bodyError(w, err)
+		return
+	}
+
+	m := v1.MaintenanceStatus{}
+	cmd := Command{Op: "MAINTENANCE", RequestID: requestID(r)}
+	if req.Enabled {
+		m = v1.MaintenanceStatus{Enabled: true, Reason: req.Reason, Since: time.Now().UTC()}
+		value, err := json.Marshal(m)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		cmd.Value = string(value)
+	}
+	cmdBytes, err := json.Marshal(cmd)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, err = s.applyCommand(cmd, cmdBytes)
+	op := "MAINTENANCE_OFF"
+	if req.Enabled {
+		op = "MAINTENANCE_ON"
+	}
+	s.recordAudit(r, audit.Entry{Op: op}, err)
+	if err != nil {
+		http.Error(w, "Failed to apply command: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if req.Enabled {
+		log.Printf("[%s] ADMIN: Cluster entered maintenance mode (%s)", requestID(r), req.Reason)
+	} else {
+		log.Printf("[%s] ADMIN: Cluster left maintenance mode", requestID(r))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m)
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+)
+
+// clusterID returns the cluster's ID as last replicated to this node, or ""
+// if it has not been assigned one yet.
+func (s *Server) clusterID() string {
+	vv, _ := s.store.Get(store.ClusterIDKey)
+	return vv.Value
+}
+
+// nodeHTTPAddr returns the advertised HTTP address of the node at the Raft
+// address raftAddr, or "" if it has not recorded one.
+func (s *Server) nodeHTTPAddr(raftAddr string) string {
+	vv, _ := s.store.Get(store.NodeHTTPPrefix + raftAddr)
+	return vv.Value
+}
+
+// leaderAddr returns where clients should send what only the leader
+// serves: its advertised HTTP address, or its Raft address if it has not
+// recorded one.
+func (s *Server) leaderAddr() string {
+	leader := string(s.raft.Leader())
+	if addr := s.nodeHTTPAddr(leader); addr != "" {
+		return addr
+	}
+	return leader
+}
+
+// handleMembers reports the cluster configuration as this node knows it. Any
+// node answers, so a restarting node can find its cluster through whichever
+// peer is up.
+func (s *Server) handleMembers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	future := s.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		http.Error(w, "Failed to read the cluster configuration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	leader := string(s.raft.Leader())
+	res := v1.MembersResponse{Leader: leader, LeaderHTTPAddr: s.nodeHTTPAddr(leader), ClusterID: s.clusterID(), Members: []v1.Member{}}
+	for _, srv := range future.Configuration().Servers {
+		res.Members = append(res.Members, v1.Member{
+			NodeID:   string(srv.ID),
+			Addr:     string(srv.Address),
+			HTTPAddr: s.nodeHTTPAddr(string(srv.Address)),
+			Suffrage: srv.Suffrage.String(),
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
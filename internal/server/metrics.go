@@ -0,0 +1,194 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/transaction"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// handleStats reports runtime statistics as JSON: transaction outcomes,
+// namespace usage, and the latencies and hottest keys of recent requests,
+// as many as ?top= asks for.
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	top := defaultHotKeys
+	if v := r.URL.Query().Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid top", http.StatusBadRequest)
+			return
+		}
+		top = min(n, maxHotKeys)
+	}
+	windows := s.ops.windows()
+	tx := s.txm.Stats()
+	res := v1.StatsResponse{
+		Transactions: v1.TxStats{
+			Active:             tx.Active,
+			StagedBytes:        tx.StagedBytes,
+			CommitAttempts:     tx.CommitAttempts,
+			Commits:            tx.Commits,
+			ValidationFailures: tx.ValidationFailures,
+			Aborts:             tx.Aborts,
+			Expired:            tx.Expired,
+			MeanWriteSetSize:   tx.MeanWriteSetSize,
+		},
+		Namespaces: s.namespaceUsage(),
+		Latencies:  opLatencies(windows),
+		HotReads:   topKeys(windows, func(w *opWindow) *hotKeys { return &w.reads }, top),
+		HotWrites:  topKeys(windows, func(w *opWindow) *hotKeys { return &w.writes }, top),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// metricsHandler serves the node's metrics in the Prometheus text format.
+// Each server gets its own registry, so several can coexist in one process.
+func (s *Server) metricsHandler() http.Handler {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(txCollector{s.txm})
+	if s.dataDir != "" {
+		reg.MustRegister(diskCollector{s})
+	}
+	if len(s.tenantList) > 0 {
+		reg.MustRegister(tenantCollector{s.tenantList})
+	}
+	if s.keyMeter != nil {
+		reg.MustRegister(keyCollector{s.keyMeter})
+	}
+	if s.loader != nil {
+		reg.MustRegister(upstreamCollector{&s.upstreamLoads})
+	}
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+}
+
+var (
+	txActiveDesc = prometheus.NewDesc("heliosdb_tx_active",
+		"Transactions begun but not yet committed.", nil, nil)
+	txStagedBytesDesc = prometheus.NewDesc("heliosdb_tx_staged_bytes",
+		"Bytes of keys and values staged by transactions not yet committed.", nil, nil)
+	txCommitAttemptsDesc = prometheus.NewDesc("heliosdb_tx_commit_attempts_total",
+		"Transaction commit attempts.", nil, nil)
+	txCommitsDesc = prometheus.NewDesc("heliosdb_tx_commits_total",
+		"Transactions committed successfully.", nil, nil)
+	txValidationFailuresDesc = prometheus.NewDesc("heliosdb_tx_validation_failures_total",
+		"Commits rejected because a validated key changed concurrently.", nil, nil)
+	txAbortsDesc = prometheus.NewDesc("heliosdb_tx_aborts_total",
+		"Aborted commits, by reason.", []string{"reason"}, nil)
+	txMeanWriteSetDesc = prometheus.NewDesc("heliosdb_tx_mean_write_set_size",
+		"Mean number of writes per committed transaction.", nil, nil)
+)
+
+// txCollector exports transaction.Stats, reading them at scrape time.
+type txCollector struct {
+	txm *transaction.Manager
+}
+
+func (c txCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- txActiveDesc
+	ch <- txStagedBytesDesc
+	ch <- txCommitAttemptsDesc
+	ch <- txCommitsDesc
+	ch <- txValidationFailuresDesc
+	ch <- txAbortsDesc
+	ch <- txMeanWriteSetDesc
+}
+
+func (c txCollector) Collect(ch chan<- prometheus.Metric) {
+	st := c.txm.Stats()
+	ch <- prometheus.MustNewConstMetric(txActiveDesc, prometheus.GaugeValue, float64(st.Active))
+	ch <- prometheus.MustNewConstMetric(txStagedBytesDesc, prometheus.GaugeValue, float64(st.StagedBytes))
+	ch <- prometheus.MustNewConstMetric(txCommitAttemptsDesc, prometheus.CounterValue, float64(st.CommitAttempts))
+	ch <- prometheus.MustNewConstMetric(txCommitsDesc, prometheus.CounterValue, float64(st.Commits))
+	ch <- prometheus.MustNewConstMetric(txValidationFailuresDesc, prometheus.CounterValue, float64(st.ValidationFailures))
+	for _, reason := range []string{transaction.AbortConflict, transaction.AbortNotLeader, transaction.AbortApplyError} {
+		ch <- prometheus.MustNewConstMetric(txAbortsDesc, prometheus.CounterValue, float64(st.Aborts[reason]), reason)
+	}
+	ch <- prometheus.MustNewConstMetric(txMeanWriteSetDesc, prometheus.GaugeValue, st.MeanWriteSetSize)
+}
+
+var (
+	tenantRequestsDesc = prometheus.NewDesc("heliosdb_tenant_requests_total",
+		"Requests admitted for each tenant.", []string{"tenant"}, nil)
+	tenantThrottledDesc = prometheus.NewDesc("heliosdb_tenant_throttled_total",
+		"Requests refused for exceeding the tenant's request rate.", []string{"tenant"}, nil)
+	tenantDeniedDesc = prometheus.NewDesc("heliosdb_tenant_denied_total",
+		"Requests refused for reaching outside the tenant's namespace.", []string{"tenant"}, nil)
+)
+
+// tenantCollector exports the request counters of each tenant.
+type tenantCollector struct {
+	tenants []*tenant
+}
+
+func (c tenantCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tenantRequestsDesc
+	ch <- tenantThrottledDesc
+	ch <- tenantDeniedDesc
+}
+
+func (c tenantCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, t := range c.tenants {
+		ch <- prometheus.MustNewConstMetric(tenantRequestsDesc, prometheus.CounterValue, float64(t.requests.Load()), t.name)
+		ch <- prometheus.MustNewConstMetric(tenantThrottledDesc, prometheus.CounterValue, float64(t.throttled.Load()), t.name)
+		ch <- prometheus.MustNewConstMetric(tenantDeniedDesc, prometheus.CounterValue, float64(t.denied.Load()), t.name)
+	}
+}
+
+var upstreamLoadsDesc = prometheus.NewDesc("heliosdb_upstream_loads_total",
+	"Keys missing from the store that were read through from upstream, by result: found, missing or failed.", []string{"result"}, nil)
+
+// upstreamCollector exports the counts of keys read through from upstream.
+type upstreamCollector struct {
+	loads *upstreamLoads
+}
+
+func (c upstreamCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- upstreamLoadsDesc
+}
+
+func (c upstreamCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(upstreamLoadsDesc, prometheus.CounterValue, float64(c.loads.found.Load()), "found")
+	ch <- prometheus.MustNewConstMetric(upstreamLoadsDesc, prometheus.CounterValue, float64(c.loads.missing.Load()), "missing")
+	ch <- prometheus.MustNewConstMetric(upstreamLoadsDesc, prometheus.CounterValue, float64(c.loads.failed.Load()), "failed")
+}
+
+var (
+	keyRequestsDesc = prometheus.NewDesc("heliosdb_api_key_requests_total",
+		"Requests admitted for each API key, by key fingerprint.", []string{"key", "tenant"}, nil)
+	keyThrottledDesc = prometheus.NewDesc("heliosdb_api_key_throttled_total",
+		"Requests refused for exceeding the API key's request rate.", []string{"key", "tenant"}, nil)
+	keyReceivedBytesDesc = prometheus.NewDesc("heliosdb_api_key_received_bytes_total",
+		"Bytes of HTTP request bodies received from each API key.", []string{"key", "tenant"}, nil)
+	keySentBytesDesc = prometheus.NewDesc("heliosdb_api_key_sent_bytes_total",
+		"Bytes of HTTP response bodies sent to each API key.", []string{"key", "tenant"}, nil)
+)
+
+// keyCollector exports the usage of each metered API key.
+type keyCollector struct {
+	meter *keyMeter
+}
+
+func (c keyCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- keyRequestsDesc
+	ch <- keyThrottledDesc
+	ch <- keyReceivedBytesDesc
+	ch <- keySentBytesDesc
+}
+
+func (c keyCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, u := range c.meter.list() {
+		ch <- prometheus.MustNewConstMetric(keyRequestsDesc, prometheus.CounterValue, float64(u.requests.Load()), u.id, u.tenant)
+		ch <- prometheus.MustNewConstMetric(keyThrottledDesc, prometheus.CounterValue, float64(u.throttled.Load()), u.id, u.tenant)
+		ch <- prometheus.MustNewConstMetric(keyReceivedBytesDesc, prometheus.CounterValue, float64(u.bytesIn.Load()), u.id, u.tenant)
+		ch <- prometheus.MustNewConstMetric(keySentBytesDesc, prometheus.CounterValue, float64(u.bytesOut.Load()), u.id, u.tenant)
+	}
+}
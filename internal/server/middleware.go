@@ -0,0 +1,99 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ASHISH26940/heliosdb/internal/store"
+)
+
+// statusRecorder wraps an http.ResponseWriter to remember the status code and
+// number of bytes written, for logging after the handler returns.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, to flush
+// watch and subscription streams.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// mutating reports whether r may change state: anything but a GET, HEAD or
+// OPTIONS request. Transactions and scripts are refused as a whole, even
+// those that only read.
+func mutating(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// logSlowRequest logs a request that took longer than the configured threshold,
+// with enough context (key, size, peer state) to spot hot keys and stalls.
+func (s *Server) logSlowRequest(r *http.Request, rec *statusRecorder, elapsed time.Duration) {
+	if threshold := time.Duration(s.slowThreshold.Load()); threshold <= 0 || elapsed < threshold {
+		return
+	}
+	if path := unversionedPath(r.URL.Path); path == "/watch" || (r.Method == http.MethodGet && strings.HasPrefix(path, "/pubsub/")) {
+		// Watch and subscription streams stay open by design.
+		return
+	}
+	key := ""
+	if path := unversionedPath(r.URL.Path); strings.HasPrefix(path, "/kv/") {
+		key = strings.TrimPrefix(path, "/kv/")
+	} else if k := r.URL.Query().Get("key"); k != "" {
+		key = k
+	}
+	log.Printf("[%s] SLOW REQUEST: %s %s took %s (key=%q, status=%d, req_bytes=%d, resp_bytes=%d, raft_state=%s, leader=%s)",
+		requestID(r), r.Method, r.URL.Path, elapsed.Round(time.Microsecond), key, rec.status,
+		r.ContentLength, rec.bytes, s.raft.State(), s.raft.Leader())
+}
+
+// applyCommand submits an encoded command to Raft and waits for it to commit,
+// logging the apply if it exceeds the slow threshold. It returns the FSM's
+// response to the command.
+func (s *Server) applyCommand(cmd Command, cmdBytes []byte) (interface{}, error) {
+	start := time.Now()
+	future := s.raft.Apply(cmdBytes, 5*time.Second)
+	err := future.Error()
+	threshold := time.Duration(s.slowThreshold.Load())
+	if elapsed := time.Since(start); threshold > 0 && elapsed >= threshold {
+		log.Printf("[%s] SLOW RAFT APPLY: op=%s key=%q writes=%d size=%d took %s (raft_state=%s, err=%v)",
+			cmd.RequestID, cmd.Op, cmd.Key, len(cmd.WriteSet), len(cmdBytes), elapsed.Round(time.Microsecond), s.raft.State(), err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.ops.write(cmd.Key)
+	for _, op := range cmd.WriteSet {
+		s.ops.write(op.Key)
+	}
+	// Writes that raced with the cluster entering maintenance mode, or that
+	// would take a namespace over its quota, are refused by the FSM; report
+	// that as a failure whatever the command.
+	if err, ok := future.Response().(error); ok && (errors.Is(err, store.ErrMaintenance) || errors.Is(err, store.ErrQuotaExceeded)) {
+		return nil, err
+	}
+	return future.Response(), nil
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/audit"
+	"github.com/ASHISH26940/heliosdb/internal/migration"
+	"github.com/ASHISH26940/heliosdb/internal/transaction"
+	"github.com/google/uuid"
+	"github.com/hashicorp/raft"
+)
+
+// migrations holds the migration jobs started on this node.
+type migrations struct {
+	mu   sync.Mutex
+	jobs map[string]*migration.Job
+}
+
+func (m *migrations) add(id string, j *migration.Job) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.jobs == nil {
+		m.jobs = make(map[string]*migration.Job)
+	}
+	m.jobs[id] = j
+}
+
+func (m *migrations) get(id string) (*migration.Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	return j, ok
+}
+
+func (m *migrations) list() []v1.MigrationStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	statuses := make([]v1.MigrationStatus, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		statuses = append(statuses, j.Progress())
+	}
+	sort.Slice(statuses, func(i, k int) bool { return statuses[i].Started.Before(statuses[k].Started) })
+	return statuses
+}
+
+// handleMigrations starts a migration (POST) or lists them (GET).
+func (s *Server) handleMigrations(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v1.MigrationsResponse{Migrations: s.migrations.list()})
+	case http.MethodPost:
+		s.startMigration(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// startMigration copies the selected keys to another store in the
+// background. It runs on the leader, whose store is the most up to date and
+// which can delete copied keys through Raft.
+func (s *Server) startMigration(w http.ResponseWriter, r *http.Request) {
+	if s.raft.State() != raft.Leader {
+		http.Error(w, "Migrations must be started on the leader at: "+s.leaderAddr(), http.StatusForbidden)
+		return
+	}
+	var req v1.MigrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		bodyError(w, err)
+		return
+	}
+	if req.Target == "" {
+		http.Error(w, "Invalid request body: target is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	target, err := migration.Dial(ctx, req.Target, req.Replace)
+	s.recordAudit(r, audit.Entry{Op: "MIGRATE", Key: req.Prefix}, err)
+	if errors.Is(err, migration.ErrInvalidTarget) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to connect to the target: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	id := uuid.NewString()
+	c := httpCaller(r)
+	job := migration.Start(id, req.Target, s.store, target, func(key string, version uint64) error {
+		return s.deleteIfUnchanged(key, version, c)
+	}, migration.Options{Prefix: req.Prefix, DeleteAfterCopy: req.DeleteAfterCopy})
+	s.migrations.add(id, job)
+	log.Printf("[%s] ADMIN: Started migration %s of %d keys to %s", requestID(r), id, job.Progress().Total, migration.Redact(req.Target))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job.Progress())
+}
+
+// deleteIfUnchanged deletes key through Raft unless it has been written
+// since version, in which case it returns store.ErrVersionConflict.
+func (s *Server) deleteIfUnchanged(key string, version uint64, c caller) error {
+	cmd := Command{
+		Op:        "TX_COMMIT",
+		ReadSet:   []transaction.ReadOp{{Key: key, Version: version}},
+		WriteSet:  []transaction.WriteOp{{Key: key, Delete: true}},
+		RequestID: c.requestID,
+		Principal: s.writer(c),
+	}
+	cmdBytes, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+	resp, err := s.applyCommand(cmd, cmdBytes)
+	if err != nil {
+		return err
+	}
+	if applyErr, ok := resp.(error); ok {
+		return applyErr
+	}
+	return nil
+}
+
+// handleMigration reports on (GET) or cancels (DELETE) one migration.
+func (s *Server) handleMigration(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/admin/migrations/")
+	job, ok := s.migrations.get(id)
+	if !ok {
+		http.Error(w, "Migration not found", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodDelete:
+		job.Cancel()
+		job.Wait()
+		s.recordAudit(r, audit.Entry{Op: "CANCEL_MIGRATION"}, nil)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job.Progress())
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/hashicorp/raft"
+)
+
+// maxMessageSize bounds the size of a published message.
+const maxMessageSize = 64 << 10
+
+// handlePubSub publishes a message to a channel (POST) or subscribes to it
+// (GET). Messages are routed through the leader's in-memory broker and are
+// never written to the Raft log or the store: a subscriber receives the
+// messages published while it is connected, and nothing else. Both must be
+// sent to the leader, and subscriptions end when it loses leadership so
+// that clients reconnect to the new one.
+func (s *Server) handlePubSub(w http.ResponseWriter, r *http.Request) {
+	channel := strings.TrimPrefix(r.URL.Path, "/pubsub/")
+	prefix := r.Method == http.MethodGet && r.URL.Query().Get("prefix") == "true"
+	if channel == "" && !prefix {
+		http.Error(w, "Channel is missing", http.StatusBadRequest)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.raft.State() != raft.Leader {
+		http.Error(w, "Pub/sub requests must be sent to the leader at: "+s.leaderAddr(), http.StatusForbidden)
+		return
+	}
+	if r.Method == http.MethodPost {
+		s.handlePublish(w, r, channel)
+		return
+	}
+
+	sub := s.pubsub.Subscribe(channel, prefix)
+	defer sub.Close()
+	rc := openStream(w)
+	enc := json.NewEncoder(w)
+	ticker := time.NewTicker(streamCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case m, ok := <-sub.Messages():
+			if !ok {
+				enc.Encode(v1.PubSubMessage{Type: "CANCELED", Error: sub.Err().Error()})
+				return
+			}
+			if err := enc.Encode(v1.PubSubMessage{Type: "MESSAGE", Channel: m.Channel, Message: m.Payload, Time: m.Time}); err != nil {
+				return
+			}
+			if len(sub.Messages()) == 0 {
+				rc.Flush()
+			}
+		case <-ticker.C:
+			switch {
+			case s.drain.draining.Load():
+				enc.Encode(v1.PubSubMessage{Type: "CANCELED", Error: "node is draining"})
+				return
+			case s.raft.State() != raft.Leader:
+				enc.Encode(v1.PubSubMessage{Type: "CANCELED", Error: "node is no longer the leader"})
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// handlePublish delivers a message to the channel's current subscribers.
+func (s *Server) handlePublish(w http.ResponseWriter, r *http.Request, channel string) {
+	var req v1.PublishRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMessageSize)).Decode(&req); err != nil {
+		bodyError(w, err)
+		return
+	}
+	n := s.pubsub.Publish(channel, req.Message)
+	log.Printf("[%s] Published to channel %q, %d receivers", requestID(r), channel, n)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v1.PublishResponse{Receivers: n})
+}
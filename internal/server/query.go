@@ -0,0 +1,66 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/query"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+)
+
+// maxQueryRows bounds the rows returned by one query, whatever its LIMIT.
+const maxQueryRows = 10000
+
+// handleQuery runs a read-only SQL query, given as ?sql= or as the body
+// of a POST, against the node's local store. See package query for the
+// dialect.
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	var src string
+	switch r.Method {
+	case http.MethodGet:
+		src = r.URL.Query().Get("sql")
+	case http.MethodPost:
+		var req v1.QueryRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			bodyError(w, err)
+			return
+		}
+		src = req.SQL
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q, err := query.Parse(src)
+	if err != nil {
+		http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !s.readable(w, r) {
+		return
+	}
+
+	limit := maxQueryRows
+	if q.Limit > 0 {
+		limit = min(q.Limit, maxQueryRows)
+	}
+	res := v1.QueryResponse{Columns: q.Columns, Rows: [][]interface{}{}}
+	s.store.Iterate(func(key string, value store.VersionedValue) bool {
+		if !strings.HasPrefix(key, q.Prefix) {
+			return key < q.Prefix
+		}
+		if store.IsReserved(key) || !q.Filter.Match(key, value) {
+			return true
+		}
+		if len(res.Rows) == limit {
+			// Only a cap stricter than the query's own LIMIT truncates it.
+			res.Truncated = limit < q.Limit || q.Limit == 0
+			return false
+		}
+		res.Rows = append(res.Rows, q.Row(key, value))
+		return true
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
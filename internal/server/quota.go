@@ -0,0 +1,111 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/audit"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+	"github.com/hashicorp/raft"
+)
+
+// applyStatus is the HTTP status of a write that failed with err: 507
+// Insufficient Storage if it would take a namespace over its quota, 502 Bad
+// Gateway if the upstream it was written through to failed, and 500
+// otherwise.
+func applyStatus(err error) int {
+	if errors.Is(err, store.ErrQuotaExceeded) {
+		return http.StatusInsufficientStorage
+	}
+	if errors.Is(err, errUpstream) {
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
+
+// namespaceUsage returns the usage of every namespace with a quota, as last
+// replicated to this node, or nil if the store does not track it.
+func (s *Server) namespaceUsage() []v1.NamespaceUsage {
+	st, ok := s.store.(interface{ NamespaceUsage() []store.Usage })
+	if !ok {
+		return nil
+	}
+	var out []v1.NamespaceUsage
+	for _, u := range st.NamespaceUsage() {
+		out = append(out, v1.NamespaceUsage{
+			Namespace: u.Namespace,
+			MaxKeys:   u.MaxKeys,
+			MaxBytes:  u.MaxBytes,
+			Keys:      u.Keys,
+			Bytes:     u.Bytes,
+		})
+	}
+	return out
+}
+
+// handleQuotas lists (GET), sets (PUT) or removes (DELETE ?namespace=) the
+// quotas of namespaces: caps on the number of keys starting with a prefix
+// and on their size. Quotas are replicated through Raft and enforced by the
+// FSM, so every node refuses the same writes.
+func (s *Server) handleQuotas(w http.ResponseWriter, r *http.Request) {
+	var req v1.QuotaRequest
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v1.QuotasResponse{Namespaces: s.namespaceUsage()})
+		return
+	case http.MethodPut:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			bodyError(w, err)
+			return
+		}
+		if req.MaxKeys < 0 || req.MaxBytes < 0 {
+			http.Error(w, "max_keys and max_bytes must not be negative", http.StatusBadRequest)
+			return
+		}
+	case http.MethodDelete:
+		req.Namespace = r.URL.Query().Get("namespace")
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if req.Namespace == "" || store.IsReserved(req.Namespace) {
+		http.Error(w, "A namespace is required, and must not start with a NUL byte", http.StatusBadRequest)
+		return
+	}
+	if s.raft.State() != raft.Leader {
+		http.Error(w, "Quotas must be changed on the leader at: "+s.leaderAddr(), http.StatusForbidden)
+		return
+	}
+
+	cmd := Command{Op: "QUOTA", Key: req.Namespace, RequestID: requestID(r)}
+	if r.Method == http.MethodPut {
+		value, err := json.Marshal(store.Quota{MaxKeys: req.MaxKeys, MaxBytes: req.MaxBytes})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		cmd.Value = string(value)
+	}
+	cmdBytes, err := json.Marshal(cmd)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, err = s.applyCommand(cmd, cmdBytes)
+	s.recordAudit(r, audit.Entry{Op: "QUOTA", Key: req.Namespace}, err)
+	if err != nil {
+		http.Error(w, "Failed to apply command: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		log.Printf("[%s] ADMIN: Set quota of namespace %q to %d keys, %d bytes", requestID(r), req.Namespace, req.MaxKeys, req.MaxBytes)
+	} else {
+		log.Printf("[%s] ADMIN: Removed quota of namespace %q", requestID(r), req.Namespace)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/audit"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+	"github.com/hashicorp/raft"
+)
+
+// rangeDeleteSample is how many of the keys a prefix delete removed are
+// listed in its response.
+const rangeDeleteSample = 100
+
+// WithRangeDeleteLimit caps how many keys one prefix delete may remove; a
+// delete matching more removes none. Clients may lower the cap per request.
+// 0 is unlimited.
+func WithRangeDeleteLimit(n int) Option {
+	return func(s *Server) {
+		s.rangeDeleteLimit = n
+	}
+}
+
+// handleRangeDelete serves DELETE /kv?prefix=p, which deletes every key
+// starting with p as a single Raft command, so that all of them go at once
+// and no key written under p while the delete is in flight is missed or
+// half-handled. With dry_run=true it only reports what would be deleted.
+func (s *Server) handleRangeDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	prefix := q.Get("prefix")
+	if prefix == "" || store.IsReserved(prefix) {
+		http.Error(w, "A prefix is required, and must not start with a NUL byte", http.StatusBadRequest)
+		return
+	}
+	limit := s.rangeDeleteLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		if limit > 0 && n > limit {
+			http.Error(w, "limit must not be larger than the node's range_delete_max_keys of "+strconv.Itoa(limit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	if dryRun, _ := strconv.ParseBool(q.Get("dry_run")); dryRun {
+		s.dryRunRangeDelete(w, prefix, limit)
+		return
+	}
+
+	if s.raft.State() != raft.Leader {
+		http.Error(w, "Writes must be sent to the leader at: "+s.leaderAddr(), http.StatusForbidden)
+		return
+	}
+	c := httpCaller(r)
+	cmd := Command{Op: "DELETE_PREFIX", Key: prefix, Limit: limit, RequestID: c.requestID, Principal: s.writer(c)}
+	cmdBytes, err := json.Marshal(cmd)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp, err := s.applyCommand(cmd, cmdBytes)
+	if err == nil {
+		if applyErr, ok := resp.(error); ok {
+			err = applyErr
+		}
+	}
+	s.audited(c, audit.Entry{Op: "DELETE_PREFIX", Key: prefix}, err)
+	if errors.Is(err, store.ErrRangeTooLarge) {
+		http.Error(w, "Nothing was deleted: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to apply command: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	keys, _ := resp.([]string)
+	log.Printf("[%s] Applied 'DELETE_PREFIX' for prefix '%s' via Raft: %d keys", c.requestID, prefix, len(keys))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v1.RangeDeleteResponse{Prefix: prefix, Deleted: len(keys), Keys: keys[:min(len(keys), rangeDeleteSample)], Limit: limit})
+}
+
+// dryRunRangeDelete reports which keys a delete of prefix would remove from
+// this node's copy of the store, and whether there are more than limit.
+func (s *Server) dryRunRangeDelete(w http.ResponseWriter, prefix string, limit int) {
+	res := v1.RangeDeleteResponse{Prefix: prefix, DryRun: true, Keys: []string{}, Limit: limit}
+	s.store.Iterate(func(key string, _ store.VersionedValue) bool {
+		if key < prefix || store.IsReserved(key) {
+			return true
+		}
+		if !strings.HasPrefix(key, prefix) {
+			return false
+		}
+		res.Deleted++
+		if len(res.Keys) < rangeDeleteSample {
+			res.Keys = append(res.Keys, key)
+		}
+		return true
+	})
+	res.OverLimit = limit > 0 && res.Deleted > limit
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/audit"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+)
+
+// renameOp and copyOp are the ?op= that make a POST to /kv/{key} a rename
+// or a copy.
+const (
+	renameOp = "rename"
+	copyOp   = "copy"
+)
+
+// handleRename moves (op RENAME) or copies (op COPY) the value of key to
+// another key as a single Raft command, so that no reader ever sees a
+// rename under both keys or neither, and a copy is of one version.
+func (s *Server) handleRename(w http.ResponseWriter, r *http.Request, key, op string) {
+	var req v1.RenameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		bodyError(w, err)
+		return
+	}
+	if req.To == "" || req.To == key {
+		http.Error(w, "Invalid request body: to must name another key", http.StatusBadRequest)
+		return
+	}
+	if store.IsReserved(req.To) {
+		http.Error(w, errReservedKey.Error(), http.StatusBadRequest)
+		return
+	}
+	c := httpCaller(r)
+	if err := c.checkKey(req.To); err != nil {
+		http.Error(w, "Forbidden: "+err.Error(), http.StatusForbidden)
+		return
+	}
+
+	cmd := Command{Op: op, Key: key, Value: req.To, Overwrite: req.Overwrite, RequestID: c.requestID, Principal: s.writer(c)}
+	cmdBytes, err := json.Marshal(cmd)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp, err := s.applyCommand(cmd, cmdBytes)
+	if err == nil {
+		if applyErr, ok := resp.(error); ok {
+			err = applyErr
+		}
+	}
+	s.audited(c, audit.Entry{Op: op, Keys: []string{key, req.To}}, err)
+	switch {
+	case errors.Is(err, store.ErrKeyNotFound):
+		http.Error(w, "Key not found", http.StatusNotFound)
+		return
+	case errors.Is(err, store.ErrKeyExists):
+		http.Error(w, "Key "+req.To+" already exists; set overwrite to replace it", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Failed to apply command: "+err.Error(), applyStatus(err))
+		return
+	}
+
+	vv, _ := resp.(store.VersionedValue)
+	log.Printf("[%s] Applied '%s' of key '%s' to '%s' via Raft", c.requestID, op, key, req.To)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v1.RenameResponse{Key: req.To, Version: vv.Version})
+}
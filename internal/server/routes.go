@@ -0,0 +1,105 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+// CurrentAPIVersion is the path prefix of the newest stable API.
+const CurrentAPIVersion = "/v1"
+
+// apiVersion mounts one version of the HTTP API under its path prefix.
+// Introducing /v2 means adding a routes function here; older versions keep
+// working unchanged for existing clients.
+type apiVersion struct {
+	prefix string
+	routes func() *http.ServeMux
+}
+
+func (s *Server) registerRoutes() {
+	versions := []apiVersion{
+		{prefix: "/v1", routes: s.v1Routes},
+	}
+	for _, v := range versions {
+		s.router.Handle(v.prefix+"/", http.StripPrefix(v.prefix, v.routes()))
+	}
+
+	// Unversioned paths predate /v1. They are still served by v1 but marked deprecated.
+	s.router.Handle("/", deprecated(CurrentAPIVersion, s.v1Routes()))
+
+	// Metadata endpoints describe every version and are not themselves versioned.
+	s.router.HandleFunc("/openapi.json", s.handleOpenAPI)
+	s.router.Handle("/metrics", s.metricsHandler())
+	s.router.HandleFunc("/ready", s.handleReady)
+	if s.apiExplorer {
+		s.router.HandleFunc("/docs", s.handleDocs)
+	}
+}
+
+// v1Routes returns the handlers of the v1 API, relative to its /v1 prefix.
+func (s *Server) v1Routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/kv/", s.handleKV)
+	mux.HandleFunc("/kv", s.handleRangeDelete)
+	mux.HandleFunc("/join", s.handleJoin)
+	mux.HandleFunc("/tx/begin", s.handleTxBegin)
+	mux.HandleFunc("/tx/get", s.handleTxGet)
+	mux.HandleFunc("/tx/set", s.handleTxSet)
+	mux.HandleFunc("/tx/delete", s.handleTxDelete)
+	mux.HandleFunc("/tx/commit", s.handleTxCommit)
+	mux.HandleFunc("/tx/execute", s.handleTxExecute)
+	mux.HandleFunc("/tx/", s.handleTx)
+	mux.HandleFunc("/eval", s.handleEval)
+	mux.HandleFunc("/scan", s.handleScan)
+	mux.HandleFunc("/aggregate", s.handleAggregate)
+	mux.HandleFunc("/keys/sample", s.handleSample)
+	mux.HandleFunc("/query", s.handleQuery)
+	mux.HandleFunc("/watch", s.handleWatch)
+	mux.HandleFunc("/changes", s.handleChanges)
+	mux.HandleFunc("/pubsub/", s.handlePubSub)
+	mux.HandleFunc("/streams/", s.handleStreams)
+	mux.HandleFunc("/stats", s.handleStats)
+	mux.HandleFunc("/admin/rotate-key", s.handleRotateKey)
+	mux.HandleFunc("/admin/config", s.handleConfig)
+	mux.HandleFunc("/admin/settings", s.handleSettings)
+	mux.HandleFunc("/admin/bulk-load", s.handleBulkLoad)
+	mux.HandleFunc("/admin/import/redis", s.handleRedisImport)
+	mux.HandleFunc("/admin/migrations", s.handleMigrations)
+	mux.HandleFunc("/admin/migrations/", s.handleMigration)
+	mux.HandleFunc("/admin/maintenance", s.handleMaintenance)
+	mux.HandleFunc("/admin/quotas", s.handleQuotas)
+	mux.HandleFunc("/admin/api-keys", s.handleAPIKeys)
+	mux.HandleFunc("/admin/compact", s.handleCompact)
+	mux.HandleFunc("/admin/disk", s.handleDisk)
+	mux.HandleFunc("/admin/keyspace", s.handleKeyspace)
+	mux.HandleFunc("/admin/drain", s.handleDrain)
+	mux.HandleFunc("/admin/decommission", s.handleDecommission)
+	mux.HandleFunc("/admin/join-tokens", s.handleJoinTokens)
+	mux.HandleFunc("/admin/members", s.handleMembers)
+	mux.HandleFunc("/admin/digest", s.handleDigest)
+	mux.HandleFunc("/admin/scheduled", s.handleScheduled)
+	mux.HandleFunc("/admin/scheduled/", s.handleScheduled)
+	mux.HandleFunc("/admin/failpoints", s.handleFailpoints)
+	mux.HandleFunc("/admin/failpoints/", s.handleFailpoint)
+	return mux
+}
+
+// deprecated serves next for a legacy path while pointing clients at the
+// same resource under successor, via the Deprecation and Link headers.
+func deprecated(successor string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successor+r.URL.RequestURI()+`>; rel="successor-version"`)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// unversionedPath strips any API version prefix from path, e.g. "/v1/kv/a" -> "/kv/a".
+func unversionedPath(path string) string {
+	if strings.HasPrefix(path, "/v") {
+		if i := strings.IndexByte(path[1:], '/'); i > 0 {
+			return path[i+1:]
+		}
+	}
+	return path
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+)
+
+// Sample sizes for GET /keys/sample.
+const (
+	defaultSampleSize = 100
+	maxSampleSize     = 10000
+)
+
+// handleSample returns n keys under a prefix chosen uniformly at random,
+// with the size and version of each, so that value sizes and hot ranges
+// can be estimated without fetching the whole prefix.
+func (s *Server) handleSample(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	n := defaultSampleSize
+	if v := q.Get("n"); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil || i <= 0 {
+			http.Error(w, "Invalid n", http.StatusBadRequest)
+			return
+		}
+		n = min(i, maxSampleSize)
+	}
+	if !s.readable(w, r) {
+		return
+	}
+
+	prefix := q.Get("prefix")
+	keys, matched := sampleKeys(s.store, prefix, n)
+	res := v1.SampleResponse{Prefix: prefix, Matched: matched, Keys: make([]v1.SampleItem, 0, len(keys))}
+	for _, key := range keys {
+		// Keys deleted since they were sampled are left out.
+		if vv, ok := s.store.Get(key); ok {
+			res.Keys = append(res.Keys, v1.SampleItem{Key: key, Size: len(vv.Value), Version: vv.Version})
+		}
+	}
+	writeBody(w, r, http.StatusOK, res)
+}
+
+// sampleKeys returns up to n keys of st starting with prefix, chosen
+// uniformly at random and sorted, and how many keys start with prefix.
+// Stores that cannot sample their keys directly are walked in key order.
+func sampleKeys(st DataStore, prefix string, n int) ([]string, int) {
+	if sampler, ok := st.(interface {
+		SampleKeys(prefix string, n int) ([]string, int)
+	}); ok {
+		return sampler.SampleKeys(prefix, n)
+	}
+	var sample []string
+	matched := 0
+	st.Iterate(func(key string, _ store.VersionedValue) bool {
+		if !strings.HasPrefix(key, prefix) {
+			return key < prefix
+		}
+		if store.IsReserved(key) {
+			return true
+		}
+		matched++
+		if len(sample) < n {
+			sample = append(sample, key)
+		} else if i := rand.IntN(matched); i < n {
+			sample[i] = key
+		}
+		return true
+	})
+	sort.Strings(sample)
+	return sample, matched
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/filter"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+)
+
+// Page sizes for GET /scan.
+const (
+	defaultScanLimit = 1000
+	maxScanLimit     = 10000
+)
+
+// handleScan lists the keys under a prefix in key order, with their values,
+// keeping only those that match the filters in the query:
+//
+//	value_contains=s  the value contains s
+//	where=path=v      the JSON value's field at path equals v; may repeat
+//	version_gt=n      the key's version is greater than n
+//
+// Pages end after limit matches; pass next as start_after to continue.
+func (s *Server) handleScan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	f, err := scanFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := defaultScanLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxScanLimit)
+	}
+	if !s.readable(w, r) {
+		return
+	}
+
+	prefix, after := q.Get("prefix"), q.Get("start_after")
+	res := v1.ScanResponse{Items: []v1.ScanItem{}}
+	s.store.Iterate(func(key string, value store.VersionedValue) bool {
+		if !strings.HasPrefix(key, prefix) {
+			// Keys are in order, so none after the prefix's match it.
+			return key < prefix
+		}
+		if key <= after || store.IsReserved(key) {
+			return true
+		}
+		res.Scanned++
+		if !f.Match(key, value) {
+			return true
+		}
+		if len(res.Items) == limit {
+			res.More = true
+			return false
+		}
+		res.Items = append(res.Items, v1.ScanItem{Key: key, Value: value.Value, Version: value.Version})
+		res.Next = key
+		return true
+	})
+	if !res.More {
+		res.Next = ""
+	}
+	writeBody(w, r, http.StatusOK, res)
+}
+
+// scanFilter builds the filter described by a scan's query parameters.
+func scanFilter(q map[string][]string) (filter.Filter, error) {
+	var f filter.Filter
+	for _, s := range q["value_contains"] {
+		f = append(f, filter.ValueContains(s))
+	}
+	for _, where := range q["where"] {
+		path, want, ok := strings.Cut(where, "=")
+		if !ok || path == "" {
+			return nil, fmt.Errorf("invalid where %q (want path=value)", where)
+		}
+		f = append(f, filter.FieldEquals(path, want))
+	}
+	for _, v := range q["version_gt"] {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version_gt %q", v)
+		}
+		f = append(f, filter.VersionAbove(n))
+	}
+	return f, nil
+}
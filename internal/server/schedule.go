@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/audit"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+	"github.com/google/uuid"
+	"github.com/hashicorp/raft"
+)
+
+// scheduleSet commits a SET to be applied at req.ExecuteAt. The leader then
+// applies it like any other write, so watchers see a normal change.
+func (s *Server) scheduleSet(w http.ResponseWriter, r *http.Request, key string, req v1.SetRequest) {
+	c := httpCaller(r)
+	sw := store.ScheduledWrite{ID: uuid.NewString(), At: req.ExecuteAt.UTC(), Key: key, Value: req.Value}
+	cmd := Command{Op: "SCHEDULE", Schedule: &sw, RequestID: c.requestID, Principal: s.writer(c)}
+	cmdBytes, err := json.Marshal(cmd)
+	if err == nil {
+		_, err = s.applyCommand(cmd, cmdBytes)
+	}
+	s.audited(c, audit.Entry{Op: "SCHEDULE", Key: key}, err)
+	if err != nil {
+		http.Error(w, "Failed to apply command: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[%s] Scheduled 'SET' for key '%s' at %s as %s", requestID(r), key, sw.At, sw.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(scheduledWrite(sw))
+}
+
+// handleScheduled lists the pending scheduled writes (GET /admin/scheduled)
+// or cancels one (DELETE /admin/scheduled/{id}, on the leader).
+func (s *Server) handleScheduled(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/admin/scheduled"), "/")
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		res := v1.ScheduledWritesResponse{Writes: []v1.ScheduledWrite{}}
+		s.store.Iterate(func(key string, value store.VersionedValue) bool {
+			if strings.HasPrefix(key, store.SchedulePrefix) {
+				var sw store.ScheduledWrite
+				if err := json.Unmarshal([]byte(value.Value), &sw); err == nil {
+					res.Writes = append(res.Writes, scheduledWrite(sw))
+				}
+			}
+			return true
+		})
+		sort.SliceStable(res.Writes, func(i, j int) bool { return res.Writes[i].ExecuteAt.Before(res.Writes[j].ExecuteAt) })
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	case id != "" && r.Method == http.MethodDelete:
+		if s.raft.State() != raft.Leader {
+			http.Error(w, "Scheduled writes must be cancelled on the leader at: "+s.leaderAddr(), http.StatusForbidden)
+			return
+		}
+		cmd := Command{Op: "UNSCHEDULE", ScheduleIDs: []string{id}, RequestID: requestID(r)}
+		cmdBytes, err := json.Marshal(cmd)
+		var resp interface{}
+		if err == nil {
+			resp, err = s.applyCommand(cmd, cmdBytes)
+		}
+		s.recordAudit(r, audit.Entry{Op: "UNSCHEDULE"}, err)
+		if err != nil {
+			http.Error(w, "Failed to apply command: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// Writes already applied, or never scheduled, cannot be cancelled.
+		if n, _ := resp.(int); n == 0 {
+			http.Error(w, "Scheduled write not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("[%s] ADMIN: Cancelled scheduled write %s", requestID(r), id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// scheduledWrite converts a scheduled write to its API form.
+func scheduledWrite(sw store.ScheduledWrite) v1.ScheduledWrite {
+	return v1.ScheduledWrite{ID: sw.ID, Key: sw.Key, Value: sw.Value, ExecuteAt: sw.At}
+}
@@ -2,15 +2,31 @@
 package server
 
 import (
+	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"mime"
 	"net/http"
+	"net/netip"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/audit"
+	"github.com/ASHISH26940/heliosdb/internal/config"
+	"github.com/ASHISH26940/heliosdb/internal/filter"
+	"github.com/ASHISH26940/heliosdb/internal/pubsub"
 	"github.com/ASHISH26940/heliosdb/internal/store"
+	"github.com/ASHISH26940/heliosdb/internal/stream"
 	"github.com/ASHISH26940/heliosdb/internal/transaction"
+	"github.com/ASHISH26940/heliosdb/internal/upstream"
+	"github.com/ASHISH26940/heliosdb/internal/watch"
 	"github.com/hashicorp/raft"
 )
 
@@ -19,14 +35,28 @@ type DataStore interface {
 	Get(key string) (store.VersionedValue, bool)
 	Set(key, value string)
 	Delete(key string)
+	Iterate(fn func(key string, value store.VersionedValue) bool)
 }
 
+// DeletedVersionHeader is set on 404 responses for a deleted key to the
+// version the delete gave it, until its tombstone is purged.
+const DeletedVersionHeader = "X-Deleted-Version"
+
 // RaftNode is the interface our server needs to interact with the Raft layer.
 type RaftNode interface {
 	State() raft.RaftState
 	Leader() raft.ServerAddress
 	Apply(cmd []byte, timeout time.Duration) raft.ApplyFuture
 	AddVoter(id raft.ServerID, address raft.ServerAddress, prevIndex uint64, timeout time.Duration) raft.IndexFuture
+	VerifyLeader() raft.Future
+	LeadershipTransfer() raft.Future
+	GetConfiguration() raft.ConfigurationFuture
+	DemoteVoter(id raft.ServerID, prevIndex uint64, timeout time.Duration) raft.IndexFuture
+	RemoveServer(id raft.ServerID, prevIndex uint64, timeout time.Duration) raft.IndexFuture
+	Barrier(timeout time.Duration) raft.Future
+	CurrentTerm() uint64
+	AppliedIndex() uint64
+	LastContact() time.Time
 }
 
 // Command represents a single command that will be committed to the Raft log.
@@ -35,6 +65,38 @@ type Command struct {
 	Key      string                  `json:"key,omitempty"`
 	Value    string                  `json:"value,omitempty"`
 	WriteSet []transaction.WriteOp `json:"write_set,omitempty"`
+	ReadSet  []transaction.ReadOp  `json:"read_set,omitempty"`
+
+	IdempotencyKey string `json:"idempotency_key,omitempty"` // For TX_COMMIT: hash of the client's Idempotency-Key
+
+	RequestID string `json:"request_id,omitempty"` // Correlates the write across leader and follower logs
+	Principal string `json:"principal,omitempty"`  // Set when audit logging is enabled, so key history can show writers
+
+	Script string   `json:"script,omitempty"` // For EVAL
+	Args   []string `json:"args,omitempty"`   // For EVAL
+
+	ExpectedVersion uint64 `json:"expected_version,omitempty"` // For CAS; 0 means the key must not exist
+
+	Limit int `json:"limit,omitempty"` // For DELETE_PREFIX; 0 is unlimited
+
+	Overwrite bool `json:"overwrite,omitempty"` // For RENAME
+
+	Purge map[string]uint64 `json:"purge,omitempty"` // For JOIN_TOKEN: expired tokens to forget
+
+	Stream *stream.Op `json:"stream,omitempty"` // For STREAM
+
+	Schedule    *store.ScheduledWrite `json:"schedule,omitempty"`     // For SCHEDULE
+	ScheduleIDs []string              `json:"schedule_ids,omitempty"` // For UNSCHEDULE
+}
+
+// KeyRotator is the interface our server needs to rotate the data-encryption key.
+type KeyRotator interface {
+	Rotate() (uint32, error)
+}
+
+// Auditor is the interface our server needs to record mutating operations.
+type Auditor interface {
+	Record(e audit.Entry) error
 }
 
 // Server now holds a transaction manager.
@@ -42,16 +104,170 @@ type Server struct {
 	store  DataStore
 	raft   RaftNode
 	txm    *transaction.Manager // Transaction Manager
+	keys   KeyRotator           // Optional; nil when encryption at rest is disabled
+	audit  Auditor              // Optional; nil when audit logging is disabled
 	router *http.ServeMux
+
+	config        func() []config.Setting          // Optional; reports the effective configuration
+	tunables      func(values map[string]string) error // Optional; changes runtime tunables
+	slowThreshold atomic.Int64                         // Nanoseconds; requests and applies slower than this are logged, 0 disables
+	apiExplorer   bool                                 // Serve the Swagger UI page at /docs
+	failpoints    bool                                 // Serve /admin/failpoints for chaos tests
+	readOnly      bool                                 // Refuse every mutating request
+	joinToken     string                               // Required on membership changes when set
+	adminAllowlist []netip.Prefix                      // Clients allowed to reach admin and cluster endpoints; all if empty
+	separateAdmin bool                                 // Admin endpoints are served by AdminHandler only
+	tenants       map[[sha256.Size]byte]*tenant        // By API key hash, in multi-tenant mode
+	tenantList    []*tenant                            // In configuration order
+	keyMeter      *keyMeter                            // Usage of each API key; nil when not metered
+	maxRequestBytes int64                              // Limit on request bodies; 0 is unlimited
+	rangeDeleteLimit int                               // Most keys one prefix delete may remove; 0 is unlimited
+	idempotencyTTL time.Duration                       // How long /tx/execute remembers commits by Idempotency-Key; 0 ignores the header
+	compact       func() (v1.CompactResponse, error)   // Optional; compacts this node's on-disk state
+	dataDir       string                               // Optional; measured by /admin/disk
+	storageDirs   []string                             // Where Raft's log, the WAL or snapshots are kept apart from dataDir
+	ops           opTracker                            // Latencies and hot keys, for /stats
+	lease         leaderLease                          // Serves ?consistency=lease reads
+	migrations    migrations                           // Jobs copying keys to other stores
+	drain         drainState                           // Set by /admin/drain ahead of a restart
+	digest        func(ctx context.Context, index uint64) (v1.DigestResponse, error) // Optional; hashes the store at a log index
+	history       func(key string) []v1.KeyVersion                                  // Optional; serves /kv/{key}?history=true
+	watch         *watch.Hub                                                        // Optional; serves /watch
+	pubsub        *pubsub.Broker                                                    // Routes /pubsub messages between this node's clients
+	loader        upstream.Loader                                                   // Optional; serves misses from an upstream
+	backfill      bool                                                              // Keep what loader loads
+	upstreamLoads upstreamLoads                                                     // Keys loader was asked for
+	mirror        upstream.Mirror                                                   // Optional; sent single-key writes once they commit
+	mirrorLocks   [mirrorStripes]sync.Mutex                                         // Keep each key's writes in log order upstream
+}
+
+// Option configures optional Server dependencies.
+type Option func(*Server)
+
+// WithKeyRotator enables the key rotation admin endpoint.
+func WithKeyRotator(k KeyRotator) Option {
+	return func(s *Server) {
+		s.keys = k
+	}
+}
+
+// WithAuditor records every mutating operation to the given audit log.
+func WithAuditor(a Auditor) Option {
+	return func(s *Server) {
+		s.audit = a
+	}
+}
+
+// WithConfigInspector enables GET /admin/config, which reports the settings returned by fn.
+func WithConfigInspector(fn func() []config.Setting) Option {
+	return func(s *Server) {
+		s.config = fn
+	}
+}
+
+// WithTunables enables PUT /admin/settings, which passes the requested
+// key/value changes to fn.
+func WithTunables(fn func(values map[string]string) error) Option {
+	return func(s *Server) {
+		s.tunables = fn
+	}
+}
+
+// WithTxLimits caps the transactions in flight on the node and what they
+// can stage.
+func WithTxLimits(l transaction.Limits) Option {
+	return func(s *Server) {
+		s.txm.SetLimits(l)
+	}
+}
+
+// WithTxIsolation sets the isolation level of transactions that don't ask for one.
+func WithTxIsolation(level transaction.Isolation) Option {
+	return func(s *Server) {
+		s.txm.SetDefaultIsolation(level)
+	}
+}
+
+// WithIdempotencyTTL sets how long a transaction committed through
+// /tx/execute with an Idempotency-Key is remembered, so that retries of it
+// are not applied again. 0 ignores the header.
+func WithIdempotencyTTL(d time.Duration) Option {
+	return func(s *Server) {
+		s.idempotencyTTL = d
+	}
+}
+
+// WithSlowRequestThreshold logs any request or Raft apply slower than d.
+func WithSlowRequestThreshold(d time.Duration) Option {
+	return func(s *Server) {
+		s.SetSlowRequestThreshold(d)
+	}
+}
+
+// SetSlowRequestThreshold changes the slow request threshold at runtime.
+func (s *Server) SetSlowRequestThreshold(d time.Duration) {
+	s.slowThreshold.Store(int64(d))
+}
+
+// WithAPIExplorer serves an interactive API explorer at /docs.
+func WithAPIExplorer(enabled bool) Option {
+	return func(s *Server) {
+		s.apiExplorer = enabled
+	}
+}
+
+// WithFailpoints lets /admin/failpoints inject faults into this node. It
+// must never be enabled in production.
+func WithFailpoints(enabled bool) Option {
+	return func(s *Server) {
+		s.failpoints = enabled
+	}
+}
+
+// WithCompactor serves POST /admin/compact with fn.
+func WithCompactor(fn func() (v1.CompactResponse, error)) Option {
+	return func(s *Server) {
+		s.compact = fn
+	}
+}
+
+// WithDataDir lets /admin/disk and the metrics report the disk usage of dir.
+func WithDataDir(dir string) Option {
+	return func(s *Server) {
+		s.dataDir = dir
+	}
+}
+
+// WithStorageDirs has /admin/disk and the metrics also measure dirs, which
+// hold Raft's log, the WAL or snapshots apart from the data directory.
+func WithStorageDirs(dirs ...string) Option {
+	return func(s *Server) {
+		s.storageDirs = dirs
+	}
+}
+
+// WithReadOnly makes the node refuse every mutating request, whatever its
+// Raft role, so it can be exposed to untrusted readers. It still replicates
+// writes sent to the leader.
+func WithReadOnly(enabled bool) Option {
+	return func(s *Server) {
+		s.readOnly = enabled
+	}
 }
 
 // New is updated to initialize and accept the transaction manager.
-func New(store DataStore, r RaftNode) *Server {
+func New(store DataStore, r RaftNode, opts ...Option) *Server {
 	s := &Server{
 		store:  store,
 		raft:   r,
 		txm:    transaction.NewManager(), // Initialize the manager
+		pubsub: pubsub.NewBroker(),
 		router: http.NewServeMux(),
+
+		idempotencyTTL: DefaultIdempotencyTTL,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
 	s.registerRoutes()
 	return s
@@ -59,81 +275,406 @@ func New(store DataStore, r RaftNode) *Server {
 
 // ServeHTTP makes our Server a standard http.Handler.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	s.router.ServeHTTP(w, r)
+	if s.separateAdmin && adminPath(cleanPath(r.URL.Path)) {
+		http.NotFound(w, r)
+		return
+	}
+	s.serve(w, r)
+}
+
+// serve handles a request on any listener.
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	r = withRequestID(w, r)
+	if !s.checkAllowlist(w, r) {
+		return
+	}
+	w, r, ok := s.admitKey(w, r)
+	if !ok {
+		return
+	}
+	r, ok = s.admitTenant(w, r)
+	if !ok {
+		return
+	}
+	if !s.limitBody(w, r) {
+		return
+	}
+	if !drainExempt(r.URL.Path) {
+		s.drain.inFlight.Add(1)
+		defer s.drain.inFlight.Add(-1)
+	}
+	if s.drain.draining.Load() {
+		// Clients reconnect, and load balancers send them to another node.
+		w.Header().Set("Connection", "close")
+	}
+	// Draining changes no data, so read-only replicas can be restarted too.
+	if s.readOnly && mutating(r) && !drainExempt(r.URL.Path) {
+		http.Error(w, "This node is read-only; send writes to the leader at: "+s.leaderAddr(), http.StatusForbidden)
+		return
+	}
+	if m, ok := s.maintenance(); ok && mutating(r) && !strings.HasPrefix(unversionedPath(r.URL.Path), "/admin/") {
+		http.Error(w, maintenanceMessage(m), http.StatusServiceUnavailable)
+		return
+	}
+	op, key := requestOp(r)
+	if op == "GET" {
+		s.ops.read(key)
+	}
+	if s.slowThreshold.Load() <= 0 {
+		if op != "" {
+			defer s.ops.done(op, time.Now())
+		}
+		s.router.ServeHTTP(w, r)
+		return
+	}
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w}
+	s.router.ServeHTTP(rec, r)
+	s.ops.done(op, start)
+	s.logSlowRequest(r, rec, time.Since(start))
+}
+
+// --- ADMIN HANDLERS ---
+
+// handleRotateKey switches this node to a freshly generated data-encryption key.
+// Data sealed with older keys is re-encrypted lazily as it is rewritten. Only
+// this node's keyring changes; the key is not sent to the other nodes.
+func (s *Server) handleRotateKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.keys == nil {
+		http.Error(w, "Encryption at rest is not enabled on this node", http.StatusNotFound)
+		return
+	}
+
+	version, err := s.keys.Rotate()
+	s.recordAudit(r, audit.Entry{Op: "ROTATE_KEY"}, err)
+	if err != nil {
+		http.Error(w, "Failed to rotate key: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[%s] ADMIN: Rotated data-encryption key to version %d", requestID(r), version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v1.RotateKeyResponse{KeyVersion: version})
 }
 
-func (s *Server) registerRoutes() {
-	s.router.HandleFunc("/kv/", s.handleKV)
-	s.router.HandleFunc("/join", s.handleJoin)
-	// Add new routes for transactions
-	s.router.HandleFunc("/tx/begin", s.handleTxBegin)
-	s.router.HandleFunc("/tx/set", s.handleTxSet)
-	s.router.HandleFunc("/tx/commit", s.handleTxCommit)
+// handleConfig reports the effective configuration of this node, with the
+// origin of every value and secrets redacted.
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.config == nil {
+		http.Error(w, "Config inspection is not available", http.StatusNotFound)
+		return
+	}
+	res := v1.ConfigResponse{Settings: []v1.Setting{}}
+	for _, setting := range s.config() {
+		res.Settings = append(res.Settings, v1.Setting{Key: setting.Key, Value: setting.Value, Source: string(setting.Source)})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// handleCompact snapshots this node and compacts its WAL, reporting the
+// bytes reclaimed. Each node compacts only its own files.
+func (s *Server) handleCompact(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.compact == nil {
+		http.Error(w, "Compaction is not available", http.StatusNotFound)
+		return
+	}
+
+	start := time.Now()
+	res, err := s.compact()
+	s.recordAudit(r, audit.Entry{Op: "COMPACT"}, err)
+	if err != nil {
+		http.Error(w, "Failed to compact: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res.ReclaimedBytes = res.WALBytesBefore - res.WALBytesAfter
+	log.Printf("[%s] ADMIN: Compacted in %s, reclaiming %d bytes of WAL", requestID(r), time.Since(start).Round(time.Millisecond), res.ReclaimedBytes)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// handleSettings changes a small set of safe runtime tunables (e.g. log_level)
+// without a restart. Values may be JSON strings or numbers.
+func (s *Server) handleSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.tunables == nil {
+		http.Error(w, "Runtime tunables are not available", http.StatusNotFound)
+		return
+	}
+
+	var req map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		bodyError(w, err)
+		return
+	}
+	if len(req) == 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	values := make(map[string]string, len(req))
+	for key, raw := range req {
+		var str string
+		if err := json.Unmarshal(raw, &str); err == nil {
+			values[key] = str
+		} else {
+			values[key] = string(raw)
+		}
+	}
+
+	err := s.tunables(values)
+	s.recordAudit(r, audit.Entry{Op: "UPDATE_SETTINGS"}, err)
+	if err != nil {
+		http.Error(w, "Failed to update settings: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("[%s] ADMIN: Updated runtime settings %v", requestID(r), values)
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // --- NEW TRANSACTION HANDLERS ---
 
 func (s *Server) handleTxBegin(w http.ResponseWriter, r *http.Request) {
-	tx := s.txm.Begin()
+	var tx *transaction.Transaction
+	var err error
+	if level := r.URL.Query().Get("isolation"); level != "" {
+		iso, parseErr := transaction.ParseIsolation(level)
+		if parseErr != nil {
+			http.Error(w, parseErr.Error(), http.StatusBadRequest)
+			return
+		}
+		tx, err = s.txm.BeginWith(iso)
+	} else {
+		tx, err = s.txm.Begin()
+	}
+	if err != nil {
+		writeTxLimitError(w, err)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"tx_id": tx.ID})
+	json.NewEncoder(w).Encode(v1.TxBeginResponse{TxID: tx.ID, Isolation: string(tx.Isolation)})
+}
+
+// handleTxGet reads a key inside a transaction. Writes staged by the
+// transaction are visible to it; other reads are recorded in the read set
+// for validation at commit time.
+func (s *Server) handleTxGet(w http.ResponseWriter, r *http.Request) {
+	txID := r.URL.Query().Get("tx_id")
+	key := r.URL.Query().Get("key")
+	if store.IsReserved(key) {
+		http.Error(w, errReservedKey.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, ok := s.txm.Use(txID)
+	if !ok {
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+	defer tx.Release()
+
+	value, found := s.txRead(tx, key)
+	if !found {
+		http.Error(w, "Key not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(value + "\n"))
+}
+
+// txRead reads key as seen by tx: its own staged writes first, then the
+// store, recording the version read. A miss is recorded as version 0, so a
+// concurrent insert also fails validation.
+func (s *Server) txRead(tx *transaction.Transaction, key string) (string, bool) {
+	if op, ok := tx.Staged(key); ok {
+		return op.Value, !op.Delete
+	}
+	vv, found := s.store.Get(key)
+	tx.StageRead(key, vv.Version)
+	return vv.Value, found
+}
+
+// txWrite stages a write or delete of key in tx, recording the key's current
+// version when the isolation level validates the write set.
+func (s *Server) txWrite(tx *transaction.Transaction, key, value string, del bool) {
+	if tx.Isolation == transaction.Serializable {
+		current, _ := s.store.Get(key)
+		if del {
+			tx.StageVersionedDelete(key, current.Version)
+		} else {
+			tx.StageVersionedWrite(key, value, current.Version)
+		}
+		return
+	}
+	if del {
+		tx.StageDelete(key)
+	} else {
+		tx.StageWrite(key, value)
+	}
 }
 
+// handleTxSet stages a write of key. Without a key, it stages a batch of
+// operations from the body, like POST /tx/{id}/operations.
 func (s *Server) handleTxSet(w http.ResponseWriter, r *http.Request) {
 	txID := r.URL.Query().Get("tx_id")
 	key := r.URL.Query().Get("key")
+	if key == "" {
+		s.handleTxOperations(w, r, txID)
+		return
+	}
 
-	tx, ok := s.txm.Get(txID)
+	tx, ok := s.txm.Use(txID)
 	if !ok {
 		http.Error(w, "Transaction not found", http.StatusNotFound)
 		return
 	}
+	defer tx.Release()
 
 	var req v1.SetRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if err := decodeBody(r, &req); err != nil {
+		bodyError(w, err)
+		return
+	}
+	if err := validateTxOperation(v1.TxOperation{Op: "set", Key: key}); err != nil {
+		http.Error(w, "Invalid write: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := httpCaller(r).checkKey(key); err != nil {
+		http.Error(w, "Forbidden: "+err.Error(), http.StatusForbidden)
+		return
+	}
+	if err := s.reserveOperations(tx, []v1.TxOperation{{Op: "set", Key: key, Value: req.Value}}); err != nil {
+		writeTxLimitError(w, err)
 		return
 	}
 
-	tx.StageWrite(key, req.Value)
+	s.txWrite(tx, key, req.Value, false)
 	w.WriteHeader(http.StatusOK)
 }
 
-func (s *Server) handleTxCommit(w http.ResponseWriter, r *http.Request) {
-	if s.raft.State() != raft.Leader {
-		http.Error(w, "Commits must be sent to the leader node", http.StatusForbidden)
+// handleTxDelete stages a delete of key, applied with the rest of the
+// transaction at commit.
+func (s *Server) handleTxDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-
 	txID := r.URL.Query().Get("tx_id")
-	tx, ok := s.txm.Get(txID)
+	key := r.URL.Query().Get("key")
+
+	tx, ok := s.txm.Use(txID)
 	if !ok {
 		http.Error(w, "Transaction not found", http.StatusNotFound)
 		return
 	}
-	defer s.txm.Clear(txID)
+	defer tx.Release()
+	if err := validateTxOperation(v1.TxOperation{Op: "delete", Key: key}); err != nil {
+		http.Error(w, "Invalid delete: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.reserveOperations(tx, []v1.TxOperation{{Op: "delete", Key: key}}); err != nil {
+		writeTxLimitError(w, err)
+		return
+	}
+
+	s.txWrite(tx, key, "", true)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleTxCommit(w http.ResponseWriter, r *http.Request) {
+	s.commitTx(w, r, r.URL.Query().Get("tx_id"))
+}
+
+// commitTx validates and applies the transaction txID through Raft.
+func (s *Server) commitTx(w http.ResponseWriter, r *http.Request, txID string) {
+	writeCommitResult(w, s.commitTransaction(txID, httpCaller(r)))
+}
+
+// writeCommitResult reports the outcome of a transaction commit.
+func writeCommitResult(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errNotLeader):
+		http.Error(w, "Commits must be sent to the leader node", http.StatusForbidden)
+	case errors.Is(err, errTxNotFound):
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+	case errors.Is(err, store.ErrVersionConflict):
+		http.Error(w, "Transaction aborted: a key it depends on was modified concurrently", http.StatusConflict)
+	case errors.Is(err, store.ErrIdempotencyKeyReused):
+		http.Error(w, "Transaction refused: its Idempotency-Key was already used by a different transaction", http.StatusUnprocessableEntity)
+	case err != nil:
+		http.Error(w, "Failed to apply transaction: "+err.Error(), applyStatus(err))
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
 
-	// NOTE: A real OCC implementation would check the transaction's read-set
-	// against the store's current versions here before committing.
-	// We are simplifying this step for the example.
+// errTxNotFound is returned for an unknown or already finished transaction.
+var errTxNotFound = errors.New("transaction not found")
 
+// commitTransaction validates and applies the transaction txID through Raft,
+// on behalf of c. The transaction is finished whatever the outcome.
+func (s *Server) commitTransaction(txID string, c caller) error {
+	if s.raft.State() != raft.Leader {
+		s.txm.RecordAbort(transaction.AbortNotLeader)
+		return errNotLeader
+	}
+
+	tx, ok := s.txm.Use(txID)
+	if !ok {
+		return errTxNotFound
+	}
+	defer tx.Release()
+	defer s.txm.Clear(txID)
+	return s.applyTx(tx.WriteSet, tx.Validation(), c, nil)
+}
+
+// applyTx commits writes through Raft if every key in reads still has the
+// version recorded there. The read set is validated by the FSM, so that
+// every node reaches the same verdict at the same point in the log. With
+// idem, the FSM also remembers the commit, and does not apply it again.
+func (s *Server) applyTx(writes []transaction.WriteOp, reads []transaction.ReadOp, c caller, idem *txIdempotency) error {
 	cmd := Command{
-		Op:       "TX_COMMIT",
-		WriteSet: tx.WriteSet,
+		Op:        "TX_COMMIT",
+		WriteSet:  writes,
+		ReadSet:   reads,
+		RequestID: c.requestID,
+		Principal: s.writer(c),
+	}
+	if idem != nil {
+		cmd.IdempotencyKey, cmd.Value = idem.id, idem.record
 	}
 	cmdBytes, err := json.Marshal(cmd)
 	if err != nil {
-		http.Error(w, "Failed to marshal command", http.StatusInternalServerError)
-		return
+		return err
 	}
 
-	future := s.raft.Apply(cmdBytes, 5*time.Second)
-	if err := future.Error(); err != nil {
-		http.Error(w, "Failed to apply transaction: "+err.Error(), http.StatusInternalServerError)
-		return
+	keys := make([]string, 0, len(writes))
+	for _, op := range writes {
+		keys = append(keys, op.Key)
 	}
-
-	w.WriteHeader(http.StatusOK)
+	resp, err := s.applyCommand(cmd, cmdBytes)
+	if err == nil {
+		if applyErr, ok := resp.(error); ok {
+			err = applyErr
+		}
+	}
+	s.txm.RecordCommit(len(writes), err)
+	s.audited(c, audit.Entry{Op: "TX_COMMIT", Keys: keys}, err)
+	return err
 }
 
 // --- EXISTING HANDLERS ---
@@ -141,16 +682,16 @@ func (s *Server) handleTxCommit(w http.ResponseWriter, r *http.Request) {
 // handleJoin adds a new node to the Raft cluster.
 func (s *Server) handleJoin(w http.ResponseWriter, r *http.Request) {
 	if s.raft.State() != raft.Leader {
-		http.Error(w, "Can only join a cluster via the leader node", http.StatusForbidden)
+		http.Error(w, "Can only join a cluster via the leader node at: "+s.leaderAddr(), http.StatusForbidden)
 		return
 	}
-
-	var joinReq struct {
-		NodeID string `json:"node_id"`
-		Addr   string `json:"addr"`
+	if !s.authorizeMembership(w, r) {
+		return
 	}
+
+	var joinReq v1.JoinRequest
 	if err := json.NewDecoder(r.Body).Decode(&joinReq); err != nil {
-		http.Error(w, "Invalid join request body", http.StatusBadRequest)
+		bodyError(w, err)
 		return
 	}
 
@@ -159,17 +700,37 @@ func (s *Server) handleJoin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("LEADER: Received join request for node %s at %s", joinReq.NodeID, joinReq.Addr)
+	if id := s.clusterID(); joinReq.ClusterID != "" && id != "" && joinReq.ClusterID != id {
+		log.Printf("[%s] LEADER: Refusing node %s of cluster %s", requestID(r), joinReq.NodeID, joinReq.ClusterID)
+		http.Error(w, "Node belongs to cluster "+joinReq.ClusterID+", not "+id, http.StatusConflict)
+		return
+	}
+
+	log.Printf("[%s] LEADER: Received join request for node %s at %s", requestID(r), joinReq.NodeID, joinReq.Addr)
 
 	// Use the correct Raft command to add a new voter.
 	future := s.raft.AddVoter(raft.ServerID(joinReq.NodeID), raft.ServerAddress(joinReq.Addr), 0, 0)
-	if err := future.Error(); err != nil {
-		log.Printf("LEADER: Failed to add voter: %v", err)
+	err := future.Error()
+	s.recordAudit(r, audit.Entry{Op: "JOIN", NodeID: joinReq.NodeID}, err)
+	if err != nil {
+		log.Printf("[%s] LEADER: Failed to add voter: %v", requestID(r), err)
 		http.Error(w, "Failed to add node to cluster: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("LEADER: Successfully added node %s to the cluster", joinReq.NodeID)
+	log.Printf("[%s] LEADER: Successfully added node %s to the cluster", requestID(r), joinReq.NodeID)
+	if joinReq.HTTPAddr != "" && s.nodeHTTPAddr(joinReq.Addr) != joinReq.HTTPAddr {
+		// The node is a member either way; without its address, clients
+		// are pointed at its Raft address while it leads.
+		cmd := Command{Op: "NODE_HTTP", Key: joinReq.Addr, Value: joinReq.HTTPAddr, RequestID: requestID(r)}
+		cmdBytes, err := json.Marshal(cmd)
+		if err == nil {
+			_, err = s.applyCommand(cmd, cmdBytes)
+		}
+		if err != nil {
+			log.Printf("[%s] LEADER: Failed to record the HTTP address of node %s: %v", requestID(r), joinReq.NodeID, err)
+		}
+	}
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -180,19 +741,41 @@ func (s *Server) handleKV(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Key is missing", http.StatusBadRequest)
 		return
 	}
+	if store.IsReserved(key) {
+		http.Error(w, errReservedKey.Error(), http.StatusBadRequest)
+		return
+	}
 
 	if r.Method == http.MethodPost || r.Method == http.MethodDelete {
 		if s.raft.State() != raft.Leader {
-			leaderAddr := string(s.raft.Leader())
-			http.Error(w, "Writes must be sent to the leader at: "+leaderAddr, http.StatusForbidden)
+			http.Error(w, "Writes must be sent to the leader at: "+s.leaderAddr(), http.StatusForbidden)
 			return
 		}
 	}
 
 	switch r.Method {
 	case http.MethodGet:
+		if historyRequested(r) {
+			s.handleHistory(w, r, key)
+			return
+		}
 		s.handleGet(w, r, key)
 	case http.MethodPost:
+		switch op := r.URL.Query().Get("op"); op {
+		case "":
+		case updateOp:
+			s.handleUpdate(w, r, key)
+			return
+		case renameOp:
+			s.handleRename(w, r, key, "RENAME")
+			return
+		case copyOp:
+			s.handleRename(w, r, key, "COPY")
+			return
+		default:
+			http.Error(w, fmt.Sprintf("Unknown op %q", op), http.StatusBadRequest)
+			return
+		}
 		s.handleSet(w, r, key)
 	case http.MethodDelete:
 		s.handleDelete(w, r, key)
@@ -203,11 +786,65 @@ func (s *Server) handleKV(w http.ResponseWriter, r *http.Request) {
 
 // handleGet serves read requests.
 func (s *Server) handleGet(w http.ResponseWriter, r *http.Request, key string) {
+	if !s.readable(w, r) {
+		return
+	}
+
 	vv, ok := s.store.Get(key)
+	if !ok && s.loader != nil {
+		var err error
+		if vv, ok, err = s.readThrough(r.Context(), key, httpCaller(r)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
 	if !ok {
+		// Tell a deleted key from one that was never written, so clients
+		// resuming from a version they saw can observe the delete.
+		if ts, ok := s.store.(interface {
+			Tombstone(key string) (store.Tombstone, bool)
+		}); ok {
+			if t, ok := ts.Tombstone(key); ok {
+				w.Header().Set(DeletedVersionHeader, strconv.FormatUint(t.Version, 10))
+			}
+		}
 		http.Error(w, "Key not found", http.StatusNotFound)
 		return
 	}
+	// Polling clients revalidate with If-None-Match rather than fetch an
+	// unchanged value again. Values read through but not kept have no
+	// version to revalidate against.
+	addVary(w, "Accept")
+	if vv.Version > 0 {
+		etag := valueETag(vv)
+		w.Header().Set("ETag", etag)
+		w.Header().Set(VersionHeader, strconv.FormatUint(vv.Version, 10))
+		if notModified(r, etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	if fields := r.URL.Query().Get("fields"); fields != "" {
+		value, err := filter.Project(vv.Value, strings.Split(fields, ","))
+		if err != nil {
+			http.Error(w, "Cannot select fields: "+err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		if wantsMsgpack(r) {
+			// Re-encode the selected fields rather than wrap their JSON.
+			var fields interface{}
+			json.Unmarshal([]byte(value), &fields)
+			writeBody(w, r, http.StatusOK, fields)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(value + "\n"))
+		return
+	}
+	if wantsMsgpack(r) {
+		writeBody(w, r, http.StatusOK, vv.Value)
+		return
+	}
 	w.Header().Set("Content-Type", "text/plain")
 	w.Write([]byte(vv.Value + "\n"))
 }
@@ -215,50 +852,137 @@ func (s *Server) handleGet(w http.ResponseWriter, r *http.Request, key string) {
 // handleSet serves write requests.
 func (s *Server) handleSet(w http.ResponseWriter, r *http.Request, key string) {
 	var req v1.SetRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var err error
+	if t, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); t == MediaTypeOctetStream {
+		req.Value, err = readValue(r)
+	} else {
+		err = decodeBody(r, &req)
+	}
+	if err != nil {
+		bodyError(w, err)
 		return
 	}
 
-	cmd := Command{
-		Op:    "SET",
-		Key:   key,
-		Value: req.Value,
-	}
-	cmdBytes, err := json.Marshal(cmd)
-	if err != nil {
-		http.Error(w, "Failed to marshal command", http.StatusInternalServerError)
+	if req.ExecuteAt.After(time.Now()) {
+		s.scheduleSet(w, r, key, req)
 		return
 	}
 
-	future := s.raft.Apply(cmdBytes, 5*time.Second)
-	if err := future.Error(); err != nil {
-		http.Error(w, "Failed to apply command: "+err.Error(), http.StatusInternalServerError)
+	if err := s.applyKeyCommand(r.Context(), "SET", key, req.Value, httpCaller(r)); err != nil {
+		http.Error(w, "Failed to apply command: "+err.Error(), applyStatus(err))
 		return
 	}
 
-	log.Printf("Applied 'SET' for key '%s' via Raft", key)
+	log.Printf("[%s] Applied 'SET' for key '%s' via Raft", requestID(r), key)
 	w.WriteHeader(http.StatusCreated)
 }
 
 // handleDelete serves delete requests.
 func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request, key string) {
+	if err := s.applyKeyCommand(r.Context(), "DELETE", key, "", httpCaller(r)); err != nil {
+		http.Error(w, "Failed to apply command: "+err.Error(), applyStatus(err))
+		return
+	}
+
+	log.Printf("[%s] Applied 'DELETE' for key '%s' via Raft", requestID(r), key)
+	w.WriteHeader(http.StatusOK)
+}
+
+// applyKeyCommand commits a SET or DELETE of key through Raft on behalf of c,
+// then writes it through to the upstream if there is one.
+func (s *Server) applyKeyCommand(ctx context.Context, op, key, value string, c caller) error {
+	if unlock := s.lockMirrored(key); unlock != nil {
+		defer unlock()
+	}
 	cmd := Command{
-		Op:  "DELETE",
-		Key: key,
+		Op:        op,
+		Key:       key,
+		Value:     value,
+		RequestID: c.requestID,
+		Principal: s.writer(c),
 	}
 	cmdBytes, err := json.Marshal(cmd)
 	if err != nil {
-		http.Error(w, "Failed to marshal command", http.StatusInternalServerError)
-		return
+		return err
+	}
+	_, err = s.applyCommand(cmd, cmdBytes)
+	s.audited(c, audit.Entry{Op: op, Key: key}, err)
+	if err != nil {
+		return err
+	}
+	// The write is committed whatever the client does now, so the upstream
+	// must have it too.
+	if err := s.writeThrough(context.WithoutCancel(ctx), op, key, value); err != nil {
+		log.Printf("[%s] Committed '%s' for key '%s' but failed to write it through: %v", c.requestID, op, key, err)
+		return fmt.Errorf("committed, but not written through: %w", err)
 	}
+	return nil
+}
+
+// --- AUDIT HELPERS ---
+
+// caller identifies who made a request and where from, for the audit log.
+type caller struct {
+	principal  string
+	remoteAddr string
+	requestID  string
+	tenant     *tenant // Set in multi-tenant mode
+}
 
-	future := s.raft.Apply(cmdBytes, 5*time.Second)
-	if err := future.Error(); err != nil {
-		http.Error(w, "Failed to apply command: "+err.Error(), http.StatusInternalServerError)
+func httpCaller(r *http.Request) caller {
+	return caller{principal: principal(r), remoteAddr: r.RemoteAddr, requestID: requestID(r), tenant: requestTenant(r)}
+}
+
+// recordAudit fills in who and where for an operation and writes it to the
+// audit log, if one is configured.
+func (s *Server) recordAudit(r *http.Request, e audit.Entry, opErr error) {
+	s.audited(httpCaller(r), e, opErr)
+}
+
+// writer returns the principal to record as the writer of c's commands, so
+// key history can show who wrote each version. Writers are only recorded
+// when audit logging is enabled.
+func (s *Server) writer(c caller) string {
+	if s.audit == nil {
+		return ""
+	}
+	return c.principal
+}
+
+// audited records an operation made by c. Audit failures are logged, not
+// returned, so that a full audit disk cannot take down the write path.
+func (s *Server) audited(c caller, e audit.Entry, opErr error) {
+	if s.audit == nil {
 		return
 	}
+	e.Principal = c.principal
+	e.RemoteAddr = c.remoteAddr
+	e.RequestID = c.requestID
+	e.Success = opErr == nil
+	if opErr != nil {
+		e.Error = opErr.Error()
+	}
+	if err := s.audit.Record(e); err != nil {
+		log.Printf("[%s] AUDIT: Failed to record %s: %v", e.RequestID, e.Op, err)
+	}
+}
 
-	log.Printf("Applied 'DELETE' for key '%s' via Raft", key)
-	w.WriteHeader(http.StatusOK)
-}
\ No newline at end of file
+// principal identifies the caller of a request. API keys are truncated so
+// that the audit log never holds a usable credential.
+func principal(r *http.Request) string {
+	if user, _, ok := r.BasicAuth(); ok {
+		return "user:" + user
+	}
+	return apiKeyPrincipal(r.Header.Get("X-API-Key"))
+}
+
+// apiKeyPrincipal identifies a caller by a truncated API key.
+func apiKeyPrincipal(key string) string {
+	if key == "" {
+		return "anonymous"
+	}
+	if len(key) > 8 {
+		key = key[:8] + "..."
+	}
+	return "api-key:" + key
+}
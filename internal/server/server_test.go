@@ -2,15 +2,38 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/audit"
+	"github.com/ASHISH26940/heliosdb/internal/config"
+	"github.com/ASHISH26940/heliosdb/internal/failpoint"
+	"github.com/ASHISH26940/heliosdb/internal/script"
 	"github.com/ASHISH26940/heliosdb/internal/store"
+	"github.com/ASHISH26940/heliosdb/internal/stream"
+	"github.com/ASHISH26940/heliosdb/internal/transaction"
+	"github.com/ASHISH26940/heliosdb/internal/watch"
+	"github.com/hashicorp/go-msgpack/v2/codec"
 	"github.com/hashicorp/raft"
 )
 
@@ -49,12 +72,28 @@ func (m *mockStore) Delete(key string) {
 	delete(m.data, key)
 }
 
+// Iterate calls fn for every key in ascending order, like store.Store.
+func (m *mockStore) Iterate(fn func(key string, value store.VersionedValue) bool) {
+	m.mu.RLock()
+	keys := make([]string, 0, len(m.data))
+	for k := range m.data {
+		keys = append(keys, k)
+	}
+	m.mu.RUnlock()
+	sort.Strings(keys)
+	for _, k := range keys {
+		if vv, ok := m.Get(k); ok && !fn(k, vv) {
+			return
+		}
+	}
+}
+
 // --- Updated Mock Raft Implementation ---
 
-type mockApplyFuture struct{}
+type mockApplyFuture struct{ response interface{} }
 
 func (m *mockApplyFuture) Error() error        { return nil }
-func (m *mockApplyFuture) Response() interface{} { return nil }
+func (m *mockApplyFuture) Response() interface{} { return m.response }
 func (m *mockApplyFuture) Index() uint64       { return 0 }
 func (m *mockApplyFuture) Done() <-chan struct{} { return nil }
 
@@ -62,6 +101,20 @@ func (m *mockApplyFuture) Done() <-chan struct{} { return nil }
 type mockRaft struct {
 	isLeader bool
 	store    *mockStore // Reference to the mock store
+	lastCmd  Command    // The most recently applied command
+
+	casConflicts  int // Number of upcoming CAS commands to fail with a conflict
+	quotaErr      error // Returned by SET commands, as the FSM does when over quota
+	verifications int   // Number of VerifyLeader calls
+	transferErr   error // Returned by LeadershipTransfer
+
+	servers    []raft.Server // The cluster configuration
+	barrierErr error         // Returned by Barrier
+	barriers   int           // Number of Barrier calls
+	term       uint64        // Returned by CurrentTerm
+
+	appliedIndex uint64    // Returned by AppliedIndex
+	lastContact  time.Time // Returned by LastContact
 }
 
 // AddVoter is a mock implementation to satisfy the RaftNode interface.
@@ -85,23 +138,242 @@ func (m *mockRaft) State() raft.RaftState {
 }
 func (m *mockRaft) Leader() raft.ServerAddress { return "localhost:8080" }
 
+// VerifyLeader counts leadership checks and succeeds while isLeader is set.
+func (m *mockRaft) VerifyLeader() raft.Future {
+	m.verifications++
+	if !m.isLeader {
+		return &mockFuture{err: raft.ErrNotLeader}
+	}
+	return &mockFuture{}
+}
+
+// LeadershipTransfer hands leadership to "another node" unless transferErr is set.
+func (m *mockRaft) LeadershipTransfer() raft.Future {
+	if m.transferErr != nil {
+		return &mockFuture{err: m.transferErr}
+	}
+	m.isLeader = false
+	return &mockFuture{}
+}
+
+// GetConfiguration returns the mock's servers.
+func (m *mockRaft) GetConfiguration() raft.ConfigurationFuture {
+	return &mockConfigurationFuture{config: raft.Configuration{Servers: append([]raft.Server(nil), m.servers...)}}
+}
+
+// DemoteVoter turns the server into a non-voter.
+func (m *mockRaft) DemoteVoter(id raft.ServerID, prevIndex uint64, timeout time.Duration) raft.IndexFuture {
+	for i := range m.servers {
+		if m.servers[i].ID == id {
+			m.servers[i].Suffrage = raft.Nonvoter
+		}
+	}
+	return &mockIndexFuture{}
+}
+
+// RemoveServer drops the server from the configuration.
+func (m *mockRaft) RemoveServer(id raft.ServerID, prevIndex uint64, timeout time.Duration) raft.IndexFuture {
+	for i := range m.servers {
+		if m.servers[i].ID == id {
+			m.servers = append(m.servers[:i], m.servers[i+1:]...)
+			break
+		}
+	}
+	return &mockIndexFuture{}
+}
+
+// AppliedIndex returns appliedIndex.
+func (m *mockRaft) AppliedIndex() uint64 { return m.appliedIndex }
+
+// LastContact returns lastContact.
+func (m *mockRaft) LastContact() time.Time { return m.lastContact }
+
+// Barrier counts barriers and fails with barrierErr if it is set.
+func (m *mockRaft) Barrier(timeout time.Duration) raft.Future {
+	m.barriers++
+	return &mockFuture{err: m.barrierErr}
+}
+
+// CurrentTerm returns term.
+func (m *mockRaft) CurrentTerm() uint64 { return m.term }
+
+// mockConfigurationFuture is a mock implementation of raft.ConfigurationFuture.
+type mockConfigurationFuture struct {
+	mockIndexFuture
+	config raft.Configuration
+}
+
+func (m *mockConfigurationFuture) Configuration() raft.Configuration { return m.config }
+
+// mockFuture is a mock implementation of raft.Future.
+type mockFuture struct{ err error }
+
+func (m *mockFuture) Error() error { return m.err }
+
 // Apply now decodes the command and updates the mockStore, mimicking the FSM.
 func (m *mockRaft) Apply(cmdBytes []byte, timeout time.Duration) raft.ApplyFuture {
 	var cmd Command
 	if err := json.Unmarshal(cmdBytes, &cmd); err != nil {
 		panic("failed to unmarshal command in mock raft")
 	}
+	m.lastCmd = cmd
 
 	switch cmd.Op {
 	case "SET":
+		if m.quotaErr != nil {
+			return &mockApplyFuture{response: m.quotaErr}
+		}
 		m.store.Set(cmd.Key, cmd.Value)
 	case "DELETE":
 		m.store.Delete(cmd.Key)
+	case "RENAME":
+		vv, ok := m.store.Get(cmd.Key)
+		if !ok {
+			return &mockApplyFuture{response: store.ErrKeyNotFound}
+		}
+		if _, exists := m.store.Get(cmd.Value); exists && !cmd.Overwrite {
+			return &mockApplyFuture{response: store.ErrKeyExists}
+		}
+		m.store.Set(cmd.Value, vv.Value)
+		m.store.Delete(cmd.Key)
+		moved, _ := m.store.Get(cmd.Value)
+		return &mockApplyFuture{response: moved}
+	case "COPY":
+		vv, ok := m.store.Get(cmd.Key)
+		if !ok {
+			return &mockApplyFuture{response: store.ErrKeyNotFound}
+		}
+		if _, exists := m.store.Get(cmd.Value); exists && !cmd.Overwrite {
+			return &mockApplyFuture{response: store.ErrKeyExists}
+		}
+		m.store.Set(cmd.Value, vv.Value)
+		copied, _ := m.store.Get(cmd.Value)
+		return &mockApplyFuture{response: copied}
+	case "DELETE_PREFIX":
+		keys := []string{}
+		m.store.Iterate(func(key string, _ store.VersionedValue) bool {
+			if strings.HasPrefix(key, cmd.Key) {
+				keys = append(keys, key)
+			}
+			return true
+		})
+		if cmd.Limit > 0 && len(keys) > cmd.Limit {
+			return &mockApplyFuture{response: store.ErrRangeTooLarge}
+		}
+		for _, key := range keys {
+			m.store.Delete(key)
+		}
+		return &mockApplyFuture{response: keys}
+	case "CAS":
+		if m.casConflicts > 0 {
+			m.casConflicts--
+			return &mockApplyFuture{response: store.ErrVersionConflict}
+		}
+		if current, _ := m.store.Get(cmd.Key); current.Version != cmd.ExpectedVersion {
+			return &mockApplyFuture{response: store.ErrVersionConflict}
+		}
+		m.store.Set(cmd.Key, cmd.Value)
+	case "TX_COMMIT":
+		if vv, ok := m.store.Get(store.IdempotencyPrefix + cmd.IdempotencyKey); ok && cmd.IdempotencyKey != "" {
+			var was, now store.IdempotencyRecord
+			json.Unmarshal([]byte(vv.Value), &was)
+			json.Unmarshal([]byte(cmd.Value), &now)
+			if was.Digest != now.Digest {
+				return &mockApplyFuture{response: store.ErrIdempotencyKeyReused}
+			}
+			return &mockApplyFuture{}
+		}
+		for _, op := range cmd.ReadSet {
+			if current, _ := m.store.Get(op.Key); current.Version != op.Version {
+				return &mockApplyFuture{response: store.ErrVersionConflict}
+			}
+		}
+		for _, op := range cmd.WriteSet {
+			if op.Delete {
+				m.store.Delete(op.Key)
+			} else {
+				m.store.Set(op.Key, op.Value)
+			}
+		}
+		if cmd.IdempotencyKey != "" {
+			m.store.Set(store.IdempotencyPrefix+cmd.IdempotencyKey, cmd.Value)
+		}
+	case "BATCH":
+		for _, op := range cmd.WriteSet {
+			m.store.Set(op.Key, op.Value)
+		}
+	case "MAINTENANCE":
+		if cmd.Value == "" {
+			m.store.Delete(store.MaintenanceKey)
+		} else {
+			m.store.Set(store.MaintenanceKey, cmd.Value)
+		}
+	case "DIGEST":
+		return &mockApplyFuture{response: uint64(7)}
+	case "NODE_HTTP":
+		m.store.Set(store.NodeHTTPPrefix+cmd.Key, cmd.Value)
+	case "JOIN_TOKEN":
+		for hash := range cmd.Purge {
+			m.store.Delete(store.JoinTokenPrefix + hash)
+		}
+		m.store.Set(store.JoinTokenPrefix+cmd.Key, cmd.Value)
+	case "QUOTA":
+		if cmd.Value == "" {
+			m.store.Delete(store.QuotaPrefix + cmd.Key)
+		} else {
+			m.store.Set(store.QuotaPrefix+cmd.Key, cmd.Value)
+		}
+	case "USE_JOIN_TOKEN":
+		_, ok := m.store.Get(store.JoinTokenPrefix + cmd.Key)
+		m.store.Delete(store.JoinTokenPrefix + cmd.Key)
+		return &mockApplyFuture{response: ok}
+	case "EVAL":
+		res, err := script.Run(cmd.Script, cmd.Args, mockReader{m.store})
+		if err != nil {
+			return &mockApplyFuture{response: err}
+		}
+		for _, mu := range res.Mutations {
+			m.store.Set(mu.Key, mu.Value)
+		}
+		return &mockApplyFuture{response: res}
+	case "SCHEDULE":
+		data, _ := json.Marshal(cmd.Schedule)
+		m.store.Set(store.ScheduleKey(cmd.Schedule.ID), string(data))
+	case "UNSCHEDULE":
+		n := 0
+		for _, id := range cmd.ScheduleIDs {
+			if _, ok := m.store.Get(store.ScheduleKey(id)); ok {
+				m.store.Delete(store.ScheduleKey(id))
+				n++
+			}
+		}
+		return &mockApplyFuture{response: n}
+	case "STREAM":
+		res, ops, err := stream.Apply(*cmd.Stream, mockReader{m.store})
+		if err != nil {
+			return &mockApplyFuture{response: err}
+		}
+		for _, op := range ops {
+			if op.Delete {
+				m.store.Delete(op.Key)
+			} else {
+				m.store.Set(op.Key, op.Value)
+			}
+		}
+		return &mockApplyFuture{response: res}
 	}
 
 	return &mockApplyFuture{}
 }
 
+// mockReader exposes the mock store to scripts.
+type mockReader struct{ store *mockStore }
+
+func (m mockReader) Get(key string) (string, bool) {
+	vv, ok := m.store.Get(key)
+	return vv.Value, ok
+}
+
 // --- Updated Test Function ---
 
 func TestKVHandlers(t *testing.T) {
@@ -165,4 +437,3128 @@ func TestKVHandlers(t *testing.T) {
 	if ok {
 		t.Error("expected key 'foo' to be deleted, but it still exists")
 	}
-}
\ No newline at end of file
+}
+// mockRotator is a mock implementation of the KeyRotator interface.
+type mockRotator struct{ version uint32 }
+
+func (m *mockRotator) Rotate() (uint32, error) {
+	m.version++
+	return m.version, nil
+}
+
+func TestRotateKeyHandler(t *testing.T) {
+	store := newMockStore()
+	mockRaftNode := &mockRaft{isLeader: true, store: store}
+
+	// --- Test Case 1: Encryption disabled ---
+	srv := New(store, mockRaftNode)
+	req := httptest.NewRequest(http.MethodPost, "/admin/rotate-key", nil)
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d without a keyring, got %d", http.StatusNotFound, rr.Code)
+	}
+
+	// --- Test Case 2: Rotation succeeds ---
+	rotator := &mockRotator{version: 1}
+	srv = New(store, mockRaftNode, WithKeyRotator(rotator))
+	req = httptest.NewRequest(http.MethodPost, "/admin/rotate-key", nil)
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	var resp map[string]uint32
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if resp["key_version"] != 2 {
+		t.Errorf("expected key_version 2, got %d", resp["key_version"])
+	}
+}
+
+// mockAuditor collects audit entries in memory.
+type mockAuditor struct {
+	mu      sync.Mutex
+	entries []audit.Entry
+}
+
+func (m *mockAuditor) Record(e audit.Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = append(m.entries, e)
+	return nil
+}
+
+func TestAuditLogging(t *testing.T) {
+	store := newMockStore()
+	mockRaftNode := &mockRaft{isLeader: true, store: store}
+	auditor := &mockAuditor{}
+	srv := New(store, mockRaftNode, WithAuditor(auditor))
+
+	req := httptest.NewRequest(http.MethodPost, "/kv/foo", strings.NewReader(`{"value":"bar"}`))
+	req.SetBasicAuth("alice", "secret")
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest(http.MethodDelete, "/kv/foo", nil)
+	req.Header.Set("X-API-Key", "abcdefghijklmnop")
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+
+	// Reads must not be audited.
+	srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/kv/foo", nil))
+
+	if len(auditor.entries) != 2 {
+		t.Fatalf("expected 2 audit entries, got %d", len(auditor.entries))
+	}
+	if e := auditor.entries[0]; e.Op != "SET" || e.Key != "foo" || e.Principal != "user:alice" || !e.Success {
+		t.Errorf("unexpected SET audit entry: %+v", e)
+	}
+	if e := auditor.entries[1]; e.Op != "DELETE" || e.Principal != "api-key:abcdefgh..." {
+		t.Errorf("unexpected DELETE audit entry: %+v", e)
+	}
+}
+
+func TestSlowRequestLog(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	store := newMockStore()
+	mockRaftNode := &mockRaft{isLeader: true, store: store}
+
+	// A 1ns threshold makes every request "slow".
+	srv := New(store, mockRaftNode, WithSlowRequestThreshold(time.Nanosecond))
+	req := httptest.NewRequest(http.MethodPost, "/kv/hot", strings.NewReader(`{"value":"v"}`))
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+
+	out := buf.String()
+	if !strings.Contains(out, "SLOW REQUEST: POST /kv/hot") || !strings.Contains(out, `key="hot"`) {
+		t.Errorf("expected slow request to be logged with its key, got: %s", out)
+	}
+	if !strings.Contains(out, "SLOW RAFT APPLY: op=SET") {
+		t.Errorf("expected slow Raft apply to be logged, got: %s", out)
+	}
+
+	// With the log disabled nothing is reported.
+	buf.Reset()
+	srv = New(store, mockRaftNode)
+	srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/kv/hot", nil))
+	if strings.Contains(buf.String(), "SLOW") {
+		t.Errorf("expected no slow request log when disabled, got: %s", buf.String())
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	store := newMockStore()
+	mockRaftNode := &mockRaft{isLeader: true, store: store}
+	srv := New(store, mockRaftNode)
+
+	// --- Test Case 1: A caller-supplied ID is echoed and propagated to Raft ---
+	req := httptest.NewRequest(http.MethodPost, "/kv/foo", strings.NewReader(`{"value":"bar"}`))
+	req.Header.Set(RequestIDHeader, "req-123")
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+
+	if got := rr.Header().Get(RequestIDHeader); got != "req-123" {
+		t.Errorf("expected response request ID 'req-123', got '%s'", got)
+	}
+	if mockRaftNode.lastCmd.RequestID != "req-123" {
+		t.Errorf("expected Raft command to carry request ID 'req-123', got '%s'", mockRaftNode.lastCmd.RequestID)
+	}
+
+	// --- Test Case 2: An ID is generated when none is supplied ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/kv/foo", nil))
+	if rr.Header().Get(RequestIDHeader) == "" {
+		t.Error("expected a generated request ID in the response, but it was empty")
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	store := newMockStore()
+	mockRaftNode := &mockRaft{isLeader: true, store: store}
+
+	srv := New(store, mockRaftNode)
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	var spec struct {
+		OpenAPI string                     `json:"openapi"`
+		Paths   map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&spec); err != nil {
+		t.Fatalf("expected a valid JSON spec, got: %v", err)
+	}
+	for _, path := range []string{"/kv/{key}", "/tx/begin", "/tx/commit", "/join"} {
+		if _, ok := spec.Paths[path]; !ok {
+			t.Errorf("expected spec to document %s", path)
+		}
+	}
+
+	// The explorer is opt-in.
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected /docs to be disabled by default, got status %d", rr.Code)
+	}
+	srv = New(store, mockRaftNode, WithAPIExplorer(true))
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "/openapi.json") {
+		t.Errorf("expected /docs to serve the explorer, got status %d", rr.Code)
+	}
+}
+
+func TestVersionedRouting(t *testing.T) {
+	store := newMockStore()
+	mockRaftNode := &mockRaft{isLeader: true, store: store}
+	srv := New(store, mockRaftNode)
+
+	// --- Test Case 1: /v1 paths are served without deprecation headers ---
+	req := httptest.NewRequest(http.MethodPost, "/v1/kv/foo", strings.NewReader(`{"value":"bar"}`))
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Errorf("expected status %d, got %d", http.StatusCreated, rr.Code)
+	}
+	if rr.Header().Get("Deprecation") != "" {
+		t.Error("expected no Deprecation header on a /v1 path")
+	}
+	if val, ok := store.Get("foo"); !ok || val.Value != "bar" {
+		t.Error("expected key 'foo' to be set via /v1")
+	}
+
+	// --- Test Case 2: Legacy paths still work but are marked deprecated ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/kv/foo?x=1", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if rr.Header().Get("Deprecation") != "true" {
+		t.Error("expected a Deprecation header on a legacy path")
+	}
+	if link := rr.Header().Get("Link"); link != `</v1/kv/foo?x=1>; rel="successor-version"` {
+		t.Errorf("unexpected Link header: %s", link)
+	}
+
+	// --- Test Case 3: Unknown versions are not routed ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v9/kv/foo", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for an unknown version, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestConfigHandler(t *testing.T) {
+	store := newMockStore()
+	mockRaftNode := &mockRaft{isLeader: true, store: store}
+
+	srv := New(store, mockRaftNode)
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/admin/config", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d without an inspector, got %d", http.StatusNotFound, rr.Code)
+	}
+
+	srv = New(store, mockRaftNode, WithConfigInspector(func() []config.Setting {
+		return []config.Setting{{Key: "port", Value: 8081, Source: config.SourceEnv}}
+	}))
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/admin/config", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	var resp v1.ConfigResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Settings) != 1 || resp.Settings[0].Key != "port" || resp.Settings[0].Source != string(config.SourceEnv) {
+		t.Errorf("unexpected settings: %+v", resp.Settings)
+	}
+}
+
+func TestSettingsHandler(t *testing.T) {
+	store := newMockStore()
+	mockRaftNode := &mockRaft{isLeader: true, store: store}
+
+	var got map[string]string
+	srv := New(store, mockRaftNode, WithTunables(func(values map[string]string) error {
+		got = values
+		return nil
+	}))
+	req := httptest.NewRequest(http.MethodPut, "/v1/admin/settings", strings.NewReader(`{"log_level":"debug","snapshot_threshold":64}`))
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d", http.StatusNoContent, rr.Code)
+	}
+	if got["log_level"] != "debug" || got["snapshot_threshold"] != "64" {
+		t.Errorf("unexpected values passed to tunables: %v", got)
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "/v1/admin/settings", strings.NewReader(`not json`))
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d for a bad body, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestEvalHandler(t *testing.T) {
+	store := newMockStore()
+	store.Set("counter", "41")
+	mockRaftNode := &mockRaft{isLeader: true, store: store}
+	srv := New(store, mockRaftNode)
+
+	// --- Test Case 1: A script reads and writes atomically ---
+	body := `{"script":"n = int(get('counter')) + int(args[0])\nset('counter', str(n))\nresult = n","args":["1"]}`
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/eval", strings.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var resp v1.EvalResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if resp.Result != "42" || len(resp.Keys) != 1 || resp.Keys[0] != "counter" {
+		t.Errorf("unexpected eval response: %+v", resp)
+	}
+	if val, _ := store.Get("counter"); val.Value != "42" {
+		t.Errorf("expected counter to be 42, got %s", val.Value)
+	}
+
+	// --- Test Case 2: A failing script is reported and writes nothing ---
+	body = `{"script":"set('counter', '0')\nfail('nope')"}`
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/eval", strings.NewReader(body)))
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status %d, got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+	if val, _ := store.Get("counter"); val.Value != "42" {
+		t.Errorf("expected counter to be unchanged, got %s", val.Value)
+	}
+
+	// --- Test Case 3: Followers reject scripts ---
+	mockRaftNode.isLeader = false
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/eval", strings.NewReader(body)))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d on a follower, got %d", http.StatusForbidden, rr.Code)
+	}
+}
+
+func TestUpdateHandler(t *testing.T) {
+	kv := newMockStore()
+	kv.Set("hits", "10")
+	mockRaftNode := &mockRaft{isLeader: true, store: kv}
+	srv := New(kv, mockRaftNode)
+
+	// --- Test Case 1: Increment with a retried conflict ---
+	mockRaftNode.casConflicts = 2
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/kv/hits?op=update", strings.NewReader(`{"op":"incr","delta":5}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var resp v1.UpdateResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if resp.Value != "15" || resp.Attempts != 3 || resp.Version != 2 {
+		t.Errorf("unexpected update response: %+v", resp)
+	}
+	if val, _ := kv.Get("hits"); val.Value != "15" {
+		t.Errorf("expected hits to be 15, got %s", val.Value)
+	}
+
+	// --- Test Case 2: JSON merge patch on a missing key ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/kv/profile?op=update", strings.NewReader(`{"op":"merge","patch":{"name":"ada"}}`)))
+	if val, _ := kv.Get("profile"); rr.Code != http.StatusOK || val.Value != `{"name":"ada"}` {
+		t.Errorf("expected merge to create the key, got status %d and value %q", rr.Code, val.Value)
+	}
+
+	// --- Test Case 3: Persistent conflicts give up with 409 ---
+	mockRaftNode.casConflicts = maxUpdateAttempts
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/kv/hits?op=update", strings.NewReader(`{"op":"incr","delta":1}`)))
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected status %d, got %d", http.StatusConflict, rr.Code)
+	}
+
+	// --- Test Case 4: Mutations that don't fit the value are rejected ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/kv/profile?op=update", strings.NewReader(`{"op":"incr","delta":1}`)))
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status %d, got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+
+	// --- Test Case 5: Keys ending in /update are set like any other ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/kv/app/update", strings.NewReader(`{"value":"v"}`)))
+	if val, _ := kv.Get("app/update"); rr.Code != http.StatusCreated || val.Value != "v" {
+		t.Errorf("expected app/update to be set to v, got status %d and value %q", rr.Code, val.Value)
+	}
+
+	// --- Test Case 6: Unknown ops are rejected ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/kv/hits?op=frobnicate", strings.NewReader(`{"op":"incr","delta":1}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestTxIsolation(t *testing.T) {
+	kv := newMockStore()
+	kv.Set("balance", "100")
+	mockRaftNode := &mockRaft{isLeader: true, store: kv}
+	srv := New(kv, mockRaftNode)
+
+	begin := func(level string) string {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/tx/begin?isolation="+level, nil))
+		var resp v1.TxBeginResponse
+		json.NewDecoder(rr.Body).Decode(&resp)
+		return resp.TxID
+	}
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rr
+	}
+
+	// --- Test Case 1: OCC aborts when a read key changes ---
+	txID := begin("occ")
+	if rr := do(http.MethodGet, "/v1/tx/get?tx_id="+txID+"&key=balance", ""); strings.TrimSpace(rr.Body.String()) != "100" {
+		t.Fatalf("expected to read 100, but got %q", rr.Body.String())
+	}
+	do(http.MethodPost, "/v1/tx/set?tx_id="+txID+"&key=balance", `{"value":"90"}`)
+	kv.Set("balance", "150") // A concurrent writer
+	if rr := do(http.MethodPost, "/v1/tx/commit?tx_id="+txID, ""); rr.Code != http.StatusConflict {
+		t.Errorf("expected status %d, but got %d", http.StatusConflict, rr.Code)
+	}
+	if val, _ := kv.Get("balance"); val.Value != "150" {
+		t.Errorf("expected the aborted transaction to leave 150, but got %s", val.Value)
+	}
+
+	// --- Test Case 2: Last write wins ignores the conflict ---
+	txID = begin("last_write_wins")
+	do(http.MethodGet, "/v1/tx/get?tx_id="+txID+"&key=balance", "")
+	do(http.MethodPost, "/v1/tx/set?tx_id="+txID+"&key=balance", `{"value":"90"}`)
+	kv.Set("balance", "200")
+	if rr := do(http.MethodPost, "/v1/tx/commit?tx_id="+txID, ""); rr.Code != http.StatusOK {
+		t.Errorf("expected status %d, but got %d", http.StatusOK, rr.Code)
+	}
+
+	// --- Test Case 3: Serializable also validates blind writes ---
+	txID = begin("serializable")
+	do(http.MethodPost, "/v1/tx/set?tx_id="+txID+"&key=balance", `{"value":"1"}`)
+	kv.Set("balance", "300")
+	if rr := do(http.MethodPost, "/v1/tx/commit?tx_id="+txID, ""); rr.Code != http.StatusConflict {
+		t.Errorf("expected status %d, but got %d", http.StatusConflict, rr.Code)
+	}
+
+	// --- Test Case 4: Unknown levels are rejected ---
+	if rr := do(http.MethodPost, "/v1/tx/begin?isolation=chaos", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, but got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestTxOperations(t *testing.T) {
+	kv := newMockStore()
+	kv.Set("dir/a", "1")
+	kv.Set("obsolete", "x")
+	mockRaftNode := &mockRaft{isLeader: true, store: kv}
+	srv := New(kv, mockRaftNode)
+
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/tx/begin", nil))
+	var begin v1.TxBeginResponse
+	json.NewDecoder(rr.Body).Decode(&begin)
+
+	// --- Test Case 1: A batch of reads, writes and deletes ---
+	body := `{"operations":[
+		{"op":"get","key":"dir/a"},
+		{"op":"set","key":"dir/ü","value":"2"},
+		{"op":"get","key":"dir/ü"},
+		{"op":"delete","key":"obsolete"},
+		{"op":"get","key":"obsolete"}
+	]}`
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/tx/"+begin.TxID+"/operations", strings.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, but got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var resp v1.TxOperationsResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if len(resp.Results) != 5 {
+		t.Fatalf("expected 5 results, but got %d", len(resp.Results))
+	}
+	if r := resp.Results[0]; !r.Found || r.Value != "1" {
+		t.Errorf("expected to read dir/a=1, but got %+v", r)
+	}
+	if r := resp.Results[2]; !r.Found || r.Value != "2" {
+		t.Errorf("expected to read the staged write, but got %+v", r)
+	}
+	if r := resp.Results[4]; r.Found {
+		t.Errorf("expected the staged delete to hide the key, but got %+v", r)
+	}
+
+	// --- Test Case 2: A malformed batch is rejected whole ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/tx/"+begin.TxID+"/operations", strings.NewReader(`{"operations":[{"op":"set","key":"b","value":"3"},{"op":"rename","key":"c"}]}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, but got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	// --- Test Case 3: Commit under the same resource ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/tx/"+begin.TxID+"/commit", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, but got %d", http.StatusOK, rr.Code)
+	}
+	if val, _ := kv.Get("dir/ü"); val.Value != "2" {
+		t.Errorf("expected dir/ü to be 2, but got %q", val.Value)
+	}
+	if _, ok := kv.Get("obsolete"); ok {
+		t.Error("expected obsolete to be deleted, but it still exists")
+	}
+	if _, ok := kv.Get("b"); ok {
+		t.Error("expected the rejected batch to stage nothing, but b was written")
+	}
+
+	// --- Test Case 4: Unknown transaction ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/tx/nope/operations", strings.NewReader(`{"operations":[]}`)))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, but got %d", http.StatusNotFound, rr.Code)
+	}
+
+	// --- Test Case 5: /tx/set without a key stages a batch ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/tx/begin", nil))
+	json.NewDecoder(rr.Body).Decode(&begin)
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/tx/set?tx_id="+begin.TxID, strings.NewReader(`{"operations":[{"op":"set","key":"c","value":"4"},{"op":"delete","key":"dir/a"}]}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, but got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/tx/commit?tx_id="+begin.TxID, nil))
+	if val, _ := kv.Get("c"); rr.Code != http.StatusOK || val.Value != "4" {
+		t.Errorf("expected the batch to commit c=4, but got status %d and %q", rr.Code, val.Value)
+	}
+	if _, ok := kv.Get("dir/a"); ok {
+		t.Error("expected dir/a to be deleted, but it still exists")
+	}
+
+	// --- Test Case 6: /tx/delete stages a delete ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/tx/begin", nil))
+	json.NewDecoder(rr.Body).Decode(&begin)
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/tx/delete?tx_id="+begin.TxID+"&key=c", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, but got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/tx/delete?tx_id="+begin.TxID, nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d for a missing key, but got %d", http.StatusBadRequest, rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/tx/commit?tx_id="+begin.TxID, nil))
+	if _, ok := kv.Get("c"); rr.Code != http.StatusOK || ok {
+		t.Errorf("expected the commit to delete c, but got status %d and c present=%v", rr.Code, ok)
+	}
+}
+
+func TestTxExecute(t *testing.T) {
+	kv := newMockStore()
+	kv.Set("balance", "100")
+	kv.Set("old", "x")
+	mockRaftNode := &mockRaft{isLeader: true, store: kv}
+	srv := New(kv, mockRaftNode)
+	execute := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/tx/execute", strings.NewReader(body)))
+		return rr
+	}
+
+	// --- Test Case 1: Current reads commit the writes and deletes ---
+	rr := execute(`{"reads":[{"key":"balance","version":1},{"key":"audit","version":0}],
+		"operations":[{"op":"set","key":"balance","value":"90"},{"op":"delete","key":"old"}]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, but got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if val, _ := kv.Get("balance"); val.Value != "90" {
+		t.Errorf("expected balance to be 90, but got %q", val.Value)
+	}
+	if _, ok := kv.Get("old"); ok {
+		t.Error("expected old to be deleted, but it still exists")
+	}
+
+	// --- Test Case 2: A stale read aborts the whole payload ---
+	rr = execute(`{"reads":[{"key":"balance","version":1}],"operations":[{"op":"set","key":"balance","value":"80"}]}`)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected status %d, but got %d", http.StatusConflict, rr.Code)
+	}
+	if val, _ := kv.Get("balance"); val.Value != "90" {
+		t.Errorf("expected balance to stay 90, but got %q", val.Value)
+	}
+
+	// --- Test Case 3: Gets and malformed operations are refused ---
+	for _, body := range []string{
+		`{"operations":[{"op":"get","key":"balance"}]}`,
+		`{"operations":[{"op":"set","key":""}]}`,
+		`{"reads":[{"version":1}],"operations":[]}`,
+	} {
+		if rr := execute(body); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status %d for %s, but got %d", http.StatusBadRequest, body, rr.Code)
+		}
+	}
+
+	// --- Test Case 4: Followers refuse, so the client retries on the leader ---
+	mockRaftNode.isLeader = false
+	if rr := execute(`{"operations":[{"op":"set","key":"a","value":"1"}]}`); rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d, but got %d", http.StatusForbidden, rr.Code)
+	}
+	mockRaftNode.isLeader = true
+
+	// --- Test Case 5: A retry with the same Idempotency-Key is not applied twice ---
+	executeOnce := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/tx/execute", strings.NewReader(body))
+		req.Header.Set(IdempotencyKeyHeader, key)
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr
+	}
+	body := `{"reads":[{"key":"balance","version":2}],"operations":[{"op":"set","key":"balance","value":"70"}]}`
+	for i := 0; i < 2; i++ {
+		if rr := executeOnce("pay-42", body); rr.Code != http.StatusOK {
+			t.Errorf("expected status %d for attempt %d, but got %d: %s", http.StatusOK, i+1, rr.Code, rr.Body.String())
+		}
+	}
+	if val, _ := kv.Get("balance"); val.Value != "70" || val.Version != 3 {
+		t.Errorf("expected balance 70 at version 3, but got %q at %d", val.Value, val.Version)
+	}
+
+	// --- Test Case 6: The key may not be reused for another transaction ---
+	if rr := executeOnce("pay-42", `{"operations":[{"op":"set","key":"balance","value":"0"}]}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status %d, but got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+	if rr := executeOnce(strings.Repeat("k", 256), body); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d for an overlong key, but got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestTxLimits(t *testing.T) {
+	kv := newMockStore()
+	mockRaftNode := &mockRaft{isLeader: true, store: kv}
+	srv := New(kv, mockRaftNode, WithTxLimits(transaction.Limits{MaxActive: 1, MaxWriteSet: 2, MaxStagedBytes: 8}))
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rr
+	}
+
+	rr := do(http.MethodPost, "/v1/tx/begin", "")
+	var begin v1.TxBeginResponse
+	json.NewDecoder(rr.Body).Decode(&begin)
+
+	// --- Test Case 1: A second transaction is refused ---
+	if rr := do(http.MethodPost, "/v1/tx/begin", ""); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d, but got %d", http.StatusTooManyRequests, rr.Code)
+	}
+
+	// --- Test Case 2: A batch over the write-set cap stages nothing ---
+	rr = do(http.MethodPost, "/v1/tx/"+begin.TxID+"/operations", `{"operations":[{"op":"set","key":"a","value":"1"},{"op":"get","key":"a"},{"op":"delete","key":"b"},{"op":"delete","key":"c"}]}`)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status %d, but got %d", http.StatusRequestEntityTooLarge, rr.Code)
+	}
+
+	// --- Test Case 3: Writes over the byte cap are refused ---
+	if rr := do(http.MethodPost, "/v1/tx/set?tx_id="+begin.TxID+"&key=a", `{"value":"1234"}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, but got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if rr := do(http.MethodPost, "/v1/tx/set?tx_id="+begin.TxID+"&key=b", `{"value":"1234"}`); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d, but got %d", http.StatusTooManyRequests, rr.Code)
+	}
+
+	// --- Test Case 4: Committing frees the slot ---
+	if rr := do(http.MethodPost, "/v1/tx/commit?tx_id="+begin.TxID, ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, but got %d", http.StatusOK, rr.Code)
+	}
+	if rr = do(http.MethodPost, "/v1/tx/begin", ""); rr.Code != http.StatusOK {
+		t.Errorf("expected status %d, but got %d", http.StatusOK, rr.Code)
+	}
+	json.NewDecoder(rr.Body).Decode(&begin)
+
+	// --- Test Case 5: One-shot transactions are capped too ---
+	if rr := do(http.MethodPost, "/v1/tx/execute", `{"operations":[{"op":"delete","key":"a"},{"op":"delete","key":"b"},{"op":"delete","key":"c"}]}`); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status %d, but got %d", http.StatusRequestEntityTooLarge, rr.Code)
+	}
+
+	// --- Test Case 6: Aborting frees the slot ---
+	if rr := do(http.MethodDelete, "/v1/tx/"+begin.TxID, ""); rr.Code != http.StatusNoContent {
+		t.Errorf("expected status %d, but got %d", http.StatusNoContent, rr.Code)
+	}
+	if rr := do(http.MethodDelete, "/v1/tx/"+begin.TxID, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, but got %d", http.StatusNotFound, rr.Code)
+	}
+	if rr := do(http.MethodPost, "/v1/tx/begin", ""); rr.Code != http.StatusOK {
+		t.Errorf("expected status %d, but got %d", http.StatusOK, rr.Code)
+	}
+}
+
+func TestTxSavepoints(t *testing.T) {
+	kv := newMockStore()
+	mockRaftNode := &mockRaft{isLeader: true, store: kv}
+	srv := New(kv, mockRaftNode)
+	do := func(target, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+		return rr
+	}
+	var begin v1.TxBeginResponse
+	json.NewDecoder(do("/v1/tx/begin", "").Body).Decode(&begin)
+	tx := "/v1/tx/" + begin.TxID
+
+	// --- Test Case 1: Rolling back undoes only the writes since the savepoint ---
+	do(tx+"/operations", `{"operations":[{"op":"set","key":"order","value":"1"}]}`)
+	if rr := do(tx+"/savepoint", `{"name":"items"}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, but got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	do(tx+"/operations", `{"operations":[{"op":"set","key":"item/1","value":"x"},{"op":"delete","key":"order"}]}`)
+	if rr := do(tx+"/rollback", `{"name":"items"}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, but got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	do(tx+"/commit", "")
+	if val, _ := kv.Get("order"); val.Value != "1" {
+		t.Errorf("expected order to be 1, but got %q", val.Value)
+	}
+	if _, ok := kv.Get("item/1"); ok {
+		t.Error("expected item/1 to be rolled back, but it was written")
+	}
+
+	// --- Test Case 2: Unknown savepoints and missing names ---
+	json.NewDecoder(do("/v1/tx/begin", "").Body).Decode(&begin)
+	tx = "/v1/tx/" + begin.TxID
+	if rr := do(tx+"/rollback", `{"name":"nope"}`); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, but got %d", http.StatusNotFound, rr.Code)
+	}
+	if rr := do(tx+"/savepoint", `{}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, but got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestTxStats(t *testing.T) {
+	kv := newMockStore()
+	mockRaftNode := &mockRaft{isLeader: true, store: kv}
+	srv := New(kv, mockRaftNode)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rr
+	}
+	begin := func(level string) string {
+		var resp v1.TxBeginResponse
+		json.NewDecoder(do(http.MethodPost, "/v1/tx/begin?isolation="+level, "").Body).Decode(&resp)
+		return resp.TxID
+	}
+
+	// One successful commit of two writes, and one conflicting commit.
+	txID := begin("occ")
+	do(http.MethodPost, "/v1/tx/"+txID+"/operations", `{"operations":[{"op":"set","key":"a","value":"1"},{"op":"set","key":"b","value":"2"}]}`)
+	do(http.MethodPost, "/v1/tx/"+txID+"/commit", "")
+	txID = begin("occ")
+	do(http.MethodPost, "/v1/tx/"+txID+"/operations", `{"operations":[{"op":"get","key":"a"},{"op":"set","key":"a","value":"3"}]}`)
+	kv.Set("a", "concurrent")
+	do(http.MethodPost, "/v1/tx/"+txID+"/commit", "")
+
+	// --- Test Case 1: JSON stats ---
+	rr := do(http.MethodGet, "/v1/stats", "")
+	var stats v1.StatsResponse
+	if err := json.NewDecoder(rr.Body).Decode(&stats); err != nil {
+		t.Fatalf("failed to decode stats: %v", err)
+	}
+	tx := stats.Transactions
+	if tx.CommitAttempts != 2 || tx.Commits != 1 || tx.ValidationFailures != 1 || tx.Aborts["conflict"] != 1 {
+		t.Errorf("unexpected transaction stats: %+v", tx)
+	}
+	if tx.MeanWriteSetSize != 2 {
+		t.Errorf("expected a mean write set size of 2, but got %v", tx.MeanWriteSetSize)
+	}
+
+	// --- Test Case 2: Prometheus metrics ---
+	body := do(http.MethodGet, "/metrics", "").Body.String()
+	for _, want := range []string{
+		"heliosdb_tx_commits_total 1",
+		"heliosdb_tx_validation_failures_total 1",
+		`heliosdb_tx_aborts_total{reason="conflict"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected metrics to contain %q, but got:\n%s", want, body)
+		}
+	}
+}
+
+func TestReadConsistency(t *testing.T) {
+	kv := newMockStore()
+	kv.Set("k", "v")
+	mockRaftNode := &mockRaft{isLeader: true, store: kv, term: 1}
+	srv := New(kv, mockRaftNode, WithReadLease(time.Hour))
+
+	get := func(consistency string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/kv/k?consistency="+consistency, nil))
+		return rr
+	}
+
+	// --- Test Case 1: Stale reads never check leadership ---
+	if rr := get("stale"); rr.Code != http.StatusOK || mockRaftNode.verifications != 0 {
+		t.Errorf("expected a stale read without verification, but got status %d and %d checks", rr.Code, mockRaftNode.verifications)
+	}
+
+	// --- Test Case 2: Lease reads check once per lease ---
+	get("lease")
+	get("lease")
+	if mockRaftNode.verifications != 1 {
+		t.Errorf("expected 1 leadership check within the lease, but got %d", mockRaftNode.verifications)
+	}
+
+	// --- Test Case 3: Strong reads check every time ---
+	get("strong")
+	get("strong")
+	if mockRaftNode.verifications != 3 {
+		t.Errorf("expected 3 leadership checks, but got %d", mockRaftNode.verifications)
+	}
+	if mockRaftNode.barriers != 1 {
+		t.Errorf("expected 1 barrier in the term, but got %d", mockRaftNode.barriers)
+	}
+
+	// --- Test Case 4: A new term waits for earlier terms' writes to apply ---
+	mockRaftNode.term++
+	mockRaftNode.barrierErr = raft.ErrLeadershipLost
+	if rr := get("lease"); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, but got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+	mockRaftNode.barrierErr = nil
+	get("strong")
+	get("strong")
+	if mockRaftNode.barriers != 3 {
+		t.Errorf("expected 3 barriers, but got %d", mockRaftNode.barriers)
+	}
+
+	// --- Test Case 5: Followers refuse consistent reads ---
+	mockRaftNode.isLeader = false
+	if rr := get("lease"); rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d, but got %d", http.StatusForbidden, rr.Code)
+	}
+	if rr := get("stale"); rr.Code != http.StatusOK {
+		t.Errorf("expected status %d, but got %d", http.StatusOK, rr.Code)
+	}
+
+	// --- Test Case 6: Unknown levels are rejected ---
+	if rr := get("eventual"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, but got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestBulkLoad(t *testing.T) {
+	kv := newMockStore()
+	mockRaftNode := &mockRaft{isLeader: true, store: kv}
+	srv := New(kv, mockRaftNode)
+
+	// --- Test Case 1: A stream is chunked into batches ---
+	var body strings.Builder
+	for i := 0; i < bulkBatchRecords+10; i++ {
+		json.NewEncoder(&body).Encode(v1.BulkLoadRecord{Key: "k" + strconv.Itoa(i), Value: strconv.Itoa(i)})
+	}
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/admin/bulk-load", strings.NewReader(body.String())))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, but got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var resp v1.BulkLoadResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if resp.Records != bulkBatchRecords+10 || resp.Batches != 2 {
+		t.Errorf("expected %d records in 2 batches, but got %+v", bulkBatchRecords+10, resp)
+	}
+	if val, _ := kv.Get("k4100"); val.Value != "4100" {
+		t.Errorf("expected k4100 to be 4100, but got %q", val.Value)
+	}
+
+	// --- Test Case 2: A malformed record stops the load ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/admin/bulk-load", strings.NewReader(`{"key":"a","value":"1"}
+{"value":"2"}
+`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, but got %d", http.StatusBadRequest, rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), "record 2") {
+		t.Errorf("expected the error to name record 2, but got %q", rr.Body.String())
+	}
+
+	// --- Test Case 3: Only the leader accepts bulk loads ---
+	mockRaftNode.isLeader = false
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/admin/bulk-load", strings.NewReader(`{"key":"a","value":"1"}`)))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d, but got %d", http.StatusForbidden, rr.Code)
+	}
+
+	// --- Test Case 4: A slow upload outlives the server's read timeout ---
+	mockRaftNode.isLeader = true
+	ts := httptest.NewUnstartedServer(srv)
+	ts.Config.ReadTimeout = 50 * time.Millisecond
+	ts.Start()
+	defer ts.Close()
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte(`{"key":"slow1","value":"1"}` + "\n"))
+		time.Sleep(150 * time.Millisecond)
+		pw.Write([]byte(`{"key":"slow2","value":"2"}` + "\n"))
+		pw.Close()
+	}()
+	res, err := http.Post(ts.URL+"/v1/admin/bulk-load", "application/x-ndjson", pr)
+	if err != nil {
+		t.Fatalf("failed to send the bulk load: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(res.Body)
+		t.Fatalf("expected status %d, but got %d: %s", http.StatusOK, res.StatusCode, b)
+	}
+	if val, _ := kv.Get("slow2"); val.Value != "2" {
+		t.Errorf("expected slow2 to be 2, but got %q", val.Value)
+	}
+}
+
+func TestRedisImport(t *testing.T) {
+	kv := newMockStore()
+	mockRaftNode := &mockRaft{isLeader: true, store: kv}
+	srv := New(kv, mockRaftNode)
+
+	future := make([]byte, 8)
+	binary.LittleEndian.PutUint64(future, uint64(time.Now().Add(time.Hour).UnixMilli()))
+	var dump bytes.Buffer
+	dump.WriteString("REDIS0011")
+	dump.Write([]byte{0xFE, 0})                      // SELECTDB 0
+	dump.Write([]byte{0, 1, 'a', 1, '1'})            // a = 1
+	dump.Write([]byte{0xFC, 1, 0, 0, 0, 0, 0, 0, 0}) // Expired long ago
+	dump.Write([]byte{0, 1, 'b', 1, '2'})            // b = 2
+	dump.WriteByte(0xFC)
+	dump.Write(future)
+	dump.Write([]byte{0, 1, 'c', 1, '3'})                // c = 3, expiring in an hour
+	dump.Write([]byte{2, 1, 's', 1, 1, 'x'})             // A set
+	dump.Write([]byte{0xFE, 1, 0, 1, 'd', 1, '4', 0xFF}) // d = 4 in db 1
+	dump.Write(make([]byte, 8))
+
+	// --- Test Case 1: Strings in db 0 are imported ---
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/admin/import/redis", bytes.NewReader(dump.Bytes())))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, but got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var resp v1.RedisImportResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if resp.Records != 2 || resp.Expired != 1 || resp.TTLsDropped != 1 || resp.Skipped["set"] != 1 {
+		t.Errorf("expected 2 records, 1 expired, 1 TTL dropped and 1 set skipped, but got %+v", resp)
+	}
+	if val, _ := kv.Get("c"); val.Value != "3" {
+		t.Errorf("expected c to be 3, but got %q", val.Value)
+	}
+	if _, ok := kv.Get("b"); ok {
+		t.Error("expected the expired key b to be skipped, but it was imported")
+	}
+	if _, ok := kv.Get("d"); ok {
+		t.Error("expected the db 1 key d to be skipped, but it was imported")
+	}
+
+	// --- Test Case 2: A file that isn't a dump ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/admin/import/redis", strings.NewReader("not a dump")))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, but got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	// --- Test Case 3: A slow upload outlives the server's read timeout ---
+	ts := httptest.NewUnstartedServer(srv)
+	ts.Config.ReadTimeout = 50 * time.Millisecond
+	ts.Start()
+	defer ts.Close()
+	pr, pw := io.Pipe()
+	go func() {
+		half := dump.Len() / 2
+		pw.Write(dump.Bytes()[:half])
+		time.Sleep(150 * time.Millisecond)
+		pw.Write(dump.Bytes()[half:])
+		pw.Close()
+	}()
+	res, err := http.Post(ts.URL+"/v1/admin/import/redis", "application/octet-stream", pr)
+	if err != nil {
+		t.Fatalf("failed to send the dump: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(res.Body)
+		t.Errorf("expected status %d, but got %d: %s", http.StatusOK, res.StatusCode, b)
+	}
+}
+
+func TestMigration(t *testing.T) {
+	kv := newMockStore()
+	kv.Set("users/a", "1")
+	kv.Set("users/b", "2")
+	kv.Set("orders/x", "9")
+	srv := New(kv, &mockRaft{isLeader: true, store: kv})
+
+	targetKV := newMockStore()
+	target := httptest.NewServer(New(targetKV, &mockRaft{isLeader: true, store: targetKV}))
+	defer target.Close()
+
+	// --- Test Case 1: Move a prefix to another cluster ---
+	body := `{"target":"helios://` + strings.TrimPrefix(target.URL, "http://") + `","prefix":"users/","delete_after_copy":true}`
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/admin/migrations", strings.NewReader(body)))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, but got %d: %s", http.StatusAccepted, rr.Code, rr.Body.String())
+	}
+	var started v1.MigrationStatus
+	json.NewDecoder(rr.Body).Decode(&started)
+	job, _ := srv.migrations.get(started.ID)
+	job.Wait()
+
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/admin/migrations/"+started.ID, nil))
+	var status v1.MigrationStatus
+	json.NewDecoder(rr.Body).Decode(&status)
+	if status.State != "done" || status.Total != 2 || status.Copied != 2 || status.Deleted != 2 {
+		t.Errorf("expected 2 keys copied and deleted, but got %+v", status)
+	}
+	if val, _ := targetKV.Get("users/b"); val.Value != "2" {
+		t.Errorf("expected users/b to be copied, but got %q", val.Value)
+	}
+	if _, ok := kv.Get("users/a"); ok {
+		t.Error("expected users/a to be deleted after copying, but it still exists")
+	}
+	if _, ok := kv.Get("orders/x"); !ok {
+		t.Error("expected orders/x to be left alone, but it was deleted")
+	}
+
+	// --- Test Case 2: An unsupported target ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/admin/migrations", strings.NewReader(`{"target":"ftp://example.com"}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, but got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	// --- Test Case 3: Unknown migration ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/admin/migrations/nope", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, but got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestFailpoints(t *testing.T) {
+	kv := newMockStore()
+	defer failpoint.DisableAll()
+
+	// --- Test Case 1: Refused unless enabled ---
+	srv := New(kv, &mockRaft{isLeader: true, store: kv})
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPut, "/v1/admin/failpoints/raft/apply", strings.NewReader(`{"term":"error"}`)))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, but got %d", http.StatusNotFound, rr.Code)
+	}
+
+	// --- Test Case 2: Enable and list ---
+	srv = New(kv, &mockRaft{isLeader: true, store: kv}, WithFailpoints(true))
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPut, "/v1/admin/failpoints/wal/fsync", strings.NewReader(`{"term":"delay(10ms)"}`)))
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d, but got %d: %s", http.StatusNoContent, rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/admin/failpoints", nil))
+	var list v1.FailpointsResponse
+	json.NewDecoder(rr.Body).Decode(&list)
+	if list.Failpoints["wal/fsync"] != "delay(10ms)" {
+		t.Errorf("expected wal/fsync=delay(10ms), but got %v", list.Failpoints)
+	}
+
+	// --- Test Case 3: An invalid term ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPut, "/v1/admin/failpoints/raft/apply", strings.NewReader(`{"term":"explode"}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, but got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	// --- Test Case 4: Disable ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/v1/admin/failpoints/wal/fsync", nil))
+	if rr.Code != http.StatusNoContent || len(failpoint.List()) != 0 {
+		t.Errorf("expected the failpoint to be disabled, but got status %d and %v", rr.Code, failpoint.List())
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	kv := newMockStore()
+	kv.Set("foo", "bar")
+	srv := New(kv, &mockRaft{isLeader: true, store: kv}, WithReadOnly(true))
+
+	// --- Test Case 1: Reads are served ---
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/kv/foo", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status %d, but got %d", http.StatusOK, rr.Code)
+	}
+
+	// --- Test Case 2: Writes, transactions and admin changes are refused, even on the leader ---
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/v1/kv/foo", strings.NewReader(`{"value":"baz"}`)),
+		httptest.NewRequest(http.MethodDelete, "/kv/foo", nil),
+		httptest.NewRequest(http.MethodPost, "/v1/tx/begin", nil),
+		httptest.NewRequest(http.MethodPost, "/v1/eval", strings.NewReader(`{"script":"result = 1"}`)),
+		httptest.NewRequest(http.MethodPut, "/v1/admin/settings", strings.NewReader(`{"log_level":"debug"}`)),
+	} {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status %d for %s %s, but got %d", http.StatusForbidden, req.Method, req.URL.Path, rr.Code)
+		}
+	}
+	if val, _ := kv.Get("foo"); val.Value != "bar" {
+		t.Errorf("expected foo to be unchanged, but got %q", val.Value)
+	}
+
+	// --- Test Case 3: The gRPC API refuses writes too ---
+	gateway, err := srv.GatewayHandler(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create gateway: %v", err)
+	}
+	rr = httptest.NewRecorder()
+	gateway.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/kv/foo", strings.NewReader(`{"value":"baz"}`)))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d from the gateway, but got %d", http.StatusForbidden, rr.Code)
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	kv := newMockStore()
+	kv.Set("foo", "bar")
+	srv := New(kv, &mockRaft{isLeader: true, store: kv})
+
+	// --- Test Case 1: Entering maintenance mode ---
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/admin/maintenance", strings.NewReader(`{"enabled":true,"reason":"backup window"}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, but got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/admin/maintenance", nil))
+	var status v1.MaintenanceStatus
+	json.NewDecoder(rr.Body).Decode(&status)
+	if !status.Enabled || status.Reason != "backup window" || status.Since.IsZero() {
+		t.Errorf("expected maintenance mode for a backup window, but got %+v", status)
+	}
+
+	// --- Test Case 2: Writes are refused with the reason, reads are served ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/kv/foo", strings.NewReader(`{"value":"baz"}`)))
+	if rr.Code != http.StatusServiceUnavailable || !strings.Contains(rr.Body.String(), "backup window") {
+		t.Errorf("expected status %d naming the reason, but got %d: %s", http.StatusServiceUnavailable, rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/kv/foo", nil))
+	if rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != "bar" {
+		t.Errorf("expected to read bar, but got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// --- Test Case 3: Leaving maintenance mode ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/admin/maintenance", strings.NewReader(`{"enabled":false}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, but got %d", http.StatusOK, rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/kv/foo", strings.NewReader(`{"value":"baz"}`)))
+	if rr.Code != http.StatusCreated {
+		t.Errorf("expected status %d, but got %d", http.StatusCreated, rr.Code)
+	}
+
+	// --- Test Case 4: Clients cannot write reserved keys ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/kv/%00maintenance", strings.NewReader(`{"value":"x"}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, but got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	// --- Test Case 5: Nor stage writes to them in a transaction ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/tx/begin", nil))
+	var begin v1.TxBeginResponse
+	json.NewDecoder(rr.Body).Decode(&begin)
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/tx/set?tx_id="+begin.TxID+"&key=%00maintenance", strings.NewReader(`{"value":"x"}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, but got %d", http.StatusBadRequest, rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/tx/commit?tx_id="+begin.TxID, nil))
+	if _, ok := kv.Get(store.MaintenanceKey); ok {
+		t.Error("expected the cluster to stay out of maintenance mode, but it entered it")
+	}
+
+	// --- Test Case 6: Nor read them, directly or in a transaction ---
+	kv.Set(store.JoinTokenPrefix+"secret", "{}")
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/tx/begin", nil))
+	json.NewDecoder(rr.Body).Decode(&begin)
+	for _, path := range []string{"/v1/kv/%00join_token%00secret", "/v1/kv/%00join_token%00secret?history=true", "/v1/tx/get?tx_id=" + begin.TxID + "&key=%00join_token%00secret"} {
+		rr = httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != http.StatusBadRequest || strings.Contains(rr.Body.String(), "{}") {
+			t.Errorf("expected %s to be refused with status %d, but got %d: %s", path, http.StatusBadRequest, rr.Code, rr.Body.String())
+		}
+	}
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/tx/execute", strings.NewReader(`{"operations":[{"op":"get","key":"\u0000join_token\u0000secret"}]}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, but got %d: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+	}
+}
+
+func TestCompact(t *testing.T) {
+	kv := newMockStore()
+
+	// --- Test Case 1: Not available without a compactor ---
+	srv := New(kv, &mockRaft{isLeader: true, store: kv})
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/admin/compact", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, but got %d", http.StatusNotFound, rr.Code)
+	}
+
+	// --- Test Case 2: Reports the bytes reclaimed ---
+	srv = New(kv, &mockRaft{isLeader: true, store: kv}, WithCompactor(func() (v1.CompactResponse, error) {
+		return v1.CompactResponse{SnapshotIndex: 42, WALBytesBefore: 1000, WALBytesAfter: 300}, nil
+	}))
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/admin/compact", nil))
+	var res v1.CompactResponse
+	json.NewDecoder(rr.Body).Decode(&res)
+	if rr.Code != http.StatusOK || res.ReclaimedBytes != 700 || res.SnapshotIndex != 42 {
+		t.Errorf("expected 700 bytes reclaimed at index 42, but got %d: %+v", rr.Code, res)
+	}
+}
+
+func TestDiskUsage(t *testing.T) {
+	kv := newMockStore()
+	kv.Set("key", "value")
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "raft.db"), make([]byte, 100), 0644)
+	os.WriteFile(filepath.Join(dir, "app.wal"), make([]byte, 20), 0644)
+	os.Mkdir(filepath.Join(dir, "snapshots"), 0755)
+	os.WriteFile(filepath.Join(dir, "snapshots", "state.bin"), make([]byte, 7), 0644)
+	os.WriteFile(filepath.Join(dir, "audit.log"), make([]byte, 3), 0644)
+	os.Mkdir(filepath.Join(dir, "cold"), 0755)
+	os.WriteFile(filepath.Join(dir, "cold", "1.seg"), make([]byte, 5), 0644)
+
+	// --- Test Case 1: Not available without a data directory ---
+	srv := New(kv, &mockRaft{isLeader: true, store: kv})
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/admin/disk", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, but got %d", http.StatusNotFound, rr.Code)
+	}
+
+	// --- Test Case 2: Files are measured by kind ---
+	srv = New(kv, &mockRaft{isLeader: true, store: kv}, WithDataDir(dir))
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/admin/disk", nil))
+	var u v1.DiskUsageResponse
+	json.NewDecoder(rr.Body).Decode(&u)
+	if u.RaftLogBytes != 100 || u.WALBytes != 20 || u.SnapshotBytes != 7 || u.ColdBytes != 5 || u.OtherBytes != 3 || u.TotalBytes != 135 {
+		t.Errorf("expected 100/20/7/5/3 bytes totalling 135, but got %+v", u)
+	}
+	if u.StoreBytes != int64(len("key")+len("value")) {
+		t.Errorf("expected 8 store bytes, but got %d", u.StoreBytes)
+	}
+	if u.VolumeTotalBytes <= 0 || u.VolumeFreeBytes <= 0 {
+		t.Errorf("expected the volume's size and free space, but got %d and %d", u.VolumeTotalBytes, u.VolumeFreeBytes)
+	}
+
+	// --- Test Case 3: Exported as metrics ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(rr.Body.String(), `heliosdb_data_bytes{kind="wal"} 20`) {
+		t.Errorf("expected the WAL size in the metrics, but got:\n%s", rr.Body.String())
+	}
+
+	// --- Test Case 4: Storage directories apart from the data directory are measured too ---
+	walDir := t.TempDir()
+	os.WriteFile(filepath.Join(walDir, "app.wal"), make([]byte, 40), 0644)
+	snapDir := filepath.Join(dir, "bulk")
+	os.MkdirAll(filepath.Join(snapDir, "snapshots", "1-2"), 0755)
+	os.WriteFile(filepath.Join(snapDir, "snapshots", "1-2", "state.bin"), make([]byte, 9), 0644)
+	srv = New(kv, &mockRaft{isLeader: true, store: kv}, WithDataDir(dir), WithStorageDirs(walDir, snapDir))
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/admin/disk", nil))
+	u = v1.DiskUsageResponse{}
+	json.NewDecoder(rr.Body).Decode(&u)
+	if u.WALBytes != 60 || u.SnapshotBytes != 16 || u.TotalBytes != 184 {
+		t.Errorf("expected 60 WAL and 16 snapshot bytes totalling 184, but got %+v", u)
+	}
+	if len(u.Dirs) != 3 || u.Dirs[0].Bytes != 135 || u.Dirs[1].Path != walDir || u.Dirs[1].Bytes != 40 || u.Dirs[2].Bytes != 9 {
+		t.Errorf("expected 135, 40 and 9 bytes in the data, WAL and snapshot dirs, but got %+v", u.Dirs)
+	}
+	if u.Dirs[1].VolumeTotalBytes <= 0 {
+		t.Errorf("expected the WAL volume's size, but got %+v", u.Dirs[1])
+	}
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(rr.Body.String(), `heliosdb_storage_volume_free_bytes{dir="`+walDir+`"}`) {
+		t.Errorf("expected the WAL volume's free space in the metrics, but got:\n%s", rr.Body.String())
+	}
+}
+
+func TestDrain(t *testing.T) {
+	kv := newMockStore()
+	mr := &mockRaft{isLeader: true, store: kv}
+	srv := New(kv, mr)
+	ready := func() int {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/ready", nil))
+		return rr.Code
+	}
+
+	// --- Test Case 1: A node in service is ready ---
+	if code := ready(); code != http.StatusOK {
+		t.Errorf("expected status %d, but got %d", http.StatusOK, code)
+	}
+
+	// --- Test Case 2: Draining the leader hands off leadership and fails readiness ---
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/admin/drain", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, but got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var res v1.DrainResponse
+	json.NewDecoder(rr.Body).Decode(&res)
+	if !res.Draining || !res.TransferredLeadership || !res.Drained {
+		t.Errorf("expected a drained node that transferred leadership, but got %+v", res)
+	}
+	if mr.isLeader {
+		t.Error("expected leadership to be transferred, but the node still leads")
+	}
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, but got %d", http.StatusServiceUnavailable, code)
+	}
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/kv/foo", nil))
+	if got := rr.Header().Get("Connection"); got != "close" {
+		t.Errorf("expected connections to be closed while draining, but got %q", got)
+	}
+
+	// --- Test Case 3: Requests still in flight are reported after the timeout ---
+	srv.drain.inFlight.Add(1)
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/admin/drain?timeout=20ms", nil))
+	res = v1.DrainResponse{}
+	json.NewDecoder(rr.Body).Decode(&res)
+	if res.Drained || res.InFlight != 1 {
+		t.Errorf("expected 1 request in flight, but got %+v", res)
+	}
+	srv.drain.inFlight.Add(-1)
+
+	// --- Test Case 4: Returning to service ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/v1/admin/drain", nil))
+	if code := ready(); code != http.StatusOK {
+		t.Errorf("expected status %d, but got %d", http.StatusOK, code)
+	}
+
+	// --- Test Case 5: A leader that cannot hand off leadership stays in service ---
+	srv = New(kv, &mockRaft{isLeader: true, store: kv, transferErr: raft.ErrNotLeader})
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/admin/drain", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, but got %d", http.StatusInternalServerError, rr.Code)
+	}
+	if code := ready(); code != http.StatusOK {
+		t.Errorf("expected status %d, but got %d", http.StatusOK, code)
+	}
+}
+
+func TestDecommission(t *testing.T) {
+	kv := newMockStore()
+	mr := &mockRaft{isLeader: true, store: kv, servers: []raft.Server{
+		{ID: "node1", Address: "localhost:8080", Suffrage: raft.Voter},
+		{ID: "node2", Address: "localhost:9082", Suffrage: raft.Voter},
+		{ID: "node3", Address: "localhost:9083", Suffrage: raft.Voter},
+	}}
+	srv := New(kv, mr)
+	decommission := func(body string) (*httptest.ResponseRecorder, v1.DecommissionResponse) {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/admin/decommission", strings.NewReader(body)))
+		var res v1.DecommissionResponse
+		json.NewDecoder(bytes.NewReader(rr.Body.Bytes())).Decode(&res)
+		return rr, res
+	}
+
+	// --- Test Case 1: A follower is demoted, then removed ---
+	rr, res := decommission(`{"node_id":"node3"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, but got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if !res.Demoted || !res.PeersCaughtUp || !res.Removed {
+		t.Errorf("expected every step to complete, but got %+v", res)
+	}
+	if len(mr.servers) != 2 {
+		t.Errorf("expected 2 servers left, but got %d", len(mr.servers))
+	}
+
+	// --- Test Case 2: Unknown nodes and the leader itself are refused ---
+	if rr, _ := decommission(`{"node_id":"node3"}`); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, but got %d", http.StatusNotFound, rr.Code)
+	}
+	if rr, _ := decommission(`{"node_id":"node1"}`); rr.Code != http.StatusConflict {
+		t.Errorf("expected status %d, but got %d", http.StatusConflict, rr.Code)
+	}
+
+	// --- Test Case 3: The node is kept if the remaining voters never catch up ---
+	mr.barrierErr = raft.ErrLeadershipLost
+	rr, res = decommission(`{"node_id":"node2","timeout":"50ms"}`)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, but got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+	if !res.Demoted || res.PeersCaughtUp || res.Removed || res.Error == "" {
+		t.Errorf("expected the decommission to stop after demotion, but got %+v", res)
+	}
+	if len(mr.servers) != 2 {
+		t.Errorf("expected node2 to stay in the configuration, but got %d servers", len(mr.servers))
+	}
+
+	// --- Test Case 4: Only the leader can decommission ---
+	mr.isLeader = false
+	if rr, _ := decommission(`{"node_id":"node2"}`); rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d, but got %d", http.StatusForbidden, rr.Code)
+	}
+}
+
+func TestMembers(t *testing.T) {
+	kv := newMockStore()
+	srv := New(kv, &mockRaft{store: kv, servers: []raft.Server{
+		{ID: "node1", Address: "localhost:9081", Suffrage: raft.Voter},
+		{ID: "node2", Address: "localhost:9082", Suffrage: raft.Nonvoter},
+	}})
+
+	// --- Test Case 1: Any node lists the configuration ---
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/admin/members", nil))
+	var res v1.MembersResponse
+	json.NewDecoder(rr.Body).Decode(&res)
+	if rr.Code != http.StatusOK || len(res.Members) != 2 {
+		t.Fatalf("expected 2 members, but got status %d: %+v", rr.Code, res)
+	}
+	if m := res.Members[1]; m.NodeID != "node2" || m.Addr != "localhost:9082" || m.Suffrage != "Nonvoter" {
+		t.Errorf("expected node2 as a non-voter, but got %+v", m)
+	}
+}
+
+func TestJoinTokens(t *testing.T) {
+	kv := newMockStore()
+	srv := New(kv, &mockRaft{store: kv, isLeader: true}, WithJoinToken("secret"))
+	request := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set(JoinTokenHeader, token)
+		}
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr
+	}
+	const join = `{"node_id":"node2","addr":"localhost:9082"}`
+
+	// --- Test Case 1: Membership changes need the shared token ---
+	if rr := request(http.MethodPost, "/v1/join", "", join); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d, but got %d", http.StatusUnauthorized, rr.Code)
+	}
+	if rr := request(http.MethodPost, "/v1/admin/decommission", "wrong", `{"node_id":"node2"}`); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d, but got %d", http.StatusUnauthorized, rr.Code)
+	}
+	if rr := request(http.MethodPost, "/v1/join", "secret", join); rr.Code != http.StatusOK {
+		t.Errorf("expected status %d, but got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	// --- Test Case 2: A one-time token admits a single request ---
+	if rr := request(http.MethodPost, "/v1/admin/join-tokens", "", `{}`); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected minting without the shared token to fail, but got %d", rr.Code)
+	}
+	rr := request(http.MethodPost, "/v1/admin/join-tokens", "secret", `{"ttl":"10m"}`)
+	var res v1.JoinTokenResponse
+	json.NewDecoder(rr.Body).Decode(&res)
+	if rr.Code != http.StatusOK || res.Token == "" || time.Until(res.ExpiresAt) > 10*time.Minute {
+		t.Fatalf("expected a token valid for 10m, but got status %d: %+v", rr.Code, res)
+	}
+	if rr := request(http.MethodPost, "/v1/join", res.Token, join); rr.Code != http.StatusOK {
+		t.Errorf("expected status %d, but got %d", http.StatusOK, rr.Code)
+	}
+	if rr := request(http.MethodPost, "/v1/join", res.Token, join); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected the spent token to be refused, but got %d", rr.Code)
+	}
+	if _, ok := kv.Get(store.JoinTokenPrefix + res.Token); ok {
+		t.Error("expected only the token's hash to be stored, but the token was")
+	}
+
+	// --- Test Case 3: Unknown and expired tokens are refused without a proposal ---
+	expired := hashJoinToken("expired")
+	kv.Set(store.JoinTokenPrefix+expired, time.Now().UTC().Add(-time.Minute).Format(time.RFC3339Nano))
+	node := srv.raft.(*mockRaft)
+	node.lastCmd = Command{}
+	for _, token := range []string{"guess", "expired"} {
+		if rr := request(http.MethodPost, "/v1/join", token, join); rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected token %q to be refused, but got %d", token, rr.Code)
+		}
+	}
+	if node.lastCmd.Op != "" {
+		t.Errorf("expected no command to be proposed, but got %+v", node.lastCmd)
+	}
+
+	// --- Test Case 4: Minting forgets expired tokens ---
+	if rr := request(http.MethodPost, "/v1/admin/join-tokens", "secret", `{}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, but got %d", http.StatusOK, rr.Code)
+	}
+	if _, ok := node.lastCmd.Purge[expired]; !ok || len(node.lastCmd.Purge) != 1 {
+		t.Errorf("expected only the expired token to be purged, but got %v", node.lastCmd.Purge)
+	}
+	if _, ok := kv.Get(store.JoinTokenPrefix + expired); ok {
+		t.Error("expected the expired token to be forgotten, but it is still stored")
+	}
+}
+
+func TestJoinClusterID(t *testing.T) {
+	kv := newMockStore()
+	kv.Set(store.ClusterIDKey, "cluster-a")
+	srv := New(kv, &mockRaft{store: kv, isLeader: true})
+	join := func(body string) int {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/join", strings.NewReader(body)))
+		return rr.Code
+	}
+
+	// --- Test Case 1: Nodes of the same cluster, or of none yet, may join ---
+	if code := join(`{"node_id":"node2","addr":"localhost:9082","cluster_id":"cluster-a"}`); code != http.StatusOK {
+		t.Errorf("expected status %d, but got %d", http.StatusOK, code)
+	}
+	if code := join(`{"node_id":"node3","addr":"localhost:9083"}`); code != http.StatusOK {
+		t.Errorf("expected status %d, but got %d", http.StatusOK, code)
+	}
+
+	// --- Test Case 2: A node of another cluster is refused ---
+	if code := join(`{"node_id":"node4","addr":"localhost:9084","cluster_id":"cluster-b"}`); code != http.StatusConflict {
+		t.Errorf("expected status %d, but got %d", http.StatusConflict, code)
+	}
+
+	// --- Test Case 3: Members report the cluster ID ---
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/admin/members", nil))
+	var res v1.MembersResponse
+	json.NewDecoder(rr.Body).Decode(&res)
+	if res.ClusterID != "cluster-a" {
+		t.Errorf("expected cluster-a, but got %q", res.ClusterID)
+	}
+}
+
+func TestLeaderHTTPAddr(t *testing.T) {
+	kv := newMockStore()
+	node := &mockRaft{store: kv, isLeader: true}
+	srv := New(kv, node)
+
+	// --- Test Case 1: A joining node's HTTP address is recorded ---
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/join", strings.NewReader(`{"node_id":"node1","addr":"localhost:8080","http_addr":"db1.example.com:443"}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, but got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if addr := srv.nodeHTTPAddr("localhost:8080"); addr != "db1.example.com:443" {
+		t.Errorf("expected db1.example.com:443, but got %q", addr)
+	}
+
+	// --- Test Case 2: Followers point clients at the leader's HTTP address ---
+	node.isLeader = false
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/kv/a", strings.NewReader(`{"value":"1"}`)))
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "db1.example.com:443") {
+		t.Errorf("expected 403 naming the leader's HTTP address, but got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// --- Test Case 3: Members report HTTP addresses ---
+	node.servers = []raft.Server{{ID: "node1", Address: "localhost:8080", Suffrage: raft.Voter}}
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/admin/members", nil))
+	var res v1.MembersResponse
+	json.NewDecoder(rr.Body).Decode(&res)
+	if res.LeaderHTTPAddr != "db1.example.com:443" || len(res.Members) != 1 || res.Members[0].HTTPAddr != "db1.example.com:443" {
+		t.Errorf("expected the leader's HTTP address, but got %+v", res)
+	}
+}
+
+func TestDigest(t *testing.T) {
+	kv := newMockStore()
+	node := &mockRaft{store: kv, isLeader: true}
+	var asked []uint64
+	srv := New(kv, node, WithDigester(func(ctx context.Context, index uint64) (v1.DigestResponse, error) {
+		asked = append(asked, index)
+		if index == 2 {
+			return v1.DigestResponse{}, ErrDigestUnavailable
+		}
+		return v1.DigestResponse{Index: index, Hash: "abc", Keys: 1}, nil
+	}))
+
+	// --- Test Case 1: POST proposes a marker and digests at its index ---
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/admin/digest", nil))
+	var res v1.DigestResponse
+	json.NewDecoder(rr.Body).Decode(&res)
+	if rr.Code != http.StatusOK || node.lastCmd.Op != "DIGEST" || res.Index != 7 {
+		t.Errorf("expected a digest at the marker's index 7, but got status %d: %+v", rr.Code, res)
+	}
+
+	// --- Test Case 2: GET passes the requested index through ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/admin/digest?index=5", nil))
+	if rr.Code != http.StatusOK || asked[len(asked)-1] != 5 {
+		t.Errorf("expected a digest at index 5, but got status %d after asking for %v", rr.Code, asked)
+	}
+
+	// --- Test Case 3: An index applied past without a marker is gone ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/admin/digest?index=2", nil))
+	if rr.Code != http.StatusGone {
+		t.Errorf("expected status %d, but got %d", http.StatusGone, rr.Code)
+	}
+
+	// --- Test Case 4: Only the leader proposes markers ---
+	node.isLeader = false
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/admin/digest", nil))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d, but got %d", http.StatusForbidden, rr.Code)
+	}
+}
+
+func TestQuotas(t *testing.T) {
+	kv := newMockStore()
+	node := &mockRaft{isLeader: true, store: kv}
+	srv := New(kv, node)
+	request := func(method, target, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rr
+	}
+
+	// --- Test Case 1: The leader replicates a quota ---
+	if rr := request(http.MethodPut, "/v1/admin/quotas", `{"namespace":"a/","max_keys":10,"max_bytes":1024}`); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d, but got %d: %s", http.StatusNoContent, rr.Code, rr.Body.String())
+	}
+	if vv, _ := kv.Get(store.QuotaPrefix + "a/"); vv.Value != `{"max_keys":10,"max_bytes":1024}` {
+		t.Errorf("expected the quota to be replicated, but got %q", vv.Value)
+	}
+
+	// --- Test Case 2: Invalid quotas are refused ---
+	for _, body := range []string{`{"max_keys":1}`, `{"namespace":"\u0000x","max_keys":1}`, `{"namespace":"a/","max_keys":-1}`} {
+		if rr := request(http.MethodPut, "/v1/admin/quotas", body); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status %d for %s, but got %d", http.StatusBadRequest, body, rr.Code)
+		}
+	}
+
+	// --- Test Case 3: Removing a quota ---
+	if rr := request(http.MethodDelete, "/v1/admin/quotas?namespace=a/", ""); rr.Code != http.StatusNoContent {
+		t.Errorf("expected status %d, but got %d", http.StatusNoContent, rr.Code)
+	}
+	if _, ok := kv.Get(store.QuotaPrefix + "a/"); ok {
+		t.Error("expected the quota to be removed, but it is still there")
+	}
+
+	// --- Test Case 4: Writes over quota fail with 507 ---
+	node.quotaErr = store.ErrQuotaExceeded
+	if rr := request(http.MethodPost, "/v1/kv/a/1", `{"value":"x"}`); rr.Code != http.StatusInsufficientStorage || !strings.Contains(rr.Body.String(), "quota exceeded") {
+		t.Errorf("expected status %d, but got %d: %s", http.StatusInsufficientStorage, rr.Code, rr.Body.String())
+	}
+
+	// --- Test Case 5: Followers refuse changes ---
+	node.isLeader = false
+	if rr := request(http.MethodPut, "/v1/admin/quotas", `{"namespace":"a/","max_keys":1}`); rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d, but got %d", http.StatusForbidden, rr.Code)
+	}
+
+	// --- Test Case 6: Usage is listed and reported in /stats ---
+	st := store.NewStore()
+	st.Set("a/1", "xyz")
+	st.Set(store.QuotaPrefix+"a/", `{"max_keys":10}`)
+	srv = New(st, node)
+	rr := request(http.MethodGet, "/v1/admin/quotas", "")
+	var quotas v1.QuotasResponse
+	json.NewDecoder(rr.Body).Decode(&quotas)
+	if len(quotas.Namespaces) != 1 || quotas.Namespaces[0] != (v1.NamespaceUsage{Namespace: "a/", MaxKeys: 10, Keys: 1, Bytes: 6}) {
+		t.Errorf("expected a/ to hold 1 key of 6 bytes, but got %+v", quotas.Namespaces)
+	}
+	rr = request(http.MethodGet, "/v1/stats", "")
+	var stats v1.StatsResponse
+	json.NewDecoder(rr.Body).Decode(&stats)
+	if len(stats.Namespaces) != 1 || stats.Namespaces[0].Keys != 1 {
+		t.Errorf("expected /stats to report a/, but got %+v", stats.Namespaces)
+	}
+}
+
+func TestGetDeletedKey(t *testing.T) {
+	st := store.NewStore()
+	srv := New(st, &mockRaft{isLeader: true})
+	st.Set("a", "1")
+	st.Delete("a")
+
+	// --- Test Case 1: A deleted key reports the version of its delete ---
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/kv/a", nil))
+	if rr.Code != http.StatusNotFound || rr.Header().Get(DeletedVersionHeader) != "2" {
+		t.Errorf("expected 404 with deleted version 2, but got %d with %q", rr.Code, rr.Header().Get(DeletedVersionHeader))
+	}
+
+	// --- Test Case 2: A key that never existed does not ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/kv/b", nil))
+	if rr.Code != http.StatusNotFound || rr.Header().Get(DeletedVersionHeader) != "" {
+		t.Errorf("expected 404 without a deleted version, but got %d with %q", rr.Code, rr.Header().Get(DeletedVersionHeader))
+	}
+}
+
+func TestKeyHistory(t *testing.T) {
+	kv := newMockStore()
+	node := &mockRaft{isLeader: true, store: kv}
+	history := map[string][]v1.KeyVersion{"a": {{Version: 2, Value: "new", Writer: "user:alice"}, {Version: 1, Value: "old"}}}
+	srv := New(kv, node, WithAuditor(&mockAuditor{}), WithKeyHistory(func(key string) []v1.KeyVersion {
+		return history[key]
+	}))
+
+	// --- Test Case 1: The versions of a key are listed ---
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/kv/a?history=true", nil))
+	var res v1.KeyHistoryResponse
+	json.NewDecoder(rr.Body).Decode(&res)
+	if rr.Code != http.StatusOK || res.Key != "a" || len(res.Versions) != 2 || res.Versions[0].Writer != "user:alice" {
+		t.Errorf("expected 2 versions of a, but got status %d: %+v", rr.Code, res)
+	}
+
+	// --- Test Case 2: A key with no history that does not exist is not found ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/kv/missing?history=true", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, but got %d", http.StatusNotFound, rr.Code)
+	}
+
+	// --- Test Case 3: With auditing on, writes carry their writer through Raft ---
+	req := httptest.NewRequest(http.MethodPost, "/v1/kv/a", strings.NewReader(`{"value":"x"}`))
+	req.SetBasicAuth("alice", "secret")
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+	if node.lastCmd.Principal != "user:alice" {
+		t.Errorf("expected the command to carry user:alice, but got %q", node.lastCmd.Principal)
+	}
+
+	// --- Test Case 4: Nodes without history say so ---
+	rr = httptest.NewRecorder()
+	New(kv, node).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/kv/a?history=true", nil))
+	if rr.Code != http.StatusNotFound || !strings.Contains(rr.Body.String(), "not enabled") {
+		t.Errorf("expected history to be reported as disabled, but got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// --- Test Case 5: Keys ending in /history are read like any other ---
+	kv.Set("app/history", "v")
+	rr = httptest.NewRecorder()
+	New(kv, node).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/kv/app/history", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "v\n" {
+		t.Errorf("expected app/history to read as v, but got %d: %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestWatch(t *testing.T) {
+	kv := newMockStore()
+	node := &mockRaft{isLeader: true, store: kv}
+	hub := watch.NewHub(10, watch.WithSize(2))
+	srv := New(kv, node, WithWatchHub(hub), WithSlowRequestThreshold(time.Nanosecond))
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	// --- Test Case 1: Changes to the watched prefix are streamed as they commit ---
+	resp, err := http.Get(ts.URL + "/v1/watch?key=a/&prefix=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get(RevisionHeader) != "10" {
+		t.Fatalf("expected a stream from revision 10, but got status %d at %q", resp.StatusCode, resp.Header.Get(RevisionHeader))
+	}
+	hub.Publish(watch.Event{Revision: 11, Type: watch.Put, Key: "b", Value: "x", Version: 1})
+	hub.Publish(watch.Event{Revision: 12, Type: watch.Put, Key: "a/1", Value: "y", Version: 1})
+	dec := json.NewDecoder(resp.Body)
+	var e v1.WatchEvent
+	if err := dec.Decode(&e); err != nil || e.Revision != 12 || e.Type != "PUT" || e.Key != "a/1" || e.Value != "y" {
+		t.Errorf("expected the PUT of a/1 at 12, but got %+v (%v)", e, err)
+	}
+
+	// --- Test Case 2: A reconnecting watch gets what it missed ---
+	hub.Publish(watch.Event{Revision: 13, Type: watch.Delete, Key: "a/1", Version: 2})
+	resumed, err := http.Get(ts.URL + "/v1/watch?key=a/1&since_revision=12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resumed.Body.Close()
+	e = v1.WatchEvent{}
+	if err := json.NewDecoder(resumed.Body).Decode(&e); err != nil || e.Revision != 13 || e.Type != "DELETE" {
+		t.Errorf("expected the missed DELETE at 13, but got %+v (%v)", e, err)
+	}
+
+	// --- Test Case 3: Resuming from a revision no longer buffered is refused ---
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/watch?key=a/1&since_revision=10", nil))
+	var gone v1.WatchCompactedResponse
+	json.NewDecoder(rr.Body).Decode(&gone)
+	if rr.Code != http.StatusGone || gone.Error != "compacted" || gone.CompactedRevision != 11 {
+		t.Errorf("expected 410 compacted at 11, but got status %d: %+v", rr.Code, gone)
+	}
+
+	// --- Test Case 4: A cancelled stream says why ---
+	hub.Reset(20)
+	for {
+		e = v1.WatchEvent{}
+		if err := dec.Decode(&e); err != nil || e.Type == "CANCELED" {
+			break
+		}
+	}
+	if e.Type != "CANCELED" || e.Error != watch.ErrCompacted.Error() {
+		t.Errorf("expected the stream to be cancelled as compacted, but got %+v", e)
+	}
+
+	// --- Test Case 5: A key is required ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/watch", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, but got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	kv := newMockStore()
+	node := &mockRaft{isLeader: true, store: kv}
+	hub := watch.NewHub(10, watch.WithSize(3))
+	srv := New(kv, node, WithWatchHub(hub))
+	for i := uint64(11); i <= 14; i++ {
+		hub.Publish(watch.Event{Revision: i, Type: watch.Put, Key: "jobs/" + strconv.FormatUint(i, 10), Version: 1})
+	}
+	get := func(query string) (int, v1.ChangesResponse) {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/changes?"+query, nil))
+		var res v1.ChangesResponse
+		json.NewDecoder(rr.Body).Decode(&res)
+		return rr.Code, res
+	}
+
+	// --- Test Case 1: Without a revision, paging starts at the oldest buffered change ---
+	code, res := get("key=jobs/&prefix=true&limit=2")
+	if code != http.StatusOK || len(res.Events) != 2 || res.Events[0].Revision != 12 || res.Revision != 13 || !res.More || res.CompactedRevision != 11 {
+		t.Errorf("expected revisions 12 and 13 with more to come, but got status %d: %+v", code, res)
+	}
+
+	// --- Test Case 2: The next page continues from the returned revision ---
+	code, res = get("key=jobs/&prefix=true&limit=2&since_revision=13")
+	if code != http.StatusOK || len(res.Events) != 1 || res.Revision != 14 || res.More {
+		t.Errorf("expected the last change, but got status %d: %+v", code, res)
+	}
+
+	// --- Test Case 3: A caught-up consumer gets an empty page at its revision ---
+	code, res = get("key=jobs/&prefix=true&since_revision=14")
+	if code != http.StatusOK || len(res.Events) != 0 || res.Revision != 14 {
+		t.Errorf("expected no changes at revision 14, but got status %d: %+v", code, res)
+	}
+
+	// --- Test Case 4: Changes no longer buffered are reported as compacted ---
+	if code, _ := get("key=jobs/&prefix=true&since_revision=10"); code != http.StatusGone {
+		t.Errorf("expected status %d, but got %d", http.StatusGone, code)
+	}
+
+	// --- Test Case 5: An invalid limit is rejected ---
+	if code, _ := get("key=jobs/&prefix=true&limit=0"); code != http.StatusBadRequest {
+		t.Errorf("expected status %d, but got %d", http.StatusBadRequest, code)
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	kv := newMockStore()
+	node := &mockRaft{isLeader: true, store: kv}
+	srv := New(kv, node)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	publish := func(channel, message string) (int, v1.PublishResponse) {
+		resp, err := http.Post(ts.URL+"/v1/pubsub/"+channel, "application/json", strings.NewReader(`{"message":"`+message+`"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var res v1.PublishResponse
+		json.NewDecoder(resp.Body).Decode(&res)
+		return resp.StatusCode, res
+	}
+
+	// --- Test Case 1: A message with no subscribers goes nowhere ---
+	if code, res := publish("locks", "early"); code != http.StatusOK || res.Receivers != 0 {
+		t.Errorf("expected 0 receivers, but got status %d: %+v", code, res)
+	}
+
+	// --- Test Case 2: Subscribers receive messages published while connected ---
+	resp, err := http.Get(ts.URL + "/v1/pubsub/locks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if code, res := publish("locks", "released"); code != http.StatusOK || res.Receivers != 1 {
+		t.Errorf("expected 1 receiver, but got status %d: %+v", code, res)
+	}
+	var m v1.PubSubMessage
+	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil || m.Type != "MESSAGE" || m.Channel != "locks" || m.Message != "released" {
+		t.Errorf("expected the released message, but got %+v (%v)", m, err)
+	}
+	if len(kv.data) != 0 {
+		t.Errorf("expected nothing to be stored, but got %v", kv.data)
+	}
+
+	// --- Test Case 3: Followers refuse pub/sub requests ---
+	rr := httptest.NewRecorder()
+	New(kv, &mockRaft{store: kv}).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/pubsub/locks", nil))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d, but got %d", http.StatusForbidden, rr.Code)
+	}
+}
+
+func TestStreams(t *testing.T) {
+	kv := newMockStore()
+	node := &mockRaft{isLeader: true, store: kv}
+	srv := New(kv, node)
+	do := func(method, path, body string, v any) int {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(method, path, strings.NewReader(body)))
+		if v != nil {
+			json.NewDecoder(rr.Body).Decode(v)
+		}
+		return rr.Code
+	}
+
+	// --- Test Case 1: Entries are appended through Raft and listed in order ---
+	for _, job := range []string{"a", "b", "c"} {
+		var res v1.StreamAddResponse
+		if code := do(http.MethodPost, "/v1/streams/jobs", `{"fields":{"job":"`+job+`"}}`, &res); code != http.StatusOK || res.ID == 0 {
+			t.Fatalf("expected an entry ID, but got status %d: %+v", code, res)
+		}
+	}
+	if node.lastCmd.Op != "STREAM" || node.lastCmd.Stream.Type != stream.OpAdd {
+		t.Errorf("expected a STREAM command, but got %+v", node.lastCmd)
+	}
+	var entries v1.StreamEntriesResponse
+	if code := do(http.MethodGet, "/v1/streams/jobs?start=2", "", &entries); code != http.StatusOK || len(entries.Entries) != 2 || entries.Entries[0].Fields["job"] != "b" {
+		t.Errorf("expected entries 2 and 3, but got status %d: %+v", code, entries)
+	}
+
+	// --- Test Case 2: A consumer group reads and acknowledges entries ---
+	if code := do(http.MethodPost, "/v1/streams/jobs/groups", `{"group":"workers"}`, nil); code != http.StatusNoContent {
+		t.Errorf("expected status %d, but got %d", http.StatusNoContent, code)
+	}
+	if code := do(http.MethodPost, "/v1/streams/jobs/groups", `{"group":"workers"}`, nil); code != http.StatusConflict {
+		t.Errorf("expected status %d, but got %d", http.StatusConflict, code)
+	}
+	entries = v1.StreamEntriesResponse{}
+	if code := do(http.MethodPost, "/v1/streams/jobs/groups/workers/read", `{"consumer":"w1","count":2}`, &entries); code != http.StatusOK || len(entries.Entries) != 2 || entries.Entries[0].Deliveries != 1 {
+		t.Errorf("expected 2 entries delivered, but got status %d: %+v", code, entries)
+	}
+	var acked v1.StreamAckResponse
+	if code := do(http.MethodPost, "/v1/streams/jobs/groups/workers/ack", `{"ids":[1]}`, &acked); code != http.StatusOK || acked.Acked != 1 {
+		t.Errorf("expected 1 entry acknowledged, but got status %d: %+v", code, acked)
+	}
+	var info v1.StreamInfoResponse
+	do(http.MethodGet, "/v1/streams/jobs/info", "", &info)
+	if info.Length != 3 || len(info.Groups) != 1 || len(info.Groups[0].Pending) != 1 || info.Groups[0].Pending[0].ID != 2 {
+		t.Errorf("expected entry 2 pending, but got %+v", info)
+	}
+
+	// --- Test Case 3: Missing streams and groups are not found ---
+	if code := do(http.MethodPost, "/v1/streams/jobs/groups/nobody/read", `{"consumer":"w1"}`, nil); code != http.StatusNotFound {
+		t.Errorf("expected status %d, but got %d", http.StatusNotFound, code)
+	}
+	if code := do(http.MethodGet, "/v1/streams/missing", "", nil); code != http.StatusNotFound {
+		t.Errorf("expected status %d, but got %d", http.StatusNotFound, code)
+	}
+
+	// --- Test Case 4: Followers serve reads but refuse changes ---
+	follower := New(kv, &mockRaft{store: kv})
+	rr := httptest.NewRecorder()
+	follower.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/streams/jobs", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status %d, but got %d", http.StatusOK, rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	follower.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/streams/jobs/groups/workers/read", strings.NewReader(`{"consumer":"w1"}`)))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d, but got %d", http.StatusForbidden, rr.Code)
+	}
+
+	// --- Test Case 5: Deleting the stream removes it ---
+	if code := do(http.MethodDelete, "/v1/streams/jobs", "", nil); code != http.StatusNoContent {
+		t.Errorf("expected status %d, but got %d", http.StatusNoContent, code)
+	}
+	if code := do(http.MethodGet, "/v1/streams/jobs/info", "", nil); code != http.StatusNotFound {
+		t.Errorf("expected status %d, but got %d", http.StatusNotFound, code)
+	}
+}
+
+func TestScheduledWrites(t *testing.T) {
+	kv := newMockStore()
+	node := &mockRaft{isLeader: true, store: kv}
+	srv := New(kv, node)
+	at := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	// --- Test Case 1: A SET with a future execute_at is scheduled, not applied ---
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/kv/lease", strings.NewReader(`{"value":"renewed","execute_at":"`+at.Format(time.RFC3339)+`"}`)))
+	var sw v1.ScheduledWrite
+	json.NewDecoder(rr.Body).Decode(&sw)
+	if rr.Code != http.StatusAccepted || sw.ID == "" || sw.Key != "lease" || !sw.ExecuteAt.Equal(at) {
+		t.Fatalf("expected the write to be scheduled, but got status %d: %+v", rr.Code, sw)
+	}
+	if node.lastCmd.Op != "SCHEDULE" {
+		t.Errorf("expected a SCHEDULE command, but got %q", node.lastCmd.Op)
+	}
+	if _, ok := kv.Get("lease"); ok {
+		t.Error("expected lease not to be written yet, but it was")
+	}
+
+	// --- Test Case 2: Pending writes are listed ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/admin/scheduled", nil))
+	var list v1.ScheduledWritesResponse
+	json.NewDecoder(rr.Body).Decode(&list)
+	if len(list.Writes) != 1 || list.Writes[0].ID != sw.ID || list.Writes[0].Value != "renewed" {
+		t.Errorf("expected the scheduled write to be listed, but got %+v", list)
+	}
+
+	// --- Test Case 3: A pending write can be cancelled once ---
+	for _, want := range []int{http.StatusNoContent, http.StatusNotFound} {
+		rr = httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/v1/admin/scheduled/"+sw.ID, nil))
+		if rr.Code != want {
+			t.Errorf("expected status %d, but got %d", want, rr.Code)
+		}
+	}
+
+	// --- Test Case 4: A SET whose time has passed is applied at once ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/kv/lease", strings.NewReader(`{"value":"now","execute_at":"2000-01-01T00:00:00Z"}`)))
+	if vv, _ := kv.Get("lease"); rr.Code != http.StatusCreated || vv.Value != "now" {
+		t.Errorf("expected lease to be written, but got status %d and %q", rr.Code, vv.Value)
+	}
+}
+
+func TestScan(t *testing.T) {
+	kv := newMockStore()
+	srv := New(kv, &mockRaft{isLeader: true, store: kv})
+	kv.Set("users/1", `{"name":"alice","address":{"city":"Paris"}}`)
+	kv.Set("users/2", `{"name":"bob","address":{"city":"Berlin"}}`)
+	kv.Set("users/2", `{"name":"bob","address":{"city":"Paris"}}`)
+	kv.Set("users/3", "not json, Paris")
+	kv.Set("orders/1", `{"address":{"city":"Paris"}}`)
+	kv.Set(store.ReservedPrefix+"internal", "Paris")
+	scan := func(query string) (v1.ScanResponse, int) {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/scan?"+query, nil))
+		var res v1.ScanResponse
+		json.NewDecoder(rr.Body).Decode(&res)
+		return res, rr.Code
+	}
+	keys := func(res v1.ScanResponse) []string {
+		var keys []string
+		for _, item := range res.Items {
+			keys = append(keys, item.Key)
+		}
+		return keys
+	}
+
+	// --- Test Case 1: A plain scan lists the prefix, without reserved keys ---
+	res, code := scan("prefix=users/")
+	if code != http.StatusOK || !slices.Equal(keys(res), []string{"users/1", "users/2", "users/3"}) || res.More {
+		t.Errorf("expected the three users, but got status %d: %+v", code, res)
+	}
+	if res, _ := scan(""); len(res.Items) != 4 {
+		t.Errorf("expected every unreserved key, but got %v", keys(res))
+	}
+
+	// --- Test Case 2: Filters are evaluated on the server ---
+	if res, _ := scan("prefix=users/&where=address.city=Paris"); !slices.Equal(keys(res), []string{"users/1", "users/2"}) || res.Scanned != 3 {
+		t.Errorf("expected the users in Paris out of 3 scanned, but got %v (scanned %d)", keys(res), res.Scanned)
+	}
+	if res, _ := scan("prefix=users/&value_contains=Paris&version_gt=1"); !slices.Equal(keys(res), []string{"users/2"}) {
+		t.Errorf("expected only users/2, but got %v", keys(res))
+	}
+
+	// --- Test Case 3: Pages continue from next ---
+	res, _ = scan("prefix=users/&limit=2")
+	if !slices.Equal(keys(res), []string{"users/1", "users/2"}) || !res.More || res.Next != "users/2" {
+		t.Errorf("expected a first page ending at users/2, but got %+v", res)
+	}
+	if res, _ = scan("prefix=users/&limit=2&start_after=" + res.Next); !slices.Equal(keys(res), []string{"users/3"}) || res.More {
+		t.Errorf("expected a last page with users/3, but got %+v", res)
+	}
+
+	// --- Test Case 4: Invalid filters are refused ---
+	for _, query := range []string{"where=city", "version_gt=x", "limit=0"} {
+		if _, code := scan(query); code != http.StatusBadRequest {
+			t.Errorf("expected 400 for %q, but got %d", query, code)
+		}
+	}
+}
+
+func TestFieldProjection(t *testing.T) {
+	kv := newMockStore()
+	srv := New(kv, &mockRaft{isLeader: true, store: kv})
+	kv.Set("user", `{"name":"alice","bio":"a very long biography","address":{"city":"Paris","zip":"75001"}}`)
+	kv.Set("plain", "hello")
+
+	// --- Test Case 1: Only the selected fields are returned ---
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/kv/user?fields=name,address.city,missing", nil))
+	if want := `{"address":{"city":"Paris"},"name":"alice"}` + "\n"; rr.Code != http.StatusOK || rr.Body.String() != want {
+		t.Errorf("expected %q, but got status %d: %q", want, rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected a JSON response, but got %q", ct)
+	}
+
+	// --- Test Case 2: Values that are not JSON objects are refused ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/kv/plain?fields=name", nil))
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status 422, but got %d", rr.Code)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	kv := newMockStore()
+	srv := New(kv, &mockRaft{isLeader: true, store: kv})
+	kv.Set("orders/1", `{"total":10,"status":"paid"}`)
+	kv.Set("orders/2", `{"total":2.5,"status":"open"}`)
+	kv.Set("orders/3", `{"total":"n/a","status":"paid"}`)
+	kv.Set("orders/4", `{"total":30,"status":"paid"}`)
+	kv.Set("counters/a", "4")
+	kv.Set("counters/b", "6")
+	aggregate := func(query string) (v1.AggregateResponse, int) {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/aggregate?"+query, nil))
+		var res v1.AggregateResponse
+		json.NewDecoder(rr.Body).Decode(&res)
+		return res, rr.Code
+	}
+
+	// --- Test Case 1: Each op over a JSON field ---
+	tests := []struct {
+		query          string
+		value          float64
+		count, skipped int
+	}{
+		{"prefix=orders/&op=count", 4, 4, 0},
+		{"prefix=orders/&op=sum&field=total", 42.5, 3, 1},
+		{"prefix=orders/&op=avg&field=total", 42.5 / 3, 3, 1},
+		{"prefix=orders/&op=min&field=total", 2.5, 3, 1},
+		{"prefix=orders/&op=max&field=total", 30, 3, 1},
+		{"prefix=orders/&op=sum&field=total&where=status=paid", 40, 2, 1},
+		{"prefix=counters/&op=sum", 10, 2, 0},
+		{"prefix=none/&op=max", 0, 0, 0},
+	}
+	for _, tc := range tests {
+		res, code := aggregate(tc.query)
+		if code != http.StatusOK || res.Value != tc.value || res.Count != tc.count || res.Skipped != tc.skipped {
+			t.Errorf("expected %s to give %v over %d keys skipping %d, but got status %d: %+v", tc.query, tc.value, tc.count, tc.skipped, code, res)
+		}
+	}
+
+	// --- Test Case 2: Unknown ops are refused ---
+	if _, code := aggregate("prefix=orders/&op=median"); code != http.StatusBadRequest {
+		t.Errorf("expected status 400, but got %d", code)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	kv := newMockStore()
+	srv := New(kv, &mockRaft{isLeader: true, store: kv})
+	kv.Set("users/1", `{"name":"alice","age":30}`)
+	kv.Set("users/2", `{"name":"bob","age":25}`)
+	kv.Set("users/3", `{"name":"carol","age":41}`)
+	kv.Set(store.ReservedPrefix+"users", "hidden")
+
+	// --- Test Case 1: A query given in the body ---
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/query", strings.NewReader(`{"sql":"SELECT key, value.name FROM kv WHERE value.age >= 30 LIMIT 1"}`)))
+	var res v1.QueryResponse
+	json.NewDecoder(rr.Body).Decode(&res)
+	if rr.Code != http.StatusOK || len(res.Rows) != 1 || res.Rows[0][0] != "users/1" || res.Rows[0][1] != "alice" || res.Truncated {
+		t.Errorf("expected one row for alice, but got status %d: %+v", rr.Code, res)
+	}
+
+	// --- Test Case 2: A query given as a parameter skips reserved keys ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/query?sql="+url.QueryEscape("SELECT * WHERE value LIKE '%o%'"), nil))
+	res = v1.QueryResponse{}
+	json.NewDecoder(rr.Body).Decode(&res)
+	if rr.Code != http.StatusOK || len(res.Columns) != 3 || len(res.Rows) != 2 {
+		t.Errorf("expected two rows of three columns, but got status %d: %+v", rr.Code, res)
+	}
+
+	// --- Test Case 3: Queries outside the dialect are refused ---
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/query?sql="+url.QueryEscape("DELETE FROM kv"), nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, but got %d", rr.Code)
+	}
+}
+
+func TestMsgpack(t *testing.T) {
+	kv := newMockStore()
+	srv := New(kv, &mockRaft{isLeader: true, store: kv})
+	encode := func(v interface{}) *bytes.Buffer {
+		var buf bytes.Buffer
+		if err := codec.NewEncoder(&buf, msgpackHandle).Encode(v); err != nil {
+			t.Fatal(err)
+		}
+		return &buf
+	}
+
+	// --- Test Case 1: A MessagePack SET body is decoded ---
+	req := httptest.NewRequest(http.MethodPost, "/v1/kv/greeting", encode(v1.SetRequest{Value: "hello"}))
+	req.Header.Set("Content-Type", "application/x-msgpack")
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	if got, _ := kv.Get("greeting"); rr.Code != http.StatusCreated || got.Value != "hello" {
+		t.Errorf("expected greeting to be set, but got status %d and %q", rr.Code, got.Value)
+	}
+
+	// --- Test Case 2: Reads honor Accept ---
+	req = httptest.NewRequest(http.MethodGet, "/v1/kv/greeting", nil)
+	req.Header.Set("Accept", "application/msgpack, application/json;q=0.5")
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	var value string
+	if err := codec.NewDecoderBytes(rr.Body.Bytes(), msgpackHandle).Decode(&value); err != nil || value != "hello" || rr.Header().Get("Content-Type") != MediaTypeMsgpack {
+		t.Errorf("expected a MessagePack string, but got %q (%s, err %v)", value, rr.Header().Get("Content-Type"), err)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/v1/kv/greeting", nil)
+	req.Header.Set("Accept", "application/json, application/msgpack")
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	if rr.Body.String() != "hello\n" {
+		t.Errorf("expected the plain value when JSON is preferred, but got %q", rr.Body.String())
+	}
+
+	// --- Test Case 3: Batches of transaction operations round-trip ---
+	tx, _ := srv.txm.Begin()
+	req = httptest.NewRequest(http.MethodPost, "/v1/tx/"+tx.ID+"/operations", encode(v1.TxOperationsRequest{Operations: []v1.TxOperation{{Op: "set", Key: "a", Value: "1"}, {Op: "get", Key: "a"}}}))
+	req.Header.Set("Content-Type", MediaTypeMsgpack)
+	req.Header.Set("Accept", MediaTypeMsgpack)
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	var res v1.TxOperationsResponse
+	if err := codec.NewDecoderBytes(rr.Body.Bytes(), msgpackHandle).Decode(&res); err != nil || len(res.Results) != 2 || res.Results[1].Value != "1" || !res.Results[1].Found {
+		t.Errorf("expected the staged write to be read back, but got status %d: %+v (err %v)", rr.Code, res, err)
+	}
+}
+
+func TestConditionalGet(t *testing.T) {
+	kv := newMockStore()
+	srv := New(kv, &mockRaft{isLeader: true, store: kv})
+	kv.Set("config", "large value")
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/kv/config", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// --- Test Case 1: The ETag starts with the version, also returned on its own ---
+	rr := get("")
+	etag := rr.Header().Get("ETag")
+	if rr.Code != http.StatusOK || !strings.HasPrefix(etag, `"1-`) || rr.Header().Get(VersionHeader) != "1" {
+		t.Fatalf("expected version 1 in the ETag, but got status %d and %q", rr.Code, etag)
+	}
+
+	// --- Test Case 2: A matching If-None-Match gets an empty 304 ---
+	for _, header := range []string{etag, `"7", W/` + etag, "*"} {
+		if rr := get(header); rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+			t.Errorf("expected 304 for %s, but got %d with %q", header, rr.Code, rr.Body.String())
+		}
+	}
+
+	// --- Test Case 3: A write changes the ETag ---
+	kv.Set("config", "new value")
+	if rr := get(etag); rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("ETag"), `"2-`) || rr.Body.String() != "new value\n" {
+		t.Errorf("expected the new value with version 2 in the ETag, but got %d, %q: %q", rr.Code, rr.Header().Get("ETag"), rr.Body.String())
+	}
+
+	// --- Test Case 4: A key recreated at the same version has a new ETag ---
+	etag = get("").Header().Get("ETag")
+	kv.Delete("config")
+	kv.Set("config", "other value")
+	kv.Set("config", "other value")
+	if rr := get(etag); rr.Code != http.StatusOK || rr.Header().Get(VersionHeader) != "2" || rr.Body.String() != "other value\n" {
+		t.Errorf("expected the recreated value at version 2, but got %d, %q: %q", rr.Code, rr.Header().Get("ETag"), rr.Body.String())
+	}
+}
+
+func TestFreshnessHeaders(t *testing.T) {
+	kv := newMockStore()
+	node := &mockRaft{isLeader: false, store: kv, appliedIndex: 42, lastContact: time.Now().Add(-2 * time.Second)}
+	srv := New(kv, node)
+	kv.Set("a", "1")
+
+	// --- Test Case 1: A stale read on a follower reports its lag ---
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/kv/a", nil))
+	h := rr.Header()
+	if h.Get(ConsistencyHeader) != ConsistencyStale || h.Get(AppliedIndexHeader) != "42" || h.Get("Cache-Control") != "no-cache" {
+		t.Errorf("expected stale freshness headers at index 42, but got %v", h)
+	}
+	if age, err := strconv.Atoi(h.Get(LeaderContactHeader)); err != nil || age < 2000 || age > 60000 {
+		t.Errorf("expected a leader contact age of about 2000ms, but got %q", h.Get(LeaderContactHeader))
+	}
+
+	// --- Test Case 2: A strong read on the leader has no lag ---
+	node.isLeader = true
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/scan?consistency=strong", nil))
+	if h := rr.Header(); h.Get(ConsistencyHeader) != ConsistencyStrong || h.Get(LeaderContactHeader) != "0" {
+		t.Errorf("expected strong freshness headers with no lag, but got %v", h)
+	}
+}
+
+func TestAdminAllowlist(t *testing.T) {
+	// --- Test Case 1: Entries must be addresses or prefixes ---
+	if _, err := ParseAllowlist([]string{"10.0.0.0/8", "nonsense"}); err == nil {
+		t.Error("expected an invalid entry to fail, but it parsed")
+	}
+	allowlist, err := ParseAllowlist([]string{"10.0.0.0/8", " 192.168.1.7 ", "fd00::/8"})
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	kv := newMockStore()
+	srv := New(kv, &mockRaft{store: kv, isLeader: true}, WithAdminAllowlist(allowlist))
+	request := func(path, remote string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remote
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	// --- Test Case 2: Admin and cluster endpoints need a listed address ---
+	for _, path := range []string{"/v1/admin/members", "/admin/members", "/v1/join", "/v1/cluster/status", "/v1/kv/../admin/members"} {
+		if code := request(path, "203.0.113.9:4000"); code != http.StatusForbidden {
+			t.Errorf("expected %s to be refused, but got status %d", path, code)
+		}
+	}
+	for _, remote := range []string{"10.1.2.3:4000", "192.168.1.7:4000", "[::ffff:10.0.0.1]:4000", "[fd00::1]:4000"} {
+		if code := request("/v1/admin/members", remote); code != http.StatusOK {
+			t.Errorf("expected a request from %s to be allowed, but got status %d", remote, code)
+		}
+	}
+	if code := request("/v1/admin/members", "192.168.1.8:4000"); code != http.StatusForbidden {
+		t.Errorf("expected a neighbouring address to be refused, but got status %d", code)
+	}
+
+	// --- Test Case 3: Other endpoints are open to everyone ---
+	if code := request("/v1/kv/a", "203.0.113.9:4000"); code == http.StatusForbidden {
+		t.Error("expected the KV API to stay reachable, but it was refused")
+	}
+
+	// --- Test Case 4: Clients on the unix socket are local ---
+	req := httptest.NewRequest(http.MethodGet, "/v1/admin/members", nil)
+	req.RemoteAddr = "@"
+	req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, &net.UnixAddr{Name: "/tmp/helios.sock", Net: "unix"}))
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status %d, but got %d", http.StatusOK, rr.Code)
+	}
+}
+
+func TestSeparateAdmin(t *testing.T) {
+	kv := newMockStore()
+	srv := New(kv, &mockRaft{store: kv, isLeader: true}, WithSeparateAdmin(true))
+	admin := srv.AdminHandler()
+	request := func(h http.Handler, path string) int {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr.Code
+	}
+
+	// --- Test Case 1: The data plane hides admin endpoints ---
+	for _, path := range []string{"/v1/admin/members", "/admin/members", "/metrics", "/debug/pprof/"} {
+		if code := request(srv, path); code != http.StatusNotFound {
+			t.Errorf("expected %s to be hidden, but got status %d", path, code)
+		}
+	}
+	if code := request(srv, "/v1/kv/missing"); code != http.StatusNotFound {
+		t.Errorf("expected status %d, but got %d", http.StatusNotFound, code)
+	}
+
+	// --- Test Case 2: The admin listener serves them, and nothing else ---
+	for _, path := range []string{"/v1/admin/members", "/metrics", "/debug/pprof/", "/ready"} {
+		if code := request(admin, path); code != http.StatusOK {
+			t.Errorf("expected %s to be served, but got status %d", path, code)
+		}
+	}
+	kv.Set("a", "1")
+	if code := request(admin, "/v1/kv/a"); code != http.StatusNotFound {
+		t.Errorf("expected the KV API to be hidden, but got status %d", code)
+	}
+	if code := request(srv, "/v1/kv/a"); code != http.StatusOK {
+		t.Errorf("expected the KV API on the data plane, but got status %d", code)
+	}
+
+	// --- Test Case 3: The allowlist covers the profiler ---
+	allowlist, _ := ParseAllowlist([]string{"10.0.0.0/8"})
+	admin = New(kv, &mockRaft{store: kv, isLeader: true}, WithSeparateAdmin(true), WithAdminAllowlist(allowlist)).AdminHandler()
+	req := httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil)
+	req.RemoteAddr = "203.0.113.9:4000"
+	rr := httptest.NewRecorder()
+	admin.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d, but got %d", http.StatusForbidden, rr.Code)
+	}
+}
+
+func TestTenants(t *testing.T) {
+	kv := newMockStore()
+	srv := New(kv, &mockRaft{store: kv, isLeader: true}, WithTenants([]Tenant{
+		{Name: "payments", Namespace: "payments/", APIKeys: []string{"pay-key"}},
+		{Name: "search", Namespace: "search/", APIKeys: []string{"search-key"}, RequestsPerSecond: 2},
+	}))
+	request := func(method, path, apiKey, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// --- Test Case 1: Data-plane requests need a tenant's key ---
+	if rr := request(http.MethodGet, "/v1/kv/payments/a", "", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d, but got %d", http.StatusUnauthorized, rr.Code)
+	}
+	if rr := request(http.MethodGet, "/v1/kv/payments/a", "stolen", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d, but got %d", http.StatusUnauthorized, rr.Code)
+	}
+	if rr := request(http.MethodGet, "/ready", "", ""); rr.Code != http.StatusOK {
+		t.Errorf("expected /ready to stay open, but got status %d", rr.Code)
+	}
+
+	// --- Test Case 2: Tenants stay within their namespace ---
+	if rr := request(http.MethodPost, "/v1/kv/payments/a", "pay-key", `{"value":"1"}`); rr.Code != http.StatusCreated {
+		t.Errorf("expected status %d, but got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	for _, path := range []string{"/v1/kv/search/a", "/v1/scan?prefix=", "/v1/scan?prefix=search/", "/v1/watch?key=pay", "/v1/query?sql=SELECT+*+FROM+kv", "/v1/changes", "/v1/stats"} {
+		if rr := request(http.MethodGet, path, "pay-key", ""); rr.Code != http.StatusForbidden {
+			t.Errorf("expected %s to be refused, but got status %d", path, rr.Code)
+		}
+	}
+	if rr := request(http.MethodGet, "/v1/scan?prefix=payments/", "pay-key", ""); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "payments/a") {
+		t.Errorf("expected the tenant's keys, but got status %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// --- Test Case 3: Keys in request bodies are checked too ---
+	rr := request(http.MethodPost, "/v1/tx/execute", "pay-key", `{"operations":[{"op":"set","key":"search/x","value":"1"}]}`)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d, but got %d", http.StatusForbidden, rr.Code)
+	}
+	if _, ok := kv.Get("search/x"); ok {
+		t.Error("expected the write outside the namespace not to be applied")
+	}
+	rr = request(http.MethodPost, "/v1/tx/execute", "pay-key", `{"operations":[{"op":"set","key":"payments/x","value":"1"}]}`)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status %d, but got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	// --- Test Case 4: Each tenant's request rate is capped ---
+	throttled := 0
+	for i := 0; i < 5; i++ {
+		if request(http.MethodGet, "/v1/kv/search/a", "search-key", "").Code == http.StatusTooManyRequests {
+			throttled++
+		}
+	}
+	if throttled == 0 {
+		t.Error("expected requests over the rate to be throttled, but none were")
+	}
+	if rr := request(http.MethodGet, "/v1/kv/payments/a", "pay-key", ""); rr.Code != http.StatusOK {
+		t.Errorf("expected other tenants to be unaffected, but got status %d", rr.Code)
+	}
+
+	// --- Test Case 5: Metrics are labelled by tenant ---
+	body := request(http.MethodGet, "/metrics", "", "").Body.String()
+	for _, want := range []string{`heliosdb_tenant_requests_total{tenant="payments"}`, `heliosdb_tenant_throttled_total{tenant="search"}`, `heliosdb_tenant_denied_total{tenant="payments"}`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected metrics to contain %q, but got:\n%s", want, body)
+		}
+	}
+
+	// --- Test Case 6: Request rates can be changed at runtime ---
+	srv.SetTenantRates(map[string]float64{"search": 0, "payments": 1})
+	for i := 0; i < 5; i++ {
+		if rr := request(http.MethodGet, "/v1/kv/search/a", "search-key", ""); rr.Code == http.StatusTooManyRequests {
+			t.Fatalf("expected the lifted cap to admit request %d, but got status %d", i, rr.Code)
+		}
+	}
+	throttled = 0
+	for i := 0; i < 5; i++ {
+		if request(http.MethodGet, "/v1/kv/payments/a", "pay-key", "").Code == http.StatusTooManyRequests {
+			throttled++
+		}
+	}
+	if throttled == 0 {
+		t.Error("expected the new cap to throttle requests, but none were")
+	}
+}
+
+func TestKeyMetering(t *testing.T) {
+	kv := newMockStore()
+	node := &mockRaft{store: kv, isLeader: true}
+	srv := New(kv, node, WithKeyRateLimit(2), WithTenants([]Tenant{
+		{Name: "payments", Namespace: "payments/", APIKeys: []string{"pay-key", "pay-batch"}, RequestsPerSecond: 1000},
+	}))
+	request := func(method, path, apiKey, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		return rr
+	}
+	usage := func() map[string]v1.APIKeyUsage {
+		var res v1.APIKeysResponse
+		json.NewDecoder(request(http.MethodGet, "/v1/admin/api-keys", "", "").Body).Decode(&res)
+		out := make(map[string]v1.APIKeyUsage)
+		for _, u := range res.Keys {
+			out[u.Key] = u
+		}
+		return out
+	}
+
+	// --- Test Case 1: Requests and bytes are counted per key ---
+	if rr := request(http.MethodPost, "/v1/kv/payments/a", "pay-key", `{"value":"12345"}`); rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, but got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	request(http.MethodGet, "/v1/kv/payments/a", "pay-key", "")
+	u := usage()["api-key:pay-key"]
+	if u.Requests != 2 || u.BytesReceived != 17 || u.BytesSent == 0 || u.Tenant != "payments" || len(u.ID) != 12 {
+		t.Errorf("expected 2 requests of 17 bytes from payments, but got %+v", u)
+	}
+
+	// --- Test Case 2: Each key is capped on its own ---
+	throttled := 0
+	for i := 0; i < 5; i++ {
+		rr := request(http.MethodGet, "/v1/kv/payments/a", "pay-batch", "")
+		if rr.Code == http.StatusTooManyRequests {
+			throttled++
+		}
+	}
+	if throttled == 0 {
+		t.Error("expected requests over the key's rate to be throttled, but none were")
+	}
+	if u := usage()["api-key:pay-batc..."]; u.Throttled != uint64(throttled) {
+		t.Errorf("expected %d throttled requests, but got %+v", throttled, u)
+	}
+
+	// --- Test Case 3: Unknown keys and admin endpoints are not metered ---
+	request(http.MethodGet, "/v1/kv/payments/a", "stolen", "")
+	if got := usage(); len(got) != 2 {
+		t.Errorf("expected 2 metered keys, but got %+v", got)
+	}
+
+	// --- Test Case 4: Usage is exported as metrics ---
+	body := request(http.MethodGet, "/metrics", "", "").Body.String()
+	for _, want := range []string{`heliosdb_api_key_requests_total{key="` + u.ID + `",tenant="payments"} 2`, `heliosdb_api_key_received_bytes_total{key="` + u.ID + `",tenant="payments"} 17`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected metrics to contain %q, but got:\n%s", want, body)
+		}
+	}
+
+	// --- Test Case 5: Without metering there is nothing to report ---
+	rr := httptest.NewRecorder()
+	New(kv, node).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/admin/api-keys", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, but got %d", http.StatusNotFound, rr.Code)
+	}
+
+	// --- Test Case 6: Requests without a key, and keys past the limit, share a cap ---
+	srv = New(kv, node, WithKeyRateLimit(2))
+	for i := 0; i < maxMeteredKeys; i++ {
+		srv.keyMeter.usage("key-"+strconv.Itoa(i), nil)
+	}
+	for _, prefix := range []string{"", "new-key-"} {
+		throttled := 0
+		for i := 0; i < 5; i++ {
+			apiKey := ""
+			if prefix != "" {
+				apiKey = prefix + strconv.Itoa(i)
+			}
+			if rr := request(http.MethodGet, "/v1/kv/a", apiKey, ""); rr.Code == http.StatusTooManyRequests {
+				throttled++
+			}
+		}
+		if throttled == 0 {
+			t.Errorf("expected requests with keys %q to be throttled, but none were", prefix)
+		}
+	}
+
+	// --- Test Case 7: The cap can be changed at runtime, if keys are metered ---
+	if err := srv.SetKeyRateLimit(0); err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if rr := request(http.MethodGet, "/v1/kv/a", "", ""); rr.Code == http.StatusTooManyRequests {
+			t.Fatalf("expected the lifted cap to admit request %d, but got status %d", i, rr.Code)
+		}
+	}
+	if err := New(kv, node).SetKeyRateLimit(2); err == nil {
+		t.Error("expected an error capping keys that are not metered, but got none")
+	}
+}
+
+func TestMaxRequestBytes(t *testing.T) {
+	kv := newMockStore()
+	srv := New(kv, &mockRaft{isLeader: true, store: kv}, WithMaxRequestBytes(64))
+
+	// --- Test Case 1: Bodies declaring more than the limit fail at once ---
+	req := httptest.NewRequest(http.MethodPost, "/v1/kv/a", strings.NewReader(`{"value":"`+strings.Repeat("x", 100)+`"}`))
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge || rr.Header().Get("Connection") != "close" {
+		t.Errorf("expected status %d closing the connection, but got %d", http.StatusRequestEntityTooLarge, rr.Code)
+	}
+
+	// --- Test Case 2: Bodies of unknown length fail once they pass it ---
+	req = httptest.NewRequest(http.MethodPost, "/v1/kv/a", io.MultiReader(strings.NewReader(`{"value":"`+strings.Repeat("x", 100)+`"}`)))
+	req.ContentLength = -1
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status %d, but got %d: %s", http.StatusRequestEntityTooLarge, rr.Code, rr.Body.String())
+	}
+	if _, ok := kv.Get("a"); ok {
+		t.Error("expected the oversized value not to be written, but it was")
+	}
+
+	// --- Test Case 3: Raw values are stored as sent, if they are text ---
+	req = httptest.NewRequest(http.MethodPost, "/v1/kv/a", strings.NewReader("\xff\xfe"))
+	req.Header.Set("Content-Type", MediaTypeOctetStream)
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "UTF-8") {
+		t.Errorf("expected status %d for a binary value, but got %d: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+	}
+	value := "line \"one\"\n\tline two \u00e9"
+	req = httptest.NewRequest(http.MethodPost, "/v1/kv/a", strings.NewReader(value))
+	req.Header.Set("Content-Type", MediaTypeOctetStream)
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, but got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	if vv, _ := kv.Get("a"); vv.Value != value {
+		t.Errorf("expected %q, but got %q", value, vv.Value)
+	}
+
+	// --- Test Case 4: Bulk loads are not limited ---
+	var lines strings.Builder
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(&lines, "{\"key\":\"k%d\",\"value\":\"%s\"}\n", i, strings.Repeat("v", 20))
+	}
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/admin/bulk-load", strings.NewReader(lines.String())))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status %d, but got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	// --- Test Case 5: Every JSON endpoint answers 413 once a body passes the limit ---
+	for _, path := range []string{"/v1/join", "/v1/admin/maintenance", "/v1/admin/decommission"} {
+		req = httptest.NewRequest(http.MethodPost, path, io.MultiReader(strings.NewReader(`{"node_id":"`+strings.Repeat("x", 100)+`"}`)))
+		req.ContentLength = -1
+		rr = httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+		if rr.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected status %d from %s, but got %d: %s", http.StatusRequestEntityTooLarge, path, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestRangeDelete(t *testing.T) {
+	kv := newMockStore()
+	node := &mockRaft{isLeader: true, store: kv}
+	srv := New(kv, node, WithRangeDeleteLimit(3))
+	for _, key := range []string{"session:expired:1", "session:expired:2", "session:live:1"} {
+		kv.Set(key, "x")
+	}
+	request := func(target string) (*httptest.ResponseRecorder, v1.RangeDeleteResponse) {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, target, nil))
+		var res v1.RangeDeleteResponse
+		json.Unmarshal(rr.Body.Bytes(), &res)
+		return rr, res
+	}
+
+	// --- Test Case 1: A dry run reports the keys and deletes nothing ---
+	rr, res := request("/v1/kv?prefix=session:expired:&dry_run=true")
+	if rr.Code != http.StatusOK || !res.DryRun || res.Deleted != 2 || len(res.Keys) != 2 || res.OverLimit {
+		t.Errorf("expected 2 keys to be reported, but got %d: %+v", rr.Code, res)
+	}
+	if _, ok := kv.Get("session:expired:1"); !ok {
+		t.Error("expected a dry run to delete nothing, but a key is gone")
+	}
+	if _, res := request("/v1/kv?prefix=session:&dry_run=true&limit=2"); !res.OverLimit {
+		t.Errorf("expected the dry run to report the limit is exceeded, but got %+v", res)
+	}
+
+	// --- Test Case 2: Deleting over the limit deletes nothing ---
+	if rr, _ := request("/v1/kv?prefix=session:&limit=2"); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status %d, but got %d", http.StatusUnprocessableEntity, rr.Code)
+	}
+	if _, ok := kv.Get("session:live:1"); !ok {
+		t.Error("expected nothing to be deleted, but a key is gone")
+	}
+
+	// --- Test Case 3: The matching keys are deleted in one command ---
+	rr, res = request("/v1/kv?prefix=session:expired:")
+	if rr.Code != http.StatusOK || res.Deleted != 2 || node.lastCmd.Op != "DELETE_PREFIX" || node.lastCmd.Limit != 3 {
+		t.Errorf("expected 2 keys deleted by one DELETE_PREFIX, but got %d: %+v (last command %+v)", rr.Code, res, node.lastCmd)
+	}
+	if _, ok := kv.Get("session:expired:1"); ok {
+		t.Error("expected session:expired:1 to be deleted, but it still exists")
+	}
+	if _, ok := kv.Get("session:live:1"); !ok {
+		t.Error("expected session:live:1 to be kept, but it is gone")
+	}
+
+	// --- Test Case 4: Invalid requests are refused ---
+	for _, target := range []string{"/v1/kv", "/v1/kv?prefix=a&limit=0", "/v1/kv?prefix=a&limit=4"} {
+		if rr, _ := request(target); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status %d for %s, but got %d", http.StatusBadRequest, target, rr.Code)
+		}
+	}
+	node.isLeader = false
+	if rr, _ := request("/v1/kv?prefix=a"); rr.Code != http.StatusForbidden {
+		t.Errorf("expected followers to refuse, but got status %d", rr.Code)
+	}
+}
+
+func TestRename(t *testing.T) {
+	kv := newMockStore()
+	node := &mockRaft{isLeader: true, store: kv}
+	srv := New(kv, node)
+	kv.Set("a", "1")
+	kv.Set("b", "2")
+	request := func(target, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+		return rr
+	}
+
+	// --- Test Case 1: Existing destinations are kept unless overwrite is set ---
+	if rr := request("/v1/kv/a?op=rename", `{"to":"b"}`); rr.Code != http.StatusConflict {
+		t.Errorf("expected status %d, but got %d", http.StatusConflict, rr.Code)
+	}
+	if rr := request("/v1/kv/missing?op=rename", `{"to":"c"}`); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, but got %d", http.StatusNotFound, rr.Code)
+	}
+
+	// --- Test Case 2: The value moves in one command ---
+	rr := request("/v1/kv/a?op=rename", `{"to":"c"}`)
+	var res v1.RenameResponse
+	json.NewDecoder(rr.Body).Decode(&res)
+	if rr.Code != http.StatusOK || res.Key != "c" || node.lastCmd.Op != "RENAME" {
+		t.Errorf("expected a rename to c, but got %d: %+v", rr.Code, res)
+	}
+	if vv, _ := kv.Get("c"); vv.Value != "1" {
+		t.Errorf("expected c to hold 1, but got %q", vv.Value)
+	}
+	if _, ok := kv.Get("a"); ok {
+		t.Error("expected a to be gone, but it still exists")
+	}
+	if rr := request("/v1/kv/c?op=rename", `{"to":"b","overwrite":true}`); rr.Code != http.StatusOK {
+		t.Errorf("expected status %d, but got %d", http.StatusOK, rr.Code)
+	}
+
+	// --- Test Case 3: Invalid destinations are refused ---
+	for _, body := range []string{`{}`, `{"to":"b"}`, `{"to":"\u0000x"}`} {
+		if rr := request("/v1/kv/b?op=rename", body); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status %d for %s, but got %d", http.StatusBadRequest, body, rr.Code)
+		}
+	}
+
+	// --- Test Case 4: Keys ending in /rename are set like any other ---
+	if rr := request("/v1/kv/b/rename", `{"value":"v"}`); rr.Code != http.StatusCreated {
+		t.Errorf("expected status %d, but got %d", http.StatusCreated, rr.Code)
+	}
+	if vv, _ := kv.Get("b/rename"); vv.Value != "v" {
+		t.Errorf("expected b/rename to hold v, but got %q", vv.Value)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	kv := newMockStore()
+	node := &mockRaft{isLeader: true, store: kv}
+	srv := New(kv, node)
+	kv.Set("a", "1")
+	kv.Set("b", "2")
+	request := func(target, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+		return rr
+	}
+
+	// --- Test Case 1: Existing destinations are kept unless overwrite is set ---
+	if rr := request("/v1/kv/a?op=copy", `{"to":"b"}`); rr.Code != http.StatusConflict {
+		t.Errorf("expected status %d, but got %d", http.StatusConflict, rr.Code)
+	}
+	if rr := request("/v1/kv/missing?op=copy", `{"to":"c"}`); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, but got %d", http.StatusNotFound, rr.Code)
+	}
+
+	// --- Test Case 2: The source is kept ---
+	rr := request("/v1/kv/a?op=copy", `{"to":"c"}`)
+	var res v1.RenameResponse
+	json.NewDecoder(rr.Body).Decode(&res)
+	if rr.Code != http.StatusOK || res.Key != "c" || res.Version != 1 || node.lastCmd.Op != "COPY" {
+		t.Errorf("expected a copy to c at version 1, but got %d: %+v", rr.Code, res)
+	}
+	for _, key := range []string{"a", "c"} {
+		if vv, _ := kv.Get(key); vv.Value != "1" {
+			t.Errorf("expected %s to hold 1, but got %q", key, vv.Value)
+		}
+	}
+	if rr := request("/v1/kv/a?op=copy", `{"to":"b","overwrite":true}`); rr.Code != http.StatusOK {
+		t.Errorf("expected status %d, but got %d", http.StatusOK, rr.Code)
+	}
+	if rr := request("/v1/kv/a?op=copy", `{"to":"a"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, but got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	// --- Test Case 3: Keys ending in /copy are set like any other ---
+	if rr := request("/v1/kv/a/copy", `{"value":"v"}`); rr.Code != http.StatusCreated {
+		t.Errorf("expected status %d, but got %d", http.StatusCreated, rr.Code)
+	}
+	if vv, _ := kv.Get("a/copy"); vv.Value != "v" {
+		t.Errorf("expected a/copy to hold v, but got %q", vv.Value)
+	}
+}
+
+func TestSample(t *testing.T) {
+	kv := newMockStore()
+	srv := New(kv, &mockRaft{isLeader: true, store: kv})
+	for i := 0; i < 20; i++ {
+		kv.Set(fmt.Sprintf("user:%02d", i), strings.Repeat("x", i))
+	}
+	kv.Set("order:1", "x")
+	sample := func(target string) (int, v1.SampleResponse) {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		var res v1.SampleResponse
+		json.NewDecoder(rr.Body).Decode(&res)
+		return rr.Code, res
+	}
+
+	// --- Test Case 1: n distinct keys under the prefix, with their sizes ---
+	code, res := sample("/v1/keys/sample?n=5&prefix=user:")
+	if code != http.StatusOK || len(res.Keys) != 5 || res.Matched != 20 {
+		t.Fatalf("expected 5 of 20 keys, but got %d: %+v", code, res)
+	}
+	seen := map[string]bool{}
+	for _, item := range res.Keys {
+		vv, _ := kv.Get(item.Key)
+		if !strings.HasPrefix(item.Key, "user:") || seen[item.Key] || item.Size != len(vv.Value) {
+			t.Errorf("expected a new user key with its size, but got %+v", item)
+		}
+		seen[item.Key] = true
+	}
+
+	// --- Test Case 2: The default sample covers a small prefix ---
+	if _, res := sample("/v1/keys/sample"); len(res.Keys) != 21 || res.Matched != 21 {
+		t.Errorf("expected all 21 keys, but got %d of %d", len(res.Keys), res.Matched)
+	}
+	if code, _ := sample("/v1/keys/sample?n=0"); code != http.StatusBadRequest {
+		t.Errorf("expected status %d, but got %d", http.StatusBadRequest, code)
+	}
+}
+
+func TestKeyspace(t *testing.T) {
+	st := store.NewStore()
+	srv := New(st, &mockRaft{isLeader: true})
+	st.Set("orders/1", strings.Repeat("x", 300))
+	st.Set("orders/2", "x")
+	st.Set("users/1", "x")
+	get := func(target string) (int, v1.KeyspaceResponse) {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		var res v1.KeyspaceResponse
+		json.NewDecoder(rr.Body).Decode(&res)
+		return rr.Code, res
+	}
+
+	// --- Test Case 1: Keys are summarized overall and by prefix ---
+	code, res := get("/v1/admin/keyspace")
+	if code != http.StatusOK || res.Total.Keys != 3 || len(res.Levels) != store.PrefixLevels || len(res.Levels[0].Prefixes) != 2 {
+		t.Fatalf("expected 3 keys under 2 prefixes, but got %d: %+v", code, res)
+	}
+	orders := res.Levels[0].Prefixes[0]
+	if orders.Prefix != "orders/" || orders.Keys != 2 || orders.ValueSizes[0].Keys != 1 || orders.ValueSizes[2] != (v1.ValueSizeBucket{MaxBytes: 1024, Keys: 1}) {
+		t.Errorf("expected orders/ to hold a small and a 300-byte value, but got %+v", orders)
+	}
+	if last := orders.ValueSizes[len(orders.ValueSizes)-1]; last.MaxBytes != 0 {
+		t.Errorf("expected the last bucket to be unbounded, but got %+v", last)
+	}
+
+	// --- Test Case 2: The listing can be narrowed to a prefix ---
+	if _, res := get("/v1/admin/keyspace?prefix=users/"); len(res.Levels[0].Prefixes) != 1 || res.Total.Keys != 3 {
+		t.Errorf("expected only users/ to be listed, but got %+v", res.Levels[0].Prefixes)
+	}
+
+	// --- Test Case 3: Stores without statistics say so ---
+	srv = New(newMockStore(), &mockRaft{isLeader: true})
+	if code, _ := get("/v1/admin/keyspace"); code != http.StatusNotFound {
+		t.Errorf("expected status %d, but got %d", http.StatusNotFound, code)
+	}
+}
+
+// fakeUpstream is an upstream.Loader and upstream.Mirror over a map.
+type fakeUpstream struct {
+	data  map[string]string
+	loads int
+	err   error
+}
+
+func (u *fakeUpstream) Load(ctx context.Context, key string) (string, bool, error) {
+	u.loads++
+	value, ok := u.data[key]
+	return value, ok, u.err
+}
+
+func (u *fakeUpstream) Set(ctx context.Context, key, value string) error {
+	if u.err != nil {
+		return u.err
+	}
+	u.data[key] = value
+	return nil
+}
+
+func (u *fakeUpstream) Delete(ctx context.Context, key string) error {
+	if u.err != nil {
+		return u.err
+	}
+	delete(u.data, key)
+	return nil
+}
+
+func TestReadWriteThrough(t *testing.T) {
+	kv := newMockStore()
+	node := &mockRaft{isLeader: true, store: kv}
+	up := &fakeUpstream{data: map[string]string{"a": "1", "b": "2"}}
+	srv := New(kv, node, WithReadThrough(up, true), WithWriteThrough(up))
+	request := func(method, target, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rr
+	}
+
+	// --- Test Case 1: A miss on the leader is loaded and kept ---
+	rr := request(http.MethodGet, "/v1/kv/a", "")
+	if rr.Code != http.StatusOK || rr.Body.String() != "1\n" || rr.Header().Get("ETag") == "" {
+		t.Errorf("expected 1 with an ETag, but got %d: %q", rr.Code, rr.Body.String())
+	}
+	if vv, ok := kv.Get("a"); !ok || vv.Value != "1" || node.lastCmd.Op != "CAS" {
+		t.Errorf("expected a to be kept, but got %+v (%v)", vv, ok)
+	}
+	request(http.MethodGet, "/v1/kv/a", "")
+	if up.loads != 1 {
+		t.Errorf("expected a hit not to load again, but got %d loads", up.loads)
+	}
+	if rr := request(http.MethodGet, "/v1/kv/missing", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, but got %d", http.StatusNotFound, rr.Code)
+	}
+
+	// --- Test Case 2: Followers serve what they load without keeping it ---
+	node.isLeader = false
+	rr = request(http.MethodGet, "/v1/kv/b", "")
+	if rr.Code != http.StatusOK || rr.Body.String() != "2\n" || rr.Header().Get("ETag") != "" {
+		t.Errorf("expected 2 without an ETag, but got %d: %q (%q)", rr.Code, rr.Body.String(), rr.Header().Get("ETag"))
+	}
+	if _, ok := kv.Get("b"); ok {
+		t.Error("expected a follower not to keep b, but it did")
+	}
+	node.isLeader = true
+
+	// --- Test Case 3: Writes reach the upstream once they commit ---
+	if rr := request(http.MethodPost, "/v1/kv/c", `{"value":"3"}`); rr.Code != http.StatusCreated || up.data["c"] != "3" {
+		t.Errorf("expected c to be written through, but got %d: %v", rr.Code, up.data)
+	}
+	if rr := request(http.MethodDelete, "/v1/kv/a", ""); rr.Code != http.StatusOK || up.data["a"] != "" {
+		t.Errorf("expected a to be deleted upstream, but got %d: %v", rr.Code, up.data)
+	}
+
+	// --- Test Case 4: Writes the store refuses are not written through ---
+	node.quotaErr = fmt.Errorf("%w: namespace %q is full", store.ErrQuotaExceeded, "")
+	if rr := request(http.MethodPost, "/v1/kv/f", `{"value":"5"}`); rr.Code == http.StatusCreated {
+		t.Errorf("expected f to be refused, but got %d", rr.Code)
+	}
+	if _, ok := up.data["f"]; ok {
+		t.Error("expected f not to be written through, but it was")
+	}
+	node.quotaErr = nil
+
+	// --- Test Case 5: Upstream failures fail the request ---
+	up.err = errors.New("connection refused")
+	if rr := request(http.MethodPost, "/v1/kv/d", `{"value":"4"}`); rr.Code != http.StatusBadGateway || !strings.Contains(rr.Body.String(), "committed") {
+		t.Errorf("expected status %d saying d was committed, but got %d: %q", http.StatusBadGateway, rr.Code, rr.Body.String())
+	}
+	if rr := request(http.MethodGet, "/v1/kv/e", ""); rr.Code != http.StatusBadGateway {
+		t.Errorf("expected status %d, but got %d", http.StatusBadGateway, rr.Code)
+	}
+}
+
+func TestProxyReads(t *testing.T) {
+	kv := newMockStore()
+	up := &fakeUpstream{data: map[string]string{"legacy": "1"}}
+	srv := New(kv, &mockRaft{isLeader: true, store: kv}, WithReadThrough(up, false))
+	get := func(target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		return rr
+	}
+
+	// --- Test Case 1: Misses are proxied without being kept ---
+	for i := 0; i < 2; i++ {
+		if rr := get("/v1/kv/legacy"); rr.Code != http.StatusOK || rr.Body.String() != "1\n" {
+			t.Errorf("expected 1, but got %d: %q", rr.Code, rr.Body.String())
+		}
+	}
+	if _, ok := kv.Get("legacy"); ok || up.loads != 2 {
+		t.Errorf("expected legacy to be loaded twice and never kept, but got %d loads (kept %v)", up.loads, ok)
+	}
+
+	// --- Test Case 2: Loads are counted by result ---
+	get("/v1/kv/missing")
+	body := get("/metrics").Body.String()
+	for _, want := range []string{`heliosdb_upstream_loads_total{result="found"} 2`, `heliosdb_upstream_loads_total{result="missing"} 1`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected /metrics to report %s, but it did not", want)
+		}
+	}
+}
+
+func TestStats_LatenciesAndHotKeys(t *testing.T) {
+	kv := newMockStore()
+	srv := New(kv, &mockRaft{isLeader: true, store: kv})
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rr
+	}
+	stats := func(query string) v1.StatsResponse {
+		var res v1.StatsResponse
+		json.NewDecoder(do(http.MethodGet, "/v1/stats"+query, "").Body).Decode(&res)
+		return res
+	}
+	for i := 0; i < 5; i++ {
+		do(http.MethodPost, "/v1/kv/counter", fmt.Sprintf(`{"value":"%d"}`, i))
+		do(http.MethodGet, "/v1/kv/hot", "")
+		do(http.MethodGet, "/v1/kv/hot", "")
+	}
+	do(http.MethodPost, "/v1/kv/other", `{"value":"x"}`)
+	do(http.MethodGet, "/v1/kv/cold", "")
+	do(http.MethodPost, "/v1/kv/other?op=rename", `{"to":"moved"}`)
+
+	// --- Test Case 1: Latencies are reported by op ---
+	res := stats("")
+	ops := map[string]v1.OpLatency{}
+	for _, l := range res.Latencies {
+		ops[l.Op] = l
+	}
+	if ops["GET"].Count != 11 || ops["SET"].Count != 6 || ops["RENAME"].Count != 1 || len(ops) != 3 {
+		t.Errorf("expected 11 GETs, 6 SETs and 1 RENAME, but got %+v", res.Latencies)
+	}
+	if l := ops["GET"]; l.P50Ms <= 0 || l.P50Ms > l.P95Ms || l.P95Ms > l.P99Ms {
+		t.Errorf("expected increasing GET percentiles, but got %+v", l)
+	}
+
+	// --- Test Case 2: The hottest keys come first ---
+	if len(res.HotReads) != 2 || res.HotReads[0] != (v1.HotKey{Key: "hot", Count: 10}) {
+		t.Errorf("expected hot to be read 10 times, but got %+v", res.HotReads)
+	}
+	if len(res.HotWrites) == 0 || res.HotWrites[0] != (v1.HotKey{Key: "counter", Count: 5}) {
+		t.Errorf("expected counter to be written 5 times, but got %+v", res.HotWrites)
+	}
+	if res = stats("?top=1"); len(res.HotReads) != 1 || len(res.HotWrites) != 1 {
+		t.Errorf("expected one key of each, but got %+v and %+v", res.HotReads, res.HotWrites)
+	}
+	if rr := do(http.MethodGet, "/v1/stats?top=many", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, but got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	// --- Test Case 3: A hot key survives far more keys than there are counters ---
+	var h hotKeys
+	for i := 0; i < 10*hotKeyCounters; i++ {
+		h.add(fmt.Sprint("key", i))
+		if i%4 == 0 {
+			h.add("melting")
+		}
+	}
+	top := topKeys([]*opWindow{{}}, func(*opWindow) *hotKeys { return &h }, 1)
+	if len(top) != 1 || top[0].Key != "melting" || top[0].Count < 10*hotKeyCounters/4 || top[0].Count-top[0].Error > 10*hotKeyCounters/4 {
+		t.Errorf("expected melting within its error of %d, but got %+v", 10*hotKeyCounters/4, top)
+	}
+	counted, floor := h.snapshot()
+	var total uint64
+	for _, c := range counted {
+		total += c.count
+		if c.count < floor {
+			t.Errorf("expected no count below the floor of %d, but got %+v", floor, c)
+		}
+	}
+	if want := uint64(10*hotKeyCounters + 10*hotKeyCounters/4); total != want {
+		t.Errorf("expected counts totalling %d, but got %d", want, total)
+	}
+
+	// --- Test Case 4: Percentiles fall in the right buckets ---
+	var hist latencyHistogram
+	for i := 0; i < 99; i++ {
+		hist.observe(100 * time.Microsecond)
+	}
+	hist.observe(time.Second)
+	var counts [latencyBuckets]uint64
+	for i := range counts {
+		counts[i] = hist.counts[i].Load()
+	}
+	if p50 := quantile(&counts, 100, 0.5); p50 < 64*time.Microsecond || p50 > 128*time.Microsecond {
+		t.Errorf("expected a p50 between 64us and 128us, but got %s", p50)
+	}
+	if p99 := quantile(&counts, 100, 0.995); p99 < 512*time.Millisecond {
+		t.Errorf("expected the slowest request at the top, but got %s", p99)
+	}
+}
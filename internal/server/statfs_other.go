@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package server
+
+import "errors"
+
+// volumeSpace is not implemented on this platform; disk usage is reported
+// without the volume's size and free space.
+func volumeSpace(path string) (total, free int64, err error) {
+	return 0, 0, errors.New("volume space is not supported on this platform")
+}
@@ -0,0 +1,15 @@
+//go:build linux || darwin
+
+package server
+
+import "syscall"
+
+// volumeSpace returns the size of the volume holding path and the bytes
+// available on it to unprivileged users.
+func volumeSpace(path string) (total, free int64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+	return int64(st.Blocks) * int64(st.Bsize), int64(st.Bavail) * int64(st.Bsize), nil
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/audit"
+	"github.com/ASHISH26940/heliosdb/internal/stream"
+	"github.com/hashicorp/raft"
+)
+
+// Limits on stream requests.
+const (
+	defaultStreamCount = 10
+	maxStreamCount     = 1000
+	maxStreamEntrySize = 64 << 10 // Entries are copied into the Raft log
+)
+
+// handleStreams serves the stream API:
+//
+//	GET    /streams/{name}                    list entries (?start=, ?end=, ?count=)
+//	POST   /streams/{name}                    append an entry
+//	DELETE /streams/{name}                    delete the stream
+//	GET    /streams/{name}/info               length, IDs and consumer groups
+//	POST   /streams/{name}/groups             create a consumer group
+//	DELETE /streams/{name}/groups/{group}     delete a consumer group
+//	POST   /streams/{name}/groups/{group}/read  deliver entries to a consumer
+//	POST   /streams/{name}/groups/{group}/ack   acknowledge processed entries
+//
+// Reads are served from this node's store. Changes, including reads by a
+// consumer group, which record what was delivered, go through the leader.
+func (s *Server) handleStreams(w http.ResponseWriter, r *http.Request) {
+	name, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/streams/"), "/")
+	if name == "" {
+		http.Error(w, "Stream name is missing", http.StatusBadRequest)
+		return
+	}
+	group, action, _ := strings.Cut(strings.TrimPrefix(rest, "groups/"), "/")
+	var op stream.Op
+	switch {
+	case rest == "" && r.Method == http.MethodGet:
+		s.handleStreamRange(w, r, name)
+		return
+	case rest == "info" && r.Method == http.MethodGet:
+		s.handleStreamInfo(w, name)
+		return
+	case rest == "" && r.Method == http.MethodPost:
+		var req v1.StreamAddRequest
+		if !decodeStreamRequest(w, r, &req) {
+			return
+		}
+		if len(req.Fields) == 0 {
+			http.Error(w, "An entry needs at least one field", http.StatusBadRequest)
+			return
+		}
+		op = stream.Op{Type: stream.OpAdd, Fields: req.Fields, MaxLen: req.MaxLen}
+	case rest == "" && r.Method == http.MethodDelete:
+		op = stream.Op{Type: stream.OpDelete}
+	case rest == "groups" && r.Method == http.MethodPost:
+		var req v1.StreamGroupRequest
+		if !decodeStreamRequest(w, r, &req) {
+			return
+		}
+		op = stream.Op{Type: stream.OpCreateGroup, Group: req.Group, StartID: req.StartID, Latest: req.Latest}
+	case strings.HasPrefix(rest, "groups/") && action == "" && r.Method == http.MethodDelete:
+		op = stream.Op{Type: stream.OpDeleteGroup, Group: group}
+	case strings.HasPrefix(rest, "groups/") && action == "read" && r.Method == http.MethodPost:
+		var req v1.StreamReadRequest
+		if !decodeStreamRequest(w, r, &req) {
+			return
+		}
+		if req.Consumer == "" || req.Count < 0 {
+			http.Error(w, "A consumer is required, and count must not be negative", http.StatusBadRequest)
+			return
+		}
+		count := req.Count
+		if count == 0 {
+			count = defaultStreamCount
+		}
+		op = stream.Op{Type: stream.OpRead, Group: group, Consumer: req.Consumer, Count: min(count, maxStreamCount), MinIdle: req.MinIdleMs, Now: time.Now().UnixMilli()}
+	case strings.HasPrefix(rest, "groups/") && action == "ack" && r.Method == http.MethodPost:
+		var req v1.StreamAckRequest
+		if !decodeStreamRequest(w, r, &req) {
+			return
+		}
+		op = stream.Op{Type: stream.OpAck, Group: group, IDs: req.IDs}
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	if s.raft.State() != raft.Leader {
+		http.Error(w, "Stream changes must be sent to the leader at: "+s.leaderAddr(), http.StatusForbidden)
+		return
+	}
+	op.Stream = name
+	res, err := s.applyStreamOp(op, httpCaller(r))
+	if err != nil {
+		writeStreamError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	switch op.Type {
+	case stream.OpAdd:
+		json.NewEncoder(w).Encode(v1.StreamAddResponse{ID: res.ID})
+	case stream.OpRead:
+		json.NewEncoder(w).Encode(v1.StreamEntriesResponse{Stream: name, Entries: streamEntries(res.Entries)})
+	case stream.OpAck:
+		json.NewEncoder(w).Encode(v1.StreamAckResponse{Acked: res.Acked})
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// applyStreamOp commits op through Raft and returns its result.
+func (s *Server) applyStreamOp(op stream.Op, c caller) (stream.Result, error) {
+	cmd := Command{Op: "STREAM", Stream: &op, RequestID: c.requestID, Principal: s.writer(c)}
+	cmdBytes, err := json.Marshal(cmd)
+	if err != nil {
+		return stream.Result{}, err
+	}
+	resp, err := s.applyCommand(cmd, cmdBytes)
+	if err == nil {
+		if opErr, ok := resp.(error); ok {
+			err = opErr
+		}
+	}
+	s.audited(c, audit.Entry{Op: "STREAM_" + op.Type, Key: op.Stream}, err)
+	res, _ := resp.(stream.Result)
+	return res, err
+}
+
+// handleStreamRange lists the entries of a stream from this node's store.
+func (s *Server) handleStreamRange(w http.ResponseWriter, r *http.Request, name string) {
+	q := r.URL.Query()
+	var bounds [3]uint64
+	for i, param := range []string{"start", "end", "count"} {
+		if v := q.Get(param); v != "" {
+			n, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid "+param, http.StatusBadRequest)
+				return
+			}
+			bounds[i] = n
+		}
+	}
+	count := defaultStreamCount
+	if bounds[2] > 0 {
+		count = int(min(bounds[2], maxStreamCount))
+	}
+	entries, err := stream.Range(streamReader{s.store}, name, bounds[0], bounds[1], count)
+	if err != nil {
+		writeStreamError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v1.StreamEntriesResponse{Stream: name, Entries: streamEntries(entries)})
+}
+
+// handleStreamInfo describes a stream from this node's store.
+func (s *Server) handleStreamInfo(w http.ResponseWriter, name string) {
+	info, err := stream.Describe(streamReader{s.store}, name)
+	if err != nil {
+		writeStreamError(w, err)
+		return
+	}
+	res := v1.StreamInfoResponse{Stream: name, Length: info.Length, FirstID: info.FirstID, LastID: info.LastID, Groups: []v1.StreamGroup{}}
+	for _, g := range info.Groups {
+		group := v1.StreamGroup{Name: g.Name, LastDelivered: g.LastDelivered, Pending: []v1.StreamPending{}}
+		for _, p := range g.Pending {
+			group.Pending = append(group.Pending, v1.StreamPending{ID: p.ID, Consumer: p.Consumer, Deliveries: p.Deliveries, DeliveredAt: time.UnixMilli(p.DeliveredAt).UTC()})
+		}
+		res.Groups = append(res.Groups, group)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// decodeStreamRequest decodes a stream request body into v, writing a 400
+// response if it is invalid, or 413 if it is too large.
+func decodeStreamRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxStreamEntrySize)).Decode(v); err != nil {
+		bodyError(w, err)
+		return false
+	}
+	return true
+}
+
+// writeStreamError maps a stream error to its HTTP status.
+func writeStreamError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, stream.ErrInvalidName):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, stream.ErrNoStream), errors.Is(err, stream.ErrNoGroup):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, stream.ErrGroupExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "Failed to apply stream operation: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// streamEntries converts stream entries to their API form.
+func streamEntries(entries []stream.Entry) []v1.StreamEntry {
+	res := make([]v1.StreamEntry, len(entries))
+	for i, e := range entries {
+		res[i] = v1.StreamEntry{ID: e.ID, Fields: e.Fields, Deliveries: e.Deliveries}
+	}
+	return res
+}
+
+// streamReader reads the plain values of a DataStore for the stream package.
+type streamReader struct {
+	st DataStore
+}
+
+func (r streamReader) Get(key string) (string, bool) {
+	vv, ok := r.st.Get(key)
+	return vv.Value, ok
+}
@@ -0,0 +1,239 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Tenant is a team sharing the cluster. Its callers authenticate with one of
+// its API keys, in the X-API-Key header, and may only touch keys starting
+// with its namespace.
+type Tenant struct {
+	Name              string
+	Namespace         string   // Key prefix, e.g. "payments/"
+	APIKeys           []string // Any of them identifies the tenant
+	RequestsPerSecond float64  // Sustained request rate allowed; 0 is unlimited
+}
+
+// errNoTenant is returned for calls without a known tenant API key.
+var errNoTenant = errors.New("a tenant API key is required in the X-API-Key header")
+
+// tenant is a Tenant with its rate limiter and request counters.
+type tenant struct {
+	name      string
+	namespace string
+	limiter   atomic.Pointer[rate.Limiter] // nil when unlimited
+
+	requests  atomic.Uint64 // Admitted
+	throttled atomic.Uint64 // Refused for exceeding the request rate
+	denied    atomic.Uint64 // Refused for reaching outside the namespace
+}
+
+// WithTenants enables multi-tenant mode: every data-plane request must carry
+// the API key of one of tenants and stay within its namespace, and each
+// tenant's request rate is capped. Cluster and admin endpoints keep their own
+// protections, and clients on the unix socket are not restricted.
+func WithTenants(tenants []Tenant) Option {
+	return func(s *Server) {
+		s.tenants = make(map[[sha256.Size]byte]*tenant)
+		for _, cfg := range tenants {
+			t := &tenant{name: cfg.Name, namespace: cfg.Namespace}
+			setRate(&t.limiter, cfg.RequestsPerSecond)
+			for _, key := range cfg.APIKeys {
+				s.tenants[sha256.Sum256([]byte(key))] = t
+			}
+			s.tenantList = append(s.tenantList, t)
+		}
+	}
+}
+
+// SetTenantRates changes the request rate of each tenant named in rates, in
+// requests per second; 0 is unlimited. Other tenants keep theirs.
+func (s *Server) SetTenantRates(rates map[string]float64) {
+	for _, t := range s.tenantList {
+		if rps, ok := rates[t.name]; ok {
+			setRate(&t.limiter, rps)
+		}
+	}
+}
+
+// setRate caps the limiter in l at requestsPerSecond, with a burst of one
+// second's worth, or removes it if requestsPerSecond is 0 or less. A limiter
+// already in place keeps the tokens it has.
+func setRate(l *atomic.Pointer[rate.Limiter], requestsPerSecond float64) {
+	if requestsPerSecond <= 0 {
+		l.Store(nil)
+		return
+	}
+	limit, burst := rate.Limit(requestsPerSecond), int(math.Ceil(requestsPerSecond))
+	if cur := l.Load(); cur != nil {
+		cur.SetLimit(limit)
+		cur.SetBurst(burst)
+		return
+	}
+	l.Store(rate.NewLimiter(limit, burst))
+}
+
+// allowRate reports whether the limiter in l, if any, admits a request now.
+func allowRate(l *atomic.Pointer[rate.Limiter]) bool {
+	cur := l.Load()
+	return cur == nil || cur.Allow()
+}
+
+// tenantByKey returns the tenant apiKey belongs to, or nil. Keys are looked
+// up by hash, so the time a lookup takes reveals nothing about them.
+func (s *Server) tenantByKey(apiKey string) *tenant {
+	if apiKey == "" {
+		return nil
+	}
+	return s.tenants[sha256.Sum256([]byte(apiKey))]
+}
+
+// owns reports whether key, or every key starting with it, is in t's
+// namespace. A nil tenant owns every key.
+func (t *tenant) owns(key string) bool {
+	return t == nil || strings.HasPrefix(key, t.namespace)
+}
+
+// checkKey fails if key is outside the namespace of c's tenant.
+func (c caller) checkKey(key string) error {
+	if c.tenant.owns(key) {
+		return nil
+	}
+	c.tenant.denied.Add(1)
+	return fmt.Errorf("key %q is outside namespace %q of tenant %s", key, c.tenant.namespace, c.tenant.name)
+}
+
+// tenantKey is the context key of the tenant a request was admitted for.
+type tenantKey struct{}
+
+// requestTenant returns the tenant r was admitted for, or nil.
+func requestTenant(r *http.Request) *tenant {
+	t, _ := r.Context().Value(tenantKey{}).(*tenant)
+	return t
+}
+
+// unixClient reports whether r arrived on the unix socket.
+func unixClient(r *http.Request) bool {
+	local, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	return ok && local.Network() == "unix"
+}
+
+// grpcUnixClient reports whether a gRPC call arrived on the unix socket.
+func grpcUnixClient(ctx context.Context) bool {
+	p, ok := peer.FromContext(ctx)
+	return ok && p.LocalAddr != nil && p.LocalAddr.Network() == "unix"
+}
+
+// admitTenant identifies the tenant of a data-plane request in multi-tenant
+// mode, and refuses the request if it has no tenant, exceeds its tenant's
+// request rate, or names keys outside the tenant's namespace in its URL.
+// Keys in request bodies are checked by the handlers, through the caller.
+func (s *Server) admitTenant(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	if len(s.tenantList) == 0 || unixClient(r) {
+		return r, true
+	}
+	p := cleanPath(r.URL.Path)
+	if !dataPlanePath(p) {
+		return r, true
+	}
+	t := s.tenantByKey(r.Header.Get("X-API-Key"))
+	if t == nil {
+		http.Error(w, errNoTenant.Error(), http.StatusUnauthorized)
+		return r, false
+	}
+	if !allowRate(&t.limiter) {
+		t.throttled.Add(1)
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Tenant "+t.name+" exceeded its request rate", http.StatusTooManyRequests)
+		return r, false
+	}
+	t.requests.Add(1)
+	if err := tenantScope(t, p, r); err != nil {
+		t.denied.Add(1)
+		log.Printf("[%s] TENANT: Refused %s %s for %s: %v", requestID(r), r.Method, r.URL.Path, t.name, err)
+		http.Error(w, "Forbidden: "+err.Error(), http.StatusForbidden)
+		return r, false
+	}
+	return r.WithContext(context.WithValue(r.Context(), tenantKey{}, t)), true
+}
+
+// tenantScope checks the keys and prefixes in the URL of r, whose cleaned
+// path is p, against t's namespace. Endpoints that cannot be confined to a
+// namespace, such as scripts, queries and the change feed, are refused.
+func tenantScope(t *tenant, p string, r *http.Request) error {
+	q := r.URL.Query()
+	var key string
+	switch {
+	case strings.HasPrefix(p, "/kv/"):
+		// The raw path: keys may contain what cleaning would remove.
+		key = strings.TrimPrefix(unversionedPath(r.URL.Path), "/kv/")
+	case p == "/kv", p == "/scan", p == "/aggregate", p == "/keys/sample":
+		key = q.Get("prefix")
+	case p == "/watch", p == "/tx/get", p == "/tx/set", p == "/tx/delete":
+		key = q.Get("key")
+	case strings.HasPrefix(p, "/tx/"):
+		return nil
+	default:
+		return fmt.Errorf("%s is not available to tenants", p)
+	}
+	if !t.owns(key) {
+		return fmt.Errorf("%q is outside namespace %q", key, t.namespace)
+	}
+	return nil
+}
+
+// admitGRPC identifies the caller of a gRPC call and, in multi-tenant mode,
+// its tenant. It refuses the call if it has no tenant, or exceeds its API
+// key's or its tenant's request rate. Calls on the unix socket, like HTTP
+// requests on it, are not restricted.
+func (s *Server) admitGRPC(ctx context.Context) (caller, error) {
+	c := grpcCaller(ctx)
+	if grpcUnixClient(ctx) {
+		return c, nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	var apiKey string
+	if keys := md.Get("x-api-key"); len(keys) > 0 {
+		apiKey = keys[0]
+	}
+	if u := s.meteredKey(apiKey); u != nil && !u.allow() {
+		return c, status.Errorf(codes.ResourceExhausted, "API key %s exceeded its request rate", u.key)
+	}
+	if len(s.tenantList) == 0 {
+		return c, nil
+	}
+	t := s.tenantByKey(apiKey)
+	if t == nil {
+		return c, status.Error(codes.Unauthenticated, errNoTenant.Error())
+	}
+	if !allowRate(&t.limiter) {
+		t.throttled.Add(1)
+		return c, status.Errorf(codes.ResourceExhausted, "tenant %s exceeded its request rate", t.name)
+	}
+	t.requests.Add(1)
+	c.tenant = t
+	return c, nil
+}
+
+// grpcCheckKey is checkKey for gRPC calls.
+func grpcCheckKey(c caller, key string) error {
+	if err := c.checkKey(key); err != nil {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+	"github.com/ASHISH26940/heliosdb/internal/transaction"
+	"github.com/hashicorp/raft"
+)
+
+// handleTx serves the resource-style transaction API under /tx/{id}/...,
+// where keys travel in JSON bodies instead of query parameters, so they may
+// contain slashes or any unicode, and many operations can be staged at once.
+// DELETE /tx/{id} aborts the transaction.
+func (s *Server) handleTx(w http.ResponseWriter, r *http.Request) {
+	txID, action, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/tx/"), "/")
+	if !ok && txID != "" && r.Method == http.MethodDelete {
+		s.abortTx(w, r, txID)
+		return
+	}
+	if !ok || txID == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch action {
+	case "operations":
+		s.handleTxOperations(w, r, txID)
+	case "commit":
+		s.commitTx(w, r, txID)
+	case "savepoint", "rollback":
+		s.handleTxSavepoint(w, r, txID, action)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// abortTx discards the transaction txID, releasing what it staged.
+func (s *Server) abortTx(w http.ResponseWriter, r *http.Request, txID string) {
+	if !s.txm.Abort(txID) {
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleTxOperations stages a batch of reads, writes and deletes in order.
+// The whole batch is checked before anything is staged, so a malformed
+// operation leaves the transaction untouched.
+func (s *Server) handleTxOperations(w http.ResponseWriter, r *http.Request, txID string) {
+	tx, ok := s.txm.Use(txID)
+	if !ok {
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+	defer tx.Release()
+
+	var req v1.TxOperationsRequest
+	if err := decodeBody(r, &req); err != nil {
+		bodyError(w, err)
+		return
+	}
+	for i, op := range req.Operations {
+		if err := validateTxOperation(op); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid operation %d: %v", i, err), http.StatusBadRequest)
+			return
+		}
+		if err := httpCaller(r).checkKey(op.Key); err != nil {
+			http.Error(w, "Forbidden: "+err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+	if err := s.reserveOperations(tx, req.Operations); err != nil {
+		writeTxLimitError(w, err)
+		return
+	}
+
+	writeBody(w, r, http.StatusOK, v1.TxOperationsResponse{Results: s.stageOperations(tx, req.Operations)})
+}
+
+// handleTxSavepoint sets a savepoint in the transaction, or rolls back to
+// one, undoing the writes and deletes staged since.
+func (s *Server) handleTxSavepoint(w http.ResponseWriter, r *http.Request, txID, action string) {
+	tx, ok := s.txm.Use(txID)
+	if !ok {
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+	defer tx.Release()
+	var req v1.TxSavepointRequest
+	if err := decodeBody(r, &req); err != nil {
+		bodyError(w, err)
+		return
+	}
+	if req.Name == "" {
+		http.Error(w, "Invalid request body: a savepoint name is required", http.StatusBadRequest)
+		return
+	}
+
+	if action == "savepoint" {
+		tx.Savepoint(req.Name)
+	} else if err := s.txm.RollbackTo(tx, req.Name); err != nil {
+		http.Error(w, "Savepoint not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// reserveOperations accounts for the writes and deletes among ops in tx's
+// limits before they are staged, so that a batch over a limit stages nothing.
+func (s *Server) reserveOperations(tx *transaction.Transaction, ops []v1.TxOperation) error {
+	writes, size := 0, int64(0)
+	for _, op := range ops {
+		if op.Op != "get" {
+			writes++
+			size += int64(len(op.Key) + len(op.Value))
+		}
+	}
+	return s.txm.Reserve(tx, writes, size)
+}
+
+// writeTxLimitError reports a transaction limit that was reached, or any
+// other error from beginning or staging a transaction.
+func writeTxLimitError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, transaction.ErrWriteSetTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, transaction.ErrTooManyTransactions), errors.Is(err, transaction.ErrStagedBytesExceeded):
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// stageOperations stages already validated operations in tx, in order.
+func (s *Server) stageOperations(tx *transaction.Transaction, ops []v1.TxOperation) []v1.TxOperationResult {
+	results := make([]v1.TxOperationResult, 0, len(ops))
+	for _, op := range ops {
+		result := v1.TxOperationResult{Op: op.Op, Key: op.Key}
+		switch op.Op {
+		case "get":
+			result.Value, result.Found = s.txRead(tx, op.Key)
+		case "set":
+			s.txWrite(tx, op.Key, op.Value, false)
+		case "delete":
+			s.txWrite(tx, op.Key, "", true)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// handleTxExecute commits a whole transaction sent in one request: the
+// versions the client read and the writes and deletes to apply if they are
+// still current. No state is kept between requests, so unlike a transaction
+// begun with /tx/begin, which lives only in the leader's memory, the same
+// payload can be retried against whichever node leads after a failover.
+// Sent with an Idempotency-Key, a retry of a commit that succeeded returns
+// 200 again without being applied twice.
+func (s *Server) handleTxExecute(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req v1.TxExecuteRequest
+	if err := decodeBody(r, &req); err != nil {
+		bodyError(w, err)
+		return
+	}
+
+	c := httpCaller(r)
+	reads := make([]transaction.ReadOp, 0, len(req.Reads))
+	for i, rd := range req.Reads {
+		if rd.Key == "" {
+			http.Error(w, fmt.Sprintf("Invalid read %d: key is missing", i), http.StatusBadRequest)
+			return
+		}
+		if err := c.checkKey(rd.Key); err != nil {
+			http.Error(w, "Forbidden: "+err.Error(), http.StatusForbidden)
+			return
+		}
+		reads = append(reads, transaction.ReadOp{Key: rd.Key, Version: rd.Version})
+	}
+	writes := make([]transaction.WriteOp, 0, len(req.Operations))
+	for i, op := range req.Operations {
+		err := validateTxOperation(op)
+		if err == nil && op.Op == "get" {
+			err = fmt.Errorf("reads are not staged here; list the version read under reads")
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid operation %d: %v", i, err), http.StatusBadRequest)
+			return
+		}
+		if err := c.checkKey(op.Key); err != nil {
+			http.Error(w, "Forbidden: "+err.Error(), http.StatusForbidden)
+			return
+		}
+		writes = append(writes, transaction.WriteOp{Key: op.Key, Value: op.Value, Delete: op.Op == "delete"})
+	}
+	if err := s.txm.CheckWriteSet(len(writes)); err != nil {
+		writeTxLimitError(w, err)
+		return
+	}
+	idem, err := s.txIdempotency(r, c, writes, reads)
+	if err != nil {
+		http.Error(w, "Invalid "+IdempotencyKeyHeader+": "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if s.raft.State() != raft.Leader {
+		s.txm.RecordAbort(transaction.AbortNotLeader)
+		writeCommitResult(w, errNotLeader)
+		return
+	}
+	writeCommitResult(w, s.applyTx(writes, reads, c, idem))
+}
+
+func validateTxOperation(op v1.TxOperation) error {
+	if op.Key == "" {
+		return fmt.Errorf("key is missing")
+	}
+	if store.IsReserved(op.Key) {
+		return errReservedKey
+	}
+	switch op.Op {
+	case "get", "set", "delete":
+		return nil
+	}
+	return fmt.Errorf("unknown op %q (want get, set or delete)", op.Op)
+}
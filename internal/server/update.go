@@ -0,0 +1,77 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/audit"
+	"github.com/ASHISH26940/heliosdb/internal/mutate"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+)
+
+// updateOp is the ?op= that makes a POST to /kv/{key} a read-modify-write.
+const updateOp = "update"
+
+// maxUpdateAttempts bounds how often the leader retries a read-modify-write
+// that lost a race with another writer.
+const maxUpdateAttempts = 10
+
+// handleUpdate atomically applies a declarative mutation to key. The leader
+// reads the current value, computes the new one and proposes it as a CAS
+// against the version it read; if another write got in first, it retries,
+// so clients never need their own retry loop.
+func (s *Server) handleUpdate(w http.ResponseWriter, r *http.Request, key string) {
+	var m mutate.Mutation
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		bodyError(w, err)
+		return
+	}
+
+	for attempt := 1; attempt <= maxUpdateAttempts; attempt++ {
+		current, exists := s.store.Get(key)
+		if !exists {
+			current.Version = 0
+		}
+		value, err := mutate.Apply(m, current.Value, exists)
+		if err != nil {
+			http.Error(w, "Cannot apply update: "+err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+
+		cmd := Command{
+			Op:              "CAS",
+			Key:             key,
+			Value:           value,
+			ExpectedVersion: current.Version,
+			RequestID:       requestID(r),
+			Principal:       s.writer(httpCaller(r)),
+		}
+		cmdBytes, err := json.Marshal(cmd)
+		if err != nil {
+			http.Error(w, "Failed to marshal command", http.StatusInternalServerError)
+			return
+		}
+		resp, err := s.applyCommand(cmd, cmdBytes)
+		if err != nil {
+			s.recordAudit(r, audit.Entry{Op: "UPDATE", Key: key}, err)
+			http.Error(w, "Failed to apply command: "+err.Error(), applyStatus(err))
+			return
+		}
+		if respErr, ok := resp.(error); ok && errors.Is(respErr, store.ErrVersionConflict) {
+			log.Printf("[%s] 'UPDATE' for key '%s' conflicted on attempt %d, retrying", requestID(r), key, attempt)
+			continue
+		}
+
+		s.recordAudit(r, audit.Entry{Op: "UPDATE", Key: key}, nil)
+		log.Printf("[%s] Applied 'UPDATE' (%s) for key '%s' via Raft", requestID(r), m.Op, key)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v1.UpdateResponse{Value: value, Version: current.Version + 1, Attempts: attempt})
+		return
+	}
+
+	s.recordAudit(r, audit.Entry{Op: "UPDATE", Key: key}, store.ErrVersionConflict)
+	http.Error(w, "Update kept conflicting with concurrent writes; try again", http.StatusConflict)
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/ASHISH26940/heliosdb/internal/store"
+	"github.com/ASHISH26940/heliosdb/internal/upstream"
+	"github.com/hashicorp/raft"
+)
+
+// errUpstream is returned when the upstream a node reads or writes through
+// fails, or sends a value the store cannot hold.
+var errUpstream = errors.New("upstream failed")
+
+// WithReadThrough loads keys missing from the store from l. With backfill,
+// the leader keeps what it loads, committing it only if the key is still
+// absent, so that later reads hit on every node; a follower serves it
+// without keeping it. Without backfill, nothing loaded is kept, so the node
+// proxies reads of keys it lacks.
+func WithReadThrough(l upstream.Loader, backfill bool) Option {
+	return func(s *Server) {
+		s.loader = l
+		s.backfill = backfill
+	}
+}
+
+// upstreamLoads counts the keys read through from the upstream, by outcome.
+type upstreamLoads struct {
+	found   atomic.Uint64
+	missing atomic.Uint64
+	failed  atomic.Uint64
+}
+
+// WithWriteThrough sends every SET and DELETE of a single key to m once it
+// commits, in the order the log has them, and fails the request if m fails,
+// although the write stays committed. Other writes, such as updates,
+// renames, transactions, bulk loads and scheduled writes, are not sent, so
+// the keys they write go stale in m.
+func WithWriteThrough(m upstream.Mirror) Option {
+	return func(s *Server) {
+		s.mirror = m
+	}
+}
+
+// readThrough loads key from the upstream after a miss on behalf of c, and
+// keeps it if backfilling and this node is the leader and may write. A
+// value it did not keep has version 0.
+func (s *Server) readThrough(ctx context.Context, key string, c caller) (store.VersionedValue, bool, error) {
+	value, ok, err := s.loader.Load(ctx, key)
+	if err == nil && ok && !utf8.ValidString(value) {
+		err = fmt.Errorf("%s: %w", key, errNotUTF8)
+	}
+	switch {
+	case err != nil:
+		s.upstreamLoads.failed.Add(1)
+		return store.VersionedValue{}, false, fmt.Errorf("%w: %v", errUpstream, err)
+	case !ok:
+		s.upstreamLoads.missing.Add(1)
+		return store.VersionedValue{}, false, nil
+	}
+	s.upstreamLoads.found.Add(1)
+	loaded := store.VersionedValue{Value: value}
+	if _, inMaintenance := s.maintenance(); !s.backfill || s.readOnly || inMaintenance || s.raft.State() != raft.Leader {
+		return loaded, true, nil
+	}
+
+	// Expecting version 0 writes the key only if nothing has since.
+	cmd := Command{Op: "CAS", Key: key, Value: value, RequestID: c.requestID}
+	cmdBytes, err := json.Marshal(cmd)
+	if err != nil {
+		return loaded, true, nil
+	}
+	resp, err := s.applyCommand(cmd, cmdBytes)
+	if err == nil {
+		err, _ = resp.(error)
+	}
+	if err != nil && !errors.Is(err, store.ErrVersionConflict) {
+		log.Printf("[%s] Failed to keep key '%s' read through from upstream: %v", c.requestID, key, err)
+	}
+	if vv, ok := s.store.Get(key); ok {
+		return vv, true, nil
+	}
+	return loaded, true, nil
+}
+
+// mirrorStripes is how many locks the keys written through are spread over.
+const mirrorStripes = 64
+
+// lockMirrored locks key against other writes of it, if it is written
+// through, so that they reach the upstream in the order they commit. It
+// returns the unlock function, or nil if key is not written through.
+func (s *Server) lockMirrored(key string) (unlock func()) {
+	if s.mirror == nil || store.IsReserved(key) {
+		return nil
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	mu := &s.mirrorLocks[h.Sum32()%mirrorStripes]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// writeThrough sends a SET or DELETE of key to the upstream, if there is
+// one to write through to.
+func (s *Server) writeThrough(ctx context.Context, op, key, value string) error {
+	if s.mirror == nil || store.IsReserved(key) {
+		return nil
+	}
+	var err error
+	if op == "DELETE" {
+		err = s.mirror.Delete(ctx, key)
+	} else {
+		err = s.mirror.Set(ctx, key, value)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", errUpstream, err)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/watch"
+)
+
+// RevisionHeader carries the revision a watch started at: the Raft log
+// index of the last change committed before it.
+const RevisionHeader = "X-Revision"
+
+// Page sizes for GET /changes.
+const (
+	defaultChangesLimit = 1000
+	maxChangesLimit     = 10000
+)
+
+// streamCheckInterval is how often a long-lived stream checks whether it
+// must end, as when the node starts draining, so that a drain is not held
+// up by open streams.
+const streamCheckInterval = time.Second
+
+// WithWatchHub serves GET /watch and GET /changes from h, which receives
+// the changes this node applies.
+func WithWatchHub(h *watch.Hub) Option {
+	return func(s *Server) {
+		s.watch = h
+	}
+}
+
+// handleWatch streams committed changes to a key, or to every key under a
+// prefix with prefix=true, as newline-delimited JSON. A client that
+// reconnects with since_revision set to the last revision it received gets
+// the changes it missed first, or 410 Gone if they are no longer buffered.
+// A stream the node cancels ends with a CANCELED line saying why; a client
+// can then resume from its last revision.
+func (s *Server) handleWatch(w http.ResponseWriter, r *http.Request) {
+	key, prefix, since, ok := s.watchParams(w, r)
+	if !ok {
+		return
+	}
+	watcher, err := s.watch.Watch(key, prefix, since)
+	if errors.Is(err, watch.ErrCompacted) {
+		s.writeCompacted(w)
+		return
+	}
+	defer watcher.Close()
+
+	w.Header().Set(RevisionHeader, strconv.FormatUint(watcher.Revision, 10))
+	rc := openStream(w)
+	enc := json.NewEncoder(w)
+	ticker := time.NewTicker(streamCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case e, ok := <-watcher.Events():
+			if !ok {
+				enc.Encode(v1.WatchEvent{Type: "CANCELED", Error: watcher.Err().Error()})
+				return
+			}
+			if err := enc.Encode(watchEvent(e)); err != nil {
+				return
+			}
+			// Send whatever is already buffered in one flush.
+			if len(watcher.Events()) == 0 {
+				rc.Flush()
+			}
+		case <-ticker.C:
+			if s.drain.draining.Load() {
+				enc.Encode(v1.WatchEvent{Type: "CANCELED", Error: "node is draining"})
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// openStream starts a newline-delimited JSON response that outlives the
+// server's write timeout, returning the controller to flush it with.
+func openStream(w http.ResponseWriter) *http.ResponseController {
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+	return rc
+}
+
+// handleChanges returns the buffered changes to a key or prefix after
+// since_revision, oldest first, for change-data-capture consumers that poll
+// rather than hold a stream open. Without since_revision it starts from the
+// oldest change still buffered.
+func (s *Server) handleChanges(w http.ResponseWriter, r *http.Request) {
+	key, prefix, since, ok := s.watchParams(w, r)
+	if !ok {
+		return
+	}
+	limit := defaultChangesLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxChangesLimit)
+	}
+	_, compacted := s.watch.Revision()
+	if !r.URL.Query().Has("since_revision") {
+		since = compacted
+	}
+	events, more, err := s.watch.Changes(key, prefix, since, limit)
+	if errors.Is(err, watch.ErrCompacted) {
+		s.writeCompacted(w)
+		return
+	}
+	res := v1.ChangesResponse{Events: make([]v1.WatchEvent, 0, len(events)), Revision: since, CompactedRevision: compacted, More: more}
+	for _, e := range events {
+		res.Events = append(res.Events, watchEvent(e))
+		res.Revision = e.Revision
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// watchParams parses the key, prefix and since_revision parameters shared
+// by /watch and /changes, writing an error response if they are invalid or
+// watches are disabled.
+func (s *Server) watchParams(w http.ResponseWriter, r *http.Request) (key string, prefix bool, since uint64, ok bool) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return "", false, 0, false
+	}
+	if s.watch == nil {
+		http.Error(w, "Watches are not enabled on this node", http.StatusNotFound)
+		return "", false, 0, false
+	}
+	q := r.URL.Query()
+	key = q.Get("key")
+	prefix = q.Get("prefix") == "true"
+	if key == "" && !prefix {
+		http.Error(w, "key is required unless prefix=true", http.StatusBadRequest)
+		return "", false, 0, false
+	}
+	if v := q.Get("since_revision"); v != "" {
+		var err error
+		if since, err = strconv.ParseUint(v, 10, 64); err != nil {
+			http.Error(w, "Invalid since_revision", http.StatusBadRequest)
+			return "", false, 0, false
+		}
+	}
+	return key, prefix, since, true
+}
+
+// writeCompacted refuses a request for changes no longer buffered.
+func (s *Server) writeCompacted(w http.ResponseWriter) {
+	_, compacted := s.watch.Revision()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusGone)
+	json.NewEncoder(w).Encode(v1.WatchCompactedResponse{Error: "compacted", CompactedRevision: compacted})
+}
+
+// watchEvent converts a change to its API form.
+func watchEvent(e watch.Event) v1.WatchEvent {
+	return v1.WatchEvent{Revision: e.Revision, Type: e.Type, Key: e.Key, Value: e.Value, Version: e.Version, Time: e.Time}
+}
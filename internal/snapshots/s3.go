@@ -0,0 +1,322 @@
+// Package snapshots provides Raft snapshot stores beyond hashicorp/raft's
+// local file store, so that nodes on ephemeral disks or in other regions can
+// recover from snapshots kept in object storage.
+package snapshots
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/hashicorp/raft"
+)
+
+const (
+	metaObject  = "meta.json"
+	stateObject = "state.bin"
+)
+
+// S3Client is the subset of the S3 API the snapshot store uses.
+type S3Client interface {
+	PutObject(ctx context.Context, in *s3.PutObjectInput, opts ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, in *s3.GetObjectInput, opts ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	ListObjectsV2(ctx context.Context, in *s3.ListObjectsV2Input, opts ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	DeleteObject(ctx context.Context, in *s3.DeleteObjectInput, opts ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+}
+
+// S3Options configures an S3Store.
+type S3Options struct {
+	Bucket   string
+	Prefix   string // Key prefix, e.g. "heliosdb/node1/"; a trailing slash is added if missing
+	Region   string // Defaults to the AWS SDK's usual resolution
+	Endpoint string // For S3-compatible services such as MinIO; enables path-style addressing
+	Retain   int    // Snapshots to keep; older ones are deleted after each new one
+	TempDir  string // Where snapshots are staged before upload; defaults to os.TempDir()
+}
+
+// S3Store is a raft.SnapshotStore that keeps snapshots in an S3 bucket. Each
+// snapshot is two objects under <prefix><id>/: the FSM state, and its
+// metadata, which is uploaded last so that a snapshot is only listed once
+// it is complete.
+type S3Store struct {
+	client  S3Client
+	bucket  string
+	prefix  string
+	retain  int
+	tempDir string
+}
+
+// NewS3Store connects to S3 using the default AWS credential chain
+// (environment, shared config, instance role, ...).
+func NewS3Store(ctx context.Context, opts S3Options) (*S3Store, error) {
+	var loadOpts []func(*awsconfig.LoadOptions) error
+	if opts.Region != "" {
+		loadOpts = append(loadOpts, awsconfig.WithRegion(opts.Region))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, loadOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if opts.Endpoint != "" {
+			o.BaseEndpoint = aws.String(opts.Endpoint)
+			o.UsePathStyle = true
+		}
+	})
+	return NewS3StoreWithClient(client, opts)
+}
+
+// NewS3StoreWithClient returns an S3Store that talks to S3 through client.
+func NewS3StoreWithClient(client S3Client, opts S3Options) (*S3Store, error) {
+	if opts.Bucket == "" {
+		return nil, errors.New("s3 snapshot store: bucket is required")
+	}
+	if opts.Retain < 1 {
+		return nil, fmt.Errorf("s3 snapshot store: must retain at least 1 snapshot, got %d", opts.Retain)
+	}
+	prefix := opts.Prefix
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &S3Store{
+		client:  client,
+		bucket:  opts.Bucket,
+		prefix:  prefix,
+		retain:  opts.Retain,
+		tempDir: opts.TempDir,
+	}, nil
+}
+
+func (s *S3Store) key(id, object string) string {
+	return s.prefix + id + "/" + object
+}
+
+// Create starts a new snapshot. Its contents are staged in a temporary file
+// and uploaded when the sink is closed.
+func (s *S3Store) Create(version raft.SnapshotVersion, index, term uint64, configuration raft.Configuration,
+	configurationIndex uint64, trans raft.Transport) (raft.SnapshotSink, error) {
+	if version != 1 {
+		return nil, fmt.Errorf("unsupported snapshot version %d", version)
+	}
+	id := fmt.Sprintf("%d-%d-%d", term, index, time.Now().UnixMilli())
+	file, err := os.CreateTemp(s.tempDir, "heliosdb-snapshot-*")
+	if err != nil {
+		return nil, err
+	}
+	return &s3Sink{
+		store: s,
+		file:  file,
+		meta: raft.SnapshotMeta{
+			Version:            version,
+			ID:                 id,
+			Index:              index,
+			Term:               term,
+			Configuration:      configuration,
+			ConfigurationIndex: configurationIndex,
+		},
+	}, nil
+}
+
+// List returns the retained snapshots, newest first.
+func (s *S3Store) List() ([]*raft.SnapshotMeta, error) {
+	metas, err := s.listAll(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if len(metas) > s.retain {
+		metas = metas[:s.retain]
+	}
+	return metas, nil
+}
+
+// listAll returns the metadata of every complete snapshot, newest first.
+func (s *S3Store) listAll(ctx context.Context) ([]*raft.SnapshotMeta, error) {
+	var metas []*raft.SnapshotMeta
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list snapshots: %w", err)
+		}
+		for _, obj := range page.Contents {
+			key := aws.ToString(obj.Key)
+			if !strings.HasSuffix(key, "/"+metaObject) {
+				continue
+			}
+			id := strings.TrimSuffix(strings.TrimPrefix(key, s.prefix), "/"+metaObject)
+			meta, err := s.readMeta(ctx, id)
+			if err != nil {
+				log.Printf("Snapshot store: skipping snapshot %s with unreadable metadata: %v", id, err)
+				continue
+			}
+			metas = append(metas, meta)
+		}
+	}
+	sort.Slice(metas, func(i, j int) bool {
+		if metas[i].Term != metas[j].Term {
+			return metas[i].Term > metas[j].Term
+		}
+		if metas[i].Index != metas[j].Index {
+			return metas[i].Index > metas[j].Index
+		}
+		return metas[i].ID > metas[j].ID
+	})
+	return metas, nil
+}
+
+func (s *S3Store) readMeta(ctx context.Context, id string) (*raft.SnapshotMeta, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(id, metaObject)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	var meta raft.SnapshotMeta
+	if err := json.NewDecoder(out.Body).Decode(&meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// Open returns the metadata and contents of the snapshot id.
+func (s *S3Store) Open(id string) (*raft.SnapshotMeta, io.ReadCloser, error) {
+	ctx := context.Background()
+	meta, err := s.readMeta(ctx, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read snapshot %s metadata: %w", id, err)
+	}
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(id, stateObject)),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open snapshot %s: %w", id, err)
+	}
+	return meta, out.Body, nil
+}
+
+// reap deletes all but the newest retain snapshots.
+func (s *S3Store) reap(ctx context.Context) error {
+	metas, err := s.listAll(ctx)
+	if err != nil {
+		return err
+	}
+	for i := s.retain; i < len(metas); i++ {
+		// Delete the metadata first, so a half-deleted snapshot is never listed.
+		for _, object := range []string{metaObject, stateObject} {
+			_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+				Bucket: aws.String(s.bucket),
+				Key:    aws.String(s.key(metas[i].ID, object)),
+			})
+			if err != nil {
+				return fmt.Errorf("failed to delete snapshot %s: %w", metas[i].ID, err)
+			}
+		}
+		log.Printf("Snapshot store: reaped snapshot %s", metas[i].ID)
+	}
+	return nil
+}
+
+// s3Sink stages a snapshot in a temporary file until it is closed.
+type s3Sink struct {
+	store *S3Store
+	file  *os.File
+	meta  raft.SnapshotMeta
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// ID returns the ID of the snapshot being written.
+func (s *s3Sink) ID() string {
+	return s.meta.ID
+}
+
+// Write appends p to the staged snapshot.
+func (s *s3Sink) Write(p []byte) (int, error) {
+	return s.file.Write(p)
+}
+
+// Close uploads the snapshot and then deletes snapshots beyond retention.
+func (s *s3Sink) Close() error {
+	if !s.finish() {
+		return nil
+	}
+	defer s.discard()
+	ctx := context.Background()
+
+	size, err := s.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	s.meta.Size = size
+	_, err = s.store.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.store.bucket),
+		Key:           aws.String(s.store.key(s.meta.ID, stateObject)),
+		Body:          s.file,
+		ContentLength: aws.Int64(size),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload snapshot %s: %w", s.meta.ID, err)
+	}
+
+	metaBytes, err := json.Marshal(s.meta)
+	if err != nil {
+		return err
+	}
+	_, err = s.store.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.store.bucket),
+		Key:           aws.String(s.store.key(s.meta.ID, metaObject)),
+		Body:          strings.NewReader(string(metaBytes)),
+		ContentLength: aws.Int64(int64(len(metaBytes))),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload snapshot %s metadata: %w", s.meta.ID, err)
+	}
+	log.Printf("Snapshot store: uploaded snapshot %s (%d bytes) to s3://%s/%s", s.meta.ID, size, s.store.bucket, s.store.prefix)
+
+	return s.store.reap(ctx)
+}
+
+// Cancel abandons the snapshot without uploading it.
+func (s *s3Sink) Cancel() error {
+	if s.finish() {
+		s.discard()
+	}
+	return nil
+}
+
+// finish marks the sink as done, reporting whether it was still open.
+func (s *s3Sink) finish() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.closed = true
+	return true
+}
+
+func (s *s3Sink) discard() {
+	s.file.Close()
+	os.Remove(s.file.Name())
+}
@@ -0,0 +1,127 @@
+// Package snapshots_test contains the unit tests for the snapshots package.
+package snapshots
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/hashicorp/raft"
+)
+
+// fakeS3 is an in-memory S3Client.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: make(map[string][]byte)}
+}
+
+func (f *fakeS3) PutObject(_ context.Context, in *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(in.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects[aws.ToString(in.Key)] = data
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) GetObject(_ context.Context, in *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.objects[aws.ToString(in.Key)]
+	if !ok {
+		return nil, errors.New("NoSuchKey")
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func (f *fakeS3) ListObjectsV2(_ context.Context, in *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var keys []string
+	for k := range f.objects {
+		if strings.HasPrefix(k, aws.ToString(in.Prefix)) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	out := &s3.ListObjectsV2Output{}
+	for _, k := range keys {
+		out.Contents = append(out.Contents, types.Object{Key: aws.String(k)})
+	}
+	return out, nil
+}
+
+func (f *fakeS3) DeleteObject(_ context.Context, in *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.objects, aws.ToString(in.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func TestS3Store(t *testing.T) {
+	client := newFakeS3()
+	store, err := NewS3StoreWithClient(client, S3Options{Bucket: "b", Prefix: "node1", Retain: 2, TempDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	_, trans := raft.NewInmemTransport("")
+	create := func(index uint64, state string) string {
+		sink, err := store.Create(1, index, 1, raft.Configuration{}, 1, trans)
+		if err != nil {
+			t.Fatalf("failed to create snapshot: %v", err)
+		}
+		sink.Write([]byte(state))
+		if err := sink.Close(); err != nil {
+			t.Fatalf("failed to close snapshot: %v", err)
+		}
+		return sink.ID()
+	}
+
+	// --- Test Case 1: A snapshot round-trips ---
+	id := create(10, "state-10")
+	meta, rc, err := store.Open(id)
+	if err != nil {
+		t.Fatalf("failed to open snapshot: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "state-10" || meta.Index != 10 || meta.Size != int64(len(data)) {
+		t.Errorf("unexpected snapshot: meta %+v, data %q", meta, data)
+	}
+
+	// --- Test Case 2: Newest first, older ones reaped ---
+	create(20, "state-20")
+	create(30, "state-30")
+	metas, err := store.List()
+	if err != nil {
+		t.Fatalf("failed to list snapshots: %v", err)
+	}
+	if len(metas) != 2 || metas[0].Index != 30 || metas[1].Index != 20 {
+		t.Errorf("expected snapshots [30 20], but got %d snapshots", len(metas))
+	}
+	if _, ok := client.objects["node1/"+id+"/state.bin"]; ok {
+		t.Error("expected the oldest snapshot to be reaped, but it still exists")
+	}
+
+	// --- Test Case 3: Cancelled snapshots are never uploaded ---
+	sink, _ := store.Create(1, 40, 1, raft.Configuration{}, 1, trans)
+	sink.Write([]byte("partial"))
+	sink.Cancel()
+	if metas, _ := store.List(); metas[0].Index != 30 {
+		t.Errorf("expected the cancelled snapshot to be absent, but got index %d", metas[0].Index)
+	}
+}
@@ -0,0 +1,22 @@
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+// IdempotencyPrefix starts the keys that remember transactions committed
+// with an idempotency key, each followed by a hash of the key and holding
+// an IdempotencyRecord as JSON.
+const IdempotencyPrefix = ReservedPrefix + "idempotency\x00"
+
+// ErrIdempotencyKeyReused is returned for a transaction sent with the
+// idempotency key of an earlier, different transaction.
+var ErrIdempotencyKeyReused = errors.New("idempotency key was already used by a different transaction")
+
+// IdempotencyRecord is kept for a transaction committed with an idempotency
+// key until Expires, so that retries of it are not applied again.
+type IdempotencyRecord struct {
+	Expires time.Time `json:"expires"`
+	Digest  string    `json:"digest"` // Hash of the transaction's reads and writes
+}
@@ -0,0 +1,138 @@
+package store
+
+import (
+	"sort"
+	"strings"
+)
+
+// PrefixDelimiters end the segments of a key that KeyspaceStats groups keys
+// by: "orders/2026/17" is counted under "orders/" and "orders/2026/".
+const PrefixDelimiters = "/:"
+
+// PrefixLevels is how many segments deep KeyspaceStats counts prefixes.
+const PrefixLevels = 2
+
+// maxPrefixesPerLevel bounds how many prefixes are counted separately at
+// each level, so keys like "session:<id>:data" cannot grow the statistics
+// without limit. Keys of prefixes beyond it are counted together, as Other.
+const maxPrefixesPerLevel = 1000
+
+// ValueSizeBounds are the upper bounds, in bytes, of the buckets of
+// PrefixStats.ValueSizes. The last bucket counts the larger values.
+var ValueSizeBounds = [...]int{64, 256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20}
+
+// PrefixStats counts the keys under a prefix.
+type PrefixStats struct {
+	Prefix     string
+	Keys       int64
+	Bytes      int64                           // Of keys and values together
+	ValueSizes [len(ValueSizeBounds) + 1]int64 // Keys by value size; see ValueSizeBounds
+}
+
+// add counts key, holding value, in p, or uncounts it if n is -1.
+func (p *PrefixStats) add(key, value string, n int64) {
+	p.Keys += n
+	p.Bytes += n * entrySize(key, value)
+	p.ValueSizes[sizeBucket(len(value))] += n
+}
+
+// sizeBucket returns the bucket of PrefixStats.ValueSizes that counts
+// values of size bytes.
+func sizeBucket(size int) int {
+	for i, bound := range ValueSizeBounds {
+		if size <= bound {
+			return i
+		}
+	}
+	return len(ValueSizeBounds)
+}
+
+// prefixLevel counts the keys under the prefixes of one level.
+type prefixLevel struct {
+	prefixes map[string]*PrefixStats
+	// Keys whose prefix was not counted separately when they were written.
+	// No new prefixes are counted while any are left, so that every key is
+	// uncounted from where it was counted.
+	other PrefixStats
+}
+
+// keyspace counts the keys of a store, overall and by prefix.
+type keyspace struct {
+	total  PrefixStats
+	levels [PrefixLevels]prefixLevel
+}
+
+// KeyspaceStats is a summary of the keys in a store.
+type KeyspaceStats struct {
+	Total  PrefixStats
+	Levels [PrefixLevels][]PrefixStats // Ordered by prefix
+	Other  [PrefixLevels]PrefixStats   // Keys of prefixes past the limit of each level
+}
+
+// keyPrefixes returns the prefixes of key at each level, ending just after
+// a delimiter, as far as key has them.
+func keyPrefixes(key string) []string {
+	var prefixes []string
+	for i := 0; i < len(key) && len(prefixes) < PrefixLevels; i++ {
+		if strings.IndexByte(PrefixDelimiters, key[i]) >= 0 {
+			prefixes = append(prefixes, key[:i+1])
+		}
+	}
+	return prefixes
+}
+
+// add counts key, holding value, or uncounts it if n is -1.
+func (k *keyspace) add(key, value string, n int64) {
+	if IsReserved(key) {
+		return
+	}
+	k.total.add(key, value, n)
+	for i, prefix := range keyPrefixes(key) {
+		level := &k.levels[i]
+		p, ok := level.prefixes[prefix]
+		if !ok && n > 0 && level.other.Keys == 0 && len(level.prefixes) < maxPrefixesPerLevel {
+			if level.prefixes == nil {
+				level.prefixes = make(map[string]*PrefixStats)
+			}
+			p = &PrefixStats{Prefix: prefix}
+			level.prefixes[prefix] = p
+			ok = true
+		}
+		if !ok {
+			level.other.add(key, value, n)
+			continue
+		}
+		p.add(key, value, n)
+		if p.Keys == 0 {
+			delete(level.prefixes, prefix)
+		}
+	}
+}
+
+// rebuildKeyspaceLocked counts every key again, after the whole store was
+// replaced. The caller must hold s.mu for writing.
+func (s *Store) rebuildKeyspaceLocked() {
+	s.keyspace = keyspace{}
+	for k, v := range s.data {
+		s.keyspace.add(k, v.Value, 1)
+	}
+}
+
+// KeyspaceStats returns how many keys the store holds, and how large they
+// are, overall and by prefix. It is kept up to date as keys are written, so
+// it costs no walk of the keys. Reserved keys are not counted.
+func (s *Store) KeyspaceStats() KeyspaceStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stats := KeyspaceStats{Total: s.keyspace.total}
+	for i, level := range s.keyspace.levels {
+		prefixes := make([]PrefixStats, 0, len(level.prefixes))
+		for _, p := range level.prefixes {
+			prefixes = append(prefixes, *p)
+		}
+		sort.Slice(prefixes, func(a, b int) bool { return prefixes[a].Prefix < prefixes[b].Prefix })
+		stats.Levels[i] = prefixes
+		stats.Other[i] = level.other
+	}
+	return stats
+}
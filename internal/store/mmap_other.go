@@ -0,0 +1,16 @@
+//go:build !linux && !darwin
+
+package store
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile reads f into memory; memory mapping is not implemented on this
+// platform, so segments save no memory here.
+func mapFile(f *os.File, size int) ([]byte, error) {
+	data := make([]byte, size)
+	_, err := io.ReadFull(f, data)
+	return data, err
+}
@@ -0,0 +1,189 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrQuotaExceeded is returned for writes that would take a namespace past
+// its quota. Nothing of the write is applied.
+var ErrQuotaExceeded = errors.New("namespace quota exceeded")
+
+// QuotaPrefix starts the keys of namespace quotas, each followed by the key
+// prefix of the namespace. The value is the Quota in JSON.
+const QuotaPrefix = ReservedPrefix + "quota\x00"
+
+// Quota caps the keys under a namespace's prefix. Zero fields are unlimited.
+type Quota struct {
+	MaxKeys  int64 `json:"max_keys,omitempty"`
+	MaxBytes int64 `json:"max_bytes,omitempty"` // Of keys and values together
+}
+
+// Usage is how much of its quota a namespace uses.
+type Usage struct {
+	Namespace string
+	Quota
+	Keys  int64
+	Bytes int64
+}
+
+// namespaceUsage tracks the keys of a namespace with a quota.
+type namespaceUsage struct {
+	quota Quota
+	keys  int64
+	bytes int64
+}
+
+// entrySize is what a key and its value count against a quota.
+func entrySize(key, value string) int64 {
+	return int64(len(key) + len(value))
+}
+
+// trackLocked accounts for key changing from before (absent unless hadBefore)
+// to after (absent unless hasAfter) in the usage of its namespaces and the
+// keyspace statistics, and reloads the quota of a namespace if key holds it.
+// The caller must hold s.mu for writing, and must already have changed
+// s.data.
+func (s *Store) trackLocked(key string, before string, hadBefore bool, after string, hasAfter bool) {
+	if hadBefore {
+		s.keyspace.add(key, before, -1)
+	}
+	if hasAfter {
+		s.keyspace.add(key, after, 1)
+	}
+	if namespace, ok := strings.CutPrefix(key, QuotaPrefix); ok {
+		s.loadQuotaLocked(namespace)
+		return
+	}
+	for namespace, u := range s.usage {
+		if !strings.HasPrefix(key, namespace) {
+			continue
+		}
+		if hadBefore {
+			u.keys--
+			u.bytes -= entrySize(key, before)
+		}
+		if hasAfter {
+			u.keys++
+			u.bytes += entrySize(key, after)
+		}
+	}
+}
+
+// loadQuotaLocked reads the quota of namespace from its reserved key, and
+// counts the namespace's keys again. The caller must hold s.mu for writing.
+func (s *Store) loadQuotaLocked(namespace string) {
+	vv, ok := s.data[QuotaPrefix+namespace]
+	if !ok {
+		delete(s.usage, namespace)
+		return
+	}
+	var q Quota
+	if err := json.Unmarshal([]byte(vv.Value), &q); err != nil {
+		delete(s.usage, namespace)
+		return
+	}
+	u := &namespaceUsage{quota: q}
+	for k, v := range s.data {
+		if strings.HasPrefix(k, namespace) && !IsReserved(k) {
+			u.keys++
+			u.bytes += entrySize(k, v.Value)
+		}
+	}
+	if s.usage == nil {
+		s.usage = make(map[string]*namespaceUsage)
+	}
+	s.usage[namespace] = u
+}
+
+// rebuildUsageLocked recounts every namespace with a quota, after the whole
+// store was replaced. The caller must hold s.mu for writing.
+func (s *Store) rebuildUsageLocked() {
+	s.usage = nil
+	for k := range s.data {
+		if namespace, ok := strings.CutPrefix(k, QuotaPrefix); ok {
+			s.loadQuotaLocked(namespace)
+		}
+	}
+}
+
+// CheckQuota returns ErrQuotaExceeded if applying ops, in order, would take
+// a namespace over its quota. Writes that do not grow a namespace are always
+// allowed, so a namespace over a quota lowered after the fact can still be
+// cleaned up. Reserved keys count against no quota.
+func (s *Store) CheckQuota(ops []BatchOp) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.usage) == 0 {
+		return nil
+	}
+	// The value each key will have, if the batch writes it more than once.
+	type entry struct {
+		value   string
+		present bool
+	}
+	pending := make(map[string]entry)
+	delta := make(map[string]*namespaceUsage)
+	for _, op := range ops {
+		if IsReserved(op.Key) {
+			continue
+		}
+		before, ok := pending[op.Key]
+		if !ok {
+			vv, present := s.data[op.Key]
+			before = entry{value: vv.Value, present: present}
+		}
+		after := entry{value: op.Value, present: !op.Delete}
+		pending[op.Key] = after
+		for namespace := range s.usage {
+			if !strings.HasPrefix(op.Key, namespace) {
+				continue
+			}
+			d := delta[namespace]
+			if d == nil {
+				d = &namespaceUsage{}
+				delta[namespace] = d
+			}
+			if before.present {
+				d.keys--
+				d.bytes -= entrySize(op.Key, before.value)
+			}
+			if after.present {
+				d.keys++
+				d.bytes += entrySize(op.Key, after.value)
+			}
+		}
+	}
+	// Namespaces are checked in order, so every replica reports the same one.
+	namespaces := make([]string, 0, len(delta))
+	for namespace := range delta {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	for _, namespace := range namespaces {
+		u, d := s.usage[namespace], delta[namespace]
+		if q := u.quota.MaxKeys; q > 0 && d.keys > 0 && u.keys+d.keys > q {
+			return fmt.Errorf("%w: namespace %q would hold %d keys, over its limit of %d", ErrQuotaExceeded, namespace, u.keys+d.keys, q)
+		}
+		if q := u.quota.MaxBytes; q > 0 && d.bytes > 0 && u.bytes+d.bytes > q {
+			return fmt.Errorf("%w: namespace %q would hold %d bytes, over its limit of %d", ErrQuotaExceeded, namespace, u.bytes+d.bytes, q)
+		}
+	}
+	return nil
+}
+
+// NamespaceUsage returns the usage of every namespace with a quota, ordered
+// by namespace.
+func (s *Store) NamespaceUsage() []Usage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Usage, 0, len(s.usage))
+	for namespace, u := range s.usage {
+		out = append(out, Usage{Namespace: namespace, Quota: u.quota, Keys: u.keys, Bytes: u.bytes})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Namespace < out[j].Namespace })
+	return out
+}
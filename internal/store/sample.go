@@ -0,0 +1,40 @@
+package store
+
+import (
+	"math/rand/v2"
+	"sort"
+	"strings"
+)
+
+// SampleKeys returns up to n of the keys starting with prefix, chosen
+// uniformly at random and sorted, and how many keys start with prefix.
+// Reserved keys are never chosen. It copies the keys, but not their values,
+// under the read lock, and matches and samples them once it is released, so
+// writers wait for no more than the copy. Without sorting the keys or
+// copying the values, it is much cheaper than a scan.
+func (s *Store) SampleKeys(prefix string, n int) ([]string, int) {
+	s.mu.RLock()
+	keys := make([]string, 0, len(s.data))
+	for key := range s.data {
+		keys = append(keys, key)
+	}
+	s.mu.RUnlock()
+
+	sample := make([]string, 0, min(n, len(keys)))
+	matched := 0
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) || IsReserved(key) {
+			continue
+		}
+		matched++
+		// Reservoir sampling: the key replaces a sampled one with
+		// probability n/matched, leaving every key equally likely.
+		if len(sample) < n {
+			sample = append(sample, key)
+		} else if i := rand.IntN(matched); i < n {
+			sample[i] = key
+		}
+	}
+	sort.Strings(sample)
+	return sample, matched
+}
@@ -0,0 +1,20 @@
+package store
+
+import "time"
+
+// SchedulePrefix starts the keys of writes scheduled for later, each
+// holding a ScheduledWrite as JSON.
+const SchedulePrefix = ReservedPrefix + "schedule\x00"
+
+// ScheduledWrite is a SET held until the leader applies it at At.
+type ScheduledWrite struct {
+	ID    string    `json:"id"`
+	At    time.Time `json:"at"`
+	Key   string    `json:"key"`
+	Value string    `json:"value"`
+}
+
+// ScheduleKey returns the key holding the scheduled write id.
+func ScheduleKey(id string) string {
+	return SchedulePrefix + id
+}
@@ -0,0 +1,315 @@
+package store
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+	"unsafe"
+)
+
+// segmentMagic starts every segment file.
+const segmentMagic = "HSEG1\n"
+
+// spillChunk bounds how many keys Spill replaces per acquisition of the
+// store's lock, so that writers are not held up by a large spill.
+const spillChunk = 1024
+
+// ErrBadSegment is returned when a segment file is truncated or corrupt.
+var ErrBadSegment = errors.New("store: malformed segment file")
+
+// Segment is an immutable file of keys and values, memory-mapped so that the
+// values can be served from the page cache instead of the Go heap. The
+// kernel pages values in on first read and may drop them again under memory
+// pressure, so mostly-cold data costs little resident memory.
+//
+// Values returned from a segment alias its mapping, which is therefore never
+// unmapped. The file may be removed once it is mapped.
+type Segment struct {
+	path string
+	data []byte
+}
+
+// WriteSegment writes every key of view whose value is at least minValueBytes
+// long to a new segment file at path, and returns the number of keys written.
+// The file is synced and then renamed into place, so a segment is never seen
+// half-written.
+func WriteSegment(path string, view *View, minValueBytes int) (int, error) {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp)
+
+	bw := bufio.NewWriter(f)
+	bw.WriteString(segmentMagic)
+	var buf [binary.MaxVarintLen64]byte
+	n := 0
+	view.Iterate(func(key string, value VersionedValue) bool {
+		if len(value.Value) < minValueBytes {
+			return true
+		}
+		bw.Write(buf[:binary.PutUvarint(buf[:], uint64(len(key)))])
+		bw.WriteString(key)
+		bw.Write(buf[:binary.PutUvarint(buf[:], uint64(len(value.Value)))])
+		bw.WriteString(value.Value)
+		bw.Write(buf[:binary.PutUvarint(buf[:], value.Version)])
+		n++
+		return true
+	})
+	if err := bw.Flush(); err != nil {
+		f.Close()
+		return 0, err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	return n, os.Rename(tmp, path)
+}
+
+// OpenSegment maps the segment file at path into memory.
+func OpenSegment(path string) (*Segment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	data, err := mapFile(f, int(info.Size()))
+	if err != nil {
+		return nil, fmt.Errorf("store: failed to map segment %s: %w", path, err)
+	}
+	if len(data) < len(segmentMagic) || string(data[:len(segmentMagic)]) != segmentMagic {
+		return nil, ErrBadSegment
+	}
+	return &Segment{path: path, data: data}, nil
+}
+
+// Size returns the size of the segment file in bytes.
+func (g *Segment) Size() int {
+	return len(g.data)
+}
+
+// Iterate calls fn for every key in the segment, in ascending key order,
+// until fn returns false. Keys are copied onto the heap; values alias the
+// mapping.
+func (g *Segment) Iterate(fn func(key string, value VersionedValue) bool) error {
+	b := g.data[len(segmentMagic):]
+	for len(b) > 0 {
+		key, rest, ok := readField(b)
+		if !ok {
+			return ErrBadSegment
+		}
+		value, rest, ok := readField(rest)
+		if !ok {
+			return ErrBadSegment
+		}
+		version, n := binary.Uvarint(rest)
+		if n <= 0 {
+			return ErrBadSegment
+		}
+		b = rest[n:]
+		if !fn(string(key), VersionedValue{Value: aliasString(value), Version: version}) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// contains reports whether s points into the segment's mapping.
+func (g *Segment) contains(s string) bool {
+	if len(s) == 0 || len(g.data) == 0 {
+		return false
+	}
+	p := uintptr(unsafe.Pointer(unsafe.StringData(s)))
+	start := uintptr(unsafe.Pointer(&g.data[0]))
+	return p >= start && p < start+uintptr(len(g.data))
+}
+
+// readField splits a length-prefixed field off the front of b.
+func readField(b []byte) (field, rest []byte, ok bool) {
+	l, n := binary.Uvarint(b)
+	if n <= 0 || uint64(len(b)-n) < l {
+		return nil, nil, false
+	}
+	return b[n : n+int(l)], b[n+int(l):], true
+}
+
+// aliasString returns b as a string without copying it. b must never change.
+func aliasString(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	return unsafe.String(&b[0], len(b))
+}
+
+// SpillResult reports what Spill moved out of the heap.
+type SpillResult struct {
+	Keys    int   // Values now served from the new segment
+	Bytes   int64 // Size of the new segment file
+	Retired int   // Segments dropped because they no longer serve any value
+}
+
+// Spill moves values of at least minValueBytes that are still on the heap
+// into a new memory-mapped segment in dir, and serves them from there.
+// Values written while the segment is built stay on the heap.
+//
+// Once more than half of the segments' bytes belong to values that have
+// since been overwritten or deleted, the values still served from them are
+// written into the new segment as well. Segments that no longer serve any
+// value are dropped and their files removed, so the store keeps few
+// segments however often it spills. Their mappings are kept, since values
+// read from them earlier may still be in use, but their pages are never
+// dirty and the kernel reclaims them as it needs.
+func (s *Store) Spill(dir string, minValueBytes int) (SpillResult, error) {
+	var res SpillResult
+	s.spillMu.Lock()
+	defer s.spillMu.Unlock()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return res, err
+	}
+
+	// Only values that are not already mapped are worth writing again,
+	// unless most of the mapped bytes are dead.
+	s.mu.RLock()
+	data := make(map[string]VersionedValue)
+	mapped := make(map[string]VersionedValue)
+	var live, total int64
+	for k, v := range s.data {
+		if s.mapped(v.Value) {
+			mapped[k] = v
+			live += int64(len(v.Value))
+		} else if len(v.Value) >= minValueBytes {
+			data[k] = v
+		}
+	}
+	for _, seg := range s.segments {
+		total += int64(len(seg.data))
+	}
+	s.mu.RUnlock()
+	if live*2 < total {
+		for k, v := range mapped {
+			data[k] = v
+		}
+	}
+	if len(data) == 0 {
+		res.Retired = s.retireSegments()
+		return res, nil
+	}
+
+	path := filepath.Join(dir, strconv.FormatInt(time.Now().UnixNano(), 10)+".seg")
+	if _, err := WriteSegment(path, newView(data, nil), minValueBytes); err != nil {
+		return res, err
+	}
+	seg, err := OpenSegment(path)
+	if err != nil {
+		return res, err
+	}
+	res.Bytes = int64(seg.Size())
+
+	s.mu.Lock()
+	s.segments = append(s.segments, seg)
+	s.mu.Unlock()
+
+	batch := make([]spilled, 0, spillChunk)
+	flush := func() {
+		s.mu.Lock()
+		for _, e := range batch {
+			// A key written since the segment was built keeps its newer value.
+			if current, ok := s.data[e.key]; ok && current.Version == e.value.Version {
+				s.data[e.key] = e.value
+				res.Keys++
+			}
+		}
+		s.mu.Unlock()
+		batch = batch[:0]
+	}
+	err = seg.Iterate(func(key string, value VersionedValue) bool {
+		if batch = append(batch, spilled{key, value}); len(batch) == spillChunk {
+			flush()
+		}
+		return true
+	})
+	flush()
+	res.Retired = s.retireSegments()
+	return res, err
+}
+
+// retireSegments drops the segments that no longer serve any value, removes
+// their files, and returns how many it dropped. The caller must hold
+// s.spillMu: only Spill points values into a segment, so a segment that
+// serves none then never will again.
+func (s *Store) retireSegments() int {
+	s.mu.RLock()
+	refs := make(map[*Segment]int, len(s.segments))
+	for _, v := range s.data {
+		for _, seg := range s.segments {
+			if seg.contains(v.Value) {
+				refs[seg]++
+				break
+			}
+		}
+	}
+	s.mu.RUnlock()
+
+	s.mu.Lock()
+	var dead []*Segment
+	kept := s.segments[:0]
+	for _, seg := range s.segments {
+		if refs[seg] == 0 {
+			dead = append(dead, seg)
+		} else {
+			kept = append(kept, seg)
+		}
+	}
+	s.segments = kept
+	s.mu.Unlock()
+
+	for _, seg := range dead {
+		os.Remove(seg.path)
+	}
+	return len(dead)
+}
+
+// spilled is a key whose value Spill is about to replace.
+type spilled struct {
+	key   string
+	value VersionedValue
+}
+
+// mapped reports whether value is served from one of the store's segments.
+// The caller must hold s.mu.
+func (s *Store) mapped(value string) bool {
+	for _, seg := range s.segments {
+		if seg.contains(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// MappedBytes returns the total size of the values the store serves from
+// memory-mapped segments.
+func (s *Store) MappedBytes() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var n int64
+	for _, v := range s.data {
+		if s.mapped(v.Value) {
+			n += int64(len(v.Value))
+		}
+	}
+	return n
+}
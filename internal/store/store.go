@@ -2,7 +2,62 @@
 // It is designed to be thread-safe for concurrent access.
 package store
 
-import "sync"
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ASHISH26940/heliosdb/internal/failpoint"
+)
+
+// ErrVersionConflict is returned when a conditional write finds that the key
+// has been modified since it was read.
+var ErrVersionConflict = errors.New("version conflict")
+
+// ErrMaintenance is returned for writes applied while the cluster is in
+// maintenance mode.
+var ErrMaintenance = errors.New("cluster is in maintenance mode")
+
+// ErrKeyNotFound is returned for a command that needs a key that does not
+// exist.
+var ErrKeyNotFound = errors.New("key not found")
+
+// ErrKeyExists is returned for a command that would replace a key it was
+// told to leave alone.
+var ErrKeyExists = errors.New("key already exists")
+
+// ErrRangeTooLarge is returned by DeletePrefix when more keys match than it
+// may delete.
+var ErrRangeTooLarge = errors.New("too many keys match")
+
+// ReservedPrefix starts the keys that hold the cluster's own replicated
+// state. Clients cannot write them.
+const ReservedPrefix = "\x00"
+
+// MaintenanceKey is present while the cluster is in maintenance mode. Its
+// value describes why, and is opaque to the store.
+const MaintenanceKey = ReservedPrefix + "maintenance"
+
+// ClusterIDKey holds the ID the cluster was given when it was first
+// bootstrapped. Nodes check it before they exchange Raft traffic or join.
+const ClusterIDKey = ReservedPrefix + "cluster_id"
+
+// JoinTokenPrefix starts the keys of unused one-time join tokens, each
+// followed by the SHA-256 of the token. The value is when it expires.
+const JoinTokenPrefix = ReservedPrefix + "join_token\x00"
+
+// NodeHTTPPrefix starts the keys of the nodes' advertised HTTP addresses,
+// each followed by the node's Raft address, so that any node can point
+// clients at the leader's HTTP API.
+const NodeHTTPPrefix = ReservedPrefix + "node_http\x00"
+
+// IsReserved reports whether key holds cluster state rather than client data.
+func IsReserved(key string) bool {
+	return strings.HasPrefix(key, ReservedPrefix)
+}
 
 // VersionedValue holds the actual value and a version number for concurrency control.
 type VersionedValue struct {
@@ -10,46 +65,303 @@ type VersionedValue struct {
 	Version uint64
 }
 
+// Tombstone records that a key was deleted. While it is kept, the key's
+// version keeps increasing if it is written again, and readers that resume
+// from an old version can tell that the key was deleted rather than never
+// written.
+type Tombstone struct {
+	Version   uint64    // The key's version after the delete
+	DeletedAt time.Time // When this node applied the delete or restored the tombstone; not replicated
+}
+
 // Store is a thread-safe in-memory key-value store.
 // It now stores VersionedValue objects instead of raw strings.
 type Store struct {
-	mu   sync.RWMutex
-	data map[string]VersionedValue
+	mu         sync.RWMutex
+	data       map[string]VersionedValue
+	tombstones map[string]Tombstone       // Deleted keys, until purged by PurgeTombstones
+	usage      map[string]*namespaceUsage // Namespaces with a quota, by key prefix; see CheckQuota
+	keyspace   keyspace                   // See KeyspaceStats
+
+	segments []*Segment // Memory-mapped files some values are served from; see Spill
+	spillMu  sync.Mutex // Held by Spill, so that only one spill changes segments at a time
 }
 
 // NewStore initializes and returns a new empty Store.
 func NewStore() *Store {
 	return &Store{
-		data: make(map[string]VersionedValue),
+		data:       make(map[string]VersionedValue),
+		tombstones: make(map[string]Tombstone),
+	}
+}
+
+// nextVersion returns the version the next write to key gets, continuing
+// from its tombstone if it was deleted. The caller must hold s.mu.
+func (s *Store) nextVersion(key string) uint64 {
+	return max(s.data[key].Version, s.tombstones[key].Version) + 1
+}
+
+// deleteLocked replaces key with a tombstone at version, or at the version
+// after its current one if version is 0. Deleting a key that does not exist
+// changes nothing unless version is given. The caller must hold s.mu.
+func (s *Store) deleteLocked(key string, version uint64, now time.Time) {
+	if version == 0 {
+		current, ok := s.data[key]
+		if !ok {
+			return
+		}
+		version = current.Version + 1
+	}
+	current, ok := s.data[key]
+	delete(s.data, key)
+	s.tombstones[key] = Tombstone{Version: version, DeletedAt: now}
+	if ok {
+		s.trackLocked(key, current.Value, true, "", false)
 	}
 }
 
 // Set adds or updates a key-value pair.
 // Crucially, it increments the version number on every write.
 func (s *Store) Set(key, value string) {
+	failpoint.Inject(failpoint.StoreAccess)
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	// Increment version, even for new keys (starts at version 1).
-	current, _ := s.data[key]
+	current, ok := s.data[key]
 	s.data[key] = VersionedValue{
 		Value:   value,
-		Version: current.Version + 1,
+		Version: s.nextVersion(key),
+	}
+	delete(s.tombstones, key)
+	s.trackLocked(key, current.Value, ok, value, true)
+}
+
+// BatchOp is one write or delete in a batch passed to ApplyBatch.
+type BatchOp struct {
+	Key     string
+	Value   string
+	Delete  bool
+	Version uint64 // If non-zero, installed as is instead of the next version, for deletes too
+}
+
+// ApplyBatch applies ops in order under a single lock acquisition, so that
+// concurrent readers see either none or all of the batch.
+func (s *Store) ApplyBatch(ops []BatchOp) {
+	failpoint.Inject(failpoint.StoreAccess)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, op := range ops {
+		if op.Delete {
+			s.deleteLocked(op.Key, op.Version, now)
+			continue
+		}
+		version := op.Version
+		if version == 0 {
+			version = s.nextVersion(op.Key)
+		}
+		current, ok := s.data[op.Key]
+		s.data[op.Key] = VersionedValue{
+			Value:   op.Value,
+			Version: version,
+		}
+		delete(s.tombstones, op.Key)
+		s.trackLocked(op.Key, current.Value, ok, op.Value, true)
 	}
 }
 
 // Get retrieves a VersionedValue for a given key.
 // It now returns the full struct, not just the string value.
 func (s *Store) Get(key string) (VersionedValue, bool) {
+	failpoint.Inject(failpoint.StoreAccess)
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	value, ok := s.data[key]
 	return value, ok
 }
 
-// Delete removes a key-value pair from the store.
+// Delete removes a key-value pair from the store, leaving a tombstone at the
+// next version.
 func (s *Store) Delete(key string) {
+	failpoint.Inject(failpoint.StoreAccess)
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	delete(s.data, key)
-}
\ No newline at end of file
+	s.deleteLocked(key, 0, time.Now())
+}
+
+// DeletePrefix deletes every key starting with prefix, other than reserved
+// keys, leaving tombstones, and returns the deleted keys in ascending order.
+// If more than limit keys match, it deletes none and returns an error
+// wrapping ErrRangeTooLarge. A limit of 0 or less is unlimited.
+func (s *Store) DeletePrefix(prefix string, limit int) ([]string, error) {
+	failpoint.Inject(failpoint.StoreAccess)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := []string{}
+	for k := range s.data {
+		if strings.HasPrefix(k, prefix) && !IsReserved(k) {
+			keys = append(keys, k)
+		}
+	}
+	if limit > 0 && len(keys) > limit {
+		return nil, fmt.Errorf("%w: %d keys start with %q, over the limit of %d", ErrRangeTooLarge, len(keys), prefix, limit)
+	}
+	sort.Strings(keys)
+	now := time.Now()
+	for _, k := range keys {
+		s.deleteLocked(k, 0, now)
+	}
+	return keys, nil
+}
+
+// Tombstone returns the tombstone of a deleted key, if it has not been purged.
+func (s *Store) Tombstone(key string) (Tombstone, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tombstones[key]
+	return t, ok
+}
+
+// ExpiredTombstones returns the version of every tombstone this node has
+// held since before cutoff, by key.
+func (s *Store) ExpiredTombstones(cutoff time.Time) map[string]uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	expired := make(map[string]uint64)
+	for k, t := range s.tombstones {
+		if t.DeletedAt.Before(cutoff) {
+			expired[k] = t.Version
+		}
+	}
+	return expired
+}
+
+// PurgeTombstones forgets the given tombstones, each only if it is still at
+// the given version, and returns how many it forgot. A purged key's version
+// starts again from 1 if it is written again.
+func (s *Store) PurgeTombstones(versions map[string]uint64) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for k, version := range versions {
+		if t, ok := s.tombstones[k]; ok && t.Version == version {
+			delete(s.tombstones, k)
+			n++
+		}
+	}
+	return n
+}
+
+// Restore replaces the entire contents of the store with data and
+// tombstones, which the store takes ownership of. Tombstones without a
+// DeletedAt are treated as deleted now, so their retention starts again.
+func (s *Store) Restore(data map[string]VersionedValue, tombstones map[string]Tombstone) {
+	if tombstones == nil {
+		tombstones = make(map[string]Tombstone)
+	}
+	now := time.Now()
+	for k, t := range tombstones {
+		if t.DeletedAt.IsZero() {
+			t.DeletedAt = now
+			tombstones[k] = t
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = data
+	s.tombstones = tombstones
+	s.rebuildUsageLocked()
+	s.rebuildKeyspaceLocked()
+}
+
+// View is a consistent, read-only, point-in-time copy of a Store. Later
+// writes to the store are not visible through it.
+type View struct {
+	data map[string]VersionedValue
+	keys []string // Sorted, for deterministic iteration
+
+	tombstones    map[string]Tombstone
+	tombstoneKeys []string // Sorted
+}
+
+// SnapshotView returns a View of the store as it is now. The store is only
+// read-locked while it is copied, so consumers such as snapshots, backups
+// and scans can take as long as they like without blocking writers.
+func (s *Store) SnapshotView() *View {
+	s.mu.RLock()
+	data := make(map[string]VersionedValue, len(s.data))
+	for k, v := range s.data {
+		data[k] = v
+	}
+	tombstones := make(map[string]Tombstone, len(s.tombstones))
+	for k, t := range s.tombstones {
+		tombstones[k] = t
+	}
+	s.mu.RUnlock()
+	return newView(data, tombstones)
+}
+
+// newView returns a View of data and tombstones, which it takes ownership of.
+func newView(data map[string]VersionedValue, tombstones map[string]Tombstone) *View {
+	return &View{data: data, keys: sortedKeys(data), tombstones: tombstones, tombstoneKeys: sortedKeys(tombstones)}
+}
+
+// sortedKeys returns the keys of m in ascending order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Iterate calls fn for every key in a fresh SnapshotView, in ascending key
+// order, until fn returns false. fn may safely call back into the store.
+func (s *Store) Iterate(fn func(key string, value VersionedValue) bool) {
+	s.SnapshotView().Iterate(fn)
+}
+
+// Get retrieves a VersionedValue from the view.
+func (v *View) Get(key string) (VersionedValue, bool) {
+	value, ok := v.data[key]
+	return value, ok
+}
+
+// Len returns the number of keys in the view.
+func (v *View) Len() int {
+	return len(v.keys)
+}
+
+// Iterate calls fn for every key in the view, in ascending key order, until
+// fn returns false.
+func (v *View) Iterate(fn func(key string, value VersionedValue) bool) {
+	for _, k := range v.keys {
+		if !fn(k, v.data[k]) {
+			return
+		}
+	}
+}
+
+// Tombstone returns the tombstone of a key deleted as of the view.
+func (v *View) Tombstone(key string) (Tombstone, bool) {
+	t, ok := v.tombstones[key]
+	return t, ok
+}
+
+// TombstoneCount returns the number of tombstones in the view.
+func (v *View) TombstoneCount() int {
+	return len(v.tombstoneKeys)
+}
+
+// IterateTombstones calls fn for every tombstone in the view, in ascending
+// key order, until fn returns false.
+func (v *View) IterateTombstones(fn func(key string, t Tombstone) bool) {
+	for _, k := range v.tombstoneKeys {
+		if !fn(k, v.tombstones[k]) {
+			return
+		}
+	}
+}
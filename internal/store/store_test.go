@@ -2,9 +2,14 @@
 package store
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 // TestStore_Versioning tests the basic lifecycle and version incrementing.
@@ -78,4 +83,389 @@ func TestStore_Concurrency(t *testing.T) {
 		}(i)
 	}
 	wg.Wait()
-}
\ No newline at end of file
+}
+// TestStore_ApplyBatch tests that a batch is applied in order.
+func TestStore_ApplyBatch(t *testing.T) {
+	s := NewStore()
+	s.Set("a", "old")
+	s.Set("gone", "x")
+
+	// 1. Apply a mixed batch
+	s.ApplyBatch([]BatchOp{
+		{Key: "a", Value: "new"},
+		{Key: "b", Value: "1"},
+		{Key: "b", Value: "2"},
+		{Key: "gone", Delete: true},
+	})
+	if v, _ := s.Get("a"); v.Value != "new" || v.Version != 2 {
+		t.Errorf("expected a=new at version 2, but got %+v", v)
+	}
+	if v, _ := s.Get("b"); v.Value != "2" || v.Version != 2 {
+		t.Errorf("expected b=2 at version 2, but got %+v", v)
+	}
+	if _, ok := s.Get("gone"); ok {
+		t.Error("expected 'gone' to be deleted, but it still exists")
+	}
+}
+
+// TestStore_SnapshotView tests that views are point-in-time and ordered.
+func TestStore_SnapshotView(t *testing.T) {
+	s := NewStore()
+	s.Set("b", "2")
+	s.Set("a", "1")
+	s.Set("c", "3")
+
+	// 1. Take a view, then keep writing
+	view := s.SnapshotView()
+	s.Set("a", "changed")
+	s.Delete("b")
+	s.Set("d", "4")
+
+	if view.Len() != 3 {
+		t.Errorf("expected the view to hold 3 keys, but got %d", view.Len())
+	}
+	if v, _ := view.Get("a"); v.Value != "1" {
+		t.Errorf("expected the view to keep a=1, but got %s", v.Value)
+	}
+	if _, ok := view.Get("d"); ok {
+		t.Error("expected a later write to be invisible to the view, but it was visible")
+	}
+
+	// 2. Iteration is in key order and can stop early
+	var keys []string
+	view.Iterate(func(key string, _ VersionedValue) bool {
+		keys = append(keys, key)
+		return key != "b"
+	})
+	if fmt.Sprint(keys) != "[a b]" {
+		t.Errorf("expected to visit [a b], but got %v", keys)
+	}
+
+	// 3. Store.Iterate lets the callback write without deadlocking
+	count := 0
+	s.Iterate(func(key string, value VersionedValue) bool {
+		s.Set(key+"-copy", value.Value)
+		count++
+		return true
+	})
+	if count != 3 {
+		t.Errorf("expected to visit 3 keys, but got %d", count)
+	}
+}
+
+// TestStore_Spill tests serving large values from a memory-mapped segment.
+func TestStore_Spill(t *testing.T) {
+	dir := t.TempDir()
+	s := NewStore()
+	large := strings.Repeat("x", 100)
+	s.Set("small", "1")
+	s.Set("a", large)
+	s.Set("b", large+"b")
+	s.Set("b", large+"b")
+	s.Set("c", large+"c")
+
+	// --- Test Case 1: Large values move to a segment and read back unchanged ---
+	res, err := s.Spill(dir, 64)
+	if err != nil {
+		t.Fatalf("failed to spill: %v", err)
+	}
+	if res.Keys != 3 || res.Bytes == 0 {
+		t.Errorf("expected 3 keys spilled to a non-empty segment, but got %+v", res)
+	}
+	if vv, _ := s.Get("b"); vv.Value != large+"b" || vv.Version != 2 {
+		t.Errorf("expected b to read back at version 2, but got %+v", vv)
+	}
+	if got, want := s.MappedBytes(), int64(3*len(large)+2); got != want {
+		t.Errorf("expected %d mapped bytes, but got %d", want, got)
+	}
+
+	// --- Test Case 2: Overwritten values go back to the heap ---
+	s.Set("a", large+"new")
+	if got, want := s.MappedBytes(), int64(2*len(large)+2); got != want {
+		t.Errorf("expected %d mapped bytes, but got %d", want, got)
+	}
+
+	// --- Test Case 3: Only values still on the heap are spilled again ---
+	res, err = s.Spill(dir, 64)
+	if err != nil {
+		t.Fatalf("failed to spill: %v", err)
+	}
+	if res.Keys != 1 {
+		t.Errorf("expected 1 key spilled, but got %d", res.Keys)
+	}
+	if vv, _ := s.Get("a"); vv.Value != large+"new" || vv.Version != 2 {
+		t.Errorf("expected a to read back at version 2, but got %+v", vv)
+	}
+
+	// --- Test Case 4: Mostly dead segments are rewritten into one ---
+	s.Set("b", "small")
+	s.Set("c", "small")
+	res, err = s.Spill(dir, 64)
+	if err != nil {
+		t.Fatalf("failed to spill: %v", err)
+	}
+	if res.Keys != 1 || res.Retired != 2 {
+		t.Errorf("expected a rewritten and 2 segments retired, but got %+v", res)
+	}
+	if vv, _ := s.Get("a"); vv.Value != large+"new" {
+		t.Errorf("expected a to read back unchanged, but got %+v", vv)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.seg")); len(files) != 1 {
+		t.Errorf("expected 1 segment file, but got %v", files)
+	}
+
+	// --- Test Case 5: A segment serving nothing is removed ---
+	s.Delete("a")
+	if res, err = s.Spill(dir, 64); err != nil || res.Retired != 1 {
+		t.Errorf("expected 1 segment retired, but got %+v, %v", res, err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.seg")); len(files) != 0 {
+		t.Errorf("expected no segment files, but got %v", files)
+	}
+
+	// --- Test Case 6: A corrupt segment is rejected ---
+	path := filepath.Join(dir, "bad.seg")
+	if err := os.WriteFile(path, []byte("HSEG1\n\x05ab"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	seg, err := OpenSegment(path)
+	if err != nil {
+		t.Fatalf("failed to open segment: %v", err)
+	}
+	if err := seg.Iterate(func(string, VersionedValue) bool { return true }); err != ErrBadSegment {
+		t.Errorf("expected ErrBadSegment, but got %v", err)
+	}
+}
+
+// TestStore_Tombstones tests that deletes are remembered until purged.
+func TestStore_Tombstones(t *testing.T) {
+	s := NewStore()
+	s.Set("a", "1")
+	s.Delete("a")
+
+	// --- Test Case 1: A delete leaves a tombstone at the next version ---
+	if _, ok := s.Get("a"); ok {
+		t.Error("expected a to be deleted, but it still exists")
+	}
+	if ts, ok := s.Tombstone("a"); !ok || ts.Version != 2 {
+		t.Errorf("expected a tombstone at version 2, but got %+v (found %v)", ts, ok)
+	}
+	s.Delete("never-written")
+	if _, ok := s.Tombstone("never-written"); ok {
+		t.Error("expected no tombstone for a key that never existed, but found one")
+	}
+
+	// --- Test Case 2: Views carry tombstones ---
+	view := s.SnapshotView()
+	if view.Len() != 0 || view.TombstoneCount() != 1 {
+		t.Errorf("expected 0 keys and 1 tombstone, but got %d and %d", view.Len(), view.TombstoneCount())
+	}
+
+	// --- Test Case 3: Writing the key again continues its versions ---
+	s.Set("a", "again")
+	if vv, _ := s.Get("a"); vv.Version != 3 {
+		t.Errorf("expected version 3, but got %d", vv.Version)
+	}
+	if _, ok := s.Tombstone("a"); ok {
+		t.Error("expected the tombstone to be gone, but it is still there")
+	}
+
+	// --- Test Case 4: Only expired tombstones at the given version are purged ---
+	s.ApplyBatch([]BatchOp{{Key: "a", Delete: true}, {Key: "b", Delete: true, Version: 7}})
+	if expired := s.ExpiredTombstones(time.Now().Add(-time.Hour)); len(expired) != 0 {
+		t.Errorf("expected no tombstones older than an hour, but got %v", expired)
+	}
+	expired := s.ExpiredTombstones(time.Now().Add(time.Second))
+	if fmt.Sprint(expired) != "map[a:4 b:7]" {
+		t.Errorf("expected a at 4 and b at 7 to expire, but got %v", expired)
+	}
+	if n := s.PurgeTombstones(map[string]uint64{"a": 4, "b": 6}); n != 1 {
+		t.Errorf("expected 1 tombstone purged, but got %d", n)
+	}
+	if _, ok := s.Tombstone("b"); !ok {
+		t.Error("expected b's tombstone at another version to be kept, but it was purged")
+	}
+	s.Set("a", "fresh")
+	if vv, _ := s.Get("a"); vv.Version != 1 {
+		t.Errorf("expected a purged key to start again at version 1, but got %d", vv.Version)
+	}
+}
+
+func TestStore_Quota(t *testing.T) {
+	s := NewStore()
+	s.Set("a/1", "xx")
+	s.Set("b/1", "xx")
+	s.Set(QuotaPrefix+"a/", `{"max_keys":2,"max_bytes":12}`)
+
+	// --- Test Case 1: Existing keys count against a new quota ---
+	usage := s.NamespaceUsage()
+	if len(usage) != 1 || usage[0].Namespace != "a/" || usage[0].Keys != 1 || usage[0].Bytes != 5 || usage[0].MaxKeys != 2 {
+		t.Fatalf("expected a/ to hold 1 key of 5 bytes, but got %+v", usage)
+	}
+
+	// --- Test Case 2: Writes within the quota are allowed, and tracked ---
+	if err := s.CheckQuota([]BatchOp{{Key: "a/2", Value: "x"}}); err != nil {
+		t.Errorf("expected a write within the quota to be allowed, but got %v", err)
+	}
+	s.ApplyBatch([]BatchOp{{Key: "a/2", Value: "x"}})
+	if u := s.NamespaceUsage()[0]; u.Keys != 2 || u.Bytes != 9 {
+		t.Errorf("expected 2 keys of 9 bytes, but got %+v", u)
+	}
+
+	// --- Test Case 3: Writes past either limit are refused ---
+	if err := s.CheckQuota([]BatchOp{{Key: "a/3", Value: ""}}); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected a third key to exceed the quota, but got %v", err)
+	}
+	if err := s.CheckQuota([]BatchOp{{Key: "a/1", Value: "xxxxxx"}}); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected a larger value to exceed the quota, but got %v", err)
+	}
+	if err := s.CheckQuota([]BatchOp{{Key: "a/2", Delete: true}, {Key: "a/3", Value: "y"}}); err != nil {
+		t.Errorf("expected a batch freeing room first to be allowed, but got %v", err)
+	}
+	if err := s.CheckQuota([]BatchOp{{Key: "b/2", Value: "xxxxxxxxxxxxxxxx"}}); err != nil {
+		t.Errorf("expected a namespace without a quota to be unlimited, but got %v", err)
+	}
+
+	// --- Test Case 4: Deletes are tracked, and shrinking is always allowed ---
+	s.Set(QuotaPrefix+"a/", `{"max_keys":1}`)
+	if err := s.CheckQuota([]BatchOp{{Key: "a/1", Value: "x"}}); err != nil {
+		t.Errorf("expected a write that shrinks a namespace over its quota to be allowed, but got %v", err)
+	}
+	s.Delete("a/2")
+	if u := s.NamespaceUsage()[0]; u.Keys != 1 || u.Bytes != 5 {
+		t.Errorf("expected 1 key of 5 bytes, but got %+v", u)
+	}
+
+	// --- Test Case 5: Usage is recounted on restore, and quotas can be removed ---
+	s.Restore(map[string]VersionedValue{"a/9": {Value: "z", Version: 1}, QuotaPrefix + "a/": {Value: `{"max_keys":5}`, Version: 1}}, nil)
+	if u := s.NamespaceUsage(); len(u) != 1 || u[0].Keys != 1 || u[0].MaxKeys != 5 {
+		t.Errorf("expected the restored quota with 1 key, but got %+v", u)
+	}
+	s.Delete(QuotaPrefix + "a/")
+	if u := s.NamespaceUsage(); len(u) != 0 {
+		t.Errorf("expected no quotas, but got %+v", u)
+	}
+}
+
+func TestStore_DeletePrefix(t *testing.T) {
+	s := NewStore()
+	for _, k := range []string{"a/2", "a/1", "b/1", ReservedPrefix + "a/"} {
+		s.Set(k, "x")
+	}
+
+	// --- Test Case 1: Too many matching keys deletes none ---
+	if _, err := s.DeletePrefix("a/", 1); !errors.Is(err, ErrRangeTooLarge) {
+		t.Errorf("expected ErrRangeTooLarge, but got %v", err)
+	}
+	if _, ok := s.Get("a/1"); !ok {
+		t.Error("expected a/1 to be kept, but it is gone")
+	}
+
+	// --- Test Case 2: Matching keys are deleted, in order, with tombstones ---
+	keys, err := s.DeletePrefix("a/", 2)
+	if err != nil || fmt.Sprint(keys) != "[a/1 a/2]" {
+		t.Errorf("expected [a/1 a/2] to be deleted, but got %v (%v)", keys, err)
+	}
+	if ts, ok := s.Tombstone("a/1"); !ok || ts.Version != 2 {
+		t.Errorf("expected a tombstone at version 2, but got %+v (found %v)", ts, ok)
+	}
+	if _, ok := s.Get("b/1"); !ok {
+		t.Error("expected b/1 to be kept, but it is gone")
+	}
+
+	// --- Test Case 3: Reserved keys are never deleted ---
+	if keys, _ := s.DeletePrefix("", 0); fmt.Sprint(keys) != "[b/1]" {
+		t.Errorf("expected only b/1 to be deleted, but got %v", keys)
+	}
+	if _, ok := s.Get(ReservedPrefix + "a/"); !ok {
+		t.Error("expected the reserved key to be kept, but it is gone")
+	}
+}
+
+func TestStore_SampleKeys(t *testing.T) {
+	s := NewStore()
+	for _, k := range []string{"a/1", "a/2", "a/3", "a/4", "b/1", ReservedPrefix + "a/"} {
+		s.Set(k, "x")
+	}
+
+	// --- Test Case 1: A sample larger than the prefix returns all of it ---
+	keys, matched := s.SampleKeys("a/", 10)
+	if fmt.Sprint(keys) != "[a/1 a/2 a/3 a/4]" || matched != 4 {
+		t.Errorf("expected all 4 keys under a/, but got %v of %d", keys, matched)
+	}
+	if keys, matched := s.SampleKeys("", 10); len(keys) != 5 || matched != 5 {
+		t.Errorf("expected the 5 unreserved keys, but got %v of %d", keys, matched)
+	}
+
+	// --- Test Case 2: Every key is about as likely to be sampled ---
+	counts := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		keys, _ := s.SampleKeys("a/", 1)
+		counts[keys[0]]++
+	}
+	for _, k := range []string{"a/1", "a/2", "a/3", "a/4"} {
+		if counts[k] < 700 || counts[k] > 1300 {
+			t.Errorf("expected %s to be sampled about 1000 times, but got %d", k, counts[k])
+		}
+	}
+}
+
+func TestStore_KeyspaceStats(t *testing.T) {
+	s := NewStore()
+	s.Set("orders/2026/1", "x")
+	s.Set("orders/2026/2", strings.Repeat("x", 100))
+	s.Set("orders/2025/1", "x")
+	s.Set("user:1", "x")
+	s.Set("plain", "x")
+	s.Set(ReservedPrefix+"a/", "x")
+
+	// --- Test Case 1: Keys are counted overall and under each prefix ---
+	stats := s.KeyspaceStats()
+	if stats.Total.Keys != 5 || stats.Total.ValueSizes[0] != 4 || stats.Total.ValueSizes[1] != 1 {
+		t.Errorf("expected 5 keys, one of them over 64 bytes, but got %+v", stats.Total)
+	}
+	var level1, level2 []string
+	for _, p := range stats.Levels[0] {
+		level1 = append(level1, fmt.Sprintf("%s=%d", p.Prefix, p.Keys))
+	}
+	for _, p := range stats.Levels[1] {
+		level2 = append(level2, fmt.Sprintf("%s=%d", p.Prefix, p.Keys))
+	}
+	if fmt.Sprint(level1) != "[orders/=3 user:=1]" || fmt.Sprint(level2) != "[orders/2025/=1 orders/2026/=2]" {
+		t.Errorf("expected counts by prefix, but got %v and %v", level1, level2)
+	}
+
+	// --- Test Case 2: Overwrites and deletes are accounted for ---
+	s.Set("orders/2026/2", "x")
+	s.Delete("orders/2025/1")
+	stats = s.KeyspaceStats()
+	if p := stats.Levels[0][0]; p.Keys != 2 || p.Bytes != 2*int64(len("orders/2026/1")+1) {
+		t.Errorf("expected orders/ to hold 2 keys of 14 bytes, but got %+v", p)
+	}
+	if len(stats.Levels[1]) != 1 {
+		t.Errorf("expected empty prefixes to be dropped, but got %+v", stats.Levels[1])
+	}
+
+	// --- Test Case 3: Prefixes past the limit are counted together ---
+	for i := 0; i <= maxPrefixesPerLevel; i++ {
+		s.Set(fmt.Sprintf("p%d/k", i), "x")
+	}
+	stats = s.KeyspaceStats()
+	if len(stats.Levels[0]) != maxPrefixesPerLevel || stats.Other[0].Keys != 3 {
+		t.Errorf("expected %d prefixes and 3 other keys, but got %d and %d", maxPrefixesPerLevel, len(stats.Levels[0]), stats.Other[0].Keys)
+	}
+	for i := 0; i <= maxPrefixesPerLevel; i++ {
+		s.Delete(fmt.Sprintf("p%d/k", i))
+	}
+	s.Delete("user:1")
+	stats = s.KeyspaceStats()
+	if stats.Other[0].Keys != 0 || len(stats.Levels[0]) != 1 || stats.Total.Keys != 3 {
+		t.Errorf("expected every key uncounted where it was counted, but got %+v", stats)
+	}
+
+	// --- Test Case 4: Restoring counts the new contents ---
+	s.Restore(map[string]VersionedValue{"a/1": {Value: "x", Version: 1}}, nil)
+	if stats := s.KeyspaceStats(); stats.Total.Keys != 1 || len(stats.Levels[0]) != 1 || stats.Levels[0][0].Prefix != "a/" {
+		t.Errorf("expected only a/1 to be counted, but got %+v", stats)
+	}
+}
@@ -0,0 +1,361 @@
+// Package stream implements append-only streams with consumer groups, in
+// the style of Redis Streams, on top of the key-value store. A stream's
+// entries, metadata and groups are kept under reserved keys, so they are
+// replicated, snapshotted and compacted like any other data. Every change
+// is a deterministic function of the store's contents and an Op, applied
+// through the Raft log on every replica.
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ASHISH26940/heliosdb/internal/store"
+)
+
+// Op types.
+const (
+	OpAdd         = "ADD"          // Append an entry, creating the stream if needed
+	OpDelete      = "DELETE"       // Delete the stream with its entries and groups
+	OpCreateGroup = "CREATE_GROUP" // Create a consumer group, creating the stream if needed
+	OpDeleteGroup = "DELETE_GROUP" // Delete a consumer group and its pending entries
+	OpRead        = "READ"         // Deliver entries to a consumer of a group
+	OpAck         = "ACK"          // Mark delivered entries as processed
+)
+
+// Errors returned by Apply and the read functions.
+var (
+	ErrInvalidName = errors.New("stream and group names must be non-empty and contain no NUL bytes")
+	ErrNoStream    = errors.New("no such stream")
+	ErrNoGroup     = errors.New("no such consumer group")
+	ErrGroupExists = errors.New("consumer group already exists")
+)
+
+// keyPrefix starts every key holding stream state. Names cannot contain
+// NUL, so the keys of different streams never collide.
+const keyPrefix = store.ReservedPrefix + "stream\x00"
+
+// Op is a change to a stream, carried in a Raft command.
+type Op struct {
+	Type     string            `json:"type"`
+	Stream   string            `json:"stream"`
+	Fields   map[string]string `json:"fields,omitempty"`   // For ADD
+	MaxLen   uint64            `json:"max_len,omitempty"`  // For ADD: trim the oldest entries beyond this many; 0 keeps all
+	Group    string            `json:"group,omitempty"`    // For group ops
+	StartID  uint64            `json:"start_id,omitempty"` // For CREATE_GROUP: deliver the entries after this one
+	Latest   bool              `json:"latest,omitempty"`   // For CREATE_GROUP: deliver only entries added from now on
+	Consumer string            `json:"consumer,omitempty"` // For READ
+	Count    int               `json:"count,omitempty"`    // For READ: most entries to deliver; 0 is no limit
+	MinIdle  int64             `json:"min_idle,omitempty"` // For READ: first redeliver entries pending this many milliseconds; 0 does not
+	IDs      []uint64          `json:"ids,omitempty"`      // For ACK
+	Now      int64             `json:"now,omitempty"`      // For READ: the proposer's clock, in Unix milliseconds
+}
+
+// Entry is one entry of a stream. IDs are assigned in order from 1.
+type Entry struct {
+	ID         uint64
+	Fields     map[string]string
+	Deliveries int // For entries delivered by READ: how many times the group has delivered it
+}
+
+// Result is what applying an Op returns.
+type Result struct {
+	ID      uint64  // For ADD: the new entry's ID
+	Entries []Entry // For READ: the entries delivered
+	Acked   int     // For ACK: how many entries were pending
+}
+
+// Pending is an entry delivered to a consumer and not yet acknowledged.
+type Pending struct {
+	ID          uint64 `json:"id"`
+	Consumer    string `json:"consumer"`
+	Deliveries  int    `json:"deliveries"`
+	DeliveredAt int64  `json:"delivered_at"` // Unix milliseconds
+}
+
+// Group is the state of a consumer group.
+type Group struct {
+	Name          string    `json:"-"`
+	LastDelivered uint64    `json:"last_delivered"`
+	Pending       []Pending `json:"pending,omitempty"` // In ID order
+}
+
+// Info describes a stream.
+type Info struct {
+	Length  uint64
+	FirstID uint64 // 0 when the stream is empty
+	LastID  uint64 // ID of the last entry ever added, even if trimmed since
+	Groups  []Group
+}
+
+// meta is a stream's metadata. Its entries are those from First to Last.
+type meta struct {
+	First  uint64   `json:"first"`
+	Last   uint64   `json:"last"`
+	Groups []string `json:"groups,omitempty"` // Sorted
+}
+
+// Reader reads the store.
+type Reader interface {
+	Get(key string) (string, bool)
+}
+
+func metaKey(name string) string { return keyPrefix + name }
+func entryKey(name string, id uint64) string {
+	return fmt.Sprintf("%s%s\x00e%020d", keyPrefix, name, id)
+}
+func groupKey(name, group string) string { return keyPrefix + name + "\x00g" + group }
+
+// validName reports whether name can be used for a stream or group.
+func validName(name string) bool {
+	return name != "" && !strings.Contains(name, "\x00")
+}
+
+// Apply computes the result of op against the store read through r, and
+// the writes that make it, which the caller must install as one batch.
+func Apply(op Op, r Reader) (Result, []store.BatchOp, error) {
+	if !validName(op.Stream) || (op.Type != OpAdd && op.Type != OpDelete && !validName(op.Group)) {
+		return Result{}, nil, ErrInvalidName
+	}
+	a := applier{r: r, name: op.Stream}
+	m, exists, err := a.meta()
+	if err != nil {
+		return Result{}, nil, err
+	}
+	if !exists {
+		m = meta{First: 1}
+	}
+	var res Result
+	switch op.Type {
+	case OpAdd:
+		m.Last++
+		res.ID = m.Last
+		a.put(entryKey(op.Stream, m.Last), op.Fields)
+		for op.MaxLen > 0 && m.Last-m.First+1 > op.MaxLen {
+			a.del(entryKey(op.Stream, m.First))
+			m.First++
+		}
+	case OpDelete:
+		if !exists {
+			return Result{}, nil, ErrNoStream
+		}
+		for id := m.First; id <= m.Last; id++ {
+			a.del(entryKey(op.Stream, id))
+		}
+		for _, g := range m.Groups {
+			a.del(groupKey(op.Stream, g))
+		}
+		a.del(metaKey(op.Stream))
+		return res, a.ops, nil
+	case OpCreateGroup:
+		if _, ok := slices.BinarySearch(m.Groups, op.Group); ok {
+			return Result{}, nil, ErrGroupExists
+		}
+		g := Group{LastDelivered: min(op.StartID, m.Last)}
+		if op.Latest {
+			g.LastDelivered = m.Last
+		}
+		i, _ := slices.BinarySearch(m.Groups, op.Group)
+		m.Groups = slices.Insert(m.Groups, i, op.Group)
+		a.put(groupKey(op.Stream, op.Group), g)
+	case OpDeleteGroup:
+		i, ok := slices.BinarySearch(m.Groups, op.Group)
+		if !exists || !ok {
+			return Result{}, nil, ErrNoGroup
+		}
+		m.Groups = slices.Delete(m.Groups, i, i+1)
+		a.del(groupKey(op.Stream, op.Group))
+	case OpRead, OpAck:
+		if !exists {
+			return Result{}, nil, ErrNoStream
+		}
+		g, err := a.group(op.Group)
+		if err != nil {
+			return Result{}, nil, err
+		}
+		if op.Type == OpRead {
+			res.Entries, err = a.read(&g, m, op)
+		} else {
+			res.Acked = ack(&g, op.IDs)
+		}
+		if err != nil {
+			return Result{}, nil, err
+		}
+		a.put(groupKey(op.Stream, op.Group), g)
+		return res, a.ops, nil
+	default:
+		return Result{}, nil, fmt.Errorf("unknown stream op %q", op.Type)
+	}
+	a.put(metaKey(op.Stream), m)
+	return res, a.ops, nil
+}
+
+// applier reads one stream's state and collects the writes of an Op.
+type applier struct {
+	r    Reader
+	name string
+	ops  []store.BatchOp
+}
+
+func (a *applier) put(key string, v any) {
+	b, _ := json.Marshal(v)
+	a.ops = append(a.ops, store.BatchOp{Key: key, Value: string(b)})
+}
+
+func (a *applier) del(key string) {
+	a.ops = append(a.ops, store.BatchOp{Key: key, Delete: true})
+}
+
+func (a *applier) meta() (meta, bool, error) {
+	var m meta
+	ok, err := get(a.r, metaKey(a.name), &m)
+	return m, ok, err
+}
+
+func (a *applier) group(name string) (Group, error) {
+	var g Group
+	ok, err := get(a.r, groupKey(a.name, name), &g)
+	if err == nil && !ok {
+		err = ErrNoGroup
+	}
+	g.Name = name
+	return g, err
+}
+
+// read delivers entries to op.Consumer: first pending entries idle for at
+// least op.MinIdle, whose consumers are presumed to have failed, then
+// entries never delivered to the group.
+func (a *applier) read(g *Group, m meta, op Op) ([]Entry, error) {
+	var entries []Entry
+	full := func() bool { return op.Count > 0 && len(entries) >= op.Count }
+	if op.MinIdle > 0 {
+		kept := g.Pending[:0]
+		for _, p := range g.Pending {
+			if full() || op.Now-p.DeliveredAt < op.MinIdle {
+				kept = append(kept, p)
+				continue
+			}
+			e, ok, err := a.entry(p.ID)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				// Trimmed while pending; there is nothing left to deliver.
+				continue
+			}
+			p.Consumer, p.Deliveries, p.DeliveredAt = op.Consumer, p.Deliveries+1, op.Now
+			e.Deliveries = p.Deliveries
+			entries = append(entries, e)
+			kept = append(kept, p)
+		}
+		g.Pending = kept
+	}
+	for id := max(g.LastDelivered+1, m.First); id <= m.Last && !full(); id++ {
+		e, ok, err := a.entry(id)
+		if err != nil {
+			return nil, err
+		}
+		g.LastDelivered = id
+		if !ok {
+			continue
+		}
+		e.Deliveries = 1
+		entries = append(entries, e)
+		g.Pending = append(g.Pending, Pending{ID: id, Consumer: op.Consumer, Deliveries: 1, DeliveredAt: op.Now})
+	}
+	// Entries trimmed before the group saw them are skipped.
+	g.LastDelivered = max(g.LastDelivered, m.First-1)
+	return entries, nil
+}
+
+// ack removes ids from g's pending entries, returning how many were there.
+func ack(g *Group, ids []uint64) int {
+	n := 0
+	g.Pending = slices.DeleteFunc(g.Pending, func(p Pending) bool {
+		if slices.Contains(ids, p.ID) {
+			n++
+			return true
+		}
+		return false
+	})
+	return n
+}
+
+func (a *applier) entry(id uint64) (Entry, bool, error) {
+	e := Entry{ID: id}
+	ok, err := get(a.r, entryKey(a.name, id), &e.Fields)
+	return e, ok, err
+}
+
+// get decodes the JSON value of key into v, reporting whether it exists.
+func get(r Reader, key string, v any) (bool, error) {
+	value, ok := r.Get(key)
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal([]byte(value), v); err != nil {
+		return false, fmt.Errorf("corrupt stream state at %q: %w", key, err)
+	}
+	return true, nil
+}
+
+// Range returns up to count entries of stream name with IDs from start to
+// end inclusive, in order. An end of 0 means the last entry, and a count
+// of 0 no limit.
+func Range(r Reader, name string, start, end uint64, count int) ([]Entry, error) {
+	if !validName(name) {
+		return nil, ErrInvalidName
+	}
+	a := applier{r: r, name: name}
+	m, ok, err := a.meta()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNoStream
+	}
+	if end == 0 || end > m.Last {
+		end = m.Last
+	}
+	entries := []Entry{}
+	for id := max(start, m.First); id <= end && (count <= 0 || len(entries) < count); id++ {
+		e, ok, err := a.entry(id)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// Describe returns the length, IDs and consumer groups of stream name.
+func Describe(r Reader, name string) (Info, error) {
+	if !validName(name) {
+		return Info{}, ErrInvalidName
+	}
+	a := applier{r: r, name: name}
+	m, ok, err := a.meta()
+	if err != nil {
+		return Info{}, err
+	}
+	if !ok {
+		return Info{}, ErrNoStream
+	}
+	info := Info{LastID: m.Last, Groups: []Group{}}
+	if m.Last >= m.First {
+		info.Length, info.FirstID = m.Last-m.First+1, m.First
+	}
+	for _, name := range m.Groups {
+		g, err := a.group(name)
+		if err != nil {
+			return Info{}, err
+		}
+		info.Groups = append(info.Groups, g)
+	}
+	return info, nil
+}
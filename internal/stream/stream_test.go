@@ -0,0 +1,119 @@
+// Package stream_test contains the unit tests for the stream package.
+package stream
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ASHISH26940/heliosdb/internal/store"
+)
+
+// mapStore is a Reader over a map, to which Apply's writes are installed.
+type mapStore map[string]string
+
+func (m mapStore) Get(key string) (string, bool) {
+	v, ok := m[key]
+	return v, ok
+}
+
+// apply applies op to m, installing its writes.
+func (m mapStore) apply(t *testing.T, op Op) (Result, error) {
+	t.Helper()
+	res, ops, err := Apply(op, m)
+	if err != nil {
+		if len(ops) > 0 {
+			t.Errorf("expected no writes from a failed %s, but got %d", op.Type, len(ops))
+		}
+		return res, err
+	}
+	for _, o := range ops {
+		if !store.IsReserved(o.Key) {
+			t.Fatalf("expected stream state in reserved keys, but got %q", o.Key)
+		}
+		if o.Delete {
+			delete(m, o.Key)
+		} else {
+			m[o.Key] = o.Value
+		}
+	}
+	return res, nil
+}
+
+func TestStream(t *testing.T) {
+	m := mapStore{}
+	for i := range 5 {
+		res, err := m.apply(t, Op{Type: OpAdd, Stream: "jobs", Fields: map[string]string{"n": string(rune('a' + i))}, MaxLen: 4})
+		if err != nil || res.ID != uint64(i+1) {
+			t.Fatalf("expected entry %d, but got %d (%v)", i+1, res.ID, err)
+		}
+	}
+
+	// --- Test Case 1: Entries are kept in order, trimmed to the maximum length ---
+	entries, err := Range(m, "jobs", 0, 0, 0)
+	if err != nil || len(entries) != 4 || entries[0].ID != 2 || entries[3].Fields["n"] != "e" {
+		t.Errorf("expected entries 2 to 5, but got %+v (%v)", entries, err)
+	}
+	if entries, _ := Range(m, "jobs", 3, 4, 0); len(entries) != 2 || entries[0].ID != 3 {
+		t.Errorf("expected entries 3 and 4, but got %+v", entries)
+	}
+	if _, err := Range(m, "missing", 0, 0, 0); !errors.Is(err, ErrNoStream) {
+		t.Errorf("expected ErrNoStream, but got %v", err)
+	}
+
+	// --- Test Case 2: A group delivers each entry to one consumer ---
+	if _, err := m.apply(t, Op{Type: OpCreateGroup, Stream: "jobs", Group: "workers"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.apply(t, Op{Type: OpCreateGroup, Stream: "jobs", Group: "workers"}); !errors.Is(err, ErrGroupExists) {
+		t.Errorf("expected ErrGroupExists, but got %v", err)
+	}
+	res, _ := m.apply(t, Op{Type: OpRead, Stream: "jobs", Group: "workers", Consumer: "w1", Count: 3, Now: 1000})
+	if len(res.Entries) != 3 || res.Entries[0].ID != 2 {
+		t.Errorf("expected entries 2 to 4 for w1, but got %+v", res.Entries)
+	}
+	res, _ = m.apply(t, Op{Type: OpRead, Stream: "jobs", Group: "workers", Consumer: "w2", Count: 3, Now: 1000})
+	if len(res.Entries) != 1 || res.Entries[0].ID != 5 {
+		t.Errorf("expected entry 5 for w2, but got %+v", res.Entries)
+	}
+
+	// --- Test Case 3: Acknowledged entries stop being pending ---
+	res, _ = m.apply(t, Op{Type: OpAck, Stream: "jobs", Group: "workers", IDs: []uint64{2, 5, 99}})
+	if res.Acked != 2 {
+		t.Errorf("expected 2 entries acknowledged, but got %d", res.Acked)
+	}
+	info, err := Describe(m, "jobs")
+	if err != nil || info.Length != 4 || info.FirstID != 2 || info.LastID != 5 || len(info.Groups) != 1 {
+		t.Fatalf("expected 4 entries and 1 group, but got %+v (%v)", info, err)
+	}
+	if g := info.Groups[0]; g.Name != "workers" || g.LastDelivered != 5 || len(g.Pending) != 2 || g.Pending[0].ID != 3 || g.Pending[0].Consumer != "w1" {
+		t.Errorf("expected entries 3 and 4 pending for w1, but got %+v", g)
+	}
+
+	// --- Test Case 4: Entries left pending too long are redelivered ---
+	res, _ = m.apply(t, Op{Type: OpRead, Stream: "jobs", Group: "workers", Consumer: "w2", MinIdle: 500, Now: 1200})
+	if len(res.Entries) != 0 {
+		t.Errorf("expected nothing to redeliver yet, but got %+v", res.Entries)
+	}
+	res, _ = m.apply(t, Op{Type: OpRead, Stream: "jobs", Group: "workers", Consumer: "w2", Count: 1, MinIdle: 500, Now: 1600})
+	if len(res.Entries) != 1 || res.Entries[0].ID != 3 || res.Entries[0].Deliveries != 2 {
+		t.Errorf("expected entry 3 redelivered, but got %+v", res.Entries)
+	}
+	info, _ = Describe(m, "jobs")
+	if p := info.Groups[0].Pending[0]; p.Consumer != "w2" || p.DeliveredAt != 1600 {
+		t.Errorf("expected entry 3 pending for w2, but got %+v", p)
+	}
+
+	// --- Test Case 5: Deleting the stream removes all of its state ---
+	if _, err := m.apply(t, Op{Type: OpDelete, Stream: "jobs"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 0 {
+		t.Errorf("expected no keys left, but got %d", len(m))
+	}
+	if _, err := m.apply(t, Op{Type: OpRead, Stream: "jobs", Group: "workers", Consumer: "w1"}); !errors.Is(err, ErrNoStream) {
+		t.Errorf("expected ErrNoStream, but got %v", err)
+	}
+	if _, err := m.apply(t, Op{Type: OpAdd, Stream: "a\x00b", Fields: map[string]string{"k": "v"}}); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("expected ErrInvalidName, but got %v", err)
+	}
+}
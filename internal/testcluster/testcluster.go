@@ -0,0 +1,293 @@
+// Package testcluster runs a multi-node HeliosDB cluster inside a single test
+// process. Nodes use real FSMs, stores and HTTP servers, but talk Raft over
+// in-memory transports, so membership changes, partitions and failover can
+// be tested without docker or real ports for Raft.
+package testcluster
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ASHISH26940/heliosdb/internal/persistence"
+	internal_raft "github.com/ASHISH26940/heliosdb/internal/raft"
+	"github.com/ASHISH26940/heliosdb/internal/server"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+	"github.com/hashicorp/raft"
+)
+
+// defaultTimeout bounds how long the helpers wait for the cluster to converge.
+const defaultTimeout = 10 * time.Second
+
+// Node is one member of a test cluster.
+type Node struct {
+	ID        string
+	Store     *store.Store
+	Raft      *raft.Raft
+	Server    *server.Server
+	HTTP      *httptest.Server // Serves Server; its URL is the node's endpoint
+	Transport *raft.InmemTransport
+
+	wal     *persistence.WAL
+	stopped bool
+}
+
+// Addr returns the node's Raft address.
+func (n *Node) Addr() raft.ServerAddress {
+	return n.Transport.LocalAddr()
+}
+
+// URL returns the base URL of the node's HTTP API.
+func (n *Node) URL() string {
+	return n.HTTP.URL
+}
+
+// Cluster is a set of nodes started by New.
+type Cluster struct {
+	t       testing.TB
+	Nodes   []*Node
+	opts    []server.Option
+	nextID  int
+	timeout time.Duration
+}
+
+// Option configures a Cluster.
+type Option func(*Cluster)
+
+// WithServerOptions passes opts to every node's server.New.
+func WithServerOptions(opts ...server.Option) Option {
+	return func(c *Cluster) {
+		c.opts = append(c.opts, opts...)
+	}
+}
+
+// WithTimeout changes how long the helpers wait for the cluster to converge.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Cluster) {
+		c.timeout = d
+	}
+}
+
+// New starts a cluster of n voters and waits until it has a leader. The
+// cluster is shut down when the test finishes.
+func New(t testing.TB, n int, opts ...Option) *Cluster {
+	t.Helper()
+	c := &Cluster{t: t, timeout: defaultTimeout}
+	for _, opt := range opts {
+		opt(c)
+	}
+	t.Cleanup(c.Shutdown)
+
+	var servers []raft.Server
+	for i := 0; i < n; i++ {
+		node := c.startNode()
+		servers = append(servers, raft.Server{ID: raft.ServerID(node.ID), Address: node.Addr()})
+	}
+	if err := c.Nodes[0].Raft.BootstrapCluster(raft.Configuration{Servers: servers}).Error(); err != nil {
+		t.Fatalf("testcluster: failed to bootstrap: %v", err)
+	}
+	c.Leader()
+	return c
+}
+
+// startNode creates a node, connects it to every other node and starts serving.
+func (c *Cluster) startNode() *Node {
+	c.t.Helper()
+	c.nextID++
+	id := fmt.Sprintf("node%d", c.nextID)
+
+	st := store.NewStore()
+	wal, err := persistence.NewWAL(filepath.Join(c.t.TempDir(), "app.wal"))
+	if err != nil {
+		c.t.Fatalf("testcluster: failed to open WAL for %s: %v", id, err)
+	}
+	fsm := internal_raft.NewFSM(st, wal)
+
+	cfg := raft.DefaultConfig()
+	cfg.LocalID = raft.ServerID(id)
+	cfg.HeartbeatTimeout = 50 * time.Millisecond
+	cfg.ElectionTimeout = 50 * time.Millisecond
+	cfg.LeaderLeaseTimeout = 50 * time.Millisecond
+	cfg.CommitTimeout = 5 * time.Millisecond
+	cfg.LogOutput = io.Discard
+
+	_, transport := raft.NewInmemTransport(raft.ServerAddress(id))
+	logs := raft.NewInmemStore()
+	r, err := raft.NewRaft(cfg, fsm, logs, logs, raft.NewInmemSnapshotStore(), transport)
+	if err != nil {
+		c.t.Fatalf("testcluster: failed to start raft for %s: %v", id, err)
+	}
+
+	srv := server.New(st, r, c.opts...)
+	node := &Node{
+		ID:        id,
+		Store:     st,
+		Raft:      r,
+		Server:    srv,
+		HTTP:      httptest.NewServer(srv),
+		Transport: transport,
+		wal:       wal,
+	}
+	for _, other := range c.Nodes {
+		c.connect(node, other)
+	}
+	c.Nodes = append(c.Nodes, node)
+	return node
+}
+
+func (c *Cluster) connect(a, b *Node) {
+	a.Transport.Connect(b.Addr(), b.Transport)
+	b.Transport.Connect(a.Addr(), a.Transport)
+}
+
+// Endpoints returns the HTTP URLs of the running nodes.
+func (c *Cluster) Endpoints() []string {
+	var urls []string
+	for _, n := range c.Nodes {
+		if !n.stopped {
+			urls = append(urls, n.URL())
+		}
+	}
+	return urls
+}
+
+// Leader waits until exactly one running node considers itself leader and
+// returns it.
+func (c *Cluster) Leader() *Node {
+	c.t.Helper()
+	var leader *Node
+	c.WaitFor("a single leader", func() bool {
+		leader = nil
+		for _, n := range c.Nodes {
+			if n.stopped || n.Raft.State() != raft.Leader {
+				continue
+			}
+			if leader != nil {
+				return false
+			}
+			leader = n
+		}
+		return leader != nil
+	})
+	return leader
+}
+
+// Followers returns the running nodes other than the current leader.
+func (c *Cluster) Followers() []*Node {
+	c.t.Helper()
+	leader := c.Leader()
+	var followers []*Node
+	for _, n := range c.Nodes {
+		if n != leader && !n.stopped {
+			followers = append(followers, n)
+		}
+	}
+	return followers
+}
+
+// AddNode starts a new node and adds it to the cluster as a voter through
+// the leader's /v1/join endpoint, as an operator would.
+func (c *Cluster) AddNode() *Node {
+	c.t.Helper()
+	node := c.startNode()
+	leader := c.Leader()
+	body := fmt.Sprintf(`{"node_id":%q,"addr":%q}`, node.ID, node.Addr())
+	resp, err := leader.HTTP.Client().Post(leader.URL()+"/v1/join", "application/json", strings.NewReader(body))
+	if err != nil {
+		c.t.Fatalf("testcluster: failed to join %s: %v", node.ID, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		c.t.Fatalf("testcluster: joining %s returned status %d", node.ID, resp.StatusCode)
+	}
+	return node
+}
+
+// RemoveNode removes n from the Raft configuration through the leader and
+// stops it.
+func (c *Cluster) RemoveNode(n *Node) {
+	c.t.Helper()
+	leader := c.Leader()
+	if err := leader.Raft.RemoveServer(raft.ServerID(n.ID), 0, c.timeout).Error(); err != nil {
+		c.t.Fatalf("testcluster: failed to remove %s: %v", n.ID, err)
+	}
+	c.Stop(n)
+}
+
+// Stop shuts n down, as if the process had crashed. Its store is kept for
+// inspection.
+func (c *Cluster) Stop(n *Node) {
+	c.t.Helper()
+	if n.stopped {
+		return
+	}
+	n.stopped = true
+	c.Isolate(n)
+	if err := n.Raft.Shutdown().Error(); err != nil {
+		c.t.Errorf("testcluster: failed to shut down %s: %v", n.ID, err)
+	}
+	n.HTTP.Close()
+	n.wal.Close()
+}
+
+// Isolate cuts n off from every other node, simulating a network partition.
+// n keeps serving HTTP.
+func (c *Cluster) Isolate(n *Node) {
+	n.Transport.DisconnectAll()
+	for _, other := range c.Nodes {
+		if other != n {
+			other.Transport.Disconnect(n.Addr())
+		}
+	}
+}
+
+// Heal reconnects an isolated node to every running node.
+func (c *Cluster) Heal(n *Node) {
+	for _, other := range c.Nodes {
+		if other != n && !other.stopped {
+			c.connect(n, other)
+		}
+	}
+}
+
+// WaitFor polls cond until it holds, failing the test after the cluster's
+// timeout. what describes the condition in the failure message.
+func (c *Cluster) WaitFor(what string, cond func() bool) {
+	c.t.Helper()
+	deadline := time.Now().Add(c.timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			c.t.Fatalf("testcluster: timed out after %s waiting for %s", c.timeout, what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// WaitForKey waits until every running node's store holds key=value.
+func (c *Cluster) WaitForKey(key, value string) {
+	c.t.Helper()
+	c.WaitFor(fmt.Sprintf("%s=%q on every node", key, value), func() bool {
+		for _, n := range c.Nodes {
+			if n.stopped {
+				continue
+			}
+			if v, ok := n.Store.Get(key); !ok || v.Value != value {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Shutdown stops every node. It is registered with t.Cleanup by New.
+func (c *Cluster) Shutdown() {
+	for _, n := range c.Nodes {
+		if !n.stopped {
+			c.Stop(n)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Package testcluster_test contains the unit tests for the testcluster package.
+package testcluster
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/client"
+)
+
+func TestCluster(t *testing.T) {
+	c := New(t, 3)
+	ctx := context.Background()
+	cl, err := client.New(c.Endpoints())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// --- Test Case 1: Writes replicate to every node ---
+	if err := cl.Set(ctx, "a", "1"); err != nil {
+		t.Fatalf("expected the write to succeed, but got %v", err)
+	}
+	c.WaitForKey("a", "1")
+
+	// --- Test Case 2: Failover after the leader stops ---
+	old := c.Leader()
+	c.Stop(old)
+	leader := c.Leader()
+	if leader == old {
+		t.Fatal("expected a new leader, but the stopped node is still leader")
+	}
+	c.RemoveNode(old) // Keep the majority at two of three once a node joins
+	cl, _ = client.New(c.Endpoints())
+	if err := cl.Set(ctx, "b", "2"); err != nil {
+		t.Fatalf("expected writes to succeed after failover, but got %v", err)
+	}
+	c.WaitForKey("b", "2")
+
+	// --- Test Case 3: A joining node catches up ---
+	node := c.AddNode()
+	c.WaitForKey("b", "2")
+	if v, _ := node.Store.Get("a"); v.Value != "1" {
+		t.Errorf("expected the new node to have a=1, but got %q", v.Value)
+	}
+
+	// --- Test Case 4: An isolated follower misses writes until healed ---
+	follower := c.Followers()[0]
+	c.Isolate(follower)
+	cl, _ = client.New([]string{c.Leader().URL()})
+	if err := cl.Set(ctx, "c", "3"); err != nil {
+		t.Fatalf("expected the majority to accept writes, but got %v", err)
+	}
+	if _, ok := follower.Store.Get("c"); ok {
+		t.Error("expected the isolated follower not to see c, but it did")
+	}
+	c.Heal(follower)
+	c.WaitForKey("c", "3")
+
+	// --- Test Case 5: Removing a member ---
+	c.RemoveNode(c.Followers()[0])
+	cl, _ = client.New(c.Endpoints())
+	if err := cl.Set(ctx, "d", "4"); err != nil {
+		t.Fatalf("expected writes to succeed after removing a node, but got %v", err)
+	}
+	c.WaitForKey("d", "4")
+}
+
+func TestDecommission(t *testing.T) {
+	c := New(t, 3)
+	leader := c.Leader()
+	target := c.Followers()[0]
+
+	// --- Test Case 1: The leader demotes and removes a follower ---
+	body := strings.NewReader(`{"node_id":"` + target.ID + `"}`)
+	resp, err := http.Post(leader.URL()+"/v1/admin/decommission", "application/json", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res v1.DecommissionResponse
+	json.NewDecoder(resp.Body).Decode(&res)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !res.Removed {
+		t.Fatalf("expected the node to be removed, but got status %d: %+v", resp.StatusCode, res)
+	}
+	future := leader.Raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		t.Fatal(err)
+	}
+	for _, srv := range future.Configuration().Servers {
+		if string(srv.ID) == target.ID {
+			t.Errorf("expected %s to leave the configuration, but it is still there", target.ID)
+		}
+	}
+
+	// --- Test Case 2: The remaining nodes keep accepting writes ---
+	c.Stop(target)
+	cl, _ := client.New([]string{leader.URL()})
+	if err := cl.Set(context.Background(), "a", "1"); err != nil {
+		t.Fatalf("expected writes to succeed after decommissioning, but got %v", err)
+	}
+	c.WaitForKey("a", "1")
+}
@@ -0,0 +1,44 @@
+package transaction
+
+import "fmt"
+
+// Isolation selects how much of a transaction is validated at commit time.
+type Isolation string
+
+const (
+	// LastWriteWins commits the write set unconditionally; concurrent writers
+	// silently overwrite each other. This is the historical behaviour.
+	LastWriteWins Isolation = "last_write_wins"
+	// OptimisticRead aborts the commit if any key the transaction read has
+	// changed since it was read.
+	OptimisticRead Isolation = "occ"
+	// Serializable additionally aborts the commit if any key the transaction
+	// writes has changed since the write was staged.
+	Serializable Isolation = "serializable"
+)
+
+// ParseIsolation converts a config or query value to an Isolation. The empty
+// string selects LastWriteWins.
+func ParseIsolation(s string) (Isolation, error) {
+	switch Isolation(s) {
+	case "", LastWriteWins:
+		return LastWriteWins, nil
+	case OptimisticRead, Serializable:
+		return Isolation(s), nil
+	}
+	return "", fmt.Errorf("unknown isolation level %q (want last_write_wins, occ or serializable)", s)
+}
+
+// Validation returns the key versions that must still hold when the
+// transaction commits, according to its isolation level.
+func (t *Transaction) Validation() []ReadOp {
+	switch t.Isolation {
+	case OptimisticRead:
+		return t.ReadSet
+	case Serializable:
+		ops := make([]ReadOp, 0, len(t.ReadSet)+len(t.WriteVersions))
+		ops = append(ops, t.ReadSet...)
+		return append(ops, t.WriteVersions...)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package transaction
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Limits caps the memory that in-flight transactions can hold on the node,
+// so that a client which never commits can't exhaust it. A zero field means
+// no limit.
+type Limits struct {
+	MaxActive      int           // Transactions begun but not yet committed or cleared
+	MaxWriteSet    int           // Writes and deletes staged by one transaction
+	MaxStagedBytes int64         // Bytes of keys and values staged across all transactions
+	IdleTimeout    time.Duration // Transactions unused for this long are aborted when a limit is reached
+}
+
+// Errors returned when a limit is reached.
+var (
+	ErrTooManyTransactions = errors.New("too many transactions in flight")
+	ErrWriteSetTooLarge    = errors.New("write set too large")
+	ErrStagedBytesExceeded = errors.New("too many bytes staged by transactions in flight")
+)
+
+// SetLimits changes the limits enforced by Begin and Reserve. Transactions
+// already over a lowered limit are left alone.
+func (m *Manager) SetLimits(l Limits) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.limits = l
+}
+
+// CheckWriteSet returns ErrWriteSetTooLarge if a transaction may not stage n
+// writes and deletes.
+func (m *Manager) CheckWriteSet(n int) error {
+	m.mu.RLock()
+	max := m.limits.MaxWriteSet
+	m.mu.RUnlock()
+	if max > 0 && n > max {
+		return fmt.Errorf("%w: %d writes, at most %d allowed", ErrWriteSetTooLarge, n, max)
+	}
+	return nil
+}
+
+// Reserve accounts for writes more writes and deletes, holding size bytes
+// of keys and values, before tx stages them. It fails, reserving nothing,
+// if that would take tx past MaxWriteSet or all transactions past
+// MaxStagedBytes. The bytes are released when tx is cleared. The caller
+// must have tx from Use.
+func (m *Manager) Reserve(tx *Transaction, writes int, size int64) error {
+	if err := m.CheckWriteSet(len(tx.WriteSet) + writes); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if max := m.limits.MaxStagedBytes; max > 0 && m.staged+size > max {
+		m.expireIdleLocked(time.Now())
+	}
+	if max := m.limits.MaxStagedBytes; max > 0 && m.staged+size > max {
+		return fmt.Errorf("%w: %d bytes staged, at most %d allowed", ErrStagedBytesExceeded, m.staged+size, max)
+	}
+	m.staged += size
+	tx.stagedBytes += size
+	return nil
+}
+
+// expireIdleLocked aborts the transactions no one has used for IdleTimeout,
+// to make room for new ones, and returns how many it aborted. Those in use
+// are left alone. The caller must hold m.mu for writing.
+func (m *Manager) expireIdleLocked(now time.Time) int {
+	if m.limits.IdleTimeout <= 0 {
+		return 0
+	}
+	expired := 0
+	for id, tx := range m.transactions {
+		if !tx.mu.TryLock() {
+			continue
+		}
+		if now.Sub(tx.lastUsed) >= m.limits.IdleTimeout {
+			m.staged -= tx.stagedBytes
+			delete(m.transactions, id)
+			expired++
+		}
+		tx.mu.Unlock()
+	}
+	m.stats.mu.Lock()
+	m.stats.expired += uint64(expired)
+	m.stats.mu.Unlock()
+	return expired
+}
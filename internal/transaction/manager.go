@@ -2,7 +2,10 @@
 package transaction
 
 import (
+	"fmt"
 	"sync"
+	"time"
+
 	"github.com/google/uuid"
 )
 
@@ -12,44 +15,87 @@ type ReadOp struct {
 	Version uint64
 }
 
-// WriteOp represents a key-value pair that will be written upon commit.
+// WriteOp represents a key-value pair that will be written upon commit, or a
+// key that will be deleted.
 type WriteOp struct {
-	Key   string
-	Value string
+	Key    string
+	Value  string
+	Delete bool `json:",omitempty"`
 }
 
 // Transaction holds the state for a single, in-flight transaction.
 type Transaction struct {
-	ID       string
-	ReadSet  []ReadOp
-	WriteSet []WriteOp
+	ID        string
+	Isolation Isolation
+	ReadSet   []ReadOp
+	WriteSet  []WriteOp
+
+	// WriteVersions records the version of each written key when its write
+	// was staged; only Serializable transactions validate it.
+	WriteVersions []ReadOp
+
+	stagedBytes int64       // Reserved for the write set, see Manager.Reserve
+	savepoints  []savepoint // In the order they were set
+
+	mu       sync.Mutex // Held by whoever is using the transaction, see Manager.Use
+	lastUsed time.Time  // When it was last released; guarded by mu
 }
 
 // Manager is a thread-safe manager for all active transactions.
 type Manager struct {
 	mu           sync.RWMutex
 	transactions map[string]*Transaction
+	isolation    Isolation // Default for transactions begun without an explicit level
+	limits       Limits
+	staged       int64 // Bytes reserved by all transactions
+	stats        stats
 }
 
 // NewManager creates a new transaction manager.
 func NewManager() *Manager {
 	return &Manager{
 		transactions: make(map[string]*Transaction),
+		isolation:    LastWriteWins,
 	}
 }
 
-// Begin starts a new transaction and returns its unique ID.
-func (m *Manager) Begin() *Transaction {
+// SetDefaultIsolation changes the isolation level used by Begin.
+func (m *Manager) SetDefaultIsolation(level Isolation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.isolation = level
+}
+
+// Begin starts a new transaction at the default isolation level.
+func (m *Manager) Begin() (*Transaction, error) {
+	m.mu.RLock()
+	level := m.isolation
+	m.mu.RUnlock()
+	return m.BeginWith(level)
+}
+
+// BeginWith starts a new transaction at the given isolation level. It
+// returns ErrTooManyTransactions if MaxActive transactions are in flight.
+func (m *Manager) BeginWith(level Isolation) (*Transaction, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	now := time.Now()
+	if max := m.limits.MaxActive; max > 0 && len(m.transactions) >= max {
+		m.expireIdleLocked(now)
+	}
+	if max := m.limits.MaxActive; max > 0 && len(m.transactions) >= max {
+		return nil, fmt.Errorf("%w: at most %d allowed", ErrTooManyTransactions, max)
+	}
 
 	tx := &Transaction{
-		ID:       uuid.NewString(), // Generate a unique ID
-		ReadSet:  make([]ReadOp, 0),
+		ID:        uuid.NewString(), // Generate a unique ID
+		Isolation: level,
+		ReadSet:   make([]ReadOp, 0),
 		WriteSet: make([]WriteOp, 0),
+		lastUsed:  now,
 	}
 	m.transactions[tx.ID] = tx
-	return tx
+	return tx, nil
 }
 
 // Get retrieves an active transaction by its ID.
@@ -60,11 +106,77 @@ func (m *Manager) Get(txID string) (*Transaction, bool) {
 	return tx, ok
 }
 
+// Use retrieves an active transaction by its ID and locks it, waiting for
+// any other request using it, so that requests on one transaction take
+// turns. It returns false if there is no such transaction, including one
+// committed, aborted or expired while it waited. The caller must Release it.
+func (m *Manager) Use(txID string) (*Transaction, bool) {
+	tx, ok := m.Get(txID)
+	if !ok {
+		return nil, false
+	}
+	tx.mu.Lock()
+	if current, ok := m.Get(txID); !ok || current != tx {
+		tx.mu.Unlock()
+		return nil, false
+	}
+	return tx, true
+}
+
+// Release unlocks a transaction returned by Use, which counts as using it
+// for the idle timeout.
+func (t *Transaction) Release() {
+	t.lastUsed = time.Now()
+	t.mu.Unlock()
+}
+
+// Abort discards the transaction txID without committing it, waiting for
+// any request using it. It returns false if there was no such transaction.
+func (m *Manager) Abort(txID string) bool {
+	tx, ok := m.Use(txID)
+	if !ok {
+		return false
+	}
+	defer tx.Release()
+	m.Clear(txID)
+	return true
+}
+
 // StageWrite adds a write operation to a transaction's write set.
 func (t *Transaction) StageWrite(key, value string) {
 	t.WriteSet = append(t.WriteSet, WriteOp{Key: key, Value: value})
 }
 
+// StageVersionedWrite adds a write operation and remembers the version the
+// key had when the write was staged, for write-set validation.
+func (t *Transaction) StageVersionedWrite(key, value string, version uint64) {
+	t.StageWrite(key, value)
+	t.WriteVersions = append(t.WriteVersions, ReadOp{Key: key, Version: version})
+}
+
+// StageDelete adds a delete operation to a transaction's write set.
+func (t *Transaction) StageDelete(key string) {
+	t.WriteSet = append(t.WriteSet, WriteOp{Key: key, Delete: true})
+}
+
+// StageVersionedDelete is StageDelete with the key's version recorded for
+// write-set validation.
+func (t *Transaction) StageVersionedDelete(key string, version uint64) {
+	t.StageDelete(key)
+	t.WriteVersions = append(t.WriteVersions, ReadOp{Key: key, Version: version})
+}
+
+// Staged returns the latest write the transaction has staged for key, so
+// that a transaction can read its own writes.
+func (t *Transaction) Staged(key string) (WriteOp, bool) {
+	for i := len(t.WriteSet) - 1; i >= 0; i-- {
+		if t.WriteSet[i].Key == key {
+			return t.WriteSet[i], true
+		}
+	}
+	return WriteOp{}, false
+}
+
 // StageRead adds a read operation to a transaction's read set.
 func (t *Transaction) StageRead(key string, version uint64) {
 	t.ReadSet = append(t.ReadSet, ReadOp{Key: key, Version: version})
@@ -74,5 +186,8 @@ func (t *Transaction) StageRead(key string, version uint64) {
 func (m *Manager) Clear(txID string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	delete(m.transactions, txID)
+	if tx, ok := m.transactions[txID]; ok {
+		m.staged -= tx.stagedBytes
+		delete(m.transactions, txID)
+	}
 }
\ No newline at end of file
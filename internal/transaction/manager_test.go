@@ -1,13 +1,19 @@
 // Package transaction_test contains the unit tests for the transaction package.
 package transaction
 
-import "testing"
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ASHISH26940/heliosdb/internal/store"
+)
 
 func TestManager(t *testing.T) {
 	m := NewManager()
 
 	// 1. Begin a new transaction
-	tx1 := m.Begin()
+	tx1, _ := m.Begin()
 	if tx1.ID == "" {
 		t.Fatal("expected a transaction ID, but it was empty")
 	}
@@ -33,7 +39,7 @@ func TestManager(t *testing.T) {
 	}
 
 	// 4. Begin another transaction to ensure IDs are unique
-	tx2 := m.Begin()
+	tx2, _ := m.Begin()
 	if tx1.ID == tx2.ID {
 		t.Fatal("expected transaction IDs to be unique")
 	}
@@ -50,4 +56,176 @@ func TestManager(t *testing.T) {
 	if !ok {
 		t.Errorf("transaction %s was cleared unexpectedly", tx2.ID)
 	}
-}
\ No newline at end of file
+}
+func TestIsolation(t *testing.T) {
+	m := NewManager()
+
+	// --- Test Case 1: Parsing ---
+	if level, err := ParseIsolation(""); err != nil || level != LastWriteWins {
+		t.Errorf("expected empty isolation to mean %s, but got %s (err %v)", LastWriteWins, level, err)
+	}
+	if _, err := ParseIsolation("snapshot"); err == nil {
+		t.Error("expected an error for an unknown isolation level, but got nil")
+	}
+
+	// --- Test Case 2: Begin uses the manager default ---
+	if tx, _ := m.Begin(); tx.Isolation != LastWriteWins {
+		t.Errorf("expected default isolation %s, but got %s", LastWriteWins, tx.Isolation)
+	}
+	m.SetDefaultIsolation(OptimisticRead)
+	if tx, _ := m.Begin(); tx.Isolation != OptimisticRead {
+		t.Errorf("expected default isolation %s, but got %s", OptimisticRead, tx.Isolation)
+	}
+
+	// --- Test Case 3: Validation depends on the level ---
+	for _, tc := range []struct {
+		level Isolation
+		want  int
+	}{
+		{LastWriteWins, 0},
+		{OptimisticRead, 1},
+		{Serializable, 2},
+	} {
+		tx, _ := m.BeginWith(tc.level)
+		tx.StageRead("a", 3)
+		tx.StageVersionedWrite("b", "v", 7)
+		if got := len(tx.Validation()); got != tc.want {
+			t.Errorf("expected %d validated keys for %s, but got %d", tc.want, tc.level, got)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	m := NewManager()
+	m.SetLimits(Limits{MaxActive: 2, MaxWriteSet: 3, MaxStagedBytes: 10})
+
+	// --- Test Case 1: Begin fails once MaxActive transactions are in flight ---
+	tx1, _ := m.Begin()
+	tx2, _ := m.Begin()
+	if _, err := m.Begin(); !errors.Is(err, ErrTooManyTransactions) {
+		t.Errorf("expected ErrTooManyTransactions, but got %v", err)
+	}
+
+	// --- Test Case 2: The write set is capped per transaction ---
+	if err := m.Reserve(tx1, 2, 4); err != nil {
+		t.Fatalf("expected the reservation to succeed, but got %v", err)
+	}
+	tx1.StageWrite("a", "1")
+	tx1.StageWrite("b", "1")
+	if err := m.Reserve(tx1, 2, 0); !errors.Is(err, ErrWriteSetTooLarge) {
+		t.Errorf("expected ErrWriteSetTooLarge, but got %v", err)
+	}
+
+	// --- Test Case 3: Staged bytes are capped across transactions ---
+	if err := m.Reserve(tx2, 1, 7); !errors.Is(err, ErrStagedBytesExceeded) {
+		t.Errorf("expected ErrStagedBytesExceeded, but got %v", err)
+	}
+	if st := m.Stats(); st.StagedBytes != 4 {
+		t.Errorf("expected 4 bytes staged, but got %d", st.StagedBytes)
+	}
+
+	// --- Test Case 4: Clearing a transaction frees its slot and bytes ---
+	m.Clear(tx1.ID)
+	if err := m.Reserve(tx2, 1, 7); err != nil {
+		t.Errorf("expected the reservation to succeed, but got %v", err)
+	}
+	if _, err := m.Begin(); err != nil {
+		t.Errorf("expected a free slot, but got %v", err)
+	}
+
+	// --- Test Case 5: Idle transactions make room, unless in use ---
+	m = NewManager()
+	m.SetLimits(Limits{MaxActive: 1, IdleTimeout: time.Millisecond})
+	idle, _ := m.Begin()
+	tx, _ := m.Use(idle.ID)
+	time.Sleep(5 * time.Millisecond)
+	if _, err := m.Begin(); !errors.Is(err, ErrTooManyTransactions) {
+		t.Errorf("expected ErrTooManyTransactions while in use, but got %v", err)
+	}
+	tx.Release()
+	time.Sleep(5 * time.Millisecond)
+	fresh, err := m.Begin()
+	if err != nil {
+		t.Fatalf("expected the idle transaction to make room, but got %v", err)
+	}
+	if _, ok := m.Use(idle.ID); ok {
+		t.Error("expected the idle transaction to be gone, but it was found")
+	}
+	if st := m.Stats(); st.Expired != 1 || st.Active != 1 {
+		t.Errorf("expected 1 expired and 1 active, but got %+v", st)
+	}
+
+	// --- Test Case 6: Aborting frees the slot ---
+	if !m.Abort(fresh.ID) || m.Abort(fresh.ID) {
+		t.Error("expected the transaction to be aborted once")
+	}
+	if st := m.Stats(); st.Active != 0 {
+		t.Errorf("expected no active transactions, but got %d", st.Active)
+	}
+}
+
+func TestSavepoints(t *testing.T) {
+	m := NewManager()
+	tx, _ := m.BeginWith(Serializable)
+	stage := func(key, value string) {
+		m.Reserve(tx, 1, int64(len(key)+len(value)))
+		tx.StageVersionedWrite(key, value, 1)
+	}
+
+	stage("a", "1")
+	tx.Savepoint("one")
+	stage("b", "22")
+	tx.StageRead("r", 3)
+	tx.Savepoint("two")
+	stage("c", "333")
+
+	// --- Test Case 1: Rolling back drops later writes, versions and bytes ---
+	if err := m.RollbackTo(tx, "one"); err != nil {
+		t.Fatalf("expected the rollback to succeed, but got %v", err)
+	}
+	if len(tx.WriteSet) != 1 || tx.WriteSet[0].Key != "a" || len(tx.WriteVersions) != 1 {
+		t.Errorf("expected only a to stay staged, but got %+v and %+v", tx.WriteSet, tx.WriteVersions)
+	}
+	if st := m.Stats(); st.StagedBytes != 2 {
+		t.Errorf("expected 2 bytes staged, but got %d", st.StagedBytes)
+	}
+	if len(tx.ReadSet) != 1 {
+		t.Errorf("expected the read set to be kept, but got %+v", tx.ReadSet)
+	}
+
+	// --- Test Case 2: Later savepoints are discarded, the target is kept ---
+	if err := m.RollbackTo(tx, "two"); !errors.Is(err, ErrNoSavepoint) {
+		t.Errorf("expected ErrNoSavepoint, but got %v", err)
+	}
+	stage("d", "4")
+	if err := m.RollbackTo(tx, "one"); err != nil || len(tx.WriteSet) != 1 {
+		t.Errorf("expected to roll back to one again, but got %v and %+v", err, tx.WriteSet)
+	}
+}
+
+func TestStats(t *testing.T) {
+	m := NewManager()
+	m.Begin()
+
+	m.RecordCommit(2, nil)
+	m.RecordCommit(4, nil)
+	m.RecordCommit(3, store.ErrVersionConflict)
+	m.RecordCommit(1, errors.New("raft: leadership lost"))
+	m.RecordAbort(AbortNotLeader)
+
+	st := m.Stats()
+	if st.Active != 1 {
+		t.Errorf("expected 1 active transaction, but got %d", st.Active)
+	}
+	if st.CommitAttempts != 5 || st.Commits != 2 || st.ValidationFailures != 1 {
+		t.Errorf("unexpected counters: %+v", st)
+	}
+	for reason, want := range map[string]uint64{AbortConflict: 1, AbortApplyError: 1, AbortNotLeader: 1} {
+		if st.Aborts[reason] != want {
+			t.Errorf("expected %d aborts for %s, but got %d", want, reason, st.Aborts[reason])
+		}
+	}
+	if st.MeanWriteSetSize != 3 {
+		t.Errorf("expected a mean write set size of 3, but got %v", st.MeanWriteSetSize)
+	}
+}
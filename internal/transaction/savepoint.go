@@ -0,0 +1,51 @@
+package transaction
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrNoSavepoint is returned when rolling back to a savepoint that was never
+// set, or was discarded by an earlier rollback.
+var ErrNoSavepoint = errors.New("no such savepoint")
+
+// savepoint marks how much of a transaction's write set had been staged when
+// it was set.
+type savepoint struct {
+	name     string
+	writes   int // len(WriteSet)
+	versions int // len(WriteVersions)
+}
+
+// Savepoint marks the writes staged so far under name, so that later ones
+// can be undone with Manager.RollbackTo. Setting a name again moves it.
+func (t *Transaction) Savepoint(name string) {
+	t.savepoints = slices.DeleteFunc(t.savepoints, func(sp savepoint) bool { return sp.name == name })
+	t.savepoints = append(t.savepoints, savepoint{name: name, writes: len(t.WriteSet), versions: len(t.WriteVersions)})
+}
+
+// RollbackTo discards the writes and deletes tx staged since the savepoint
+// name, and any savepoints set since, releasing their bytes. The savepoint
+// itself remains, so it can be rolled back to again. Reads are kept in the
+// read set: what the transaction decides may still depend on them.
+func (m *Manager) RollbackTo(tx *Transaction, name string) error {
+	i := slices.IndexFunc(tx.savepoints, func(sp savepoint) bool { return sp.name == name })
+	if i < 0 {
+		return fmt.Errorf("%w %q", ErrNoSavepoint, name)
+	}
+	sp := tx.savepoints[i]
+	var freed int64
+	for _, op := range tx.WriteSet[sp.writes:] {
+		freed += int64(len(op.Key) + len(op.Value))
+	}
+	tx.WriteSet = tx.WriteSet[:sp.writes]
+	tx.WriteVersions = tx.WriteVersions[:sp.versions]
+	tx.savepoints = tx.savepoints[:i+1]
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.staged -= freed
+	tx.stagedBytes -= freed
+	return nil
+}
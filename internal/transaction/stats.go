@@ -0,0 +1,100 @@
+package transaction
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/ASHISH26940/heliosdb/internal/store"
+)
+
+// Reasons a commit can be aborted, as reported in Stats.Aborts.
+const (
+	AbortConflict   = "conflict"    // Validation found a key changed concurrently
+	AbortNotLeader  = "not_leader"  // The commit reached a follower
+	AbortApplyError = "apply_error" // Raft failed to apply the commit
+)
+
+// Stats summarises commit outcomes, to help tune contention.
+type Stats struct {
+	Active             int               `json:"active"`       // Transactions begun but not yet committed or cleared
+	StagedBytes        int64             `json:"staged_bytes"` // Bytes of keys and values staged by active transactions
+	CommitAttempts     uint64            `json:"commit_attempts"`
+	Commits            uint64            `json:"commits"`
+	ValidationFailures uint64            `json:"validation_failures"`
+	Aborts             map[string]uint64 `json:"aborts"`              // By reason
+	Expired            uint64            `json:"expired"`             // Aborted after sitting idle past the idle timeout
+	MeanWriteSetSize   float64           `json:"mean_write_set_size"` // Over successful commits
+}
+
+// stats accumulates the counters behind Stats.
+type stats struct {
+	mu                 sync.Mutex
+	commitAttempts     uint64
+	commits            uint64
+	validationFailures uint64
+	aborts             map[string]uint64
+	writeSetTotal      uint64
+	expired            uint64
+}
+
+// RecordCommit accounts for one commit attempt of a transaction with the
+// given write set size. err is nil on success; otherwise it is classified
+// into an abort reason.
+func (m *Manager) RecordCommit(writeSetSize int, err error) {
+	m.stats.mu.Lock()
+	defer m.stats.mu.Unlock()
+
+	m.stats.commitAttempts++
+	if err == nil {
+		m.stats.commits++
+		m.stats.writeSetTotal += uint64(writeSetSize)
+		return
+	}
+	reason := AbortApplyError
+	if errors.Is(err, store.ErrVersionConflict) {
+		m.stats.validationFailures++
+		reason = AbortConflict
+	}
+	m.recordAbortLocked(reason)
+}
+
+// RecordAbort accounts for a commit attempt rejected before it was proposed.
+func (m *Manager) RecordAbort(reason string) {
+	m.stats.mu.Lock()
+	defer m.stats.mu.Unlock()
+	m.stats.commitAttempts++
+	m.recordAbortLocked(reason)
+}
+
+func (m *Manager) recordAbortLocked(reason string) {
+	if m.stats.aborts == nil {
+		m.stats.aborts = make(map[string]uint64)
+	}
+	m.stats.aborts[reason]++
+}
+
+// Stats returns a snapshot of the commit statistics.
+func (m *Manager) Stats() Stats {
+	m.mu.RLock()
+	active, staged := len(m.transactions), m.staged
+	m.mu.RUnlock()
+
+	m.stats.mu.Lock()
+	defer m.stats.mu.Unlock()
+	s := Stats{
+		Active:             active,
+		StagedBytes:        staged,
+		CommitAttempts:     m.stats.commitAttempts,
+		Commits:            m.stats.commits,
+		ValidationFailures: m.stats.validationFailures,
+		Aborts:             make(map[string]uint64, len(m.stats.aborts)),
+		Expired:            m.stats.expired,
+	}
+	for reason, n := range m.stats.aborts {
+		s.Aborts[reason] = n
+	}
+	if s.Commits > 0 {
+		s.MeanWriteSetSize = float64(m.stats.writeSetTotal) / float64(s.Commits)
+	}
+	return s
+}
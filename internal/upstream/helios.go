@@ -0,0 +1,46 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/ASHISH26940/heliosdb/client"
+)
+
+// helios reads and writes another HeliosDB cluster through the Go client,
+// which spreads reads across its nodes and finds its leader for writes.
+type helios struct {
+	c *client.Client
+}
+
+func newHelios(hosts []string, o options) (*helios, error) {
+	endpoints := make([]string, len(hosts))
+	for i, h := range hosts {
+		endpoints[i] = "http://" + h
+	}
+	c, err := client.New(endpoints, client.WithHTTPClient(&http.Client{Timeout: o.timeout}))
+	if err != nil {
+		return nil, err
+	}
+	return &helios{c: c}, nil
+}
+
+// Load implements Loader.
+func (h *helios) Load(ctx context.Context, key string) (string, bool, error) {
+	value, err := h.c.Get(ctx, key)
+	if errors.Is(err, client.ErrNotFound) {
+		return "", false, nil
+	}
+	return value, err == nil, err
+}
+
+// Set implements Mirror.
+func (h *helios) Set(ctx context.Context, key, value string) error {
+	return h.c.Set(ctx, key, value)
+}
+
+// Delete implements Mirror.
+func (h *helios) Delete(ctx context.Context, key string) error {
+	return h.c.Delete(ctx, key)
+}
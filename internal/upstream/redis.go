@@ -0,0 +1,173 @@
+package upstream
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxIdleRedisConns bounds the connections kept open to a Redis upstream
+// between calls.
+const maxIdleRedisConns = 8
+
+// redis reads and writes a Redis-compatible server with GET, SET and DEL.
+// Each call takes a connection from a small pool, or dials a new one.
+type redis struct {
+	addr    string
+	setup   [][]string // AUTH and SELECT, sent on every new connection
+	timeout time.Duration
+	idle    chan *redisConn
+}
+
+// redisConn is one connection to a Redis server.
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+func newRedis(u *url.URL, o options) *redis {
+	r := &redis{addr: u.Host, timeout: o.timeout, idle: make(chan *redisConn, maxIdleRedisConns)}
+	if password, ok := u.User.Password(); ok {
+		if user := u.User.Username(); user != "" {
+			r.setup = append(r.setup, []string{"AUTH", user, password})
+		} else {
+			r.setup = append(r.setup, []string{"AUTH", password})
+		}
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		r.setup = append(r.setup, []string{"SELECT", db})
+	}
+	return r
+}
+
+// Load implements Loader.
+func (r *redis) Load(ctx context.Context, key string) (string, bool, error) {
+	return r.do(ctx, "GET", key)
+}
+
+// Set implements Mirror.
+func (r *redis) Set(ctx context.Context, key, value string) error {
+	_, _, err := r.do(ctx, "SET", key, value)
+	return err
+}
+
+// Delete implements Mirror.
+func (r *redis) Delete(ctx context.Context, key string) error {
+	_, _, err := r.do(ctx, "DEL", key)
+	return err
+}
+
+// do sends one command about a key and returns its reply, and whether it
+// was other than nil. The connection goes back to the pool unless it broke.
+func (r *redis) do(ctx context.Context, args ...string) (string, bool, error) {
+	c, err := r.conn(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	reply, ok, err := c.do(r.deadline(ctx), args)
+	if _, isReply := err.(redisError); err != nil && !isReply {
+		c.conn.Close()
+		return "", false, err
+	}
+	select {
+	case r.idle <- c:
+	default:
+		c.conn.Close()
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("redis %s %s: %w", args[0], args[1], err)
+	}
+	return reply, ok, nil
+}
+
+// conn returns an idle connection, or dials and sets up a new one.
+func (r *redis) conn(ctx context.Context) (*redisConn, error) {
+	select {
+	case c := <-r.idle:
+		return c, nil
+	default:
+	}
+	d := net.Dialer{Timeout: r.timeout}
+	conn, err := d.DialContext(ctx, "tcp", r.addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+	for _, cmd := range r.setup {
+		if _, _, err := c.do(r.deadline(ctx), cmd); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("redis %s failed: %w", cmd[0], err)
+		}
+	}
+	return c, nil
+}
+
+// deadline is when a call made under ctx must finish.
+func (r *redis) deadline(ctx context.Context) time.Time {
+	deadline := time.Now().Add(r.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		return d
+	}
+	return deadline
+}
+
+// do sends args as one command and reads its reply.
+func (c *redisConn) do(deadline time.Time, args []string) (string, bool, error) {
+	c.conn.SetDeadline(deadline)
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := c.w.Flush(); err != nil {
+		return "", false, err
+	}
+	return readReply(c.r)
+}
+
+// redisError is an error reply from the server, e.g. "WRONGTYPE Operation
+// against a key holding the wrong kind of value".
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+// readReply reads a simple, integer or bulk string reply, reporting false
+// for a nil bulk string and returning an error reply as a redisError.
+func readReply(r *bufio.Reader) (string, bool, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", false, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return "", false, fmt.Errorf("malformed reply")
+	}
+	switch line[0] {
+	case '+', ':':
+		return line[1:], true, nil
+	case '-':
+		return "", false, redisError(line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return "", false, fmt.Errorf("malformed reply %q", line)
+		}
+		if n < 0 {
+			return "", false, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return "", false, err
+		}
+		return string(buf[:n]), true, nil
+	}
+	return "", false, fmt.Errorf("unexpected reply %q", line)
+}
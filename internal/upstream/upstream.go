@@ -0,0 +1,177 @@
+// Package upstream connects HeliosDB to another store: a slower system of
+// record that it caches, or a legacy store it is taking traffic over from. A
+// Loader fetches keys the store does not hold, so that reads fall through to
+// the upstream on a miss; a Mirror is sent each write before it is
+// committed, so that the upstream stays the source of truth.
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds each call to an upstream.
+const DefaultTimeout = 5 * time.Second
+
+// Loader fetches the value of a key from an upstream. It reports false,
+// without an error, if the upstream has no such key.
+type Loader interface {
+	Load(ctx context.Context, key string) (string, bool, error)
+}
+
+// Mirror applies writes to an upstream.
+type Mirror interface {
+	Set(ctx context.Context, key, value string) error
+	Delete(ctx context.Context, key string) error
+}
+
+// Store is an upstream that can be both read and written through.
+type Store interface {
+	Loader
+	Mirror
+}
+
+// Option configures an upstream.
+type Option func(*options)
+
+type options struct {
+	timeout time.Duration
+	header  http.Header
+}
+
+// WithTimeout bounds each call to the upstream by d instead of
+// DefaultTimeout.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// WithHeader sets a header on every call to an HTTP upstream, such as the
+// credentials it expects.
+func WithHeader(name, value string) Option {
+	return func(o *options) {
+		o.header.Set(name, value)
+	}
+}
+
+// newOptions applies opts to the defaults.
+func newOptions(opts []Option) options {
+	o := options{timeout: DefaultTimeout, header: make(http.Header)}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Open returns the upstream named by a URL: http:// or https:// for an HTTP
+// callback (see HTTP), helios://host:port[,host:port...] for a HeliosDB
+// cluster, or redis://[user:password@]host:port[/db] for a Redis-compatible
+// server. These are the URLs migrations accept as targets.
+func Open(rawURL string, opts ...Option) (Store, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return NewHTTP(rawURL, opts...)
+	case "helios":
+		return newHelios(strings.Split(u.Host, ","), newOptions(opts))
+	case "redis":
+		return newRedis(u, newOptions(opts)), nil
+	}
+	return nil, fmt.Errorf("unsupported upstream scheme %q (want http, https, helios or redis)", u.Scheme)
+}
+
+// HTTP is a Loader and Mirror that calls back an HTTP service for each key,
+// at its base URL followed by the escaped key: GET loads the key, answering
+// 200 with the value as the body or 404 if there is none; PUT stores the
+// body as the key's value; DELETE removes the key. A DELETE answered with
+// 404 succeeds, and so does any other 2xx response.
+type HTTP struct {
+	baseURL string
+	client  *http.Client
+	header  http.Header
+}
+
+// NewHTTP returns an HTTP upstream at baseURL.
+func NewHTTP(baseURL string, opts ...Option) (*HTTP, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("upstream URL %q is not http or https", baseURL)
+	}
+	o := newOptions(opts)
+	return &HTTP{
+		baseURL: strings.TrimSuffix(baseURL, "/") + "/",
+		client:  &http.Client{Timeout: o.timeout},
+		header:  o.header,
+	}, nil
+}
+
+// Load implements Loader.
+func (h *HTTP) Load(ctx context.Context, key string) (string, bool, error) {
+	resp, err := h.do(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return "", false, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", false, nil
+	case resp.StatusCode != http.StatusOK:
+		return "", false, fmt.Errorf("upstream GET %s: %s", key, resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", false, err
+	}
+	return string(body), true, nil
+}
+
+// Set implements Mirror.
+func (h *HTTP) Set(ctx context.Context, key, value string) error {
+	return h.write(ctx, http.MethodPut, key, strings.NewReader(value))
+}
+
+// Delete implements Mirror.
+func (h *HTTP) Delete(ctx context.Context, key string) error {
+	return h.write(ctx, http.MethodDelete, key, nil)
+}
+
+// write sends a PUT or DELETE of key, and fails unless it is accepted.
+func (h *HTTP) write(ctx context.Context, method, key string, body io.Reader) error {
+	resp, err := h.do(ctx, method, key, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 == 2 || (method == http.MethodDelete && resp.StatusCode == http.StatusNotFound) {
+		return nil
+	}
+	return fmt.Errorf("upstream %s %s: %s", method, key, resp.Status)
+}
+
+// do sends a request for key.
+func (h *HTTP) do(ctx context.Context, method, key string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, h.baseURL+url.PathEscape(key), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range h.header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	return h.client.Do(req)
+}
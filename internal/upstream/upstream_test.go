@@ -0,0 +1,232 @@
+// Package upstream_test contains the unit tests for the upstream package.
+package upstream
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// backend is an HTTP upstream holding keys in a map.
+type backend struct {
+	mu   sync.Mutex
+	data map[string]string
+	auth string // Authorization of the last request
+	fail bool
+}
+
+func (b *backend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.auth = r.Header.Get("Authorization")
+	if b.fail {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/v1"), "/kv/")
+	switch r.Method {
+	case http.MethodGet:
+		value, ok := b.data[key]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, value)
+		if r.URL.Path != "/kv/"+key {
+			io.WriteString(w, "\n") // HeliosDB ends values with a newline
+		}
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		b.data[key] = string(body)
+	case http.MethodPost:
+		var req struct{ Value string }
+		json.NewDecoder(r.Body).Decode(&req)
+		b.data[key] = req.Value
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		if _, ok := b.data[key]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		delete(b.data, key)
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	b := &backend{data: map[string]string{"users/1": "alice"}}
+	srv := httptest.NewServer(b)
+	defer srv.Close()
+	h, err := NewHTTP(srv.URL+"/kv", WithHeader("Authorization", "Bearer t"))
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	ctx := context.Background()
+
+	// --- Test Case 1: Keys are loaded, and missing ones reported ---
+	if value, ok, err := h.Load(ctx, "users/1"); value != "alice" || !ok || err != nil {
+		t.Errorf("expected alice, but got %q, %v, %v", value, ok, err)
+	}
+	if _, ok, err := h.Load(ctx, "users/2"); ok || err != nil {
+		t.Errorf("expected users/2 to be missing, but got %v, %v", ok, err)
+	}
+	if b.auth != "Bearer t" {
+		t.Errorf("expected the Authorization header to be sent, but got %q", b.auth)
+	}
+
+	// --- Test Case 2: Writes are mirrored, and deleting a missing key succeeds ---
+	if err := h.Set(ctx, "users/2", "bob"); err != nil || b.data["users/2"] != "bob" {
+		t.Errorf("expected users/2 to be stored, but got %v: %v", err, b.data)
+	}
+	if err := h.Delete(ctx, "users/1"); err != nil || b.data["users/1"] != "" {
+		t.Errorf("expected users/1 to be deleted, but got %v: %v", err, b.data)
+	}
+	if err := h.Delete(ctx, "users/1"); err != nil {
+		t.Errorf("expected deleting a missing key to succeed, but got %v", err)
+	}
+
+	// --- Test Case 3: Upstream failures are errors ---
+	b.fail = true
+	if _, _, err := h.Load(ctx, "users/2"); err == nil {
+		t.Error("expected an error loading from a failing upstream, but got none")
+	}
+	if err := h.Set(ctx, "users/3", "carol"); err == nil {
+		t.Error("expected an error writing to a failing upstream, but got none")
+	}
+	if _, err := NewHTTP("ftp://example.com"); err == nil {
+		t.Error("expected an error for a non-HTTP URL, but got none")
+	}
+}
+
+func TestOpenHelios(t *testing.T) {
+	b := &backend{data: map[string]string{"users/1": "alice"}}
+	srv := httptest.NewServer(b)
+	defer srv.Close()
+	up, err := Open("helios://" + strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	ctx := context.Background()
+
+	// --- Test Case 1: Keys are read from the cluster's HTTP API ---
+	if value, ok, err := up.Load(ctx, "users/1"); value != "alice" || !ok || err != nil {
+		t.Errorf("expected alice, but got %q, %v, %v", value, ok, err)
+	}
+	if _, ok, err := up.Load(ctx, "users/2"); ok || err != nil {
+		t.Errorf("expected users/2 to be missing, but got %v, %v", ok, err)
+	}
+
+	// --- Test Case 2: Writes go to the cluster too ---
+	if err := up.Set(ctx, "users/2", "bob"); err != nil || b.data["users/2"] != "bob" {
+		t.Errorf("expected users/2 to be stored, but got %v: %v", err, b.data)
+	}
+	if _, err := Open("memcached://localhost:11211"); err == nil {
+		t.Error("expected an error for an unsupported scheme, but got none")
+	}
+}
+
+// fakeRedis serves GET, SET, DEL, AUTH and SELECT over RESP from a map, and
+// returns its address and the commands it was sent.
+func fakeRedis(t *testing.T, data map[string]string) (string, func() []string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	var mu sync.Mutex
+	var seen []string
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			var n int
+			if _, err := fmt.Fscanf(r, "*%d\r\n", &n); err != nil {
+				return
+			}
+			args := make([]string, n)
+			for i := range args {
+				var size int
+				fmt.Fscanf(r, "$%d\r\n", &size)
+				buf := make([]byte, size+2)
+				if _, err := io.ReadFull(r, buf); err != nil {
+					return
+				}
+				args[i] = string(buf[:size])
+			}
+			mu.Lock()
+			seen = append(seen, args[0])
+			switch args[0] {
+			case "GET":
+				if value, ok := data[args[1]]; ok {
+					fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(value), value)
+				} else if args[1] == "list" {
+					io.WriteString(conn, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+				} else {
+					io.WriteString(conn, "$-1\r\n")
+				}
+			case "SET":
+				data[args[1]] = args[2]
+				io.WriteString(conn, "+OK\r\n")
+			case "DEL":
+				delete(data, args[1])
+				io.WriteString(conn, ":1\r\n")
+			default:
+				io.WriteString(conn, "+OK\r\n")
+			}
+			mu.Unlock()
+		}
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+	return ln.Addr().String(), func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), seen...)
+	}
+}
+
+func TestOpenRedis(t *testing.T) {
+	data := map[string]string{"users/1": "alice"}
+	addr, commands := fakeRedis(t, data)
+	up, err := Open("redis://:pw@" + addr + "/2")
+	if err != nil {
+		t.Fatalf("expected no error, but got %v", err)
+	}
+	ctx := context.Background()
+
+	// --- Test Case 1: Keys are read with GET on a set-up connection ---
+	if value, ok, err := up.Load(ctx, "users/1"); value != "alice" || !ok || err != nil {
+		t.Errorf("expected alice, but got %q, %v, %v", value, ok, err)
+	}
+	if _, ok, err := up.Load(ctx, "users/2"); ok || err != nil {
+		t.Errorf("expected users/2 to be missing, but got %v, %v", ok, err)
+	}
+	if _, _, err := up.Load(ctx, "list"); err == nil || !strings.Contains(err.Error(), "WRONGTYPE") {
+		t.Errorf("expected a WRONGTYPE error, but got %v", err)
+	}
+
+	// --- Test Case 2: Writes use SET and DEL, over the same connection ---
+	if err := up.Set(ctx, "users/2", "bob"); err != nil {
+		t.Errorf("expected no error, but got %v", err)
+	}
+	if err := up.Delete(ctx, "users/1"); err != nil {
+		t.Errorf("expected no error, but got %v", err)
+	}
+	if got := fmt.Sprint(commands()); got != "[AUTH SELECT GET GET GET SET DEL]" {
+		t.Errorf("expected one connection set up once, but got %s", got)
+	}
+}
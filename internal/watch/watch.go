@@ -0,0 +1,327 @@
+// Package watch delivers committed changes to keys to watchers in Raft log
+// order. Every change carries a revision, the log index of the write that
+// made it, and recent changes are kept in a bounded in-memory history so
+// that a watcher that disconnects can resume from the last revision it saw
+// without missing any, and change-data-capture consumers can poll for
+// changes without a separate event log.
+package watch
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for the history a Hub keeps.
+const (
+	DefaultSize   = 10000
+	DefaultMaxAge = time.Hour
+)
+
+// watcherBuffer is how many live events a watcher may fall behind by before
+// it is cancelled.
+const watcherBuffer = 1024
+
+// ErrCompacted is returned by Watch, and reported by cancelled watchers, when
+// events after the requested revision are no longer in the backlog.
+var ErrCompacted = errors.New("watch: revision has been compacted")
+
+// ErrFellBehind is reported by a watcher that was cancelled because it did
+// not keep up. It can resume from the last revision it received.
+var ErrFellBehind = errors.New("watch: watcher fell behind")
+
+// Event types.
+const (
+	Put    = "PUT"
+	Delete = "DELETE"
+)
+
+// Event is a committed change to one key. The keys changed by one write,
+// such as a transaction, share its revision.
+type Event struct {
+	Revision uint64 // Raft log index of the write
+	Type     string // Put or Delete
+	Key      string
+	Value    string    // Empty for Delete
+	Version  uint64    // The key's version after the change
+	Time     time.Time // When the leader appended the write to its log, if known
+}
+
+// Option configures a Hub.
+type Option func(*Hub)
+
+// WithSize sets how many recent events the hub keeps. 0 keeps none, so
+// watches can only start live.
+func WithSize(n int) Option {
+	return func(h *Hub) {
+		h.size = max(n, 0)
+	}
+}
+
+// WithMaxAge drops events from the history once they have been kept for d.
+// 0 keeps events until the history is full.
+func WithMaxAge(d time.Duration) Option {
+	return func(h *Hub) {
+		h.maxAge = d
+	}
+}
+
+// Hub fans committed events out to watchers and keeps a history of the most
+// recent ones in a ring buffer.
+type Hub struct {
+	mu        sync.Mutex
+	size      int
+	maxAge    time.Duration
+	now       func() time.Time
+	ring      []entry // Allocated up to size as events arrive
+	start     int     // Position of the oldest event in ring
+	count     int     // Number of events in ring
+	compacted uint64  // Events at or below this revision may be missing from the history
+	revision  uint64  // Revision of the last event published
+	watchers  map[*Watcher]struct{}
+}
+
+// entry is an event in a Hub's history, with when the hub received it.
+type entry struct {
+	Event
+	added time.Time
+}
+
+// NewHub returns a Hub that keeps DefaultSize events for up to
+// DefaultMaxAge unless opts say otherwise. revision is the log index the
+// node's store already reflects; earlier events were never published to the
+// Hub, so watches cannot resume from before it.
+func NewHub(revision uint64, opts ...Option) *Hub {
+	h := &Hub{
+		size:      DefaultSize,
+		maxAge:    DefaultMaxAge,
+		now:       time.Now,
+		compacted: revision,
+		revision:  revision,
+		watchers:  make(map[*Watcher]struct{}),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Revision returns the revision of the last event published, and the
+// revision at or below which events may be missing from the history.
+func (h *Hub) Revision() (revision, compacted uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.expire()
+	return h.revision, h.compacted
+}
+
+// Len returns the number of events in the history.
+func (h *Hub) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.expire()
+	return h.count
+}
+
+// at returns the i'th oldest event in the history. The caller must hold h.mu.
+func (h *Hub) at(i int) *entry {
+	return &h.ring[(h.start+i)%len(h.ring)]
+}
+
+// add appends e to the history, dropping the oldest event if it is full.
+// The caller must hold h.mu.
+func (h *Hub) add(e Event) {
+	if h.size == 0 {
+		h.compacted = max(h.compacted, e.Revision)
+		return
+	}
+	if h.count == h.size {
+		h.drop()
+	}
+	if len(h.ring) < h.size && h.count == len(h.ring) {
+		// Grow towards size, keeping the events in order from position 0.
+		ring := make([]entry, min(max(2*len(h.ring), 64), h.size))
+		for i := range h.count {
+			ring[i] = *h.at(i)
+		}
+		h.ring, h.start = ring, 0
+	}
+	*h.at(h.count) = entry{Event: e, added: h.now()}
+	h.count++
+}
+
+// drop forgets the oldest event in the history. The caller must hold h.mu.
+func (h *Hub) drop() {
+	oldest := h.at(0)
+	h.compacted = max(h.compacted, oldest.Revision)
+	*oldest = entry{}
+	h.start = (h.start + 1) % len(h.ring)
+	h.count--
+}
+
+// expire forgets the events older than the hub's maximum age. The caller
+// must hold h.mu.
+func (h *Hub) expire() {
+	if h.maxAge <= 0 {
+		return
+	}
+	cutoff := h.now().Add(-h.maxAge)
+	for h.count > 0 && h.at(0).added.Before(cutoff) {
+		h.drop()
+	}
+}
+
+// Publish records the events of one write, in order, and delivers them to
+// matching watchers. Watchers whose buffer is full are cancelled with
+// ErrFellBehind rather than holding up the caller.
+func (h *Hub) Publish(events ...Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.expire()
+	for _, e := range events {
+		h.revision = max(h.revision, e.Revision)
+		h.add(e)
+		for w := range h.watchers {
+			if !w.matches(e) {
+				continue
+			}
+			select {
+			case w.ch <- e:
+			default:
+				h.cancel(w, ErrFellBehind)
+			}
+		}
+	}
+}
+
+// Reset forgets the history and cancels every watcher with ErrCompacted,
+// for when the store jumps to revision without its changes being
+// published, as when a snapshot is restored.
+func (h *Hub) Reset(revision uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ring, h.start, h.count = nil, 0, 0
+	h.revision, h.compacted = revision, revision
+	for w := range h.watchers {
+		h.cancel(w, ErrCompacted)
+	}
+}
+
+// Watch starts watching key, or every key starting with key if prefix is
+// set. With since 0 it delivers changes committed from now on; otherwise it
+// first delivers the changes in the history after revision since, and
+// returns ErrCompacted if some of them are no longer there.
+func (h *Hub) Watch(key string, prefix bool, since uint64) (*Watcher, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.expire()
+	if since == 0 {
+		since = h.revision
+	}
+	if since < h.compacted {
+		return nil, ErrCompacted
+	}
+	w := &Watcher{key: key, prefix: prefix, since: since, hub: h, Revision: h.revision}
+	backlog, _ := h.since(w, 0)
+	w.ch = make(chan Event, len(backlog)+watcherBuffer)
+	for _, e := range backlog {
+		w.ch <- e
+	}
+	h.watchers[w] = struct{}{}
+	return w, nil
+}
+
+// Changes returns up to limit of the changes to key, or to every key
+// starting with key if prefix is set, after revision since, oldest first.
+// All of them are returned if limit is 0, and more reports whether some
+// were left out. It returns ErrCompacted if some changes after since are
+// no longer in the history. Unlike Watch, it suits consumers that poll,
+// passing the revision of the last change they processed.
+func (h *Hub) Changes(key string, prefix bool, since uint64, limit int) (events []Event, more bool, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.expire()
+	if since < h.compacted {
+		return nil, false, ErrCompacted
+	}
+	events, more = h.since(&Watcher{key: key, prefix: prefix, since: since}, limit)
+	return events, more, nil
+}
+
+// since returns up to limit events in the history that w wants, or all of
+// them if limit is 0, and whether some were left out. A write's events are
+// never split, so more than limit may be returned. The caller must hold
+// h.mu.
+func (h *Hub) since(w *Watcher, limit int) (events []Event, more bool) {
+	// The history is in revision order.
+	first := sort.Search(h.count, func(i int) bool { return h.at(i).Revision > w.since })
+	for i := first; i < h.count; i++ {
+		e := h.at(i).Event
+		if !w.matches(e) {
+			continue
+		}
+		if limit > 0 && len(events) >= limit && e.Revision != events[len(events)-1].Revision {
+			return events, true
+		}
+		events = append(events, e)
+	}
+	return events, false
+}
+
+// cancel stops delivering to w, closing its channel with err. The caller
+// must hold h.mu.
+func (h *Hub) cancel(w *Watcher, err error) {
+	if _, ok := h.watchers[w]; !ok {
+		return
+	}
+	delete(h.watchers, w)
+	w.err = err
+	close(w.ch)
+}
+
+// Watcher receives the events for a watched key or prefix.
+type Watcher struct {
+	// Revision is the hub's revision when the watch started. Events after it
+	// are live; a resumed watch delivers events from the history up to it
+	// first.
+	Revision uint64
+
+	key    string
+	prefix bool
+	since  uint64
+	hub    *Hub
+	ch     chan Event
+	err    error // Set before ch is closed
+}
+
+// Events returns the channel events are delivered on, in revision order. It
+// is closed when the watcher is cancelled; Err then says why.
+func (w *Watcher) Events() <-chan Event {
+	return w.ch
+}
+
+// Err returns why Events was closed: ErrFellBehind, ErrCompacted, or nil
+// after Close.
+func (w *Watcher) Err() error {
+	return w.err
+}
+
+// Close stops the watch.
+func (w *Watcher) Close() {
+	w.hub.mu.Lock()
+	defer w.hub.mu.Unlock()
+	w.hub.cancel(w, nil)
+}
+
+// matches reports whether e is a change w wants.
+func (w *Watcher) matches(e Event) bool {
+	if e.Revision <= w.since {
+		return false
+	}
+	if w.prefix {
+		return strings.HasPrefix(e.Key, w.key)
+	}
+	return e.Key == w.key
+}
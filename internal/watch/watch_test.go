@@ -0,0 +1,166 @@
+// Package watch_test contains the unit tests for the watch package.
+package watch
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// drain returns the events already delivered to w.
+func drain(w *Watcher) []Event {
+	var events []Event
+	for {
+		select {
+		case e, ok := <-w.Events():
+			if !ok {
+				return events
+			}
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
+
+func TestHub(t *testing.T) {
+	h := NewHub(10, WithSize(3))
+
+	// --- Test Case 1: Watches cannot resume from before the hub's start ---
+	if _, err := h.Watch("a", false, 9); !errors.Is(err, ErrCompacted) {
+		t.Errorf("expected ErrCompacted, but got %v", err)
+	}
+
+	// --- Test Case 2: A live watch sees only matching changes ---
+	live, err := h.Watch("a", true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer live.Close()
+	if live.Revision != 10 {
+		t.Errorf("expected the watch to start at revision 10, but got %d", live.Revision)
+	}
+	h.Publish(Event{Revision: 11, Type: Put, Key: "a/1", Value: "x", Version: 1})
+	h.Publish(Event{Revision: 12, Type: Put, Key: "b", Value: "y", Version: 1})
+	h.Publish(Event{Revision: 13, Type: Put, Key: "a/1", Value: "z", Version: 2}, Event{Revision: 13, Type: Delete, Key: "a/2", Version: 4})
+	events := drain(live)
+	if len(events) != 3 || events[0].Revision != 11 || events[2].Type != Delete {
+		t.Errorf("expected the three changes under a, but got %+v", events)
+	}
+
+	// --- Test Case 3: A resumed watch replays the backlog after its revision ---
+	resumed, err := h.Watch("a/1", false, 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resumed.Close()
+	h.Publish(Event{Revision: 14, Type: Put, Key: "a/1", Value: "w", Version: 3})
+	events = drain(resumed)
+	if len(events) != 2 || events[0].Revision != 13 || events[1].Revision != 14 {
+		t.Errorf("expected revisions 13 and 14, but got %+v", events)
+	}
+
+	// --- Test Case 4: Revisions trimmed from the backlog are compacted ---
+	// The backlog now holds the last 3 events: 13, 13 and 14.
+	if _, err := h.Watch("a/1", false, 11); !errors.Is(err, ErrCompacted) {
+		t.Errorf("expected ErrCompacted resuming from 11, but got %v", err)
+	}
+	if _, compacted := h.Revision(); compacted != 12 {
+		t.Errorf("expected compaction through 12, but got %d", compacted)
+	}
+
+	// --- Test Case 5: A snapshot restore cancels every watcher ---
+	h.Reset(20)
+	if events := drain(live); len(events) != 1 {
+		t.Errorf("expected only the change at 14 before cancellation, but got %+v", events)
+	}
+	if !errors.Is(live.Err(), ErrCompacted) {
+		t.Errorf("expected the watcher to be cancelled with ErrCompacted, but got %v", live.Err())
+	}
+	if _, err := h.Watch("a", false, 14); !errors.Is(err, ErrCompacted) {
+		t.Errorf("expected ErrCompacted after the reset, but got %v", err)
+	}
+}
+
+func TestHubSlowWatcher(t *testing.T) {
+	h := NewHub(0)
+	w, err := h.Watch("k", false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// --- Test Case 1: A watcher that falls behind is cancelled ---
+	for i := uint64(1); i <= watcherBuffer+1; i++ {
+		h.Publish(Event{Revision: i, Type: Put, Key: "k", Version: i})
+	}
+	events := drain(w)
+	if len(events) != watcherBuffer {
+		t.Errorf("expected %d buffered events, but got %d", watcherBuffer, len(events))
+	}
+	if !errors.Is(w.Err(), ErrFellBehind) {
+		t.Errorf("expected ErrFellBehind, but got %v", w.Err())
+	}
+
+	// --- Test Case 2: It can resume from the last revision it received ---
+	w, err = h.Watch("k", false, events[len(events)-1].Revision)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if events := drain(w); len(events) != 1 || events[0].Revision != watcherBuffer+1 {
+		t.Errorf("expected the missed event, but got %+v", events)
+	}
+}
+
+func TestHubHistory(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	h := NewHub(0, WithSize(100), WithMaxAge(time.Minute))
+	h.now = func() time.Time { return now }
+	for i := uint64(1); i <= 150; i++ {
+		h.Publish(Event{Revision: i, Type: Put, Key: "k", Version: i})
+	}
+
+	// --- Test Case 1: The history keeps the newest events, in order ---
+	if n := h.Len(); n != 100 {
+		t.Errorf("expected 100 events, but got %d", n)
+	}
+	events, more, err := h.Changes("k", false, 50, 0)
+	if err != nil || more || len(events) != 100 || events[0].Revision != 51 || events[99].Revision != 150 {
+		t.Errorf("expected revisions 51 to 150, but got %d events (more=%t, %v)", len(events), more, err)
+	}
+	if _, _, err := h.Changes("k", false, 49, 0); !errors.Is(err, ErrCompacted) {
+		t.Errorf("expected ErrCompacted before revision 50, but got %v", err)
+	}
+
+	// --- Test Case 2: Pages end at a limit without splitting a write ---
+	h.Publish(Event{Revision: 151, Type: Put, Key: "k"}, Event{Revision: 151, Type: Delete, Key: "k2"})
+	events, more, _ = h.Changes("k", true, 147, 3)
+	if len(events) != 3 || !more || events[2].Revision != 150 {
+		t.Errorf("expected revisions 148 to 150 with more to come, but got %+v (more=%t)", events, more)
+	}
+	events, more, _ = h.Changes("k", true, 150, 1)
+	if len(events) != 2 || more || events[1].Key != "k2" {
+		t.Errorf("expected both events at 151, but got %+v (more=%t)", events, more)
+	}
+
+	// --- Test Case 3: Events older than the maximum age are dropped ---
+	now = now.Add(30 * time.Second)
+	h.Publish(Event{Revision: 152, Type: Put, Key: "k"})
+	now = now.Add(45 * time.Second)
+	if n := h.Len(); n != 1 {
+		t.Errorf("expected only the newest event to be kept, but got %d", n)
+	}
+	if revision, compacted := h.Revision(); revision != 152 || compacted != 151 {
+		t.Errorf("expected revision 152 compacted through 151, but got %d and %d", revision, compacted)
+	}
+
+	// --- Test Case 4: A hub without history only allows live watches ---
+	h = NewHub(0, WithSize(0))
+	h.Publish(Event{Revision: 1, Type: Put, Key: "k"})
+	if _, err := h.Watch("k", false, 0); err != nil {
+		t.Errorf("expected a live watch to start, but got %v", err)
+	}
+	if _, _, err := h.Changes("k", false, 0, 0); !errors.Is(err, ErrCompacted) {
+		t.Errorf("expected ErrCompacted, but got %v", err)
+	}
+}
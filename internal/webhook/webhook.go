@@ -0,0 +1,204 @@
+// Package webhook POSTs committed changes to user URLs, so that external
+// systems can react to writes without polling. Each endpoint receives the
+// changes under its key prefix in revision order, one request per change,
+// signed with HMAC-SHA256 when it has a secret.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/watch"
+)
+
+// Headers set on every delivery.
+const (
+	// SignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the body,
+	// keyed with the endpoint's secret. It is omitted if there is no secret.
+	SignatureHeader = "X-Helios-Signature"
+	// RevisionHeader carries the revision of the change, which receivers can
+	// use to drop duplicates.
+	RevisionHeader = "X-Helios-Revision"
+)
+
+// Defaults for retrying failed deliveries.
+const (
+	DefaultAttempts   = 5
+	DefaultBackoff    = 500 * time.Millisecond
+	DefaultMaxBackoff = 30 * time.Second
+	DefaultTimeout    = 10 * time.Second
+)
+
+// Endpoint is a URL that receives the changes to keys starting with Prefix.
+type Endpoint struct {
+	Prefix string
+	URL    string
+	Secret string // Signs deliveries when set
+}
+
+// Option configures a Dispatcher.
+type Option func(*Dispatcher)
+
+// WithClient sends deliveries with c instead of a client with
+// DefaultTimeout.
+func WithClient(c *http.Client) Option {
+	return func(d *Dispatcher) {
+		d.client = c
+	}
+}
+
+// WithRetries makes up to attempts tries to deliver each change, waiting
+// backoff after the first failure and doubling the wait after each further
+// one, up to maxBackoff. A change that still fails is logged and skipped.
+func WithRetries(attempts int, backoff, maxBackoff time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.attempts = max(attempts, 1)
+		d.backoff = backoff
+		d.maxBackoff = maxBackoff
+	}
+}
+
+// Dispatcher delivers the changes published to a watch.Hub to endpoints.
+type Dispatcher struct {
+	endpoints  []Endpoint
+	client     *http.Client
+	attempts   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+// New returns a Dispatcher for endpoints.
+func New(endpoints []Endpoint, opts ...Option) *Dispatcher {
+	d := &Dispatcher{
+		endpoints:  endpoints,
+		client:     &http.Client{Timeout: DefaultTimeout},
+		attempts:   DefaultAttempts,
+		backoff:    DefaultBackoff,
+		maxBackoff: DefaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Run delivers changes to every endpoint until stop is closed. Only changes
+// applied while leader reports true are delivered, so that a cluster sends
+// each change once; one that is in flight when leadership moves may be
+// delivered twice or, if the new leader has not caught up, not at all.
+func (d *Dispatcher) Run(h *watch.Hub, leader func() bool, stop <-chan struct{}) {
+	done := make(chan struct{})
+	for _, e := range d.endpoints {
+		go func() {
+			d.run(e, h, leader, stop)
+			done <- struct{}{}
+		}()
+	}
+	for range d.endpoints {
+		<-done
+	}
+}
+
+// run delivers the changes under e's prefix one at a time. An endpoint too
+// slow to keep up resumes from the hub's history where it left off, and
+// skips ahead, with a log line, if that history is gone.
+func (d *Dispatcher) run(e Endpoint, h *watch.Hub, leader func() bool, stop <-chan struct{}) {
+	var since uint64
+	for {
+		w, err := h.Watch(e.Prefix, true, since)
+		if errors.Is(err, watch.ErrCompacted) {
+			log.Printf("Webhook %s: changes after revision %d are no longer buffered; skipping to the latest", e.URL, since)
+			since = 0
+			continue
+		}
+	deliver:
+		for {
+			select {
+			case <-stop:
+				w.Close()
+				return
+			case ev, ok := <-w.Events():
+				if !ok {
+					break deliver
+				}
+				if leader() {
+					d.deliver(e, ev, stop)
+				}
+				since = ev.Revision
+			}
+		}
+		if errors.Is(w.Err(), watch.ErrCompacted) {
+			// The store was replaced by a snapshot, so the changes since
+			// were never applied here.
+			since = 0
+		}
+	}
+}
+
+// deliver POSTs ev to e, retrying until it is accepted, the attempts run
+// out or stop is closed.
+func (d *Dispatcher) deliver(e Endpoint, ev watch.Event, stop <-chan struct{}) {
+	body, err := json.Marshal(v1.WatchEvent{Revision: ev.Revision, Type: ev.Type, Key: ev.Key, Value: ev.Value, Version: ev.Version, Time: ev.Time})
+	if err != nil {
+		log.Printf("Webhook %s: failed to encode change at revision %d: %v", e.URL, ev.Revision, err)
+		return
+	}
+	wait := d.backoff
+	for attempt := 1; ; attempt++ {
+		err := d.post(e, ev.Revision, body)
+		if err == nil {
+			return
+		}
+		if attempt == d.attempts {
+			log.Printf("Webhook %s: giving up on %s %q at revision %d after %d attempts: %v", e.URL, ev.Type, ev.Key, ev.Revision, attempt, err)
+			return
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(wait):
+		}
+		wait = min(wait*2, d.maxBackoff)
+	}
+}
+
+// post sends one delivery, failing on any status other than 2xx.
+func (d *Dispatcher) post(e Endpoint, revision uint64, body []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, e.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(RevisionHeader, strconv.FormatUint(revision, 10))
+	if e.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(e.Secret, body))
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign returns the SignatureHeader value for body, for receivers to compare
+// with hmac.Equal.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,135 @@
+// Package webhook_test contains the unit tests for the webhook package.
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "github.com/ASHISH26940/heliosdb/api/v1"
+	"github.com/ASHISH26940/heliosdb/internal/watch"
+)
+
+// receiver records the deliveries it accepts, failing the first failures
+// requests it gets.
+type receiver struct {
+	mu         sync.Mutex
+	failures   int
+	events     []v1.WatchEvent
+	signatures []string
+	received   chan struct{}
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.failures > 0 {
+		rc.failures--
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	var e v1.WatchEvent
+	json.Unmarshal(body, &e)
+	rc.events = append(rc.events, e)
+	rc.signatures = append(rc.signatures, r.Header.Get(SignatureHeader))
+	if r.Header.Get(SignatureHeader) != Sign("s3cret", body) {
+		rc.signatures[len(rc.signatures)-1] = "invalid"
+	}
+	rc.received <- struct{}{}
+}
+
+func TestDispatcher(t *testing.T) {
+	rc := &receiver{failures: 2, received: make(chan struct{}, 10)}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	h := watch.NewHub(0)
+	// The dispatcher asks whether this node is the leader once per change.
+	asked, answers := make(chan struct{}), make(chan bool)
+	leader := func() bool {
+		asked <- struct{}{}
+		return <-answers
+	}
+	d := New([]Endpoint{{Prefix: "users/", URL: srv.URL, Secret: "s3cret"}}, WithRetries(3, time.Millisecond, time.Millisecond))
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		d.Run(h, leader, stop)
+		close(done)
+	}()
+	// Publish until the endpoint's watch has started and sees a change.
+	revision := uint64(0)
+	publish := func(e watch.Event) {
+		revision++
+		e.Revision = revision
+		h.Publish(e)
+	}
+	for started := false; !started; {
+		publish(watch.Event{Type: watch.Put, Key: "users/warmup", Value: "x", Version: revision + 1})
+		select {
+		case <-asked:
+			answers <- false
+			started = true
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	// Skip any other warm-up changes the watch caught.
+	for skipped := false; !skipped; {
+		select {
+		case <-asked:
+			answers <- false
+		case <-time.After(50 * time.Millisecond):
+			skipped = true
+		}
+	}
+	wait := func() {
+		t.Helper()
+		select {
+		case <-rc.received:
+		case <-time.After(2 * time.Second):
+			t.Fatal("expected a delivery, but got none")
+		}
+	}
+
+	// --- Test Case 1: Changes under the prefix are delivered, signed, after retries ---
+	publish(watch.Event{Type: watch.Put, Key: "other", Value: "x", Version: 1})
+	publish(watch.Event{Type: watch.Put, Key: "users/1", Value: "alice", Version: 1})
+	<-asked
+	answers <- true
+	wait()
+	rc.mu.Lock()
+	if len(rc.events) != 1 || rc.events[0].Key != "users/1" || rc.events[0].Revision != revision {
+		t.Errorf("expected the change to users/1 at revision %d, but got %+v", revision, rc.events)
+	}
+	if len(rc.signatures) != 1 || rc.signatures[0] == "invalid" {
+		t.Errorf("expected a valid signature, but got %v", rc.signatures)
+	}
+	rc.mu.Unlock()
+
+	// --- Test Case 2: Changes applied while not the leader are not delivered ---
+	publish(watch.Event{Type: watch.Delete, Key: "users/1", Version: 2})
+	<-asked
+	answers <- false
+	publish(watch.Event{Type: watch.Put, Key: "users/2", Value: "bob", Version: 1})
+	<-asked
+	answers <- true
+	wait()
+	rc.mu.Lock()
+	if len(rc.events) != 2 || rc.events[1].Key != "users/2" {
+		t.Errorf("expected only the change to users/2 to follow, but got %+v", rc.events)
+	}
+	rc.mu.Unlock()
+
+	// --- Test Case 3: Run returns once stopped ---
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("expected Run to return after stop, but it did not")
+	}
+}
@@ -0,0 +1,352 @@
+// Package helios embeds a HeliosDB node in a Go program: the replicated
+// store, Raft and the write-ahead log run in-process and are used through
+// method calls instead of HTTP, much like embedding etcd or bbolt.
+//
+//	db, err := helios.Open("data")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer db.Close()
+//	err = db.Set("users/ada", "hello")
+//	value, _, ok := db.Get("users/ada")
+//
+// By default the node is a single-member cluster with no network listener.
+// WithRaft makes it reachable by other nodes, which join it with Join.
+package helios
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/ASHISH26940/heliosdb/internal/persistence"
+	internal_raft "github.com/ASHISH26940/heliosdb/internal/raft"
+	"github.com/ASHISH26940/heliosdb/internal/server"
+	"github.com/ASHISH26940/heliosdb/internal/store"
+	"github.com/hashicorp/raft"
+	"github.com/hashicorp/raft-boltdb"
+)
+
+// ErrNotLeader is returned by writes on a node that is not the Raft leader.
+var ErrNotLeader = errors.New("helios: not the leader")
+
+// ErrVersionConflict is returned by CompareAndSwap when the key's version no
+// longer matches.
+var ErrVersionConflict = store.ErrVersionConflict
+
+// DB is an embedded HeliosDB node.
+type DB struct {
+	store     *store.Store
+	fsm       *internal_raft.FSM
+	raft      *raft.Raft
+	wal       *persistence.WAL
+	logs      *raftboltdb.BoltStore
+	transport raft.Transport
+	timeout   time.Duration
+	stop      chan struct{} // Closed by Close to stop the tombstone purger and scheduler
+	caughtUp  atomic.Uint64 // Term in which this node, as leader, has applied every earlier term's writes
+}
+
+type options struct {
+	nodeID        string
+	bindAddr      string
+	advertiseAddr string
+	bootstrap     bool
+	keyFile       string
+	timeout       time.Duration
+	logOutput     io.Writer
+	retention     time.Duration
+}
+
+// Option configures Open.
+type Option func(*options)
+
+// WithNodeID sets the node's Raft ID. It defaults to "node1".
+func WithNodeID(id string) Option {
+	return func(o *options) {
+		o.nodeID = id
+	}
+}
+
+// WithRaft serves Raft on bindAddr over TCP, advertising advertiseAddr to
+// other nodes (bindAddr if empty). Without it the node has no listener and
+// can only be a cluster of one.
+func WithRaft(bindAddr, advertiseAddr string) Option {
+	return func(o *options) {
+		o.bindAddr = bindAddr
+		o.advertiseAddr = advertiseAddr
+	}
+}
+
+// WithBootstrap controls whether a node with no existing Raft state creates
+// a new cluster with itself as its only member. It defaults to true; nodes
+// that will Join an existing cluster must pass false.
+func WithBootstrap(bootstrap bool) Option {
+	return func(o *options) {
+		o.bootstrap = bootstrap
+	}
+}
+
+// WithEncryptionKeyFile encrypts the WAL at rest with the keyring at path,
+// in the format used by the encryption_key_file config option.
+func WithEncryptionKeyFile(path string) Option {
+	return func(o *options) {
+		o.keyFile = path
+	}
+}
+
+// WithApplyTimeout bounds how long a write waits to be committed. It
+// defaults to 10 seconds.
+func WithApplyTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// WithTombstoneRetention sets how long deleted keys are remembered before
+// their tombstones are purged. It defaults to 24 hours; 0 keeps them forever.
+func WithTombstoneRetention(d time.Duration) Option {
+	return func(o *options) {
+		o.retention = d
+	}
+}
+
+// WithLogOutput sends Raft's log to w instead of stderr.
+func WithLogOutput(w io.Writer) Option {
+	return func(o *options) {
+		o.logOutput = w
+	}
+}
+
+// Open starts a node whose state lives in dir, creating it if needed, and
+// replays its WAL before returning. A bootstrapped node may take a moment to
+// elect itself; use WaitForLeader before writing.
+func Open(dir string, opts ...Option) (*DB, error) {
+	o := options{nodeID: "node1", bootstrap: true, timeout: 10 * time.Second, logOutput: os.Stderr, retention: 24 * time.Hour}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	var keyring *persistence.Keyring
+	if o.keyFile != "" {
+		var err error
+		if keyring, err = persistence.LoadKeyring(o.keyFile); err != nil {
+			return nil, fmt.Errorf("helios: failed to load encryption keyring: %w", err)
+		}
+	}
+
+	snapshots, err := raft.NewFileSnapshotStore(dir, 2, o.logOutput)
+	if err != nil {
+		return nil, err
+	}
+	st := store.NewStore()
+	walPath := filepath.Join(dir, "app.wal")
+	recovery, err := internal_raft.Recover(st, snapshots, walPath, keyring, runtime.NumCPU())
+	if err != nil {
+		return nil, fmt.Errorf("helios: failed to recover store: %w", err)
+	}
+	wal, err := persistence.NewPipelinedWAL(walPath, keyring, 1024, persistence.WithSegmentBytes(persistence.DefaultSegmentBytes))
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{store: st, wal: wal, timeout: o.timeout, stop: make(chan struct{})}
+	db.fsm = internal_raft.NewFSM(st, wal)
+	db.fsm.SetAppliedIndex(recovery.Index)
+	if err := db.startRaft(dir, snapshots, recovery.SkipRestore, o); err != nil {
+		db.Close()
+		return nil, err
+	}
+	go internal_raft.RunTombstonePurger(db.raft, st, o.retention, db.stop)
+	go internal_raft.RunScheduler(db.raft, db.fsm, db.stop)
+	return db, nil
+}
+
+func (db *DB) startRaft(dir string, snapshots raft.SnapshotStore, skipRestore bool, o options) error {
+	cfg := raft.DefaultConfig()
+	cfg.LocalID = raft.ServerID(o.nodeID)
+	cfg.LogOutput = o.logOutput
+	cfg.NoSnapshotRestoreOnStart = skipRestore
+
+	var addr raft.ServerAddress
+	if o.bindAddr == "" {
+		addr, db.transport = raft.NewInmemTransport(raft.ServerAddress(o.nodeID))
+	} else {
+		advertise := o.advertiseAddr
+		if advertise == "" {
+			advertise = o.bindAddr
+		}
+		tcpAddr, err := net.ResolveTCPAddr("tcp", advertise)
+		if err != nil {
+			return fmt.Errorf("helios: failed to resolve Raft advertise address: %w", err)
+		}
+		transport, err := raft.NewTCPTransport(o.bindAddr, tcpAddr, 3, 10*time.Second, o.logOutput)
+		if err != nil {
+			return fmt.Errorf("helios: failed to create Raft transport: %w", err)
+		}
+		addr, db.transport = transport.LocalAddr(), transport
+	}
+
+	var err error
+	db.logs, err = raftboltdb.NewBoltStore(filepath.Join(dir, "raft.db"))
+	if err != nil {
+		return err
+	}
+	db.raft, err = raft.NewRaft(cfg, db.fsm, db.logs, db.logs, snapshots, db.transport)
+	if err != nil {
+		return err
+	}
+
+	if o.bootstrap {
+		existing, err := raft.HasExistingState(db.logs, db.logs, snapshots)
+		if err != nil {
+			return err
+		}
+		if !existing {
+			return db.raft.BootstrapCluster(raft.Configuration{
+				Servers: []raft.Server{{ID: cfg.LocalID, Address: addr}},
+			}).Error()
+		}
+	}
+	return nil
+}
+
+// Close shuts the node down and flushes its WAL.
+func (db *DB) Close() error {
+	close(db.stop)
+	var err error
+	if db.raft != nil {
+		err = db.raft.Shutdown().Error()
+	}
+	if c, ok := db.transport.(io.Closer); ok {
+		c.Close()
+	}
+	if db.logs != nil {
+		db.logs.Close()
+	}
+	if werr := db.wal.Close(); err == nil {
+		err = werr
+	}
+	return err
+}
+
+// WaitForLeader blocks until the cluster has a leader, or ctx is done.
+func (db *DB) WaitForLeader(ctx context.Context) error {
+	for {
+		if addr, _ := db.raft.LeaderWithID(); addr != "" {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// IsLeader reports whether this node is the Raft leader, and so accepts writes.
+func (db *DB) IsLeader() bool {
+	return db.raft.State() == raft.Leader
+}
+
+// Leader returns the Raft address of the current leader, or "" if there is none.
+func (db *DB) Leader() string {
+	return string(db.raft.Leader())
+}
+
+// Join adds the node with the given ID and Raft address to the cluster as a
+// voter. It must be called on the leader.
+func (db *DB) Join(nodeID, addr string) error {
+	if !db.IsLeader() {
+		return ErrNotLeader
+	}
+	return db.raft.AddVoter(raft.ServerID(nodeID), raft.ServerAddress(addr), 0, db.timeout).Error()
+}
+
+// Get returns the value and version of key from this node's store. On a
+// follower the value may lag the leader's.
+func (db *DB) Get(key string) (value string, version uint64, ok bool) {
+	vv, ok := db.store.Get(key)
+	return vv.Value, vv.Version, ok
+}
+
+// GetConsistent is Get, after confirming with a quorum that this node is
+// still the leader, so the value reflects every committed write. The first
+// call in each term also waits until the leader has applied the writes
+// committed before it was elected.
+func (db *DB) GetConsistent(key string) (value string, version uint64, ok bool, err error) {
+	if term := db.raft.CurrentTerm(); db.caughtUp.Load() != term {
+		if err := db.raft.Barrier(db.timeout).Error(); err != nil {
+			return "", 0, false, ErrNotLeader
+		}
+		db.caughtUp.Store(term)
+	}
+	if err := db.raft.VerifyLeader().Error(); err != nil {
+		return "", 0, false, ErrNotLeader
+	}
+	value, version, ok = db.Get(key)
+	return value, version, ok, nil
+}
+
+// Set writes value to key through Raft.
+func (db *DB) Set(key, value string) error {
+	return db.apply(internal_raft.Command{Op: "SET", Key: key, Value: value})
+}
+
+// Delete removes key through Raft.
+func (db *DB) Delete(key string) error {
+	return db.apply(internal_raft.Command{Op: "DELETE", Key: key})
+}
+
+// CompareAndSwap writes value to key only if the key is still at
+// expectedVersion (0 means it must not exist), and returns
+// ErrVersionConflict otherwise.
+func (db *DB) CompareAndSwap(key, value string, expectedVersion uint64) error {
+	return db.apply(internal_raft.Command{Op: "CAS", Key: key, Value: value, ExpectedVersion: expectedVersion})
+}
+
+func (db *DB) apply(cmd internal_raft.Command) error {
+	if !db.IsLeader() {
+		return ErrNotLeader
+	}
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+	future := db.raft.Apply(data, db.timeout)
+	if err := future.Error(); err != nil {
+		if errors.Is(err, raft.ErrNotLeader) || errors.Is(err, raft.ErrLeadershipLost) {
+			return ErrNotLeader
+		}
+		return err
+	}
+	if err, ok := future.Response().(error); ok {
+		return err
+	}
+	return nil
+}
+
+// Compact snapshots the node, letting Raft truncate its log, and rewrites
+// the WAL as the store's current contents. It returns the bytes of WAL
+// reclaimed.
+func (db *DB) Compact() (reclaimed int64, err error) {
+	res, err := internal_raft.Compact(db.raft, db.fsm)
+	return res.WALBytesBefore - res.WALBytesAfter, err
+}
+
+// Handler returns the node's HTTP API, for programs that also want to serve
+// it to other processes.
+func (db *DB) Handler() http.Handler {
+	return server.New(db.store, db.raft)
+}
@@ -0,0 +1,107 @@
+// Package helios_test contains the unit tests for the helios package.
+package helios
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func openTest(t *testing.T, dir string, opts ...Option) *DB {
+	t.Helper()
+	db, err := Open(dir, append([]Option{WithLogOutput(io.Discard)}, opts...)...)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	return db
+}
+
+func TestDB(t *testing.T) {
+	dir := t.TempDir()
+	db := openTest(t, dir)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := db.WaitForLeader(ctx); err != nil {
+		t.Fatalf("expected the node to elect itself, but got %v", err)
+	}
+
+	// --- Test Case 1: Set and Get ---
+	if err := db.Set("a", "1"); err != nil {
+		t.Fatalf("expected the write to succeed, but got %v", err)
+	}
+	if value, version, ok := db.Get("a"); !ok || value != "1" || version != 1 {
+		t.Errorf("expected a=1 at version 1, but got %q at %d (found %v)", value, version, ok)
+	}
+	if value, _, ok, err := db.GetConsistent("a"); err != nil || !ok || value != "1" {
+		t.Errorf("expected a consistent read of 1, but got %q, %v", value, err)
+	}
+
+	// --- Test Case 2: Compare-and-swap ---
+	if err := db.CompareAndSwap("a", "2", 7); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("expected ErrVersionConflict, but got %v", err)
+	}
+	if err := db.CompareAndSwap("a", "2", 1); err != nil {
+		t.Errorf("expected the swap to succeed, but got %v", err)
+	}
+
+	// --- Test Case 3: Delete ---
+	db.Set("b", "x")
+	if err := db.Delete("b"); err != nil {
+		t.Fatalf("expected the delete to succeed, but got %v", err)
+	}
+	if _, _, ok := db.Get("b"); ok {
+		t.Error("expected b to be deleted, but it still exists")
+	}
+
+	// --- Test Case 4: The HTTP API serves the same store ---
+	rr := httptest.NewRecorder()
+	db.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/kv/a", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status %d, but got %d", http.StatusOK, rr.Code)
+	}
+
+	// --- Test Case 5: Compaction ---
+	for i := 0; i < 20; i++ {
+		db.Set("c", "overwritten")
+	}
+	if reclaimed, err := db.Compact(); err != nil || reclaimed <= 0 {
+		t.Errorf("expected compaction to reclaim WAL bytes, but got %d (err %v)", reclaimed, err)
+	}
+
+	// --- Test Case 6: Data survives a restart ---
+	if err := db.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	db = openTest(t, dir)
+	defer db.Close()
+	if value, _, ok := db.Get("a"); !ok || value != "2" {
+		t.Errorf("expected a=2 after reopening, but got %q (found %v)", value, ok)
+	}
+
+	// --- Test Case 7: Raft's log replay does not re-apply what recovery restored ---
+	if err := db.WaitForLeader(ctx); err != nil {
+		t.Fatalf("expected the node to elect itself, but got %v", err)
+	}
+	if err := db.Set("d", "1"); err != nil {
+		t.Fatalf("expected the write to succeed, but got %v", err)
+	}
+	if _, version, _ := db.Get("c"); version != 20 {
+		t.Errorf("expected c to stay at version 20, but got %d", version)
+	}
+}
+
+func TestNotLeader(t *testing.T) {
+	// --- Test Case 1: A node that has not joined a cluster refuses writes ---
+	db := openTest(t, t.TempDir(), WithBootstrap(false))
+	defer db.Close()
+	if err := db.Set("a", "1"); !errors.Is(err, ErrNotLeader) {
+		t.Errorf("expected ErrNotLeader, but got %v", err)
+	}
+	if err := db.Join("node2", "127.0.0.1:1"); !errors.Is(err, ErrNotLeader) {
+		t.Errorf("expected ErrNotLeader from Join, but got %v", err)
+	}
+}